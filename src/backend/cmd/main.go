@@ -7,18 +7,17 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"owlistic-notes/owlistic/broker"
 	"owlistic-notes/owlistic/config"
 	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/middleware"
-	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/prompts"
 	"owlistic-notes/owlistic/routes"
 	"owlistic-notes/owlistic/services"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func main() {
@@ -30,6 +29,21 @@ func main() {
 	}
 	defer db.Close()
 
+	// Calendar tokens are stored encrypted; refuse to start without the key
+	// once there are tokens to protect
+	if err := services.PrepareCalendarTokenEncryption(db.DB); err != nil {
+		log.Fatalf("Failed to prepare calendar token encryption: %v", err)
+	}
+
+	if err := services.CheckChromaEnv(); err != nil {
+		log.Fatalf("Invalid ChromaDB settings: %v", err)
+	}
+
+	// Load AI prompt templates, falling back to the built-in defaults
+	if err := prompts.Load(os.Getenv("AI_PROMPTS_DIR")); err != nil {
+		log.Printf("Warning: Failed to load prompt templates: %v", err)
+	}
+
 	// Initialize producer
 	err = broker.InitProducer(cfg)
 	if err != nil {
@@ -52,11 +66,30 @@ func main() {
 	services.BlockServiceInstance = services.NewBlockService()
 	services.TaskServiceInstance = services.NewTaskService()
 	services.TrashServiceInstance = services.NewTrashService()
+	services.NoteLockServiceInstance = services.NewNoteLockService()
+	services.AgendaServiceInstance = services.NewAgendaService()
 
-	// Initialize single user for single-user mode
-	if err := initializeSingleUser(db, cfg); err != nil {
-		log.Printf("Warning: Failed to initialize single user: %v", err)
-	}
+	// Event debugging: recent events, a live stream and event retention
+	debugEventService := services.NewDebugEventService(db)
+	services.DebugEventServiceInstance = debugEventService
+	debugEventService.Start(cfg)
+	defer debugEventService.Stop()
+
+	// Operators can pause AI work across the server; a pause survives restarts
+	services.AIPauseInstance = services.NewAIPause(db.DB)
+
+	// AI service and the auto-enhancement of notes whose settings ask for it
+	aiService := services.NewAIService(db.DB)
+	services.AIServiceInstance = aiService
+	autoEnhancer := services.NewAutoEnhancer(db.DB, aiService)
+	services.AutoEnhancerInstance = autoEnhancer
+	autoEnhancer.Start()
+	defer autoEnhancer.Stop()
+
+	// Edited notes are re-embedded in ChromaDB once their edits settle
+	chromaNoteSyncer := services.NewChromaNoteSyncer(aiService)
+	services.ChromaNoteSyncerInstance = chromaNoteSyncer
+	defer chromaNoteSyncer.Stop()
 
 	// Initialize eventHandler service with the database
 	eventHandlerService := services.NewEventHandlerService(db)
@@ -87,6 +120,7 @@ func main() {
 
 	// CORS middleware
 	router.Use(middleware.CORSMiddleware(cfg.AppOrigins))
+	router.Use(middleware.RequestIDMiddleware())
 
 	// Create public API groups
 	publicGroup := router.Group("/api/v1")
@@ -98,17 +132,31 @@ func main() {
 	// Register AI routes on public group for single-user mode
 	aiRoutes := routes.NewAIRoutes(db.DB)
 	aiRoutes.RegisterRoutes(publicGroup)
+	chromaRoutes := routes.NewChromaRoutes(db.DB)
+	chromaRoutes.RegisterRoutes(publicGroup.Group("/ai"))
 
 	// Register Agent Orchestrator routes on public group for single-user mode
 	orchestratorRoutes := routes.NewAgentOrchestratorRoutes(db.DB)
 	orchestratorRoutes.RegisterRoutes(publicGroup)
 
+	// Start scheduled chain execution
+	chainScheduler := orchestratorRoutes.Scheduler()
+	chainScheduler.Start()
+
 	// Register core routes on public group for single-user mode
 	routes.RegisterNoteRoutes(publicGroup, db, services.NoteServiceInstance)
+	routes.RegisterNoteLockRoutes(publicGroup, db, services.NoteLockServiceInstance)
+	routes.RegisterNoteTemplateRoutes(publicGroup, db, services.NoteTemplateServiceInstance)
+	routes.RegisterTagRoutes(publicGroup, db, services.TagServiceInstance)
+	routes.RegisterAISettingsRoutes(publicGroup, db, services.AISettingsServiceInstance)
 	routes.RegisterTaskRoutes(publicGroup, db, services.TaskServiceInstance)
 	routes.RegisterNotebookRoutes(publicGroup, db, services.NotebookServiceInstance)
 	routes.RegisterBlockRoutes(publicGroup, db, services.BlockServiceInstance)
+	routes.RegisterLinkRoutes(publicGroup, db, services.LinkServiceInstance)
 	routes.RegisterTrashRoutes(publicGroup, db, services.TrashServiceInstance)
+	routes.RegisterAgendaRoutes(publicGroup, db, services.AgendaServiceInstance)
+	routes.RegisterUsageRoutes(publicGroup, db)
+	routes.RegisterWebhookRoutes(publicGroup, db, services.WebhookServiceInstance)
 
 	// Create protected API group with auth middleware (for future multi-user features)
 	protectedGroup := router.Group("/api/v1")
@@ -117,13 +165,19 @@ func main() {
 	// Register remaining protected API routes
 	routes.RegisterProtectedUserRoutes(protectedGroup, db, userService, authService)
 	routes.RegisterRoleRoutes(protectedGroup, db, services.RoleServiceInstance)
+	routes.RegisterAdminRoutes(protectedGroup, db, services.RoleServiceInstance, services.AIPauseInstance)
+	chromaRoutes.RegisterAdminRoutes(protectedGroup.Group("/ai"), db, services.RoleServiceInstance)
+	orchestratorRoutes.RegisterDebugRoutes(protectedGroup, services.RoleServiceInstance)
+	routes.SetupDebugRoutes(protectedGroup, db, services.RoleServiceInstance, debugEventService)
 
 	// Register WebSocket routes with consistent auth middleware
 	wsGroup := router.Group("/ws")
 	wsGroup.Use(middleware.AuthMiddleware(authService))
 	routes.RegisterWebSocketRoutes(wsGroup, webSocketService)
+	routes.RegisterDebugStreamRoutes(wsGroup, debugEventService)
 
 	// Register Calendar routes on protected group
+	var calendarRefresher *services.CalendarTokenRefresher
 	calendarRoutes, err := routes.NewCalendarRoutes(db.DB)
 	if err != nil {
 		log.Printf("Failed to initialize calendar routes: %v", err)
@@ -133,6 +187,10 @@ func main() {
 		calendarRoutes.RegisterRoutes(protectedGroup)
 		calendarRoutes.RegisterPublicRoutes(publicGroup)
 		log.Println("Calendar routes registered successfully")
+
+		// Refresh tokens ahead of expiry
+		calendarRefresher = calendarRoutes.TokenRefresher()
+		calendarRefresher.Start()
 	}
 
 	// Register Zettelkasten routes on public group for single-user mode
@@ -145,9 +203,13 @@ func main() {
 		log.Println("Zettelkasten routes registered successfully")
 	}
 
-	// Initialize Telegram service and routes (optional)
-	aiService := services.NewAIService(db.DB)
+	// Run bulk AI jobs, resuming any interrupted by the last shutdown
+	bulkJobService := services.NewBulkJobService(db.DB, aiService)
+	services.BulkJobServiceInstance = bulkJobService
+	routes.RegisterJobRoutes(publicGroup, db, bulkJobService)
+	bulkJobService.Start()
 
+	// Initialize Telegram service and routes (optional)
 	telegramService, err := services.NewTelegramService(db.DB, aiService)
 	if err != nil {
 		log.Printf("Failed to initialize Telegram service: %v", err)
@@ -173,9 +235,6 @@ func main() {
 		log.Println("Telegram bot started and listening for messages...")
 	}
 
-	// Register debug routes for monitoring events
-	routes.SetupDebugRoutes(router, db)
-
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	go func() {
@@ -187,6 +246,16 @@ func main() {
 		}()
 		<-quit
 		log.Println("Shutting down server...")
+		chainScheduler.Stop(30 * time.Second)
+		if calendarRefresher != nil {
+			calendarRefresher.Stop(30 * time.Second)
+		}
+		services.AppBackgroundTasks().Stop(30 * time.Second)
+		services.ChainNotebookSaves().Stop(30 * time.Second)
+		bulkJobService.Stop(30 * time.Second)
+		if telegramService != nil {
+			telegramService.Stop()
+		}
 		os.Exit(0)
 	}()
 
@@ -196,42 +265,3 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
-
-// initializeSingleUser creates the single user if it doesn't exist
-func initializeSingleUser(db *database.Database, cfg config.Config) error {
-	singleUserUUID, err := uuid.Parse("00000000-0000-0000-0000-000000000001")
-	if err != nil {
-		return fmt.Errorf("invalid single user UUID: %w", err)
-	}
-
-	// Check if user already exists
-	var existingUser models.User
-	err = db.DB.Where("id = ?", singleUserUUID).First(&existingUser).Error
-	if err == nil {
-		// User already exists
-		log.Printf("Single user already exists: %s", existingUser.Email)
-		return nil
-	}
-
-	// User doesn't exist, create it
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(cfg.UserPassword), bcrypt.DefaultCost)
-	if err != nil {
-		return fmt.Errorf("failed to hash password: %w", err)
-	}
-
-	user := models.User{
-		ID:           singleUserUUID,
-		Username:     cfg.UserUsername,
-		Email:        cfg.UserEmail,
-		PasswordHash: string(hashedPassword),
-		DisplayName:  cfg.UserUsername,
-		Preferences:  make(map[string]interface{}),
-	}
-
-	if err := db.DB.Create(&user).Error; err != nil {
-		return fmt.Errorf("failed to create single user: %w", err)
-	}
-
-	log.Printf("Single user created successfully: %s (%s)", user.Email, user.Username)
-	return nil
-}
@@ -6,6 +6,10 @@ import (
 	"strconv"
 )
 
+// DefaultSingleUserID is the ID of the single user unless SINGLE_USER_ID
+// names another one
+const DefaultSingleUserID = "00000000-0000-0000-0000-000000000001"
+
 type Config struct {
 	AppPort            string
 	AppOrigins         string
@@ -17,7 +21,12 @@ type Config struct {
 	DBName             string
 	JWTSecret          string
 	JWTExpirationHours int
+	// Dispatched events are pruned past this age (hours) or count; 0 keeps them
+	EventRetainHours   int
+	EventRetainMax     int
 	// Single user configuration
+	SingleUserMode     bool
+	SingleUserID       string
 	UserUsername       string
 	UserEmail          string
 	UserPassword       string
@@ -41,6 +50,16 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+		log.Printf("Invalid boolean value for %s, defaulting to %t", key, defaultValue)
+	}
+	return defaultValue
+}
+
 func Load() Config {
 	log.Println("Loading configuration...")
 
@@ -55,7 +74,11 @@ func Load() Config {
 		DBName:             getEnv("DB_NAME", "owlistic"),
 		JWTSecret:          getEnv("JWT_SECRET", "your-super-secret-key-change-this-in-production"),
 		JWTExpirationHours: getEnvAsInt("JWT_EXPIRATION_HOURS", 24),
+		EventRetainHours:   getEnvAsInt("EVENT_RETENTION_HOURS", 168),
+		EventRetainMax:     getEnvAsInt("EVENT_RETENTION_MAX", 10000),
 		// Single user configuration
+		SingleUserMode:     getEnvAsBool("SINGLE_USER_MODE", true),
+		SingleUserID:       getEnv("SINGLE_USER_ID", DefaultSingleUserID),
 		UserUsername:       getEnv("USER_USERNAME", "admin"),
 		UserEmail:          getEnv("USER_EMAIL", "admin@owlistic.local"),
 		UserPassword:       getEnv("USER_PASSWORD", "admin123"),
@@ -76,6 +99,8 @@ func Print(cfg Config) {
 	log.Printf("DB Password: %s\n", cfg.DBPassword)
 	log.Printf("JWT Secret: %s\n", cfg.JWTSecret)
 	log.Printf("JWT Expiration Hours: %d\n", cfg.JWTExpirationHours)
+	log.Printf("Event Retention: %d hours, %d events\n", cfg.EventRetainHours, cfg.EventRetainMax)
+	log.Printf("Single User Mode: %t, ID: %s\n", cfg.SingleUserMode, cfg.SingleUserID)
 	log.Printf("Single User Email: %s\n", cfg.UserEmail)
 	log.Printf("Single User Username: %s\n", cfg.UserUsername)
 }
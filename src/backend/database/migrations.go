@@ -1,11 +1,15 @@
 package database
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"strings"
 
 	"owlistic-notes/owlistic/config"
 	"owlistic-notes/owlistic/models"
 
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -19,10 +23,16 @@ func RunMigrations(db *gorm.DB) error {
 		&models.User{},
 		&models.Role{},
 		&models.Notebook{},
+		&models.NotebookVisit{},
 		&models.Note{},
 		&models.Block{},
 		&models.Task{},
 		&models.Event{},
+		&models.NoteLock{},
+		&models.DeferredSyncEvent{},
+		&models.NoteTemplate{},
+		&models.Webhook{},
+		&models.BulkJob{},
 		// AI Enhancement models
 		&models.AIEnhancedNote{},
 		&models.AIAgent{},
@@ -30,12 +40,18 @@ func RunMigrations(db *gorm.DB) error {
 		&models.AIProject{},
 		&models.AITaskEnhancement{},
 		&models.ChatMemory{},
+		&models.ScheduledChain{},
+		&models.AICallLog{},
+		&models.AIArtifact{},
+		&models.AISetting{},
+		&models.RemoteAgent{},
 		// Calendar models
 		&models.GoogleCalendarCredentials{},
 		&models.CalendarEvent{},
 		&models.CalendarSync{},
 		&models.CalendarReminder{},
 		&models.CalendarAttendee{},
+		&models.CalendarConflict{},
 		// Zettelkasten models
 		&models.ZettelNode{},
 		&models.ZettelEdge{},
@@ -120,55 +136,114 @@ func runManualMigrations(db *gorm.DB) error {
 		log.Printf("Failed to add index on ai_agents user_status: %v", err)
 	}
 
+	// Only one bulk job of each type may run at a time
+	if err := db.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_bulk_jobs_one_running
+		ON bulk_jobs(type) WHERE status = 'running';
+	`).Error; err != nil {
+		log.Printf("Failed to add running index on bulk_jobs: %v", err)
+	}
+
+	// Remote agent types used to be unique across users
+	if err := db.Exec(`DROP INDEX IF EXISTS idx_remote_agents_agent_type`).Error; err != nil {
+		log.Printf("Failed to drop global index on remote_agents.agent_type: %v", err)
+	}
+
+	// Fill in previews for notes created before the preview column existed
+	if err := db.Exec(`UPDATE notes SET preview = ` + models.NotePreviewSQL + ` WHERE preview = '' AND deleted_at IS NULL`).Error; err != nil {
+		log.Printf("Failed to backfill note previews: %v", err)
+	}
+
 	log.Println("Manual migrations completed")
 	return nil
 }
 
-// SetupSingleUser creates or updates the single user from environment variables
+// ErrSingleUserMismatch is returned at startup when the configured single
+// user doesn't exist but other users do, e.g. after a migration from a
+// multi-user setup
+var ErrSingleUserMismatch = errors.New("configured single user does not exist")
+
+// singleUserID is the user requests without an authenticated user act as
+var singleUserID = uuid.MustParse(config.DefaultSingleUserID)
+
+// SingleUserID returns the single user's ID, as configured by SINGLE_USER_ID
+func SingleUserID() uuid.UUID {
+	return singleUserID
+}
+
+// SetupSingleUser creates or updates the single user from environment variables.
+// The user is created only in an empty database; when others exist, one of
+// them has to be named by SINGLE_USER_ID.
 func SetupSingleUser(db *gorm.DB, cfg config.Config) error {
-	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(cfg.UserPassword), bcrypt.DefaultCost)
+	if !cfg.SingleUserMode {
+		log.Println("Single-user mode is off, skipping single user setup")
+		return nil
+	}
+
+	userID, err := uuid.Parse(cfg.SingleUserID)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid SINGLE_USER_ID %q: %w", cfg.SingleUserID, err)
 	}
 
-	// Check if any user exists
-	var userCount int64
-	if err := db.Model(&models.User{}).Count(&userCount).Error; err != nil {
+	// Hash the password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(cfg.UserPassword), bcrypt.DefaultCost)
+	if err != nil {
 		return err
 	}
 
-	if userCount == 0 {
-		// Create new user
-		user := models.User{
-			Username:     cfg.UserUsername,
-			Email:        cfg.UserEmail,
-			PasswordHash: string(hashedPassword),
-		}
-
-		if err := db.Create(&user).Error; err != nil {
+	var user models.User
+	err = db.Where("id = ?", userID).First(&user).Error
+	if err == nil {
+		// Update user details
+		if err := db.Model(&user).Updates(map[string]interface{}{
+			"username":      cfg.UserUsername,
+			"email":         cfg.UserEmail,
+			"password_hash": string(hashedPassword),
+		}).Error; err != nil {
 			return err
 		}
 
-		log.Printf("Created single user with email: %s", cfg.UserEmail)
-	} else {
-		// Update existing user (assuming there's only one)
-		var user models.User
-		if err := db.First(&user).Error; err != nil {
-			return err
-		}
+		log.Printf("Updated single user %s with email: %s", userID, cfg.UserEmail)
+		singleUserID = userID
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
 
-		// Update user details
-		user.Username = cfg.UserUsername
-		user.Email = cfg.UserEmail
-		user.PasswordHash = string(hashedPassword)
+	// The configured user doesn't exist: only create it when no one else does
+	var existingIDs []uuid.UUID
+	if err := db.Model(&models.User{}).Order("created_at ASC").Limit(5).Pluck("id", &existingIDs).Error; err != nil {
+		return err
+	}
+	if len(existingIDs) > 0 {
+		return fmt.Errorf("%w: user %s not found but the database has other users (%s); set SINGLE_USER_ID to the user to run as",
+			ErrSingleUserMismatch, userID, joinIDs(existingIDs))
+	}
 
-		if err := db.Save(&user).Error; err != nil {
-			return err
-		}
+	user = models.User{
+		ID:           userID,
+		Username:     cfg.UserUsername,
+		Email:        cfg.UserEmail,
+		PasswordHash: string(hashedPassword),
+		DisplayName:  cfg.UserUsername,
+		Preferences:  make(map[string]interface{}),
+	}
 
-		log.Printf("Updated single user with email: %s", cfg.UserEmail)
+	if err := db.Create(&user).Error; err != nil {
+		return err
 	}
 
+	log.Printf("Created single user %s with email: %s", userID, cfg.UserEmail)
+	singleUserID = userID
 	return nil
 }
+
+// joinIDs formats user IDs for an error message
+func joinIDs(ids []uuid.UUID) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = id.String()
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/config"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func setupSingleUserMock(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn, PreferSimpleProtocol: true}), &gorm.Config{})
+	require.NoError(t, err)
+	return db, mock
+}
+
+func singleUserConfig(id string) config.Config {
+	return config.Config{
+		SingleUserMode: true,
+		SingleUserID:   id,
+		UserUsername:   "admin",
+		UserEmail:      "admin@owlistic.local",
+		UserPassword:   "admin123",
+	}
+}
+
+func TestSetupSingleUser_DetectsMismatch(t *testing.T) {
+	db, mock := setupSingleUserMock(t)
+	configured := uuid.New()
+	existing := uuid.New()
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+		WithArgs(configured, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT "id" FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(existing))
+
+	err := SetupSingleUser(db, singleUserConfig(configured.String()))
+	assert.ErrorIs(t, err, ErrSingleUserMismatch)
+	assert.Contains(t, err.Error(), existing.String(), "the error names the users that do exist")
+	assert.NotEqual(t, configured, SingleUserID(), "a mismatched ID must not be used")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetupSingleUser_UsesConfiguredID(t *testing.T) {
+	db, mock := setupSingleUserMock(t)
+	configured := uuid.New()
+	t.Cleanup(func() { singleUserID = uuid.MustParse(config.DefaultSingleUserID) })
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+		WithArgs(configured, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(configured, "old@owlistic.local"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, SetupSingleUser(db, singleUserConfig(configured.String())))
+	assert.Equal(t, configured, SingleUserID())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetupSingleUser_RejectsInvalidID(t *testing.T) {
+	db, mock := setupSingleUserMock(t)
+
+	assert.Error(t, SetupSingleUser(db, singleUserConfig("not-a-uuid")))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -46,8 +46,8 @@ func CORSMiddleware(allowedOrigins string) gin.HandlerFunc {
 		
 		// Always set these headers
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Requested-With, Origin, Cache-Control, X-File-Name, Cf-Access-Jwt-Assertion, Cf-Access-Authenticated-User-Email")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Content-Type")
+		c.Header("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Requested-With, Origin, Cache-Control, X-File-Name, Cf-Access-Jwt-Assertion, Cf-Access-Authenticated-User-Email, X-Request-ID, X-API-Version")
+		c.Header("Access-Control-Expose-Headers", "Content-Length, Content-Type, X-Request-ID")
 		c.Header("Access-Control-Max-Age", "43200") // 12 hours
 		
 		// Handle preflight requests
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudflareAccessMiddleware_SetsIdentityFromHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CloudflareAccessMiddleware())
+	router.GET("/whoami", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"email": c.GetString("cf-email"), "jwt": c.GetString("cf-jwt")})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Header.Set("Cf-Access-Authenticated-User-Email", "ada@example.com")
+	req.Header.Set("Cf-Access-Jwt-Assertion", "signed.jwt")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.JSONEq(t, `{"email":"ada@example.com","jwt":"signed.jwt"}`, w.Body.String())
+
+	// Without Cloudflare Access nothing is set
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/whoami", nil))
+	assert.JSONEq(t, `{"email":"","jwt":""}`, w.Body.String())
+}
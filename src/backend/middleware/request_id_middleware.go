@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the correlation ID of a request
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware gives every request a correlation ID, taken from the
+// X-Request-ID header or generated, and echoes it in the response. The ID is
+// set on the request context, so work the request starts in the background
+// logs it too.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = uuid.New().String()
+		}
+
+		c.Set("requestID", requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(services.WithRequestID(c.Request.Context(), requestID))
+		c.Next()
+	}
+}
@@ -109,14 +109,63 @@ type AIEnhancedNote struct {
 	ActionSteps    pq.StringArray `gorm:"type:text[]" json:"action_steps,omitempty"`
 	LearningItems  pq.StringArray `gorm:"type:text[]" json:"learning_items,omitempty"`
 	Embeddings     Embeddings     `gorm:"type:jsonb" json:"embeddings,omitempty"`
-	RelatedNoteIDs []uuid.UUID    `gorm:"type:text[]" json:"related_note_ids,omitempty"`
+	RelatedNoteIDs UUIDArray      `gorm:"type:text[]" json:"related_note_ids,omitempty"`
+	RelatedNotesUpdatedAt *time.Time `json:"related_notes_updated_at,omitempty"` // When RelatedNoteIDs were computed, nil until they are
 	AIMetadata     AIMetadata     `gorm:"type:jsonb;default:'{}'::jsonb" json:"ai_metadata,omitempty"`
-	ProcessingStatus string       `gorm:"default:'pending'" json:"processing_status"` // pending, processing, completed, failed
+	ProcessingStatus string       `gorm:"default:'pending'" json:"processing_status"` // pending, processing, completed, partial, failed
+	ProcessingErrors EnhancementErrors `gorm:"type:jsonb;not null;default:'[]'::jsonb" json:"processing_errors,omitempty"` // Enhancements that failed in the last processing
 	LastProcessedAt *time.Time    `json:"last_processed_at,omitempty"`
 	CreatedAt      time.Time      `gorm:"not null;default:now()" json:"created_at"`
 	UpdatedAt      time.Time      `gorm:"not null;default:now()" json:"updated_at"`
 }
 
+// Processing statuses of an AIEnhancedNote
+const (
+	ProcessingPending   = "pending"
+	ProcessingCompleted = "completed"
+	ProcessingPartial   = "partial" // Some enhancements failed, see ProcessingErrors
+	ProcessingFailed    = "failed"
+)
+
+// EnhancementError records why an enhancement of a note failed
+type EnhancementError struct {
+	Enhancement string    `json:"enhancement"` // One of AIEnhancements
+	Error       string    `json:"error"`
+	FailedAt    time.Time `json:"failed_at"`
+}
+
+// EnhancementErrors stores the failed enhancements of a note as JSON
+type EnhancementErrors []EnhancementError
+
+// Enhancements lists the enhancements that failed
+func (ee EnhancementErrors) Enhancements() []string {
+	names := make([]string, len(ee))
+	for i, e := range ee {
+		names[i] = e.Enhancement
+	}
+	return names
+}
+
+func (ee EnhancementErrors) Value() (driver.Value, error) {
+	if ee == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(ee)
+}
+
+func (ee *EnhancementErrors) Scan(value interface{}) error {
+	if value == nil {
+		*ee = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, ee)
+}
+
 // AIAgent represents different types of AI agents
 type AIAgent struct {
 	ID           uuid.UUID       `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
@@ -233,4 +282,79 @@ type AIToolUsage struct {
 	ResponseTime  int            `json:"response_time"` // in milliseconds
 	CreatedAt     time.Time      `gorm:"not null;default:now()" json:"created_at"`
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
-}
\ No newline at end of file
+}
+
+// ScheduledChain runs an agent chain on a recurring cron schedule
+type ScheduledChain struct {
+	ID              uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID          uuid.UUID      `gorm:"type:uuid;not null;index;constraint:OnDelete:CASCADE;" json:"user_id"`
+	ChainID         string         `gorm:"not null;index" json:"chain_id"`
+	Name            string         `json:"name"`
+	CronExpression  string         `gorm:"column:cron_expression;not null" json:"cron_expression"`
+	Timezone        string         `gorm:"default:'UTC'" json:"timezone"`
+	InitialData     AIMetadata     `gorm:"type:jsonb;default:'{}'::jsonb" json:"initial_data"`
+	ChainDefinition AIMetadata     `gorm:"type:jsonb;default:'{}'::jsonb" json:"chain_definition,omitempty"` // Snapshot of custom chains
+	Enabled         bool           `gorm:"not null;index" json:"enabled"`
+	MaxMissedRuns   int            `gorm:"not null" json:"max_missed_runs"` // Overdue runs replayed after downtime
+	LastRun         *time.Time     `json:"last_run,omitempty"`
+	NextRun         *time.Time     `gorm:"index" json:"next_run,omitempty"`
+	LastExecutionID string         `json:"last_execution_id,omitempty"`
+	LastStatus      string         `json:"last_status,omitempty"` // completed, failed, skipped
+	LastError       string         `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt       time.Time      `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"not null;default:now()" json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+// RemoteAgent is a user-registered agent type served by an external HTTP
+// endpoint. Type names are unique per user.
+type RemoteAgent struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID         uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_remote_agents_user_type,priority:1;constraint:OnDelete:CASCADE;" json:"user_id"`
+	AgentType      string     `gorm:"not null;uniqueIndex:idx_remote_agents_user_type,priority:2" json:"type"`
+	Name           string     `gorm:"not null" json:"name"`
+	Description    string     `json:"description"`
+	URL            string     `gorm:"not null" json:"url"`
+	InputSchema    AIMetadata `gorm:"type:jsonb;default:'{}'::jsonb" json:"input_schema"`
+	TimeoutSeconds int        `gorm:"default:60" json:"timeout_seconds"`
+	CreatedAt      time.Time  `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"not null;default:now()" json:"updated_at"`
+}
+
+// AICallLog stores an LLM prompt/response pair for debugging (AI_DEBUG_PERSIST)
+type AICallLog struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID        *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	Feature       string     `gorm:"index" json:"feature"`
+	Model         string     `json:"model"`
+	Prompt        string     `gorm:"type:text" json:"prompt"`
+	Response      string     `gorm:"type:text" json:"response"`
+	Error         string     `gorm:"type:text" json:"error,omitempty"`
+	PromptChars   int        `json:"prompt_chars"`   // Characters before truncation
+	ResponseChars int        `json:"response_chars"` // Characters before truncation
+	Truncated     bool       `json:"truncated"`
+	Redacted      bool       `json:"redacted"`
+	DurationMs    int64      `json:"duration_ms"`
+	CreatedAt     time.Time  `gorm:"not null;default:now();index" json:"created_at"`
+}
+
+// AIArtifact caches a derived AI result, such as a notebook summary, along
+// with a hash of the inputs it was computed from. An entry is only served
+// while the hash of the current inputs matches.
+type AIArtifact struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Kind      string    `gorm:"not null;uniqueIndex:idx_ai_artifacts_kind_scope" json:"kind"`                     // e.g. notebook_summary
+	ScopeID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_ai_artifacts_kind_scope;index" json:"scope_id"` // Notebook or note the result is about
+	InputHash string    `gorm:"not null" json:"input_hash"`
+	Result    string    `gorm:"type:text" json:"result"`
+	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null;default:now()" json:"updated_at"`
+}
+
+// AISetting stores a server-wide AI setting as JSON under a fixed key, such
+// as the vector index parameters chosen through the API
+type AISetting struct {
+	Key       string          `gorm:"primaryKey" json:"key"`
+	Value     json.RawMessage `gorm:"type:jsonb;not null" json:"value"`
+	UpdatedAt time.Time       `gorm:"not null;default:now()" json:"updated_at"`
+}
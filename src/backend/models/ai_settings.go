@@ -0,0 +1,116 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// AI enhancements a note can be processed with
+const (
+	EnhancementTitle         = "title" // Only generated for untitled notes
+	EnhancementSummary       = "summary"
+	EnhancementTags          = "tags"
+	EnhancementActionSteps   = "action_steps"
+	EnhancementLearningItems = "learning_items"
+)
+
+// Summary lengths and formats
+const (
+	SummaryShort     = "short"
+	SummaryMedium    = "medium"
+	SummaryLong      = "long"
+	SummaryParagraph = "paragraph"
+	SummaryBullets   = "bullets"
+)
+
+// AIEnhancements lists every enhancement, in processing order
+var AIEnhancements = []string{
+	EnhancementTitle,
+	EnhancementSummary,
+	EnhancementTags,
+	EnhancementActionSteps,
+	EnhancementLearningItems,
+}
+
+// AISettings are AI processing preferences stored on a notebook or note.
+// Unset fields inherit from the level above: note, then notebook, then the
+// server defaults.
+type AISettings struct {
+	AutoEnhance      *bool    `json:"auto_enhance,omitempty"`       // Process the note when it changes
+	Enhancements     []string `json:"enhancements,omitempty"`       // Enhancements to generate, all when unset
+	AutoExtractTasks *bool    `json:"auto_extract_tasks,omitempty"` // Create tasks from the action steps
+	SummaryLength    string   `json:"summary_length,omitempty"`     // short, medium or long
+	SummaryFormat    string   `json:"summary_format,omitempty"`     // paragraph or bullets
+}
+
+// Overlay returns s with the fields set in override replacing its own
+func (s AISettings) Overlay(override AISettings) AISettings {
+	if override.AutoEnhance != nil {
+		s.AutoEnhance = override.AutoEnhance
+	}
+	if override.Enhancements != nil {
+		s.Enhancements = override.Enhancements
+	}
+	if override.AutoExtractTasks != nil {
+		s.AutoExtractTasks = override.AutoExtractTasks
+	}
+	if override.SummaryLength != "" {
+		s.SummaryLength = override.SummaryLength
+	}
+	if override.SummaryFormat != "" {
+		s.SummaryFormat = override.SummaryFormat
+	}
+	return s
+}
+
+// Validate checks that only known enhancements, summary lengths and
+// summary formats are named
+func (s AISettings) Validate() error {
+	for _, enhancement := range s.Enhancements {
+		if !IsAIEnhancement(enhancement) {
+			return errors.New("unknown enhancement: " + enhancement)
+		}
+	}
+	switch s.SummaryLength {
+	case "", SummaryShort, SummaryMedium, SummaryLong:
+	default:
+		return errors.New("summary_length must be short, medium or long")
+	}
+	switch s.SummaryFormat {
+	case "", SummaryParagraph, SummaryBullets:
+	default:
+		return errors.New("summary_format must be paragraph or bullets")
+	}
+	return nil
+}
+
+// IsAIEnhancement reports whether name is one of AIEnhancements
+func IsAIEnhancement(name string) bool {
+	for _, enhancement := range AIEnhancements {
+		if enhancement == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Value implements the driver.Valuer interface for JSONB storage
+func (s AISettings) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan implements the sql.Scanner interface for JSONB retrieval
+func (s *AISettings) Scan(value interface{}) error {
+	if value == nil {
+		*s = AISettings{}
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, s)
+}
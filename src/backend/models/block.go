@@ -18,6 +18,14 @@ const (
 	HeadingBlock        BlockType = "header"
 	ListItemBlock       BlockType = "listItem"
 	HorizontalRuleBlock BlockType = "horizontalRule"
+	// LinkBlock is a bookmark of an external page: content holds its url,
+	// title, description and site_name, text is the title or the url
+	LinkBlock BlockType = "link"
+	// Paragraph styles the editor stores as the block type
+	CodeBlock  BlockType = "code"
+	QuoteBlock BlockType = "blockquote"
+	// CalloutBlock is text set apart from the note, such as an AI explanation
+	CalloutBlock BlockType = "callout"
 )
 
 type BlockContent map[string]interface{}
@@ -91,8 +99,11 @@ func (b *Block) GetHeadingLevel() int {
 		return 0
 	}
 
-	if level, ok := b.Metadata["level"].(float64); ok {
+	switch level := b.Metadata["level"].(type) {
+	case float64:
 		return int(level)
+	case int:
+		return level
 	}
 	return 1 // Default header level
 }
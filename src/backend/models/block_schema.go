@@ -0,0 +1,164 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidBlock is returned for blocks whose content or metadata don't
+// match the schema of their type
+var ErrInvalidBlock = errors.New("invalid block")
+
+// BlockValueKind is the JSON type of a block field
+type BlockValueKind string
+
+const (
+	StringValue  BlockValueKind = "string"
+	IntegerValue BlockValueKind = "integer"
+	BoolValue    BlockValueKind = "boolean"
+)
+
+// BlockField describes a key of a block's content or metadata
+type BlockField struct {
+	Kind     BlockValueKind
+	Required bool
+	// Default is set when the key is missing, so the field isn't required
+	Default interface{}
+	// OneOf are the allowed values of a string, any when empty
+	OneOf []string
+	// Min and Max bound an integer, unless both are 0
+	Min, Max int
+	// Aliases are other keys the field may be stored under
+	Aliases []string
+}
+
+// BlockSchema lists the keys of a block type's content and metadata that are
+// checked. Other keys are kept as they are.
+type BlockSchema struct {
+	Content  map[string]BlockField
+	Metadata map[string]BlockField
+}
+
+// blockText is the text every editable block holds in its content
+var blockText = map[string]BlockField{"text": {Kind: StringValue, Required: true}}
+
+// BlockSchemas are the schemas blocks are validated against when they are
+// created or updated, by type. Blocks of a type without a schema aren't
+// checked; schemas can be added or replaced at startup.
+var BlockSchemas = map[BlockType]BlockSchema{
+	TextBlock: {Content: blockText},
+	TaskBlock: {
+		Content: blockText,
+		Metadata: map[string]BlockField{
+			"is_completed": {Kind: BoolValue, Default: false},
+			"task_id":      {Kind: StringValue},
+		},
+	},
+	HeadingBlock: {
+		Content:  blockText,
+		Metadata: map[string]BlockField{"level": {Kind: IntegerValue, Default: 1, Min: 1, Max: 6}},
+	},
+	ListItemBlock: {
+		Content: blockText,
+		Metadata: map[string]BlockField{
+			// The editor has stored the list type under both keys
+			"listType": {Kind: StringValue, Default: "unordered", OneOf: []string{"ordered", "unordered"}, Aliases: []string{"item_type"}},
+		},
+	},
+	HorizontalRuleBlock: {},
+	LinkBlock: {
+		Content: map[string]BlockField{
+			"url":         {Kind: StringValue, Required: true},
+			"text":        {Kind: StringValue},
+			"title":       {Kind: StringValue},
+			"description": {Kind: StringValue},
+			"site_name":   {Kind: StringValue},
+		},
+	},
+	CodeBlock: {
+		Content:  blockText,
+		Metadata: map[string]BlockField{"language": {Kind: StringValue}},
+	},
+	QuoteBlock:   {Content: blockText},
+	CalloutBlock: {Content: blockText},
+}
+
+// ValidateBlock checks content and metadata against the schema of the block
+// type and sets the defaults of missing fields in them. Metadata may be nil
+// when the block type has no metadata defaults to set.
+func ValidateBlock(blockType BlockType, content BlockContent, metadata BlockMetadata) error {
+	schema, ok := BlockSchemas[blockType]
+	if !ok {
+		return nil
+	}
+	if err := validateBlockFields(blockType, "content", schema.Content, content); err != nil {
+		return err
+	}
+	return validateBlockFields(blockType, "metadata", schema.Metadata, metadata)
+}
+
+// validateBlockFields checks the fields of values, which is the part of a
+// block named by part
+func validateBlockFields(blockType BlockType, part string, fields map[string]BlockField, values map[string]interface{}) error {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys) // Report the same error for the same block
+
+	for _, key := range keys {
+		field := fields[key]
+		storedKey := key
+		value, exists := values[key]
+		for _, alias := range field.Aliases {
+			if exists {
+				break
+			}
+			storedKey = alias
+			value, exists = values[alias]
+		}
+
+		if !exists || value == nil {
+			switch {
+			case field.Default != nil && values != nil:
+				values[key] = field.Default
+			case field.Required:
+				return fmt.Errorf("%w: %s block needs %s %s", ErrInvalidBlock, blockType, part, key)
+			}
+			continue
+		}
+		if err := field.check(value); err != nil {
+			return fmt.Errorf("%w: %s block %s %s %v", ErrInvalidBlock, blockType, part, storedKey, err)
+		}
+	}
+	return nil
+}
+
+// check reports how value doesn't match the field
+func (field BlockField) check(value interface{}) error {
+	switch field.Kind {
+	case StringValue:
+		s, ok := value.(string)
+		if !ok {
+			return errors.New("must be a string")
+		}
+		if len(field.OneOf) > 0 && !slices.Contains(field.OneOf, s) {
+			return fmt.Errorf("must be one of %s", strings.Join(field.OneOf, ", "))
+		}
+	case IntegerValue:
+		n, ok := spanOffset(value)
+		if !ok {
+			return errors.New("must be an integer")
+		}
+		if (field.Min != 0 || field.Max != 0) && (n < field.Min || n > field.Max) {
+			return fmt.Errorf("must be from %d to %d", field.Min, field.Max)
+		}
+	case BoolValue:
+		if _, ok := value.(bool); !ok {
+			return errors.New("must be true or false")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBlock(t *testing.T) {
+	text := func() BlockContent { return BlockContent{"text": "Hello"} }
+
+	valid := []struct {
+		name      string
+		blockType BlockType
+		content   BlockContent
+		metadata  BlockMetadata
+	}{
+		{"text", TextBlock, text(), BlockMetadata{}},
+		{"task", TaskBlock, text(), BlockMetadata{"is_completed": true, "task_id": "1"}},
+		{"header", HeadingBlock, text(), BlockMetadata{"level": float64(3)}},
+		{"ordered list item", ListItemBlock, text(), BlockMetadata{"listType": "ordered"}},
+		{"list item with the item_type key", ListItemBlock, text(), BlockMetadata{"item_type": "unordered"}},
+		{"horizontal rule", HorizontalRuleBlock, BlockContent{}, BlockMetadata{}},
+		{"link", LinkBlock, BlockContent{"url": "https://example.com", "title": "Example"}, BlockMetadata{}},
+		{"code", CodeBlock, text(), BlockMetadata{"language": "go"}},
+		{"quote", QuoteBlock, text(), BlockMetadata{}},
+		{"callout", CalloutBlock, text(), BlockMetadata{}},
+		{"type without a schema", BlockType("paragraph"), BlockContent{}, BlockMetadata{}},
+	}
+	for _, tt := range valid {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, ValidateBlock(tt.blockType, tt.content, tt.metadata))
+		})
+	}
+
+	invalid := []struct {
+		name      string
+		blockType BlockType
+		content   BlockContent
+		metadata  BlockMetadata
+		message   string
+	}{
+		{"text without text", TextBlock, BlockContent{}, BlockMetadata{}, "text block needs content text"},
+		{"text that isn't a string", TextBlock, BlockContent{"text": 4.0}, BlockMetadata{}, "text block content text must be a string"},
+		{"task completion that isn't a bool", TaskBlock, text(), BlockMetadata{"is_completed": "yes"}, "task block metadata is_completed must be true or false"},
+		{"header level out of range", HeadingBlock, text(), BlockMetadata{"level": 7}, "header block metadata level must be from 1 to 6"},
+		{"header level that isn't an integer", HeadingBlock, text(), BlockMetadata{"level": 1.5}, "header block metadata level must be an integer"},
+		{"unknown list type", ListItemBlock, text(), BlockMetadata{"item_type": "checked"}, "listItem block metadata item_type must be one of ordered, unordered"},
+		{"link without url", LinkBlock, BlockContent{"title": "Example"}, BlockMetadata{}, "link block needs content url"},
+		{"code language that isn't a string", CodeBlock, text(), BlockMetadata{"language": true}, "code block metadata language must be a string"},
+		{"quote without text", QuoteBlock, BlockContent{"text": nil}, BlockMetadata{}, "blockquote block needs content text"},
+		{"callout without text", CalloutBlock, BlockContent{}, BlockMetadata{}, "callout block needs content text"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBlock(tt.blockType, tt.content, tt.metadata)
+			require.ErrorIs(t, err, ErrInvalidBlock)
+			assert.Contains(t, err.Error(), tt.message)
+		})
+	}
+}
+
+func TestValidateBlock_SetsDefaults(t *testing.T) {
+	metadata := BlockMetadata{}
+	require.NoError(t, ValidateBlock(HeadingBlock, BlockContent{"text": "Title"}, metadata))
+	assert.Equal(t, 1, metadata["level"], "headings default to level 1")
+
+	metadata = BlockMetadata{}
+	require.NoError(t, ValidateBlock(ListItemBlock, BlockContent{"text": "Item"}, metadata))
+	assert.Equal(t, "unordered", metadata["listType"])
+
+	metadata = BlockMetadata{"item_type": "ordered"}
+	require.NoError(t, ValidateBlock(ListItemBlock, BlockContent{"text": "Item"}, metadata))
+	assert.NotContains(t, metadata, "listType", "the list type under the other key is kept")
+
+	metadata = BlockMetadata{}
+	require.NoError(t, ValidateBlock(TaskBlock, BlockContent{"text": "Todo"}, metadata))
+	assert.Equal(t, false, metadata["is_completed"])
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrInvalidSpan is returned for formatting spans that can't be interpreted
+var ErrInvalidSpan = errors.New("invalid span")
+
+// NewSpan returns a formatting span over text[start:end]. Offsets are Go
+// byte offsets and are stored as rune offsets, which is what the editor
+// counts in, so spans stay aligned on text with emoji or accents.
+func NewSpan(text string, start, end int, spanType string) map[string]interface{} {
+	return map[string]interface{}{
+		"start": runeOffset(text, start),
+		"end":   runeOffset(text, end),
+		"type":  spanType,
+	}
+}
+
+// NormalizeSpans checks the spans metadata of a block against its text.
+// Spans must be objects with a type and numeric start and end; anything else
+// is rejected. Offsets are clamped to the text's rune length and spans left
+// empty are dropped. An end past the rune length that still fits the text's
+// bytes on a character boundary was counted in bytes and is converted to
+// runes; offsets within the rune length are taken as rune offsets.
+func NormalizeSpans(text string, spans interface{}) ([]interface{}, error) {
+	if spans == nil {
+		return []interface{}{}, nil
+	}
+	list, ok := spans.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: spans must be a list", ErrInvalidSpan)
+	}
+
+	runeLen := utf8.RuneCountInString(text)
+	normalized := make([]interface{}, 0, len(list))
+	for i, item := range list {
+		span, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: span %d must be an object", ErrInvalidSpan, i)
+		}
+		if spanType, _ := span["type"].(string); spanType == "" {
+			return nil, fmt.Errorf("%w: span %d has no type", ErrInvalidSpan, i)
+		}
+		start, okStart := spanOffset(span["start"])
+		end, okEnd := spanOffset(span["end"])
+		if !okStart || !okEnd {
+			return nil, fmt.Errorf("%w: span %d needs integer start and end", ErrInvalidSpan, i)
+		}
+
+		if end > runeLen && isByteSpan(text, start, end) {
+			start, end = runeOffset(text, start), runeOffset(text, end)
+		}
+		start = clampOffset(start, runeLen)
+		end = clampOffset(end, runeLen)
+		if end <= start {
+			continue
+		}
+
+		// Keep extra attributes such as link targets
+		fixed := make(map[string]interface{}, len(span))
+		for key, value := range span {
+			fixed[key] = value
+		}
+		fixed["start"] = start
+		fixed["end"] = end
+		normalized = append(normalized, fixed)
+	}
+	return normalized, nil
+}
+
+// NormalizeBlockSpans normalizes the spans in metadata against the text in
+// content, if there are any
+func NormalizeBlockSpans(content BlockContent, metadata BlockMetadata) error {
+	if metadata == nil {
+		return nil
+	}
+	spans, exists := metadata["spans"]
+	if !exists {
+		return nil
+	}
+	text, _ := content["text"].(string)
+	normalized, err := NormalizeSpans(text, spans)
+	if err != nil {
+		return err
+	}
+	metadata["spans"] = normalized
+	return nil
+}
+
+// spanOffset reads an offset decoded from JSON (float64) or set in Go (int)
+func spanOffset(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false
+		}
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+// isByteSpan reports whether start and end are valid byte offsets into text
+// that land on character boundaries
+func isByteSpan(text string, start, end int) bool {
+	if start < 0 || end > len(text) || start > end {
+		return false
+	}
+	onBoundary := func(i int) bool { return i == len(text) || utf8.RuneStart(text[i]) }
+	return onBoundary(start) && onBoundary(end)
+}
+
+// runeOffset converts a byte offset into text to a rune offset
+func runeOffset(text string, byteOffset int) int {
+	if byteOffset <= 0 {
+		return 0
+	}
+	if byteOffset > len(text) {
+		byteOffset = len(text)
+	}
+	return utf8.RuneCountInString(text[:byteOffset])
+}
+
+func clampOffset(offset, length int) int {
+	if offset < 0 {
+		return 0
+	}
+	if offset > length {
+		return length
+	}
+	return offset
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSpan_CountsRunes(t *testing.T) {
+	key := "🔍 Search Results"
+	text := key + ": café"
+
+	span := NewSpan(text, 0, len(key), "bold")
+	assert.Equal(t, 0, span["start"])
+	assert.Equal(t, 16, span["end"])
+	assert.Equal(t, key, string([]rune(text)[:span["end"].(int)]))
+}
+
+func TestNormalizeSpans(t *testing.T) {
+	text := "🔍 Search Results:"
+
+	t.Run("byte offsets past the rune length are converted", func(t *testing.T) {
+		spans, err := NormalizeSpans(text, []interface{}{
+			map[string]interface{}{"start": float64(0), "end": float64(len("🔍 Search Results")), "type": "bold"},
+		})
+		require.NoError(t, err)
+		require.Len(t, spans, 1)
+		assert.Equal(t, map[string]interface{}{"start": 0, "end": 16, "type": "bold"}, spans[0])
+	})
+
+	t.Run("rune offsets are kept", func(t *testing.T) {
+		spans, err := NormalizeSpans("Éa bold word", []interface{}{
+			map[string]interface{}{"start": float64(3), "end": float64(7), "type": "bold", "href": "x"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{map[string]interface{}{"start": 3, "end": 7, "type": "bold", "href": "x"}}, spans)
+	})
+
+	t.Run("out of range offsets are clamped and empty spans dropped", func(t *testing.T) {
+		spans, err := NormalizeSpans(text, []interface{}{
+			map[string]interface{}{"start": -4, "end": 3, "type": "italic"},
+			map[string]interface{}{"start": 2, "end": 500, "type": "bold"},
+			map[string]interface{}{"start": 5, "end": 5, "type": "bold"},
+			map[string]interface{}{"start": 40, "end": 60, "type": "bold"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"start": 0, "end": 3, "type": "italic"},
+			map[string]interface{}{"start": 2, "end": 17, "type": "bold"},
+		}, spans)
+	})
+
+	t.Run("malformed spans are rejected", func(t *testing.T) {
+		for _, spans := range []interface{}{
+			"bold",
+			[]interface{}{"bold"},
+			[]interface{}{map[string]interface{}{"start": 0, "end": 2}},
+			[]interface{}{map[string]interface{}{"start": "0", "end": 2, "type": "bold"}},
+			[]interface{}{map[string]interface{}{"start": 0.5, "end": 2, "type": "bold"}},
+		} {
+			_, err := NormalizeSpans(text, spans)
+			assert.ErrorIs(t, err, ErrInvalidSpan, "%v", spans)
+		}
+	})
+}
+
+func TestNormalizeBlockSpans(t *testing.T) {
+	metadata := BlockMetadata{"spans": []interface{}{map[string]interface{}{"start": 0, "end": 99, "type": "bold"}}}
+	require.NoError(t, NormalizeBlockSpans(BlockContent{"text": "ünïcode"}, metadata))
+	assert.Equal(t, []interface{}{map[string]interface{}{"start": 0, "end": 7, "type": "bold"}}, metadata["spans"])
+
+	// Metadata without spans is left alone
+	metadata = BlockMetadata{"level": 1}
+	require.NoError(t, NormalizeBlockSpans(BlockContent{"text": "Title"}, metadata))
+	assert.Equal(t, BlockMetadata{"level": 1}, metadata)
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Bulk job types
+const (
+	BulkJobProcessAll = "process-all" // Run AI enhancement over every note in scope
+	BulkJobReindex    = "reindex"     // Rebuild the semantic search collection
+)
+
+// Bulk job statuses. A job left running when the server stops is picked up
+// again from its cursor on the next start.
+const (
+	BulkJobRunning   = "running"
+	BulkJobCompleted = "completed"
+	BulkJobFailed    = "failed"
+)
+
+// BulkJob records the progress of a long-running operation over many notes
+// so it survives restarts and can be polled by any client
+type BulkJob struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index;constraint:OnDelete:CASCADE;" json:"user_id"`
+	Type      string     `gorm:"not null;index" json:"type"`
+	Scope     AIMetadata `gorm:"type:jsonb;default:'{}'::jsonb" json:"scope"` // user_id and optional notebook_id of the notes covered
+	Status    string     `gorm:"not null;default:'running';index" json:"status"`
+	Total     int        `gorm:"not null;default:0" json:"total"`
+	Processed int        `gorm:"not null;default:0" json:"processed"`
+	Failed    int        `gorm:"not null;default:0" json:"failed"`
+	// FailedNoteIDs are the notes that failed, the first hundred of them
+	FailedNoteIDs pq.StringArray `gorm:"type:text[]" json:"failed_note_ids,omitempty"`
+	Cursor        string         `json:"-"` // Last note handled, where a resumed job carries on
+	Error         string         `gorm:"type:text" json:"error,omitempty"`
+	StartedAt     time.Time      `gorm:"not null;default:now()" json:"started_at"`
+	UpdatedAt     time.Time      `gorm:"not null;default:now()" json:"updated_at"`
+	FinishedAt    *time.Time     `json:"finished_at,omitempty"`
+}
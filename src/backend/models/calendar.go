@@ -11,7 +11,8 @@ import (
 	"gorm.io/gorm/logger"
 )
 
-// GoogleCalendarCredentials stores OAuth tokens for Google Calendar access
+// GoogleCalendarCredentials stores OAuth tokens for Google Calendar access.
+// The tokens are encrypted at rest by the calendar service.
 type GoogleCalendarCredentials struct {
 	ID           uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	UserID       uuid.UUID      `gorm:"type:uuid;not null;constraint:OnDelete:CASCADE;" json:"user_id"`
@@ -20,6 +21,9 @@ type GoogleCalendarCredentials struct {
 	TokenType    string         `gorm:"default:'Bearer'" json:"token_type"`
 	ExpiresAt    time.Time      `gorm:"not null" json:"expires_at"`
 	Scope        string         `gorm:"type:text" json:"scope"`
+	KeyVersion   int            `gorm:"not null;default:0" json:"-"` // Key the tokens are encrypted with, 0 for plaintext
+	InvalidAt    *time.Time     `json:"invalid_at,omitempty"`          // Set when Google rejected a refresh; the user has to reconnect
+	RefreshError string         `gorm:"type:text" json:"refresh_error,omitempty"`
 	CreatedAt    time.Time      `gorm:"not null;default:now()" json:"created_at"`
 	UpdatedAt    time.Time      `gorm:"not null;default:now()" json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
@@ -71,6 +75,9 @@ type CalendarEvent struct {
 	NoteID           *uuid.UUID            `gorm:"type:uuid" json:"note_id,omitempty"` // Link to related note
 	TaskID           *uuid.UUID            `gorm:"type:uuid" json:"task_id,omitempty"` // Link to related task
 	Metadata         CalendarEventMetadata `gorm:"type:jsonb;default:'{}'::jsonb" json:"metadata,omitempty"`
+	GoogleSequence   int64                 `gorm:"not null;default:0" json:"google_sequence"` // Sequence of the Google version last synced
+	GoogleUpdatedAt  *time.Time            `json:"google_updated_at,omitempty"` // When Google last changed the version last synced
+	LocalChangedAt   *time.Time            `json:"local_changed_at,omitempty"` // Set while a local edit hasn't reached Google
 	CreatedAt        time.Time             `gorm:"not null;default:now()" json:"created_at"`
 	UpdatedAt        time.Time             `gorm:"not null;default:now()" json:"updated_at"`
 	DeletedAt        gorm.DeletedAt        `gorm:"index" json:"deleted_at,omitempty"`
@@ -86,11 +93,64 @@ type CalendarSync struct {
 	LastSyncAt       *time.Time     `json:"last_sync_at,omitempty"`
 	SyncEnabled      bool           `gorm:"default:true" json:"sync_enabled"`
 	SyncDirection    string         `gorm:"default:'bidirectional'" json:"sync_direction"` // read_only, write_only, bidirectional
+	ConflictPolicy   string         `json:"conflict_policy,omitempty"` // google-wins, local-wins, newest-wins, manual; empty for CALENDAR_CONFLICT_POLICY
 	CreatedAt        time.Time      `gorm:"not null;default:now()" json:"created_at"`
 	UpdatedAt        time.Time      `gorm:"not null;default:now()" json:"updated_at"`
 	DeletedAt        gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
+// CalendarEventVersion is one side's version of an event in a sync conflict
+type CalendarEventVersion struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Location    string    `json:"location"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	AllDay      bool      `json:"all_day"`
+	TimeZone    string    `json:"time_zone"`
+	Status      string    `json:"status"`
+	Sequence    int64     `json:"sequence"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Value implements the driver.Valuer interface for JSONB storage
+func (v CalendarEventVersion) Value() (driver.Value, error) {
+	return json.Marshal(v)
+}
+
+// Scan implements the sql.Scanner interface for JSONB retrieval
+func (v *CalendarEventVersion) Scan(value interface{}) error {
+	if value == nil {
+		*v = CalendarEventVersion{}
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, v)
+}
+
+// CalendarConflict records an event that changed both locally and in Google
+// between syncs, under the manual conflict policy. The event keeps its local
+// version until the user picks one.
+type CalendarConflict struct {
+	ID               uuid.UUID            `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID           uuid.UUID            `gorm:"type:uuid;not null;index;constraint:OnDelete:CASCADE;" json:"user_id"`
+	EventID          uuid.UUID            `gorm:"type:uuid;not null;index" json:"event_id"`
+	GoogleCalendarID string               `gorm:"not null" json:"google_calendar_id"`
+	GoogleEventID    string               `gorm:"not null" json:"google_event_id"`
+	Local            CalendarEventVersion `gorm:"type:jsonb;not null" json:"local"`
+	Google           CalendarEventVersion `gorm:"type:jsonb;not null" json:"google"`
+	Status           string               `gorm:"not null;default:'open'" json:"status"` // open, resolved
+	Resolution       string               `json:"resolution,omitempty"` // google, local
+	ResolvedAt       *time.Time           `json:"resolved_at,omitempty"`
+	CreatedAt        time.Time            `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt        time.Time            `gorm:"not null;default:now()" json:"updated_at"`
+}
+
 // CalendarReminder represents reminders for calendar events
 type CalendarReminder struct {
 	ID        uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
@@ -131,19 +191,9 @@ func (gc *GoogleCalendarCredentials) IsExpired() bool {
 	return time.Now().After(gc.ExpiresAt)
 }
 
-// NeedsRefresh checks if the token needs to be refreshed (expires within 5 minutes)
-func (gc *GoogleCalendarCredentials) NeedsRefresh() bool {
-	return time.Now().Add(5 * time.Minute).After(gc.ExpiresAt)
-}
-
-// UpdateTokens updates the access and refresh tokens
-func (gc *GoogleCalendarCredentials) UpdateTokens(db *gorm.DB, accessToken, refreshToken string, expiresAt time.Time) error {
-	gc.AccessToken = accessToken
-	if refreshToken != "" {
-		gc.RefreshToken = refreshToken
-	}
-	gc.ExpiresAt = expiresAt
-	return db.Save(gc).Error
+// NeedsRefresh checks if the token expires within lead of now
+func (gc *GoogleCalendarCredentials) NeedsRefresh(now time.Time, lead time.Duration) bool {
+	return now.Add(lead).After(gc.ExpiresAt)
 }
 
 // GetUserCalendars gets all calendar sync configurations for a user
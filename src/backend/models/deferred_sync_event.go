@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeferredSyncEvent is a block-task sync event held back while its note is
+// locked. It is stored so the event is replayed even when the server stops
+// before the note is unlocked.
+type DeferredSyncEvent struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	NoteID    uuid.UUID `gorm:"type:uuid;not null;index;constraint:OnDelete:CASCADE;" json:"note_id"`
+	EventType string    `gorm:"not null" json:"event_type"`
+	Data      []byte    `gorm:"type:bytea;not null" json:"-"` // The event message as received
+	CreatedAt time.Time `gorm:"not null;default:now();index" json:"created_at"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,15 +13,36 @@ import (
 type Note struct {
 	ID         uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	UserID     uuid.UUID      `gorm:"type:uuid;not null;constraint:OnDelete:CASCADE;" json:"user_id"`
-	NotebookID uuid.UUID      `gorm:"type:uuid;not null;constraint:OnDelete:CASCADE;" json:"notebook_id"`
+	NotebookID uuid.UUID      `gorm:"type:uuid;not null;constraint:OnDelete:CASCADE;index:idx_notes_notebook_position,priority:1" json:"notebook_id"`
 	Title      string         `gorm:"not null" json:"title"`
+	Position   float64        `gorm:"not null;default:0;index:idx_notes_notebook_position,priority:2" json:"position"` // Manual order within the notebook, lowest first
+	Preview    string         `gorm:"type:text;not null;default:''" json:"preview"`                                    // Start of the text content, kept in sync with the blocks
 	Blocks     []Block        `gorm:"foreignKey:NoteID" json:"blocks"`
 	Tags       pq.StringArray `gorm:"type:text[]" json:"tags"`
+	Language   string         `gorm:"size:16;not null;default:''" json:"language,omitempty"`      // ISO 639-1 code detected from the content, empty when unknown
+	AISettings AISettings     `gorm:"type:jsonb;not null;default:'{}'::jsonb" json:"ai_settings"` // Overrides the notebook's AI settings
 	CreatedAt  time.Time      `gorm:"not null;default:now()" json:"created_at"`
 	UpdatedAt  time.Time      `gorm:"not null;default:now()" json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
+// NotePreviewLength is the number of characters of text content kept in Note.Preview
+const NotePreviewLength = 200
+
+// NotePreviewSQL computes the preview (NotePreviewLength characters) of the
+// note row "notes" from its first text-bearing blocks, for use in an
+// UPDATE notes SET preview = ... statement
+var NotePreviewSQL = `COALESCE((
+	SELECT left(regexp_replace(string_agg(t.text, ' ' ORDER BY t.ord), '\s+', ' ', 'g'), ` + strconv.Itoa(NotePreviewLength) + `)
+	FROM (
+		SELECT b.content->>'text' AS text, b."order" AS ord
+		FROM blocks b
+		WHERE b.note_id = notes.id AND b.deleted_at IS NULL AND btrim(COALESCE(b.content->>'text', '')) <> ''
+		ORDER BY b."order"
+		LIMIT 10
+	) t
+), '')`
+
 func (n *Note) FromJSON(data []byte) error {
 	return json.Unmarshal(data, n)
 }
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NoteLock is an advisory editing lock. While it is held, background
+// mutators (AI enhancement, block-task sync) leave the note alone.
+type NoteLock struct {
+	NoteID    uuid.UUID `gorm:"type:uuid;primaryKey;constraint:OnDelete:CASCADE;" json:"note_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	ClientID  string    `gorm:"index" json:"client_id,omitempty"` // WebSocket connection that holds the lock
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null;default:now()" json:"updated_at"`
+}
+
+// Active reports whether the lock is still in effect at t
+func (l NoteLock) Active(t time.Time) bool {
+	return t.Before(l.ExpiresAt)
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// NoteTemplateBlock describes one block of a note created from a template.
+// String values in Content are Go text/template strings filled in when the
+// note is generated.
+type NoteTemplateBlock struct {
+	Type    BlockType    `json:"type"`
+	Content BlockContent `json:"content"`
+}
+
+// NoteTemplateBlocks is the ordered block list of a template
+type NoteTemplateBlocks []NoteTemplateBlock
+
+// Value implements the driver.Valuer interface for JSONB storage
+func (tb NoteTemplateBlocks) Value() (driver.Value, error) {
+	if tb == nil {
+		return json.Marshal([]NoteTemplateBlock{})
+	}
+	return json.Marshal(tb)
+}
+
+// Scan implements the sql.Scanner interface for JSONB retrieval
+func (tb *NoteTemplateBlocks) Scan(value interface{}) error {
+	if value == nil {
+		*tb = NoteTemplateBlocks{}
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, tb)
+}
+
+// NoteTemplate is a user-defined note structure, used for the step notes of
+// AI-generated project notebooks
+type NoteTemplate struct {
+	ID          uuid.UUID          `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID      uuid.UUID          `gorm:"type:uuid;not null;index;constraint:OnDelete:CASCADE;" json:"user_id"`
+	Name        string             `gorm:"not null" json:"name"`
+	Description string             `json:"description"`
+	Blocks      NoteTemplateBlocks `gorm:"type:jsonb;default:'[]'::jsonb" json:"blocks"`
+	CreatedAt   time.Time          `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt   time.Time          `gorm:"not null;default:now()" json:"updated_at"`
+	DeletedAt   gorm.DeletedAt     `gorm:"index" json:"deleted_at,omitempty"`
+}
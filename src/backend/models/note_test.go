@@ -2,6 +2,8 @@ package models
 
 import (
 	"encoding/json"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
@@ -58,3 +60,7 @@ func TestNoteFromJSON(t *testing.T) {
 	assert.Equal(t, 1, len(note.Blocks))
 	assert.Equal(t, "Test Content", note.Blocks[0].Content["text"])
 }
+
+func TestNotePreviewSQL_CutsAtNotePreviewLength(t *testing.T) {
+	assert.True(t, strings.Contains(NotePreviewSQL, "'g'), "+strconv.Itoa(NotePreviewLength)+")"))
+}
@@ -9,14 +9,17 @@ import (
 )
 
 type Notebook struct {
-	ID          uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	UserID      uuid.UUID      `gorm:"type:uuid;not null;constraint:OnDelete:CASCADE;" json:"user_id"`
-	Name        string         `gorm:"not null" json:"name"`
-	Description string         `json:"description"`
-	Notes       []Note         `gorm:"foreignKey:NotebookID" json:"notes"`
-	CreatedAt   time.Time      `gorm:"not null;default:now()" json:"created_at"`
-	UpdatedAt   time.Time      `gorm:"not null;default:now()" json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ID                 uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID             uuid.UUID      `gorm:"type:uuid;not null;constraint:OnDelete:CASCADE;" json:"user_id"`
+	Name               string         `gorm:"not null" json:"name"`
+	Description        string         `json:"description"`
+	Notes              []Note         `gorm:"foreignKey:NotebookID" json:"notes"`
+	AISummary          string         `gorm:"type:text" json:"ai_summary,omitempty"` // AI generated overview of the notes
+	SummaryGeneratedAt *time.Time     `json:"summary_generated_at,omitempty"`
+	AISettings         AISettings     `gorm:"type:jsonb;not null;default:'{}'::jsonb" json:"ai_settings"` // Defaults for the notes of the notebook
+	CreatedAt          time.Time      `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt          time.Time      `gorm:"not null;default:now()" json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
 func (nb *Notebook) FromJSON(data []byte) error {
@@ -26,3 +29,10 @@ func (nb *Notebook) FromJSON(data []byte) error {
 func (nb *Notebook) ToJSON() ([]byte, error) {
 	return json.Marshal(nb)
 }
+
+// NotebookVisit records when a user last caught up on what changed in a notebook
+type NotebookVisit struct {
+	UserID     uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	NotebookID uuid.UUID `gorm:"type:uuid;primaryKey" json:"notebook_id"`
+	VisitedAt  time.Time `gorm:"not null" json:"visited_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NotTrashed restricts a query to rows that have not been moved to the trash.
+// Trashed rows carry a non-NULL deleted_at (see gorm.DeletedAt on each model).
+// GORM adds this filter implicitly for model queries; the scope turns that
+// off with Unscoped and adds the condition explicitly, so it also holds for
+// Table() and raw-join queries without being duplicated. Unscoped carries
+// over to preloads, which need the scope themselves.
+func NotTrashed(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Where(clause.Eq{
+		Column: clause.Column{Table: clause.CurrentTable, Name: "deleted_at"},
+		Value:  nil,
+	})
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Webhook is an outbound HTTP endpoint notified of a user's note, notebook
+// and task lifecycle events
+type Webhook struct {
+	ID          uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID      uuid.UUID      `gorm:"type:uuid;not null;index;constraint:OnDelete:CASCADE;" json:"user_id"`
+	URL         string         `gorm:"not null" json:"url"`
+	Secret      string         `json:"-"`                               // Signs deliveries, never returned by the API
+	EventTypes  pq.StringArray `gorm:"type:text[]" json:"event_types"`  // e.g. note.created or note.*; empty means all
+	NotebookIDs UUIDArray      `gorm:"type:text[]" json:"notebook_ids"` // Only events of these notebooks; empty means all
+	Active      bool           `gorm:"not null;default:true" json:"active"`
+	CreatedAt   time.Time      `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"not null;default:now()" json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
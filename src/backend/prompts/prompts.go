@@ -0,0 +1,156 @@
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Template names used across the AI services
+const (
+	Title                 = "title"
+	Summary               = "summary"
+	Tags                  = "tags"
+	ActionSteps           = "action-steps"
+	LearningItems         = "learning-items"
+	BreakDownTask         = "break-down-task"
+	ClassifyIntent        = "classify-intent"
+	ReasoningAnalyze      = "reasoning-analyze"
+	ReasoningPlan         = "reasoning-plan"
+	ReasoningCreate       = "reasoning-create"
+	ReasoningReflect      = "reasoning-reflect"
+	ReasoningAssess       = "reasoning-assess"
+	NotebookSummaryMap    = "notebook-summary-map"
+	NotebookSummaryReduce = "notebook-summary-reduce"
+	NotebookChanges       = "notebook-changes"
+	ExtractCalendarEvent  = "extract-calendar-event"
+	ContinueWriting       = "continue-writing"
+	SuggestTagMerges      = "suggest-tag-merges"
+	Explain               = "explain"
+	PrioritizeTasks       = "prioritize-tasks"
+	templateExtension     = ".tmpl"
+)
+
+//go:embed templates/*.tmpl
+var embeddedTemplates embed.FS
+
+// Registry holds named prompt templates
+type Registry struct {
+	mu        sync.RWMutex
+	templates map[string]*template.Template
+}
+
+// NewRegistry creates a registry preloaded with the embedded default prompts
+func NewRegistry() *Registry {
+	r := &Registry{templates: make(map[string]*template.Template)}
+	if err := r.loadFS(embeddedTemplates, "templates"); err != nil {
+		// The defaults are compiled in, so this only fails on a broken build
+		panic(fmt.Sprintf("invalid embedded prompt templates: %v", err))
+	}
+	return r
+}
+
+// LoadDir loads *.tmpl files from dir, overriding templates with the same name.
+// A missing directory is not an error, the embedded defaults stay in place.
+func (r *Registry) LoadDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("prompt templates path %s is not a directory", dir)
+	}
+	return r.loadFS(os.DirFS(dir), ".")
+}
+
+func (r *Registry) loadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	parsed := make(map[string]*template.Template)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != templateExtension {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, filepath.ToSlash(filepath.Join(dir, entry.Name())))
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(entry.Name(), templateExtension)
+		// A field the caller doesn't pass is an error rather than "<no value>" in the prompt
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("failed to parse prompt template %s: %w", name, err)
+		}
+		parsed[name] = tmpl
+	}
+
+	// Only swap templates in once every file parsed
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, tmpl := range parsed {
+		r.templates[name] = tmpl
+	}
+	return nil
+}
+
+// Render executes the named template with data
+func (r *Registry) Render(name string, data interface{}) (string, error) {
+	r.mu.RLock()
+	tmpl, ok := r.templates[name]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("prompt template %q not found", name)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %w", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Names returns the registered template names
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Default is the registry used by the AI services
+var Default = NewRegistry()
+
+// Load applies template overrides from dir to the default registry
+func Load(dir string) error {
+	if err := Default.LoadDir(dir); err != nil {
+		return err
+	}
+	log.Printf("Loaded prompt templates: %s", strings.Join(Default.Names(), ", "))
+	return nil
+}
+
+// Render executes a template from the default registry
+func Render(name string, data interface{}) (string, error) {
+	return Default.Render(name, data)
+}
@@ -0,0 +1,82 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// allPromptFields holds every field the default templates use
+var allPromptFields = map[string]interface{}{
+	"Title": "", "Content": "", "Language": "", "Words": 0, "Bullets": false, "Description": "",
+	"MaxSteps": 5, "Message": "", "Instruction": "", "Tone": "", "Level": "", "Scope": "",
+	"Now": "", "Weekday": "", "Notebook": "", "Notes": "", "Since": "", "Part": 1, "Parts": 1,
+	"Today": "", "Tasks": []map[string]interface{}{}, "Tags": []map[string]interface{}{},
+	"Goal": "", "Strategy": "", "InitialContext": "", "CurrentState": "", "Learnings": []string{},
+	"StepCount": 0, "EndReason": "", "RecentSteps": "", "Action": "", "Resources": "", "Analysis": "",
+}
+
+func TestDefaultTemplatesRender(t *testing.T) {
+	r := NewRegistry()
+
+	for _, name := range []string{Title, Summary, Tags, ActionSteps, LearningItems, BreakDownTask,
+		ClassifyIntent, ReasoningAnalyze, ReasoningPlan, ReasoningCreate, ReasoningReflect, ReasoningAssess,
+		NotebookSummaryMap, NotebookSummaryReduce, NotebookChanges, ExtractCalendarEvent, ContinueWriting, SuggestTagMerges, Explain, PrioritizeTasks} {
+		out, err := r.Render(name, allPromptFields)
+		require.NoError(t, err, name)
+		assert.NotEmpty(t, out, name)
+	}
+
+	out, err := r.Render(Summary, map[string]interface{}{"Title": "Groceries", "Content": "milk, eggs", "Language": "", "Words": 0, "Bullets": false})
+	require.NoError(t, err)
+	assert.Equal(t, "Create a concise summary of this content. Focus on key points and main ideas:\n\nTitle: Groceries\nContent: milk, eggs", out)
+}
+
+func TestLoadDirOverridesDefault(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "summary.tmpl"), []byte("Summarize {{.Title}} in one line."), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("ignored"), 0o644))
+
+	r := NewRegistry()
+	require.NoError(t, r.LoadDir(dir))
+
+	out, err := r.Render(Summary, map[string]interface{}{"Title": "Groceries"})
+	require.NoError(t, err)
+	assert.Equal(t, "Summarize Groceries in one line.", out)
+
+	// Templates without an override keep the default
+	out, err = r.Render(Tags, map[string]interface{}{"Title": "Groceries", "Content": "", "Language": ""})
+	require.NoError(t, err)
+	assert.Contains(t, out, "Extract 3-5 relevant tags")
+}
+
+func TestLoadDirInvalidTemplateKeepsDefaults(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "summary.tmpl"), []byte("{{.Title"), 0o644))
+
+	r := NewRegistry()
+	assert.Error(t, r.LoadDir(dir))
+
+	out, err := r.Render(Summary, allPromptFields)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Create a concise summary")
+}
+
+func TestLoadDirMissing(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.LoadDir(filepath.Join(t.TempDir(), "missing")))
+	assert.NoError(t, r.LoadDir(""))
+}
+
+func TestRenderMissingFieldFails(t *testing.T) {
+	_, err := NewRegistry().Render(Summary, map[string]interface{}{"Title": "Groceries"})
+	assert.Error(t, err)
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	_, err := NewRegistry().Render("does-not-exist", nil)
+	assert.Error(t, err)
+}
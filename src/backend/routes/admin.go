@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterAdminRoutes registers the server administration routes. They
+// belong on a group behind the auth middleware and need the admin role.
+func RegisterAdminRoutes(group *gin.RouterGroup, db *database.Database, roleService services.RoleServiceInterface, aiPause *services.AIPause) {
+	admin := group.Group("/admin", func(c *gin.Context) { requireAdmin(c, db, roleService) })
+	admin.GET("/ai", func(c *gin.Context) { c.JSON(http.StatusOK, aiPause.State()) })
+	admin.POST("/ai/pause", func(c *gin.Context) { PauseAI(c, aiPause) })
+	admin.POST("/ai/resume", func(c *gin.Context) { ResumeAI(c, aiPause) })
+}
+
+// requireAdmin stops requests from users without the system admin role
+func requireAdmin(c *gin.Context, db *database.Database, roleService services.RoleServiceInterface) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	isAdmin, err := roleService.HasSystemRole(db, userID.(uuid.UUID).String(), string(models.AdminRole))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !isAdmin {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin role required"})
+		return
+	}
+	c.Next()
+}
+
+// PauseAI halts AI work across the server until it is resumed
+func PauseAI(c *gin.Context, aiPause *services.AIPause) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	state, err := aiPause.Pause(c.Request.Context(), c.MustGet("userID").(uuid.UUID), req.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pause AI", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// ResumeAI lets AI work run again
+func ResumeAI(c *gin.Context, aiPause *services.AIPause) {
+	state, err := aiPause.Resume(c.Request.Context(), c.MustGet("userID").(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume AI", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// requireAIActive answers 503 for new AI work while AI is paused. It goes
+// in front of the handlers of endpoints that call the model.
+func requireAIActive(c *gin.Context) {
+	if services.AIPauseInstance.Paused() {
+		respondAIPaused(c)
+		return
+	}
+	c.Next()
+}
+
+// respondAIPaused answers 503, telling the client AI is paused
+func respondAIPaused(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+		"error":     services.AIPausedMessage,
+		"ai_paused": true,
+	})
+}
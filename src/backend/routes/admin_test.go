@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adminRoleService answers the system admin check
+type adminRoleService struct {
+	services.RoleServiceInterface
+	admin bool
+}
+
+func (m *adminRoleService) HasSystemRole(db *database.Database, userID string, requiredRole string) (bool, error) {
+	return m.admin, nil
+}
+
+// newAIPauseRouter serves the admin, AI and note routes to a single user, with a
+// fresh AI pause installed for the test
+func newAIPauseRouter(t *testing.T, admin bool) (*gin.Engine, sqlmock.Sqlmock) {
+	db, mock, close := testutils.SetupMockDB()
+	t.Cleanup(close)
+
+	mock.ExpectQuery(`SELECT \* FROM "ai_settings"`).WillReturnRows(sqlmock.NewRows([]string{"key"}))
+	aiPause := services.NewAIPause(db.DB)
+	previous := services.AIPauseInstance
+	services.AIPauseInstance = aiPause
+	t.Cleanup(func() { services.AIPauseInstance = previous })
+
+	router := gin.New()
+	userID := uuid.New()
+	api := router.Group("/api/v1", func(c *gin.Context) { c.Set("userID", userID) })
+	RegisterAdminRoutes(api, db, &adminRoleService{admin: admin}, aiPause)
+	(&AIRoutes{}).RegisterRoutes(api)
+	RegisterNoteRoutes(api, db, &MockNoteService{})
+	return router, mock
+}
+
+func expectAIPauseStored(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "ai_settings"`).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(time.Now()))
+	mock.ExpectCommit()
+}
+
+func serve(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAIPause_AIEndpointsAnswer503UntilResumed(t *testing.T) {
+	router, mock := newAIPauseRouter(t, true)
+
+	expectAIPauseStored(mock)
+	w := serve(router, "POST", "/api/v1/admin/ai/pause", `{"reason":"provider outage"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var state services.AIPauseState
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &state))
+	assert.True(t, state.Paused)
+	assert.Equal(t, "provider outage", state.Reason)
+
+	w = serve(router, "GET", "/api/v1/admin/ai", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"paused":true`)
+
+	for _, request := range []struct{ method, path, body string }{
+		{"POST", "/api/v1/ai/notes/not-a-uuid/explain", ""},
+		{"POST", "/api/v1/ai/chat", `{"message":"hi"}`},
+		{"POST", "/api/v1/ai/tasks/prioritize", `{}`},
+	} {
+		w = serve(router, request.method, request.path, request.body)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, request.path)
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, services.AIPausedMessage, body["error"])
+		assert.Equal(t, true, body["ai_paused"])
+	}
+
+	// Notes don't depend on AI
+	w = serve(router, "GET", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	expectAIPauseStored(mock)
+	w = serve(router, "POST", "/api/v1/admin/ai/resume", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"paused":false`)
+
+	// The request reaches the handler again, which rejects the bad ID
+	w = serve(router, "POST", "/api/v1/ai/notes/not-a-uuid/explain", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAIPause_OnlyAdminsCanPause(t *testing.T) {
+	router, mock := newAIPauseRouter(t, false)
+
+	w := serve(router, "POST", "/api/v1/admin/ai/pause", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.False(t, services.AIPauseInstance.Paused())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChromaConfig_NeedsAdminRole(t *testing.T) {
+	db, _, close := testutils.SetupMockDB()
+	defer close()
+	cr := &ChromaRoutes{aiService: &services.AIService{}}
+
+	for _, admin := range []bool{false, true} {
+		router := gin.New()
+		api := router.Group("/api/v1/ai", func(c *gin.Context) { c.Set("userID", uuid.New()) })
+		cr.RegisterAdminRoutes(api, db, &adminRoleService{admin: admin})
+
+		w := serve(router, "PUT", "/api/v1/ai/chroma/config", "not json")
+		if admin {
+			assert.Equal(t, http.StatusBadRequest, w.Code, "admins reach the handler")
+		} else {
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		}
+	}
+}
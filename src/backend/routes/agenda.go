@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterAgendaRoutes registers the routes of the daily agenda
+func RegisterAgendaRoutes(group *gin.RouterGroup, db *database.Database, agendaService services.AgendaServiceInterface) {
+	// Events, due tasks and reminders of a day, today unless ?date= is given
+	group.GET("/agenda/today", func(c *gin.Context) { GetAgenda(c, db, agendaService) })
+}
+
+// GetAgenda returns the time-sorted agenda of a day in the user's timezone,
+// or in the timezone given by ?tz=
+func GetAgenda(c *gin.Context, db *database.Database, agendaService services.AgendaServiceInterface) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		userIDInterface = getSingleUserID(db)
+	}
+	userID := userIDInterface.(uuid.UUID)
+
+	agenda, err := agendaService.GetAgenda(db, userID, c.Query("date"), c.Query("tz"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build agenda"})
+		return
+	}
+
+	c.JSON(http.StatusOK, agenda)
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,28 +13,40 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/services"
 )
 
 type AgentOrchestratorRoutes struct {
 	db           *gorm.DB
 	orchestrator *services.AgentOrchestrator
+	scheduler    *services.ChainScheduler
 }
 
 func NewAgentOrchestratorRoutes(db *gorm.DB) *AgentOrchestratorRoutes {
+	orchestrator := services.NewAgentOrchestrator(db)
 	return &AgentOrchestratorRoutes{
 		db:           db,
-		orchestrator: services.NewAgentOrchestrator(db),
+		orchestrator: orchestrator,
+		scheduler:    services.NewChainScheduler(db, orchestrator),
 	}
 }
 
+// Scheduler returns the chain scheduler backing the schedule routes
+func (aor *AgentOrchestratorRoutes) Scheduler() *services.ChainScheduler {
+	return aor.scheduler
+}
+
 func (aor *AgentOrchestratorRoutes) RegisterRoutes(router *gin.RouterGroup) {
 	agentGroup := router.Group("/agents/orchestrator")
 	{
 		// Chain execution
-		agentGroup.POST("/chains/execute", aor.executeChain)
+		agentGroup.POST("/chains/execute", requireAIActive, aor.executeChain)
 		agentGroup.GET("/executions", aor.getActiveExecutions)
 		agentGroup.GET("/executions/:id", aor.getExecutionStatus)
+		agentGroup.GET("/executions/:id/results", aor.getExecutionResults)
+		agentGroup.GET("/executions/:id/report", aor.getExecutionReport)
+		agentGroup.POST("/executions/:id/save-as-note", aor.saveExecutionAsNote)
 		
 		// Chain management
 		agentGroup.GET("/chains", aor.listChains)
@@ -42,8 +55,17 @@ func (aor *AgentOrchestratorRoutes) RegisterRoutes(router *gin.RouterGroup) {
 		agentGroup.PUT("/chains/:id", aor.updateChain)
 		agentGroup.DELETE("/chains/:id", aor.deleteChain)
 		
+		// Scheduled chain execution
+		agentGroup.GET("/schedules", aor.listSchedules)
+		agentGroup.GET("/schedules/:id", aor.getSchedule)
+		agentGroup.POST("/schedules", aor.createSchedule)
+		agentGroup.PUT("/schedules/:id", aor.updateSchedule)
+		agentGroup.DELETE("/schedules/:id", aor.deleteSchedule)
+
 		// Agent information
 		agentGroup.GET("/agent-types", aor.getAgentTypes)
+		agentGroup.POST("/agent-types", aor.registerRemoteAgent)
+		agentGroup.DELETE("/agent-types/:type", aor.deleteRemoteAgent)
 		
 		// Predefined chain templates
 		agentGroup.GET("/templates", aor.getChainTemplates)
@@ -51,6 +73,50 @@ func (aor *AgentOrchestratorRoutes) RegisterRoutes(router *gin.RouterGroup) {
 	}
 }
 
+// defaultExecutionGCAge is how old an execution must be for the debug GC
+// to remove it when no older_than is given
+const defaultExecutionGCAge = time.Hour
+
+// RegisterDebugRoutes adds the orchestrator memory inspection routes. They
+// belong on a group behind the auth middleware and need the admin role, as
+// they show and remove the executions of every user.
+func (aor *AgentOrchestratorRoutes) RegisterDebugRoutes(router *gin.RouterGroup, roleService services.RoleServiceInterface) {
+	db := &database.Database{DB: aor.db}
+	debugGroup := router.Group("/debug/orchestrator", func(c *gin.Context) { requireAdmin(c, db, roleService) })
+	{
+		debugGroup.GET("", aor.getOrchestratorState)
+		debugGroup.POST("/gc", aor.collectStaleExecutions)
+	}
+}
+
+// getOrchestratorState reports the executions and chains held in memory
+func (aor *AgentOrchestratorRoutes) getOrchestratorState(c *gin.Context) {
+	c.JSON(http.StatusOK, aor.orchestrator.State())
+}
+
+// collectStaleExecutions removes executions older than the older_than query
+// parameter (a duration like "30m", default 1h)
+func (aor *AgentOrchestratorRoutes) collectStaleExecutions(c *gin.Context) {
+	olderThan := defaultExecutionGCAge
+	if value := c.Query("older_than"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "older_than must be a positive duration such as 30m"})
+			return
+		}
+		olderThan = parsed
+	}
+
+	removed := aor.orchestrator.CollectStaleExecutions(olderThan)
+	log.Printf("Orchestrator GC removed %d executions older than %s", len(removed), olderThan)
+
+	c.JSON(http.StatusOK, gin.H{
+		"removed":    removed,
+		"count":      len(removed),
+		"older_than": olderThan.String(),
+	})
+}
+
 // executeChain starts execution of an agent chain
 func (aor *AgentOrchestratorRoutes) executeChain(c *gin.Context) {
 	var req services.ChainExecutionRequest
@@ -100,6 +166,106 @@ func (aor *AgentOrchestratorRoutes) getExecutionStatus(c *gin.Context) {
 	})
 }
 
+// getExecutionResults returns the stored results of a finished execution
+func (aor *AgentOrchestratorRoutes) getExecutionResults(c *gin.Context) {
+	userUUID := getUserUUID(c, aor.db)
+
+	results, err := aor.orchestrator.GetExecutionResults(userUUID, c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Execution results not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"execution": results,
+	})
+}
+
+// getExecutionReport downloads a finished execution as a report, Markdown by
+// default or a PDF with format=pdf
+func (aor *AgentOrchestratorRoutes) getExecutionReport(c *gin.Context) {
+	userUUID := getUserUUID(c, aor.db)
+
+	format := c.DefaultQuery("format", services.ExecutionReportMarkdown)
+	if format != services.ExecutionReportMarkdown && format != services.ExecutionReportPDF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be md or pdf"})
+		return
+	}
+
+	report, err := aor.orchestrator.ExportExecutionReport(userUUID, c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Execution results not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", report.Filename(format)))
+	if format == services.ExecutionReportMarkdown {
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(report.Markdown()))
+		return
+	}
+
+	c.Header("Content-Type", "application/pdf")
+	c.Status(http.StatusOK)
+	if err := report.WritePDF(c.Writer); err != nil {
+		log.Printf("Failed to write report for execution %s: %v", c.Param("id"), err)
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render report"})
+		}
+	}
+}
+
+// saveExecutionAsNote writes a completed execution's results to a new note
+// in the notebook given by notebook_id
+func (aor *AgentOrchestratorRoutes) saveExecutionAsNote(c *gin.Context) {
+	userUUID := getUserUUID(c, aor.db)
+
+	notebookID, err := uuid.Parse(c.Query("notebook_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A valid notebook_id is required"})
+		return
+	}
+
+	note, err := aor.orchestrator.SaveExecutionAsNote(userUUID, c.Param("id"), notebookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Execution results not found"})
+		case errors.Is(err, services.ErrNotebookNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found"})
+		case errors.Is(err, services.ErrExecutionNotCompleted):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrLimitExceeded):
+			respondLimitExceeded(c, err)
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"note_id":     note.ID,
+		"notebook_id": note.NotebookID,
+		"title":       note.Title,
+	})
+}
+
 // listChains returns all available chains
 func (aor *AgentOrchestratorRoutes) listChains(c *gin.Context) {
 	// In a real implementation, this would query the database
@@ -135,7 +301,7 @@ func (aor *AgentOrchestratorRoutes) listChains(c *gin.Context) {
 		},
 	}
 	
-	c.JSON(http.StatusOK, gin.H{
+	respondList(c, chains, gin.H{
 		"chains": chains,
 		"count":  len(chains),
 	})
@@ -210,83 +376,64 @@ func (aor *AgentOrchestratorRoutes) deleteChain(c *gin.Context) {
 	})
 }
 
-// getAgentTypes returns all available agent types
+// getAgentTypes returns the built-in agent types and the user's remote ones
 func (aor *AgentOrchestratorRoutes) getAgentTypes(c *gin.Context) {
-	agentTypes := []map[string]interface{}{
-		{
-			"type":        "reasoning",
-			"name":        "Reasoning Agent",
-			"description": "Multi-strategy reasoning and problem solving",
-			"input_schema": map[string]interface{}{
-				"problem":        "string (required)",
-				"strategy":       "string (optional)",
-				"max_iterations": "number (optional)",
-			},
-		},
-		{
-			"type":        "chat",
-			"name":        "Chat Agent",
-			"description": "Context-aware conversational agent",
-			"input_schema": map[string]interface{}{
-				"message": "string (required)",
-				"context": "array<string> (optional)",
-			},
-		},
-		{
-			"type":        "web_search",
-			"name":        "Web Search Agent",
-			"description": "Search and retrieve information from the web",
-			"input_schema": map[string]interface{}{
-				"query":       "string (required)",
-				"max_results": "number (optional)",
-			},
-		},
-		{
-			"type":        "note_analyzer",
-			"name":        "Note Analyzer",
-			"description": "Analyze notes and extract insights",
-			"input_schema": map[string]interface{}{
-				"note_id": "string (required)",
-				"action":  "string (optional: analyze, find_related, extract_entities)",
-			},
-		},
-		{
-			"type":        "task_planner",
-			"name":        "Task Planner",
-			"description": "Create detailed task plans from goals",
-			"input_schema": map[string]interface{}{
-				"goal":         "string (required)",
-				"create_tasks": "boolean (optional)",
-			},
-		},
-		{
-			"type":        "summarizer",
-			"name":        "Summarizer",
-			"description": "Create summaries of content",
-			"input_schema": map[string]interface{}{
-				"content":    "string (required)",
-				"style":      "string (optional: concise, bullet, executive, technical)",
-				"max_length": "number (optional)",
-			},
-		},
-		{
-			"type":        "code_generator",
-			"name":        "Code Generator",
-			"description": "Generate code based on specifications",
-			"input_schema": map[string]interface{}{
-				"specification": "string (required)",
-				"language":      "string (optional)",
-				"style":         "string (optional)",
-			},
-		},
+	agentTypes, err := aor.orchestrator.ListAgentTypes(getUserUUID(c, aor.db))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	
+
 	c.JSON(http.StatusOK, gin.H{
 		"agent_types": agentTypes,
 		"count":       len(agentTypes),
 	})
 }
 
+// registerRemoteAgent adds an agent type served by an external HTTP endpoint
+func (aor *AgentOrchestratorRoutes) registerRemoteAgent(c *gin.Context) {
+	var req services.RemoteAgentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	agent, err := aor.orchestrator.RegisterRemoteAgent(getUserUUID(c, aor.db), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrResourceExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"agent":   agent,
+		"message": "Remote agent registered",
+	})
+}
+
+// deleteRemoteAgent removes a remote agent type
+func (aor *AgentOrchestratorRoutes) deleteRemoteAgent(c *gin.Context) {
+	if err := aor.orchestrator.DeleteRemoteAgent(getUserUUID(c, aor.db), c.Param("type")); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Remote agent not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Remote agent deleted"})
+}
+
 // getChainTemplates returns predefined chain templates
 func (aor *AgentOrchestratorRoutes) getChainTemplates(c *gin.Context) {
 	templates := []map[string]interface{}{
@@ -703,15 +850,16 @@ func (aor *AgentOrchestratorRoutes) instantiateTemplate(c *gin.Context) {
 			InitialData: initialData,
 			UserID:      userUUID,
 		}
+		if save, ok := params["save_as_notebook"].(bool); ok {
+			req.SaveAsNotebook = &save
+		}
 		
-		// Start execution in background
-		go func() {
-			// Use background context to prevent cancellation when HTTP request completes
-			_, err := aor.orchestrator.ExecuteChain(context.Background(), req)
-			if err != nil {
-				log.Printf("Background chain execution failed: %v", err)
-			}
-		}()
+		// Start execution in background; it outlives the request and is
+		// cancelled only on shutdown
+		services.AppBackgroundTasks().Go(c.Request.Context(), "chain execution "+chain.Name, func(ctx context.Context) error {
+			_, err := aor.orchestrator.ExecuteChain(ctx, req)
+			return err
+		})
 		
 		c.JSON(http.StatusAccepted, gin.H{
 			"chain":   chain,
@@ -726,6 +874,100 @@ func (aor *AgentOrchestratorRoutes) instantiateTemplate(c *gin.Context) {
 	}
 }
 
+// listSchedules returns the user's scheduled chains
+func (aor *AgentOrchestratorRoutes) listSchedules(c *gin.Context) {
+	schedules, err := aor.scheduler.ListSchedules(getUserUUID(c, aor.db))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedules": schedules,
+		"count":     len(schedules),
+	})
+}
+
+// getSchedule returns a single scheduled chain
+func (aor *AgentOrchestratorRoutes) getSchedule(c *gin.Context) {
+	schedule, err := aor.scheduler.GetSchedule(getUserUUID(c, aor.db), c.Param("id"))
+	if err != nil {
+		aor.respondScheduleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedule": schedule,
+	})
+}
+
+// createSchedule creates a new scheduled chain
+func (aor *AgentOrchestratorRoutes) createSchedule(c *gin.Context) {
+	var input services.ScheduleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule, err := aor.scheduler.CreateSchedule(getUserUUID(c, aor.db), input)
+	if err != nil {
+		aor.respondScheduleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"schedule": schedule,
+		"message":  "Schedule created successfully",
+	})
+}
+
+// updateSchedule updates an existing scheduled chain
+func (aor *AgentOrchestratorRoutes) updateSchedule(c *gin.Context) {
+	var input services.ScheduleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule, err := aor.scheduler.UpdateSchedule(getUserUUID(c, aor.db), c.Param("id"), input)
+	if err != nil {
+		aor.respondScheduleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedule": schedule,
+		"message":  "Schedule updated successfully",
+	})
+}
+
+// deleteSchedule deletes a scheduled chain
+func (aor *AgentOrchestratorRoutes) deleteSchedule(c *gin.Context) {
+	scheduleID := c.Param("id")
+
+	if err := aor.scheduler.DeleteSchedule(getUserUUID(c, aor.db), scheduleID); err != nil {
+		aor.respondScheduleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Schedule deleted successfully",
+		"id":      scheduleID,
+	})
+}
+
+// respondScheduleError maps scheduler errors to HTTP responses
+func (aor *AgentOrchestratorRoutes) respondScheduleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // Helper functions for parameter extraction
 func getStringParam(params map[string]interface{}, key string, defaultValue string) string {
 	if val, ok := params[key]; ok {
@@ -761,17 +1003,9 @@ func getBoolParam(params map[string]interface{}, key string, defaultValue bool)
 	return defaultValue
 }
 
-// getSingleUserIDFromDB returns the first user ID for single-user systems
+// getSingleUserIDFromDB returns the configured single user's ID, validated at startup
 func getSingleUserIDFromDB(db *gorm.DB) uuid.UUID {
-	var user struct {
-		ID uuid.UUID `gorm:"column:id"`
-	}
-	if err := db.Table("users").First(&user).Error; err != nil {
-		// Return the intended single-user UUID as fallback
-		singleUserUUID, _ := uuid.Parse("00000000-0000-0000-0000-000000000001")
-		return singleUserUUID
-	}
-	return user.ID
+	return database.SingleUserID()
 }
 
 // getUserUUID safely extracts and converts user ID from gin context
@@ -2,7 +2,9 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -12,6 +14,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	"gorm.io/gorm"
+	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/models"
 	"owlistic-notes/owlistic/services"
 )
@@ -40,9 +43,17 @@ func (ar *AIRoutes) RegisterRoutes(routerGroup *gin.RouterGroup) {
 	aiGroup := routerGroup.Group("/ai")
 	{
 		// Note AI enhancements
-		aiGroup.POST("/notes/:id/process", ar.processNoteWithAI)
+		aiGroup.POST("/notes/:id/process", requireAIActive, ar.processNoteWithAI)
 		aiGroup.GET("/notes/:id/enhanced", ar.getEnhancedNote)
+		aiGroup.POST("/notes/:id/retry-failed", requireAIActive, ar.retryFailedEnhancements)
+		aiGroup.POST("/notes/:id/continue", requireAIActive, ar.continueNote)
+		aiGroup.POST("/notes/:id/explain", requireAIActive, ar.explainNote)
 		aiGroup.POST("/notes/search/semantic", ar.semanticSearch)
+		aiGroup.GET("/tags/suggest-merges", requireAIActive, ar.suggestTagMerges)
+
+		// Notebook digests
+		aiGroup.POST("/notebooks/:id/summary", requireAIActive, ar.generateNotebookSummary)
+		aiGroup.GET("/notebooks/:id/summary", ar.getNotebookSummary)
 		
 		// AI Projects
 		aiGroup.POST("/projects", ar.createAIProject)
@@ -52,21 +63,26 @@ func (ar *AIRoutes) RegisterRoutes(routerGroup *gin.RouterGroup) {
 		aiGroup.DELETE("/projects/:id", ar.deleteAIProject)
 		
 		// AI Agents
-		aiGroup.POST("/agents/run", ar.runAgent)
+		aiGroup.POST("/agents/run", requireAIActive, ar.runAgent)
 		aiGroup.GET("/agents/runs", ar.getAgentRuns)
 		aiGroup.GET("/agents/runs/:id", ar.getAgentRun)
-		aiGroup.POST("/agents/quick-goal", ar.quickGoalAgent)
-		aiGroup.POST("/agents/task-breakdown", ar.breakDownTask)
+		aiGroup.POST("/agents/quick-goal", requireAIActive, ar.quickGoalAgent)
+		aiGroup.POST("/agents/task-breakdown", requireAIActive, ar.breakDownTask)
+		aiGroup.POST("/tasks/prioritize", ar.prioritizeTasks)
 		
 		// AI Chat/Memory
-		aiGroup.POST("/chat", ar.chatWithAI)
+		aiGroup.POST("/chat", requireAIActive, ar.chatWithAI)
 		aiGroup.GET("/chat/history", ar.getChatHistory)
 		aiGroup.GET("/chat/sessions", ar.getChatSessions)
 		aiGroup.DELETE("/chat/sessions/:id", ar.deleteChatSession)
+		aiGroup.GET("/chat/sessions/:id/export", ar.exportChatSession)
 		
 		// Reasoning Agent
-		aiGroup.POST("/agents/reasoning", ar.runReasoningAgent)
+		aiGroup.POST("/agents/reasoning", requireAIActive, ar.runReasoningAgent)
 		aiGroup.GET("/agents/reasoning/:id", ar.getReasoningAgentResult)
+
+		// What the AI did on the user's behalf
+		aiGroup.GET("/history", ar.getAIHistory)
 	}
 }
 
@@ -94,26 +110,11 @@ func (ar *AIRoutes) processNoteWithAI(c *gin.Context) {
 		return
 	}
 
-	// AI background processing is disabled to prevent goroutine leaks
-	log.Printf("AI background processing is disabled to prevent application crashes")
-	log.Printf("Note: To re-enable, uncomment the AI processing code in ai_routes.go")
-	
-	// Minimal usage to prevent import errors (remove when re-enabling background processing)
-	_ = context.Background()
-	_ = fmt.Sprintf("")
-	
-	/*
-	// Process note with AI in background
-	go func() {
-		// Use background context to prevent cancellation when HTTP request completes
-		ctx := context.Background()
-		if err := ar.aiService.ProcessNoteWithAI(ctx, noteID); err != nil {
-			// Log error - in production, you might want to store this in a job queue
-			// and have proper error handling/retry logic
-			println("AI processing error:", err.Error())
-		}
-	}()
-	*/
+	// Process note with AI in the background; the task outlives the request
+	// and is cancelled only on shutdown
+	services.AppBackgroundTasks().Go(c.Request.Context(), "AI processing of note "+noteID.String(), func(ctx context.Context) error {
+		return ar.aiService.ProcessNoteWithAI(ctx, noteID)
+	})
 
 	c.JSON(http.StatusAccepted, gin.H{
 		"message": "AI processing started",
@@ -121,6 +122,125 @@ func (ar *AIRoutes) processNoteWithAI(c *gin.Context) {
 	})
 }
 
+// explainNote explains selected text, blocks or the whole note in plain
+// language, adding the explanation to the note only with append=true
+func (ar *AIRoutes) explainNote(c *gin.Context) {
+	noteID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid note ID"})
+		return
+	}
+
+	var req struct {
+		BlockIDs  []string `json:"block_ids"`
+		Selection string   `json:"selection"`
+		Level     string   `json:"level"` // eli5, standard or expert
+		Append    bool     `json:"append"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if c.Query("append") == "true" {
+		req.Append = true
+	}
+	if level := c.Query("level"); level != "" && req.Level == "" {
+		req.Level = level
+	}
+
+	opts := services.ExplainOptions{Selection: req.Selection, Level: req.Level, Append: req.Append}
+	for _, id := range req.BlockIDs {
+		blockID, err := uuid.Parse(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid block ID: " + id})
+			return
+		}
+		opts.BlockIDs = append(opts.BlockIDs, blockID)
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userID = ar.getSingleUserIDFromDB()
+	}
+
+	explanation, err := ar.aiService.ExplainNote(c.Request.Context(), noteID, userID.(uuid.UUID), opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNoteNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+		case errors.Is(err, services.ErrInsufficientAccess):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAIUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": services.AIUnavailableMessage})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to explain note", "details": err.Error()})
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if explanation.Block != nil {
+		status = http.StatusCreated
+	}
+	c.JSON(status, explanation)
+}
+
+// continueNote extends a note with AI-written text appended as new blocks
+func (ar *AIRoutes) continueNote(c *gin.Context) {
+	noteID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid note ID"})
+		return
+	}
+
+	var req struct {
+		Length      int    `json:"length"` // Approximate number of words
+		Tone        string `json:"tone"`
+		Instruction string `json:"instruction"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userID = ar.getSingleUserIDFromDB()
+	}
+
+	blocks, err := ar.aiService.ContinueNote(c.Request.Context(), noteID, userID.(uuid.UUID), services.ContinueWritingOptions{
+		Words:       req.Length,
+		Tone:        req.Tone,
+		Instruction: req.Instruction,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNoteNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAIUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": services.AIUnavailableMessage})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to continue note", "details": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"note_id": noteID,
+		"blocks":  blocks,
+	})
+}
+
 // getEnhancedNote returns the AI-enhanced version of a note
 func (ar *AIRoutes) getEnhancedNote(c *gin.Context) {
 	noteIDStr := c.Param("id")
@@ -137,8 +257,12 @@ func (ar *AIRoutes) getEnhancedNote(c *gin.Context) {
 		userID = ar.getSingleUserIDFromDB()
 	}
 
-	var aiNote models.AIEnhancedNote
-	if err := ar.db.Preload("Note").Where("note_id = ?", noteID).Joins("JOIN notes ON notes.id = ai_enhanced_notes.note_id").Where("notes.user_id = ?", userID).First(&aiNote).Error; err != nil {
+	aiNote, err := ar.aiService.GetEnhancedNote(c.Request.Context(), noteID, userID.(uuid.UUID))
+	if err != nil && !errors.Is(err, services.ErrNoteNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load enhanced note", "details": err.Error()})
+		return
+	}
+	if err != nil {
 		// Return regular note if AI enhancement doesn't exist
 		var note models.Note
 		if err := ar.db.Where("id = ? AND user_id = ?", noteID, userID).First(&note).Error; err != nil {
@@ -157,6 +281,15 @@ func (ar *AIRoutes) getEnhancedNote(c *gin.Context) {
 		return
 	}
 
+	if err := ar.aiService.EnsureRelatedNotes(c.Request.Context(), aiNote); err != nil {
+		log.Printf("Failed to compute related notes for %s: %v", noteID, err)
+	}
+
+	// Related notes may have been deleted since they were stored
+	if err := services.PruneRelatedNoteIDs(ar.db, userID.(uuid.UUID), aiNote); err != nil {
+		log.Printf("Failed to prune related notes of %s: %v", noteID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"note": aiNote.Note,
 		"ai_enhancement": gin.H{
@@ -166,11 +299,206 @@ func (ar *AIRoutes) getEnhancedNote(c *gin.Context) {
 			"learning_items":    aiNote.LearningItems,
 			"related_note_ids":  aiNote.RelatedNoteIDs,
 			"processing_status": aiNote.ProcessingStatus,
+			"processing_errors": aiNote.ProcessingErrors,
 			"last_processed_at": aiNote.LastProcessedAt,
 		},
 	})
 }
 
+// retryFailedEnhancements regenerates the enhancements of a note that failed
+// when it was last processed, all of them or those given in the body
+func (ar *AIRoutes) retryFailedEnhancements(c *gin.Context) {
+	noteID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid note ID"})
+		return
+	}
+
+	var req struct {
+		Enhancements []string `json:"enhancements"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userID = ar.getSingleUserIDFromDB()
+	}
+
+	aiNote, err := ar.aiService.RetryFailedEnhancements(c.Request.Context(), noteID, userID.(uuid.UUID), req.Enhancements)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNoteNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Enhanced note not found"})
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAIUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": services.AIUnavailableMessage})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry enhancements", "details": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"note_id":        noteID,
+		"ai_enhancement": aiNote,
+	})
+}
+
+// generateNotebookSummary (re)generates the AI overview of a notebook
+func (ar *AIRoutes) generateNotebookSummary(c *gin.Context) {
+	notebookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notebook ID"})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userID = ar.getSingleUserIDFromDB()
+	}
+
+	notebook, err := ar.aiService.GenerateNotebookSummary(c.Request.Context(), notebookID, userID.(uuid.UUID))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNotebookNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found"})
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate notebook summary", "details": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notebook_id":          notebook.ID,
+		"ai_summary":           notebook.AISummary,
+		"summary_generated_at": notebook.SummaryGeneratedAt,
+	})
+}
+
+// prioritizeTasks previews a suggested order of the user's open tasks. With
+// apply set it stores task_ids, the order the user confirmed, as the
+// priority of those tasks instead.
+func (ar *AIRoutes) prioritizeTasks(c *gin.Context) {
+	var request struct {
+		Apply   bool     `json:"apply"`
+		TaskIDs []string `json:"task_ids"`
+	}
+	// The body is optional; without one the order is previewed
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the configured single user
+		userID = ar.getSingleUserIDFromDB()
+	}
+
+	if !request.Apply {
+		// Applying a confirmed order needs no AI, previewing one does
+		if services.AIPauseInstance.Paused() {
+			respondAIPaused(c)
+			return
+		}
+		ranking, err := ar.aiService.PrioritizeTasks(c.Request.Context(), userID.(uuid.UUID))
+		if err != nil {
+			log.Printf("Failed to prioritize tasks: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prioritize tasks: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tasks": ranking, "applied": false})
+		return
+	}
+
+	taskIDs := make([]uuid.UUID, 0, len(request.TaskIDs))
+	for _, idStr := range request.TaskIDs {
+		taskID, err := uuid.Parse(idStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID: " + idStr})
+			return
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+
+	ranking, err := services.ApplyTaskPriorities(&database.Database{DB: ar.db.WithContext(c.Request.Context())}, userID.(uuid.UUID), taskIDs)
+	if errors.Is(err, services.ErrInvalidInput) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply task priorities: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tasks": ranking, "applied": true})
+}
+
+// suggestTagMerges proposes groups of the user's tags to merge; apply them
+// with POST /tags/merge
+func (ar *AIRoutes) suggestTagMerges(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the configured single user
+		userID = ar.getSingleUserIDFromDB()
+	}
+
+	suggestions, err := ar.aiService.SuggestTagMerges(c.Request.Context(), userID.(uuid.UUID))
+	if err != nil {
+		log.Printf("Failed to suggest tag merges: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suggest tag merges: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+// getNotebookSummary returns the cached AI overview of a notebook
+func (ar *AIRoutes) getNotebookSummary(c *gin.Context) {
+	notebookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notebook ID"})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userID = ar.getSingleUserIDFromDB()
+	}
+
+	var notebook models.Notebook
+	if err := ar.db.Where("id = ? AND user_id = ?", notebookID, userID).First(&notebook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found"})
+		return
+	}
+
+	if notebook.SummaryGeneratedAt == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"notebook_id": notebook.ID,
+			"status":      "not_generated",
+			"message":     "No summary yet, POST to this endpoint to generate one",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notebook_id":          notebook.ID,
+		"status":               "generated",
+		"ai_summary":           notebook.AISummary,
+		"summary_generated_at": notebook.SummaryGeneratedAt,
+	})
+}
+
 // semanticSearch performs AI-powered semantic search
 func (ar *AIRoutes) semanticSearch(c *gin.Context) {
 	var request struct {
@@ -221,6 +549,8 @@ func (ar *AIRoutes) createAIProject(c *gin.Context) {
 		Description string                 `json:"description"`
 		AITags      []string               `json:"ai_tags"`
 		AIMetadata  map[string]interface{} `json:"ai_metadata"`
+		// Note template for the generated step notes, the default layout when empty
+		StepTemplateID string `json:"step_template_id"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -235,6 +565,24 @@ func (ar *AIRoutes) createAIProject(c *gin.Context) {
 		userID = ar.getSingleUserIDFromDB()
 	}
 
+	// Reject unknown templates before anything is created
+	if request.StepTemplateID != "" {
+		_, err := services.NoteTemplateServiceInstance.GetTemplateById(&database.Database{DB: ar.db}, request.StepTemplateID, map[string]interface{}{
+			"user_id": userID.(uuid.UUID).String(),
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "Step template not found"})
+			case errors.Is(err, services.ErrInvalidInput):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load step template"})
+			}
+			return
+		}
+	}
+
 	// Check if this project was created from a task breakdown
 	var notebookID *uuid.UUID
 	var relatedNoteIDs []uuid.UUID
@@ -248,6 +596,7 @@ func (ar *AIRoutes) createAIProject(c *gin.Context) {
 				request.Name,
 				request.Description,
 				breakdownMap,
+				request.StepTemplateID,
 			)
 			if err != nil {
 				log.Printf("Failed to create project notebook: %v", err)
@@ -293,7 +642,7 @@ func (ar *AIRoutes) getAIProjects(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, projects)
+	respondList(c, projects, projects)
 }
 
 // getAIProject returns a specific AI project
@@ -470,7 +819,7 @@ func (ar *AIRoutes) runAgent(c *gin.Context) {
 		var err error
 		
 		// Execute agent based on type
-		executor, exists := orchestrator.GetAgent(services.AgentType(request.AgentType))
+		executor, exists := orchestrator.GetAgent(agent.UserID, services.AgentType(request.AgentType))
 		if !exists {
 			agent.Status = "failed"
 			agent.ErrorMessage = fmt.Sprintf("Unknown agent type: %s", request.AgentType)
@@ -508,6 +857,11 @@ func (ar *AIRoutes) getAgentRuns(c *gin.Context) {
 		userID = ar.getSingleUserIDFromDB()
 	}
 
+	if wantsListEnvelope(c) {
+		ar.getAgentRunsPage(c, userID)
+		return
+	}
+
 	limit := 20
 	if limitStr := c.Query("limit"); limitStr != "" {
 		if l, err := strconv.Atoi(limitStr); err == nil {
@@ -528,6 +882,82 @@ func (ar *AIRoutes) getAgentRuns(c *gin.Context) {
 	c.JSON(http.StatusOK, agents)
 }
 
+// getAIHistory returns a page of the user's AI operations, newest first,
+// optionally filtered by ?type (comma-separated) and the RFC 3339 ?since and
+// ?until. Operations are paged in the query, so the total is not counted.
+func (ar *AIRoutes) getAIHistory(c *gin.Context) {
+	page, err := parsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var filter services.AIHistoryFilter
+	if filter.Types, err = services.ParseAIOperationTypes(c.Query("type")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for param, bound := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if raw := c.Query(param); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC 3339 timestamp"})
+				return
+			}
+			*bound = &parsed
+		}
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userID = ar.getSingleUserIDFromDB()
+	}
+
+	operations, err := services.GetAIHistory(c.Request.Context(), ar.db, userID.(uuid.UUID), filter, page.Offset, page.Limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch AI history"})
+		return
+	}
+
+	more := len(operations) > page.Limit
+	if more {
+		operations = operations[:page.Limit]
+	}
+	if !wantsListEnvelope(c) {
+		c.JSON(http.StatusOK, operations)
+		return
+	}
+	respondPage(c, operations, page, more, nil)
+}
+
+// getAgentRunsPage returns a page of agent runs, newest first. Runs are
+// paged in the query, so the total is not counted.
+func (ar *AIRoutes) getAgentRunsPage(c *gin.Context, userID interface{}) {
+	page, err := parsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var agents []models.AIAgent
+	if err := ar.db.Where("user_id = ?", userID).
+		Preload("Steps").
+		Order("created_at DESC").
+		Offset(page.Offset).
+		Limit(page.Limit + 1).
+		Find(&agents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch agent runs"})
+		return
+	}
+
+	more := len(agents) > page.Limit
+	if more {
+		agents = agents[:page.Limit]
+	}
+	respondPage(c, agents, page, more, nil)
+}
+
 // getAgentRun returns a specific agent run
 func (ar *AIRoutes) getAgentRun(c *gin.Context) {
 	agentIDStr := c.Param("id")
@@ -646,6 +1076,9 @@ func (ar *AIRoutes) breakDownTask(c *gin.Context) {
 		MaxSteps    int                    `json:"max_steps"`
 		Priority    string                 `json:"priority"`
 		Preferences map[string]interface{} `json:"preferences"`
+		CreateTasks bool                   `json:"create_tasks"`
+		CreateNotes bool                   `json:"create_notes"`
+		NotebookID  string                 `json:"notebook_id"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -660,6 +1093,24 @@ func (ar *AIRoutes) breakDownTask(c *gin.Context) {
 		userID = ar.getSingleUserIDFromDB()
 	}
 
+	opts := services.BreakdownOptions{CreateTasks: request.CreateTasks, CreateNotes: request.CreateNotes}
+	if request.NotebookID != "" {
+		notebookID, err := uuid.Parse(request.NotebookID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notebook_id"})
+			return
+		}
+		opts.NotebookID = notebookID
+	}
+	if err := ar.aiService.CheckBreakdownNotebook(userID.(uuid.UUID), opts); err != nil {
+		if errors.Is(err, services.ErrInsufficientAccess) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Call AI service to break down the task
 	breakdown, err := ar.aiService.BreakDownTask(c.Request.Context(), request.Goal, request.Context, request.MaxSteps)
 	if err != nil {
@@ -667,6 +1118,16 @@ func (ar *AIRoutes) breakDownTask(c *gin.Context) {
 		return
 	}
 
+	// Turn the steps into tasks and/or step notes when asked to
+	created, err := ar.aiService.SaveBreakdown(c.Request.Context(), userID.(uuid.UUID), request.Goal, request.Context, breakdown, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save task breakdown: " + err.Error(), "breakdown": breakdown})
+		return
+	}
+	if created != nil {
+		breakdown["created"] = created
+	}
+
 	// Store the task breakdown as an AI agent run for tracking
 	agent := models.AIAgent{
 		UserID:    userID.(uuid.UUID),
@@ -679,6 +1140,9 @@ func (ar *AIRoutes) breakDownTask(c *gin.Context) {
 			"max_steps":    request.MaxSteps,
 			"priority":     request.Priority,
 			"preferences":  request.Preferences,
+			"create_tasks": request.CreateTasks,
+			"create_notes": request.CreateNotes,
+			"notebook_id":  request.NotebookID,
 		},
 		OutputData: breakdown,
 	}
@@ -731,12 +1195,42 @@ func (ar *AIRoutes) deleteChatSession(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Chat session deleted successfully"})
 }
 
+// exportChatSession downloads a chat session as a Markdown transcript
+func (ar *AIRoutes) exportChatSession(c *gin.Context) {
+	// For single-user mode, use default user ID if not authenticated
+	userID, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userID = ar.getSingleUserIDFromDB()
+	}
+
+	transcript, err := ar.chatService.ExportChatSession(c.Request.Context(), userID.(uuid.UUID), c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export chat session"})
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", transcript.Filename()))
+	c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(transcript.Markdown))
+}
+
 // runReasoningAgent starts a reasoning loop agent
 func (ar *AIRoutes) runReasoningAgent(c *gin.Context) {
 	var request struct {
 		Goal     string `json:"goal" binding:"required"`
 		Context  string `json:"context"`
 		Strategy string `json:"strategy"` // methodical, exploratory, focused
+		// SaveAsNote writes the run up as a note, in NotebookID or the
+		// user's reasoning notebook
+		SaveAsNote bool   `json:"save_as_note"`
+		NotebookID string `json:"notebook_id"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -744,6 +1238,16 @@ func (ar *AIRoutes) runReasoningAgent(c *gin.Context) {
 		return
 	}
 
+	opts := services.ReasoningOptions{SaveAsNote: request.SaveAsNote}
+	if request.NotebookID != "" {
+		notebookID, err := uuid.Parse(request.NotebookID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notebook ID"})
+			return
+		}
+		opts.NotebookID = notebookID
+	}
+
 	// For single-user mode, use default user ID if not authenticated
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -752,14 +1256,19 @@ func (ar *AIRoutes) runReasoningAgent(c *gin.Context) {
 	}
 
 	// Execute reasoning loop in background
-	agent, err := ar.reasoningAgentService.ExecuteReasoningLoop(
+	agent, err := ar.reasoningAgentService.ExecuteReasoningLoopWithOptions(
 		c.Request.Context(),
 		userID.(uuid.UUID),
 		request.Goal,
 		request.Context,
 		request.Strategy,
+		opts,
 	)
 	
+	if errors.Is(err, services.ErrInsufficientAccess) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot add notes to this notebook"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start reasoning agent: " + err.Error()})
 		return
@@ -768,6 +1277,8 @@ func (ar *AIRoutes) runReasoningAgent(c *gin.Context) {
 	c.JSON(http.StatusAccepted, gin.H{
 		"agent_id": agent.ID,
 		"status": agent.Status,
+		"note_id": agent.OutputData["note_id"],
+		"assessment": agent.OutputData["assessment"],
 		"message": "Reasoning agent started successfully",
 	})
 }
@@ -798,15 +1309,8 @@ func (ar *AIRoutes) getReasoningAgentResult(c *gin.Context) {
 	c.JSON(http.StatusOK, agent)
 }
 
-// getSingleUserIDFromDB returns the first user ID for single-user systems
+// getSingleUserIDFromDB returns the configured single user's ID, validated at startup
 func (ar *AIRoutes) getSingleUserIDFromDB() uuid.UUID {
-	var user models.User
-	if err := ar.db.First(&user).Error; err != nil {
-		log.Printf("Warning: No users found in database for single-user mode")
-		// Return the intended single-user UUID as fallback
-		singleUserUUID, _ := uuid.Parse("00000000-0000-0000-0000-000000000001")
-		return singleUserUUID
-	}
-	return user.ID
+	return database.SingleUserID()
 }
 
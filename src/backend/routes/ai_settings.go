@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func RegisterAISettingsRoutes(group *gin.RouterGroup, db *database.Database, settingsService services.AISettingsServiceInterface) {
+	group.GET("/notebooks/:id/ai-settings", func(c *gin.Context) { GetNotebookAISettings(c, db, settingsService) })
+	group.PUT("/notebooks/:id/ai-settings", func(c *gin.Context) { UpdateNotebookAISettings(c, db, settingsService) })
+	group.GET("/notes/:id/ai-settings", func(c *gin.Context) { GetNoteAISettings(c, db, settingsService) })
+	group.PUT("/notes/:id/ai-settings", func(c *gin.Context) { UpdateNoteAISettings(c, db, settingsService) })
+	group.GET("/ai/settings", func(c *gin.Context) { GetUserAISettings(c, db, settingsService) })
+	group.PUT("/ai/settings", func(c *gin.Context) { UpdateUserAISettings(c, db, settingsService) })
+}
+
+func aiSettingsParams(c *gin.Context, db *database.Database) map[string]interface{} {
+	params := make(map[string]interface{})
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the configured single user
+		userIDInterface = getSingleUserID(db)
+	}
+	params["user_id"] = userIDInterface.(uuid.UUID).String()
+	return params
+}
+
+func GetNotebookAISettings(c *gin.Context, db *database.Database, settingsService services.AISettingsServiceInterface) {
+	view, err := settingsService.GetNotebookAISettings(db, c.Param("id"), aiSettingsParams(c, db))
+	respondAISettings(c, view, err)
+}
+
+func UpdateNotebookAISettings(c *gin.Context, db *database.Database, settingsService services.AISettingsServiceInterface) {
+	var settings models.AISettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	view, err := settingsService.UpdateNotebookAISettings(db, c.Param("id"), settings, aiSettingsParams(c, db))
+	respondAISettings(c, view, err)
+}
+
+func GetNoteAISettings(c *gin.Context, db *database.Database, settingsService services.AISettingsServiceInterface) {
+	view, err := settingsService.GetNoteAISettings(db, c.Param("id"), aiSettingsParams(c, db))
+	respondAISettings(c, view, err)
+}
+
+func UpdateNoteAISettings(c *gin.Context, db *database.Database, settingsService services.AISettingsServiceInterface) {
+	var settings models.AISettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	view, err := settingsService.UpdateNoteAISettings(db, c.Param("id"), settings, aiSettingsParams(c, db))
+	respondAISettings(c, view, err)
+}
+
+func GetUserAISettings(c *gin.Context, db *database.Database, settingsService services.AISettingsServiceInterface) {
+	view, err := settingsService.GetUserAISettings(db, c.Query("notebook_id"), aiSettingsParams(c, db))
+	respondAISettings(c, view, err)
+}
+
+func UpdateUserAISettings(c *gin.Context, db *database.Database, settingsService services.AISettingsServiceInterface) {
+	var settings services.UserAISettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	view, err := settingsService.UpdateUserAISettings(db, settings, aiSettingsParams(c, db))
+	respondAISettings(c, view, err)
+}
+
+func respondAISettings(c *gin.Context, view interface{}, err error) {
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, view)
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotebookNotFound), errors.Is(err, services.ErrNoteNotFound), errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInsufficientAccess):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
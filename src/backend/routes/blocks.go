@@ -102,6 +102,13 @@ func CreateBlock(c *gin.Context, db *database.Database, blockService services.Bl
 
 	block, err := blockService.CreateBlock(db, blockData, params)
 	if err != nil {
+		if respondLimitExceeded(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -162,7 +169,7 @@ func UpdateBlock(c *gin.Context, db *database.Database, blockService services.Bl
 			c.JSON(http.StatusNotFound, gin.H{"error": "Block not found"})
 			return
 		} else if errors.Is(err, services.ErrInvalidInput) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
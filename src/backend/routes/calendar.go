@@ -1,7 +1,9 @@
 package routes
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -32,6 +34,12 @@ func NewCalendarRoutes(db *gorm.DB) (*CalendarRoutes, error) {
 	}, nil
 }
 
+// TokenRefresher returns a refresher for the calendar tokens; the caller
+// starts and stops it
+func (cr *CalendarRoutes) TokenRefresher() *services.CalendarTokenRefresher {
+	return services.NewCalendarTokenRefresher(cr.calendarService)
+}
+
 // getUserID extracts user ID from context, falling back to single-user mode
 func (cr *CalendarRoutes) getUserID(c *gin.Context) (uuid.UUID, error) {
 	userID, exists := c.Get("userID")
@@ -81,6 +89,10 @@ func (cr *CalendarRoutes) RegisterPublicRoutes(routerGroup *gin.RouterGroup) {
 
 		// Manual sync (public for single-user mode)
 		calendarGroup.POST("/sync", cr.performSync)
+
+		// Events changed both locally and in Google, under the manual policy
+		calendarGroup.GET("/conflicts", cr.getConflicts)
+		calendarGroup.POST("/conflicts/:id/resolve", cr.resolveConflict)
 	}
 }
 
@@ -216,8 +228,9 @@ func (cr *CalendarRoutes) syncCalendar(c *gin.Context) {
 	}
 
 	var request struct {
-		CalendarName  string `json:"calendar_name" binding:"required"`
-		SyncDirection string `json:"sync_direction"` // read_only, write_only, bidirectional
+		CalendarName   string `json:"calendar_name" binding:"required"`
+		SyncDirection  string `json:"sync_direction"`  // read_only, write_only, bidirectional
+		ConflictPolicy string `json:"conflict_policy"` // google-wins, local-wins, newest-wins, manual
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -230,16 +243,21 @@ func (cr *CalendarRoutes) syncCalendar(c *gin.Context) {
 		request.SyncDirection = "bidirectional"
 	}
 
-	if err := cr.calendarService.SyncCalendar(c.Request.Context(), userUUID, calendarID, request.CalendarName, request.SyncDirection); err != nil {
+	if err := cr.calendarService.SyncCalendar(c.Request.Context(), userUUID, calendarID, request.CalendarName, request.SyncDirection, request.ConflictPolicy); err != nil {
+		if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to setup calendar sync: " + err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":        "Calendar sync configured successfully",
-		"calendar_id":    calendarID,
-		"calendar_name":  request.CalendarName,
-		"sync_direction": request.SyncDirection,
+		"message":         "Calendar sync configured successfully",
+		"calendar_id":     calendarID,
+		"calendar_name":   request.CalendarName,
+		"sync_direction":  request.SyncDirection,
+		"conflict_policy": request.ConflictPolicy,
 	})
 }
 
@@ -429,32 +447,36 @@ func (cr *CalendarRoutes) performSync(c *gin.Context) {
 		CalendarID string `json:"calendar_id"`
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
+	// The body is optional; without one every calendar is synced
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	if request.CalendarID == "" {
-		// Sync all calendars
-		var syncConfigs []models.CalendarSync
-		if err := cr.db.Where("user_id = ? AND sync_enabled = true", userUUID).Find(&syncConfigs).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sync configurations"})
+		// Sync all calendars, reporting each one
+		results, err := cr.calendarService.SyncAllCalendars(c.Request.Context(), userUUID)
+		if errors.Is(err, services.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync calendars: " + err.Error()})
 			return
 		}
 
 		syncCount := 0
-		for _, config := range syncConfigs {
-			if err := cr.calendarService.PerformSync(c.Request.Context(), userUUID, config.GoogleCalendarID); err != nil {
-				// Log error but continue with other calendars
-				continue
+		for _, result := range results {
+			if result.Error == "" {
+				syncCount++
 			}
-			syncCount++
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"message":           "Sync completed",
-			"calendars_synced":  syncCount,
-			"total_calendars":   len(syncConfigs),
+			"message":          "Sync completed",
+			"calendars_synced": syncCount,
+			"total_calendars":  len(results),
+			"calendars":        results,
 		})
 	} else {
 		// Sync specific calendar
@@ -470,6 +492,62 @@ func (cr *CalendarRoutes) performSync(c *gin.Context) {
 	}
 }
 
+// getConflicts lists the calendar conflicts waiting for the user, or those
+// with the status query parameter
+func (cr *CalendarRoutes) getConflicts(c *gin.Context) {
+	userUUID, err := cr.getUserID(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user ID: " + err.Error()})
+		return
+	}
+
+	conflicts, err := cr.calendarService.GetConflicts(c.Request.Context(), userUUID, c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conflicts": conflicts,
+		"count":     len(conflicts),
+	})
+}
+
+// resolveConflict settles a conflict with the Google or the local version
+func (cr *CalendarRoutes) resolveConflict(c *gin.Context) {
+	userUUID, err := cr.getUserID(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user ID: " + err.Error()})
+		return
+	}
+
+	conflictID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conflict ID"})
+		return
+	}
+
+	var request struct {
+		Resolution string `json:"resolution" binding:"required"` // google, local
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conflict, err := cr.calendarService.ResolveConflict(c.Request.Context(), userUUID, conflictID, request.Resolution)
+	switch {
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotFound), errors.Is(err, services.ErrEventNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve conflict: " + err.Error()})
+	default:
+		c.JSON(http.StatusOK, conflict)
+	}
+}
+
 // getOAuthConfig returns the current OAuth configuration for setup purposes
 func (cr *CalendarRoutes) getOAuthConfig(c *gin.Context) {
 	// This endpoint doesn't require authentication as it's for setup purposes
@@ -1,12 +1,14 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/models"
 	"owlistic-notes/owlistic/services"
 )
@@ -29,6 +31,7 @@ func (cr *ChromaRoutes) RegisterRoutes(router *gin.RouterGroup) {
 		// Collection management
 		chromaGroup.GET("/stats", cr.getCollectionStats)
 		chromaGroup.POST("/refresh", cr.refreshCollection)
+		chromaGroup.POST("/prune", cr.pruneCollection)
 		
 		// Search endpoints
 		chromaGroup.POST("/search", cr.semanticSearch)
@@ -40,6 +43,14 @@ func (cr *ChromaRoutes) RegisterRoutes(router *gin.RouterGroup) {
 	}
 }
 
+// RegisterAdminRoutes adds the collection tuning routes. They belong on a
+// group behind the auth middleware and need the admin role, as changing the
+// index empties the collection for every user.
+func (cr *ChromaRoutes) RegisterAdminRoutes(router *gin.RouterGroup, db *database.Database, roleService services.RoleServiceInterface) {
+	chromaGroup := router.Group("/chroma", func(c *gin.Context) { requireAdmin(c, db, roleService) })
+	chromaGroup.PUT("/config", cr.updateCollectionConfig)
+}
+
 // getCollectionStats returns statistics about the ChromaDB collection
 func (cr *ChromaRoutes) getCollectionStats(c *gin.Context) {
 	stats, err := cr.aiService.GetChromaCollectionStats(c.Request.Context())
@@ -57,20 +68,91 @@ func (cr *ChromaRoutes) getCollectionStats(c *gin.Context) {
 	})
 }
 
-// refreshCollection rebuilds the entire ChromaDB collection
+// updateCollectionConfig recreates the collection with new HNSW parameters.
+// Fields left out keep their current value.
+func (cr *ChromaRoutes) updateCollectionConfig(c *gin.Context) {
+	config := cr.aiService.HNSWConfig(c.Request.Context())
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	config, err := cr.aiService.UpdateHNSWConfig(c.Request.Context(), config)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrBulkJobRunning):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to update collection config",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hnsw": config,
+		"reindex_required": true,
+		"message": "Collection recreated with the new parameters. It is empty until notes are reindexed with POST /ai/chroma/refresh.",
+	})
+}
+
+// refreshCollection rebuilds the entire ChromaDB collection as a reindex job
 func (cr *ChromaRoutes) refreshCollection(c *gin.Context) {
-	// This could be a long operation, so we'll do it asynchronously
-	go func() {
-		if err := cr.aiService.RefreshChromaCollection(c.Request.Context()); err != nil {
-			// Log error - in production, you might want to store this status somewhere
-			// or use a job queue system
-			println("Error refreshing ChromaDB collection:", err.Error())
+	if services.BulkJobServiceInstance == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Background jobs are not available"})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	job, err := services.BulkJobServiceInstance.StartJob(models.BulkJobReindex, userID.(uuid.UUID), nil)
+	if err != nil {
+		if errors.Is(err, services.ErrBulkJobRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A collection refresh is already running"})
+			return
 		}
-	}()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to start collection refresh",
+			"details": err.Error(),
+		})
+		return
+	}
 	
 	c.JSON(http.StatusAccepted, gin.H{
 		"message": "Collection refresh started",
 		"status": "processing",
+		"job_id": job.ID,
+	})
+}
+
+// pruneCollection deletes the embeddings of notes that were deleted or trashed
+func (cr *ChromaRoutes) pruneCollection(c *gin.Context) {
+	if _, exists := c.Get("userID"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result, err := cr.aiService.PruneOrphanedChromaDocuments(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to prune collection",
+			"details": err.Error(),
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Collection pruned successfully",
+		"checked": result.Checked,
+		"pruned": result.Pruned,
 	})
 }
 
@@ -83,8 +165,12 @@ func (cr *ChromaRoutes) semanticSearch(c *gin.Context) {
 	}
 	
 	var req struct {
-		Query string `json:"query" binding:"required"`
-		Limit int    `json:"limit"`
+		Query        string  `json:"query" binding:"required"`
+		Limit        int     `json:"limit"`
+		Order         string   `json:"order"`
+		HalfLifeDays  float64  `json:"half_life_days"`
+		MinSimilarity *float64 `json:"min_similarity"`
+		Backfill      string   `json:"backfill"`
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -92,6 +178,17 @@ func (cr *ChromaRoutes) semanticSearch(c *gin.Context) {
 		return
 	}
 	
+	ranking, err := services.ParseSearchRanking(req.Order, req.HalfLifeDays, req.MinSimilarity)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	backfill, err := services.ParseSearchBackfill(req.Backfill)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
 	// Default limit
 	if req.Limit == 0 {
 		req.Limit = 10
@@ -105,6 +202,8 @@ func (cr *ChromaRoutes) semanticSearch(c *gin.Context) {
 		req.Query,
 		userID.(uuid.UUID),
 		req.Limit,
+		ranking,
+		backfill,
 	)
 	
 	if err != nil {
@@ -115,10 +214,21 @@ func (cr *ChromaRoutes) semanticSearch(c *gin.Context) {
 		return
 	}
 	
+	supplemental := 0
+	for _, result := range results {
+		if result.AIMetadata["supplemental"] == true {
+			supplemental++
+		}
+	}
+	
 	c.JSON(http.StatusOK, gin.H{
 		"results": results,
 		"count": len(results),
+		"supplemental": supplemental,
 		"query": req.Query,
+		"order": ranking.Order,
+		"min_similarity": ranking.MinSimilarity,
+		"backfill": backfill,
 	})
 }
 
@@ -139,8 +249,33 @@ func (cr *ChromaRoutes) getRelatedNotes(c *gin.Context) {
 		}
 	}
 	
+	// Ranking from query params: order=relevance|recency|hybrid,
+	// half_life_days, min_similarity
+	halfLifeDays := 0.0
+	if h := c.Query("half_life_days"); h != "" {
+		halfLifeDays, err = strconv.ParseFloat(h, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid half_life_days"})
+			return
+		}
+	}
+	var minSimilarity *float64
+	if m := c.Query("min_similarity"); m != "" {
+		parsed, err := strconv.ParseFloat(m, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_similarity"})
+			return
+		}
+		minSimilarity = &parsed
+	}
+	ranking, err := services.ParseSearchRanking(c.Query("order"), halfLifeDays, minSimilarity)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
 	// Find related notes
-	relatedNotes, err := cr.aiService.FindRelatedNotes(c.Request.Context(), noteID, limit)
+	relatedNotes, err := cr.aiService.FindRankedRelatedNotes(c.Request.Context(), noteID, limit, ranking)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to find related notes",
@@ -153,6 +288,8 @@ func (cr *ChromaRoutes) getRelatedNotes(c *gin.Context) {
 		"related_notes": relatedNotes,
 		"count": len(relatedNotes),
 		"note_id": noteID,
+		"order": ranking.Order,
+		"min_similarity": ranking.MinSimilarity,
 	})
 }
 
@@ -2,19 +2,30 @@ package routes
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
-// SetupDebugRoutes sets up routes for debugging
-func SetupDebugRoutes(router *gin.Engine, db *database.Database) {
-	debugGroup := router.Group("/api/v1/debug")
+// SetupDebugRoutes sets up routes for debugging. They belong on a group
+// behind the auth middleware: events are listed for the signed-in user, and
+// the note and queue inspection routes, which see every user's data, are for
+// admins only.
+func SetupDebugRoutes(group *gin.RouterGroup, db *database.Database, roleService services.RoleServiceInterface, debugEvents *services.DebugEventService) {
+	debugGroup := group.Group("/debug")
 	{
-		debugGroup.GET("/note-exists/:id", func(c *gin.Context) {
+		// Recent events, filtered by type, entity_id, since and until (RFC3339)
+		debugGroup.GET("/events", func(c *gin.Context) { GetDebugEvents(c, debugEvents) })
+
+		admin := func(c *gin.Context) { requireAdmin(c, db, roleService) }
+
+		debugGroup.GET("/note-exists/:id", admin, func(c *gin.Context) {
 			id := c.Param("id")
 
 			// Check if note exists
@@ -40,7 +51,7 @@ func SetupDebugRoutes(router *gin.Engine, db *database.Database) {
 		})
 
 		// Add route to check transaction processing queue
-		debugGroup.GET("/event-queue", func(c *gin.Context) {
+		debugGroup.GET("/event-queue", admin, func(c *gin.Context) {
 			var events []models.Event
 			db.DB.Where("dispatched = ?", false).Find(&events)
 
@@ -52,3 +63,54 @@ func SetupDebugRoutes(router *gin.Engine, db *database.Database) {
 		})
 	}
 }
+
+// RegisterDebugStreamRoutes streams live events to the authenticated user
+func RegisterDebugStreamRoutes(group *gin.RouterGroup, debugEvents *services.DebugEventService) {
+	group.GET("/debug", func(c *gin.Context) { debugEvents.HandleStream(c) })
+}
+
+func GetDebugEvents(c *gin.Context, debugEvents *services.DebugEventService) {
+	filter := services.DebugEventFilter{
+		Type:     c.Query("type"),
+		EntityID: c.Query("entity_id"),
+	}
+
+	// Users only ever see their own events
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	filter.UserID = userID.(uuid.UUID).String()
+
+	for param, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := c.Query(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC3339 time"})
+				return
+			}
+			*target = parsed
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+			return
+		}
+		filter.Limit = n
+	}
+
+	events, err := debugEvents.ListEvents(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"count":  len(events),
+		"time":   time.Now(),
+	})
+}
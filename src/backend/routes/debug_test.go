@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"owlistic-notes/owlistic/services"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugRoutes_EventsAreScopedToTheSignedInUser(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	debugEvents := services.NewDebugEventService(db)
+
+	// Without a signed-in user nothing is listed
+	router := gin.New()
+	SetupDebugRoutes(router.Group("/api/v1"), db, &adminRoleService{}, debugEvents)
+	w := serve(router, "GET", "/api/v1/debug/events", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	userID := uuid.New()
+	router = gin.New()
+	SetupDebugRoutes(router.Group("/api/v1", func(c *gin.Context) { c.Set("userID", userID) }), db, &adminRoleService{}, debugEvents)
+	mock.ExpectQuery(`SELECT \* FROM "events" WHERE data->>'user_id' = \$1`).
+		WithArgs(userID.String(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	w = serve(router, "GET", "/api/v1/debug/events", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Inspecting any user's notes and queued events is for admins
+	w = serve(router, "GET", "/api/v1/debug/event-queue", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serve(router, "GET", "/api/v1/debug/note-exists/"+uuid.New().String(), "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrchestratorDebugRoutes_NeedTheAdminRole(t *testing.T) {
+	db, _, close := testutils.SetupMockDB()
+	defer close()
+	aor := &AgentOrchestratorRoutes{db: db.DB}
+
+	for _, admin := range []bool{false, true} {
+		router := gin.New()
+		aor.RegisterDebugRoutes(router.Group("/api/v1", func(c *gin.Context) { c.Set("userID", uuid.New()) }), &adminRoleService{admin: admin})
+
+		w := serve(router, "POST", "/api/v1/debug/orchestrator/gc?older_than=soon", "")
+		if admin {
+			assert.Equal(t, http.StatusBadRequest, w.Code, "admins reach the handler")
+		} else {
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			assert.Equal(t, http.StatusForbidden, serve(router, "GET", "/api/v1/debug/orchestrator", "").Code)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"encoding/json"
+)
+
+// projectFields converts a list of models to JSON objects holding only the
+// given fields, so columns that were not selected don't show up as zero values
+func projectFields(items interface{}, fields []string) ([]map[string]interface{}, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]interface{}
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+
+	projected := make([]map[string]interface{}, 0, len(objects))
+	for _, object := range objects {
+		item := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			if value, ok := object[field]; ok {
+				item[field] = value
+			}
+		}
+		projected = append(projected, item)
+	}
+	return projected, nil
+}
@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func RegisterJobRoutes(group *gin.RouterGroup, db *database.Database, jobService *services.BulkJobService) {
+	group.GET("/jobs", func(c *gin.Context) { GetJobs(c, db, jobService) })
+	group.GET("/jobs/:id", func(c *gin.Context) { GetJob(c, db, jobService) })
+	group.POST("/jobs", func(c *gin.Context) { StartJob(c, db, jobService) })
+}
+
+func jobUserID(c *gin.Context, db *database.Database) uuid.UUID {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userIDInterface = getSingleUserID(db)
+	}
+	return userIDInterface.(uuid.UUID)
+}
+
+// StartJob starts a process-all or reindex job. process-all covers the
+// user's notes, optionally only those of one notebook.
+func StartJob(c *gin.Context, db *database.Database, jobService *services.BulkJobService) {
+	var req struct {
+		Type       string `json:"type" binding:"required"`
+		NotebookID string `json:"notebook_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := jobUserID(c, db)
+	scope := map[string]interface{}{"user_id": userID.String()}
+	if req.NotebookID != "" {
+		scope["notebook_id"] = req.NotebookID
+	}
+
+	job, err := jobService.StartJob(req.Type, userID, scope)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func GetJobs(c *gin.Context, db *database.Database, jobService *services.BulkJobService) {
+	jobs, err := jobService.ListJobs(jobUserID(c, db))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+func GetJob(c *gin.Context, db *database.Database, jobService *services.BulkJobService) {
+	job, err := jobService.GetJob(c.Param("id"), jobUserID(c, db))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func respondJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case errors.Is(err, services.ErrBulkJobRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAIPaused):
+		respondAIPaused(c)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func RegisterLinkRoutes(group *gin.RouterGroup, db *database.Database, linkService services.LinkServiceInterface) {
+	group.POST("/notes/:id/links", func(c *gin.Context) { AddNoteLink(c, db, linkService) })
+}
+
+// AddNoteLink appends a bookmark of the URL, with the page's title and
+// description, to the note
+func AddNoteLink(c *gin.Context, db *database.Database, linkService services.LinkServiceInterface) {
+	var request struct {
+		URL string `json:"url" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params := make(map[string]interface{})
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the configured single user
+		userIDInterface = getSingleUserID(db)
+	}
+	params["user_id"] = userIDInterface.(uuid.UUID).String()
+
+	block, err := linkService.AddLink(c.Request.Context(), db, c.Param("id"), request.URL, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInput), errors.Is(err, services.ErrBlockedAddress):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInsufficientAccess):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, block)
+}
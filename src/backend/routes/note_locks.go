@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func RegisterNoteLockRoutes(group *gin.RouterGroup, db *database.Database, lockService services.NoteLockServiceInterface) {
+	group.GET("/notes/:id/lock", func(c *gin.Context) { GetNoteLock(c, db, lockService) })
+	group.POST("/notes/:id/lock", func(c *gin.Context) { AcquireNoteLock(c, db, lockService) })
+	group.DELETE("/notes/:id/lock", func(c *gin.Context) { ReleaseNoteLock(c, db, lockService) })
+}
+
+func noteLockParams(c *gin.Context, db *database.Database) map[string]interface{} {
+	params := make(map[string]interface{})
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userIDInterface = getSingleUserID(db)
+	}
+	params["user_id"] = userIDInterface.(uuid.UUID).String()
+	return params
+}
+
+func AcquireNoteLock(c *gin.Context, db *database.Database, lockService services.NoteLockServiceInterface) {
+	var req struct {
+		TTLSeconds float64 `json:"ttl_seconds"`
+		ClientID   string  `json:"client_id"`
+	}
+	// The body is optional, an empty request takes the default TTL
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	params := noteLockParams(c, db)
+	params["ttl_seconds"] = req.TTLSeconds
+	params["client_id"] = req.ClientID
+
+	lock, err := lockService.AcquireLock(db, c.Param("id"), params)
+	if err != nil {
+		respondNoteLockError(c, lock, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, lock)
+}
+
+func ReleaseNoteLock(c *gin.Context, db *database.Database, lockService services.NoteLockServiceInterface) {
+	if err := lockService.ReleaseLock(db, c.Param("id"), noteLockParams(c, db)); err != nil {
+		respondNoteLockError(c, models.NoteLock{}, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Note unlocked"})
+}
+
+func GetNoteLock(c *gin.Context, db *database.Database, lockService services.NoteLockServiceInterface) {
+	lock, err := lockService.GetLock(db, c.Param("id"), noteLockParams(c, db))
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			c.JSON(http.StatusOK, gin.H{"locked": false})
+			return
+		}
+		respondNoteLockError(c, lock, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"locked": true, "lock": lock})
+}
+
+func respondNoteLockError(c *gin.Context, lock models.NoteLock, err error) {
+	switch {
+	case errors.Is(err, services.ErrNoteLocked):
+		body := gin.H{"error": err.Error()}
+		if lock.NoteID != uuid.Nil {
+			body["lock"] = lock
+		}
+		c.JSON(http.StatusConflict, body)
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
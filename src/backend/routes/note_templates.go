@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func RegisterNoteTemplateRoutes(group *gin.RouterGroup, db *database.Database, templateService services.NoteTemplateServiceInterface) {
+	group.GET("/note-templates", func(c *gin.Context) { GetNoteTemplates(c, db, templateService) })
+	group.POST("/note-templates", func(c *gin.Context) { CreateNoteTemplate(c, db, templateService) })
+	group.GET("/note-templates/:id", func(c *gin.Context) { GetNoteTemplateById(c, db, templateService) })
+	group.DELETE("/note-templates/:id", func(c *gin.Context) { DeleteNoteTemplate(c, db, templateService) })
+}
+
+func noteTemplateParams(c *gin.Context, db *database.Database) map[string]interface{} {
+	params := make(map[string]interface{})
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userIDInterface = getSingleUserID(db)
+	}
+	params["user_id"] = userIDInterface.(uuid.UUID).String()
+	return params
+}
+
+func CreateNoteTemplate(c *gin.Context, db *database.Database, templateService services.NoteTemplateServiceInterface) {
+	var req struct {
+		Name        string                    `json:"name" binding:"required"`
+		Description string                    `json:"description"`
+		Blocks      models.NoteTemplateBlocks `json:"blocks" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	noteTemplate, err := templateService.CreateTemplate(db, map[string]interface{}{
+		"name":        req.Name,
+		"description": req.Description,
+		"blocks":      req.Blocks,
+	}, noteTemplateParams(c, db))
+	if err != nil {
+		respondNoteTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, noteTemplate)
+}
+
+func GetNoteTemplates(c *gin.Context, db *database.Database, templateService services.NoteTemplateServiceInterface) {
+	templates, err := templateService.GetTemplates(db, noteTemplateParams(c, db))
+	if err != nil {
+		respondNoteTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+func GetNoteTemplateById(c *gin.Context, db *database.Database, templateService services.NoteTemplateServiceInterface) {
+	noteTemplate, err := templateService.GetTemplateById(db, c.Param("id"), noteTemplateParams(c, db))
+	if err != nil {
+		respondNoteTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, noteTemplate)
+}
+
+func DeleteNoteTemplate(c *gin.Context, db *database.Database, templateService services.NoteTemplateServiceInterface) {
+	if err := templateService.DeleteTemplate(db, c.Param("id"), noteTemplateParams(c, db)); err != nil {
+		respondNoteTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Note template deleted"})
+}
+
+func respondNoteTemplateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note template not found"})
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
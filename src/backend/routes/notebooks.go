@@ -3,6 +3,7 @@ package routes
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/services"
@@ -20,6 +21,8 @@ func RegisterNotebookRoutes(group *gin.RouterGroup, db *database.Database, noteb
 	group.GET("/notebooks/:id", func(c *gin.Context) { GetNotebookById(c, db, notebookService) })
 	group.PUT("/notebooks/:id", func(c *gin.Context) { UpdateNotebook(c, db, notebookService) })
 	group.DELETE("/notebooks/:id", func(c *gin.Context) { DeleteNotebook(c, db, notebookService) })
+	group.PATCH("/notebooks/:id/notes/reorder", func(c *gin.Context) { ReorderNotebookNotes(c, db, notebookService) })
+	group.GET("/notebooks/:id/whats-new", func(c *gin.Context) { GetNotebookWhatsNew(c, db, notebookService) })
 }
 
 func GetNotebooks(c *gin.Context, db *database.Database, notebookService services.NotebookServiceInterface) {
@@ -40,12 +43,17 @@ func GetNotebooks(c *gin.Context, db *database.Database, notebookService service
 		params["name"] = name
 	}
 
+	page, ok := pageListParams(c, params)
+	if !ok {
+		return
+	}
+
 	notebooks, err := notebookService.GetNotebooks(db, params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, notebooks)
+	respondCountedPage(c, notebooks, page, func() (int64, error) { return notebookService.CountNotebooks(db, params) })
 }
 
 func CreateNotebook(c *gin.Context, db *database.Database, notebookService services.NotebookServiceInterface) {
@@ -66,6 +74,9 @@ func CreateNotebook(c *gin.Context, db *database.Database, notebookService servi
 
 	notebook, err := notebookService.CreateNotebook(db, notebookData)
 	if err != nil {
+		if respondLimitExceeded(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -99,6 +110,85 @@ func GetNotebookById(c *gin.Context, db *database.Database, notebookService serv
 	c.JSON(http.StatusOK, notebook)
 }
 
+// GetNotebookWhatsNew lists the notes created or modified in a notebook since
+// ?since, or since the user's last visit, and with ?summarize=true adds an AI
+// summary of the changes. The call counts as a visit unless
+// ?mark_visited=false.
+func GetNotebookWhatsNew(c *gin.Context, db *database.Database, notebookService services.NotebookServiceInterface) {
+	visitedAt := time.Now()
+	id := c.Param("id")
+
+	var since *time.Time
+	if raw := c.Query("since"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 timestamp"})
+			return
+		}
+		since = &parsed
+	}
+
+	summarize := c.Query("summarize") == "true"
+	if summarize {
+		if services.AIPauseInstance.Paused() {
+			respondAIPaused(c)
+			return
+		}
+		if services.AIServiceInstance == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI is not configured"})
+			return
+		}
+	}
+
+	params := make(map[string]interface{})
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userIDInterface = getSingleUserID(db)
+	}
+	userID := userIDInterface.(uuid.UUID)
+	params["user_id"] = userID.String()
+
+	notebook, err := notebookService.GetNotebookById(db, id, params)
+	if err != nil {
+		if errors.Is(err, services.ErrNotebookNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	whatsNew, err := services.GetNotebookWhatsNew(c.Request.Context(), db.DB, userID, notebook.ID, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if summarize {
+		whatsNew.Summary, err = services.AIServiceInstance.SummarizeNotebookChanges(c.Request.Context(), userID, notebook, whatsNew)
+		if err != nil {
+			if errors.Is(err, services.ErrAIUnavailable) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": services.AIUnavailableMessage})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarize changes", "details": err.Error()})
+			return
+		}
+	}
+
+	// Only a visit once the changes were delivered, so a failed summary
+	// doesn't lose them
+	if c.Query("mark_visited") != "false" {
+		if err := services.RecordNotebookVisit(c.Request.Context(), db.DB, userID, notebook.ID, visitedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, whatsNew)
+}
+
 func UpdateNotebook(c *gin.Context, db *database.Database, notebookService services.NotebookServiceInterface) {
 	id := c.Param("id")
 	var notebookData map[string]interface{}
@@ -154,3 +244,37 @@ func DeleteNotebook(c *gin.Context, db *database.Database, notebookService servi
 	}
 	c.JSON(http.StatusNoContent, gin.H{})
 }
+
+// ReorderNotebookNotes moves a note within its notebook. The body names the
+// note and the note it should follow: {"note_id": "...", "after_note_id": "..."}.
+// Without after_note_id the note moves to the top.
+func ReorderNotebookNotes(c *gin.Context, db *database.Database, notebookService services.NotebookServiceInterface) {
+	id := c.Param("id")
+	var reorderData map[string]interface{}
+	if err := c.ShouldBindJSON(&reorderData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params := make(map[string]interface{})
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userIDInterface = getSingleUserID(db)
+	}
+	params["user_id"] = userIDInterface.(uuid.UUID).String()
+
+	notes, err := notebookService.ReorderNotes(db, id, reorderData, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNotebookNotFound), errors.Is(err, services.ErrNoteNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, notes)
+}
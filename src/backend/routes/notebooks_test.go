@@ -10,7 +10,9 @@ import (
 	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/models"
 	"owlistic-notes/owlistic/services"
+	"owlistic-notes/owlistic/testutils"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -80,11 +82,19 @@ func (m *MockNotebookService) GetNotebooks(db *database.Database, params map[str
 	return notebooks, nil
 }
 
+func (m *MockNotebookService) CountNotebooks(db *database.Database, params map[string]interface{}) (int64, error) {
+	notebooks, err := m.GetNotebooks(db, params)
+	return int64(len(notebooks)), err
+}
+
 func (m *MockNotebookService) CreateNotebook(db *database.Database, notebookData map[string]interface{}) (models.Notebook, error) {
 	name, ok := notebookData["name"].(string)
 	if !ok || name == "" {
 		return models.Notebook{}, errors.New("name is required")
 	}
+	if name == "One too many" {
+		return models.Notebook{}, &services.LimitExceededError{Resource: services.UsageNotebooks, Limit: 50}
+	}
 
 	userIDStr, ok := notebookData["user_id"].(string)
 	if !ok {
@@ -148,6 +158,18 @@ func (m *MockNotebookService) DeleteNotebook(db *database.Database, id string, p
 	return services.ErrNotebookNotFound
 }
 
+func (m *MockNotebookService) ReorderNotes(db *database.Database, notebookID string, reorderData map[string]interface{}, params map[string]interface{}) ([]models.Note, error) {
+	if notebookID != "123e4567-e89b-12d3-a456-426614174000" {
+		return nil, services.ErrNotebookNotFound
+	}
+	noteIDStr, _ := reorderData["note_id"].(string)
+	noteID, err := uuid.Parse(noteIDStr)
+	if err != nil {
+		return nil, services.ErrInvalidInput
+	}
+	return []models.Note{{ID: noteID, NotebookID: uuid.Must(uuid.Parse(notebookID)), Position: -1000}}, nil
+}
+
 func (m *MockNotebookService) ListNotebooksByUser(db *database.Database, userID string) ([]models.Notebook, error) {
 	if userID == "90a12345-f12a-98c4-a456-513432930000" {
 		return []models.Notebook{
@@ -201,6 +223,14 @@ func TestCreateNotebook(t *testing.T) {
 		router.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusCreated, w.Code)
 	})
+
+	t.Run("Over Limit", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notebooks", bytes.NewBuffer([]byte(`{"name":"One too many"}`)))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.JSONEq(t, `{"error":"notebooks limit of 50 reached","resource":"notebooks","limit":50}`, w.Body.String())
+	})
 }
 
 func TestGetNotebookById(t *testing.T) {
@@ -227,6 +257,54 @@ func TestGetNotebookById(t *testing.T) {
 	})
 }
 
+func TestGetNotebookWhatsNew(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	router := gin.Default()
+	apiGroup := router.Group("/api/v1", func(c *gin.Context) { c.Set("userID", uuid.New()) })
+	RegisterNotebookRoutes(apiGroup, db, &MockNotebookService{})
+
+	t.Run("Invalid Since", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notebooks/123e4567-e89b-12d3-a456-426614174000/whats-new?since=yesterday", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Notebook Not Found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notebooks/123e4567-e89b-12d3-a456-426614174001/whats-new", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Records The Visit", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT \* FROM "notes" .* updated_at > \$2`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO "notebook_visits" .* ON CONFLICT \("user_id","notebook_id"\) DO UPDATE SET "visited_at"="excluded"."visited_at"`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notebooks/123e4567-e89b-12d3-a456-426614174000/whats-new?since=2024-05-01T09:00:00Z", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"since":"2024-05-01T09:00:00Z"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Peek Without Recording", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT \* FROM "notes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notebooks/123e4567-e89b-12d3-a456-426614174000/whats-new?since=2024-05-01T09:00:00Z&mark_visited=false", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
 func TestUpdateNotebook(t *testing.T) {
 	router := gin.Default()
 	db := &database.Database{}
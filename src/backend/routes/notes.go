@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
@@ -11,13 +12,18 @@ import (
 	"github.com/google/uuid"
 )
 
+// noteMarkdownMIME is the media type of notes rendered as Markdown
+const noteMarkdownMIME = "text/markdown"
+
 func RegisterNoteRoutes(group *gin.RouterGroup, db *database.Database, noteService services.NoteServiceInterface) {
 	// Collection endpoints with query parameters
 	group.GET("/notes", func(c *gin.Context) { GetNotes(c, db, noteService) })
 	group.POST("/notes", func(c *gin.Context) { CreateNote(c, db, noteService) })
+	group.POST("/notes/merge", func(c *gin.Context) { MergeNotes(c, db, noteService) })
 
 	// Resource-specific endpoints
 	group.GET("/notes/:id", func(c *gin.Context) { GetNoteById(c, db, noteService) })
+	group.GET("/notes/:id/diff", func(c *gin.Context) { DiffNotes(c, db, noteService) })
 	group.PUT("/notes/:id", func(c *gin.Context) { UpdateNote(c, db, noteService) })
 	group.DELETE("/notes/:id", func(c *gin.Context) { DeleteNote(c, db, noteService) })
 }
@@ -39,6 +45,9 @@ func CreateNote(c *gin.Context, db *database.Database, noteService services.Note
 
 	createdNote, err := noteService.CreateNote(db, noteData)
 	if err != nil {
+		if respondLimitExceeded(c, err) {
+			return
+		}
 		if errors.Is(err, services.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
 			return
@@ -49,9 +58,17 @@ func CreateNote(c *gin.Context, db *database.Database, noteService services.Note
 	c.JSON(http.StatusCreated, createdNote)
 }
 
+// GetNoteById sends the note as JSON, or rendered as Markdown or sanitized
+// HTML when the Accept header asks for text/markdown or text/html
 func GetNoteById(c *gin.Context, db *database.Database, noteService services.NoteServiceInterface) {
 	id := c.Param("id")
 
+	format := c.NegotiateFormat(gin.MIMEJSON, noteMarkdownMIME, gin.MIMEHTML)
+	if format == "" {
+		c.JSON(http.StatusNotAcceptable, gin.H{"error": "Notes are available as application/json, text/markdown or text/html"})
+		return
+	}
+
 	// Create params map for permissions check
 	params := make(map[string]interface{})
 
@@ -73,7 +90,14 @@ func GetNoteById(c *gin.Context, db *database.Database, noteService services.Not
 		return
 	}
 
-	c.JSON(http.StatusOK, note)
+	switch format {
+	case noteMarkdownMIME:
+		c.Data(http.StatusOK, noteMarkdownMIME+"; charset=utf-8", []byte(services.RenderNoteMarkdown(note)))
+	case gin.MIMEHTML:
+		c.Data(http.StatusOK, gin.MIMEHTML+"; charset=utf-8", []byte(services.RenderNoteHTML(note)))
+	default:
+		c.JSON(http.StatusOK, note)
+	}
 }
 
 func UpdateNote(c *gin.Context, db *database.Database, noteService services.NoteServiceInterface) {
@@ -101,6 +125,10 @@ func UpdateNote(c *gin.Context, db *database.Database, noteService services.Note
 			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
 			return
 		}
+		if errors.Is(err, services.ErrInsufficientAccess) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -117,8 +145,7 @@ func DeleteNote(c *gin.Context, db *database.Database, noteService services.Note
 	userIDInterface, exists := c.Get("userID")
 	if !exists {
 		// Default to single-user UUID for single-user systems
-		singleUserUUID, _ := uuid.Parse("00000000-0000-0000-0000-000000000001")
-		userIDInterface = singleUserUUID
+		userIDInterface = database.SingleUserID()
 	}
 	params["user_id"] = userIDInterface.(uuid.UUID).String()
 
@@ -155,12 +182,133 @@ func GetNotes(c *gin.Context, db *database.Database, noteService services.NoteSe
 		params["title"] = title
 	}
 
+	fields, err := services.ParseFields(c.Query("fields"), services.NoteFields, services.NoteListFields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	params["fields"] = fields
+
+	page, ok := pageListParams(c, params)
+	if !ok {
+		return
+	}
+
 	notes, err := noteService.GetNotes(db, params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Log how many notes were found
-	c.JSON(http.StatusOK, notes)
+	projected, err := projectFields(notes, fields)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondCountedPage(c, projected, page, func() (int64, error) { return noteService.CountNotes(db, params) })
+}
+
+func MergeNotes(c *gin.Context, db *database.Database, noteService services.NoteServiceInterface) {
+	var req struct {
+		TargetID  string   `json:"target_id" binding:"required"`
+		SourceIDs []string `json:"source_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	targetID, err := uuid.Parse(req.TargetID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target note ID"})
+		return
+	}
+	// Compare parsed IDs so differently written copies of one ID, or of the
+	// target, don't get merged twice
+	seen := map[uuid.UUID]bool{targetID: true}
+	sourceIDs := make([]uuid.UUID, 0, len(req.SourceIDs))
+	sourceIDStrs := make([]string, 0, len(req.SourceIDs))
+	for _, id := range req.SourceIDs {
+		sourceID, err := uuid.Parse(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source note ID: " + id})
+			return
+		}
+		if !seen[sourceID] {
+			seen[sourceID] = true
+			sourceIDs = append(sourceIDs, sourceID)
+			sourceIDStrs = append(sourceIDStrs, sourceID.String())
+		}
+	}
+	if len(sourceIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one source note other than the target is required"})
+		return
+	}
+
+	params := make(map[string]interface{})
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userIDInterface = getSingleUserID(db)
+	}
+	params["user_id"] = userIDInterface.(uuid.UUID).String()
+
+	mergedNote, err := noteService.MergeNotes(db, targetID.String(), sourceIDStrs, params)
+	if err != nil {
+		if errors.Is(err, services.ErrNoteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Keep the vector index in step with the merge
+	if aiService := services.AIServiceInstance; aiService != nil {
+		services.AppBackgroundTasks().Go(c.Request.Context(), "ChromaDB sync of merged note "+targetID.String(), func(ctx context.Context) error {
+			return aiService.SyncMergedNoteToChroma(ctx, targetID, sourceIDs)
+		})
+	}
+
+	c.JSON(http.StatusOK, mergedNote)
+}
+
+func DiffNotes(c *gin.Context, db *database.Database, noteService services.NoteServiceInterface) {
+	id := c.Param("id")
+	againstID := c.Query("against")
+	if againstID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "against query parameter is required"})
+		return
+	}
+
+	params := make(map[string]interface{})
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userIDInterface = getSingleUserID(db)
+	}
+	params["user_id"] = userIDInterface.(uuid.UUID).String()
+
+	diff, err := noteService.DiffNotes(db, id, againstID, params)
+	if err != nil {
+		if errors.Is(err, services.ErrNoteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
 }
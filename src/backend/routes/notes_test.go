@@ -2,9 +2,11 @@ package routes
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"owlistic-notes/owlistic/database"
@@ -82,7 +84,12 @@ func (m *MockNoteService) GetNotes(db *database.Database, params map[string]inte
 		notes = filteredNotes
 	}
 
-	return notes, nil
+	return mockPage(notes, params), nil
+}
+
+func (m *MockNoteService) CountNotes(db *database.Database, params map[string]interface{}) (int64, error) {
+	notes, err := m.GetNotes(db, withoutPage(params))
+	return int64(len(notes)), err
 }
 
 func (m *MockNoteService) CreateNote(db *database.Database, noteData map[string]interface{}) (models.Note, error) {
@@ -223,6 +230,26 @@ func (m *MockNoteService) ListNotesByUser(db *database.Database, userID string)
 	return []models.Note{}, nil
 }
 
+func (m *MockNoteService) MergeNotes(db *database.Database, targetID string, sourceIDs []string, params map[string]interface{}) (models.Note, error) {
+	if targetID == "123e4567-e89b-12d3-a456-426614174000" {
+		return models.Note{
+			ID:    uuid.Must(uuid.Parse(targetID)),
+			Title: "Test Note",
+		}, nil
+	}
+	return models.Note{}, services.ErrNoteNotFound
+}
+
+func (m *MockNoteService) DiffNotes(db *database.Database, id string, againstID string, params map[string]interface{}) (services.NoteDiff, error) {
+	if id == "123e4567-e89b-12d3-a456-426614174000" {
+		return services.NoteDiff{
+			NoteID:    uuid.Must(uuid.Parse(id)),
+			AgainstID: uuid.Must(uuid.Parse(againstID)),
+		}, nil
+	}
+	return services.NoteDiff{}, services.ErrNoteNotFound
+}
+
 func (m *MockNoteService) GetAllNotes(db *database.Database) ([]models.Note, error) {
 	return []models.Note{
 		{
@@ -339,6 +366,81 @@ func TestGetNoteById(t *testing.T) {
 		router.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusOK, w.Code)
 	})
+
+	t.Run("JSON", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000", nil)
+		req.Header.Set("Accept", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+
+		var note models.Note
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &note))
+		assert.Equal(t, "Test Note", note.Title)
+	})
+
+	t.Run("Markdown", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000", nil)
+		req.Header.Set("Accept", "text/markdown")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/markdown; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "# Test Note\n\nThis is a test note.", w.Body.String())
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000", nil)
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "<h1>Test Note</h1>")
+		assert.Contains(t, w.Body.String(), "<p>This is a test note.</p>")
+	})
+
+	t.Run("Not Acceptable", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000", nil)
+		req.Header.Set("Accept", "image/png")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	})
+}
+
+// scriptNoteService returns a note whose content tries to run a script
+type scriptNoteService struct {
+	MockNoteService
+}
+
+func (m *scriptNoteService) GetNoteById(db *database.Database, id string, params map[string]interface{}) (models.Note, error) {
+	return models.Note{
+		ID:    uuid.Must(uuid.Parse(id)),
+		Title: "Injected",
+		Blocks: []models.Block{{
+			ID:      uuid.New(),
+			Type:    models.TextBlock,
+			Content: models.BlockContent{"text": "Hi <script>alert('xss')</script><a href=\"javascript:alert(1)\" onclick=\"alert(2)\">there</a>"},
+			Order:   1,
+		}},
+	}, nil
+}
+
+func TestGetNoteById_HTMLStripsScripts(t *testing.T) {
+	router := gin.Default()
+	RegisterNoteRoutes(router.Group("/api/v1"), &database.Database{}, &scriptNoteService{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000", nil)
+	req.Header.Set("Accept", "text/html")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "<script")
+	assert.NotContains(t, w.Body.String(), "alert")
+	assert.Contains(t, w.Body.String(), `<p>Hi <a rel="nofollow noopener noreferrer">there</a></p>`)
 }
 
 func TestUpdateNote(t *testing.T) {
@@ -490,3 +592,137 @@ func TestGetNotes(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "Test Note")
 	})
 }
+
+func TestGetNotes_Fields(t *testing.T) {
+	router := gin.Default()
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+	apiGroup := router.Group("/api/v1")
+	RegisterNoteRoutes(apiGroup, &database.Database{}, &MockNoteService{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/notes?fields=id,title", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var notes []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &notes))
+	assert.NotEmpty(t, notes)
+	for _, note := range notes {
+		assert.ElementsMatch(t, []string{"id", "title"}, mapKeys(note))
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/notes?fields=id,password_hash", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// mockPage pages items the way the services page their queries
+func mockPage[T any](items []T, params map[string]interface{}) []T {
+	limit, ok := params["limit"].(int)
+	if !ok {
+		return items
+	}
+	offset, _ := params["offset"].(int)
+	start := min(offset, len(items))
+	return items[start:min(start+limit, len(items))]
+}
+
+// withoutPage copies params without the page, for the mock counts
+func withoutPage(params map[string]interface{}) map[string]interface{} {
+	whole := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		if key != "limit" && key != "offset" {
+			whole[key] = value
+		}
+	}
+	return whole
+}
+
+func mapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestGetNotes_ListEnvelope(t *testing.T) {
+	router := gin.Default()
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+	apiGroup := router.Group("/api/v1")
+	RegisterNoteRoutes(apiGroup, &database.Database{}, &MockNoteService{})
+
+	// Without the version header notes are still a bare array
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/notes", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var notes []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &notes))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/notes?fields=id,title", nil)
+	req.Header.Set(APIVersionHeader, "2")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var envelope struct {
+		Data       []map[string]interface{} `json:"data"`
+		Pagination map[string]interface{}   `json:"pagination"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+	assert.Len(t, envelope.Data, len(notes))
+	for _, note := range envelope.Data {
+		assert.ElementsMatch(t, []string{"id", "title"}, mapKeys(note))
+	}
+	assert.ElementsMatch(t, []string{"next_cursor", "limit", "total"}, mapKeys(envelope.Pagination))
+	assert.Equal(t, float64(defaultPageLimit), envelope.Pagination["limit"])
+	assert.Equal(t, float64(len(notes)), envelope.Pagination["total"])
+	assert.Equal(t, "", envelope.Pagination["next_cursor"])
+}
+
+// mergeRecordingNoteService records the IDs a merge is asked for
+type mergeRecordingNoteService struct {
+	MockNoteService
+	targetID  string
+	sourceIDs []string
+}
+
+func (m *mergeRecordingNoteService) MergeNotes(db *database.Database, targetID string, sourceIDs []string, params map[string]interface{}) (models.Note, error) {
+	m.targetID, m.sourceIDs = targetID, sourceIDs
+	return m.MockNoteService.MergeNotes(db, targetID, sourceIDs, params)
+}
+
+func TestMergeNotes_ChecksSourceIDs(t *testing.T) {
+	target := "123e4567-e89b-12d3-a456-426614174000"
+	source := "123e4567-e89b-12d3-a456-426614174001"
+	noteService := &mergeRecordingNoteService{}
+	router := gin.Default()
+	router.Use(func(c *gin.Context) { c.Set("userID", uuid.New()) })
+	RegisterNoteRoutes(router.Group("/api/v1"), &database.Database{}, noteService)
+
+	merge := func(sourceIDs string) *httptest.ResponseRecorder {
+		return serve(router, "POST", "/api/v1/notes/merge", `{"target_id":"`+target+`","source_ids":`+sourceIDs+`}`)
+	}
+
+	w := merge(`["not-a-uuid"]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid source note ID")
+
+	// The target written in capitals is still the target
+	w = merge(`["` + strings.ToUpper(target) + `"]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Nil(t, noteService.sourceIDs, "a self-merge must not reach the service")
+
+	w = merge(`["` + source + `","` + strings.ToUpper(source) + `","` + target + `"]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, target, noteService.targetID)
+	assert.Equal(t, []string{source}, noteService.sourceIDs)
+}
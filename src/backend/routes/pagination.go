@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIVersionHeader picks the shape of list responses. Clients sending "2"
+// get lists wrapped in a ListEnvelope and page through them with limit and
+// cursor; without it lists keep their original shape.
+const APIVersionHeader = "X-API-Version"
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// Pagination tells a client how to get the next page. NextCursor is empty on
+// the last page; Total is left out where counting would be expensive.
+type Pagination struct {
+	NextCursor string `json:"next_cursor"`
+	Limit      int    `json:"limit"`
+	Total      *int   `json:"total,omitempty"`
+}
+
+// ListEnvelope is the version 2 shape of every list response
+type ListEnvelope struct {
+	Data       interface{} `json:"data"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// pageRequest is the page a client asked for
+type pageRequest struct {
+	Limit  int
+	Offset int
+}
+
+// wantsListEnvelope tells whether the client asked for version 2 lists
+func wantsListEnvelope(c *gin.Context) bool {
+	return c.GetHeader(APIVersionHeader) == "2"
+}
+
+// parsePageRequest reads the limit and cursor query parameters
+func parsePageRequest(c *gin.Context) (pageRequest, error) {
+	page := pageRequest{Limit: defaultPageLimit}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return page, errors.New("limit must be a positive number")
+		}
+		page.Limit = min(limit, maxPageLimit)
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		offset, err := decodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		page.Offset = offset
+	}
+	return page, nil
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return offset, nil
+}
+
+// respondList writes a list that was loaded whole. Version 2 clients get
+// the requested page of items in an envelope; others get legacy, the body
+// the endpoint always sent.
+func respondList[T any](c *gin.Context, items []T, legacy interface{}) {
+	if !wantsListEnvelope(c) {
+		c.JSON(http.StatusOK, legacy)
+		return
+	}
+	page, err := parsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	total := len(items)
+	start := min(page.Offset, total)
+	end := min(start+page.Limit, total)
+	respondPage(c, items[start:end], page, end < total, &total)
+}
+
+// pageListParams asks the service for the page a version 2 client wants
+// by setting limit and offset in params; other clients get the whole list.
+// It writes the error response itself and returns false on a bad page.
+func pageListParams(c *gin.Context, params map[string]interface{}) (pageRequest, bool) {
+	if !wantsListEnvelope(c) {
+		return pageRequest{}, true
+	}
+	page, err := parsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return page, false
+	}
+	params["limit"] = page.Limit
+	params["offset"] = page.Offset
+	return page, true
+}
+
+// respondCountedPage writes a list the service already paged with
+// pageListParams. count reads the total of the whole list and is only
+// called for version 2 clients.
+func respondCountedPage[T any](c *gin.Context, items []T, page pageRequest, count func() (int64, error)) {
+	if !wantsListEnvelope(c) {
+		c.JSON(http.StatusOK, items)
+		return
+	}
+	total64, err := count()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	total := int(total64)
+	respondPage(c, items, page, page.Offset+len(items) < total, &total)
+}
+
+// respondPage writes one page of a list in an envelope. more tells whether
+// another page follows.
+func respondPage[T any](c *gin.Context, data []T, page pageRequest, more bool, total *int) {
+	if data == nil {
+		data = []T{}
+	}
+	pagination := Pagination{Limit: page.Limit, Total: total}
+	if more {
+		pagination.NextCursor = encodeCursor(page.Offset + len(data))
+	}
+	c.JSON(http.StatusOK, ListEnvelope{Data: data, Pagination: pagination})
+}
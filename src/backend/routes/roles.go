@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 
 	"owlistic-notes/owlistic/database"
@@ -16,6 +17,11 @@ func RegisterRoleRoutes(group *gin.RouterGroup, db *database.Database, roleServi
 	group.GET("/roles", func(c *gin.Context) { GetRoles(c, db, roleService) })
 	group.POST("/roles", func(c *gin.Context) { AssignRole(c, db, roleService) })
 	group.DELETE("/roles/:id", func(c *gin.Context) { RemoveRole(c, db, roleService) })
+
+	// Sharing a single note, independent of its notebook
+	group.GET("/notes/:id/roles", func(c *gin.Context) { GetNoteRoles(c, db, roleService) })
+	group.POST("/notes/:id/roles", func(c *gin.Context) { GrantNoteRole(c, db, roleService) })
+	group.DELETE("/notes/:id/roles/:user_id", func(c *gin.Context) { RevokeNoteRole(c, db, roleService) })
 }
 
 // GetRoles returns roles based on query parameters
@@ -129,3 +135,124 @@ func RemoveRole(c *gin.Context, db *database.Database, roleService services.Role
 		"message": "Role removed successfully",
 	})
 }
+
+// currentUserID returns the authenticated user, writing an error response
+// when there is none
+func currentUserID(c *gin.Context) (uuid.UUID, bool) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return uuid.Nil, false
+	}
+
+	userID, ok := userIDInterface.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// noteRoleError maps note sharing errors to a response
+func noteRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInsufficientAccess):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You must be the owner of this note to share it"})
+	case errors.Is(err, services.ErrNoteNotFound), errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// GetNoteRoles lists the users a note is shared with
+func GetNoteRoles(c *gin.Context, db *database.Database, roleService services.RoleServiceInterface) {
+	noteID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid note ID"})
+		return
+	}
+
+	ownerID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	roles, err := roleService.GetNoteRoles(db, ownerID, noteID)
+	if err != nil {
+		noteRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+type noteRoleRequest struct {
+	UserID string          `json:"user_id" binding:"required"`
+	Role   models.RoleType `json:"role" binding:"required"`
+}
+
+// GrantNoteRole shares a note with a user as viewer or editor
+func GrantNoteRole(c *gin.Context, db *database.Database, roleService services.RoleServiceInterface) {
+	noteID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid note ID"})
+		return
+	}
+
+	var req noteRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ownerID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	role, err := roleService.GrantNoteRole(db, ownerID, noteID, userID, req.Role)
+	if err != nil {
+		noteRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// RevokeNoteRole stops sharing a note with a user
+func RevokeNoteRole(c *gin.Context, db *database.Database, roleService services.RoleServiceInterface) {
+	noteID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid note ID"})
+		return
+	}
+
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ownerID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := roleService.RevokeNoteRole(db, ownerID, noteID, userID); err != nil {
+		noteRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Note role revoked successfully",
+	})
+}
@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func RegisterTagRoutes(group *gin.RouterGroup, db *database.Database, tagService services.TagServiceInterface) {
+	group.GET("/tags", func(c *gin.Context) { GetTags(c, db, tagService) })
+	group.POST("/tags/rename", func(c *gin.Context) { RenameTag(c, db, tagService) })
+	group.POST("/tags/merge", func(c *gin.Context) { MergeTags(c, db, tagService) })
+}
+
+func tagParams(c *gin.Context, db *database.Database) map[string]interface{} {
+	params := make(map[string]interface{})
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the configured single user
+		userIDInterface = getSingleUserID(db)
+	}
+	params["user_id"] = userIDInterface.(uuid.UUID).String()
+	return params
+}
+
+func GetTags(c *gin.Context, db *database.Database, tagService services.TagServiceInterface) {
+	tags, err := tagService.GetTags(db, tagParams(c, db))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+func RenameTag(c *gin.Context, db *database.Database, tagService services.TagServiceInterface) {
+	var req struct {
+		From string `json:"from" binding:"required"`
+		To   string `json:"to" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := tagService.RenameTag(db, req.From, req.To, tagParams(c, db))
+	respondTagChange(c, change, err)
+}
+
+func MergeTags(c *gin.Context, db *database.Database, tagService services.TagServiceInterface) {
+	var req struct {
+		Tags []string `json:"tags" binding:"required"`
+		Into string   `json:"into" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := tagService.MergeTags(db, req.Tags, req.Into, tagParams(c, db))
+	respondTagChange(c, change, err)
+}
+
+// respondTagChange answers a rename or merge and brings the rewritten notes'
+// vector metadata up to date
+func respondTagChange(c *gin.Context, change services.TagChange, err error) {
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if aiService := services.AIServiceInstance; aiService != nil && len(change.NoteIDs) > 0 {
+		services.AppBackgroundTasks().Go(c.Request.Context(), fmt.Sprintf("ChromaDB refresh after renaming tags to %q", change.Tag), func(ctx context.Context) error {
+			return aiService.RefreshNotesInChroma(ctx, change.NoteIDs)
+		})
+	}
+
+	c.JSON(http.StatusOK, change)
+}
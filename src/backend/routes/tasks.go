@@ -187,10 +187,28 @@ func GetTasks(c *gin.Context, db *database.Database, taskService services.TaskSe
 		params["note_id"] = noteId
 	}
 
+	fields, err := services.ParseFields(c.Query("fields"), services.TaskFields, services.TaskListFields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	params["fields"] = fields
+
+	page, ok := pageListParams(c, params)
+	if !ok {
+		return
+	}
+
 	tasks, err := taskService.GetTasks(db, params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, tasks)
+
+	projected, err := projectFields(tasks, fields)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	respondCountedPage(c, projected, page, func() (int64, error) { return taskService.CountTasks(db, params) })
 }
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -60,7 +61,12 @@ func (m *MockTaskService) GetTasks(db *database.Database, params map[string]inte
 		tasks = filteredTasks
 	}
 
-	return tasks, nil
+	return mockPage(tasks, params), nil
+}
+
+func (m *MockTaskService) CountTasks(db *database.Database, params map[string]interface{}) (int64, error) {
+	tasks, err := m.GetTasks(db, withoutPage(params))
+	return int64(len(tasks)), err
 }
 
 func (m *MockTaskService) CreateTask(db *database.Database, taskData map[string]interface{}) (models.Task, error) {
@@ -257,3 +263,42 @@ func TestGetTasks(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "Test Task 2")
 	})
 }
+
+func TestGetTasks_ListEnvelope(t *testing.T) {
+	router := gin.Default()
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+	apiGroup := router.Group("/api/v1")
+	RegisterTaskRoutes(apiGroup, &database.Database{}, &MockTaskService{})
+
+	get := func(url string) ListEnvelope {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set(APIVersionHeader, "2")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var envelope ListEnvelope
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+		return envelope
+	}
+
+	first := get("/api/v1/tasks?limit=1")
+	assert.Len(t, first.Data, 1)
+	assert.Equal(t, 1, first.Pagination.Limit)
+	assert.Equal(t, 2, *first.Pagination.Total)
+	assert.NotEmpty(t, first.Pagination.NextCursor)
+
+	last := get("/api/v1/tasks?limit=1&cursor=" + first.Pagination.NextCursor)
+	assert.Len(t, last.Data, 1)
+	assert.Equal(t, "Test Task 2", last.Data.([]interface{})[0].(map[string]interface{})["title"])
+	assert.Empty(t, last.Pagination.NextCursor)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/tasks?cursor=not-a-cursor", nil)
+	req.Header.Set(APIVersionHeader, "2")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
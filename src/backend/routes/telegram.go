@@ -30,6 +30,7 @@ func (tr *TelegramRoutes) RegisterRoutes(routerGroup *gin.RouterGroup) {
 		// Manual controls (protected by auth middleware)
 		telegramGroup.POST("/send-notification", tr.sendNotification)
 		telegramGroup.GET("/status", tr.getStatus)
+		telegramGroup.POST("/classify", tr.classifyMessage)
 	}
 }
 
@@ -103,4 +104,31 @@ func (tr *TelegramRoutes) getStatus(c *gin.Context) {
 		"bot_name": "Owlistic Telegram Bot",
 		"message": "Telegram bot is running and ready to receive messages",
 	})
-}
\ No newline at end of file
+}
+
+// classifyMessage previews how a message would be classified, by AI and by
+// the fallback keyword rules, without creating anything
+func (tr *TelegramRoutes) classifyMessage(c *gin.Context) {
+	var request struct {
+		Text string `json:"text" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	preview, err := tr.telegramService.PreviewClassification(c.Request.Context(), request.Text)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to classify message: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterUsageRoutes registers the routes reporting usage against the per-user limits
+func RegisterUsageRoutes(group *gin.RouterGroup, db *database.Database) {
+	group.GET("/usage/limits", func(c *gin.Context) { GetUsageLimits(c, db) })
+}
+
+// GetUsageLimits returns the user's notes, notebooks and largest note size next to their limits
+func GetUsageLimits(c *gin.Context, db *database.Database) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		userIDInterface = getSingleUserID(db)
+	}
+
+	usage, err := services.GetUsageLimits(db, userIDInterface.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
+
+// respondLimitExceeded answers 403 with the limit when err is a reached
+// usage limit, and tells whether it did
+func respondLimitExceeded(c *gin.Context, err error) bool {
+	var limitErr *services.LimitExceededError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":    limitErr.Error(),
+		"resource": limitErr.Resource,
+		"limit":    limitErr.Limit,
+	})
+	return true
+}
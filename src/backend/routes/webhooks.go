@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func RegisterWebhookRoutes(group *gin.RouterGroup, db *database.Database, webhookService services.WebhookServiceInterface) {
+	group.GET("/webhooks", func(c *gin.Context) { GetWebhooks(c, db, webhookService) })
+	group.POST("/webhooks", func(c *gin.Context) { CreateWebhook(c, db, webhookService) })
+	group.DELETE("/webhooks/:id", func(c *gin.Context) { DeleteWebhook(c, db, webhookService) })
+}
+
+func webhookParams(c *gin.Context, db *database.Database) map[string]interface{} {
+	params := make(map[string]interface{})
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		// For single-user systems, use the first user in the database
+		userIDInterface = getSingleUserID(db)
+	}
+	params["user_id"] = userIDInterface.(uuid.UUID).String()
+	return params
+}
+
+func CreateWebhook(c *gin.Context, db *database.Database, webhookService services.WebhookServiceInterface) {
+	var req struct {
+		URL         string   `json:"url" binding:"required"`
+		Secret      string   `json:"secret"`
+		EventTypes  []string `json:"event_types"`
+		NotebookIDs []string `json:"notebook_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook, err := webhookService.CreateWebhook(db, map[string]interface{}{
+		"url":          req.URL,
+		"secret":       req.Secret,
+		"event_types":  req.EventTypes,
+		"notebook_ids": req.NotebookIDs,
+	}, webhookParams(c, db))
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+func GetWebhooks(c *gin.Context, db *database.Database, webhookService services.WebhookServiceInterface) {
+	webhooks, err := webhookService.GetWebhooks(db, webhookParams(c, db))
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+func DeleteWebhook(c *gin.Context, db *database.Database, webhookService services.WebhookServiceInterface) {
+	if err := webhookService.DeleteWebhook(db, c.Param("id"), webhookParams(c, db)); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+func respondWebhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
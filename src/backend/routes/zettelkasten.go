@@ -52,11 +52,11 @@ func (zr *ZettelkastenRoutes) RegisterRoutes(router *gin.RouterGroup) {
 		// Graph operations
 		zettel.GET("/graph", zr.getGraphData)
 		zettel.GET("/graph/export", zr.exportGraph)
-		zettel.POST("/graph/analyze", zr.analyzeGraph)
+		zettel.POST("/graph/analyze", requireAIActive, zr.analyzeGraph)
 
 		// Search and discovery
 		zettel.POST("/search", zr.searchNodes)
-		zettel.GET("/discover/:nodeId", zr.discoverConnections)
+		zettel.GET("/discover/:nodeId", requireAIActive, zr.discoverConnections)
 
 		// Synchronization
 		zettel.POST("/sync/notes", zr.syncNotes)
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// Agenda item types
+const (
+	AgendaItemEvent    = "event"
+	AgendaItemTask     = "task"
+	AgendaItemReminder = "reminder"
+)
+
+// agendaDateLayout is the layout of agenda dates and of date-only due dates
+const agendaDateLayout = "2006-01-02"
+
+// dueDateLayouts are the formats task due dates are stored in, tried in order
+var dueDateLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST", // time.Time.String, as saved by CreateTask
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// AgendaItem is an event, due task or reminder on an agenda. Times are in
+// the agenda's timezone; all-day items have no end and start at midnight.
+type AgendaItem struct {
+	Type      string     `json:"type"`
+	ID        uuid.UUID  `json:"id"`
+	Title     string     `json:"title"`
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"`
+	AllDay    bool       `json:"all_day"`
+	Completed bool       `json:"completed,omitempty"`
+	Location  string     `json:"location,omitempty"`
+	NoteID    *uuid.UUID `json:"note_id,omitempty"`
+	EventID   *uuid.UUID `json:"event_id,omitempty"`
+	Method    string     `json:"method,omitempty"`
+}
+
+// Agenda lists what is on a user's day, all-day items first and the rest by time
+type Agenda struct {
+	Date     string       `json:"date"`
+	Timezone string       `json:"timezone"`
+	Items    []AgendaItem `json:"items"`
+}
+
+type AgendaServiceInterface interface {
+	GetAgenda(db *database.Database, userID uuid.UUID, date string, timezone string) (*Agenda, error)
+}
+
+type AgendaService struct {
+	clock Clock
+}
+
+func (s *AgendaService) now() time.Time {
+	return clockNow(s.clock)
+}
+
+// GetAgenda builds the agenda of date (YYYY-MM-DD, today when empty) in
+// timezone. Without a timezone the user's "timezone" preference is used,
+// falling back to UTC.
+func (s *AgendaService) GetAgenda(db *database.Database, userID uuid.UUID, date string, timezone string) (*Agenda, error) {
+	if timezone == "" {
+		timezone = userTimezone(db, userID)
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidInput, timezone)
+	}
+
+	var day time.Time
+	if date == "" {
+		now := s.now().In(location)
+		day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	} else if day, err = time.ParseInLocation(agendaDateLayout, date, location); err != nil {
+		return nil, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidInput)
+	}
+	dayEnd := day.AddDate(0, 0, 1)
+
+	agenda := &Agenda{Date: day.Format(agendaDateLayout), Timezone: location.String(), Items: []AgendaItem{}}
+
+	tasks, err := agendaTasks(db, userID, day, dayEnd)
+	if err != nil {
+		return nil, err
+	}
+	agenda.Items = append(agenda.Items, tasks...)
+
+	events, err := agendaEvents(db, userID, day, dayEnd)
+	if err != nil {
+		return nil, err
+	}
+	agenda.Items = append(agenda.Items, events...)
+
+	sortAgendaItems(agenda.Items)
+	return agenda, nil
+}
+
+// userTimezone reads the "timezone" preference of the user, UTC when unset
+func userTimezone(db *database.Database, userID uuid.UUID) string {
+	var timezones []string
+	if err := db.DB.Model(&models.User{}).Where("id = ?", userID).
+		Pluck("COALESCE(preferences->>'timezone', '')", &timezones).Error; err != nil || len(timezones) == 0 || timezones[0] == "" {
+		return "UTC"
+	}
+	return timezones[0]
+}
+
+// agendaTasks returns the tasks due between day and dayEnd. Due dates without
+// a time are all-day tasks on that date wherever the user is; due dates with
+// a time are placed by the instant they name.
+func agendaTasks(db *database.Database, userID uuid.UUID, day, dayEnd time.Time) ([]AgendaItem, error) {
+	// Whatever offset a due date was written with, its date prefix is at most
+	// a day away from the agenda date
+	dates := []string{
+		day.AddDate(0, 0, -1).Format(agendaDateLayout),
+		day.Format(agendaDateLayout),
+		dayEnd.Format(agendaDateLayout),
+	}
+
+	var tasks []models.Task
+	if err := db.DB.Scopes(models.NotTrashed).Select(TaskListFields).
+		Where("user_id = ? AND LEFT(due_date, 10) IN ?", userID, dates).
+		Find(&tasks).Error; err != nil {
+		return nil, fmt.Errorf("failed to load due tasks: %w", err)
+	}
+
+	var items []AgendaItem
+	for _, task := range tasks {
+		start, allDay, ok := parseDueDate(task.DueDate, day.Location())
+		if !ok {
+			continue
+		}
+		if allDay {
+			if strings.TrimSpace(task.DueDate) != day.Format(agendaDateLayout) {
+				continue
+			}
+			start = day
+		} else if start.Before(day) || !start.Before(dayEnd) {
+			continue
+		}
+
+		noteID := task.NoteID
+		items = append(items, AgendaItem{
+			Type:      AgendaItemTask,
+			ID:        task.ID,
+			Title:     task.Title,
+			Start:     start,
+			AllDay:    allDay,
+			Completed: task.IsCompleted,
+			NoteID:    &noteID,
+		})
+	}
+	return items, nil
+}
+
+// parseDueDate parses a task due date; a due date without an offset is read
+// in location
+func parseDueDate(dueDate string, location *time.Location) (time.Time, bool, bool) {
+	dueDate = strings.TrimSpace(dueDate)
+	if date, err := time.ParseInLocation(agendaDateLayout, dueDate, location); err == nil {
+		return date, true, true
+	}
+	for _, layout := range dueDateLayouts {
+		if due, err := time.ParseInLocation(layout, dueDate, location); err == nil {
+			return due.In(location), false, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// agendaEvents returns the events happening between day and dayEnd and the
+// reminders of events that go off in that time, including those of events
+// on the next day
+func agendaEvents(db *database.Database, userID uuid.UUID, day, dayEnd time.Time) ([]AgendaItem, error) {
+	// All-day events are stored at midnight UTC of their date, with an
+	// exclusive end date
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+
+	var events []models.CalendarEvent
+	if err := db.DB.Where("user_id = ? AND status <> ?", userID, "cancelled").
+		Where("(all_day = ? AND start_time < ? AND end_time > ?) OR (all_day = ? AND start_time <= ? AND end_time > ?)",
+			false, dayEnd.AddDate(0, 0, 1), day, true, date, date).
+		Order("start_time ASC").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to load calendar events: %w", err)
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	var items []AgendaItem
+	starts := make(map[uuid.UUID]time.Time, len(events))
+	eventIDs := make([]uuid.UUID, 0, len(events))
+	for _, event := range events {
+		start := event.StartTime.In(day.Location())
+		if event.AllDay {
+			// Reminders of all-day events count from local midnight of
+			// their first day
+			first := event.StartTime.UTC()
+			starts[event.ID] = time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, day.Location())
+			start = day
+		} else {
+			starts[event.ID] = start
+		}
+		eventIDs = append(eventIDs, event.ID)
+
+		if !event.AllDay && !start.Before(dayEnd) {
+			// Only here for its reminders
+			continue
+		}
+		item := AgendaItem{
+			Type:     AgendaItemEvent,
+			ID:       event.ID,
+			Title:    event.Title,
+			Start:    start,
+			AllDay:   event.AllDay,
+			Location: event.Location,
+			NoteID:   event.NoteID,
+		}
+		if !event.AllDay {
+			end := event.EndTime.In(day.Location())
+			item.End = &end
+		}
+		items = append(items, item)
+	}
+
+	var reminders []models.CalendarReminder
+	if err := db.DB.Where("event_id IN ?", eventIDs).Find(&reminders).Error; err != nil {
+		return nil, fmt.Errorf("failed to load event reminders: %w", err)
+	}
+	titles := make(map[uuid.UUID]string, len(events))
+	for _, event := range events {
+		titles[event.ID] = event.Title
+	}
+	for _, reminder := range reminders {
+		at := starts[reminder.EventID].Add(-time.Duration(reminder.Minutes) * time.Minute)
+		if at.Before(day) || !at.Before(dayEnd) {
+			continue
+		}
+		eventID := reminder.EventID
+		items = append(items, AgendaItem{
+			Type:    AgendaItemReminder,
+			ID:      reminder.ID,
+			Title:   titles[reminder.EventID],
+			Start:   at,
+			EventID: &eventID,
+			Method:  reminder.Method,
+		})
+	}
+	return items, nil
+}
+
+// agendaTypeOrder orders items starting at the same time
+var agendaTypeOrder = map[string]int{AgendaItemReminder: 0, AgendaItemEvent: 1, AgendaItemTask: 2}
+
+// sortAgendaItems puts all-day items first, then orders by start time; at the
+// same time reminders come before events and events before tasks
+func sortAgendaItems(items []AgendaItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.AllDay != b.AllDay {
+			return a.AllDay
+		}
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		if agendaTypeOrder[a.Type] != agendaTypeOrder[b.Type] {
+			return agendaTypeOrder[a.Type] < agendaTypeOrder[b.Type]
+		}
+		return a.Title < b.Title
+	})
+}
+
+// NewAgendaService creates a new instance of AgendaService
+func NewAgendaService() AgendaServiceInterface {
+	return &AgendaService{clock: SystemClock}
+}
+
+// Don't initialize here, will be set properly in main.go
+var AgendaServiceInstance AgendaServiceInterface
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAgenda_OrdersMixedItemsInUserTimezone(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	userID := uuid.New()
+	allDayTask, lateTask, meeting, holiday, earlyCall, reminder, earlyCallReminder :=
+		uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	// In New York March 12th runs from 04:00 UTC to 04:00 UTC the next day
+	mock.ExpectQuery(`SELECT .* FROM "tasks" WHERE \(user_id = \$1 AND LEFT\(due_date, 10\) IN \(\$2,\$3,\$4\)\)`).
+		WithArgs(userID, "2025-03-11", "2025-03-12", "2025-03-13").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "note_id", "title", "is_completed", "due_date"}).
+			AddRow(allDayTask, userID, uuid.New(), "Pay rent", false, "2025-03-12").
+			AddRow(uuid.New(), userID, uuid.New(), "Tomorrow's chore", false, "2025-03-13").
+			AddRow(lateTask, userID, uuid.New(), "Submit report", true, "2025-03-13 02:30:00 +0000 UTC").
+			AddRow(uuid.New(), userID, uuid.New(), "Yesterday evening", false, "2025-03-12T03:00:00Z"))
+	mock.ExpectQuery(`SELECT \* FROM "calendar_events" WHERE \(user_id = \$1 AND status <> \$2\) AND \(\(all_day = \$3 AND start_time < \$4 AND end_time > \$5\) OR \(all_day = \$6 AND start_time <= \$7 AND end_time > \$8\)\)`).
+		WithArgs(userID, "cancelled", false, time.Date(2025, 3, 14, 0, 0, 0, 0, newYork), time.Date(2025, 3, 12, 0, 0, 0, 0, newYork),
+			true, time.Date(2025, 3, 12, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 12, 0, 0, 0, 0, time.UTC)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "start_time", "end_time", "all_day"}).
+			AddRow(holiday, userID, "Holiday", time.Date(2025, 3, 12, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 13, 0, 0, 0, 0, time.UTC), true).
+			AddRow(meeting, userID, "Standup", time.Date(2025, 3, 12, 13, 0, 0, 0, time.UTC), time.Date(2025, 3, 12, 13, 30, 0, 0, time.UTC), false).
+			AddRow(earlyCall, userID, "Early call", time.Date(2025, 3, 13, 4, 30, 0, 0, time.UTC), time.Date(2025, 3, 13, 5, 0, 0, 0, time.UTC), false))
+	mock.ExpectQuery(`SELECT \* FROM "calendar_reminders" WHERE event_id IN \(\$1,\$2,\$3\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "event_id", "method", "minutes"}).
+			AddRow(reminder, meeting, "popup", 10).
+			AddRow(earlyCallReminder, earlyCall, "popup", 60))
+
+	agenda, err := (&AgendaService{clock: SystemClock}).GetAgenda(db, userID, "2025-03-12", "America/New_York")
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "2025-03-12", agenda.Date)
+	assert.Equal(t, "America/New_York", agenda.Timezone)
+
+	var got []uuid.UUID
+	var starts []string
+	for _, item := range agenda.Items {
+		got = append(got, item.ID)
+		starts = append(starts, item.Start.Format("15:04 MST"))
+	}
+	assert.Equal(t, []uuid.UUID{holiday, allDayTask, reminder, meeting, lateTask, earlyCallReminder}, got)
+	assert.Equal(t, []string{"00:00 EDT", "00:00 EDT", "08:50 EDT", "09:00 EDT", "22:30 EDT", "23:30 EDT"}, starts)
+
+	assert.True(t, agenda.Items[0].AllDay)
+	assert.Nil(t, agenda.Items[0].End)
+	assert.Equal(t, AgendaItemReminder, agenda.Items[2].Type)
+	assert.Equal(t, "Standup", agenda.Items[2].Title)
+	assert.Equal(t, meeting, *agenda.Items[2].EventID)
+	assert.True(t, agenda.Items[4].Completed)
+}
+
+func TestGetAgenda_TodayInPreferredTimezone(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	mock.ExpectQuery(`SELECT COALESCE\(preferences->>'timezone', ''\) FROM "users" WHERE id = \$1`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"timezone"}).AddRow("Asia/Tokyo"))
+	mock.ExpectQuery(`FROM "tasks"`).
+		WithArgs(userID, "2025-03-12", "2025-03-13", "2025-03-14").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM "calendar_events"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// Still the 12th in UTC, already the 13th in Tokyo
+	service := &AgendaService{clock: NewFakeClock(time.Date(2025, 3, 12, 20, 0, 0, 0, time.UTC))}
+	agenda, err := service.GetAgenda(db, userID, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-03-13", agenda.Date)
+	assert.Equal(t, "Asia/Tokyo", agenda.Timezone)
+	assert.Empty(t, agenda.Items)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = service.GetAgenda(db, userID, "March 13", "UTC")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = service.GetAgenda(db, userID, "", "Mars/Olympus_Mons")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestGetAgenda_ReminderGoesOffAtSimulatedTime(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	userID := uuid.New()
+	event, reminder := uuid.New(), uuid.New()
+	expectDay := func(dates ...string) {
+		mock.ExpectQuery(`FROM "tasks"`).
+			WithArgs(userID, dates[0], dates[1], dates[2]).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(`FROM "calendar_events"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "start_time", "end_time", "all_day"}).
+				AddRow(event, userID, "Late flight", time.Date(2025, 3, 13, 0, 30, 0, 0, newYork), time.Date(2025, 3, 13, 2, 0, 0, 0, newYork), false))
+		mock.ExpectQuery(`FROM "calendar_reminders"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "event_id", "method", "minutes"}).
+				AddRow(reminder, event, "popup", 60))
+	}
+
+	clock := NewFakeClock(time.Date(2025, 3, 12, 22, 0, 0, 0, newYork))
+	service := &AgendaService{clock: clock}
+
+	// The reminder goes off an hour before the event, still on the 12th
+	expectDay("2025-03-11", "2025-03-12", "2025-03-13")
+	agenda, err := service.GetAgenda(db, userID, "", "America/New_York")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-03-12", agenda.Date)
+	require.Len(t, agenda.Items, 1)
+	assert.Equal(t, AgendaItemReminder, agenda.Items[0].Type)
+	assert.Equal(t, reminder, agenda.Items[0].ID)
+	assert.Equal(t, time.Date(2025, 3, 12, 23, 30, 0, 0, newYork), agenda.Items[0].Start)
+
+	// Past midnight the event itself is on today's agenda
+	clock.Advance(3 * time.Hour)
+	expectDay("2025-03-12", "2025-03-13", "2025-03-14")
+	agenda, err = service.GetAgenda(db, userID, "", "America/New_York")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-03-13", agenda.Date)
+	require.Len(t, agenda.Items, 1)
+	assert.Equal(t, event, agenda.Items[0].ID)
+	assert.NotEqual(t, AgendaItemReminder, agenda.Items[0].Type)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runBranchingChain executes a branching chain over a triage agent whose
+// verdict decides between publishing and revising
+func runBranchingChain(t *testing.T, verdict string) *ChainExecutionResult {
+	o, mock, chainID, _ := newTestOrchestrator(t)
+	o.registeredAgents["triage"] = fixedOutputAgent{output: map[string]interface{}{"verdict": verdict}}
+	o.registeredAgents["publish"] = fixedOutputAgent{output: "published"}
+	o.registeredAgents["revise"] = fixedOutputAgent{output: "revised"}
+	chain := o.activeChains[chainID]
+	chain.Mode = ChainModeBranching
+	chain.Agents = []AgentDefinition{
+		{ID: "revise", Type: "revise", Name: "Revise", OutputKey: "revision"},
+		{
+			ID: "triage", Type: "triage", Name: "Triage", OutputKey: "triage",
+			Conditions:  []ChainCondition{{Type: "equals", DataKey: "verdict", Value: "approve"}},
+			NextOnTrue:  "publish",
+			NextOnFalse: "revise",
+		},
+		{ID: "publish", Type: "publish", Name: "Publish", OutputKey: "publication"},
+	}
+	chain.EntryAgent = "triage"
+	save := false
+
+	result, err := o.ExecuteChain(context.Background(), ChainExecutionRequest{
+		ChainID:        chainID,
+		UserID:         uuid.New(),
+		SaveAsNotebook: &save,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "completed", result.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	return result
+}
+
+func executedAgents(result *ChainExecutionResult) []string {
+	var ids []string
+	for _, log := range result.ExecutionLog {
+		ids = append(ids, log.AgentID)
+	}
+	return ids
+}
+
+func TestExecuteBranching_TrueTarget(t *testing.T) {
+	result := runBranchingChain(t, "approve")
+
+	assert.Equal(t, []string{"triage", "publish"}, executedAgents(result))
+	assert.Equal(t, "published", result.Results["publication"])
+	assert.NotContains(t, result.Results, "revision")
+}
+
+func TestExecuteBranching_FalseTarget(t *testing.T) {
+	result := runBranchingChain(t, "reject")
+
+	assert.Equal(t, []string{"triage", "revise"}, executedAgents(result))
+	assert.Equal(t, "revised", result.Results["revision"])
+	assert.NotContains(t, result.Results, "publication")
+}
+
+func TestExecuteBranching_StopsLoops(t *testing.T) {
+	o, mock, chainID, _ := newTestOrchestrator(t)
+	o.registeredAgents["fixed_output"] = fixedOutputAgent{output: "again"}
+	chain := o.activeChains[chainID]
+	chain.Mode = ChainModeBranching
+	chain.MaxTransitions = 5
+	chain.Agents = []AgentDefinition{
+		{ID: "ping", Type: "fixed_output", Name: "Ping", NextOnTrue: "pong"},
+		{ID: "pong", Type: "fixed_output", Name: "Pong", NextOnTrue: "ping"},
+	}
+	save := false
+
+	result, err := o.ExecuteChain(context.Background(), ChainExecutionRequest{
+		ChainID:        chainID,
+		UserID:         uuid.New(),
+		SaveAsNotebook: &save,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "5 transitions")
+	assert.Equal(t, "failed", result.Status)
+	assert.Equal(t, []string{"ping", "pong", "ping", "pong", "ping"}, executedAgents(result))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestValidateBranches(t *testing.T) {
+	agents := func() []AgentDefinition {
+		return []AgentDefinition{{ID: "a", NextOnTrue: "b"}, {ID: "b"}}
+	}
+	assert.NoError(t, validateBranches(&AgentChain{Agents: agents()}))
+
+	chain := &AgentChain{Agents: agents(), EntryAgent: "c"}
+	assert.EqualError(t, validateBranches(chain), "entry agent c is not in the chain")
+
+	chain = &AgentChain{Agents: agents()}
+	chain.Agents[1].NextOnFalse = "missing"
+	assert.EqualError(t, validateBranches(chain), "agent b jumps to unknown agent missing")
+
+	chain = &AgentChain{Agents: append(agents(), AgentDefinition{ID: "a"})}
+	assert.EqualError(t, validateBranches(chain), "duplicate agent id: a")
+
+	chain = &AgentChain{Agents: append(agents(), AgentDefinition{})}
+	assert.EqualError(t, validateBranches(chain), "every agent of a branching chain needs an id")
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	"owlistic-notes/owlistic/models"
@@ -63,8 +64,16 @@ func (r *ReasoningAgentExecutor) Execute(ctx context.Context, input map[string]i
 		Context:       input,
 	}
 
+	opts := ReasoningOptions{}
+	opts.SaveAsNote, _ = input["save_as_note"].(bool)
+	if nbStr, ok := input["notebook_id"].(string); ok {
+		if parsed, err := uuid.Parse(nbStr); err == nil {
+			opts.NotebookID = parsed
+		}
+	}
+
 	// Execute reasoning
-	result, err := r.service.ExecuteReasoningLoop(ctx, userID, req.Problem, fmt.Sprintf("%v", req.Context), string(req.Strategy))
+	result, err := r.service.ExecuteReasoningLoopWithOptions(ctx, userID, req.Problem, fmt.Sprintf("%v", req.Context), string(req.Strategy), opts)
 	if err != nil {
 		return nil, err
 	}
@@ -72,8 +81,13 @@ func (r *ReasoningAgentExecutor) Execute(ctx context.Context, input map[string]i
 	// Extract readable content from the reasoning result for downstream agents
 	if result.OutputData != nil {
 		if learnings, exists := result.OutputData["learnings"]; exists {
-			return fmt.Sprintf("Reasoning Analysis:\n\nProblem: %s\n\nLearnings: %v\n\nFinal State: %v", 
-				req.Problem, learnings, result.OutputData["final_state"]), nil
+			output := fmt.Sprintf("Reasoning Analysis:\n\nProblem: %s\n\nLearnings: %v\n\nFinal State: %v", 
+				req.Problem, learnings, result.OutputData["final_state"])
+			if assessment, ok := result.OutputData["assessment"].(*ReasoningAssessment); ok {
+				output += fmt.Sprintf("\n\nConfidence: %.2f\nAccomplished: %s\nNext Steps: %s",
+					assessment.Confidence, assessment.Accomplished, strings.Join(assessment.NextSteps, "; "))
+			}
+			return output, nil
 		}
 	}
 	
@@ -85,6 +99,24 @@ func (r *ReasoningAgentExecutor) GetType() AgentType {
 	return AgentTypeReasoning
 }
 
+func (r *ReasoningAgentExecutor) Name() string {
+	return "Reasoning Agent"
+}
+
+func (r *ReasoningAgentExecutor) Description() string {
+	return "Multi-strategy reasoning and problem solving"
+}
+
+func (r *ReasoningAgentExecutor) InputSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"problem":        "string (required)",
+		"strategy":       "string (optional)",
+		"max_iterations": "number (optional)",
+		"save_as_note":   "boolean (optional)",
+		"notebook_id":    "string (optional)",
+	}
+}
+
 // ChatAgentExecutor wraps the ChatService for orchestration
 type ChatAgentExecutor struct {
 	service *ChatService
@@ -131,6 +163,21 @@ func (c *ChatAgentExecutor) GetType() AgentType {
 	return AgentTypeChat
 }
 
+func (c *ChatAgentExecutor) Name() string {
+	return "Chat Agent"
+}
+
+func (c *ChatAgentExecutor) Description() string {
+	return "Context-aware conversational agent"
+}
+
+func (c *ChatAgentExecutor) InputSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"message": "string (required)",
+		"context": "array<string> (optional)",
+	}
+}
+
 // NoteAnalyzerAgent analyzes notes and extracts insights
 type NoteAnalyzerAgent struct {
 	aiService   *AIService
@@ -258,6 +305,21 @@ func (n *NoteAnalyzerAgent) GetType() AgentType {
 	return AgentTypeNoteAnalyzer
 }
 
+func (n *NoteAnalyzerAgent) Name() string {
+	return "Note Analyzer"
+}
+
+func (n *NoteAnalyzerAgent) Description() string {
+	return "Analyze notes and extract insights"
+}
+
+func (n *NoteAnalyzerAgent) InputSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"note_id": "string (required)",
+		"action":  "string (optional: analyze, find_related, extract_entities)",
+	}
+}
+
 // TaskPlannerAgent creates and manages task plans
 type TaskPlannerAgent struct {
 	aiService   *AIService
@@ -309,6 +371,21 @@ func (t *TaskPlannerAgent) GetType() AgentType {
 	return AgentTypeTaskPlanner
 }
 
+func (t *TaskPlannerAgent) Name() string {
+	return "Task Planner"
+}
+
+func (t *TaskPlannerAgent) Description() string {
+	return "Create detailed task plans from goals"
+}
+
+func (t *TaskPlannerAgent) InputSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"goal":         "string (required)",
+		"create_tasks": "boolean (optional)",
+	}
+}
+
 // WebSearchAgent performs web searches
 type WebSearchAgent struct {
 	aiService *AIService
@@ -382,6 +459,21 @@ func (w *WebSearchAgent) GetType() AgentType {
 	return AgentTypeWebSearch
 }
 
+func (w *WebSearchAgent) Name() string {
+	return "Web Search Agent"
+}
+
+func (w *WebSearchAgent) Description() string {
+	return "Search and retrieve information from the web"
+}
+
+func (w *WebSearchAgent) InputSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"query":       "string (required)",
+		"max_results": "number (optional)",
+	}
+}
+
 // SummarizerAgent creates summaries of content
 type SummarizerAgent struct {
 	aiService *AIService
@@ -438,6 +530,22 @@ func (s *SummarizerAgent) GetType() AgentType {
 	return AgentTypeSummarizer
 }
 
+func (s *SummarizerAgent) Name() string {
+	return "Summarizer"
+}
+
+func (s *SummarizerAgent) Description() string {
+	return "Create summaries of content"
+}
+
+func (s *SummarizerAgent) InputSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"content":    "string (required)",
+		"style":      "string (optional: concise, bullet, executive, technical)",
+		"max_length": "number (optional)",
+	}
+}
+
 // CodeGeneratorAgent generates code based on specifications
 type CodeGeneratorAgent struct {
 	aiService *AIService
@@ -504,17 +612,26 @@ func (c *CodeGeneratorAgent) GetType() AgentType {
 	return AgentTypeCodeGenerator
 }
 
+func (c *CodeGeneratorAgent) Name() string {
+	return "Code Generator"
+}
+
+func (c *CodeGeneratorAgent) Description() string {
+	return "Generate code based on specifications"
+}
+
+func (c *CodeGeneratorAgent) InputSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"specification": "string (required)",
+		"language":      "string (optional)",
+		"style":         "string (optional)",
+	}
+}
+
 // Helper method to extract content from note blocks
 func (n *NoteAnalyzerAgent) extractNoteContent(note *models.Note) string {
-	var contentBuilder strings.Builder
-	for _, block := range note.Blocks {
-		// Extract text content from the block
-		if textContent, exists := block.Content["text"]; exists {
-			if textStr, ok := textContent.(string); ok && strings.TrimSpace(textStr) != "" {
-				contentBuilder.WriteString(textStr)
-				contentBuilder.WriteString("\n")
-			}
-		}
-	}
-	return strings.TrimSpace(contentBuilder.String())
+	// Preloaded blocks aren't ordered
+	blocks := append([]models.Block(nil), note.Blocks...)
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Order < blocks[j].Order })
+	return renderNoteBlocks(blocks, noteContentFormat())
 }
@@ -3,8 +3,12 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"owlistic-notes/owlistic/database"
@@ -34,8 +38,13 @@ const (
 	ChainModeSequential ChainExecutionMode = "sequential" // Execute agents one after another
 	ChainModeParallel   ChainExecutionMode = "parallel"   // Execute agents simultaneously
 	ChainModeConditional ChainExecutionMode = "conditional" // Execute based on conditions
+	ChainModeBranching  ChainExecutionMode = "branching"   // Follow each agent's jump targets from an entry agent
 )
 
+// defaultMaxChainTransitions caps how many agents a branching execution
+// runs when the chain sets no max_transitions, so a flow that loops ends
+const defaultMaxChainTransitions = 50
+
 // AgentDefinition defines a single agent in a chain
 type AgentDefinition struct {
 	ID          string                 `json:"id"`
@@ -47,6 +56,8 @@ type AgentDefinition struct {
 	OutputKey   string                 `json:"output_key"`    // Key to store agent output in chain data
 	Conditions  []ChainCondition       `json:"conditions"`    // For conditional execution
 	RetryPolicy RetryPolicy            `json:"retry_policy"`
+	NextOnTrue  string                 `json:"next_on_true,omitempty"`  // Branching mode: agent to run next when the conditions hold
+	NextOnFalse string                 `json:"next_on_false,omitempty"` // Branching mode: agent to run next when they don't
 }
 
 // ChainCondition defines when an agent should be executed
@@ -72,6 +83,8 @@ type AgentChain struct {
 	Mode        ChainExecutionMode `json:"mode"`
 	Agents      []AgentDefinition  `json:"agents"`
 	Timeout     int                `json:"timeout_seconds"`
+	EntryAgent     string          `json:"entry_agent,omitempty"`     // Branching mode: agent the flow starts at, the first agent when unset
+	MaxTransitions int             `json:"max_transitions,omitempty"` // Branching mode: agents run before the flow is stopped as a loop
 	UserID      uuid.UUID          `json:"user_id"`
 	CreatedAt   time.Time          `json:"created_at"`
 	UpdatedAt   time.Time          `json:"updated_at"`
@@ -82,8 +95,19 @@ type ChainExecutionRequest struct {
 	ChainID     string                 `json:"chain_id"`
 	InitialData map[string]interface{} `json:"initial_data"`
 	UserID      uuid.UUID              `json:"user_id"`
+	// SaveAsNotebook controls whether results are also written to a notebook.
+	// When unset the user's save_chain_results_as_notebook preference applies,
+	// which defaults to true.
+	SaveAsNotebook *bool `json:"save_as_notebook,omitempty"`
 }
 
+// SaveChainResultsAsNotebookPreference is the user preference key holding the
+// default for ChainExecutionRequest.SaveAsNotebook
+const SaveChainResultsAsNotebookPreference = "save_chain_results_as_notebook"
+
+// chainNotebookSaver writes a finished execution to a notebook
+type chainNotebookSaver func(ctx context.Context, userID uuid.UUID, chain *AgentChain, result *ChainExecutionResult) (uuid.UUID, []uuid.UUID, error)
+
 // ChainExecutionResult represents the result of a chain execution
 type ChainExecutionResult struct {
 	ID          string                  `json:"id"`
@@ -114,6 +138,8 @@ type AgentExecutionLog struct {
 	StartTime time.Time              `json:"start_time"`
 	EndTime   time.Time              `json:"end_time"`
 	Duration  float64                `json:"duration_seconds"`
+	Truncated bool                   `json:"truncated,omitempty"`  // Output was cut to the size limit
+	OutputRef string                 `json:"output_ref,omitempty"` // Where the full output was stored
 }
 
 // AgentOrchestrator manages agent chains and orchestration
@@ -128,12 +154,21 @@ type AgentOrchestrator struct {
 	activeExecutions    map[string]*ChainExecutionResult
 	registeredAgents    map[AgentType]AgentExecutor
 	activeChains        map[string]*AgentChain // Store chains during execution
+	saveNotebook        chainNotebookSaver
+	saveWorker          *NotebookSaveWorker
+	outputLimits        AgentOutputLimits
+	outputSeq           atomic.Int64 // Numbers stored outputs so reruns of an agent keep their own
+	logMu               sync.Mutex // Guards ExecutionLog appends from parallel agents
+	stateMu             sync.Mutex // Guards activeExecutions and activeChains
 }
 
 // AgentExecutor interface that all agents must implement
 type AgentExecutor interface {
 	Execute(ctx context.Context, input map[string]interface{}) (interface{}, error)
 	GetType() AgentType
+	Name() string
+	Description() string
+	InputSchema() map[string]interface{} // Input key to a short type/requirement description
 }
 
 // NewAgentOrchestrator creates a new agent orchestrator
@@ -152,6 +187,9 @@ func NewAgentOrchestrator(db *gorm.DB) *AgentOrchestrator {
 	orchestrator.taskService = NewTaskService().(*TaskService)
 	orchestrator.reasoningAgent = NewReasoningAgentService(db, orchestrator.aiService, orchestrator.noteService)
 	orchestrator.chatService = NewChatService(db, orchestrator.aiService, orchestrator.noteService)
+	orchestrator.saveNotebook = orchestrator.saveExecutionAsNotebook
+	orchestrator.saveWorker = ChainNotebookSaves()
+	orchestrator.outputLimits = agentOutputLimitsFromEnv()
 
 	// Register built-in agents
 	orchestrator.registerBuiltInAgents()
@@ -200,16 +238,33 @@ func (o *AgentOrchestrator) registerBuiltInAgents() {
 	}
 }
 
-// GetAgent returns a registered agent executor by type
-func (o *AgentOrchestrator) GetAgent(agentType AgentType) (AgentExecutor, bool) {
-	agent, exists := o.registeredAgents[agentType]
-	return agent, exists
+// GetAgent returns a built-in agent executor, or one of the user's remote
+// agents, by type
+func (o *AgentOrchestrator) GetAgent(userID uuid.UUID, agentType AgentType) (AgentExecutor, bool) {
+	if agent, exists := o.registeredAgents[agentType]; exists {
+		return agent, true
+	}
+	return o.remoteAgent(userID, agentType)
+}
+
+// chainUserID is the user a chain runs for, uuid.Nil when it has none
+func chainUserID(chainData map[string]interface{}) uuid.UUID {
+	switch v := chainData["user_id"].(type) {
+	case uuid.UUID:
+		return v
+	case string:
+		if parsed, err := uuid.Parse(v); err == nil {
+			return parsed
+		}
+	}
+	return uuid.Nil
 }
 
-// ExecuteChain executes an agent chain
-func (o *AgentOrchestrator) ExecuteChain(ctx context.Context, req ChainExecutionRequest) (*ChainExecutionResult, error) {
+// ExecuteChain executes an agent chain. A panic during the execution is
+// recovered and reported as a failed execution.
+func (o *AgentOrchestrator) ExecuteChain(ctx context.Context, req ChainExecutionRequest) (result *ChainExecutionResult, err error) {
 	// Create execution result
-	result := &ChainExecutionResult{
+	result = &ChainExecutionResult{
 		ID:           uuid.New().String(),
 		ChainID:      req.ChainID,
 		Status:       "running",
@@ -219,13 +274,22 @@ func (o *AgentOrchestrator) ExecuteChain(ctx context.Context, req ChainExecution
 		ExecutionLog: []AgentExecutionLog{},
 	}
 
-	// Store active execution
+	// Store active execution. It is removed however the execution ends,
+	// a panicking agent included.
+	o.stateMu.Lock()
 	o.activeExecutions[result.ID] = result
+	o.stateMu.Unlock()
+	defer o.forgetExecution(result)
+	defer func() {
+		if r := recover(); r != nil {
+			err = o.failPanickedExecution(result, r)
+		}
+	}()
 
 	// Load chain definition (in real implementation, load from database)
 	chain, err := o.LoadChainDefinition(req.ChainID)
 	if err != nil {
-		result.Status = "failed"
+		o.setExecutionStatus(result, "failed", nil)
 		result.Errors = append(result.Errors, AgentExecutionError{
 			Error:     fmt.Sprintf("Failed to load chain: %v", err),
 			Timestamp: time.Now(),
@@ -261,18 +325,19 @@ func (o *AgentOrchestrator) ExecuteChain(ctx context.Context, req ChainExecution
 		err = o.executeParallel(ctxWithTimeout, chain, chainData, result)
 	case ChainModeConditional:
 		err = o.executeConditional(ctxWithTimeout, chain, chainData, result)
+	case ChainModeBranching:
+		err = o.executeBranching(ctxWithTimeout, chain, chainData, result)
 	default:
 		err = fmt.Errorf("unsupported chain mode: %s", chain.Mode)
 	}
 
 	// Update final status
 	endTime := time.Now()
-	result.EndTime = &endTime
 	if err != nil {
-		result.Status = "failed"
+		o.setExecutionStatus(result, "failed", &endTime)
 		fmt.Printf("Chain %s failed: %v\n", chain.Name, err)
 	} else {
-		result.Status = "completed"
+		o.setExecutionStatus(result, "completed", &endTime)
 		fmt.Printf("Chain %s completed successfully in %.2fs\n", chain.Name, endTime.Sub(result.StartTime).Seconds())
 	}
 
@@ -284,22 +349,82 @@ func (o *AgentOrchestrator) ExecuteChain(ctx context.Context, req ChainExecution
 		fmt.Printf("Failed to save execution result to database: %v\n", saveErr)
 	}
 
-	// Save execution as notebook and notes if successful
-	if err == nil && req.UserID != uuid.Nil {
-		go func() {
-			if notebookID, noteIDs, saveErr := o.saveExecutionAsNotebook(context.Background(), req.UserID, chain, result); saveErr != nil {
+	// Save execution as notebook and notes if successful and requested
+	if err == nil && req.UserID != uuid.Nil && o.shouldSaveAsNotebook(req) {
+		queued := o.saveWorker.Submit(ctx, func(saveCtx context.Context) {
+			if notebookID, noteIDs, saveErr := o.saveNotebook(saveCtx, req.UserID, chain, result); saveErr != nil {
 				fmt.Printf("Failed to save execution as notebook: %v\n", saveErr)
 			} else {
 				fmt.Printf("Saved execution as notebook %s with %d notes\n", notebookID, len(noteIDs))
 			}
-		}()
+		})
+		if !queued {
+			fmt.Printf("Execution %s not saved as notebook: shutting down\n", result.ID)
+		}
+	}
+
+	return result, err
+}
+
+// failPanickedExecution records a recovered panic as the execution's failure
+func (o *AgentOrchestrator) failPanickedExecution(result *ChainExecutionResult, recovered interface{}) error {
+	err := fmt.Errorf("chain execution panicked: %v", recovered)
+	fmt.Printf("Chain execution %s: %v\n", result.ID, err)
+
+	endTime := time.Now()
+	o.setExecutionStatus(result, "failed", &endTime)
+	o.logMu.Lock()
+	result.Errors = append(result.Errors, AgentExecutionError{
+		Error:     err.Error(),
+		Timestamp: endTime,
+	})
+	o.logMu.Unlock()
+
+	if saveErr := o.SaveExecutionResult(result); saveErr != nil {
+		fmt.Printf("Failed to save execution result to database: %v\n", saveErr)
+	}
+	return err
+}
+
+// setExecutionStatus updates an execution's status, and its end time when
+// endTime is set, while State may be reading it
+func (o *AgentOrchestrator) setExecutionStatus(result *ChainExecutionResult, status string, endTime *time.Time) {
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+	result.Status = status
+	if endTime != nil {
+		result.EndTime = endTime
 	}
+}
 
-	// Clean up active execution and chain
+// forgetExecution removes a finished execution and its chain from memory
+func (o *AgentOrchestrator) forgetExecution(result *ChainExecutionResult) {
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
 	delete(o.activeExecutions, result.ID)
 	delete(o.activeChains, result.ChainID)
+}
 
-	return result, err
+// shouldSaveAsNotebook resolves whether a successful execution is written to
+// a notebook: the request flag wins, then the user's preference, then true
+func (o *AgentOrchestrator) shouldSaveAsNotebook(req ChainExecutionRequest) bool {
+	if req.SaveAsNotebook != nil {
+		return *req.SaveAsNotebook
+	}
+
+	var raw []byte
+	row := o.db.Model(&models.User{}).Select("preferences").Where("id = ?", req.UserID).Row()
+	if err := row.Scan(&raw); err != nil || len(raw) == 0 {
+		return true
+	}
+	var preferences map[string]interface{}
+	if err := json.Unmarshal(raw, &preferences); err != nil {
+		return true
+	}
+	if save, ok := preferences[SaveChainResultsAsNotebookPreference].(bool); ok {
+		return save
+	}
+	return true
 }
 
 // executeSequential executes agents one after another
@@ -311,7 +436,7 @@ func (o *AgentOrchestrator) executeSequential(ctx context.Context, chain *AgentC
 		}
 
 		// Execute agent
-		if err := o.executeAgent(ctx, agentDef, chainData, result); err != nil {
+		if _, err := o.executeAgent(ctx, agentDef, chainData, result); err != nil {
 			return fmt.Errorf("agent %s failed: %w", agentDef.Name, err)
 		}
 	}
@@ -345,7 +470,7 @@ func (o *AgentOrchestrator) executeParallel(ctx context.Context, chain *AgentCha
 			}
 			
 			// Execute agent
-			output, err := o.executeSingleAgent(ctx, def, localData)
+			output, err := o.executeSingleAgent(ctx, def, localData, result)
 			resultChan <- agentResult{
 				agentID: def.ID,
 				output:  output,
@@ -393,7 +518,7 @@ func (o *AgentOrchestrator) executeConditional(ctx context.Context, chain *Agent
 	// and execute only those that meet the criteria
 	for _, agentDef := range chain.Agents {
 		if o.checkConditions(agentDef.Conditions, chainData) {
-			if err := o.executeAgent(ctx, agentDef, chainData, result); err != nil {
+			if _, err := o.executeAgent(ctx, agentDef, chainData, result); err != nil {
 				// In conditional mode, we might want to continue despite errors
 				result.Errors = append(result.Errors, AgentExecutionError{
 					AgentID:   agentDef.ID,
@@ -409,8 +534,99 @@ func (o *AgentOrchestrator) executeConditional(ctx context.Context, chain *Agent
 	return nil
 }
 
-// executeAgent executes a single agent with retry logic
-func (o *AgentOrchestrator) executeAgent(ctx context.Context, agentDef AgentDefinition, chainData map[string]interface{}, result *ChainExecutionResult) error {
+// executeBranching runs a decision flow. From the entry agent, each agent
+// runs, its conditions are checked against its own output and the flow jumps
+// to its NextOnTrue or NextOnFalse agent; an agent with no target for the
+// outcome ends the flow. Agents may run again, but after MaxTransitions
+// agents the flow is stopped as a loop.
+func (o *AgentOrchestrator) executeBranching(ctx context.Context, chain *AgentChain, chainData map[string]interface{}, result *ChainExecutionResult) error {
+	if err := validateBranches(chain); err != nil {
+		return err
+	}
+	agents := make(map[string]AgentDefinition, len(chain.Agents))
+	for _, agentDef := range chain.Agents {
+		agents[agentDef.ID] = agentDef
+	}
+	maxTransitions := chain.MaxTransitions
+	if maxTransitions <= 0 {
+		maxTransitions = defaultMaxChainTransitions
+	}
+
+	current := chain.EntryAgent
+	if current == "" && len(chain.Agents) > 0 {
+		current = chain.Agents[0].ID
+	}
+	for runs := 0; current != ""; runs++ {
+		if runs == maxTransitions {
+			return fmt.Errorf("branching stopped after %d transitions, the flow may loop", maxTransitions)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		agentDef := agents[current]
+		output, err := o.executeAgent(ctx, agentDef, chainData, result)
+		if err != nil {
+			return fmt.Errorf("agent %s failed: %w", agentDef.Name, err)
+		}
+
+		if o.checkConditions(agentDef.Conditions, branchConditionData(chainData, output)) {
+			current = agentDef.NextOnTrue
+		} else {
+			current = agentDef.NextOnFalse
+		}
+		if current != "" {
+			fmt.Printf("Branch from agent %s to %s\n", agentDef.ID, current)
+		}
+	}
+	return nil
+}
+
+// branchConditionData is what a branching agent's conditions are checked
+// against: the chain data, the agent's output under "output" and, when the
+// output is an object, each of its fields
+func branchConditionData(chainData map[string]interface{}, output interface{}) map[string]interface{} {
+	data := make(map[string]interface{}, len(chainData)+1)
+	for k, v := range chainData {
+		data[k] = v
+	}
+	data["output"] = output
+	if fields, ok := output.(map[string]interface{}); ok {
+		for k, v := range fields {
+			data[k] = v
+		}
+	}
+	return data
+}
+
+// validateBranches checks that the agents of a branching chain have unique
+// IDs and that its entry agent and jump targets are among them
+func validateBranches(chain *AgentChain) error {
+	ids := make(map[string]bool, len(chain.Agents))
+	for _, agentDef := range chain.Agents {
+		if agentDef.ID == "" {
+			return fmt.Errorf("every agent of a branching chain needs an id")
+		}
+		if ids[agentDef.ID] {
+			return fmt.Errorf("duplicate agent id: %s", agentDef.ID)
+		}
+		ids[agentDef.ID] = true
+	}
+	if chain.EntryAgent != "" && !ids[chain.EntryAgent] {
+		return fmt.Errorf("entry agent %s is not in the chain", chain.EntryAgent)
+	}
+	for _, agentDef := range chain.Agents {
+		for _, target := range []string{agentDef.NextOnTrue, agentDef.NextOnFalse} {
+			if target != "" && !ids[target] {
+				return fmt.Errorf("agent %s jumps to unknown agent %s", agentDef.ID, target)
+			}
+		}
+	}
+	return nil
+}
+
+// executeAgent executes a single agent with retry logic and returns its output
+func (o *AgentOrchestrator) executeAgent(ctx context.Context, agentDef AgentDefinition, chainData map[string]interface{}, result *ChainExecutionResult) (interface{}, error) {
 	var lastErr error
 	maxRetries := 1
 	if agentDef.RetryPolicy.MaxRetries > 0 {
@@ -427,13 +643,13 @@ func (o *AgentOrchestrator) executeAgent(ctx context.Context, agentDef AgentDefi
 			time.Sleep(backoff)
 		}
 
-		output, err := o.executeSingleAgent(ctx, agentDef, chainData)
+		output, err := o.executeSingleAgent(ctx, agentDef, chainData, result)
 		if err == nil {
 			// Success - store output if key is specified
 			if agentDef.OutputKey != "" {
 				chainData[agentDef.OutputKey] = output
 			}
-			return nil
+			return output, nil
 		}
 
 		lastErr = err
@@ -444,15 +660,28 @@ func (o *AgentOrchestrator) executeAgent(ctx context.Context, agentDef AgentDefi
 		}
 	}
 
-	return lastErr
+	return nil, lastErr
 }
 
-// executeSingleAgent executes a single agent without retry logic
-func (o *AgentOrchestrator) executeSingleAgent(ctx context.Context, agentDef AgentDefinition, chainData map[string]interface{}) (interface{}, error) {
+// executeRecovered runs an agent, turning a panic into an ErrAgentPanicked
+// error so one agent can't take down the chain or, in parallel mode, the
+// whole process
+func executeRecovered(ctx context.Context, executor AgentExecutor, input map[string]interface{}) (output interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			output, err = nil, fmt.Errorf("%w: %v", ErrAgentPanicked, r)
+		}
+	}()
+	return executor.Execute(ctx, input)
+}
+
+// executeSingleAgent executes a single agent without retry logic and records
+// it in the execution log. Output over the size limit is truncated.
+func (o *AgentOrchestrator) executeSingleAgent(ctx context.Context, agentDef AgentDefinition, chainData map[string]interface{}, result *ChainExecutionResult) (interface{}, error) {
 	startTime := time.Now()
 
 	// Get the agent executor
-	executor, exists := o.registeredAgents[agentDef.Type]
+	executor, exists := o.GetAgent(chainUserID(chainData), agentDef.Type)
 	if !exists {
 		return nil, fmt.Errorf("unknown agent type: %s", agentDef.Type)
 	}
@@ -477,13 +706,18 @@ func (o *AgentOrchestrator) executeSingleAgent(ctx context.Context, agentDef Age
 		input["user_id"] = userID
 	}
 
-	// Create independent context for agent execution to prevent cancellation
-	// when the main request context times out
-	agentCtx, agentCancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	// Each agent gets at most three minutes and stops when the chain's
+	// context is cancelled
+	agentCtx, agentCancel := context.WithTimeout(ctx, 3*time.Minute)
 	defer agentCancel()
-	
-	// Execute the agent with independent context
-	output, err := executor.Execute(agentCtx, input)
+
+	output, err := executeRecovered(agentCtx, executor, input)
+
+	// Keep oversized output out of the chain data, database and result notes
+	truncated, outputRef := false, ""
+	if err == nil {
+		output, truncated, outputRef = o.limitAgentOutput(agentCtx, result.ID, agentDef, output)
+	}
 
 	// Log execution
 	endTime := time.Now()
@@ -498,6 +732,8 @@ func (o *AgentOrchestrator) executeSingleAgent(ctx context.Context, agentDef Age
 		StartTime: startTime,
 		EndTime:   endTime,
 		Duration:  duration,
+		Truncated: truncated,
+		OutputRef: outputRef,
 	}
 	
 	if err != nil {
@@ -508,8 +744,15 @@ func (o *AgentOrchestrator) executeSingleAgent(ctx context.Context, agentDef Age
 	} else {
 		// Log successful execution
 		fmt.Printf("Agent %s (%s) completed successfully in %.2fs\n", agentDef.Name, agentDef.ID, duration)
+		if truncated {
+			fmt.Printf("Agent %s (%s) output truncated to %d characters\n", agentDef.Name, agentDef.ID, o.outputLimits.MaxChars)
+		}
 	}
 
+	o.logMu.Lock()
+	result.ExecutionLog = append(result.ExecutionLog, log)
+	o.logMu.Unlock()
+
 	return output, err
 }
 
@@ -611,6 +854,10 @@ func toFloat64(v interface{}) (float64, bool) {
 
 // shouldRetry determines if an error should trigger a retry
 func (o *AgentOrchestrator) shouldRetry(err error, policy RetryPolicy) bool {
+	// A panicking agent panics again
+	if errors.Is(err, ErrAgentPanicked) {
+		return false
+	}
 	if len(policy.RetryOnErrors) == 0 {
 		return true // Retry all errors if no specific errors specified
 	}
@@ -656,7 +903,10 @@ func (o *AgentOrchestrator) saveChainAsAIAgent(chain *AgentChain, userID uuid.UU
 // LoadChainDefinition loads a chain definition 
 func (o *AgentOrchestrator) LoadChainDefinition(chainID string) (*AgentChain, error) {
 	// Check active chains first (dynamically created chains)
-	if chain, exists := o.activeChains[chainID]; exists {
+	o.stateMu.Lock()
+	chain, exists := o.activeChains[chainID]
+	o.stateMu.Unlock()
+	if exists {
 		fmt.Printf("Found chain in active chains: %s\n", chainID)
 		return chain, nil
 	}
@@ -757,6 +1007,8 @@ func (o *AgentOrchestrator) LoadChainDefinition(chainID string) (*AgentChain, er
 
 // GetActiveExecutions returns all active chain executions
 func (o *AgentOrchestrator) GetActiveExecutions() map[string]*ChainExecutionResult {
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
 	results := make(map[string]*ChainExecutionResult)
 	for k, v := range o.activeExecutions {
 		results[k] = v
@@ -766,6 +1018,8 @@ func (o *AgentOrchestrator) GetActiveExecutions() map[string]*ChainExecutionResu
 
 // GetExecutionStatus returns the status of a specific execution
 func (o *AgentOrchestrator) GetExecutionStatus(executionID string) (*ChainExecutionResult, bool) {
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
 	result, exists := o.activeExecutions[executionID]
 	return result, exists
 }
@@ -787,13 +1041,23 @@ func (o *AgentOrchestrator) CreateCustomChain(chain *AgentChain) error {
 	
 	// Validate each agent
 	for _, agent := range chain.Agents {
-		if _, exists := o.registeredAgents[agent.Type]; !exists {
+		if _, exists := o.GetAgent(chain.UserID, agent.Type); !exists {
 			return fmt.Errorf("unknown agent type: %s", agent.Type)
 		}
 	}
+	if chain.Mode == ChainModeBranching {
+		if err := validateBranches(chain); err != nil {
+			return err
+		}
+	}
 	
 	// Store chain in memory for execution
+	if chain.CreatedAt.IsZero() {
+		chain.CreatedAt = time.Now()
+	}
+	o.stateMu.Lock()
 	o.activeChains[chain.ID] = chain
+	o.stateMu.Unlock()
 	
 	// Save chain as AIAgent for tracking
 	_, err := o.saveChainAsAIAgent(chain, chain.UserID)
@@ -837,6 +1101,12 @@ func (o *AgentOrchestrator) SaveExecutionResult(result *ChainExecutionResult) er
 		aiAgent.OutputData["errors"] = result.Errors
 	}
 
+	// Remember the execution so its results can be fetched by execution ID
+	if aiAgent.OutputData == nil {
+		aiAgent.OutputData = make(models.AIMetadata)
+	}
+	aiAgent.OutputData["execution_id"] = result.ID
+
 	// Save individual steps as AIAgentStep
 	for i, log := range result.ExecutionLog {
 		step := &models.AIAgentStep{
@@ -867,6 +1137,9 @@ func (o *AgentOrchestrator) SaveExecutionResult(result *ChainExecutionResult) er
 			} else {
 				outputData["result"] = log.Output
 			}
+			if log.OutputRef != "" {
+				outputData["full_output_ref"] = log.OutputRef
+			}
 			step.OutputData = outputData
 		}
 
@@ -886,6 +1159,62 @@ func (o *AgentOrchestrator) SaveExecutionResult(result *ChainExecutionResult) er
 	return nil
 }
 
+// ChainExecutionResults is the persisted output of a finished chain execution
+type ChainExecutionResults struct {
+	ExecutionID string               `json:"execution_id,omitempty"`
+	ChainID     string               `json:"chain_id"`
+	ChainName   string               `json:"chain_name,omitempty"`
+	Status      string               `json:"status"`
+	StartedAt   time.Time            `json:"started_at"`
+	CompletedAt *time.Time           `json:"completed_at,omitempty"`
+	Results     models.AIMetadata    `json:"results"`
+	Errors      interface{}          `json:"errors,omitempty"`
+	Steps       []models.AIAgentStep `json:"steps"`
+}
+
+// GetExecutionResults loads the stored results of a chain execution owned by
+// userID. id may be the execution ID or the chain ID.
+func (o *AgentOrchestrator) GetExecutionResults(userID uuid.UUID, id string) (*ChainExecutionResults, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("%w: invalid execution id", ErrInvalidInput)
+	}
+
+	var aiAgent models.AIAgent
+	err := o.db.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("step_number ASC")
+	}).Where("user_id = ? AND agent_type = ? AND (id = ? OR output_data->>'execution_id' = ?)", userID, "agent_chain", id, id).
+		First(&aiAgent).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	results := make(models.AIMetadata, len(aiAgent.OutputData))
+	for k, v := range aiAgent.OutputData {
+		results[k] = v
+	}
+	executionID, _ := results["execution_id"].(string)
+	errs := results["errors"]
+	delete(results, "execution_id")
+	delete(results, "errors")
+
+	chainName, _ := aiAgent.InputData["chain_name"].(string)
+
+	return &ChainExecutionResults{
+		ExecutionID: executionID,
+		ChainID:     aiAgent.ID.String(),
+		ChainName:   chainName,
+		Status:      aiAgent.Status,
+		StartedAt:   aiAgent.StartedAt,
+		CompletedAt: aiAgent.CompletedAt,
+		Results:     results,
+		Errors:      errs,
+		Steps:       aiAgent.Steps,
+	}, nil
+}
+
 // saveExecutionAsNotebook saves an agent chain execution as a notebook with notes for each step
 func (o *AgentOrchestrator) saveExecutionAsNotebook(ctx context.Context, userID uuid.UUID, chain *AgentChain, result *ChainExecutionResult) (uuid.UUID, []uuid.UUID, error) {
 	// Create notebook for this execution
@@ -897,7 +1226,7 @@ func (o *AgentOrchestrator) saveExecutionAsNotebook(ctx context.Context, userID
 	}
 
 	// Use database directly since we need to access the services
-	dbWrapper := &database.Database{DB: o.db}
+	dbWrapper := &database.Database{DB: o.db.WithContext(ctx)}
 	notebook, err := o.notebookService.CreateNotebook(dbWrapper, notebookData)
 	if err != nil {
 		return uuid.Nil, nil, fmt.Errorf("failed to create notebook: %w", err)
@@ -910,6 +1239,7 @@ func (o *AgentOrchestrator) saveExecutionAsNotebook(ctx context.Context, userID
 		"title":       "Execution Overview",
 		"user_id":     userID.String(),
 		"notebook_id": notebook.ID.String(),
+		"source":      "agent_chain",
 	}
 
 	overviewNote, err := o.noteService.CreateNote(dbWrapper, overviewNoteData)
@@ -996,8 +1326,9 @@ func (o *AgentOrchestrator) saveExecutionAsNotebook(ctx context.Context, userID
 	}
 
 	// Create overview blocks
+	overviewBlocks := make([]models.Block, 0, len(blocks))
 	for _, block := range blocks {
-		blockModel := models.Block{
+		overviewBlocks = append(overviewBlocks, models.Block{
 			ID:       uuid.New(),
 			UserID:   userID,
 			NoteID:   overviewNote.ID,
@@ -1005,8 +1336,10 @@ func (o *AgentOrchestrator) saveExecutionAsNotebook(ctx context.Context, userID
 			Order:    block.order,
 			Content:  block.content,
 			Metadata: block.metadata,
-		}
-		o.db.Create(&blockModel)
+		})
+	}
+	if err := createGeneratedBlocks(dbWrapper.DB, userID, overviewNote.ID, overviewBlocks); err != nil {
+		return notebook.ID, noteIDs, fmt.Errorf("failed to save overview blocks: %w", err)
 	}
 
 	// Create individual notes for each agent execution
@@ -1015,6 +1348,7 @@ func (o *AgentOrchestrator) saveExecutionAsNotebook(ctx context.Context, userID
 			"title":       fmt.Sprintf("Step %d: %s", i+1, log.AgentName),
 			"user_id":     userID.String(),
 			"notebook_id": notebook.ID.String(),
+			"source":      "agent_chain",
 		}
 
 		agentNote, err := o.noteService.CreateNote(dbWrapper, agentNoteData)
@@ -1137,8 +1471,9 @@ func (o *AgentOrchestrator) saveExecutionAsNotebook(ctx context.Context, userID
 		})
 
 		// Create all blocks for this agent
+		stepBlocks := make([]models.Block, 0, len(agentBlocks))
 		for _, block := range agentBlocks {
-			blockModel := models.Block{
+			stepBlocks = append(stepBlocks, models.Block{
 				ID:       uuid.New(),
 				UserID:   userID,
 				NoteID:   agentNote.ID,
@@ -1146,8 +1481,10 @@ func (o *AgentOrchestrator) saveExecutionAsNotebook(ctx context.Context, userID
 				Order:    block.order,
 				Content:  block.content,
 				Metadata: block.metadata,
-			}
-			o.db.Create(&blockModel)
+			})
+		}
+		if err := createGeneratedBlocks(dbWrapper.DB, userID, agentNote.ID, stepBlocks); err != nil {
+			fmt.Printf("Failed to save blocks for agent %s: %v\n", log.AgentName, err)
 		}
 	}
 
@@ -1157,37 +1494,93 @@ func (o *AgentOrchestrator) saveExecutionAsNotebook(ctx context.Context, userID
 			"title":       "Final Results",
 			"user_id":     userID.String(),
 			"notebook_id": notebook.ID.String(),
+			"source":      "agent_chain",
 		}
 
 		resultsNote, err := o.noteService.CreateNote(dbWrapper, resultsNoteData)
 		if err == nil {
 			noteIDs = append(noteIDs, resultsNote.ID)
 
-			// Create a main header for the results
-			mainHeaderBlock := models.Block{
-				ID:      uuid.New(),
-				UserID:  userID,
-				NoteID:  resultsNote.ID,
-				Type:    models.HeadingBlock,
-				Order:   500.0,
-				Content: models.BlockContent{"text": "Chain Results"},
-				Metadata: models.BlockMetadata{"level": 1, "spans": []interface{}{}},
-			}
-			o.db.Create(&mainHeaderBlock)
-
-			// Format results as properly structured blocks
-			resultBlocks := o.FormatResultsAsBlocks(result.Results, userID, resultsNote.ID)
-			
-			// Save all the result blocks to the database
-			for _, block := range resultBlocks {
-				o.db.Create(&block)
+			// Save the results, under a main header, as properly structured blocks
+			blocks := o.resultsNoteBlocks(result.Results, userID, resultsNote.ID)
+			if err := createGeneratedBlocks(dbWrapper.DB, userID, resultsNote.ID, blocks); err != nil {
+				fmt.Printf("Failed to save final result blocks: %v\n", err)
 			}
 		}
 	}
 
+	for _, noteID := range noteIDs {
+		refreshNotePreview(dbWrapper.DB, noteID)
+	}
+
 	return notebook.ID, noteIDs, nil
 }
 
+// resultsNoteBlocks returns the blocks of a note holding chain results: a
+// main header followed by the formatted results
+func (o *AgentOrchestrator) resultsNoteBlocks(results map[string]interface{}, userID, noteID uuid.UUID) []models.Block {
+	header := models.Block{
+		ID:       uuid.New(),
+		UserID:   userID,
+		NoteID:   noteID,
+		Type:     models.HeadingBlock,
+		Order:    500.0,
+		Content:  models.BlockContent{"text": "Chain Results"},
+		Metadata: models.BlockMetadata{"level": 1, "spans": []interface{}{}},
+	}
+	return append([]models.Block{header}, o.FormatResultsAsBlocks(results, userID, noteID)...)
+}
+
+// SaveExecutionAsNote writes the stored results of a completed execution
+// owned by userID to a new note in one of the user's notebooks, for
+// executions that weren't saved as a notebook when they ran. The returned
+// note holds the result blocks.
+func (o *AgentOrchestrator) SaveExecutionAsNote(userID uuid.UUID, executionID string, notebookID uuid.UUID) (*models.Note, error) {
+	stored, err := o.GetExecutionResults(userID, executionID)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Status != "completed" {
+		return nil, fmt.Errorf("%w: execution is %s", ErrExecutionNotCompleted, stored.Status)
+	}
+
+	var notebooks int64
+	if err := o.db.Model(&models.Notebook{}).Where("id = ? AND user_id = ?", notebookID, userID).Count(&notebooks).Error; err != nil {
+		return nil, err
+	}
+	if notebooks == 0 {
+		return nil, ErrNotebookNotFound
+	}
+
+	title := "Chain Results"
+	if stored.ChainName != "" {
+		title = stored.ChainName + " Results"
+	}
+	if stored.CompletedAt != nil {
+		title += " - " + stored.CompletedAt.Format("2006-01-02 15:04")
+	}
+
+	db := &database.Database{DB: o.db}
+	note, err := NoteServiceInstance.CreateNote(db, map[string]interface{}{
+		"title":       title,
+		"user_id":     userID.String(),
+		"notebook_id": notebookID.String(),
+		"source":      "agent_chain",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create results note: %w", err)
+	}
+
+	blocks := o.resultsNoteBlocks(stored.Results, userID, note.ID)
+	if err := createGeneratedBlocks(o.db, userID, note.ID, blocks); err != nil {
+		return nil, fmt.Errorf("failed to save result blocks: %w", err)
+	}
+	refreshNotePreview(o.db, note.ID)
+
+	note.Blocks = append(note.Blocks, blocks...)
+	return &note, nil
+}
+
 // FormatResultsAsBlocks converts chain execution results to properly formatted blocks
 func (o *AgentOrchestrator) FormatResultsAsBlocks(results map[string]interface{}, userID, noteID uuid.UUID) []models.Block {
 	var blocks []models.Block
@@ -1208,10 +1601,11 @@ func (o *AgentOrchestrator) FormatResultsAsBlocks(results map[string]interface{}
 		}
 	}
 	
-	// Then handle any remaining keys
-	for key, value := range results {
+	// Then handle any remaining keys, sorted so the blocks come out the same
+	// every time
+	for _, key := range sortedKeys(results) {
 		if !processedKeys[key] {
-			resultBlocks := o.formatResultSectionAsBlocks(key, value, userID, noteID, order)
+			resultBlocks := o.formatResultSectionAsBlocks(key, results[key], userID, noteID, order)
 			blocks = append(blocks, resultBlocks...)
 			order += float64(len(resultBlocks)) * 100.0
 		}
@@ -1341,7 +1735,8 @@ func (o *AgentOrchestrator) formatMapAsBlocks(data map[string]interface{}, userI
 	var blocks []models.Block
 	order := baseOrder
 	
-	for key, value := range data {
+	for _, key := range sortedKeys(data) {
+		value := data[key]
 		humanKey := o.humanizeKey(key)
 		
 		// Create a text block with formatted key-value content
@@ -1354,55 +1749,25 @@ func (o *AgentOrchestrator) formatMapAsBlocks(data map[string]interface{}, userI
 				// Multi-line value - put key on its own line
 				text = fmt.Sprintf("%s:\n%s", humanKey, v)
 				// Add bold formatting for the key
-				spans = []interface{}{
-					map[string]interface{}{
-						"start": 0,
-						"end":   len(humanKey),
-						"type":  "bold",
-					},
-				}
+				spans = []interface{}{models.NewSpan(text, 0, len(humanKey), "bold")}
 			} else {
 				// Single line value
 				text = fmt.Sprintf("%s: %s", humanKey, v)
 				// Add bold formatting for the key and colon
-				spans = []interface{}{
-					map[string]interface{}{
-						"start": 0,
-						"end":   len(humanKey),
-						"type":  "bold",
-					},
-				}
+				spans = []interface{}{models.NewSpan(text, 0, len(humanKey), "bold")}
 			}
 			
 		case map[string]interface{}:
 			text = humanKey + ":"
-			spans = []interface{}{
-				map[string]interface{}{
-					"start": 0,
-					"end":   len(humanKey),
-					"type":  "bold",
-				},
-			}
+			spans = []interface{}{models.NewSpan(text, 0, len(humanKey), "bold")}
 			
 		case []interface{}:
 			text = humanKey + ":"
-			spans = []interface{}{
-				map[string]interface{}{
-					"start": 0,
-					"end":   len(humanKey),
-					"type":  "bold",
-				},
-			}
+			spans = []interface{}{models.NewSpan(text, 0, len(humanKey), "bold")}
 			
 		default:
 			text = fmt.Sprintf("%s: %v", humanKey, v)
-			spans = []interface{}{
-				map[string]interface{}{
-					"start": 0,
-					"end":   len(humanKey),
-					"type":  "bold",
-				},
-			}
+			spans = []interface{}{models.NewSpan(text, 0, len(humanKey), "bold")}
 		}
 		
 		textBlock := models.Block{
@@ -1465,6 +1830,16 @@ func (o *AgentOrchestrator) formatArrayItemAsString(item interface{}) string {
 	}
 }
 
+// sortedKeys returns the keys of data in order
+func sortedKeys(data map[string]interface{}) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // humanizeKey converts technical keys to human-readable titles
 func (o *AgentOrchestrator) humanizeKey(key string) string {
 	humanNames := map[string]string{
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestOrchestrator returns an orchestrator holding an empty chain whose
+// notebook saves are reported on the returned channel
+func newTestOrchestrator(t *testing.T) (*AgentOrchestrator, sqlmock.Sqlmock, string, chan uuid.UUID) {
+	db, mock, close := testutils.SetupMockDB()
+	t.Cleanup(close)
+
+	chainID := uuid.New().String()
+	saved := make(chan uuid.UUID, 1)
+	o := &AgentOrchestrator{
+		db:               db.DB,
+		activeExecutions: make(map[string]*ChainExecutionResult),
+		registeredAgents: make(map[AgentType]AgentExecutor),
+		activeChains: map[string]*AgentChain{
+			chainID: {ID: chainID, Name: "Empty", Mode: ChainModeSequential},
+		},
+		saveNotebook: func(ctx context.Context, userID uuid.UUID, chain *AgentChain, result *ChainExecutionResult) (uuid.UUID, []uuid.UUID, error) {
+			saved <- userID
+			return uuid.New(), nil, nil
+		},
+		saveWorker: NewNotebookSaveWorker(1),
+	}
+
+	// The AIAgent record is looked up to persist the results for /status
+	mock.ExpectQuery(`SELECT \* FROM "ai_agents"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	return o, mock, chainID, saved
+}
+
+func TestExecuteChain_SaveAsNotebookFalse(t *testing.T) {
+	o, mock, chainID, saved := newTestOrchestrator(t)
+	save := false
+
+	result, err := o.ExecuteChain(context.Background(), ChainExecutionRequest{
+		ChainID:        chainID,
+		UserID:         uuid.New(),
+		SaveAsNotebook: &save,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "completed", result.Status)
+
+	select {
+	case <-saved:
+		t.Fatal("notebook was created although save_as_notebook was false")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecuteChain_SaveAsNotebookDefault(t *testing.T) {
+	o, mock, chainID, saved := newTestOrchestrator(t)
+	userID := uuid.New()
+	mock.ExpectQuery(`SELECT "?preferences"? FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"preferences"}).AddRow([]byte(`{"theme":"dark"}`)))
+
+	_, err := o.ExecuteChain(context.Background(), ChainExecutionRequest{ChainID: chainID, UserID: userID})
+	require.NoError(t, err)
+
+	select {
+	case got := <-saved:
+		assert.Equal(t, userID, got)
+	case <-time.After(time.Second):
+		t.Fatal("notebook was not created")
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecuteChain_SaveAsNotebookPreference(t *testing.T) {
+	o, mock, chainID, saved := newTestOrchestrator(t)
+	mock.ExpectQuery(`SELECT "?preferences"? FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"preferences"}).AddRow([]byte(`{"save_chain_results_as_notebook":false}`)))
+
+	_, err := o.ExecuteChain(context.Background(), ChainExecutionRequest{ChainID: chainID, UserID: uuid.New()})
+	require.NoError(t, err)
+
+	select {
+	case <-saved:
+		t.Fatal("notebook was created although the user preference disables it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetExecutionResults(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	o := &AgentOrchestrator{db: db.DB}
+
+	userID := uuid.New()
+	chainID := uuid.New()
+	executionID := uuid.New().String()
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT \* FROM "ai_agents" WHERE \(user_id = \$1 AND agent_type = \$2 AND \(id = \$3 OR output_data->>'execution_id' = \$4\)\)`).
+		WithArgs(userID, "agent_chain", executionID, executionID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "agent_type", "status", "output_data", "started_at", "completed_at"}).
+			AddRow(chainID, userID, "agent_chain", "completed",
+				[]byte(`{"summary":"done","execution_id":"`+executionID+`","errors":[]}`), now, now))
+	mock.ExpectQuery(`SELECT \* FROM "ai_agent_steps" WHERE "ai_agent_steps"."agent_id" = \$1 ORDER BY step_number ASC`).
+		WithArgs(chainID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "agent_id", "step_number", "name", "status", "output_data"}).
+			AddRow(uuid.New(), chainID, 1, "Summarize", "completed", []byte(`{"result":"done"}`)))
+
+	results, err := o.GetExecutionResults(userID, executionID)
+	require.NoError(t, err)
+	assert.Equal(t, executionID, results.ExecutionID)
+	assert.Equal(t, chainID.String(), results.ChainID)
+	assert.Equal(t, "completed", results.Status)
+	assert.Equal(t, "done", results.Results["summary"])
+	assert.NotContains(t, results.Results, "execution_id")
+	require.Len(t, results.Steps, 1)
+	assert.Equal(t, "done", results.Steps[0].OutputData["result"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetExecutionResults_NotFound(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	o := &AgentOrchestrator{db: db.DB}
+
+	mock.ExpectQuery(`SELECT \* FROM "ai_agents"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err := o.GetExecutionResults(uuid.New(), uuid.New().String())
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = o.GetExecutionResults(uuid.New(), "not-a-uuid")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestFormatMapAsBlocks_SpansCoverHumanizedKey(t *testing.T) {
+	o := &AgentOrchestrator{}
+	blocks := o.formatMapAsBlocks(map[string]interface{}{"analysis": "Looks good"}, uuid.New(), uuid.New(), 0)
+	require.NotEmpty(t, blocks)
+
+	text := []rune(blocks[0].Content["text"].(string))
+	spans := blocks[0].GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "🧠 Analysis", string(text[spans[0]["start"].(int):spans[0]["end"].(int)]))
+}
+
+// expectStoredExecution answers the lookup of a stored chain execution
+func expectStoredExecution(mock sqlmock.Sqlmock, userID, chainID uuid.UUID, status, outputData string, completedAt time.Time) {
+	mock.ExpectQuery(`SELECT \* FROM "ai_agents"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "agent_type", "status", "input_data", "output_data", "started_at", "completed_at"}).
+			AddRow(chainID, userID, "agent_chain", status, []byte(`{"chain_name":"Research and Summarize"}`), []byte(outputData), completedAt, completedAt))
+	mock.ExpectQuery(`SELECT \* FROM "ai_agent_steps"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "agent_id"}))
+}
+
+func TestSaveExecutionAsNote_WritesFormattedResults(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	o := &AgentOrchestrator{db: db.DB}
+
+	notes := &recordingNoteService{}
+	originalNotes := NoteServiceInstance
+	NoteServiceInstance = notes
+	defer func() { NoteServiceInstance = originalNotes }()
+
+	userID, chainID, notebookID := uuid.New(), uuid.New(), uuid.New()
+	executionID := uuid.New().String()
+	completedAt := time.Date(2025, 3, 4, 15, 30, 0, 0, time.UTC)
+	results := map[string]interface{}{"summary": "Go 1.23 adds range over functions", "analysis": "Worth upgrading"}
+
+	expectStoredExecution(mock, userID, chainID, "completed",
+		`{"summary":"Go 1.23 adds range over functions","analysis":"Worth upgrading","execution_id":"`+executionID+`"}`, completedAt)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "notebooks" WHERE \(id = \$1 AND user_id = \$2\)`).
+		WithArgs(notebookID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	inserted := sqlmock.NewRows([]string{"id"})
+	for i := 0; i < 5; i++ {
+		inserted.AddRow(uuid.New())
+	}
+	mock.ExpectQuery(`INSERT INTO "blocks"`).WillReturnRows(inserted)
+	mock.ExpectCommit()
+	mock.ExpectExec(`UPDATE notes SET preview`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	note, err := o.SaveExecutionAsNote(userID, executionID, notebookID)
+	require.NoError(t, err)
+	require.Len(t, notes.created, 1)
+	assert.Equal(t, notebookID, note.NotebookID)
+	assert.Equal(t, "Research and Summarize Results - 2025-03-04 15:30", note.Title)
+
+	// The note holds the header and the same blocks FormatResultsAsBlocks makes
+	expected := o.FormatResultsAsBlocks(results, userID, note.ID)
+	require.Len(t, note.Blocks, len(expected)+1)
+	assert.Equal(t, "Chain Results", note.Blocks[0].Content["text"])
+	for i, block := range expected {
+		assert.Equal(t, block.Type, note.Blocks[i+1].Type)
+		assert.Equal(t, block.Content, note.Blocks[i+1].Content)
+		assert.Equal(t, note.ID, note.Blocks[i+1].NoteID)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveExecutionAsNote_KeepsToTheBlockLimit(t *testing.T) {
+	t.Setenv("USAGE_MAX_BLOCKS_PER_NOTE", "3")
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	o := &AgentOrchestrator{db: db.DB}
+
+	originalNotes := NoteServiceInstance
+	NoteServiceInstance = &recordingNoteService{}
+	defer func() { NoteServiceInstance = originalNotes }()
+
+	userID, chainID, notebookID := uuid.New(), uuid.New(), uuid.New()
+	expectStoredExecution(mock, userID, chainID, "completed", `{"summary":"Done","analysis":"Fine"}`, time.Now())
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "notebooks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "blocks" WHERE note_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+
+	// The header and two results make five blocks, past the limit of three
+	_, err := o.SaveExecutionAsNote(userID, uuid.New().String(), notebookID)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveExecutionAsNote_RequiresCompletedExecution(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	o := &AgentOrchestrator{db: db.DB}
+
+	userID := uuid.New()
+	expectStoredExecution(mock, userID, uuid.New(), "failed", `{}`, time.Now())
+
+	_, err := o.SaveExecutionAsNote(userID, uuid.New().String(), uuid.New())
+	assert.ErrorIs(t, err, ErrExecutionNotCompleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResultsNoteBlocks_MatchBlockSchemas(t *testing.T) {
+	o := &AgentOrchestrator{}
+	results := map[string]interface{}{
+		"summary":  "Everything went fine",
+		"findings": []interface{}{"first", map[string]interface{}{"source": "web"}},
+		"details":  map[string]interface{}{"score": 0.9, "steps": []interface{}{"plan", "run"}},
+	}
+
+	// Generated blocks would otherwise be stored without being checked
+	for _, block := range o.resultsNoteBlocks(results, uuid.New(), uuid.New()) {
+		assert.NoError(t, models.ValidateBlock(block.Type, block.Content, block.Metadata), "%s block %v", block.Type, block.Content)
+	}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultAgentOutputMaxChars caps agent output kept in chain data, execution
+// logs and result notes
+const defaultAgentOutputMaxChars = 20000
+
+// agentOutputTruncatedKey marks a capped map output. The underscore keeps it
+// apart from the fields agents return.
+const agentOutputTruncatedKey = "_output_truncated"
+
+// AgentOutputStore keeps the full output of agents whose output was truncated
+type AgentOutputStore interface {
+	// Save stores data under key and returns a reference to it
+	Save(ctx context.Context, key string, data []byte) (string, error)
+}
+
+// FileAgentOutputStore stores full agent outputs as files below a directory
+type FileAgentOutputStore struct {
+	dir string
+}
+
+// NewFileAgentOutputStore creates a store writing to dir
+func NewFileAgentOutputStore(dir string) *FileAgentOutputStore {
+	return &FileAgentOutputStore{dir: dir}
+}
+
+// Save writes data to dir/key and returns the file path. Keys that would
+// leave dir are rejected.
+func (s *FileAgentOutputStore) Save(ctx context.Context, key string, data []byte) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if rel, err := filepath.Rel(s.dir, path); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: agent output key %q is outside the store", ErrInvalidInput, key)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create agent output directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write agent output: %w", err)
+	}
+	return "file://" + path, nil
+}
+
+// AgentOutputLimits bounds how much agent output is kept
+type AgentOutputLimits struct {
+	MaxChars int              // Largest output kept inline, 0 disables the cap
+	Store    AgentOutputStore // Optional store for the full output of truncated agents
+}
+
+// agentOutputLimitsFromEnv reads AGENT_OUTPUT_MAX_CHARS and AGENT_OUTPUT_STORE_DIR
+func agentOutputLimitsFromEnv() AgentOutputLimits {
+	limits := AgentOutputLimits{MaxChars: defaultAgentOutputMaxChars}
+	if value, err := strconv.Atoi(os.Getenv("AGENT_OUTPUT_MAX_CHARS")); err == nil && value >= 0 {
+		limits.MaxChars = value
+	}
+	if dir := os.Getenv("AGENT_OUTPUT_STORE_DIR"); dir != "" {
+		limits.Store = NewFileAgentOutputStore(dir)
+	}
+	return limits
+}
+
+// capAgentOutput shrinks output to roughly maxChars characters of JSON.
+// Strings are cut with a marker, maps keep their keys with long string values
+// cut, anything else is replaced by a preview of its JSON encoding.
+func capAgentOutput(output interface{}, maxChars int) (interface{}, bool) {
+	if maxChars <= 0 || output == nil {
+		return output, false
+	}
+	size := agentOutputSize(output)
+	if size <= maxChars {
+		return output, false
+	}
+
+	switch value := output.(type) {
+	case string:
+		return truncateAgentText(value, maxChars), true
+	case map[string]interface{}:
+		if capped, ok := capAgentOutputMap(value, maxChars); ok {
+			return capped, true
+		}
+	}
+
+	encoded, _ := json.Marshal(output)
+	return map[string]interface{}{
+		agentOutputTruncatedKey: true,
+		"original_chars":        size,
+		"preview":               truncateAgentText(string(encoded), maxChars),
+	}, true
+}
+
+// capAgentOutputMap shares maxChars between the string values of a map. It
+// gives up when the other values alone are over the limit.
+func capAgentOutputMap(output map[string]interface{}, maxChars int) (map[string]interface{}, bool) {
+	stringFields := 0
+	others := make(map[string]interface{})
+	for k, v := range output {
+		if _, ok := v.(string); ok {
+			stringFields++
+		} else {
+			others[k] = v
+		}
+	}
+	if stringFields == 0 || agentOutputSize(others) > maxChars {
+		return nil, false
+	}
+
+	budget := maxChars / stringFields
+	capped := make(map[string]interface{}, len(output)+1)
+	for k, v := range output {
+		if s, ok := v.(string); ok && utf8.RuneCountInString(s) > budget {
+			v = truncateAgentText(s, budget)
+		}
+		capped[k] = v
+	}
+	capped[agentOutputTruncatedKey] = true
+	return capped, true
+}
+
+// truncateAgentText cuts text to maxChars characters and marks the cut
+func truncateAgentText(text string, maxChars int) string {
+	runes := []rune(text)
+	if len(runes) <= maxChars {
+		return text
+	}
+	return string(runes[:maxChars]) + fmt.Sprintf("\n\n[output truncated: %d of %d characters shown]", maxChars, len(runes))
+}
+
+// agentOutputSize measures output in characters of its JSON encoding
+func agentOutputSize(output interface{}) int {
+	if s, ok := output.(string); ok {
+		return utf8.RuneCountInString(s)
+	}
+	encoded, err := json.Marshal(output)
+	if err != nil {
+		return 0
+	}
+	return utf8.RuneCount(encoded)
+}
+
+// limitAgentOutput applies the configured cap to an agent's output. When the
+// output was cut and a store is configured the full output is saved there and
+// its reference returned.
+func (o *AgentOrchestrator) limitAgentOutput(ctx context.Context, executionID string, agentDef AgentDefinition, output interface{}) (interface{}, bool, string) {
+	capped, truncated := capAgentOutput(output, o.outputLimits.MaxChars)
+	if !truncated || o.outputLimits.Store == nil {
+		return capped, truncated, ""
+	}
+
+	full, err := json.Marshal(output)
+	if err != nil {
+		fmt.Printf("Failed to encode full output of agent %s: %v\n", agentDef.ID, err)
+		return capped, truncated, ""
+	}
+	ref, err := o.outputLimits.Store.Save(ctx, agentOutputKey(executionID, agentDef.ID, o.outputSeq.Add(1)), full)
+	if err != nil {
+		fmt.Printf("Failed to store full output of agent %s: %v\n", agentDef.ID, err)
+		return capped, truncated, ""
+	}
+	return capped, truncated, ref
+}
+
+// agentOutputKey is the store key of an agent's full output. seq tells apart
+// runs of the same agent in one execution. The agent ID comes from the chain
+// definition, so only letters, digits, '-' and '_' are kept from the IDs.
+func agentOutputKey(executionID, agentID string, seq int64) string {
+	safe := func(id string) string {
+		return strings.Map(func(r rune) rune {
+			if r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '_'
+		}, id)
+	}
+	return safe(executionID) + "/" + safe(agentID) + "-" + strconv.FormatInt(seq, 10) + ".json"
+}
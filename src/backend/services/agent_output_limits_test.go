@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedOutputAgent returns the same output on every execution, after delay
+type fixedOutputAgent struct {
+	output interface{}
+	delay  time.Duration
+}
+
+func (a fixedOutputAgent) Execute(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+	time.Sleep(a.delay)
+	return a.output, nil
+}
+
+func (a fixedOutputAgent) GetType() AgentType {
+	return "fixed_output"
+}
+
+func (a fixedOutputAgent) Name() string {
+	return "Fixed Output"
+}
+
+func (a fixedOutputAgent) Description() string {
+	return "Returns a canned output"
+}
+
+func (a fixedOutputAgent) InputSchema() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+func TestExecuteChain_CapsOversizedAgentOutput(t *testing.T) {
+	o, mock, chainID, _ := newTestOrchestrator(t)
+	storeDir := t.TempDir()
+	o.outputLimits = AgentOutputLimits{MaxChars: 100, Store: NewFileAgentOutputStore(storeDir)}
+	o.registeredAgents["fixed_output"] = fixedOutputAgent{output: strings.Repeat("x", 5000)}
+	o.activeChains[chainID].Agents = []AgentDefinition{
+		{ID: "big", Type: "fixed_output", Name: "Big", OutputKey: "big_output"},
+	}
+	save := false
+
+	result, err := o.ExecuteChain(context.Background(), ChainExecutionRequest{
+		ChainID:        chainID,
+		UserID:         uuid.New(),
+		SaveAsNotebook: &save,
+	})
+	require.NoError(t, err)
+
+	capped, ok := result.Results["big_output"].(string)
+	require.True(t, ok)
+	assert.True(t, strings.HasPrefix(capped, strings.Repeat("x", 100)))
+	assert.Contains(t, capped, "[output truncated: 100 of 5000 characters shown]")
+	assert.Less(t, len(capped), 200)
+
+	require.Len(t, result.ExecutionLog, 1)
+	log := result.ExecutionLog[0]
+	assert.True(t, log.Truncated)
+	assert.Equal(t, capped, log.Output)
+	require.True(t, strings.HasPrefix(log.OutputRef, "file://"))
+
+	full, err := os.ReadFile(strings.TrimPrefix(log.OutputRef, "file://"))
+	require.NoError(t, err)
+	var stored string
+	require.NoError(t, json.Unmarshal(full, &stored))
+	assert.Len(t, stored, 5000)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecuteChain_StoresEachRunOfAnAgent(t *testing.T) {
+	o, mock, chainID, _ := newTestOrchestrator(t)
+	o.outputLimits = AgentOutputLimits{MaxChars: 100, Store: NewFileAgentOutputStore(t.TempDir())}
+	o.registeredAgents["fixed_output"] = fixedOutputAgent{output: strings.Repeat("x", 5000)}
+	o.activeChains[chainID].Agents = []AgentDefinition{
+		{ID: "big", Type: "fixed_output", Name: "Big", OutputKey: "first"},
+		{ID: "big", Type: "fixed_output", Name: "Big", OutputKey: "second"},
+	}
+	save := false
+
+	result, err := o.ExecuteChain(context.Background(), ChainExecutionRequest{
+		ChainID:        chainID,
+		UserID:         uuid.New(),
+		SaveAsNotebook: &save,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, result.ExecutionLog, 2)
+	first, second := result.ExecutionLog[0].OutputRef, result.ExecutionLog[1].OutputRef
+	require.NotEmpty(t, first)
+	require.NotEmpty(t, second)
+	assert.NotEqual(t, first, second)
+	for _, ref := range []string{first, second} {
+		_, err := os.Stat(strings.TrimPrefix(ref, "file://"))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCapAgentOutput(t *testing.T) {
+	t.Run("small output is kept", func(t *testing.T) {
+		output, truncated := capAgentOutput("short", 100)
+		assert.False(t, truncated)
+		assert.Equal(t, "short", output)
+	})
+
+	t.Run("zero disables the cap", func(t *testing.T) {
+		long := strings.Repeat("a", 500)
+		output, truncated := capAgentOutput(long, 0)
+		assert.False(t, truncated)
+		assert.Equal(t, long, output)
+	})
+
+	t.Run("map keeps keys and cuts strings", func(t *testing.T) {
+		output, truncated := capAgentOutput(map[string]interface{}{
+			"summary":   strings.Repeat("s", 1000),
+			"count":     3,
+			"truncated": false,
+		}, 100)
+		require.True(t, truncated)
+		capped := output.(map[string]interface{})
+		assert.Equal(t, 3, capped["count"])
+		// The agent's own truncated field survives the marker
+		assert.Equal(t, false, capped["truncated"])
+		assert.Equal(t, true, capped["_output_truncated"])
+		assert.Contains(t, capped["summary"], "[output truncated: 100 of 1000 characters shown]")
+	})
+
+	t.Run("other values become a preview", func(t *testing.T) {
+		items := make([]int, 1000)
+		output, truncated := capAgentOutput(items, 100)
+		require.True(t, truncated)
+		capped := output.(map[string]interface{})
+		assert.Equal(t, true, capped["_output_truncated"])
+		assert.Equal(t, agentOutputSize(items), capped["original_chars"])
+		assert.Contains(t, capped["preview"], "[output truncated: 100 of")
+	})
+}
+
+func TestFileAgentOutputStore_StaysInsideItsDirectory(t *testing.T) {
+	root := t.TempDir()
+	storeDir := filepath.Join(root, "outputs")
+	store := NewFileAgentOutputStore(storeDir)
+
+	// A chain agent ID can't climb out of the store
+	key := agentOutputKey("run-1", "../../escaped", 1)
+	assert.Equal(t, "run-1/______escaped-1.json", key)
+	ref, err := store.Save(context.Background(), key, []byte(`"x"`))
+	require.NoError(t, err)
+	assert.Equal(t, "file://"+filepath.Join(storeDir, "run-1", "______escaped-1.json"), ref)
+
+	for _, key := range []string{"../escaped.json", "run-1/../../escaped.json", "."} {
+		_, err := store.Save(context.Background(), key, []byte(`"x"`))
+		assert.ErrorIs(t, err, ErrInvalidInput, key)
+	}
+	_, err = os.Stat(filepath.Join(root, "escaped.json"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"log"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Kinds of cached AI artifacts
+const (
+	ArtifactNotebookSummary = "notebook_summary"
+)
+
+// artifactHash hashes the inputs of a derived AI result. Each part is
+// length-prefixed so moving text between parts changes the hash.
+func artifactHash(kind string, parts ...string) string {
+	h := sha256.New()
+	for _, part := range append([]string{kind}, parts...) {
+		var size [8]byte
+		binary.LittleEndian.PutUint64(size[:], uint64(len(part)))
+		h.Write(size[:])
+		h.Write([]byte(part))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedArtifact returns the cached result of kind for scopeID when it was
+// computed from inputs with the given hash
+func cachedArtifact(ctx context.Context, db *gorm.DB, kind string, scopeID uuid.UUID, hash string) (*models.AIArtifact, bool) {
+	var artifact models.AIArtifact
+	err := db.WithContext(ctx).
+		Where("kind = ? AND scope_id = ? AND input_hash = ?", kind, scopeID, hash).
+		First(&artifact).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to read cached %s for %s: %v", kind, scopeID, err)
+		}
+		return nil, false
+	}
+	return &artifact, true
+}
+
+// storeArtifact caches result as the artifact of kind for scopeID, replacing
+// whatever was cached before
+func storeArtifact(ctx context.Context, db *gorm.DB, kind string, scopeID uuid.UUID, hash, result string) error {
+	artifact := models.AIArtifact{Kind: kind, ScopeID: scopeID, InputHash: hash, Result: result}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}, {Name: "scope_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"input_hash", "result", "updated_at"}),
+	}).Create(&artifact).Error
+}
+
+// invalidateArtifacts drops the cached artifacts of the notes and notebooks
+// an event touched. Block events only name their note, so its notebook is
+// looked up. The input hash already keeps stale results from being served;
+// this frees them as soon as their inputs change.
+func invalidateArtifacts(db *gorm.DB, event models.Event, data map[string]interface{}) {
+	switch event.Entity {
+	case "note", "block", "notebook":
+	default:
+		return
+	}
+
+	var scopeIDs []uuid.UUID
+	addScope := func(value interface{}) {
+		if idStr, ok := value.(string); ok {
+			if id, err := uuid.Parse(idStr); err == nil && id != uuid.Nil {
+				scopeIDs = append(scopeIDs, id)
+			}
+		}
+	}
+	addScope(data["note_id"])
+	addScope(data["notebook_id"])
+	if _, hasNotebook := data["notebook_id"]; !hasNotebook {
+		if noteID, ok := data["note_id"].(string); ok {
+			var note models.Note
+			if err := db.Unscoped().Select("notebook_id").Where("id = ?", noteID).First(&note).Error; err == nil {
+				addScope(note.NotebookID.String())
+			}
+		}
+	}
+	if len(scopeIDs) == 0 {
+		return
+	}
+
+	if err := db.Where("scope_id IN ?", scopeIDs).Delete(&models.AIArtifact{}).Error; err != nil {
+		log.Printf("Failed to invalidate cached AI artifacts for event %s: %v", event.ID, err)
+	}
+}
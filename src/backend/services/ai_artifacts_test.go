@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// expectNotebookSummaryInputs expects the loads of a one-note notebook whose
+// note already has an AI summary, and returns the hash of those inputs
+func expectNotebookSummaryInputs(dbMock sqlmock.Sqlmock, notebookID, userID uuid.UUID, noteSummary string) string {
+	noteID := uuid.New()
+	dbMock.ExpectQuery(`SELECT \* FROM "notebooks" WHERE \(id = \$1 AND user_id = \$2\)`).
+		WithArgs(notebookID, userID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "description"}).
+			AddRow(notebookID, userID, "Garden", "Plans for the garden"))
+	dbMock.ExpectQuery(`SELECT \* FROM "notes" WHERE notebook_id = \$1`).
+		WithArgs(notebookID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notebook_id", "title"}).AddRow(noteID, notebookID, "Tomatoes"))
+	dbMock.ExpectQuery(`SELECT \* FROM "ai_enhanced_notes" WHERE note_id IN \(\$1\) AND summary <> ''`).
+		WithArgs(noteID).
+		WillReturnRows(sqlmock.NewRows([]string{"note_id", "summary"}).AddRow(noteID, noteSummary))
+
+	doc := notebookSummaryDoc{Title: "Tomatoes", Content: noteSummary}
+	return artifactHash(ArtifactNotebookSummary, "Garden", "Plans for the garden", doc.render())
+}
+
+func TestGenerateNotebookSummary_CacheHitSkipsLLM(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	ai, prompt := newStubAIService(t, "fresh summary")
+	ai.db = db.DB
+
+	notebookID, userID := uuid.New(), uuid.New()
+	hash := expectNotebookSummaryInputs(dbMock, notebookID, userID, "Plant after the last frost.")
+	cachedAt := time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+	dbMock.ExpectQuery(`SELECT \* FROM "ai_artifacts" WHERE kind = \$1 AND scope_id = \$2 AND input_hash = \$3`).
+		WithArgs(ArtifactNotebookSummary, notebookID, hash, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "scope_id", "input_hash", "result", "updated_at"}).
+			AddRow(uuid.New(), ArtifactNotebookSummary, notebookID, hash, "cached summary", cachedAt))
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`UPDATE "notebooks" SET "ai_summary"=\$1,"summary_generated_at"=\$2`).
+		WithArgs("cached summary", cachedAt, sqlmock.AnyArg(), notebookID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	notebook, err := ai.GenerateNotebookSummary(context.Background(), notebookID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "cached summary", notebook.AISummary)
+	assert.Empty(t, *prompt, "a cache hit must not call the LLM")
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestGenerateNotebookSummary_ChangedNotesMissCache(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	ai, prompt := newStubAIService(t, "fresh summary")
+	ai.db = db.DB
+
+	// The cached entry was computed before the note's summary changed, so
+	// nothing matches the hash of the current inputs
+	notebookID, userID := uuid.New(), uuid.New()
+	hash := expectNotebookSummaryInputs(dbMock, notebookID, userID, "Plant in late May instead.")
+	dbMock.ExpectQuery(`SELECT \* FROM "ai_artifacts" WHERE kind = \$1 AND scope_id = \$2 AND input_hash = \$3`).
+		WithArgs(ArtifactNotebookSummary, notebookID, hash, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery(`INSERT INTO "ai_artifacts" .* ON CONFLICT \("kind","scope_id"\) DO UPDATE SET "input_hash"="excluded"."input_hash","result"="excluded"."result","updated_at"="excluded"."updated_at"`).
+		WithArgs(ArtifactNotebookSummary, notebookID, hash, "fresh summary").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(uuid.New(), time.Now(), time.Now()))
+	dbMock.ExpectCommit()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`UPDATE "notebooks" SET "ai_summary"=\$1`).
+		WithArgs("fresh summary", sqlmock.AnyArg(), sqlmock.AnyArg(), notebookID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	notebook, err := ai.GenerateNotebookSummary(context.Background(), notebookID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "fresh summary", notebook.AISummary)
+	assert.Contains(t, *prompt, "Plant in late May instead.")
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDispatchEvent_InvalidatesCachedArtifacts(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	producer := NewMockProducer()
+	producer.On("PublishMessage", mock.Anything, mock.Anything).Return(nil)
+	handler := &EventHandlerService{db: db, producer: producer}
+
+	// A block edit names only its note; the note's notebook is looked up
+	noteID, notebookID := uuid.New(), uuid.New()
+	data, err := json.Marshal(map[string]interface{}{"block_id": uuid.New().String(), "note_id": noteID.String()})
+	require.NoError(t, err)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`UPDATE "events" SET`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+	dbMock.ExpectQuery(`SELECT "notebook_id" FROM "notes" WHERE id = \$1`).
+		WithArgs(noteID.String(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"notebook_id"}).AddRow(notebookID))
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`DELETE FROM "ai_artifacts" WHERE scope_id IN \(\$1,\$2\)`).
+		WithArgs(noteID, notebookID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	event := models.Event{ID: uuid.New(), Event: "block.updated", Entity: "block", Timestamp: time.Now().UTC(), Data: data}
+	require.NoError(t, handler.dispatchEvent(event))
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestArtifactHash_SeparatesParts(t *testing.T) {
+	assert.Equal(t, artifactHash("k", "ab", "c"), artifactHash("k", "ab", "c"))
+	assert.NotEqual(t, artifactHash("k", "ab", "c"), artifactHash("k", "a", "bc"))
+	assert.NotEqual(t, artifactHash("k", "ab"), artifactHash("other", "ab"))
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultAnthropicBaseURL = "https://api.anthropic.com"
+	// defaultAIHealthTTL is how long a provider health result is trusted
+	defaultAIHealthTTL   = time.Minute
+	aiHealthProbeTimeout = 5 * time.Second
+)
+
+// AIUnavailableMessage is shown to users while the LLM provider can't be reached
+const AIUnavailableMessage = "AI is temporarily unavailable. Please try again in a few minutes."
+
+// aiHealth caches whether the LLM provider is reachable. mu guards the
+// cached result only; probes run outside it and concurrent ones share a call.
+type aiHealth struct {
+	mu        sync.Mutex
+	probes    singleflight.Group
+	ttl       time.Duration
+	checkedAt time.Time
+	available bool
+}
+
+// aiHealthTTLFromEnv reads AI_HEALTH_TTL, e.g. "30s"
+func aiHealthTTLFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("AI_HEALTH_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return defaultAIHealthTTL
+}
+
+// anthropicBaseURLFromEnv reads ANTHROPIC_BASE_URL, used for proxies and tests
+func anthropicBaseURLFromEnv() string {
+	if baseURL := strings.TrimSpace(os.Getenv("ANTHROPIC_BASE_URL")); baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+	return defaultAnthropicBaseURL
+}
+
+// Available reports whether the LLM provider can be used. Without an API key
+// or while AI is paused it never is; otherwise a cheap probe result is cached
+// for the health TTL. Callers use it to pick degraded behaviour instead of
+// failing requests.
+func (ai *AIService) Available(ctx context.Context) bool {
+	if ai == nil || ai.anthropicKey == "" || AIPauseInstance.Paused() {
+		return false
+	}
+
+	if available, fresh := ai.health.cached(); fresh {
+		return available
+	}
+
+	// Callers arriving while a probe runs wait for its result instead of
+	// probing again. The probe outlives a caller that gives up, so the
+	// others still get an answer.
+	probeCtx := context.WithoutCancel(ctx)
+	result := ai.health.probes.DoChan("anthropic", func() (interface{}, error) {
+		available := ai.probeAnthropic(probeCtx)
+		ai.health.record(available)
+		return available, nil
+	})
+	select {
+	case res := <-result:
+		return res.Val.(bool)
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// cached returns the last probe result and whether it's still within the TTL
+func (h *aiHealth) cached() (available, fresh bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.checkedAt.IsZero() || time.Since(h.checkedAt) >= h.ttl {
+		return false, false
+	}
+	return h.available, true
+}
+
+// record stores a probe result
+func (h *aiHealth) record(available bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if available != h.available || h.checkedAt.IsZero() {
+		log.Printf("AI provider available: %t", available)
+	}
+	h.available = available
+	h.checkedAt = time.Now()
+}
+
+// markUnavailable records a failed provider call so later calls degrade
+// straight away until the health TTL expires
+func (ai *AIService) markUnavailable(reason error) {
+	ai.health.mu.Lock()
+	defer ai.health.mu.Unlock()
+	if ai.health.available || ai.health.checkedAt.IsZero() {
+		log.Printf("AI provider marked unavailable: %v", reason)
+	}
+	ai.health.available = false
+	ai.health.checkedAt = time.Now()
+}
+
+// probeAnthropic lists models, which costs no tokens. Auth failures and
+// server errors count as unavailable, anything else means the API answers.
+func (ai *AIService) probeAnthropic(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, aiHealthProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", ai.anthropicBaseURL+"/v1/models?limit=1", nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("x-api-key", ai.anthropicKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := ai.httpClient.Do(req)
+	if err != nil {
+		log.Printf("AI provider health probe failed: %v", err)
+		return false
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		log.Printf("AI provider rejected the API key (status %d)", resp.StatusCode)
+		return false
+	case resp.StatusCode >= 500:
+		return false
+	}
+	return true
+}
+
+// providerDown reports whether a response status means the provider itself is failing
+func providerDown(status int) bool {
+	return status >= 500 || status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// placeholderBreakdown is the single-step plan used while AI is unavailable
+func placeholderBreakdown(title, description string, maxSteps int) map[string]interface{} {
+	stepDescription := description
+	if stepDescription == "" {
+		stepDescription = "Break this down into steps once AI is available again."
+	}
+	return map[string]interface{}{
+		"goal": title,
+		"steps": []interface{}{
+			map[string]interface{}{
+				"step":        1,
+				"title":       title,
+				"description": stepDescription,
+			},
+		},
+		"max_steps":      maxSteps,
+		"ai_unavailable": true,
+	}
+}
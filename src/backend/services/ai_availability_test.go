@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDownAIService returns an AI service whose provider answers every request
+// with status, and a counter of the requests it received
+func newDownAIService(t *testing.T, status int) (*AIService, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return &AIService{
+		anthropicKey:     "test-key",
+		anthropicBaseURL: server.URL,
+		httpClient:       server.Client(),
+		health:           aiHealth{ttl: time.Minute},
+	}, &requests
+}
+
+func TestAvailable_WithoutKey(t *testing.T) {
+	ai := &AIService{health: aiHealth{ttl: time.Minute}}
+	assert.False(t, ai.Available(context.Background()))
+
+	_, err := ai.callAnthropic(context.Background(), "hello", 10)
+	assert.ErrorIs(t, err, ErrAIUnavailable)
+}
+
+func TestAvailable_CachesProbeResult(t *testing.T) {
+	ai, requests := newDownAIService(t, http.StatusServiceUnavailable)
+
+	assert.False(t, ai.Available(context.Background()))
+	assert.False(t, ai.Available(context.Background()))
+	_, err := ai.callAnthropic(context.Background(), "hello", 10)
+	assert.ErrorIs(t, err, ErrAIUnavailable)
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests), "only the first check probes the provider")
+
+	// Once the TTL is over the provider is probed again
+	ai.health.checkedAt = time.Now().Add(-2 * time.Minute)
+	ai.Available(context.Background())
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
+
+func TestAvailable_FailedCallMarksProviderDown(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/v1/models" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	ai := &AIService{anthropicKey: "test-key", anthropicBaseURL: server.URL, httpClient: server.Client(), health: aiHealth{ttl: time.Minute}}
+
+	_, err := ai.callAnthropic(context.Background(), "hello", 10)
+	assert.ErrorIs(t, err, ErrAIUnavailable)
+	assert.False(t, ai.Available(context.Background()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "no probe after the failed call")
+}
+
+func TestBreakDownTask_ProviderDownReturnsPlaceholder(t *testing.T) {
+	ai, _ := newDownAIService(t, http.StatusServiceUnavailable)
+
+	breakdown, err := ai.BreakDownTask(context.Background(), "Learn Go", "Finish the tour", 5)
+	require.NoError(t, err)
+	assert.Equal(t, true, breakdown["ai_unavailable"])
+
+	steps, ok := breakdown["steps"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, steps, 1)
+	step := steps[0].(map[string]interface{})
+	assert.Equal(t, "Learn Go", step["title"])
+	assert.Equal(t, "Finish the tour", step["description"])
+}
+
+func TestChat_ProviderDownReturnsUnavailableMessage(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	mock.MatchExpectationsInOrder(false)
+	ai, _ := newDownAIService(t, http.StatusServiceUnavailable)
+	chat := NewChatService(db.DB, ai, nil)
+
+	response, err := chat.Chat(context.Background(), uuid.New(), ChatRequest{Message: "hello there"})
+	require.NoError(t, err)
+	assert.Equal(t, AIUnavailableMessage, response.Message)
+	assert.Equal(t, true, response.Metadata["ai_unavailable"])
+	assert.NotEmpty(t, response.SessionID)
+}
+
+func TestClassifyMessage_ProviderDownUsesKeywordRules(t *testing.T) {
+	ai, _ := newDownAIService(t, http.StatusServiceUnavailable)
+	ts := &TelegramService{aiService: ai}
+
+	intent, err := ts.classifyMessage(context.Background(), "remind me to buy milk")
+	require.NoError(t, err)
+	assert.Equal(t, "task", intent.Type)
+}
+
+func TestHandleNote_ProviderDownSavesWithoutEnhancement(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	ai, _ := newDownAIService(t, http.StatusServiceUnavailable)
+	ts := &TelegramService{db: db.DB, aiService: ai}
+	userID := uuid.New()
+
+	mock.ExpectQuery(`SELECT \* FROM "notebooks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name"}).AddRow(uuid.New(), userID, "📱 Telegram Messages"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "notes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "blocks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+	mock.ExpectExec(notePreviewUpdate).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	response := ts.handleNote(context.Background(), userID, "an idea for later", &MessageIntent{Type: "note"})
+	assert.Contains(t, response, "Note created")
+	assert.Contains(t, response, "saved without AI enhancement")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// newSlowAIService returns an AI service whose provider answers once release
+// is closed, and a counter of the requests it received
+func newSlowAIService(t *testing.T, release <-chan struct{}) (*AIService, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	return &AIService{
+		anthropicKey:     "test-key",
+		anthropicBaseURL: server.URL,
+		httpClient:       server.Client(),
+		health:           aiHealth{ttl: time.Minute},
+	}, &requests
+}
+
+func TestAvailable_ConcurrentCallersShareOneProbe(t *testing.T) {
+	release := make(chan struct{})
+	ai, requests := newSlowAIService(t, release)
+
+	results := make(chan bool, 5)
+	for i := 0; i < 5; i++ {
+		go func() { results <- ai.Available(context.Background()) }()
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt32(requests) == 1 }, time.Second, time.Millisecond)
+
+	close(release)
+	for i := 0; i < 5; i++ {
+		assert.True(t, <-results)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests), "concurrent callers share the probe")
+}
+
+func TestAvailable_ProbeDoesNotHoldTheLock(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	ai, requests := newSlowAIService(t, release)
+
+	go ai.Available(context.Background())
+	require.Eventually(t, func() bool { return atomic.LoadInt32(requests) == 1 }, time.Second, time.Millisecond)
+
+	marked := make(chan struct{})
+	go func() {
+		ai.markUnavailable(assert.AnError)
+		close(marked)
+	}()
+	select {
+	case <-marked:
+	case <-time.After(time.Second):
+		t.Fatal("markUnavailable waited for the probe")
+	}
+
+	// A caller that gives up doesn't wait for the probe either
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ai.health.checkedAt = time.Time{}
+	assert.False(t, ai.Available(ctx))
+}
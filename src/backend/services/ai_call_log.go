@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/utils/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// defaultAIDebugMaxChars caps how much of each prompt and response is logged
+const defaultAIDebugMaxChars = 8000
+
+type aiCallContextKey struct{}
+
+// aiCallInfo describes an LLM call for debug logging
+type aiCallInfo struct {
+	feature   string
+	userID    *uuid.UUID
+	sensitive []string
+}
+
+// WithAICallUser tags LLM calls made with ctx with the user they run for
+func WithAICallUser(ctx context.Context, userID uuid.UUID) context.Context {
+	info := aiCallInfoFrom(ctx)
+	info.userID = &userID
+	return context.WithValue(ctx, aiCallContextKey{}, info)
+}
+
+// withAICallFeature tags LLM calls made with ctx with a feature name. The
+// sensitive values (note titles, content) are masked when redaction is on.
+func withAICallFeature(ctx context.Context, feature string, sensitive ...string) context.Context {
+	info := aiCallInfoFrom(ctx)
+	info.feature = feature
+	info.sensitive = append(append([]string{}, info.sensitive...), sensitive...)
+	return context.WithValue(ctx, aiCallContextKey{}, info)
+}
+
+func aiCallInfoFrom(ctx context.Context) aiCallInfo {
+	if info, ok := ctx.Value(aiCallContextKey{}).(aiCallInfo); ok {
+		return info
+	}
+	return aiCallInfo{}
+}
+
+// AICallLogger logs full prompts and responses of LLM calls when AI_DEBUG_LOG
+// is enabled, and stores them in ai_call_logs when AI_DEBUG_PERSIST is set.
+// Either can be on without the other.
+type AICallLogger struct {
+	db       *gorm.DB
+	logger   *logger.Logger
+	logCalls bool
+	persist  bool
+	redact   bool
+	maxChars int
+}
+
+// NewAICallLogger creates a call logger configured from the environment:
+// AI_DEBUG_LOG, AI_DEBUG_PERSIST, AI_DEBUG_REDACT and AI_DEBUG_MAX_CHARS
+func NewAICallLogger(db *gorm.DB) *AICallLogger {
+	maxChars := defaultAIDebugMaxChars
+	if value, err := strconv.Atoi(os.Getenv("AI_DEBUG_MAX_CHARS")); err == nil && value > 0 {
+		maxChars = value
+	}
+
+	return &AICallLogger{
+		db:       db,
+		logger:   logger.New("AICallLog"),
+		logCalls: envFlag("AI_DEBUG_LOG"),
+		persist:  envFlag("AI_DEBUG_PERSIST") && db != nil,
+		redact:   envFlag("AI_DEBUG_REDACT"),
+		maxChars: maxChars,
+	}
+}
+
+// Enabled reports whether calls are being recorded
+func (l *AICallLogger) Enabled() bool {
+	return l != nil && (l.logCalls || l.persist)
+}
+
+// Record logs a completed LLM call
+func (l *AICallLogger) Record(ctx context.Context, model, prompt, response string, callErr error, duration time.Duration) {
+	if !l.Enabled() {
+		return
+	}
+
+	info := aiCallInfoFrom(ctx)
+	feature := info.feature
+	if feature == "" {
+		feature = "unknown"
+	}
+
+	loggedPrompt, loggedResponse := prompt, response
+	if l.redact {
+		loggedPrompt = redactAIContent(loggedPrompt, info.sensitive)
+		loggedResponse = redactAIContent(loggedResponse, info.sensitive)
+	}
+	loggedPrompt, promptTruncated := truncateAIContent(loggedPrompt, l.maxChars)
+	loggedResponse, responseTruncated := truncateAIContent(loggedResponse, l.maxChars)
+
+	errText := ""
+	if callErr != nil {
+		errText = callErr.Error()
+	}
+
+	if l.logCalls {
+		data := map[string]interface{}{
+			"feature":     feature,
+			"model":       model,
+			"prompt":      loggedPrompt,
+			"response":    loggedResponse,
+			"duration_ms": duration.Milliseconds(),
+			"truncated":   promptTruncated || responseTruncated,
+			"redacted":    l.redact,
+		}
+		if info.userID != nil {
+			data["user_id"] = info.userID.String()
+		}
+		if errText != "" {
+			data["error"] = errText
+		}
+		l.logger.Debug("LLM call", data)
+	}
+
+	if !l.persist {
+		return
+	}
+
+	entry := models.AICallLog{
+		UserID:        info.userID,
+		Feature:       feature,
+		Model:         model,
+		Prompt:        loggedPrompt,
+		Response:      loggedResponse,
+		Error:         errText,
+		PromptChars:   utf8.RuneCountInString(prompt),
+		ResponseChars: utf8.RuneCountInString(response),
+		Truncated:     promptTruncated || responseTruncated,
+		Redacted:      l.redact,
+		DurationMs:    duration.Milliseconds(),
+	}
+	// Use a fresh context so a cancelled request still gets its log row
+	if err := l.db.WithContext(context.Background()).Create(&entry).Error; err != nil {
+		l.logger.Warn("Failed to persist AI call log", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// redactAIContent masks the sensitive values inside text, longest first so
+// that a title contained in the content doesn't leave parts behind
+func redactAIContent(text string, sensitive []string) string {
+	values := make([]string, 0, len(sensitive))
+	for _, value := range sensitive {
+		if strings.TrimSpace(value) != "" {
+			values = append(values, value)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	for _, value := range values {
+		text = strings.ReplaceAll(text, value, fmt.Sprintf("[REDACTED %d chars]", utf8.RuneCountInString(value)))
+	}
+	return text
+}
+
+// truncateAIContent cuts text to at most maxChars runes
+func truncateAIContent(text string, maxChars int) (string, bool) {
+	runes := []rune(text)
+	if maxChars <= 0 || len(runes) <= maxChars {
+		return text, false
+	}
+	return string(runes[:maxChars]) + fmt.Sprintf("... [truncated %d chars]", len(runes)-maxChars), true
+}
+
+func envFlag(name string) bool {
+	enabled, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv(name)))
+	return enabled
+}
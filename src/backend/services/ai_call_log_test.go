@@ -0,0 +1,81 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func captureLogOutput(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	t.Setenv("LOG_FORMAT", "")
+	return &buf
+}
+
+func TestAICallLogger_FlagTogglesLogging(t *testing.T) {
+	buf := captureLogOutput(t)
+	ctx := withAICallFeature(context.Background(), "summary")
+
+	t.Setenv("AI_DEBUG_LOG", "")
+	NewAICallLogger(nil).Record(ctx, "test-model", "the prompt", "the response", nil, time.Second)
+	assert.Empty(t, buf.String())
+
+	t.Setenv("AI_DEBUG_LOG", "true")
+	NewAICallLogger(nil).Record(ctx, "test-model", "the prompt", "the response", nil, time.Second)
+	output := buf.String()
+	assert.Contains(t, output, "[DEBUG] AICallLog: LLM call")
+	assert.Contains(t, output, "the prompt")
+	assert.Contains(t, output, "the response")
+	assert.Contains(t, output, `"feature":"summary"`)
+	assert.Contains(t, output, `"model":"test-model"`)
+}
+
+func TestAICallLogger_RedactsAndTruncates(t *testing.T) {
+	buf := captureLogOutput(t)
+	t.Setenv("AI_DEBUG_LOG", "true")
+	t.Setenv("AI_DEBUG_REDACT", "true")
+	t.Setenv("AI_DEBUG_MAX_CHARS", "60")
+
+	ctx := withAICallFeature(context.Background(), "summary", "Secret diary", "my private thoughts")
+	NewAICallLogger(nil).Record(ctx, "test-model", "Title: Secret diary\nContent: my private thoughts", strings.Repeat("x", 100), nil, time.Second)
+
+	output := buf.String()
+	assert.NotContains(t, output, "Secret diary")
+	assert.NotContains(t, output, "my private thoughts")
+	assert.Contains(t, output, "[REDACTED 12 chars]")
+	assert.Contains(t, output, "[truncated 40 chars]")
+}
+
+func TestAICallLogger_Persists(t *testing.T) {
+	buf := captureLogOutput(t)
+	t.Setenv("AI_DEBUG_PERSIST", "true")
+
+	db, mock, closeDB := testutils.SetupMockDB()
+	defer closeDB()
+
+	userID := uuid.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "ai_call_logs"`).
+		WithArgs(userID, "classify-intent", "test-model", "prompt", "réponse", "", 6, 7, false, false, int64(1500)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(uuid.New(), time.Now()))
+	mock.ExpectCommit()
+
+	ctx := WithAICallUser(withAICallFeature(context.Background(), "classify-intent"), userID)
+	NewAICallLogger(db.DB).Record(ctx, "test-model", "prompt", "réponse", nil, 1500*time.Millisecond)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	// Persisting doesn't turn on the debug log
+	assert.NotContains(t, buf.String(), "LLM call")
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// defaultLLMConcurrency caps how many LLM calls run at the same time
+const defaultLLMConcurrency = 8
+
+var (
+	llmSlots     chan struct{}
+	llmSlotsOnce sync.Once
+)
+
+// llmCallSlots returns the semaphore shared by every LLM call, sized by
+// AI_MAX_CONCURRENT_CALLS
+func llmCallSlots() chan struct{} {
+	llmSlotsOnce.Do(func() {
+		concurrency := defaultLLMConcurrency
+		if value, err := strconv.Atoi(os.Getenv("AI_MAX_CONCURRENT_CALLS")); err == nil && value > 0 {
+			concurrency = value
+		}
+		llmSlots = make(chan struct{}, concurrency)
+	})
+	return llmSlots
+}
+
+// acquireLLMSlot waits for a free LLM call slot. The returned func frees it.
+func acquireLLMSlot(ctx context.Context) (func(), error) {
+	slots := llmCallSlots()
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
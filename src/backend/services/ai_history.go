@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AIOperationType is the kind of an AIOperation
+type AIOperationType string
+
+const (
+	// AIOperationEnhancement is a note processed by the AI
+	AIOperationEnhancement AIOperationType = "enhancement"
+	// AIOperationChain is an agent chain execution
+	AIOperationChain AIOperationType = "chain"
+	// AIOperationReasoning is a reasoning loop run
+	AIOperationReasoning AIOperationType = "reasoning"
+	// AIOperationAgent is any other agent run
+	AIOperationAgent AIOperationType = "agent"
+	// AIOperationCreated is a note the AI created
+	AIOperationCreated AIOperationType = "created"
+)
+
+// AIOperationTypes are the operation types in the AI history
+var AIOperationTypes = []AIOperationType{AIOperationEnhancement, AIOperationChain, AIOperationReasoning, AIOperationAgent, AIOperationCreated}
+
+// aiNoteSources are the sources of notes created by the AI, as recorded in
+// their note.created event
+var aiNoteSources = []string{"agent_chain", "reasoning_agent", "ai_breakdown", "ai_project"}
+
+// AIOperation is an entry of the user's AI history
+type AIOperation struct {
+	Type       AIOperationType `json:"type"`
+	TargetType string          `json:"target_type"` // note, chain or agent
+	TargetID   uuid.UUID       `json:"target_id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Status     string          `json:"status"`
+	Summary    string          `json:"summary"`
+}
+
+// AIHistoryFilter narrows the AI history. Empty Types means every type;
+// Since and Until bound the timestamps when set.
+type AIHistoryFilter struct {
+	Types []AIOperationType
+	Since *time.Time
+	Until *time.Time
+}
+
+func (f AIHistoryFilter) includes(operation AIOperationType) bool {
+	return len(f.Types) == 0 || slices.Contains(f.Types, operation)
+}
+
+// between adds the date bounds of the filter on column
+func (f AIHistoryFilter) between(db *gorm.DB, column string) *gorm.DB {
+	if f.Since != nil {
+		db = db.Where(column+" >= ?", *f.Since)
+	}
+	if f.Until != nil {
+		db = db.Where(column+" <= ?", *f.Until)
+	}
+	return db
+}
+
+// ParseAIOperationTypes reads a comma-separated list of operation types,
+// every type when empty
+func ParseAIOperationTypes(value string) ([]AIOperationType, error) {
+	var types []AIOperationType
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		operation := AIOperationType(part)
+		if !slices.Contains(AIOperationTypes, operation) {
+			return nil, fmt.Errorf("%w: unknown AI operation type %q", ErrInvalidInput, part)
+		}
+		types = append(types, operation)
+	}
+	return types, nil
+}
+
+// GetAIHistory returns limit operations of the user's AI history after the
+// first offset, newest first. The history merges note enhancements, agent
+// runs and the notes the AI created, so each source is read up to
+// offset+limit entries and the page is cut from the merged timeline.
+func GetAIHistory(ctx context.Context, db *gorm.DB, userID uuid.UUID, filter AIHistoryFilter, offset, limit int) ([]AIOperation, error) {
+	if limit <= 0 {
+		return []AIOperation{}, nil
+	}
+	db = db.WithContext(ctx)
+	window := offset + limit
+
+	var operations []AIOperation
+	if filter.includes(AIOperationEnhancement) {
+		enhancements, err := enhancementHistory(db, userID, filter, window)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, enhancements...)
+	}
+	if filter.includes(AIOperationChain) || filter.includes(AIOperationReasoning) || filter.includes(AIOperationAgent) {
+		runs, err := agentHistory(db, userID, filter, window)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, runs...)
+	}
+	if filter.includes(AIOperationCreated) {
+		created, err := createdNoteHistory(db, userID, filter, window)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, created...)
+	}
+
+	slices.SortStableFunc(operations, func(a, b AIOperation) int { return b.Timestamp.Compare(a.Timestamp) })
+	start := min(offset, len(operations))
+	end := min(start+limit, len(operations))
+	return operations[start:end], nil
+}
+
+// enhancementHistory lists the user's processed notes by when they were
+// last processed
+func enhancementHistory(db *gorm.DB, userID uuid.UUID, filter AIHistoryFilter, limit int) ([]AIOperation, error) {
+	var rows []struct {
+		NoteID           uuid.UUID
+		Title            string
+		ProcessingStatus string
+		ProcessingErrors models.EnhancementErrors
+		LastProcessedAt  time.Time
+	}
+	query := db.Table("ai_enhanced_notes").
+		Select("ai_enhanced_notes.note_id, notes.title, ai_enhanced_notes.processing_status, ai_enhanced_notes.processing_errors, ai_enhanced_notes.last_processed_at").
+		Joins("JOIN notes ON notes.id = ai_enhanced_notes.note_id").
+		Where("notes.user_id = ? AND notes.deleted_at IS NULL AND ai_enhanced_notes.last_processed_at IS NOT NULL", userID)
+	err := filter.between(query, "ai_enhanced_notes.last_processed_at").
+		Order("ai_enhanced_notes.last_processed_at DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load enhancement history: %w", err)
+	}
+
+	operations := make([]AIOperation, len(rows))
+	for i, row := range rows {
+		summary := fmt.Sprintf("Enhanced note %q", row.Title)
+		if len(row.ProcessingErrors) > 0 {
+			failed := make([]string, len(row.ProcessingErrors))
+			for j, failure := range row.ProcessingErrors {
+				failed[j] = failure.Enhancement
+			}
+			summary += ", failed: " + strings.Join(failed, ", ")
+		}
+		operations[i] = AIOperation{
+			Type:       AIOperationEnhancement,
+			TargetType: "note",
+			TargetID:   row.NoteID,
+			Timestamp:  row.LastProcessedAt,
+			Status:     row.ProcessingStatus,
+			Summary:    summary,
+		}
+	}
+	return operations, nil
+}
+
+// agentHistory lists the user's agent runs of the filtered types by when
+// they started
+func agentHistory(db *gorm.DB, userID uuid.UUID, filter AIHistoryFilter, limit int) ([]AIOperation, error) {
+	query := db.Where("user_id = ?", userID)
+	switch {
+	case filter.includes(AIOperationChain) && filter.includes(AIOperationReasoning) && filter.includes(AIOperationAgent):
+	case filter.includes(AIOperationAgent):
+		var excluded []string
+		if !filter.includes(AIOperationChain) {
+			excluded = append(excluded, "agent_chain")
+		}
+		if !filter.includes(AIOperationReasoning) {
+			excluded = append(excluded, "reasoning_loop")
+		}
+		query = query.Where("agent_type NOT IN ?", excluded)
+	default:
+		var included []string
+		if filter.includes(AIOperationChain) {
+			included = append(included, "agent_chain")
+		}
+		if filter.includes(AIOperationReasoning) {
+			included = append(included, "reasoning_loop")
+		}
+		query = query.Where("agent_type IN ?", included)
+	}
+
+	var agents []models.AIAgent
+	if err := filter.between(query, "started_at").Order("started_at DESC").Limit(limit).Find(&agents).Error; err != nil {
+		return nil, fmt.Errorf("failed to load agent history: %w", err)
+	}
+
+	operations := make([]AIOperation, len(agents))
+	for i, agent := range agents {
+		operation := AIOperation{
+			Type:       AIOperationAgent,
+			TargetType: "agent",
+			TargetID:   agent.ID,
+			Timestamp:  agent.StartedAt,
+			Status:     agent.Status,
+			Summary:    fmt.Sprintf("Ran %s agent", agent.AgentType),
+		}
+		switch agent.AgentType {
+		case "agent_chain":
+			operation.Type, operation.TargetType = AIOperationChain, "chain"
+			if name, _ := agent.InputData["chain_name"].(string); name != "" {
+				operation.Summary = fmt.Sprintf("Executed chain %q", name)
+			} else {
+				operation.Summary = "Executed agent chain"
+			}
+		case "reasoning_loop":
+			operation.Type = AIOperationReasoning
+			if goal, _ := agent.InputData["goal"].(string); goal != "" {
+				operation.Summary = fmt.Sprintf("Reasoned about %q", goal)
+			} else {
+				operation.Summary = "Ran reasoning loop"
+			}
+		}
+		if agent.ErrorMessage != "" {
+			operation.Summary += ": " + agent.ErrorMessage
+		}
+		operations[i] = operation
+	}
+	return operations, nil
+}
+
+// createdNoteHistory lists the notes the AI created for the user, from their
+// note.created events
+func createdNoteHistory(db *gorm.DB, userID uuid.UUID, filter AIHistoryFilter, limit int) ([]AIOperation, error) {
+	query := db.Where("event = ? AND data->>'user_id' = ? AND data->>'source' IN ?", string(broker.NoteCreated), userID.String(), aiNoteSources)
+	var events []models.Event
+	if err := filter.between(query, "timestamp").Order("timestamp DESC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to load created notes history: %w", err)
+	}
+
+	operations := make([]AIOperation, 0, len(events))
+	for _, event := range events {
+		var data struct {
+			NoteID string `json:"note_id"`
+			Title  string `json:"title"`
+			Source string `json:"source"`
+		}
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			continue
+		}
+		noteID, err := uuid.Parse(data.NoteID)
+		if err != nil {
+			continue
+		}
+		operations = append(operations, AIOperation{
+			Type:       AIOperationCreated,
+			TargetType: "note",
+			TargetID:   noteID,
+			Timestamp:  event.Timestamp,
+			Status:     "completed",
+			Summary:    fmt.Sprintf("Created note %q (%s)", data.Title, data.Source),
+		})
+	}
+	return operations, nil
+}
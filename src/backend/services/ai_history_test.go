@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAIHistory_MergesChainsAndEnhancements(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID, noteID, chainID, createdID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT ai_enhanced_notes.note_id, notes.title, .* FROM "ai_enhanced_notes" JOIN notes ON notes.id = ai_enhanced_notes.note_id WHERE notes.user_id = \$1 .* ORDER BY ai_enhanced_notes.last_processed_at DESC LIMIT \$2`).
+		WithArgs(userID, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"note_id", "title", "processing_status", "processing_errors", "last_processed_at"}).
+			AddRow(noteID, "Garden", "partial", []byte(`[{"enhancement":"tags","error":"timeout"}]`), now.Add(-time.Hour)))
+	mock.ExpectQuery(`SELECT \* FROM "ai_agents" WHERE user_id = \$1 AND "ai_agents"."deleted_at" IS NULL ORDER BY started_at DESC LIMIT \$2`).
+		WithArgs(userID, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "agent_type", "status", "input_data", "started_at"}).
+			AddRow(chainID, userID, "agent_chain", "completed", []byte(`{"chain_name":"Research and Summarize"}`), now))
+	mock.ExpectQuery(`SELECT \* FROM "events" WHERE event = \$1 AND data->>'user_id' = \$2 AND data->>'source' IN \(\$3,\$4,\$5,\$6\) ORDER BY timestamp DESC LIMIT \$7`).
+		WithArgs("note.created", userID.String(), "agent_chain", "reasoning_agent", "ai_breakdown", "ai_project", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "event", "timestamp", "data"}).
+			AddRow(uuid.New(), "note.created", now.Add(-30*time.Minute), []byte(`{"note_id":"`+createdID.String()+`","title":"Execution Overview","source":"agent_chain"}`)))
+
+	history, err := GetAIHistory(context.Background(), db.DB, userID, AIHistoryFilter{}, 0, 10)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.Len(t, history, 3)
+
+	assert.Equal(t, AIOperation{
+		Type: AIOperationChain, TargetType: "chain", TargetID: chainID, Timestamp: now,
+		Status: "completed", Summary: `Executed chain "Research and Summarize"`,
+	}, history[0])
+	assert.Equal(t, AIOperationCreated, history[1].Type)
+	assert.Equal(t, createdID, history[1].TargetID)
+	assert.Equal(t, AIOperation{
+		Type: AIOperationEnhancement, TargetType: "note", TargetID: noteID, Timestamp: now.Add(-time.Hour),
+		Status: "partial", Summary: `Enhanced note "Garden", failed: tags`,
+	}, history[2])
+}
+
+func TestGetAIHistory_FiltersByTypeAndDate(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	// Only agent runs are read, and only reasoning ones
+	mock.ExpectQuery(`SELECT \* FROM "ai_agents" WHERE user_id = \$1 AND agent_type IN \(\$2\) AND started_at >= \$3 .* LIMIT \$4`).
+		WithArgs(userID, "reasoning_loop", since, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "agent_type", "status", "input_data", "started_at"}).
+			AddRow(uuid.New(), "reasoning_loop", "failed", []byte(`{"goal":"Plan the launch"}`), since.Add(2*time.Hour)).
+			AddRow(uuid.New(), "reasoning_loop", "completed", []byte(`{"goal":"Sort the inbox"}`), since.Add(time.Hour)))
+
+	history, err := GetAIHistory(context.Background(), db.DB, userID, AIHistoryFilter{Types: []AIOperationType{AIOperationReasoning}, Since: &since}, 5, 2)
+	require.NoError(t, err)
+	assert.Empty(t, history, "the offset skips past every operation")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParseAIOperationTypes(t *testing.T) {
+	types, err := ParseAIOperationTypes("chain, enhancement")
+	require.NoError(t, err)
+	assert.Equal(t, []AIOperationType{AIOperationChain, AIOperationEnhancement}, types)
+
+	types, err = ParseAIOperationTypes("")
+	require.NoError(t, err)
+	assert.Empty(t, types)
+
+	_, err = ParseAIOperationTypes("chain,magic")
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+}
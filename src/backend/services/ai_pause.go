@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// aiSettingPause is the AISetting key of the global AI pause
+const aiSettingPause = "ai_pause"
+
+// AIPausedMessage is the error clients get for new AI work while AI is paused
+const AIPausedMessage = "AI processing is paused by an administrator. Please try again later."
+
+// AIPauseState tells whether AI work is paused, why and by whom
+type AIPauseState struct {
+	Paused    bool       `json:"paused"`
+	Reason    string     `json:"reason,omitempty"`
+	ChangedBy *uuid.UUID `json:"changed_by,omitempty"`
+	ChangedAt *time.Time `json:"changed_at,omitempty"`
+}
+
+// AIPause is the global switch halting AI work, for provider outages and
+// cost spikes. While paused, LLM calls fail with ErrAIPaused, on-demand AI
+// endpoints answer 503 and queued work waits until AI is resumed. Everything
+// else keeps working. The state is stored as an AISetting so a pause
+// survives restarts.
+type AIPause struct {
+	db *gorm.DB
+
+	mu      sync.Mutex
+	state   AIPauseState
+	resumed chan struct{} // Closed while AI is not paused
+}
+
+// AIPauseInstance is set in main.go; while nil AI is never paused
+var AIPauseInstance *AIPause
+
+// NewAIPause creates the switch in the state stored in db
+func NewAIPause(db *gorm.DB) *AIPause {
+	p := &AIPause{db: db, resumed: make(chan struct{})}
+	close(p.resumed)
+
+	var setting models.AISetting
+	err := db.Where("key = ?", aiSettingPause).First(&setting).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to read stored AI pause, AI stays on: %v", err)
+		}
+		return p
+	}
+
+	var state AIPauseState
+	if err := json.Unmarshal(setting.Value, &state); err != nil {
+		log.Printf("Ignoring invalid stored AI pause: %s", setting.Value)
+		return p
+	}
+	if state.Paused {
+		log.Printf("AI processing is paused: %s", state.Reason)
+	}
+	p.apply(state)
+	return p
+}
+
+// Paused reports whether AI work is paused
+func (p *AIPause) Paused() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state.Paused
+}
+
+// State returns the current state of the switch
+func (p *AIPause) State() AIPauseState {
+	if p == nil {
+		return AIPauseState{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// Pause halts AI work until Resume. Pausing again only updates the reason.
+func (p *AIPause) Pause(ctx context.Context, userID uuid.UUID, reason string) (AIPauseState, error) {
+	return p.set(ctx, AIPauseState{Paused: true, Reason: strings.TrimSpace(reason), ChangedBy: &userID})
+}
+
+// Resume lets AI work run again, starting the work that was held
+func (p *AIPause) Resume(ctx context.Context, userID uuid.UUID) (AIPauseState, error) {
+	return p.set(ctx, AIPauseState{Paused: false, ChangedBy: &userID})
+}
+
+// Wait blocks while AI is paused. It returns nil once AI runs, or the
+// context's error if it is done first.
+func (p *AIPause) Wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// set stores the state, then switches to it
+func (p *AIPause) set(ctx context.Context, state AIPauseState) (AIPauseState, error) {
+	now := time.Now()
+	state.ChangedAt = &now
+	value, err := json.Marshal(state)
+	if err != nil {
+		return p.State(), err
+	}
+
+	setting := models.AISetting{Key: aiSettingPause, Value: value}
+	if err := p.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&setting).Error; err != nil {
+		return p.State(), err
+	}
+
+	if state.Paused {
+		log.Printf("AI processing paused by %s: %s", state.ChangedBy, state.Reason)
+	} else {
+		log.Printf("AI processing resumed by %s", state.ChangedBy)
+	}
+	p.apply(state)
+	return state, nil
+}
+
+// apply switches to the state, releasing the waiters when AI resumes
+func (p *AIPause) apply(state AIPauseState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case state.Paused && !p.state.Paused:
+		p.resumed = make(chan struct{})
+	case !state.Paused && p.state.Paused:
+		close(p.resumed)
+	}
+	p.state = state
+}
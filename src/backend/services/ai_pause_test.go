@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	aiPauseQuery  = `SELECT \* FROM "ai_settings" WHERE key = \$1`
+	aiPauseUpsert = `INSERT INTO "ai_settings" .* ON CONFLICT \("key"\) DO UPDATE SET "value"="excluded"."value","updated_at"="excluded"."updated_at"`
+)
+
+// pauseAIForTest installs a paused switch as AIPauseInstance for the test
+func pauseAIForTest(t *testing.T) *AIPause {
+	p := &AIPause{resumed: make(chan struct{})}
+	close(p.resumed)
+	p.apply(AIPauseState{Paused: true, Reason: "test"})
+
+	previous := AIPauseInstance
+	AIPauseInstance = p
+	t.Cleanup(func() { AIPauseInstance = previous })
+	return p
+}
+
+func TestAIPause_PauseIsStoredAndResumeReleasesWaiters(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	mock.ExpectQuery(aiPauseQuery).WithArgs(aiSettingPause, 1).WillReturnRows(sqlmock.NewRows([]string{"key"}))
+	p := NewAIPause(db.DB)
+	assert.False(t, p.Paused())
+	assert.NoError(t, p.Wait(context.Background()), "nothing is held while AI runs")
+
+	adminID := uuid.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(aiPauseUpsert).
+		WithArgs(aiSettingPause, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(time.Now()))
+	mock.ExpectCommit()
+	state, err := p.Pause(context.Background(), adminID, " Anthropic outage ")
+	require.NoError(t, err)
+	assert.True(t, state.Paused)
+	assert.Equal(t, "Anthropic outage", state.Reason)
+	assert.Equal(t, adminID, *state.ChangedBy)
+	assert.True(t, p.Paused())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.Wait(ctx), context.DeadlineExceeded, "work is held while paused")
+
+	released := make(chan error, 1)
+	go func() { released <- p.Wait(context.Background()) }()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(aiPauseUpsert).
+		WithArgs(aiSettingPause, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(time.Now()))
+	mock.ExpectCommit()
+	state, err = p.Resume(context.Background(), adminID)
+	require.NoError(t, err)
+	assert.False(t, state.Paused)
+	assert.False(t, p.Paused())
+
+	select {
+	case err := <-released:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("held work was not released on resume")
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNewAIPause_RestoresStoredPause(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	mock.ExpectQuery(aiPauseQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "value"}).
+			AddRow(aiSettingPause, []byte(`{"paused":true,"reason":"cost spike"}`)))
+
+	p := NewAIPause(db.DB)
+	assert.True(t, p.Paused())
+	assert.Equal(t, "cost spike", p.State().Reason)
+}
+
+func TestAIPause_ModelCallsFailWithoutReachingTheProvider(t *testing.T) {
+	pauseAIForTest(t)
+	ai, prompt := newStubAIService(t, "answer")
+
+	_, err := ai.callAnthropic(context.Background(), "Summarize this", 100)
+	assert.ErrorIs(t, err, ErrAIPaused)
+	assert.ErrorIs(t, err, ErrAIUnavailable, "paused AI degrades like an outage")
+	assert.Empty(t, *prompt)
+	assert.False(t, ai.Available(context.Background()))
+}
+
+func TestAIPause_SchedulerLeavesDueChainsForLater(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	pauseAIForTest(t)
+
+	// No schedule is loaded, so next_run is left as it is
+	NewChainScheduler(db.DB, nil).RunDue()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAIPause_BulkJobsHoldAndNewOnesAreRejected(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	p := pauseAIForTest(t)
+
+	s := newTestBulkJobService(db, bulkJobHandler{usesAI: true})
+	_, err := s.StartJob("test", uuid.New(), nil)
+	assert.ErrorIs(t, err, ErrAIPaused)
+
+	// A resumed job waits before its next batch until AI runs again
+	job := &models.BulkJob{ID: uuid.New(), Type: "test", Status: models.BulkJobRunning}
+	done := make(chan struct{}, 1)
+	go func() {
+		s.runJob(context.Background(), job)
+		done <- struct{}{}
+	}()
+	select {
+	case <-done:
+		t.Fatal("job ran while AI was paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	require.NoError(t, mock.ExpectationsWereMet(), "no notes are loaded while paused")
+
+	mock.ExpectQuery(`SELECT \* FROM "notes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(jobUpdate).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	p.apply(AIPauseState{Paused: false})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job did not continue after resume")
+	}
+	assert.Equal(t, models.BulkJobCompleted, job.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAIPause_AutoEnhancerHoldsQueuedNotes(t *testing.T) {
+	p := pauseAIForTest(t)
+
+	var processed atomic.Int32
+	enhancer := newAutoEnhancer(nil, func(ctx context.Context, noteID uuid.UUID) error {
+		processed.Add(1)
+		return nil
+	})
+	enhancer.Start()
+	defer enhancer.Stop()
+
+	noteID := uuid.New()
+	require.True(t, enhancer.enqueue(noteID))
+	time.Sleep(20 * time.Millisecond)
+	assert.Zero(t, processed.Load(), "queued note waits while paused")
+	assert.False(t, enhancer.enqueue(noteID), "an edit while held doesn't queue the note again")
+
+	p.apply(AIPauseState{Paused: false})
+	assert.Eventually(t, func() bool { return processed.Load() == 1 }, time.Second, 5*time.Millisecond)
+}
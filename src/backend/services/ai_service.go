@@ -4,16 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/prompts"
 
 	"github.com/google/uuid"
 	"github.com/lib/pq"
@@ -23,17 +27,28 @@ import (
 
 // Constants for ChromaDB collection
 const (
-	NoteEmbeddingsCollection = "note_embeddings"
+	NoteEmbeddingsCollection = "note_embeddings" // default of CHROMA_COLLECTION
 	MaxDocumentLength       = 8000 // ChromaDB's default max length
 )
 
+// AIServiceInstance is the shared AI service used by core routes; nil when not configured
+var AIServiceInstance *AIService
+
 type AIService struct {
 	db                *gorm.DB
 	anthropicKey      string
 	anthropicModel    string
+	anthropicBaseURL  string
+	health            aiHealth
 	chromaService     *ChromaService
+	chromaCollection  string
 	httpClient        *http.Client
 	perplexicaService *PerplexicaService
+	callLogger        *AICallLogger
+	relatedNotesLimit int
+	relatedNotesMode  RelatedNotesMode
+	relatedNotes      *RelatedNotesQueue
+	space             atomic.Value // Distance space of the note collection
 }
 
 type AnthropicRequest struct {
@@ -67,14 +82,32 @@ func NewAIService(db *gorm.DB) *AIService {
 	chromaBaseURL := os.Getenv("CHROMA_BASE_URL")
 	chromaService := NewChromaService(chromaBaseURL, db)
 	
+	// Checked at startup, so only invalid when the environment changed since
+	chromaCollection, err := chromaCollectionName()
+	if err != nil {
+		log.Printf("Ignoring %v, using %s", err, NoteEmbeddingsCollection)
+		chromaCollection = NoteEmbeddingsCollection
+	}
+
 	service := &AIService{
 		db:                db,
 		anthropicKey:      anthropicKey,
 		anthropicModel:    anthropicModel,
+		anthropicBaseURL:  anthropicBaseURLFromEnv(),
+		health:            aiHealth{ttl: aiHealthTTLFromEnv()},
 		chromaService:     chromaService,
+		chromaCollection:  chromaCollection,
 		httpClient:        &http.Client{Timeout: 120 * time.Second}, // AI reasoning requests with 10 steps can take 1-2 minutes
 		perplexicaService: NewPerplexicaService(),
-	}
+		callLogger:        NewAICallLogger(db),
+		relatedNotesLimit: relatedNotesLimitFromEnv(),
+		relatedNotesMode:  relatedNotesModeFromEnv(),
+	}
+	service.relatedNotes = NewRelatedNotesQueue(relatedNotesConcurrency(), relatedNotesBatchSize(),
+		func(ctx context.Context, noteIDs []uuid.UUID) error {
+			_, err := service.refreshRelatedNotesBatch(ctx, noteIDs)
+			return err
+		})
 	
 	// Initialize ChromaDB collection
 	ctx := context.Background()
@@ -89,158 +122,181 @@ func NewAIService(db *gorm.DB) *AIService {
 
 // initializeChromaCollection ensures the note embeddings collection exists
 func (ai *AIService) initializeChromaCollection(ctx context.Context) error {
-	// Configuration for optimal note search
-	config := &ChromaConfiguration{
-		HNSW: &HNSWConfig{
-			Space:          "cosine", // Cosine similarity works well for text
-			EFConstruction: 200,      // Higher for better quality
-			EFSearch:       100,      // Good balance of speed and accuracy
-			MaxNeighbors:   32,       // More connections for better recall
-		},
+	// Older servers only speak the v1 API, pick the matching endpoints first
+	if _, err := ai.chromaService.DetectAPIVersion(ctx); err != nil {
+		log.Printf("Warning: %v, assuming API %s", err, ai.chromaService.APIVersion())
 	}
 	
-	return ai.chromaService.GetOrCreateCollection(ctx, NoteEmbeddingsCollection, config)
+	hnsw := ai.HNSWConfig(ctx)
+	ai.space.Store(hnsw.Space)
+	return ai.chromaService.GetOrCreateCollection(ctx, ai.noteCollection(), &ChromaConfiguration{HNSW: &hnsw})
 }
 
-// ProcessNoteWithAI enhances a note with AI-generated metadata
-func (ai *AIService) ProcessNoteWithAI(ctx context.Context, noteID uuid.UUID) error {
-	// Get the note
-	var note models.Note
-	if err := ai.db.WithContext(ctx).First(&note, noteID).Error; err != nil {
-		return fmt.Errorf("failed to find note: %w", err)
+// collectionSpace is the distance space search results are measured in: the
+// one the note collection was set up with, or the configured default before
+// that
+func (ai *AIService) collectionSpace() string {
+	if space, ok := ai.space.Load().(string); ok {
+		return space
+	}
+	config, err := defaultHNSWConfig()
+	if err != nil {
+		return builtinHNSWConfig.Space
 	}
+	return config.Space
+}
 
-	// Get note content (combine title and blocks content)
-	content := ai.extractNoteContent(&note)
+// ProcessNoteWithAI enhances a note with AI-generated metadata. Enhancements
+// that fail are recorded on the enhanced note, whose status is then partial,
+// or failed when none succeeded.
+func (ai *AIService) ProcessNoteWithAI(ctx context.Context, noteID uuid.UUID) error {
+	return ai.processNote(ctx, noteID, nil)
+}
 
-	// Generate AI enhancements concurrently
-	titleChan := make(chan string, 1)
-	summaryChan := make(chan string, 1)
-	tagsChan := make(chan []string, 1)
-	actionStepsChan := make(chan []string, 1)
-	learningItemsChan := make(chan []string, 1)
-	errChan := make(chan error, 5)
+// RetryFailedEnhancements runs again the enhancements of the user's note that
+// failed when it was last processed, or only the given ones of them, and
+// returns the updated enhanced note
+func (ai *AIService) RetryFailedEnhancements(ctx context.Context, noteID, userID uuid.UUID, enhancements []string) (*models.AIEnhancedNote, error) {
+	previous, err := ai.GetEnhancedNote(ctx, noteID, userID)
+	if err != nil {
+		return nil, err
+	}
 
-	// Generate title if empty
-	go func() {
-		if note.Title == "" {
-			title, err := ai.generateTitle(ctx, content)
-			if err != nil {
-				errChan <- err
-				return
+	failed := previous.ProcessingErrors.Enhancements()
+	retry := failed
+	if len(enhancements) > 0 {
+		retry = nil
+		for _, enhancement := range enhancements {
+			if !slices.Contains(failed, enhancement) {
+				return nil, fmt.Errorf("%w: %s did not fail", ErrInvalidInput, enhancement)
+			}
+			if !slices.Contains(retry, enhancement) {
+				retry = append(retry, enhancement)
 			}
-			titleChan <- title
-		} else {
-			titleChan <- note.Title
 		}
-	}()
+	}
+	if len(retry) == 0 {
+		return nil, fmt.Errorf("%w: no failed enhancements to retry", ErrInvalidInput)
+	}
 
-	// Generate summary
-	go func() {
-		summary, err := ai.generateSummary(ctx, content, note.Title)
-		if err != nil {
-			errChan <- err
-			return
-		}
-		summaryChan <- summary
-	}()
+	if err := ai.processNote(ctx, noteID, &enhancementRetry{previous: previous, enhancements: retry}); err != nil {
+		return nil, err
+	}
+	return ai.GetEnhancedNote(ctx, noteID, userID)
+}
 
-	// Extract tags
-	go func() {
-		tags, err := ai.extractTags(ctx, content, note.Title)
-		if err != nil {
-			errChan <- err
-			return
-		}
-		tagsChan <- tags
-	}()
+// enhancementRetry is a processing run of only some failed enhancements
+type enhancementRetry struct {
+	previous     *models.AIEnhancedNote
+	enhancements []string
+}
 
-	// Generate actionable steps
-	go func() {
-		steps, err := ai.extractActionableSteps(ctx, content, note.Title)
-		if err != nil {
-			errChan <- err
-			return
-		}
-		actionStepsChan <- steps
-	}()
+// processNote generates the note's enhancements, all those enabled in its
+// settings or, for a retry, only the retried ones, and stores them
+func (ai *AIService) processNote(ctx context.Context, noteID uuid.UUID, retry *enhancementRetry) error {
+	// Get the note
+	var note models.Note
+	if err := ai.db.WithContext(ctx).First(&note, noteID).Error; err != nil {
+		return fmt.Errorf("failed to find note: %w", err)
+	}
+	ctx = WithAICallUser(ctx, note.UserID)
 
-	// Generate learning items
-	go func() {
-		items, err := ai.extractLearningItems(ctx, content, note.Title)
-		if err != nil {
-			errChan <- err
-			return
-		}
-		learningItemsChan <- items
-	}()
+	// The notebook and note settings pick the enhancements
+	settings := resolveNoteAISettings(ai.db.WithContext(ctx), &note)
+	run := settings.Enabled
+	if retry != nil {
+		run = func(enhancement string) bool { return slices.Contains(retry.enhancements, enhancement) }
+	}
 
-	// Collect results
-	var finalTitle string
-	var summary string
-	var aiTags []string
-	var actionSteps []string
-	var learningItems []string
-	
-	completed := 0
-	errors := 0
+	// Get note content (combine title and blocks content)
+	content := ai.extractNoteContent(&note)
+	language := ai.noteLanguage(ctx, &note, content)
 
-	for completed < 5 {
-		select {
-		case title := <-titleChan:
-			finalTitle = title
-			completed++
-		case s := <-summaryChan:
-			summary = s
-			completed++
-		case tags := <-tagsChan:
-			aiTags = tags
-			completed++
-		case steps := <-actionStepsChan:
-			actionSteps = steps
-			completed++
-		case items := <-learningItemsChan:
-			learningItems = items
-			completed++
-		case err := <-errChan:
-			log.Printf("AI processing error: %v", err)
-			errors++
-			completed++ // Count error as completed to avoid infinite loop
-		case <-ctx.Done():
-			return ctx.Err()
+	results, err := ai.generateEnhancements(ctx, &note, content, language, settings, run)
+	if err != nil {
+		return err
+	}
+
+	// A retry keeps the errors of the enhancements it didn't run
+	failures := results.failures
+	succeeded := len(results.succeeded) > 0
+	if retry != nil {
+		for _, previous := range retry.previous.ProcessingErrors {
+			if !slices.Contains(retry.enhancements, previous.Enhancement) {
+				failures = append(failures, previous)
+			}
 		}
+		succeeded = succeeded || retry.previous.ProcessingStatus != models.ProcessingFailed
 	}
 
 	// Save AI enhancements to database
 	enhancedNote := models.AIEnhancedNote{
 		NoteID:           note.ID,
-		Summary:          summary,
-		AITags:           pq.StringArray(aiTags),
-		ActionSteps:      pq.StringArray(actionSteps),
-		LearningItems:    pq.StringArray(learningItems),
-		ProcessingStatus: "completed",
+		Summary:          results.summary,
+		AITags:           pq.StringArray(results.tags),
+		ActionSteps:      pq.StringArray(results.actionSteps),
+		LearningItems:    pq.StringArray(results.learningItems),
+		ProcessingStatus: processingStatus(failures, succeeded),
+		ProcessingErrors: failures,
 		LastProcessedAt:  &[]time.Time{time.Now()}[0],
 		AIMetadata: models.AIMetadata{
-			"processing_errors": errors,
+			"processing_errors": len(failures),
 			"ai_model":         ai.anthropicModel,
+			"enhancements":     settings.Enhancements,
+			// How the summary was written, so clients render it the same way
+			"summary_length": settings.SummaryLength,
+			"summary_format": settings.SummaryFormat,
 		},
 	}
+	if retry != nil {
+		// The vector index gets the enhancements that were kept too
+		keep := func(enhancement string) bool { return !slices.Contains(results.succeeded, enhancement) }
+		if keep(models.EnhancementSummary) {
+			enhancedNote.Summary = retry.previous.Summary
+		}
+		if keep(models.EnhancementTags) {
+			enhancedNote.AITags = retry.previous.AITags
+		}
+		if keep(models.EnhancementActionSteps) {
+			enhancedNote.ActionSteps = retry.previous.ActionSteps
+		}
+		if keep(models.EnhancementLearningItems) {
+			enhancedNote.LearningItems = retry.previous.LearningItems
+		}
+	}
 
 	// Update the note title if it was empty
-	if note.Title == "" && finalTitle != "" {
-		note.Title = finalTitle
-		if err := ai.db.Save(&note).Error; err != nil {
-			log.Printf("Failed to update note title: %v", err)
+	if note.Title == "" && results.title != "" {
+		ai.applyGeneratedTitle(&note, results.title)
+	}
+
+	// Tasks are created before the enhancements are saved, so the changes
+	// they make count as processed and don't trigger auto-enhance again
+	if settings.AutoExtractTasks && len(results.actionSteps) > 0 {
+		if created, err := ai.createTasksFromActionSteps(ctx, &note, results.actionSteps); err != nil {
+			log.Printf("Failed to create tasks for note %s: %v", note.ID, err)
+		} else if created > 0 {
+			log.Printf("Created %d tasks from the action steps of note %s", created, note.ID)
+		}
+	}
+
+	// Enhancements that are turned off or failed keep their previous value
+	updateColumns := []string{"processing_status", "processing_errors", "last_processed_at", "ai_metadata", "updated_at"}
+	for _, enhancement := range []struct{ name, column string }{
+		{models.EnhancementSummary, "summary"},
+		{models.EnhancementTags, "ai_tags"},
+		{models.EnhancementActionSteps, "action_steps"},
+		{models.EnhancementLearningItems, "learning_items"},
+	} {
+		if slices.Contains(results.succeeded, enhancement.name) {
+			updateColumns = append(updateColumns, enhancement.column)
 		}
 	}
 
 	// Save enhanced note data (use Clauses for upsert behavior)
 	if err := ai.db.Clauses(clause.OnConflict{
-		Columns: []clause.Column{{Name: "note_id"}},
-		DoUpdates: clause.AssignmentColumns([]string{
-			"summary", "ai_tags", "action_steps", "learning_items", 
-			"processing_status", "last_processed_at", "ai_metadata", "updated_at",
-		}),
+		Columns:   []clause.Column{{Name: "note_id"}},
+		DoUpdates: clause.AssignmentColumns(updateColumns),
 	}).Create(&enhancedNote).Error; err != nil {
 		log.Printf("Failed to save AI enhancements: %v", err)
 		return fmt.Errorf("failed to save AI enhancements: %w", err)
@@ -254,26 +310,179 @@ func (ai *AIService) ProcessNoteWithAI(ctx context.Context, noteID uuid.UUID) er
 	}
 
 	// Find and store related notes
-	go func() {
-		if relatedNotes, err := ai.FindRelatedNotes(ctx, noteID, 5); err == nil && len(relatedNotes) > 0 {
-			relatedIDs := make([]uuid.UUID, 0, len(relatedNotes))
-			for _, rn := range relatedNotes {
-				if rn.ID != noteID { // Don't include self
-					relatedIDs = append(relatedIDs, rn.ID)
-				}
+	ai.queueRelatedNotes(noteID)
+
+	return nil
+}
+
+// processingStatus is completed without failures, partial when some
+// enhancements succeeded and failed otherwise
+func processingStatus(failures models.EnhancementErrors, succeeded bool) string {
+	switch {
+	case len(failures) == 0:
+		return models.ProcessingCompleted
+	case succeeded:
+		return models.ProcessingPartial
+	default:
+		return models.ProcessingFailed
+	}
+}
+
+// noteEnhancements are the results of a processing run
+type noteEnhancements struct {
+	title         string
+	summary       string
+	tags          []string
+	actionSteps   []string
+	learningItems []string
+	succeeded     []string // Enhancements generated
+	failures      models.EnhancementErrors
+}
+
+// enhancementFailure is an enhancement that could not be generated
+type enhancementFailure struct {
+	enhancement string
+	err         error
+}
+
+// generateEnhancements generates the enhancements run selects concurrently.
+// A title is only generated for an untitled note.
+func (ai *AIService) generateEnhancements(ctx context.Context, note *models.Note, content, language string, settings EffectiveAISettings, run func(string) bool) (*noteEnhancements, error) {
+	// Generate AI enhancements concurrently
+	titleChan := make(chan string, 1)
+	summaryChan := make(chan string, 1)
+	tagsChan := make(chan []string, 1)
+	actionStepsChan := make(chan []string, 1)
+	learningItemsChan := make(chan []string, 1)
+	errChan := make(chan enhancementFailure, 5)
+	started := 0
+
+	// Generate title if empty
+	if note.Title == "" && run(models.EnhancementTitle) {
+		started++
+		go func() {
+			title, err := ai.generateTitle(ctx, content, language)
+			if err != nil {
+				errChan <- enhancementFailure{models.EnhancementTitle, err}
+				return
 			}
-			
-			if len(relatedIDs) > 0 {
-				ai.db.Model(&enhancedNote).Update("related_note_ids", relatedIDs)
+			titleChan <- title
+		}()
+	}
+
+	// Generate summary
+	if run(models.EnhancementSummary) {
+		started++
+		go func() {
+			summary, err := ai.generateSummary(ctx, content, note.Title, language, settings.summaryStyle())
+			if err != nil {
+				errChan <- enhancementFailure{models.EnhancementSummary, err}
+				return
+			}
+			summaryChan <- summary
+		}()
+	}
+
+	// Extract tags
+	if run(models.EnhancementTags) {
+		started++
+		go func() {
+			tags, err := ai.extractTags(ctx, content, note.Title, language)
+			if err != nil {
+				errChan <- enhancementFailure{models.EnhancementTags, err}
+				return
 			}
+			tagsChan <- tags
+		}()
+	}
+
+	// Generate actionable steps
+	if run(models.EnhancementActionSteps) {
+		started++
+		go func() {
+			steps, err := ai.extractActionableSteps(ctx, content, note.Title)
+			if err != nil {
+				errChan <- enhancementFailure{models.EnhancementActionSteps, err}
+				return
+			}
+			actionStepsChan <- steps
+		}()
+	}
+
+	// Generate learning items
+	if run(models.EnhancementLearningItems) {
+		started++
+		go func() {
+			items, err := ai.extractLearningItems(ctx, content, note.Title)
+			if err != nil {
+				errChan <- enhancementFailure{models.EnhancementLearningItems, err}
+				return
+			}
+			learningItemsChan <- items
+		}()
+	}
+
+	// Collect results
+	results := &noteEnhancements{}
+	for completed := 0; completed < started; completed++ {
+		select {
+		case title := <-titleChan:
+			results.title = title
+			results.succeeded = append(results.succeeded, models.EnhancementTitle)
+		case s := <-summaryChan:
+			results.summary = s
+			results.succeeded = append(results.succeeded, models.EnhancementSummary)
+		case tags := <-tagsChan:
+			results.tags = tags
+			results.succeeded = append(results.succeeded, models.EnhancementTags)
+		case steps := <-actionStepsChan:
+			results.actionSteps = steps
+			results.succeeded = append(results.succeeded, models.EnhancementActionSteps)
+		case items := <-learningItemsChan:
+			results.learningItems = items
+			results.succeeded = append(results.succeeded, models.EnhancementLearningItems)
+		case failure := <-errChan:
+			log.Printf("AI processing error of %s for note %s: %v", failure.enhancement, note.ID, failure.err)
+			results.failures = append(results.failures, models.EnhancementError{
+				Enhancement: failure.enhancement,
+				Error:       failure.err.Error(),
+				FailedAt:    time.Now(),
+			})
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
-	}()
+	}
+	return results, nil
+}
 
-	return nil
+// applyGeneratedTitle sets an AI generated title on a note that has none.
+// Notes locked for editing are left alone so the user's input isn't clobbered.
+func (ai *AIService) applyGeneratedTitle(note *models.Note, title string) bool {
+	if IsNoteLocked(ai.db, note.ID) {
+		log.Printf("Note %s is locked for editing, skipping AI title update", note.ID)
+		return false
+	}
+
+	// Only fill the title if it is still empty, the user may have typed one meanwhile
+	result := ai.db.Model(&models.Note{}).Where("id = ? AND title = ''", note.ID).Update("title", title)
+	if result.Error != nil {
+		log.Printf("Failed to update note title: %v", result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+	note.Title = title
+	return true
 }
 
 // addNoteToChroma adds or updates a note in the ChromaDB collection
 func (ai *AIService) AddNoteToChroma(ctx context.Context, note *models.Note, enhanced *models.AIEnhancedNote) error {
+	// A re-embedding still waiting for edits to settle is superseded
+	if ChromaNoteSyncerInstance != nil {
+		ChromaNoteSyncerInstance.Cancel(note.ID)
+	}
+
 	// Prepare document text
 	var docBuilder strings.Builder
 	docBuilder.WriteString(note.Title)
@@ -291,10 +500,7 @@ func (ai *AIService) AddNoteToChroma(ctx context.Context, note *models.Note, enh
 	docBuilder.WriteString(content)
 	
 	// Truncate if too long
-	document := docBuilder.String()
-	if len(document) > MaxDocumentLength {
-		document = document[:MaxDocumentLength]
-	}
+	document := fitChromaDocument(docBuilder.String())
 	
 	// Prepare metadata
 	metadata := map[string]interface{}{
@@ -309,6 +515,10 @@ func (ai *AIService) AddNoteToChroma(ctx context.Context, note *models.Note, enh
 		metadata["notebook_id"] = note.NotebookID.String()
 	}
 	
+	if len(note.Tags) > 0 {
+		metadata["tags"] = strings.Join(note.Tags, ",")
+	}
+	
 	if enhanced != nil {
 		if len(enhanced.AITags) > 0 {
 			metadata["ai_tags"] = strings.Join(enhanced.AITags, ",")
@@ -323,8 +533,8 @@ func (ai *AIService) AddNoteToChroma(ctx context.Context, note *models.Note, enh
 	documents := []string{document}
 	metadatas := []map[string]interface{}{metadata}
 	
-	log.Printf("Adding note %s to ChromaDB collection %s", note.ID, NoteEmbeddingsCollection)
-	if err := ai.chromaService.UpsertDocuments(ctx, NoteEmbeddingsCollection, ids, documents, metadatas); err != nil {
+	log.Printf("Adding note %s to ChromaDB collection %s", note.ID, ai.noteCollection())
+	if err := ai.chromaService.UpsertDocuments(ctx, ai.noteCollection(), ids, documents, metadatas); err != nil {
 		log.Printf("Failed to add note to ChromaDB: %v", err)
 		return err
 	}
@@ -335,6 +545,23 @@ func (ai *AIService) AddNoteToChroma(ctx context.Context, note *models.Note, enh
 
 // findRelatedNotes finds notes similar to the given note using vector search
 func (ai *AIService) FindRelatedNotes(ctx context.Context, noteID uuid.UUID, limit int) ([]models.Note, error) {
+	ranking := RelevanceRanking
+	ranking.MinSimilarity = DefaultMinSimilarity()
+	scored, err := ai.FindRankedRelatedNotes(ctx, noteID, limit, ranking)
+	if err != nil {
+		return nil, err
+	}
+	notes := make([]models.Note, 0, len(scored))
+	for _, result := range scored {
+		notes = append(notes, result.Note)
+	}
+	return notes, nil
+}
+
+// FindRankedRelatedNotes finds notes similar to the given note, ordered by
+// ranking, with the score of each. Matches below the ranking's minimum
+// similarity are left out, so fewer than limit notes may come back.
+func (ai *AIService) FindRankedRelatedNotes(ctx context.Context, noteID uuid.UUID, limit int, ranking SearchRanking) ([]ScoredNote, error) {
 	// Query ChromaDB for similar notes
 	queryTexts := []string{}
 	
@@ -345,14 +572,7 @@ func (ai *AIService) FindRelatedNotes(ctx context.Context, noteID uuid.UUID, lim
 	}
 	
 	// Use title and first part of content as query
-	queryText := note.Title
-	content := ai.extractNoteContent(&note)
-	if len(content) > 500 {
-		queryText += " " + content[:500]
-	} else {
-		queryText += " " + content
-	}
-	queryTexts = append(queryTexts, queryText)
+	queryTexts = append(queryTexts, relatedNotesQuery(&note, ai.extractNotePlainText(&note)))
 	
 	// Exclude the current note from results
 	where := map[string]interface{}{
@@ -362,99 +582,177 @@ func (ai *AIService) FindRelatedNotes(ctx context.Context, noteID uuid.UUID, lim
 	}
 	
 	// Query ChromaDB
-	results, err := ai.chromaService.QueryByText(ctx, NoteEmbeddingsCollection, queryTexts, limit+1, where)
+	results, err := ai.chromaService.QueryByText(ctx, ai.noteCollection(), queryTexts, ranking.candidates(limit)+1, where)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query ChromaDB: %w", err)
 	}
 	
-	// Convert results to notes
-	var relatedNotes []models.Note
-	if len(results.IDs) > 0 && len(results.IDs[0]) > 0 {
-		for i, chromaID := range results.IDs[0] {
-			if i >= limit {
-				break
-			}
-			
-			noteID, err := ChromaIDToNoteID(chromaID)
-			if err != nil {
-				log.Printf("Invalid ChromaDB ID: %s", chromaID)
-				continue
-			}
-			
-			var relatedNote models.Note
-			if err := ai.db.First(&relatedNote, noteID).Error; err == nil {
-				relatedNotes = append(relatedNotes, relatedNote)
-			}
+	// Convert results to notes, skipping the note itself and repeated matches
+	relatedNotes := []ScoredNote{}
+	for _, hit := range rankHits(searchHits(results, ai.collectionSpace()), ranking, time.Now()) {
+		if len(relatedNotes) >= limit {
+			break
+		}
+		if hit.NoteID == noteID {
+			continue
+		}
+		
+		var relatedNote models.Note
+		if err := ai.db.First(&relatedNote, hit.NoteID).Error; err == nil {
+			relatedNotes = append(relatedNotes, ScoredNote{Note: relatedNote, Similarity: hit.Similarity, Score: hit.Score})
 		}
 	}
 	
 	return relatedNotes, nil
 }
 
-// SearchNotesByEmbedding performs semantic search across all notes
-func (ai *AIService) SearchNotesByEmbedding(ctx context.Context, query string, userID uuid.UUID, limit int) ([]models.AIEnhancedNote, error) {
+// GetEnhancedNote returns the AI enhancement of a note with the note
+// preloaded. Enhancements have no owner of their own, so ownership is checked
+// on the note. Returns ErrNoteNotFound when the note isn't the user's, is in
+// the trash or has not been enhanced.
+func (ai *AIService) GetEnhancedNote(ctx context.Context, noteID, userID uuid.UUID) (*models.AIEnhancedNote, error) {
+	var aiNote models.AIEnhancedNote
+	err := ai.db.WithContext(ctx).Preload("Note").
+		Joins("JOIN notes ON notes.id = ai_enhanced_notes.note_id AND notes.deleted_at IS NULL").
+		Where("ai_enhanced_notes.note_id = ? AND notes.user_id = ?", noteID, userID).
+		First(&aiNote).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &aiNote, nil
+}
+
+// SearchNotesByEmbedding performs semantic search across all notes, ordered
+// by ranking and without the matches below its minimum similarity. Each
+// result's AI metadata holds its relevance_score (the similarity) and the
+// score it was ranked by. With fewer matches than limit, backfill fills up
+// the results after the matches (see backfillSearch).
+func (ai *AIService) SearchNotesByEmbedding(ctx context.Context, query string, userID uuid.UUID, limit int, ranking SearchRanking, backfill SearchBackfill) ([]models.AIEnhancedNote, error) {
 	// Filter by user ID
 	where := map[string]interface{}{
 		"user_id": userID.String(),
 	}
 	
 	// Query ChromaDB
-	results, err := ai.chromaService.QueryByText(ctx, NoteEmbeddingsCollection, []string{query}, limit, where)
+	results, err := ai.chromaService.QueryByText(ctx, ai.noteCollection(), []string{query}, ranking.candidates(limit), where)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search notes: %w", err)
 	}
 	
 	// Convert results to enhanced notes
 	var enhancedNotes []models.AIEnhancedNote
-	if len(results.IDs) > 0 && len(results.IDs[0]) > 0 {
-		for i, chromaID := range results.IDs[0] {
-			noteID, err := ChromaIDToNoteID(chromaID)
-			if err != nil {
-				continue
-			}
-			
-			var enhancedNote models.AIEnhancedNote
-			if err := ai.db.Where("note_id = ?", noteID).First(&enhancedNote).Error; err == nil {
-				// Add relevance score from distance
-				if len(results.Distances) > 0 && len(results.Distances[0]) > i {
-					distance := results.Distances[0][i]
-					enhancedNote.AIMetadata["relevance_score"] = 1.0 - distance // Convert distance to similarity
-				}
-				enhancedNotes = append(enhancedNotes, enhancedNote)
+	for _, hit := range rankHits(searchHits(results, ai.collectionSpace()), ranking, time.Now()) {
+		if len(enhancedNotes) >= limit {
+			break
+		}
+		
+		// The Chroma filter alone could return stale documents of notes
+		// that changed owner or were deleted
+		enhancedNote, err := ai.GetEnhancedNote(ctx, hit.NoteID, userID)
+		if err == nil {
+			if enhancedNote.AIMetadata == nil {
+				enhancedNote.AIMetadata = models.AIMetadata{}
 			}
+			enhancedNote.AIMetadata["relevance_score"] = hit.Similarity
+			enhancedNote.AIMetadata["score"] = hit.Score
+			enhancedNotes = append(enhancedNotes, *enhancedNote)
 		}
 	}
 	
-	return enhancedNotes, nil
+	supplemental, err := ai.backfillSearch(ctx, userID, query, backfill, enhancedNotes, limit-len(enhancedNotes))
+	if err != nil {
+		return nil, err
+	}
+	return append(enhancedNotes, supplemental...), nil
 }
 
 // RemoveNoteFromChroma removes a note from the ChromaDB collection
 func (ai *AIService) RemoveNoteFromChroma(ctx context.Context, noteID uuid.UUID) error {
+	if ChromaNoteSyncerInstance != nil {
+		ChromaNoteSyncerInstance.Cancel(noteID)
+	}
+	return ai.removeNoteFromChroma(ctx, noteID)
+}
+
+func (ai *AIService) removeNoteFromChroma(ctx context.Context, noteID uuid.UUID) error {
 	ids := []string{NoteIDToChromaID(noteID)}
-	return ai.chromaService.DeleteDocuments(ctx, NoteEmbeddingsCollection, ids)
+	return ai.chromaService.DeleteDocuments(ctx, ai.noteCollection(), ids)
+}
+
+// SyncMergedNoteToChroma removes merged source notes from ChromaDB and re-upserts the target
+func (ai *AIService) SyncMergedNoteToChroma(ctx context.Context, targetID uuid.UUID, sourceIDs []uuid.UUID) error {
+	for _, sourceID := range sourceIDs {
+		if err := ai.RemoveNoteFromChroma(ctx, sourceID); err != nil {
+			log.Printf("Failed to remove merged note %s from ChromaDB: %v", sourceID, err)
+		}
+	}
+
+	var note models.Note
+	if err := ai.db.Preload("Blocks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("\"blocks\".\"order\" ASC")
+	}).First(&note, "id = ?", targetID).Error; err != nil {
+		return fmt.Errorf("failed to load merged note: %w", err)
+	}
+
+	var enhanced models.AIEnhancedNote
+	if err := ai.db.Where("note_id = ?", targetID).First(&enhanced).Error; err != nil {
+		return ai.AddNoteToChroma(ctx, &note, nil)
+	}
+	return ai.AddNoteToChroma(ctx, &note, &enhanced)
+}
+
+// RefreshNotesInChroma re-upserts notes whose metadata changed, e.g. after a
+// tag rename. Trashed notes are skipped.
+func (ai *AIService) RefreshNotesInChroma(ctx context.Context, noteIDs []uuid.UUID) error {
+	if len(noteIDs) == 0 {
+		return nil
+	}
+	
+	var notes []models.Note
+	if err := ai.db.WithContext(ctx).Scopes(models.NotTrashed).
+		Preload("Blocks", func(db *gorm.DB) *gorm.DB {
+			return db.Scopes(models.NotTrashed).Order("\"blocks\".\"order\" ASC")
+		}).
+		Where("id IN ?", noteIDs).Find(&notes).Error; err != nil {
+		return fmt.Errorf("failed to load notes: %w", err)
+	}
+	
+	batchSize := 100
+	for i := 0; i < len(notes); i += batchSize {
+		end := i + batchSize
+		if end > len(notes) {
+			end = len(notes)
+		}
+		notIndexed, err := ai.indexNotes(ctx, notes[i:end])
+		if err != nil {
+			return err
+		}
+		if len(notIndexed) > 0 {
+			return fmt.Errorf("ChromaDB rejected notes %v", notIndexed)
+		}
+	}
+	return nil
 }
 
 // RefreshChromaCollection rebuilds the entire ChromaDB collection from database
 func (ai *AIService) RefreshChromaCollection(ctx context.Context) error {
 	log.Println("Starting ChromaDB collection refresh...")
 	
-	// Delete and recreate the collection
-	if err := ai.chromaService.DeleteCollection(ctx, NoteEmbeddingsCollection); err != nil {
-		log.Printf("Failed to delete collection (may not exist): %v", err)
-	}
-	
-	// Reinitialize collection
-	if err := ai.initializeChromaCollection(ctx); err != nil {
-		return fmt.Errorf("failed to reinitialize collection: %w", err)
+	if err := ai.resetNoteCollection(ctx); err != nil {
+		return err
 	}
 	
-	// Get all notes with AI enhancements
-	var notes []models.Note
-	if err := ai.db.Find(&notes).Error; err != nil {
+	// Get all notes that are not in the trash
+	notes, err := ai.notesForReindex(ctx)
+	if err != nil {
 		return fmt.Errorf("failed to fetch notes: %w", err)
 	}
 	
 	// Batch process notes
+	var notIndexed []uuid.UUID
 	batchSize := 100
 	for i := 0; i < len(notes); i += batchSize {
 		end := i + batchSize
@@ -462,73 +760,123 @@ func (ai *AIService) RefreshChromaCollection(ctx context.Context) error {
 			end = len(notes)
 		}
 		
-		batch := notes[i:end]
-		ids := make([]string, 0, len(batch))
-		documents := make([]string, 0, len(batch))
-		metadatas := make([]map[string]interface{}, 0, len(batch))
-		
-		for _, note := range batch {
-			// Get enhanced data if exists
-			var enhanced models.AIEnhancedNote
-			ai.db.Where("note_id = ?", note.ID).First(&enhanced)
-			
-			// Prepare document
-			var docBuilder strings.Builder
-			docBuilder.WriteString(note.Title)
-			if enhanced.Summary != "" {
-				docBuilder.WriteString("\n\nSummary: ")
-				docBuilder.WriteString(enhanced.Summary)
-			}
-			docBuilder.WriteString("\n\n")
-			docBuilder.WriteString(ai.extractNoteContent(&note))
-			
-			document := docBuilder.String()
-			if len(document) > MaxDocumentLength {
-				document = document[:MaxDocumentLength]
-			}
-			
-			// Prepare metadata
-			metadata := map[string]interface{}{
-				"note_id":    note.ID.String(),
-				"title":      note.Title,
-				"created_at": note.CreatedAt.Format(time.RFC3339),
-				"updated_at": note.UpdatedAt.Format(time.RFC3339),
-				"user_id":    note.UserID.String(),
-			}
-			
-			if note.NotebookID != uuid.Nil {
-				metadata["notebook_id"] = note.NotebookID.String()
-			}
-			
-			ids = append(ids, NoteIDToChromaID(note.ID))
-			documents = append(documents, document)
-			metadatas = append(metadatas, metadata)
-		}
-		
-		// Add batch to ChromaDB
-		if err := ai.chromaService.AddDocuments(ctx, NoteEmbeddingsCollection, ids, documents, metadatas); err != nil {
+		batchNotIndexed, err := ai.indexNotes(ctx, notes[i:end])
+		if err != nil {
 			log.Printf("Failed to add batch %d-%d: %v", i, end, err)
 			// Continue with next batch
+			for _, note := range notes[i:end] {
+				batchNotIndexed = append(batchNotIndexed, note.ID)
+			}
 		}
+		notIndexed = append(notIndexed, batchNotIndexed...)
 		
 		log.Printf("Processed notes %d-%d of %d", i+1, end, len(notes))
 	}
 	
-	log.Printf("ChromaDB collection refresh completed. Processed %d notes.", len(notes))
+	if _, err := ai.PruneOrphanedChromaDocuments(ctx); err != nil {
+		log.Printf("Failed to prune orphaned ChromaDB documents: %v", err)
+	}
+	
+	if len(notIndexed) > 0 {
+		log.Printf("Notes not indexed in ChromaDB: %v", notIndexed)
+	}
+	log.Printf("ChromaDB collection refresh completed. Processed %d notes, %d not indexed.", len(notes), len(notIndexed))
+	return nil
+}
+
+// resetNoteCollection drops and recreates the note embeddings collection
+func (ai *AIService) resetNoteCollection(ctx context.Context) error {
+	if err := ai.chromaService.DeleteCollection(ctx, ai.noteCollection()); err != nil {
+		log.Printf("Failed to delete collection (may not exist): %v", err)
+	}
+	
+	if err := ai.initializeChromaCollection(ctx); err != nil {
+		return fmt.Errorf("failed to reinitialize collection: %w", err)
+	}
 	return nil
 }
 
+// indexNotes writes a batch of notes to ChromaDB in one request, or in
+// smaller ones when ChromaDB rejects some of the notes, and returns the notes
+// it rejected
+func (ai *AIService) indexNotes(ctx context.Context, notes []models.Note) ([]uuid.UUID, error) {
+	ids := make([]string, 0, len(notes))
+	documents := make([]string, 0, len(notes))
+	metadatas := make([]map[string]interface{}, 0, len(notes))
+	
+	for _, note := range notes {
+		// Get enhanced data if exists
+		var enhanced models.AIEnhancedNote
+		ai.db.Where("note_id = ?", note.ID).First(&enhanced)
+		
+		// Prepare document
+		var docBuilder strings.Builder
+		docBuilder.WriteString(note.Title)
+		if enhanced.Summary != "" {
+			docBuilder.WriteString("\n\nSummary: ")
+			docBuilder.WriteString(enhanced.Summary)
+		}
+		docBuilder.WriteString("\n\n")
+		docBuilder.WriteString(ai.extractNoteContent(&note))
+		
+		document := fitChromaDocument(docBuilder.String())
+		
+		// Prepare metadata
+		metadata := map[string]interface{}{
+			"note_id":    note.ID.String(),
+			"title":      note.Title,
+			"created_at": note.CreatedAt.Format(time.RFC3339),
+			"updated_at": note.UpdatedAt.Format(time.RFC3339),
+			"user_id":    note.UserID.String(),
+		}
+		
+		if note.NotebookID != uuid.Nil {
+			metadata["notebook_id"] = note.NotebookID.String()
+		}
+		
+		if len(note.Tags) > 0 {
+			metadata["tags"] = strings.Join(note.Tags, ",")
+		}
+		
+		ids = append(ids, NoteIDToChromaID(note.ID))
+		documents = append(documents, document)
+		metadatas = append(metadatas, metadata)
+	}
+	
+	// Upsert so a resumed reindex can redo a batch it had already sent
+	rejected, err := ai.chromaService.UpsertDocumentsIsolated(ctx, ai.noteCollection(), ids, documents, metadatas)
+	notIndexed := make([]uuid.UUID, 0, len(rejected))
+	for _, document := range rejected {
+		if noteID, err := ChromaIDToNoteID(document.ID); err == nil {
+			notIndexed = append(notIndexed, noteID)
+		}
+	}
+	return notIndexed, err
+}
+
+// notesForReindex loads every non-trashed note with its non-trashed blocks
+func (ai *AIService) notesForReindex(ctx context.Context) ([]models.Note, error) {
+	var notes []models.Note
+	err := ai.db.WithContext(ctx).Scopes(models.NotTrashed).
+		Preload("Blocks", func(db *gorm.DB) *gorm.DB {
+			return db.Scopes(models.NotTrashed).Order("\"blocks\".\"order\" ASC")
+		}).
+		Find(&notes).Error
+	return notes, err
+}
+
 // GetChromaCollectionStats returns statistics about the ChromaDB collection
 func (ai *AIService) GetChromaCollectionStats(ctx context.Context) (map[string]interface{}, error) {
-	count, err := ai.chromaService.CountDocuments(ctx, NoteEmbeddingsCollection)
+	count, err := ai.chromaService.CountDocuments(ctx, ai.noteCollection())
 	if err != nil {
 		return nil, err
 	}
 	
 	stats := map[string]interface{}{
-		"collection_name": NoteEmbeddingsCollection,
+		"collection_name": ai.noteCollection(),
 		"document_count":  count,
 		"embedding_model": "all-MiniLM-L6-v2", // ChromaDB default
+		"hnsw":            ai.HNSWConfig(ctx),
 		"last_updated":    time.Now().Format(time.RFC3339),
 	}
 	
@@ -538,24 +886,24 @@ func (ai *AIService) GetChromaCollectionStats(ctx context.Context) (map[string]i
 // The rest of the methods remain the same as in the original ai_service.go...
 // (Include all the other methods like generateTitle, generateSummary, extractTags, etc.)
 
-// extractNoteContent extracts the full content from a note including blocks
+// extractNoteContent extracts the full content from a note including blocks,
+// in the format set by AI_NOTE_CONTENT_FORMAT
 func (ai *AIService) extractNoteContent(note *models.Note) string {
+	return ai.extractNoteContentAs(note, noteContentFormat())
+}
+
+// extractNotePlainText extracts the block text only, for keyword-like uses
+// such as search queries
+func (ai *AIService) extractNotePlainText(note *models.Note) string {
+	return ai.extractNoteContentAs(note, NoteContentPlain)
+}
+
+func (ai *AIService) extractNoteContentAs(note *models.Note, format NoteContentFormat) string {
 	// Get blocks for this note
 	var blocks []models.Block
 	ai.db.Where("note_id = ?", note.ID).Order("\"order\"").Find(&blocks)
-	
-	var contentBuilder strings.Builder
-	for _, block := range blocks {
-		// Extract text content from the block
-		if textContent, exists := block.Content["text"]; exists {
-			if textStr, ok := textContent.(string); ok && strings.TrimSpace(textStr) != "" {
-				contentBuilder.WriteString(textStr)
-				contentBuilder.WriteString("\n")
-			}
-		}
-	}
-	
-	return strings.TrimSpace(contentBuilder.String())
+
+	return renderNoteBlocks(blocks, format)
 }
 
 // GenerateResponse calls Anthropic's Claude API to generate a response to a prompt
@@ -584,41 +932,7 @@ func (ai *AIService) GenerateResponse(ctx context.Context, prompt string, contex
 		Messages:  messages,
 	}
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("x-api-key", ai.anthropicKey)
-	httpReq.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := ai.httpClient.Do(httpReq)
-	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("anthropic API error %d: %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	var anthropicResp AnthropicResponse
-	if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if len(anthropicResp.Content) == 0 {
-		return "", fmt.Errorf("no content in response")
-	}
-
-	return anthropicResp.Content[0].Text, nil
+	return ai.sendAnthropicRequest(ctx, req)
 }
 
 // PerformWebSearch performs a web search using the Perplexica service
@@ -682,12 +996,35 @@ func (ai *AIService) callAnthropic(ctx context.Context, prompt string, maxTokens
 		Messages:  messages,
 	}
 
+	return ai.sendAnthropicRequest(ctx, req)
+}
+
+// sendAnthropicRequest posts a messages request and returns the first text block
+func (ai *AIService) sendAnthropicRequest(ctx context.Context, req AnthropicRequest) (response string, err error) {
+	if AIPauseInstance.Paused() {
+		return "", ErrAIPaused
+	}
+	if !ai.Available(ctx) {
+		return "", ErrAIUnavailable
+	}
+	release, err := acquireLLMSlot(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	if ai.callLogger.Enabled() {
+		start := time.Now()
+		defer func() {
+			ai.callLogger.Record(ctx, req.Model, renderAnthropicMessages(req.Messages), response, err, time.Since(start))
+		}()
+	}
+
 	jsonData, err := json.Marshal(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", ai.anthropicBaseURL+"/v1/messages", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -698,13 +1035,22 @@ func (ai *AIService) callAnthropic(ctx context.Context, prompt string, maxTokens
 
 	resp, err := ai.httpClient.Do(httpReq)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("failed to make request: %w", err)
+		}
+		ai.markUnavailable(err)
+		return "", fmt.Errorf("%w: %v", ErrAIUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("anthropic API error %d: %s", resp.StatusCode, string(bodyBytes))
+		apiErr := fmt.Errorf("anthropic API error %d: %s", resp.StatusCode, string(bodyBytes))
+		if providerDown(resp.StatusCode) {
+			ai.markUnavailable(apiErr)
+			return "", fmt.Errorf("%w: %v", ErrAIUnavailable, apiErr)
+		}
+		return "", apiErr
 	}
 
 	var anthropicResp AnthropicResponse
@@ -719,10 +1065,30 @@ func (ai *AIService) callAnthropic(ctx context.Context, prompt string, maxTokens
 	return anthropicResp.Content[0].Text, nil
 }
 
-// generateTitle generates an AI-powered title for note content
-func (ai *AIService) generateTitle(ctx context.Context, content string) (string, error) {
-	prompt := fmt.Sprintf("Generate a concise, descriptive title for this content. Return only the title, no additional text:\n\n%s", content)
-	
+// renderAnthropicMessages flattens request messages for the call log
+func renderAnthropicMessages(messages []Message) string {
+	if len(messages) == 1 {
+		return messages[0].Content
+	}
+	parts := make([]string, 0, len(messages))
+	for _, message := range messages {
+		parts = append(parts, fmt.Sprintf("[%s]\n%s", message.Role, message.Content))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// generateTitle generates an AI-powered title for note content, written in
+// language when one is given
+func (ai *AIService) generateTitle(ctx context.Context, content, language string) (string, error) {
+	ctx = withAICallFeature(ctx, prompts.Title, content)
+	prompt, err := prompts.Render(prompts.Title, map[string]interface{}{
+		"Content":  content,
+		"Language": language,
+	})
+	if err != nil {
+		return "", err
+	}
+
 	response, err := ai.GenerateResponse(ctx, prompt, nil)
 	if err != nil {
 		return "", err
@@ -731,22 +1097,43 @@ func (ai *AIService) generateTitle(ctx context.Context, content string) (string,
 	return strings.TrimSpace(response), nil
 }
 
-// generateSummary generates an AI-powered summary for note content
-func (ai *AIService) generateSummary(ctx context.Context, content, title string) (string, error) {
-	prompt := fmt.Sprintf("Create a concise summary of this content. Focus on key points and main ideas:\n\nTitle: %s\nContent: %s", title, content)
-	
-	response, err := ai.GenerateResponse(ctx, prompt, nil)
+// generateSummary generates an AI-powered summary for note content in the
+// length and format of style, written in language when one is given
+func (ai *AIService) generateSummary(ctx context.Context, content, title, language string, style SummaryStyle) (string, error) {
+	style = style.withDefaults()
+	ctx = withAICallFeature(ctx, prompts.Summary, title, content)
+	prompt, err := prompts.Render(prompts.Summary, map[string]interface{}{
+		"Title":    title,
+		"Content":  content,
+		"Language": language,
+		"Words":    summaryWords[style.Length],
+		"Bullets":  style.Format == models.SummaryBullets,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	response, err := ai.callAnthropic(ctx, prompt, style.MaxTokens())
 	if err != nil {
 		return "", err
 	}
 	
-	return strings.TrimSpace(response), nil
+	return style.formatSummary(response), nil
 }
 
-// extractTags extracts relevant tags from note content
-func (ai *AIService) extractTags(ctx context.Context, content, title string) ([]string, error) {
-	prompt := fmt.Sprintf("Extract 3-5 relevant tags for this content. Return as a comma-separated list:\n\nTitle: %s\nContent: %s", title, content)
-	
+// extractTags extracts relevant tags from note content, written in language
+// when one is given
+func (ai *AIService) extractTags(ctx context.Context, content, title, language string) ([]string, error) {
+	ctx = withAICallFeature(ctx, prompts.Tags, title, content)
+	prompt, err := prompts.Render(prompts.Tags, map[string]interface{}{
+		"Title":    title,
+		"Content":  content,
+		"Language": language,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	response, err := ai.GenerateResponse(ctx, prompt, nil)
 	if err != nil {
 		return nil, err
@@ -767,8 +1154,15 @@ func (ai *AIService) extractTags(ctx context.Context, content, title string) ([]
 
 // extractActionableSteps extracts actionable steps from note content
 func (ai *AIService) extractActionableSteps(ctx context.Context, content, title string) ([]string, error) {
-	prompt := fmt.Sprintf("Extract actionable steps or tasks from this content. Return as a numbered list:\n\nTitle: %s\nContent: %s", title, content)
-	
+	ctx = withAICallFeature(ctx, prompts.ActionSteps, title, content)
+	prompt, err := prompts.Render(prompts.ActionSteps, map[string]interface{}{
+		"Title":   title,
+		"Content": content,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	response, err := ai.GenerateResponse(ctx, prompt, nil)
 	if err != nil {
 		return nil, err
@@ -789,8 +1183,15 @@ func (ai *AIService) extractActionableSteps(ctx context.Context, content, title
 
 // extractLearningItems extracts learning opportunities from note content
 func (ai *AIService) extractLearningItems(ctx context.Context, content, title string) ([]string, error) {
-	prompt := fmt.Sprintf("Extract learning opportunities, insights, or knowledge gaps from this content. Return as a bulleted list:\n\nTitle: %s\nContent: %s", title, content)
-	
+	ctx = withAICallFeature(ctx, prompts.LearningItems, title, content)
+	prompt, err := prompts.Render(prompts.LearningItems, map[string]interface{}{
+		"Title":   title,
+		"Content": content,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	response, err := ai.GenerateResponse(ctx, prompt, nil)
 	if err != nil {
 		return nil, err
@@ -811,31 +1212,21 @@ func (ai *AIService) extractLearningItems(ctx context.Context, content, title st
 
 // BreakDownTask breaks down a complex task into smaller actionable steps
 func (ai *AIService) BreakDownTask(ctx context.Context, title string, description string, maxSteps int) (map[string]interface{}, error) {
-	prompt := fmt.Sprintf(`You are a project management AI. Break down the following goal into %d actionable steps.
-
-Goal: %s
-Context: %s
-
-Please return ONLY a valid JSON object in this exact format:
-{
-  "goal": "%s",
-  "steps": [
-    {
-      "step": 1,
-      "title": "Step Title",
-      "description": "Detailed description of what to do"
-    },
-    {
-      "step": 2,
-      "title": "Step Title",
-      "description": "Detailed description of what to do"
-    }
-  ]
-}
+	ctx = withAICallFeature(ctx, prompts.BreakDownTask, title, description)
+	prompt, err := prompts.Render(prompts.BreakDownTask, map[string]interface{}{
+		"MaxSteps":    maxSteps,
+		"Title":       title,
+		"Description": description,
+	})
+	if err != nil {
+		return nil, err
+	}
 
-Return only the JSON, no additional text or formatting.`, maxSteps, title, description, title)
-	
 	response, err := ai.GenerateResponse(ctx, prompt, nil)
+	if errors.Is(err, ErrAIUnavailable) {
+		log.Printf("AI unavailable, using a single-step placeholder for %q", title)
+		return placeholderBreakdown(title, description, maxSteps), nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -913,8 +1304,21 @@ Return only the JSON, no additional text or formatting.`, maxSteps, title, descr
 	return result, nil
 }
 
-// CreateProjectNotebook creates a notebook structure for a project using AI
-func (ai *AIService) CreateProjectNotebook(ctx context.Context, userID uuid.UUID, projectName, projectDescription string, breakdown map[string]interface{}) (*uuid.UUID, []uuid.UUID, error) {
+// CreateProjectNotebook creates a notebook structure for a project using AI.
+// Step notes follow the note template stepTemplateID, or the default structure
+// when it is empty.
+func (ai *AIService) CreateProjectNotebook(ctx context.Context, userID uuid.UUID, projectName, projectDescription string, breakdown map[string]interface{}, stepTemplateID string) (*uuid.UUID, []uuid.UUID, error) {
+	stepTemplate := DefaultStepNoteTemplate
+	if stepTemplateID != "" {
+		noteTemplate, err := NoteTemplateServiceInstance.GetTemplateById(&database.Database{DB: ai.db}, stepTemplateID, map[string]interface{}{
+			"user_id": userID.String(),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load step note template: %w", err)
+		}
+		stepTemplate = noteTemplate.Blocks
+	}
+
 	// Create the notebook using the notebook service
 	notebookData := map[string]interface{}{
 		"name":        projectName + " - Project Notebook",
@@ -938,6 +1342,7 @@ func (ai *AIService) CreateProjectNotebook(ctx context.Context, userID uuid.UUID
 					"title":       projectName + " - Project Overview",
 					"user_id":     userID.String(),
 					"notebook_id": notebook.ID.String(),
+					"source":      "ai_project",
 				}
 				
 				introNote, err := NoteServiceInstance.CreateNote(&database.Database{DB: ai.db}, introNoteData)
@@ -1015,6 +1420,7 @@ func (ai *AIService) CreateProjectNotebook(ctx context.Context, userID uuid.UUID
 						Metadata: models.BlockMetadata{},
 					}
 					ai.db.Create(&stepsListBlock)
+					refreshNotePreview(ai.db, introNote.ID)
 				}
 				
 				// Create a separate note for each step
@@ -1041,6 +1447,7 @@ func (ai *AIService) CreateProjectNotebook(ctx context.Context, userID uuid.UUID
 							"title":       fmt.Sprintf("Step %d: %s", i+1, stepTitle),
 							"user_id":     userID.String(),
 							"notebook_id": notebook.ID.String(),
+							"source":      "ai_project",
 						}
 						
 						stepNote, err := NoteServiceInstance.CreateNote(&database.Database{DB: ai.db}, stepNoteData)
@@ -1053,62 +1460,26 @@ func (ai *AIService) CreateProjectNotebook(ctx context.Context, userID uuid.UUID
 						log.Printf("Created step note %d: %s", i+1, stepTitle)
 						
 						// Add content blocks to the step note
-						stepHeaderBlock := models.Block{
-							ID:      uuid.New(),
-							UserID:  userID,
-							NoteID:  stepNote.ID,
-							Type:    "header",
-							Order:   1000.0,
-							Content: map[string]interface{}{
-								"text":  fmt.Sprintf("Step %d: %s", i+1, stepTitle),
-								"level": 1,
-							},
-							Metadata: models.BlockMetadata{},
+						stepData := StepNoteData{
+							ProjectName:        projectName,
+							ProjectDescription: projectDescription,
+							Number:             i + 1,
+							Title:              stepTitle,
+							Description:        stepDesc,
+							Step:               stepMap,
 						}
-						ai.db.Create(&stepHeaderBlock)
-						
-						// Add description block
-						stepDescBlock := models.Block{
-							ID:      uuid.New(),
-							UserID:  userID,
-							NoteID:  stepNote.ID,
-							Type:    "text",
-							Order:   2000.0,
-							Content: map[string]interface{}{
-								"text": stepDesc,
-							},
-							Metadata: models.BlockMetadata{},
+						if dueDate, ok := stepMap["due_date"].(string); ok {
+							stepData.DueDate = dueDate
 						}
-						ai.db.Create(&stepDescBlock)
-						
-						// Add a status/progress section
-						statusHeaderBlock := models.Block{
-							ID:      uuid.New(),
-							UserID:  userID,
-							NoteID:  stepNote.ID,
-							Type:    "header",
-							Order:   3000.0,
-							Content: map[string]interface{}{
-								"text":  "Progress & Notes",
-								"level": 2,
-							},
-							Metadata: models.BlockMetadata{},
+						blocks, err := buildStepNoteBlocks(stepTemplate, stepData, userID, stepNote.ID)
+						if err != nil {
+							log.Printf("Failed to render step template for step %d, using default: %v", i+1, err)
+							blocks, _ = buildStepNoteBlocks(DefaultStepNoteTemplate, stepData, userID, stepNote.ID)
 						}
-						ai.db.Create(&statusHeaderBlock)
-						
-						// Add a placeholder for progress notes
-						progressBlock := models.Block{
-							ID:      uuid.New(),
-							UserID:  userID,
-							NoteID:  stepNote.ID,
-							Type:    "text",
-							Order:   4000.0,
-							Content: map[string]interface{}{
-								"text": "Status: Not started\n\nAdd your progress notes here...",
-							},
-							Metadata: models.BlockMetadata{},
+						for j := range blocks {
+							ai.db.Create(&blocks[j])
 						}
-						ai.db.Create(&progressBlock)
+						refreshNotePreview(ai.db, stepNote.ID)
 					}
 				}
 				log.Printf("Finished creating %d step notes", len(steps))
@@ -1119,49 +1490,78 @@ func (ai *AIService) CreateProjectNotebook(ctx context.Context, userID uuid.UUID
 	return &notebook.ID, noteIDs, nil
 }
 
-// SearchNotes performs semantic search across user's notes
-func (ai *AIService) SearchNotes(ctx context.Context, userID uuid.UUID, query string, limit int) ([]models.Note, error) {
-	// First try semantic search using ChromaDB if available
-	if ai.chromaService != nil {
-		// Try semantic search
+// buildStepNoteBlocks renders a step note template into blocks for a note
+func buildStepNoteBlocks(stepTemplate models.NoteTemplateBlocks, data StepNoteData, userID, noteID uuid.UUID) ([]models.Block, error) {
+	rendered, err := renderNoteTemplate(stepTemplate, data)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]models.Block, 0, len(rendered))
+	for i, block := range rendered {
+		blocks = append(blocks, models.Block{
+			ID:       uuid.New(),
+			UserID:   userID,
+			NoteID:   noteID,
+			Type:     block.Type,
+			Order:    float64(i+1) * 1000.0,
+			Content:  block.Content,
+			Metadata: models.BlockMetadata{},
+		})
+	}
+	return blocks, nil
+}
+
+// searchRetryDelay is the pause before the semantic search query is retried
+var searchRetryDelay = 300 * time.Millisecond
+
+// SearchNotes performs semantic search across user's notes, leaving out
+// matches below SEARCH_MIN_SIMILARITY. When ChromaDB is unavailable or the
+// query fails twice, it falls back to a PostgreSQL text search and reports
+// degraded as true.
+func (ai *AIService) SearchNotes(ctx context.Context, userID uuid.UUID, query string, limit int) (notes []models.Note, degraded bool, err error) {
+	if ai.chromaService == nil {
+		degraded = true
+	} else {
 		where := map[string]interface{}{
 			"user_id": userID.String(),
 		}
-		
-		results, err := ai.chromaService.QueryByText(ctx, NoteEmbeddingsCollection, []string{query}, limit, where)
-		if err == nil && len(results.IDs) > 0 && len(results.IDs[0]) > 0 {
-			// Convert ChromaDB IDs back to note IDs and fetch notes
-			var notes []models.Note
-			for _, chromaID := range results.IDs[0] {
-				noteID, err := ChromaIDToNoteID(chromaID)
-				if err != nil {
-					log.Printf("Failed to parse note ID from ChromaDB ID %s: %v", chromaID, err)
-					continue
-				}
-				
+
+		results, err := ai.chromaService.QueryByText(ctx, ai.noteCollection(), []string{query}, limit, where)
+		if err != nil {
+			select {
+			case <-time.After(searchRetryDelay):
+				results, err = ai.chromaService.QueryByText(ctx, ai.noteCollection(), []string{query}, limit, where)
+			case <-ctx.Done():
+			}
+		}
+		if err != nil {
+			log.Printf("Semantic search failed for user %s, falling back to text search: %v", userID, err)
+			degraded = true
+		} else {
+			// Fetch the notes of the matches that clear the similarity threshold
+			ranking := SearchRanking{Order: OrderRelevance, MinSimilarity: DefaultMinSimilarity()}
+			for _, hit := range rankHits(searchHits(results, ai.collectionSpace()), ranking, time.Now()) {
 				var note models.Note
-				if err := ai.db.WithContext(ctx).Where("id = ? AND user_id = ?", noteID, userID).First(&note).Error; err != nil {
-					log.Printf("Failed to find note %s: %v", noteID, err)
+				if err := ai.db.WithContext(ctx).Where("id = ? AND user_id = ?", hit.NoteID, userID).First(&note).Error; err != nil {
+					log.Printf("Failed to find note %s: %v", hit.NoteID, err)
 					continue
 				}
-				
+
 				notes = append(notes, note)
 			}
-			
+
 			if len(notes) > 0 {
-				return notes, nil
+				return notes, false, nil
 			}
 		}
 	}
-	
-	// Fallback to text search if semantic search fails or returns no results
-	var notes []models.Note
+
+	// Fall back to text search if semantic search fails or returns no results
 	searchTerm := "%" + query + "%"
-	
-	err := ai.db.WithContext(ctx).Where("user_id = ? AND title ILIKE ?", userID, searchTerm).
+	err = ai.db.WithContext(ctx).
+		Where(noteTextSearchCondition, userID, searchTerm, searchTerm, query).
 		Limit(limit).Order("updated_at DESC").Find(&notes).Error
-	
-	return notes, err
+	return notes, degraded, err
 }
 
 // ChromaIDToNoteID converts a ChromaDB document ID back to a note UUID
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotesForReindex_ExcludesTrashed(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID := uuid.New()
+
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE "notes"."deleted_at" IS NULL$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(noteID.String(), "Live note"))
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE "blocks"."note_id" = \$1 AND "blocks"."deleted_at" IS NULL ORDER BY "blocks"."order" ASC$`).
+		WithArgs(noteID.String()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id"}))
+
+	ai := &AIService{db: db.DB}
+	notes, err := ai.notesForReindex(context.Background())
+
+	assert.NoError(t, err)
+	assert.Len(t, notes, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetEnhancedNote_ChecksOwnerThroughNote(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID, owner, other := uuid.New(), uuid.New(), uuid.New()
+	enhancedQuery := `SELECT "ai_enhanced_notes"."note_id",.* FROM "ai_enhanced_notes" JOIN notes ON notes.id = ai_enhanced_notes.note_id AND notes.deleted_at IS NULL WHERE ai_enhanced_notes.note_id = \$1 AND notes.user_id = \$2`
+
+	mock.ExpectQuery(enhancedQuery).
+		WithArgs(noteID, owner, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"note_id", "summary"}).AddRow(noteID, "A summary"))
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE "notes"."id" = \$1 AND "notes"."deleted_at" IS NULL`).
+		WithArgs(noteID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).AddRow(noteID, owner, "Owned"))
+	mock.ExpectQuery(enhancedQuery).
+		WithArgs(noteID, other, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"note_id"}))
+
+	ai := &AIService{db: db.DB}
+	aiNote, err := ai.GetEnhancedNote(context.Background(), noteID, owner)
+	assert.NoError(t, err)
+	if assert.NotNil(t, aiNote) {
+		assert.Equal(t, "A summary", aiNote.Summary)
+		assert.Equal(t, "Owned", aiNote.Note.Title)
+	}
+
+	_, err = ai.GetEnhancedNote(context.Background(), noteID, other)
+	assert.ErrorIs(t, err, ErrNoteNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchNotes_FallsBackWhenChromaFails(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	defer func(delay time.Duration) { searchRetryDelay = delay }(searchRetryDelay)
+	searchRetryDelay = 0
+
+	// Every Chroma request fails
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	ai := &AIService{db: db.DB, chromaService: NewChromaService(server.URL, nil)}
+
+	userID, noteID := uuid.New(), uuid.New()
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE \(user_id = \$1 AND \(title ILIKE \$2 OR preview ILIKE \$3 OR to_tsvector\('simple', title \|\| ' ' \|\| preview\) @@ plainto_tsquery\('simple', \$4\)\)\) AND "notes"."deleted_at" IS NULL ORDER BY updated_at DESC LIMIT \$5`).
+		WithArgs(userID, "%garden%", "%garden%", "garden", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).AddRow(noteID, userID, "Garden plan"))
+
+	notes, degraded, err := ai.SearchNotes(context.Background(), userID, "garden", 5)
+	require.NoError(t, err)
+	assert.True(t, degraded)
+	require.Len(t, notes, 1)
+	assert.Equal(t, "Garden plan", notes[0].Title)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	ts := &TelegramService{aiService: ai}
+	mock.ExpectQuery(`SELECT \* FROM "notes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).AddRow(noteID, userID, "Garden plan"))
+	response := ts.handleSearchCommand(context.Background(), userID, []string{"garden"})
+	assert.Contains(t, response, "Garden plan")
+	assert.Contains(t, response, telegramText(context.Background(), msgDegradedSearch, nil))
+}
@@ -0,0 +1,424 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EffectiveAISettings are AI settings with every level applied
+type EffectiveAISettings struct {
+	AutoEnhance      bool     `json:"auto_enhance"`
+	Enhancements     []string `json:"enhancements"`
+	AutoExtractTasks bool     `json:"auto_extract_tasks"`
+	SummaryLength    string   `json:"summary_length"`
+	SummaryFormat    string   `json:"summary_format"`
+}
+
+// Enabled reports whether the enhancement is generated
+func (s EffectiveAISettings) Enabled(enhancement string) bool {
+	for _, name := range s.Enhancements {
+		if name == enhancement {
+			return true
+		}
+	}
+	return false
+}
+
+// AISettingsView is the stored settings of a notebook or note and what they
+// resolve to
+type AISettingsView struct {
+	Settings  models.AISettings   `json:"settings"`
+	Effective EffectiveAISettings `json:"effective"`
+}
+
+// DefaultAISettings are the server defaults, set by AI_AUTO_ENHANCE and
+// AI_AUTO_EXTRACT_TASKS (both off by default) with every enhancement enabled,
+// and AI_SUMMARY_LENGTH and AI_SUMMARY_FORMAT (medium paragraphs by default)
+func DefaultAISettings() models.AISettings {
+	autoEnhance, _ := strconv.ParseBool(os.Getenv("AI_AUTO_ENHANCE"))
+	autoExtractTasks, _ := strconv.ParseBool(os.Getenv("AI_AUTO_EXTRACT_TASKS"))
+	defaults := models.AISettings{
+		AutoEnhance:      &autoEnhance,
+		Enhancements:     append([]string(nil), models.AIEnhancements...),
+		AutoExtractTasks: &autoExtractTasks,
+		SummaryLength:    os.Getenv("AI_SUMMARY_LENGTH"),
+		SummaryFormat:    os.Getenv("AI_SUMMARY_FORMAT"),
+	}
+	if defaults.SummaryLength == "" || (models.AISettings{SummaryLength: defaults.SummaryLength}).Validate() != nil {
+		defaults.SummaryLength = models.SummaryMedium
+	}
+	if defaults.SummaryFormat == "" || (models.AISettings{SummaryFormat: defaults.SummaryFormat}).Validate() != nil {
+		defaults.SummaryFormat = models.SummaryParagraph
+	}
+	return defaults
+}
+
+// ResolveAISettings overlays the levels, most general first, on the defaults
+func ResolveAISettings(levels ...models.AISettings) EffectiveAISettings {
+	settings := DefaultAISettings()
+	for _, level := range levels {
+		settings = settings.Overlay(level)
+	}
+	return EffectiveAISettings{
+		AutoEnhance:      *settings.AutoEnhance,
+		Enhancements:     settings.Enhancements,
+		AutoExtractTasks: *settings.AutoExtractTasks,
+		SummaryLength:    settings.SummaryLength,
+		SummaryFormat:    settings.SummaryFormat,
+	}
+}
+
+// NoteAISettings resolves the settings a note is processed with: its own
+// over its notebook's, over its owner's
+func NoteAISettings(db *gorm.DB, noteID uuid.UUID) (EffectiveAISettings, error) {
+	var note models.Note
+	if err := db.Select("id", "user_id", "notebook_id", "ai_settings").Where("id = ?", noteID).First(&note).Error; err != nil {
+		return EffectiveAISettings{}, ErrNoteNotFound
+	}
+
+	return resolveNoteAISettings(db, &note), nil
+}
+
+// resolveNoteAISettings overlays the note's settings on its notebook's and
+// those on its owner's
+func resolveNoteAISettings(db *gorm.DB, note *models.Note) EffectiveAISettings {
+	user := userAISettings(db, note.UserID).AISettings
+	var notebook models.Notebook
+	if err := db.Unscoped().Select("id", "ai_settings").Where("id = ?", note.NotebookID).First(&notebook).Error; err != nil {
+		// An orphaned note still has its own settings
+		return ResolveAISettings(user, note.AISettings)
+	}
+	return ResolveAISettings(user, notebook.AISettings, note.AISettings)
+}
+
+type AISettingsServiceInterface interface {
+	GetNotebookAISettings(db *database.Database, notebookID string, params map[string]interface{}) (AISettingsView, error)
+	UpdateNotebookAISettings(db *database.Database, notebookID string, settings models.AISettings, params map[string]interface{}) (AISettingsView, error)
+	GetNoteAISettings(db *database.Database, noteID string, params map[string]interface{}) (AISettingsView, error)
+	UpdateNoteAISettings(db *database.Database, noteID string, settings models.AISettings, params map[string]interface{}) (AISettingsView, error)
+	GetUserAISettings(db *database.Database, notebookID string, params map[string]interface{}) (UserAISettingsView, error)
+	UpdateUserAISettings(db *database.Database, settings UserAISettings, params map[string]interface{}) (UserAISettingsView, error)
+}
+
+type AISettingsService struct{}
+
+var AISettingsServiceInstance AISettingsServiceInterface = NewAISettingsService()
+
+func NewAISettingsService() AISettingsServiceInterface {
+	return &AISettingsService{}
+}
+
+// GetNotebookAISettings returns the notebook's settings, readable by viewers
+func (s *AISettingsService) GetNotebookAISettings(db *database.Database, notebookID string, params map[string]interface{}) (AISettingsView, error) {
+	if err := s.checkAccess(db, notebookID, models.NotebookResource, "viewer", params); err != nil {
+		return AISettingsView{}, err
+	}
+
+	var notebook models.Notebook
+	if err := db.DB.Select("id", "ai_settings").Where("id = ?", notebookID).First(&notebook).Error; err != nil {
+		return AISettingsView{}, ErrNotebookNotFound
+	}
+	return AISettingsView{Settings: notebook.AISettings, Effective: ResolveAISettings(notebook.AISettings)}, nil
+}
+
+// UpdateNotebookAISettings replaces the notebook's settings, editors only
+func (s *AISettingsService) UpdateNotebookAISettings(db *database.Database, notebookID string, settings models.AISettings, params map[string]interface{}) (AISettingsView, error) {
+	if err := settings.Validate(); err != nil {
+		return AISettingsView{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if err := s.checkAccess(db, notebookID, models.NotebookResource, "editor", params); err != nil {
+		return AISettingsView{}, err
+	}
+
+	result := db.DB.Model(&models.Notebook{}).Where("id = ?", notebookID).Update("ai_settings", settings)
+	if result.Error != nil {
+		return AISettingsView{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return AISettingsView{}, ErrNotebookNotFound
+	}
+	return AISettingsView{Settings: settings, Effective: ResolveAISettings(settings)}, nil
+}
+
+// GetNoteAISettings returns the note's overrides and the settings it is
+// processed with, readable by viewers
+func (s *AISettingsService) GetNoteAISettings(db *database.Database, noteID string, params map[string]interface{}) (AISettingsView, error) {
+	if err := s.checkAccess(db, noteID, models.NoteResource, "viewer", params); err != nil {
+		return AISettingsView{}, err
+	}
+	return s.noteView(db, noteID)
+}
+
+// UpdateNoteAISettings replaces the note's overrides, editors only. Fields
+// left unset follow the notebook.
+func (s *AISettingsService) UpdateNoteAISettings(db *database.Database, noteID string, settings models.AISettings, params map[string]interface{}) (AISettingsView, error) {
+	if err := settings.Validate(); err != nil {
+		return AISettingsView{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if err := s.checkAccess(db, noteID, models.NoteResource, "editor", params); err != nil {
+		return AISettingsView{}, err
+	}
+
+	// UpdateColumn leaves updated_at alone, settings aren't note content
+	result := db.DB.Model(&models.Note{}).Where("id = ?", noteID).UpdateColumn("ai_settings", settings)
+	if result.Error != nil {
+		return AISettingsView{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return AISettingsView{}, ErrNoteNotFound
+	}
+	return s.noteView(db, noteID)
+}
+
+// noteView reads a note's overrides and resolves them
+func (s *AISettingsService) noteView(db *database.Database, noteID string) (AISettingsView, error) {
+	id, err := uuid.Parse(noteID)
+	if err != nil {
+		return AISettingsView{}, ErrNoteNotFound
+	}
+
+	var note models.Note
+	if err := db.DB.Select("id", "user_id", "notebook_id", "ai_settings").Where("id = ?", id).First(&note).Error; err != nil {
+		return AISettingsView{}, ErrNoteNotFound
+	}
+	return AISettingsView{Settings: note.AISettings, Effective: resolveNoteAISettings(db.DB, &note)}, nil
+}
+
+// checkAccess requires the user to hold at least role on the resource
+func (s *AISettingsService) checkAccess(db *database.Database, resourceID string, resourceType models.ResourceType, role string, params map[string]interface{}) error {
+	userID, ok := params["user_id"].(string)
+	if !ok || userID == "" {
+		return fmt.Errorf("user_id must be provided in parameters")
+	}
+
+	hasAccess, err := RoleServiceInstance.HasAccessByStrings(db, userID, resourceID, string(resourceType), role)
+	if err != nil {
+		return err
+	}
+	if !hasAccess {
+		return ErrInsufficientAccess
+	}
+	return nil
+}
+
+// AISettingsPreference is the user preference holding the user's AI
+// settings, which their notebooks and notes override
+const AISettingsPreference = "ai_settings"
+
+// UserAISettings are the AI preferences a user keeps in their preferences:
+// the AI settings of their notes, the AI output language and whether chain
+// results are saved as a notebook
+type UserAISettings struct {
+	models.AISettings
+	Language                   string `json:"language,omitempty"` // ISO 639-1 code, the note's language when unset
+	SaveChainResultsAsNotebook *bool  `json:"save_chain_results_as_notebook,omitempty"`
+}
+
+// Validate checks the AI settings and that the language is an ISO 639-1 code
+func (s UserAISettings) Validate() error {
+	if err := s.AISettings.Validate(); err != nil {
+		return err
+	}
+	if s.Language != "" && (len(s.Language) != 2 || strings.ToLower(s.Language) != s.Language || strings.Trim(s.Language, "abcdefghijklmnopqrstuvwxyz") != "") {
+		return errors.New("language must be an ISO 639-1 code such as de")
+	}
+	return nil
+}
+
+// AIProviderStatus is the server's AI provider configuration
+type AIProviderStatus struct {
+	Provider   string `json:"provider"`
+	Model      string `json:"model"`
+	Configured bool   `json:"configured"` // An API key is set
+	Paused     bool   `json:"paused"`     // AI processing is paused by an administrator
+}
+
+// UserAISettingsView is the AI configuration of a user: their stored
+// settings, what their notes are processed with in the notebook, if one is
+// given, and the level each effective setting comes from (global, user or
+// notebook)
+type UserAISettingsView struct {
+	Settings                   UserAISettings      `json:"settings"`
+	NotebookID                 *uuid.UUID          `json:"notebook_id,omitempty"`
+	NotebookSettings           *models.AISettings  `json:"notebook_settings,omitempty"`
+	Effective                  EffectiveAISettings `json:"effective"`
+	Sources                    map[string]string   `json:"sources"`
+	Language                   string              `json:"language"` // "" when following each note
+	SaveChainResultsAsNotebook bool                `json:"save_chain_results_as_notebook"`
+	Provider                   AIProviderStatus    `json:"provider"`
+}
+
+// GetUserAISettings returns the AI configuration of the user, merged with the
+// notebook's settings when notebookID isn't empty. The notebook needs viewer
+// access.
+func (s *AISettingsService) GetUserAISettings(db *database.Database, notebookID string, params map[string]interface{}) (UserAISettingsView, error) {
+	userID, err := settingsUserID(params)
+	if err != nil {
+		return UserAISettingsView{}, err
+	}
+
+	var notebook *models.Notebook
+	if notebookID != "" {
+		if err := s.checkAccess(db, notebookID, models.NotebookResource, "viewer", params); err != nil {
+			return UserAISettingsView{}, err
+		}
+		notebook = &models.Notebook{}
+		if err := db.DB.Select("id", "ai_settings").Where("id = ?", notebookID).First(notebook).Error; err != nil {
+			return UserAISettingsView{}, ErrNotebookNotFound
+		}
+	}
+	return userAISettingsView(userAISettings(db.DB, userID), notebook), nil
+}
+
+// UpdateUserAISettings replaces the user's AI settings. Fields left unset
+// follow the server defaults.
+func (s *AISettingsService) UpdateUserAISettings(db *database.Database, settings UserAISettings, params map[string]interface{}) (UserAISettingsView, error) {
+	if err := settings.Validate(); err != nil {
+		return UserAISettingsView{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	userID, err := settingsUserID(params)
+	if err != nil {
+		return UserAISettingsView{}, err
+	}
+
+	stored := map[string]interface{}{AISettingsPreference: settings.AISettings}
+	if settings.Language != "" {
+		stored[AILanguagePreference] = settings.Language
+	}
+	if settings.SaveChainResultsAsNotebook != nil {
+		stored[SaveChainResultsAsNotebookPreference] = *settings.SaveChainResultsAsNotebook
+	}
+	raw, err := json.Marshal(stored)
+	if err != nil {
+		return UserAISettingsView{}, err
+	}
+
+	// The other preferences are kept
+	removed := "{" + strings.Join([]string{AISettingsPreference, AILanguagePreference, SaveChainResultsAsNotebookPreference}, ",") + "}"
+	result := db.DB.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("preferences", gorm.Expr("(COALESCE(preferences, '{}'::jsonb) - ?::text[]) || ?::jsonb", removed, string(raw)))
+	if result.Error != nil {
+		return UserAISettingsView{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return UserAISettingsView{}, ErrUserNotFound
+	}
+	return userAISettingsView(settings, nil), nil
+}
+
+// userAISettings reads the user's AI preferences. Unreadable preferences
+// count as unset.
+func userAISettings(db *gorm.DB, userID uuid.UUID) UserAISettings {
+	var raw []byte
+	err := db.Model(&models.User{}).Select("preferences").Where("id = ?", userID).Row().Scan(&raw)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to read AI settings of user %s: %v", userID, err)
+		}
+		return UserAISettings{}
+	}
+	if len(raw) == 0 {
+		return UserAISettings{}
+	}
+
+	var preferences struct {
+		AISettings                 models.AISettings `json:"ai_settings"`
+		Language                   string            `json:"ai_language"`
+		SaveChainResultsAsNotebook *bool             `json:"save_chain_results_as_notebook"`
+	}
+	if err := json.Unmarshal(raw, &preferences); err != nil {
+		log.Printf("Ignoring invalid AI settings of user %s: %v", userID, err)
+		return UserAISettings{}
+	}
+	return UserAISettings{
+		AISettings:                 preferences.AISettings,
+		Language:                   strings.TrimSpace(preferences.Language),
+		SaveChainResultsAsNotebook: preferences.SaveChainResultsAsNotebook,
+	}
+}
+
+// userAISettingsView resolves the user's settings, overridden by the
+// notebook's when there is one
+func userAISettingsView(settings UserAISettings, notebook *models.Notebook) UserAISettingsView {
+	view := UserAISettingsView{
+		Settings:                   settings,
+		Effective:                  ResolveAISettings(settings.AISettings),
+		Sources:                    aiSettingSources(map[string]models.AISettings{"user": settings.AISettings}, "user"),
+		Language:                   settings.Language,
+		SaveChainResultsAsNotebook: settings.SaveChainResultsAsNotebook == nil || *settings.SaveChainResultsAsNotebook,
+		Provider:                   aiProviderStatus(),
+	}
+	if notebook != nil {
+		view.NotebookID = &notebook.ID
+		view.NotebookSettings = &notebook.AISettings
+		view.Effective = ResolveAISettings(settings.AISettings, notebook.AISettings)
+		view.Sources = aiSettingSources(map[string]models.AISettings{"user": settings.AISettings, "notebook": notebook.AISettings}, "user", "notebook")
+	}
+	return view
+}
+
+// aiSettingSources names the level each setting is taken from: the last of
+// the levels, most general first, that sets it, or global
+func aiSettingSources(settings map[string]models.AISettings, levels ...string) map[string]string {
+	sources := map[string]string{
+		"auto_enhance":       "global",
+		"enhancements":       "global",
+		"auto_extract_tasks": "global",
+		"summary_length":     "global",
+		"summary_format":     "global",
+	}
+	for _, level := range levels {
+		s := settings[level]
+		if s.AutoEnhance != nil {
+			sources["auto_enhance"] = level
+		}
+		if s.Enhancements != nil {
+			sources["enhancements"] = level
+		}
+		if s.AutoExtractTasks != nil {
+			sources["auto_extract_tasks"] = level
+		}
+		if s.SummaryLength != "" {
+			sources["summary_length"] = level
+		}
+		if s.SummaryFormat != "" {
+			sources["summary_format"] = level
+		}
+	}
+	return sources
+}
+
+// aiProviderStatus describes the configured AI provider
+func aiProviderStatus() AIProviderStatus {
+	status := AIProviderStatus{Provider: "anthropic", Paused: AIPauseInstance.Paused()}
+	if AIServiceInstance != nil {
+		status.Model = AIServiceInstance.anthropicModel
+		status.Configured = AIServiceInstance.anthropicKey != ""
+	}
+	return status
+}
+
+// settingsUserID reads the user ID from params
+func settingsUserID(params map[string]interface{}) (uuid.UUID, error) {
+	userID, ok := params["user_id"].(string)
+	if !ok || userID == "" {
+		return uuid.Nil, fmt.Errorf("user_id must be provided in parameters")
+	}
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return uuid.Nil, ErrInvalidInput
+	}
+	return id, nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUserAISettings_NotebookOverUserOverGlobal(t *testing.T) {
+	withAllowAllRoles(t)
+	t.Setenv("AI_AUTO_ENHANCE", "false")
+	t.Setenv("AI_SUMMARY_LENGTH", "long")
+	t.Setenv("AI_SUMMARY_FORMAT", "bullets")
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID, notebookID := uuid.New(), uuid.New()
+	mock.ExpectQuery(`SELECT "id","ai_settings" FROM "notebooks"`).
+		WithArgs(notebookID.String(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ai_settings"}).
+			AddRow(notebookID, []byte(`{"summary_length":"short"}`)))
+	mock.ExpectQuery(`SELECT "preferences" FROM "users"`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"preferences"}).
+			AddRow([]byte(`{"ai_settings":{"auto_enhance":true,"summary_length":"medium"},"ai_language":"de","theme":"dark"}`)))
+
+	view, err := (&AISettingsService{}).GetUserAISettings(db, notebookID.String(), map[string]interface{}{"user_id": userID.String()})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, models.SummaryShort, view.Effective.SummaryLength, "the notebook wins over the user")
+	assert.True(t, view.Effective.AutoEnhance, "the user wins over the server")
+	assert.Equal(t, models.SummaryBullets, view.Effective.SummaryFormat, "the server default applies when nobody sets it")
+	assert.Equal(t, map[string]string{
+		"auto_enhance":       "user",
+		"enhancements":       "global",
+		"auto_extract_tasks": "global",
+		"summary_length":     "notebook",
+		"summary_format":     "global",
+	}, view.Sources)
+
+	assert.Equal(t, models.SummaryMedium, view.Settings.SummaryLength, "the stored user settings are returned as they are")
+	assert.Equal(t, "de", view.Language)
+	assert.True(t, view.SaveChainResultsAsNotebook)
+	assert.Equal(t, &notebookID, view.NotebookID)
+	assert.Equal(t, "anthropic", view.Provider.Provider)
+}
+
+func TestNoteAISettings_IncludeTheOwnersSettings(t *testing.T) {
+	t.Setenv("AI_AUTO_EXTRACT_TASKS", "false")
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID, userID, notebookID := uuid.New(), uuid.New(), uuid.New()
+	mock.ExpectQuery(`SELECT "id","user_id","notebook_id","ai_settings" FROM "notes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "notebook_id", "ai_settings"}).
+			AddRow(noteID, userID, notebookID, []byte(`{}`)))
+	mock.ExpectQuery(`SELECT "preferences" FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"preferences"}).
+			AddRow([]byte(`{"ai_settings":{"auto_extract_tasks":true,"summary_format":"bullets"}}`)))
+	mock.ExpectQuery(`SELECT "id","ai_settings" FROM "notebooks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ai_settings"}).
+			AddRow(notebookID, []byte(`{"summary_format":"paragraph"}`)))
+
+	settings, err := NoteAISettings(db.DB, noteID)
+	require.NoError(t, err)
+	assert.True(t, settings.AutoExtractTasks, "notes are processed with their owner's settings")
+	assert.Equal(t, models.SummaryParagraph, settings.SummaryFormat, "the notebook overrides the owner")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateUserAISettings_Validates(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	params := map[string]interface{}{"user_id": uuid.New().String()}
+
+	for _, settings := range []UserAISettings{
+		{AISettings: models.AISettings{SummaryLength: "huge"}},
+		{AISettings: models.AISettings{Enhancements: []string{"poems"}}},
+		{Language: "German"},
+	} {
+		_, err := (&AISettingsService{}).UpdateUserAISettings(db, settings, params)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet(), "invalid settings aren't stored")
+}
+
+func TestUpdateUserAISettings_KeepsOtherPreferences(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	autoEnhance := true
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "preferences"=\(COALESCE\(preferences, '\{\}'::jsonb\) - \$1::text\[\]\) \|\| \$2::jsonb WHERE id = \$3`).
+		WithArgs("{ai_settings,ai_language,save_chain_results_as_notebook}", `{"ai_language":"fr","ai_settings":{"auto_enhance":true}}`, userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	view, err := (&AISettingsService{}).UpdateUserAISettings(db, UserAISettings{
+		AISettings: models.AISettings{AutoEnhance: &autoEnhance},
+		Language:   "fr",
+	}, map[string]interface{}{"user_id": userID.String()})
+	require.NoError(t, err)
+	assert.True(t, view.Effective.AutoEnhance)
+	assert.Equal(t, "user", view.Sources["auto_enhance"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
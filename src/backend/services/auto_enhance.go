@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// autoEnhanceQueueSize caps how many notes wait for auto-enhancement
+const autoEnhanceQueueSize = 100
+
+// AutoEnhancer processes notes with AI when their content changes, if their
+// notebook or note settings turn auto_enhance on. Notes are processed one at
+// a time; a note already waiting is not queued twice.
+type AutoEnhancer struct {
+	db      *gorm.DB
+	process func(ctx context.Context, noteID uuid.UUID) error
+	queue   chan uuid.UUID
+
+	mu      sync.Mutex
+	pending map[uuid.UUID]bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// AutoEnhancerInstance is set in main.go once the AI service exists
+var AutoEnhancerInstance *AutoEnhancer
+
+// NewAutoEnhancer creates an enhancer processing notes with ai
+func NewAutoEnhancer(db *gorm.DB, ai *AIService) *AutoEnhancer {
+	return newAutoEnhancer(db, ai.ProcessNoteWithAI)
+}
+
+func newAutoEnhancer(db *gorm.DB, process func(ctx context.Context, noteID uuid.UUID) error) *AutoEnhancer {
+	return &AutoEnhancer{
+		db:      db,
+		process: process,
+		queue:   make(chan uuid.UUID, autoEnhanceQueueSize),
+		pending: make(map[uuid.UUID]bool),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start begins processing queued notes
+func (a *AutoEnhancer) Start() {
+	go a.run()
+}
+
+// Stop stops processing, cancelling the note in progress
+func (a *AutoEnhancer) Stop() {
+	close(a.stop)
+	<-a.done
+}
+
+func (a *AutoEnhancer) run() {
+	defer close(a.done)
+	stopped, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-a.stop
+		cancel()
+	}()
+
+	for {
+		select {
+		case noteID := <-a.queue:
+			// While AI is paused the note waits, still counted as pending
+			// so further edits don't queue it again
+			if err := AIPauseInstance.Wait(stopped); err != nil {
+				return
+			}
+			a.mu.Lock()
+			delete(a.pending, noteID)
+			a.mu.Unlock()
+
+			if err := a.process(stopped, noteID); err != nil {
+				log.Printf("Auto-enhance of note %s failed: %v", noteID, err)
+			}
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// NoteChanged queues the note an event changed when its settings ask for
+// auto-enhancement. Changes older than the note's last processing, such as
+// the task blocks processing itself adds, are skipped. Reports whether the
+// note was queued.
+func (a *AutoEnhancer) NoteChanged(event models.Event, data map[string]interface{}) bool {
+	switch broker.EventType(event.Event) {
+	case broker.NoteCreated, broker.NoteUpdated, broker.BlockCreated, broker.BlockUpdated, broker.BlockDeleted:
+	default:
+		return false
+	}
+
+	noteIDStr, _ := data["note_id"].(string)
+	noteID, err := uuid.Parse(noteIDStr)
+	if err != nil {
+		return false
+	}
+
+	settings, err := NoteAISettings(a.db, noteID)
+	if err != nil || !settings.AutoEnhance {
+		return false
+	}
+
+	var enhanced models.AIEnhancedNote
+	if err := a.db.Select("note_id", "last_processed_at").Where("note_id = ?", noteID).First(&enhanced).Error; err == nil &&
+		enhanced.LastProcessedAt != nil && !enhanced.LastProcessedAt.Before(event.Timestamp) {
+		return false
+	}
+
+	return a.enqueue(noteID)
+}
+
+// enqueue adds the note unless it is waiting already or the queue is full
+func (a *AutoEnhancer) enqueue(noteID uuid.UUID) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pending[noteID] {
+		return false
+	}
+
+	select {
+	case a.queue <- noteID:
+		a.pending[noteID] = true
+		return true
+	default:
+		log.Printf("Auto-enhance queue is full, skipping note %s", noteID)
+		return false
+	}
+}
+
+// createTasksFromActionSteps adds a task to the note for each action step
+// it doesn't have a task for yet. Returns the number of tasks created.
+func (ai *AIService) createTasksFromActionSteps(ctx context.Context, note *models.Note, steps []string) (int, error) {
+	var titles []string
+	if err := ai.db.WithContext(ctx).Model(&models.Task{}).
+		Where("user_id = ? AND (note_id = ? OR metadata->>'note_id' = ?)", note.UserID, note.ID, note.ID.String()).
+		Pluck("title", &titles).Error; err != nil {
+		return 0, err
+	}
+	existing := make(map[string]bool, len(titles))
+	for _, title := range titles {
+		existing[strings.ToLower(strings.TrimSpace(title))] = true
+	}
+
+	db := &database.Database{DB: ai.db.WithContext(ctx)}
+	created := 0
+	for _, step := range steps {
+		step = strings.TrimSpace(step)
+		key := strings.ToLower(step)
+		if step == "" || existing[key] {
+			continue
+		}
+		if _, err := TaskServiceInstance.CreateTask(db, map[string]interface{}{
+			"user_id": note.UserID.String(),
+			"note_id": note.ID.String(),
+			"title":   step,
+		}); err != nil {
+			return created, err
+		}
+		existing[key] = true
+		created++
+	}
+	return created, nil
+}
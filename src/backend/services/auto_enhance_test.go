@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func boolPtr(value bool) *bool {
+	return &value
+}
+
+// expectNoteSettings answers the settings lookup of a note, its owner, who
+// has no AI settings, and its notebook
+func expectNoteSettings(mock sqlmock.Sqlmock, noteID, notebookID uuid.UUID, noteSettings, notebookSettings string) {
+	userID := uuid.New()
+	mock.ExpectQuery(`SELECT "id","user_id","notebook_id","ai_settings" FROM "notes"`).
+		WithArgs(noteID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "notebook_id", "ai_settings"}).
+			AddRow(noteID, userID, notebookID, []byte(noteSettings)))
+	mock.ExpectQuery(`SELECT "preferences" FROM "users"`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"preferences"}).AddRow([]byte(`{}`)))
+	mock.ExpectQuery(`SELECT "id","ai_settings" FROM "notebooks"`).
+		WithArgs(notebookID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ai_settings"}).
+			AddRow(notebookID, []byte(notebookSettings)))
+}
+
+func blockUpdatedEvent(t *testing.T, noteID uuid.UUID) (models.Event, map[string]interface{}) {
+	data := map[string]interface{}{"block_id": uuid.New().String(), "note_id": noteID.String()}
+	raw, err := json.Marshal(data)
+	require.NoError(t, err)
+	return models.Event{ID: uuid.New(), Event: string(broker.BlockUpdated), Entity: "block", Data: raw, Timestamp: time.Now()}, data
+}
+
+func newTestAutoEnhancer(t *testing.T) (*AutoEnhancer, sqlmock.Sqlmock) {
+	db, mock, close := testutils.SetupMockDB()
+	t.Cleanup(close)
+	return newAutoEnhancer(db.DB, func(ctx context.Context, noteID uuid.UUID) error { return nil }), mock
+}
+
+func TestAutoEnhancer_NotebookWithAutoEnhanceDisabledIsNotQueued(t *testing.T) {
+	// Enabled server wide, but the notebook turns it off
+	t.Setenv("AI_AUTO_ENHANCE", "true")
+	enhancer, mock := newTestAutoEnhancer(t)
+	noteID, notebookID := uuid.New(), uuid.New()
+	expectNoteSettings(mock, noteID, notebookID, `{}`, `{"auto_enhance":false}`)
+
+	event, data := blockUpdatedEvent(t, noteID)
+
+	assert.False(t, enhancer.NoteChanged(event, data))
+	assert.Empty(t, enhancer.queue)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAutoEnhancer_QueuesNoteOnceWhenNotebookEnablesIt(t *testing.T) {
+	enhancer, mock := newTestAutoEnhancer(t)
+	noteID, notebookID := uuid.New(), uuid.New()
+
+	for i := 0; i < 2; i++ {
+		expectNoteSettings(mock, noteID, notebookID, `{}`, `{"auto_enhance":true}`)
+		mock.ExpectQuery(`SELECT "note_id","last_processed_at" FROM "ai_enhanced_notes"`).
+			WillReturnRows(sqlmock.NewRows([]string{"note_id", "last_processed_at"}))
+	}
+
+	event, data := blockUpdatedEvent(t, noteID)
+
+	assert.True(t, enhancer.NoteChanged(event, data))
+	// A note waiting already isn't queued again
+	assert.False(t, enhancer.NoteChanged(event, data))
+	assert.Len(t, enhancer.queue, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAutoEnhancer_NoteOverrideWinsOverNotebook(t *testing.T) {
+	enhancer, mock := newTestAutoEnhancer(t)
+	noteID, notebookID := uuid.New(), uuid.New()
+	expectNoteSettings(mock, noteID, notebookID, `{"auto_enhance":false}`, `{"auto_enhance":true}`)
+
+	event, data := blockUpdatedEvent(t, noteID)
+
+	assert.False(t, enhancer.NoteChanged(event, data))
+	assert.Empty(t, enhancer.queue)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAutoEnhancer_SkipsChangesAlreadyProcessed(t *testing.T) {
+	enhancer, mock := newTestAutoEnhancer(t)
+	noteID, notebookID := uuid.New(), uuid.New()
+	event, data := blockUpdatedEvent(t, noteID)
+
+	// Processing finished after the change, e.g. the change is a task block
+	// processing added
+	expectNoteSettings(mock, noteID, notebookID, `{}`, `{"auto_enhance":true}`)
+	mock.ExpectQuery(`SELECT "note_id","last_processed_at" FROM "ai_enhanced_notes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"note_id", "last_processed_at"}).
+			AddRow(noteID, event.Timestamp.Add(time.Second)))
+
+	assert.False(t, enhancer.NoteChanged(event, data))
+	assert.Empty(t, enhancer.queue)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAutoEnhancer_IgnoresOtherEvents(t *testing.T) {
+	enhancer, mock := newTestAutoEnhancer(t)
+	noteID := uuid.New()
+
+	event := models.Event{Event: string(broker.NoteDeleted), Entity: "note", Timestamp: time.Now()}
+
+	assert.False(t, enhancer.NoteChanged(event, map[string]interface{}{"note_id": noteID.String()}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResolveAISettings_Precedence(t *testing.T) {
+	t.Setenv("AI_AUTO_EXTRACT_TASKS", "true")
+
+	notebook := models.AISettings{AutoEnhance: boolPtr(true), Enhancements: []string{models.EnhancementSummary, models.EnhancementActionSteps}}
+	note := models.AISettings{AutoExtractTasks: boolPtr(false)}
+
+	settings := ResolveAISettings(notebook, note)
+
+	assert.True(t, settings.AutoEnhance)
+	assert.False(t, settings.AutoExtractTasks)
+	assert.Equal(t, []string{models.EnhancementSummary, models.EnhancementActionSteps}, settings.Enhancements)
+	assert.True(t, settings.Enabled(models.EnhancementSummary))
+	assert.False(t, settings.Enabled(models.EnhancementTags))
+
+	defaults := ResolveAISettings()
+	assert.False(t, defaults.AutoEnhance)
+	assert.True(t, defaults.AutoExtractTasks)
+	assert.Equal(t, models.AIEnhancements, defaults.Enhancements)
+}
+
+func TestAutoEnhancer_StopCancelsTheNoteInProgress(t *testing.T) {
+	started := make(chan struct{})
+	enhancer := newAutoEnhancer(nil, func(ctx context.Context, noteID uuid.UUID) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	enhancer.Start()
+	require.True(t, enhancer.enqueue(uuid.New()))
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		enhancer.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop waited for the note in progress to finish on its own")
+	}
+}
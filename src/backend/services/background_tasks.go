@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request it serves
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID set by WithRequestID, or ""
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// detachedContext carries the values of the context it was detached from,
+// such as the request ID, but is only cancelled with its root
+type detachedContext struct {
+	context.Context
+	values context.Context
+}
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.values.Value(key)
+}
+
+// detach returns a context with the values of parent that is cancelled only
+// when root is
+func detach(root, parent context.Context) context.Context {
+	if parent == nil {
+		return root
+	}
+	return detachedContext{Context: root, values: parent}
+}
+
+// BackgroundTasks runs work that HTTP requests start but that has to outlive
+// them. Tasks keep the values of the request context, such as its request ID,
+// but not its cancellation or deadline; they are cancelled only when Stop is
+// called on shutdown.
+type BackgroundTasks struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+var (
+	appBackgroundTasks     *BackgroundTasks
+	appBackgroundTasksOnce sync.Once
+)
+
+// NewBackgroundTasks creates a runner with its own root context
+func NewBackgroundTasks() *BackgroundTasks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BackgroundTasks{ctx: ctx, cancel: cancel}
+}
+
+// AppBackgroundTasks returns the runner shared by the application, stopped on
+// shutdown
+func AppBackgroundTasks() *BackgroundTasks {
+	appBackgroundTasksOnce.Do(func() {
+		appBackgroundTasks = NewBackgroundTasks()
+	})
+	return appBackgroundTasks
+}
+
+// Detach returns a context with the values of parent that is cancelled only on
+// shutdown
+func (b *BackgroundTasks) Detach(parent context.Context) context.Context {
+	return detach(b.ctx, parent)
+}
+
+// Go runs task in the background with a context detached from parent. A
+// returned error is logged with the name of the task and the request ID.
+// Returns false when the runner is stopped and the task was not started.
+func (b *BackgroundTasks) Go(parent context.Context, name string, task func(ctx context.Context) error) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopped {
+		log.Printf("Background task %s not started: shutting down", name)
+		return false
+	}
+
+	ctx := b.Detach(parent)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Background task %s panic recovered%s: %v", name, requestIDSuffix(ctx), r)
+			}
+		}()
+		if err := task(ctx); err != nil {
+			log.Printf("Background task %s failed%s: %v", name, requestIDSuffix(ctx), err)
+		}
+	}()
+	return true
+}
+
+// Stop stops accepting tasks, cancels the running ones and waits up to
+// timeout for them to return
+func (b *BackgroundTasks) Stop(timeout time.Duration) {
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		return
+	}
+	b.stopped = true
+	b.mu.Unlock()
+	b.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("Background tasks stopped")
+	case <-time.After(timeout):
+		log.Printf("Background tasks still running after %s", timeout)
+	}
+}
+
+func requestIDSuffix(ctx context.Context) string {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		return " (request " + requestID + ")"
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackgroundTasks_StopCancelsRunningTasks(t *testing.T) {
+	tasks := NewBackgroundTasks()
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+
+	require.True(t, tasks.Go(context.Background(), "test", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return nil
+	}))
+	<-started
+
+	tasks.Stop(time.Second)
+
+	select {
+	case err := <-cancelled:
+		assert.ErrorIs(t, err, context.Canceled)
+	default:
+		t.Fatal("Stop returned before the running task was cancelled")
+	}
+	assert.False(t, tasks.Go(context.Background(), "late", func(ctx context.Context) error { return nil }),
+		"a stopped runner must not start tasks")
+}
+
+func TestBackgroundTasks_OutliveRequestAndKeepRequestID(t *testing.T) {
+	tasks := NewBackgroundTasks()
+	defer tasks.Stop(time.Second)
+
+	requestCtx, cancelRequest := context.WithTimeout(WithRequestID(context.Background(), "req-42"), time.Hour)
+	proceed := make(chan struct{})
+	seen := make(chan context.Context, 1)
+
+	require.True(t, tasks.Go(requestCtx, "test", func(ctx context.Context) error {
+		<-proceed
+		seen <- ctx
+		return nil
+	}))
+	// The request finishing must not cancel the task
+	cancelRequest()
+	close(proceed)
+
+	ctx := <-seen
+	assert.NoError(t, ctx.Err())
+	_, hasDeadline := ctx.Deadline()
+	assert.False(t, hasDeadline)
+	assert.Equal(t, "req-42", RequestIDFromContext(ctx))
+}
@@ -13,6 +13,7 @@ import (
 	"owlistic-notes/owlistic/models"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type BlockServiceInterface interface {
@@ -67,6 +68,11 @@ func (s *BlockService) CreateBlock(db *database.Database, blockData map[string]i
 		return models.Block{}, ErrInvalidInput
 	}
 
+	if err := checkBlockLimit(tx, userID, noteIDStr); err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
 	// Handle order value conversion from different types to float64
 	var orderValue float64
 	if orderInterface, exists := blockData["order"]; exists {
@@ -121,6 +127,14 @@ func (s *BlockService) CreateBlock(db *database.Database, blockData map[string]i
 		metadata["_sync_source"] = "block"
 		metadata["block_id"] = blockID
 	}
+	if err := models.NormalizeBlockSpans(content, metadata); err != nil {
+		tx.Rollback()
+		return models.Block{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if err := models.ValidateBlock(models.BlockType(blockType), content, metadata); err != nil {
+		tx.Rollback()
+		return models.Block{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
 
 	block := models.Block{
 		ID:       blockID,
@@ -166,6 +180,8 @@ func (s *BlockService) CreateBlock(db *database.Database, blockData map[string]i
 		return models.Block{}, err
 	}
 
+	refreshNotePreview(db.DB, block.NoteID)
+
 	return block, nil
 }
 
@@ -250,15 +266,41 @@ func (s *BlockService) UpdateBlock(db *database.Database, id string, blockData m
 	// Handle metadata separately - don't merge into content
 	if metadataInterface, exists := blockData["metadata"]; exists {
 		if metadataMap, ok := metadataInterface.(map[string]interface{}); ok {
+			// Spans are checked against the text the block will have
+			content := block.Content
+			if updatedContent, ok := blockData["content"].(models.BlockContent); ok {
+				content = updatedContent
+			}
+			if err := models.NormalizeBlockSpans(content, metadataMap); err != nil {
+				tx.Rollback()
+				return models.Block{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+			}
 			blockData["metadata"] = models.BlockMetadata(metadataMap)
 			eventData["metadata"] = models.BlockMetadata(metadataMap)
 		}
 	}
 
+	// Stored spans are fitted to new text sent without metadata
+	if updatedContent, ok := blockData["content"].(models.BlockContent); ok {
+		if _, sent := blockData["metadata"].(models.BlockMetadata); !sent {
+			if metadata, changed := refitStoredSpans(block, updatedContent); changed {
+				blockData["metadata"] = metadata
+				eventData["metadata"] = metadata
+			}
+		}
+	}
+
 	if blockType, ok := blockData["type"].(string); ok {
 		eventData["type"] = blockType
 	}
 
+	// The block is checked as it will be after the update. Defaults are only
+	// stored with metadata that is written in the update.
+	if err := validateUpdatedBlock(block, blockData); err != nil {
+		tx.Rollback()
+		return models.Block{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
 	// Create the event
 	event, err := models.NewEvent(
 		string(broker.BlockUpdated), // Use standard event type
@@ -293,9 +335,50 @@ func (s *BlockService) UpdateBlock(db *database.Database, id string, blockData m
 		return models.Block{}, err
 	}
 
+	refreshNotePreview(db.DB, block.NoteID)
+
 	return block, nil
 }
 
+// validateUpdatedBlock checks block with the type, content and metadata of
+// the update applied against its type's schema
+// refitStoredSpans normalizes a copy of the block's stored spans against
+// content. Spans that can't be read at all are dropped rather than blocking
+// the edit. It reports false when the block has no spans.
+func refitStoredSpans(block models.Block, content models.BlockContent) (models.BlockMetadata, bool) {
+	if _, exists := block.Metadata["spans"]; !exists {
+		return nil, false
+	}
+	metadata := models.BlockMetadata{}
+	for key, value := range block.Metadata {
+		metadata[key] = value
+	}
+	if err := models.NormalizeBlockSpans(content, metadata); err != nil {
+		log.Printf("Dropping unreadable spans of block %s: %v", block.ID, err)
+		delete(metadata, "spans")
+	}
+	return metadata, true
+}
+
+func validateUpdatedBlock(block models.Block, blockData map[string]interface{}) error {
+	blockType := block.Type
+	if updatedType, ok := blockData["type"].(string); ok {
+		blockType = models.BlockType(updatedType)
+	}
+	content := block.Content
+	if updatedContent, ok := blockData["content"].(models.BlockContent); ok {
+		content = updatedContent
+	}
+	metadata, ok := blockData["metadata"].(models.BlockMetadata)
+	if !ok {
+		metadata = models.BlockMetadata{}
+		for key, value := range block.Metadata {
+			metadata[key] = value
+		}
+	}
+	return models.ValidateBlock(blockType, content, metadata)
+}
+
 func (s *BlockService) DeleteBlock(db *database.Database, id string, params map[string]interface{}) error {
 	tx := db.DB.Begin()
 	if tx.Error != nil {
@@ -362,6 +445,8 @@ func (s *BlockService) DeleteBlock(db *database.Database, id string, params map[
 		return err
 	}
 
+	refreshNotePreview(db.DB, block.NoteID)
+
 	return nil
 }
 
@@ -422,9 +507,6 @@ func (s *BlockService) GetBlocks(db *database.Database, params map[string]interf
 
 	log.Printf("Using user_id: %s", userIDStr)
 
-	// Apply user filter
-	query = query.Where("user_id = ?", userIDStr)
-
 	// Apply additional filters
 	if noteID, ok := params["note_id"].(string); ok && noteID != "" {
 		// Check if user has access to this note
@@ -437,8 +519,13 @@ func (s *BlockService) GetBlocks(db *database.Database, params map[string]interf
 			return nil, errors.New("not authorized to access blocks from this note")
 		}
 
+		// Blocks of a shared note belong to its owner, so access to the note
+		// replaces the user filter
 		query = query.Where("note_id = ?", noteID)
 		log.Printf("Filtering by note_id: %s", noteID)
+	} else {
+		// Apply user filter
+		query = query.Where("user_id = ?", userIDStr)
 	}
 
 	if blockType, ok := params["type"].(string); ok && blockType != "" {
@@ -509,6 +596,29 @@ func (s *BlockService) GetBlocks(db *database.Database, params map[string]interf
 	return blocks, nil
 }
 
+// createGeneratedBlocks saves blocks made for the user's note by the server
+// rather than sent by a client, with the checks CreateBlock runs: each block
+// must match its schema and the note must stay within its block limit
+func createGeneratedBlocks(db *gorm.DB, userID, noteID uuid.UUID, blocks []models.Block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	for _, block := range blocks {
+		if err := models.NormalizeBlockSpans(block.Content, block.Metadata); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		if err := models.ValidateBlock(block.Type, block.Content, block.Metadata); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := checkBlocksLimit(tx, userID, noteID.String(), len(blocks)); err != nil {
+			return err
+		}
+		return tx.Create(&blocks).Error
+	})
+}
+
 // NewBlockService creates a new instance of BlockService
 func NewBlockService() BlockServiceInterface {
 	return &BlockService{}
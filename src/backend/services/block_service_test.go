@@ -11,6 +11,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -338,3 +339,92 @@ func TestGetBlocks_Success(t *testing.T) {
 	assert.Equal(t, "Test Content 2", blocks[1].Content["text"])
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestUpdateBlock_RejectsInvalidSpans(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock := setupMockDB(t)
+
+	blockID := uuid.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "type", "content"}).
+			AddRow(blockID, uuid.New(), "text", []byte(`{"text":"Héllo"}`)))
+	mock.ExpectRollback()
+
+	_, err := (&BlockService{}).UpdateBlock(db, blockID.String(), map[string]interface{}{
+		"metadata": map[string]interface{}{"spans": []interface{}{map[string]interface{}{"start": 0, "end": 2}}},
+	}, map[string]interface{}{"user_id": uuid.New().String()})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateBlock_RejectsMalformedBlock(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock := setupMockDB(t)
+
+	blockID := uuid.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "type", "content", "metadata"}).
+			AddRow(blockID, uuid.New(), "header", []byte(`{"text":"Title"}`), []byte(`{"level":1}`)))
+	mock.ExpectRollback()
+
+	_, err := (&BlockService{}).UpdateBlock(db, blockID.String(), map[string]interface{}{
+		"metadata": map[string]interface{}{"level": float64(9)},
+	}, map[string]interface{}{"user_id": uuid.New().String()})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.ErrorContains(t, err, "header block metadata level must be from 1 to 6")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateBlock_ChecksTheNewType(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock := setupMockDB(t)
+
+	// A text block turned into a link needs a url
+	blockID := uuid.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "type", "content", "metadata"}).
+			AddRow(blockID, uuid.New(), "text", []byte(`{"text":"example.com"}`), []byte(`{}`)))
+	mock.ExpectRollback()
+
+	_, err := (&BlockService{}).UpdateBlock(db, blockID.String(), map[string]interface{}{
+		"type": string(models.LinkBlock),
+	}, map[string]interface{}{"user_id": uuid.New().String()})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.ErrorContains(t, err, "link block needs content url")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateBlock_FitsStoredSpansToNewText(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock := setupMockDB(t)
+
+	blockID := uuid.New()
+	noteID := uuid.New()
+	columns := []string{"id", "note_id", "type", "content", "metadata"}
+	metadata := &capturedJSON{}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(blockID, noteID, "text", []byte(`{"text":"Hello world"}`), []byte(`{"spans":[{"start":6,"end":11,"type":"bold"}]}`)))
+	mock.ExpectQuery(`INSERT INTO "events"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectExec(`UPDATE "blocks" SET "content"=\$1,"metadata"=\$2`).
+		WithArgs(sqlmock.AnyArg(), metadata, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(blockID, noteID, "text", []byte(`{"text":"Hello wo"}`), []byte(`{}`)))
+	mock.ExpectCommit()
+	mock.ExpectExec(notePreviewUpdate).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err := (&BlockService{}).UpdateBlock(db, blockID.String(), map[string]interface{}{
+		"content": map[string]interface{}{"text": "Hello wo"},
+	}, map[string]interface{}{"user_id": uuid.New().String()})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"spans":[{"start":6,"end":8,"type":"bold"}]}`, string(metadata.value))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,362 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// bulkJobBatchSize is how many notes a bulk job handles between progress saves
+	bulkJobBatchSize = 100
+	// recentBulkJobsLimit bounds how many jobs ListJobs returns
+	recentBulkJobsLimit = 20
+	// maxBulkJobFailedNotes bounds how many failed notes a job lists
+	maxBulkJobFailedNotes = 100
+)
+
+// bulkJobHandler does the work of one type of bulk job
+type bulkJobHandler struct {
+	// prepare runs before a job's first batch; a resumed job skips it
+	prepare func(ctx context.Context) error
+	// process handles a batch of notes and returns the ones that failed
+	process func(ctx context.Context, notes []models.Note) []uuid.UUID
+	// complete runs after a job's last batch; its error is logged and the
+	// job still completes
+	complete func(ctx context.Context) error
+	// allNotes jobs rebuild shared state, so they cover every note whatever
+	// scope they are started with
+	allNotes bool
+	// usesAI jobs can't be started while AI is paused, and running ones
+	// wait between batches until it is resumed
+	usesAI bool
+}
+
+// BulkJobService runs operations over many notes in the background and
+// persists their progress in bulk_jobs. Jobs that were running when the
+// server stopped are resumed from their cursor by Start.
+type BulkJobService struct {
+	db       *gorm.DB
+	handlers map[string]bulkJobHandler
+
+	mu        sync.Mutex
+	isRunning bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// BulkJobServiceInstance is the shared bulk job runner; nil until set up in main
+var BulkJobServiceInstance *BulkJobService
+
+// NewBulkJobService creates a runner for the process-all and reindex jobs
+func NewBulkJobService(db *gorm.DB, ai *AIService) *BulkJobService {
+	s := &BulkJobService{
+		db:       db,
+		handlers: make(map[string]bulkJobHandler),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	s.handlers[models.BulkJobProcessAll] = bulkJobHandler{
+		usesAI: true,
+		process: func(ctx context.Context, notes []models.Note) []uuid.UUID {
+			var failed []uuid.UUID
+			for _, note := range notes {
+				if err := ai.ProcessNoteWithAI(ctx, note.ID); err != nil {
+					log.Printf("Bulk processing failed for note %s: %v", note.ID, err)
+					failed = append(failed, note.ID)
+				}
+			}
+			return failed
+		},
+	}
+	s.handlers[models.BulkJobReindex] = bulkJobHandler{
+		prepare:  ai.resetNoteCollection,
+		allNotes: true,
+		// Notes deleted or trashed while the job ran keep their documents
+		complete: func(ctx context.Context) error {
+			_, err := ai.PruneOrphanedChromaDocuments(ctx)
+			return err
+		},
+		// Notes ChromaDB rejects are left out and the rest are indexed
+		process: func(ctx context.Context, notes []models.Note) []uuid.UUID {
+			notIndexed, err := ai.indexNotes(ctx, notes)
+			if err != nil {
+				log.Printf("Failed to reindex %d notes: %v", len(notes), err)
+				failed := make([]uuid.UUID, len(notes))
+				for i, note := range notes {
+					failed[i] = note.ID
+				}
+				return failed
+			}
+			if len(notIndexed) > 0 {
+				log.Printf("ChromaDB rejected notes %v", notIndexed)
+			}
+			return notIndexed
+		},
+	}
+	return s
+}
+
+// Start resumes the jobs that were running when the server last stopped
+func (s *BulkJobService) Start() {
+	s.mu.Lock()
+	if s.isRunning {
+		s.mu.Unlock()
+		return
+	}
+	s.isRunning = true
+	s.mu.Unlock()
+
+	var jobs []models.BulkJob
+	if err := s.db.Where("status = ?", models.BulkJobRunning).Find(&jobs).Error; err != nil {
+		log.Printf("Failed to load interrupted bulk jobs: %v", err)
+		return
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		if _, ok := s.handlers[job.Type]; !ok {
+			s.finish(job, models.BulkJobFailed, fmt.Errorf("unknown job type %q", job.Type))
+			continue
+		}
+		log.Printf("Resuming %s job %s at %d of %d notes", job.Type, job.ID, job.Processed, job.Total)
+		s.launch(job)
+	}
+}
+
+// Stop interrupts running jobs and waits up to timeout for their current
+// batch to end. The jobs stay running in the database and resume on the
+// next Start.
+func (s *BulkJobService) Stop(timeout time.Duration) {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("Bulk jobs still in progress after %s", timeout)
+	}
+}
+
+// StartJob records a new job of jobType over the notes in scope and runs it
+// in the background. Only one job of a type runs at a time; starting another
+// returns ErrBulkJobRunning, and AI jobs return ErrAIPaused while AI is paused.
+func (s *BulkJobService) StartJob(jobType string, userID uuid.UUID, scope map[string]interface{}) (*models.BulkJob, error) {
+	handler, ok := s.handlers[jobType]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown job type %q", ErrInvalidInput, jobType)
+	}
+	if handler.usesAI && AIPauseInstance.Paused() {
+		return nil, ErrAIPaused
+	}
+	if handler.allNotes || scope == nil {
+		scope = map[string]interface{}{}
+	}
+	if notebookID, _ := scope["notebook_id"].(string); notebookID != "" {
+		if _, err := uuid.Parse(notebookID); err != nil {
+			return nil, fmt.Errorf("%w: notebook_id must be a valid UUID", ErrInvalidInput)
+		}
+	}
+
+	if running, err := s.isTypeRunning(jobType); err != nil {
+		return nil, err
+	} else if running {
+		return nil, ErrBulkJobRunning
+	}
+
+	var total int64
+	if err := scopeBulkJobNotes(s.db.Model(&models.Note{}), scope).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	job := &models.BulkJob{
+		UserID:    userID,
+		Type:      jobType,
+		Scope:     models.AIMetadata(scope),
+		Status:    models.BulkJobRunning,
+		Total:     int(total),
+		StartedAt: time.Now(),
+	}
+	if err := s.db.Create(job).Error; err != nil {
+		// The unique index on running jobs catches a job started concurrently
+		if running, _ := s.isTypeRunning(jobType); running {
+			return nil, ErrBulkJobRunning
+		}
+		return nil, err
+	}
+
+	s.launch(job)
+	return job, nil
+}
+
+// GetJob returns one of the user's jobs
+func (s *BulkJobService) GetJob(jobID string, userID uuid.UUID) (*models.BulkJob, error) {
+	id, err := uuid.Parse(jobID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid job id", ErrInvalidInput)
+	}
+
+	var job models.BulkJob
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListJobs returns the user's most recently started jobs
+func (s *BulkJobService) ListJobs(userID uuid.UUID) ([]models.BulkJob, error) {
+	var jobs []models.BulkJob
+	err := s.db.Where("user_id = ?", userID).
+		Order("started_at DESC").
+		Limit(recentBulkJobsLimit).
+		Find(&jobs).Error
+	return jobs, err
+}
+
+func (s *BulkJobService) isTypeRunning(jobType string) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.BulkJob{}).
+		Where("type = ? AND status = ?", jobType, models.BulkJobRunning).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *BulkJobService) launch(job *models.BulkJob) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				s.finish(job, models.BulkJobFailed, fmt.Errorf("job panicked: %v", r))
+			}
+		}()
+		s.runJob(s.ctx, job)
+	}()
+}
+
+// runJob works through the job's notes in id order from its cursor, saving
+// progress after every batch. When ctx is cancelled the job is left running
+// so the batch in hand is redone on resume.
+func (s *BulkJobService) runJob(ctx context.Context, job *models.BulkJob) {
+	handler := s.handlers[job.Type]
+
+	if job.Cursor == "" && handler.prepare != nil {
+		if err := handler.prepare(ctx); err != nil {
+			if ctx.Err() == nil {
+				s.finish(job, models.BulkJobFailed, err)
+			}
+			return
+		}
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		if handler.usesAI {
+			if err := AIPauseInstance.Wait(ctx); err != nil {
+				return
+			}
+		}
+
+		query := scopeBulkJobNotes(s.db.WithContext(ctx), job.Scope)
+		if job.Cursor != "" {
+			query = query.Where("id > ?", job.Cursor)
+		}
+		var notes []models.Note
+		if err := query.Order("id ASC").Limit(bulkJobBatchSize).Find(&notes).Error; err != nil {
+			if ctx.Err() == nil {
+				s.finish(job, models.BulkJobFailed, fmt.Errorf("failed to load notes: %w", err))
+			}
+			return
+		}
+		if len(notes) == 0 {
+			if handler.complete != nil {
+				if err := handler.complete(ctx); err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					log.Printf("Failed to complete %s job %s: %v", job.Type, job.ID, err)
+				}
+			}
+			s.finish(job, models.BulkJobCompleted, nil)
+			return
+		}
+
+		failed := handler.process(ctx, notes)
+		if ctx.Err() != nil {
+			return
+		}
+
+		job.Processed += len(notes)
+		job.Failed += len(failed)
+		for _, noteID := range failed {
+			if len(job.FailedNoteIDs) < maxBulkJobFailedNotes {
+				job.FailedNoteIDs = append(job.FailedNoteIDs, noteID.String())
+			}
+		}
+		job.Cursor = notes[len(notes)-1].ID.String()
+		job.UpdatedAt = time.Now()
+		progress := map[string]interface{}{
+			"processed":  job.Processed,
+			"failed":     job.Failed,
+			"cursor":     job.Cursor,
+			"updated_at": job.UpdatedAt,
+		}
+		if len(failed) > 0 {
+			progress["failed_note_ids"] = job.FailedNoteIDs
+		}
+		if err := s.db.Model(&models.BulkJob{}).Where("id = ?", job.ID).Updates(progress).Error; err != nil {
+			log.Printf("Failed to save progress of %s job %s: %v", job.Type, job.ID, err)
+		}
+	}
+}
+
+// finish records the final status of a job
+func (s *BulkJobService) finish(job *models.BulkJob, status string, jobErr error) {
+	now := time.Now()
+	job.Status = status
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+	if jobErr != nil {
+		job.Error = jobErr.Error()
+		log.Printf("%s job %s failed: %v", job.Type, job.ID, jobErr)
+	}
+
+	if err := s.db.Model(&models.BulkJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"status":      job.Status,
+		"error":       job.Error,
+		"updated_at":  job.UpdatedAt,
+		"finished_at": job.FinishedAt,
+	}).Error; err != nil {
+		log.Printf("Failed to save status of %s job %s: %v", job.Type, job.ID, err)
+	}
+}
+
+// scopeBulkJobNotes restricts a notes query to the non-trashed notes a job covers
+func scopeBulkJobNotes(query *gorm.DB, scope map[string]interface{}) *gorm.DB {
+	query = query.Scopes(models.NotTrashed)
+	if userID, _ := scope["user_id"].(string); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if notebookID, _ := scope["notebook_id"].(string); notebookID != "" {
+		query = query.Where("notebook_id = ?", notebookID)
+	}
+	return query
+}
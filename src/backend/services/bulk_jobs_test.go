@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	runningJobsQuery = `SELECT count\(\*\) FROM "bulk_jobs" WHERE type = \$1 AND status = \$2`
+	jobUpdate        = `UPDATE "bulk_jobs" SET .* WHERE id = `
+)
+
+// newTestBulkJobService returns a runner with a single "test" job type
+func newTestBulkJobService(db *database.Database, handler bulkJobHandler) *BulkJobService {
+	s := NewBulkJobService(db.DB, nil)
+	s.handlers = map[string]bulkJobHandler{"test": handler}
+	return s
+}
+
+func TestStartJob_OnlyOneJobOfATypeRuns(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	s := newTestBulkJobService(db, bulkJobHandler{})
+	mock.ExpectQuery(runningJobsQuery).
+		WithArgs("test", models.BulkJobRunning).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	_, err := s.StartJob("test", uuid.New(), nil)
+	assert.ErrorIs(t, err, ErrBulkJobRunning)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStartJob_RejectsUnknownType(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	s := newTestBulkJobService(db, bulkJobHandler{})
+	_, err := s.StartJob("defragment", uuid.New(), nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunJob_SavesProgressAndCompletes(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	prepared := false
+	var seen []models.Note
+	s := newTestBulkJobService(db, bulkJobHandler{
+		prepare: func(ctx context.Context) error {
+			prepared = true
+			return nil
+		},
+		process: func(ctx context.Context, notes []models.Note) []uuid.UUID {
+			seen = append(seen, notes...)
+			return []uuid.UUID{notes[0].ID}
+		},
+	})
+
+	userID, first, last := uuid.New(), uuid.New(), uuid.New()
+	job := &models.BulkJob{ID: uuid.New(), Type: "test", Status: models.BulkJobRunning, Total: 2,
+		Scope: models.AIMetadata{"user_id": userID.String()}}
+
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE user_id = \$1 AND "notes"."deleted_at" IS NULL ORDER BY id ASC LIMIT \$2`).
+		WithArgs(userID.String(), bulkJobBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(first).AddRow(last))
+	mock.ExpectBegin()
+	mock.ExpectExec(jobUpdate).
+		WithArgs(last.String(), 1, `{"`+first.String()+`"}`, 2, sqlmock.AnyArg(), job.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE user_id = \$1 AND id > \$2 AND "notes"."deleted_at" IS NULL ORDER BY id ASC LIMIT \$3`).
+		WithArgs(userID.String(), last.String(), bulkJobBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(jobUpdate).
+		WithArgs("", sqlmock.AnyArg(), models.BulkJobCompleted, sqlmock.AnyArg(), job.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	s.runJob(context.Background(), job)
+
+	assert.True(t, prepared)
+	assert.Len(t, seen, 2)
+	assert.Equal(t, models.BulkJobCompleted, job.Status)
+	assert.Equal(t, 2, job.Processed)
+	assert.Equal(t, 1, job.Failed)
+	assert.Equal(t, []string{first.String()}, []string(job.FailedNoteIDs))
+	assert.NotNil(t, job.FinishedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunJob_ResumesFromCursor(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	completed := false
+	s := newTestBulkJobService(db, bulkJobHandler{
+		prepare: func(ctx context.Context) error {
+			t.Error("a resumed job must not be prepared again")
+			return nil
+		},
+		process: func(ctx context.Context, notes []models.Note) []uuid.UUID { return nil },
+		complete: func(ctx context.Context) error {
+			completed = true
+			return nil
+		},
+	})
+
+	cursor := uuid.New().String()
+	job := &models.BulkJob{ID: uuid.New(), Type: "test", Status: models.BulkJobRunning, Processed: 100, Cursor: cursor}
+
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE id > \$1 AND "notes"."deleted_at" IS NULL ORDER BY id ASC LIMIT \$2`).
+		WithArgs(cursor, bulkJobBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(jobUpdate).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	s.runJob(context.Background(), job)
+
+	assert.Equal(t, models.BulkJobCompleted, job.Status)
+	assert.Equal(t, 100, job.Processed)
+	assert.True(t, completed, "a resumed job still runs its completion")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunJob_InterruptedJobStaysRunning(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newTestBulkJobService(db, bulkJobHandler{
+		process: func(ctx context.Context, notes []models.Note) []uuid.UUID {
+			// Shutdown arrives mid-batch
+			cancel()
+			return []uuid.UUID{notes[0].ID}
+		},
+	})
+
+	job := &models.BulkJob{ID: uuid.New(), Type: "test", Status: models.BulkJobRunning}
+	mock.ExpectQuery(`SELECT \* FROM "notes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+
+	s.runJob(ctx, job)
+
+	// Nothing is saved, so the batch is redone when the job resumes
+	assert.Equal(t, models.BulkJobRunning, job.Status)
+	assert.Zero(t, job.Processed)
+	assert.Empty(t, job.Cursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunJob_FailsWhenPrepareFails(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	s := newTestBulkJobService(db, bulkJobHandler{
+		prepare: func(ctx context.Context) error { return assert.AnError },
+		process: func(ctx context.Context, notes []models.Note) []uuid.UUID {
+			t.Error("no notes should be processed")
+			return nil
+		},
+	})
+
+	job := &models.BulkJob{ID: uuid.New(), Type: "test", Status: models.BulkJobRunning}
+	mock.ExpectBegin()
+	mock.ExpectExec(jobUpdate).
+		WithArgs(assert.AnError.Error(), sqlmock.AnyArg(), models.BulkJobFailed, sqlmock.AnyArg(), job.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	s.runJob(context.Background(), job)
+
+	require.Equal(t, models.BulkJobFailed, job.Status)
+	assert.Equal(t, assert.AnError.Error(), job.Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Conflict policies, deciding which version wins when an event changed both
+// locally and in Google between syncs
+const (
+	ConflictGoogleWins = "google-wins"
+	ConflictLocalWins  = "local-wins"
+	ConflictNewestWins = "newest-wins"
+	ConflictManual     = "manual"
+)
+
+// Conflict statuses and resolutions
+const (
+	ConflictOpen     = "open"
+	ConflictResolved = "resolved"
+
+	ResolveWithGoogle = "google"
+	ResolveWithLocal  = "local"
+)
+
+// calendarPushAttempts is how many times a change is sent to Google while it
+// fails transiently
+const calendarPushAttempts = 3
+
+// ValidConflictPolicy tells whether policy is one of the conflict policies
+func ValidConflictPolicy(policy string) bool {
+	switch policy {
+	case ConflictGoogleWins, ConflictLocalWins, ConflictNewestWins, ConflictManual:
+		return true
+	}
+	return false
+}
+
+// defaultConflictPolicy reads CALENDAR_CONFLICT_POLICY, google-wins unless set
+func defaultConflictPolicy() string {
+	policy := os.Getenv("CALENDAR_CONFLICT_POLICY")
+	if policy == "" {
+		return ConflictGoogleWins
+	}
+	if !ValidConflictPolicy(policy) {
+		log.Printf("Unknown CALENDAR_CONFLICT_POLICY %q, using %s", policy, ConflictGoogleWins)
+		return ConflictGoogleWins
+	}
+	return policy
+}
+
+// conflictPolicy is the policy of a synced calendar. One-way syncs always
+// keep the side they sync from.
+func conflictPolicy(sync *models.CalendarSync) string {
+	switch sync.SyncDirection {
+	case "read_only":
+		return ConflictGoogleWins
+	case "write_only":
+		return ConflictLocalWins
+	}
+	if ValidConflictPolicy(sync.ConflictPolicy) {
+		return sync.ConflictPolicy
+	}
+	return defaultConflictPolicy()
+}
+
+// isTransientGoogleError tells whether a Google Calendar call may succeed
+// when tried again
+func isTransientGoogleError(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryGoogle calls call until it succeeds, fails for good or has been tried
+// calendarPushAttempts times, waiting longer after each failure
+func (cs *CalendarService) retryGoogle(call func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || !isTransientGoogleError(err) || attempt == calendarPushAttempts {
+			return err
+		}
+		log.Printf("Google Calendar call failed (attempt %d of %d): %v", attempt, calendarPushAttempts, err)
+		time.Sleep(time.Duration(attempt) * cs.retryDelay)
+	}
+}
+
+// googleUpdatedAt parses the updated time of a Google event
+func googleUpdatedAt(googleEvent *calendar.Event) *time.Time {
+	updated, err := time.Parse(time.RFC3339, googleEvent.Updated)
+	if err != nil {
+		return nil
+	}
+	return &updated
+}
+
+// googleChanged tells whether incoming, the version Google sent, differs from
+// the Google version event was last synced with
+func googleChanged(event, incoming *models.CalendarEvent) bool {
+	if event.GoogleUpdatedAt == nil || incoming.GoogleUpdatedAt == nil {
+		return true
+	}
+	return incoming.GoogleSequence != event.GoogleSequence || !incoming.GoogleUpdatedAt.Equal(*event.GoogleUpdatedAt)
+}
+
+// eventVersion is the version of event kept in a conflict; updatedAt is when
+// that version was made
+func eventVersion(event *models.CalendarEvent, updatedAt time.Time) models.CalendarEventVersion {
+	return models.CalendarEventVersion{
+		Title:       event.Title,
+		Description: event.Description,
+		Location:    event.Location,
+		StartTime:   event.StartTime,
+		EndTime:     event.EndTime,
+		AllDay:      event.AllDay,
+		TimeZone:    event.TimeZone,
+		Status:      event.Status,
+		Sequence:    event.GoogleSequence,
+		UpdatedAt:   updatedAt,
+	}
+}
+
+// googleEventFrom builds the Google version of a local event
+func googleEventFrom(event *models.CalendarEvent) *calendar.Event {
+	googleEvent := &calendar.Event{
+		Summary:     event.Title,
+		Description: event.Description,
+		Location:    event.Location,
+	}
+	if event.AllDay {
+		googleEvent.Start = &calendar.EventDateTime{Date: event.StartTime.Format("2006-01-02")}
+		googleEvent.End = &calendar.EventDateTime{Date: event.EndTime.Format("2006-01-02")}
+	} else {
+		googleEvent.Start = &calendar.EventDateTime{DateTime: event.StartTime.Format(time.RFC3339), TimeZone: event.TimeZone}
+		googleEvent.End = &calendar.EventDateTime{DateTime: event.EndTime.Format(time.RFC3339), TimeZone: event.TimeZone}
+	}
+	return googleEvent
+}
+
+// pushEvent sends the local version of event to Google, retrying transient
+// failures, and returns the Google version it became
+func (cs *CalendarService) pushEvent(service *calendar.Service, event *models.CalendarEvent) (*calendar.Event, error) {
+	var updated *calendar.Event
+	err := cs.retryGoogle(func() error {
+		var err error
+		updated, err = service.Events.Update(event.GoogleCalendarID, event.GoogleEventID, googleEventFrom(event)).Do()
+		return err
+	})
+	return updated, err
+}
+
+// fetchEvent reads the Google version of event, retrying transient failures
+func (cs *CalendarService) fetchEvent(service *calendar.Service, event *models.CalendarEvent) (*calendar.Event, error) {
+	var remote *calendar.Event
+	err := cs.retryGoogle(func() error {
+		var err error
+		remote, err = service.Events.Get(event.GoogleCalendarID, event.GoogleEventID).Do()
+		return err
+	})
+	return remote, err
+}
+
+// markPushed records that Google has the local version of event
+func markPushed(event *models.CalendarEvent, updated *calendar.Event) {
+	event.GoogleSequence = updated.Sequence
+	event.GoogleUpdatedAt = googleUpdatedAt(updated)
+	event.LocalChangedAt = nil
+}
+
+// pushLocalVersion sends the pending local edit of event to Google and saves
+// the event as in sync
+func (cs *CalendarService) pushLocalVersion(service *calendar.Service, event *models.CalendarEvent) error {
+	updated, err := cs.pushEvent(service, event)
+	if err != nil {
+		return fmt.Errorf("failed to push local changes to Google Calendar: %w", err)
+	}
+	markPushed(event, updated)
+	return cs.db.Save(event).Error
+}
+
+// applyGoogleVersion replaces event with incoming, the version from Google,
+// dropping any pending local edit
+func (cs *CalendarService) applyGoogleVersion(event, incoming *models.CalendarEvent) error {
+	incoming.ID = event.ID
+	incoming.CreatedAt = event.CreatedAt
+	incoming.LocalChangedAt = nil
+	return cs.db.Save(incoming).Error
+}
+
+// resolveSyncConflict settles an event that was edited locally while Google
+// changed it too, following the calendar's conflict policy
+func (cs *CalendarService) resolveSyncConflict(service *calendar.Service, sync *models.CalendarSync, event, incoming *models.CalendarEvent) error {
+	policy := conflictPolicy(sync)
+	if policy == ConflictNewestWins {
+		policy = ConflictLocalWins
+		if incoming.GoogleUpdatedAt != nil && incoming.GoogleUpdatedAt.After(*event.LocalChangedAt) {
+			policy = ConflictGoogleWins
+		}
+	}
+	log.Printf("Event %s changed locally and in Google Calendar, resolving with %s", event.ID, policy)
+
+	switch policy {
+	case ConflictLocalWins:
+		return cs.pushLocalVersion(service, event)
+	case ConflictManual:
+		return cs.recordConflict(event, incoming)
+	default:
+		return cs.applyGoogleVersion(event, incoming)
+	}
+}
+
+// recordConflict stores the two versions of event for the user to pick from.
+// An event already in conflict gets the newer Google version.
+func (cs *CalendarService) recordConflict(event, incoming *models.CalendarEvent) error {
+	var googleUpdated time.Time
+	if incoming.GoogleUpdatedAt != nil {
+		googleUpdated = *incoming.GoogleUpdatedAt
+	}
+	google := eventVersion(incoming, googleUpdated)
+
+	var conflict models.CalendarConflict
+	err := cs.db.Session(&gorm.Session{Logger: cs.db.Logger.LogMode(logger.Silent)}).
+		Where("event_id = ? AND status = ?", event.ID, ConflictOpen).First(&conflict).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		conflict = models.CalendarConflict{
+			UserID:           event.UserID,
+			EventID:          event.ID,
+			GoogleCalendarID: event.GoogleCalendarID,
+			GoogleEventID:    event.GoogleEventID,
+			Local:            eventVersion(event, *event.LocalChangedAt),
+			Google:           google,
+			Status:           ConflictOpen,
+		}
+		if err := cs.db.Create(&conflict).Error; err != nil {
+			return fmt.Errorf("failed to record calendar conflict: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return cs.db.Model(&conflict).Update("google", google).Error
+}
+
+// pushPendingEvents sends the local edits of the calendar's events that
+// didn't reach Google yet. Events waiting on a manual resolution are left
+// alone.
+func (cs *CalendarService) pushPendingEvents(ctx context.Context, service *calendar.Service, sync *models.CalendarSync) {
+	var events []models.CalendarEvent
+	if err := cs.db.WithContext(ctx).
+		Where("user_id = ? AND google_calendar_id = ? AND local_changed_at IS NOT NULL", sync.UserID, sync.GoogleCalendarID).
+		Where("id NOT IN (?)", cs.db.Model(&models.CalendarConflict{}).Select("event_id").Where("status = ?", ConflictOpen)).
+		Find(&events).Error; err != nil {
+		log.Printf("Failed to load unsynced local edits of calendar %s: %v", sync.GoogleCalendarID, err)
+		return
+	}
+	for i := range events {
+		if err := cs.pushLocalVersion(service, &events[i]); err != nil {
+			log.Printf("Failed to sync local edit of event %s: %v", events[i].ID, err)
+		}
+	}
+}
+
+// GetConflicts lists the user's calendar conflicts with status, the open
+// ones when empty, newest first
+func (cs *CalendarService) GetConflicts(ctx context.Context, userID uuid.UUID, status string) ([]models.CalendarConflict, error) {
+	if status == "" {
+		status = ConflictOpen
+	}
+	conflicts := []models.CalendarConflict{}
+	if err := cs.db.WithContext(ctx).Where("user_id = ? AND status = ?", userID, status).
+		Order("created_at DESC").Find(&conflicts).Error; err != nil {
+		return nil, fmt.Errorf("failed to load calendar conflicts: %w", err)
+	}
+	return conflicts, nil
+}
+
+// ResolveConflict settles an open conflict with the version resolution
+// names: google takes the Google version locally, local sends the local
+// version to Google.
+func (cs *CalendarService) ResolveConflict(ctx context.Context, userID, conflictID uuid.UUID, resolution string) (*models.CalendarConflict, error) {
+	if resolution != ResolveWithGoogle && resolution != ResolveWithLocal {
+		return nil, fmt.Errorf("%w: resolution must be google or local", ErrInvalidInput)
+	}
+
+	var conflict models.CalendarConflict
+	if err := cs.db.WithContext(ctx).Where("id = ? AND user_id = ? AND status = ?", conflictID, userID, ConflictOpen).
+		First(&conflict).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: no open conflict %s", ErrNotFound, conflictID)
+		}
+		return nil, err
+	}
+	var event models.CalendarEvent
+	if err := cs.db.WithContext(ctx).Where("id = ? AND user_id = ?", conflict.EventID, userID).First(&event).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: the event of conflict %s is gone", ErrEventNotFound, conflictID)
+		}
+		return nil, err
+	}
+
+	if resolution == ResolveWithGoogle {
+		google := conflict.Google
+		event.Title = google.Title
+		event.Description = google.Description
+		event.Location = google.Location
+		event.StartTime = google.StartTime
+		event.EndTime = google.EndTime
+		event.AllDay = google.AllDay
+		event.TimeZone = google.TimeZone
+		event.Status = google.Status
+		event.GoogleSequence = google.Sequence
+		event.GoogleUpdatedAt = &google.UpdatedAt
+		event.LocalChangedAt = nil
+		if err := cs.db.WithContext(ctx).Save(&event).Error; err != nil {
+			return nil, fmt.Errorf("failed to save calendar event: %w", err)
+		}
+	} else {
+		service, err := cs.GetCalendarClient(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := cs.pushLocalVersion(service, &event); err != nil {
+			return nil, err
+		}
+	}
+
+	now := cs.now()
+	conflict.Status = ConflictResolved
+	conflict.Resolution = resolution
+	conflict.ResolvedAt = &now
+	if err := cs.db.WithContext(ctx).Save(&conflict).Error; err != nil {
+		return nil, fmt.Errorf("failed to save calendar conflict: %w", err)
+	}
+	return &conflict, nil
+}
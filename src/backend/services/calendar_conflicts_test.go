@@ -0,0 +1,332 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// googleEditedAt is when the Google version served by newConflictGoogle was
+// changed
+var googleEditedAt = time.Date(2025, 3, 4, 10, 0, 0, 0, time.UTC)
+
+// conflictGoogle serves the "standup" event of the "work" calendar, renamed
+// in Google at sequence 2, both in listings and on its own, and answers
+// updates with the given statuses before succeeding
+type conflictGoogle struct {
+	*httptest.Server
+	statuses []int
+	pushes   int
+}
+
+func newConflictGoogle(t *testing.T, statuses ...int) *conflictGoogle {
+	g := &conflictGoogle{statuses: statuses}
+	g.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/calendars/work/events":
+			io.WriteString(w, `{"items":[{"id":"standup","status":"confirmed","summary":"Standup (Google)","sequence":2,`+
+				`"updated":"2025-03-04T10:00:00Z","start":{"dateTime":"2025-03-05T09:00:00Z"},"end":{"dateTime":"2025-03-05T09:15:00Z"}}],"nextSyncToken":"next"}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/calendars/work/events/standup":
+			io.WriteString(w, `{"id":"standup","status":"confirmed","summary":"Standup (Google)","sequence":2,`+
+				`"updated":"2025-03-04T10:00:00Z","start":{"dateTime":"2025-03-05T09:00:00Z"},"end":{"dateTime":"2025-03-05T09:15:00Z"}}`)
+		case r.Method == http.MethodPut && r.URL.Path == "/calendars/work/events/standup":
+			g.pushes++
+			if len(g.statuses) > 0 {
+				status := g.statuses[0]
+				g.statuses = g.statuses[1:]
+				w.WriteHeader(status)
+				io.WriteString(w, `{"error":{"code":503,"message":"Backend Error"}}`)
+				return
+			}
+			io.WriteString(w, `{"id":"standup","sequence":3,"updated":"2025-03-04T11:00:00Z"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(g.Close)
+	return g
+}
+
+func newConflictTestService(t *testing.T, db *gorm.DB, google *conflictGoogle) *CalendarService {
+	cs, _ := newTokenTestCalendarService(t, db, time.Now(), http.StatusOK, `{}`)
+	cs.endpoint = google.URL + "/"
+	return cs
+}
+
+func expectCalendarCredentials(mock sqlmock.Sqlmock, userID uuid.UUID) {
+	mock.ExpectQuery(`SELECT \* FROM "google_calendar_credentials"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "access_token", "refresh_token", "token_type", "expires_at", "key_version"}).
+			AddRow(uuid.New(), userID, "access", "refresh", "Bearer", time.Now().Add(time.Hour), 0))
+}
+
+// expectLocallyEditedEvent returns the standup event as last synced at
+// sequence 1 and renamed locally at localChangedAt without reaching Google
+func expectLocallyEditedEvent(mock sqlmock.Sqlmock, userID, eventID uuid.UUID, localChangedAt time.Time) {
+	mock.ExpectQuery(`SELECT \* FROM "calendar_events" WHERE \(user_id = \$1 AND google_event_id = \$2\)`).
+		WithArgs(userID, "standup", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "google_event_id", "google_calendar_id", "title", "start_time", "end_time",
+			"time_zone", "google_sequence", "google_updated_at", "local_changed_at"}).
+			AddRow(eventID, userID, "standup", "work", "Standup (local)", time.Date(2025, 3, 5, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 3, 5, 9, 15, 0, 0, time.UTC), "UTC", 1, time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC), localChangedAt))
+}
+
+func expectSyncFinished(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT \* FROM "calendar_events" WHERE \(user_id = \$1 AND google_calendar_id = \$2 AND local_changed_at IS NOT NULL\) ` +
+		`AND id NOT IN \(SELECT "event_id" FROM "calendar_conflicts" WHERE status = \$3\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "calendar_syncs"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+// savedTitle matches the title saved for the event
+type savedTitle string
+
+func (title savedTitle) Match(value driver.Value) bool {
+	return value == string(title)
+}
+
+func expectEventSaved(mock sqlmock.Sqlmock, title string) {
+	// Save writes the 23 columns after the ID, title fourth, then the ID
+	args := make([]driver.Value, 24)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	args[3] = savedTitle(title)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "calendar_events" SET .*"title"=\$4`).WithArgs(args...).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestPerformSync_ConcurrentEditsFollowConflictPolicy(t *testing.T) {
+	cases := []struct {
+		name           string
+		policy         string
+		localChangedAt time.Time
+		wantTitle      string // Saved title; empty when a conflict is recorded instead
+		wantPushes     int
+	}{
+		{"google wins", ConflictGoogleWins, googleEditedAt.Add(time.Hour), "Standup (Google)", 0},
+		{"local wins", ConflictLocalWins, googleEditedAt.Add(-time.Hour), "Standup (local)", 1},
+		{"newest wins, Google newer", ConflictNewestWins, googleEditedAt.Add(-time.Hour), "Standup (Google)", 0},
+		{"newest wins, local newer", ConflictNewestWins, googleEditedAt.Add(time.Hour), "Standup (local)", 1},
+		{"manual", ConflictManual, googleEditedAt.Add(time.Hour), "", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, close := testutils.SetupMockDB()
+			defer close()
+			google := newConflictGoogle(t)
+			cs := newConflictTestService(t, db.DB, google)
+
+			userID, eventID := uuid.New(), uuid.New()
+			expectCalendarCredentials(mock, userID)
+			expectLocallyEditedEvent(mock, userID, eventID, tc.localChangedAt)
+			if tc.wantTitle != "" {
+				expectEventSaved(mock, tc.wantTitle)
+			} else {
+				mock.ExpectQuery(`SELECT \* FROM "calendar_conflicts" WHERE event_id = \$1 AND status = \$2`).
+					WithArgs(eventID, ConflictOpen, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "calendar_conflicts"`).
+					WithArgs(userID, eventID, "work", "standup", sqlmock.AnyArg(), sqlmock.AnyArg(), ConflictOpen, "", nil).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(uuid.New(), time.Now(), time.Now()))
+				mock.ExpectCommit()
+			}
+			expectSyncFinished(mock)
+
+			sync := &models.CalendarSync{ID: uuid.New(), UserID: userID, GoogleCalendarID: "work", SyncDirection: "bidirectional", ConflictPolicy: tc.policy}
+			synced, err := cs.performSync(context.Background(), userID, sync)
+			require.NoError(t, err)
+			assert.Equal(t, 1, synced)
+			assert.Equal(t, tc.wantPushes, google.pushes)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPerformSync_PushesLocalEditGoogleDidNotChange(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	google := newConflictGoogle(t)
+	cs := newConflictTestService(t, db.DB, google)
+
+	userID, eventID := uuid.New(), uuid.New()
+	expectCalendarCredentials(mock, userID)
+	// Last synced with the version Google still has
+	mock.ExpectQuery(`SELECT \* FROM "calendar_events" WHERE \(user_id = \$1 AND google_event_id = \$2\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "google_event_id", "google_calendar_id", "title", "google_sequence", "google_updated_at", "local_changed_at"}).
+			AddRow(eventID, userID, "standup", "work", "Standup (local)", 2, googleEditedAt, googleEditedAt.Add(-time.Hour)))
+	expectEventSaved(mock, "Standup (local)")
+	expectSyncFinished(mock)
+
+	// Even with Google winning conflicts, a one-sided local edit is kept
+	sync := &models.CalendarSync{ID: uuid.New(), UserID: userID, GoogleCalendarID: "work", ConflictPolicy: ConflictGoogleWins}
+	_, err := cs.performSync(context.Background(), userID, sync)
+	require.NoError(t, err)
+	assert.Equal(t, 1, google.pushes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConflictPolicy(t *testing.T) {
+	t.Setenv("CALENDAR_CONFLICT_POLICY", "")
+	assert.Equal(t, ConflictGoogleWins, conflictPolicy(&models.CalendarSync{SyncDirection: "bidirectional"}))
+
+	t.Setenv("CALENDAR_CONFLICT_POLICY", ConflictManual)
+	assert.Equal(t, ConflictManual, conflictPolicy(&models.CalendarSync{SyncDirection: "bidirectional"}))
+	assert.Equal(t, ConflictNewestWins, conflictPolicy(&models.CalendarSync{ConflictPolicy: ConflictNewestWins}))
+
+	// One-way syncs keep the side they sync from
+	assert.Equal(t, ConflictGoogleWins, conflictPolicy(&models.CalendarSync{SyncDirection: "read_only", ConflictPolicy: ConflictManual}))
+	assert.Equal(t, ConflictLocalWins, conflictPolicy(&models.CalendarSync{SyncDirection: "write_only", ConflictPolicy: ConflictManual}))
+
+	t.Setenv("CALENDAR_CONFLICT_POLICY", "coin-toss")
+	assert.Equal(t, ConflictGoogleWins, conflictPolicy(&models.CalendarSync{}))
+}
+
+func TestUpdateEvent_RetriesTransientGoogleFailures(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	google := newConflictGoogle(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	cs := newConflictTestService(t, db.DB, google)
+
+	userID, eventID := uuid.New(), uuid.New()
+	mock.ExpectQuery(`SELECT \* FROM "calendar_events" WHERE \(id = \$1 AND user_id = \$2\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "google_event_id", "google_calendar_id", "title", "google_sequence", "google_updated_at"}).
+			AddRow(eventID, userID, "standup", "work", "Standup", 2, googleEditedAt))
+	expectCalendarCredentials(mock, userID)
+	expectEventSaved(mock, "Standup (moved)")
+
+	start := time.Date(2025, 3, 5, 10, 0, 0, 0, time.UTC)
+	event, err := cs.UpdateEvent(context.Background(), userID, eventID, CalendarEventRequest{
+		Title:     "Standup (moved)",
+		StartTime: FlexibleTime{Time: start},
+		EndTime:   FlexibleTime{Time: start.Add(15 * time.Minute)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, google.pushes)
+	assert.Equal(t, int64(3), event.GoogleSequence)
+	assert.Nil(t, event.LocalChangedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateEvent_KeepsEditWhileGoogleIsDown(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	google := newConflictGoogle(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	cs := newConflictTestService(t, db.DB, google)
+
+	userID, eventID := uuid.New(), uuid.New()
+	mock.ExpectQuery(`SELECT \* FROM "calendar_events" WHERE \(id = \$1 AND user_id = \$2\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "google_event_id", "google_calendar_id", "title", "google_sequence", "google_updated_at"}).
+			AddRow(eventID, userID, "standup", "work", "Standup", 2, googleEditedAt))
+	expectCalendarCredentials(mock, userID)
+	expectEventSaved(mock, "Standup (moved)")
+
+	event, err := cs.UpdateEvent(context.Background(), userID, eventID, CalendarEventRequest{Title: "Standup (moved)"})
+	require.NoError(t, err)
+	assert.Equal(t, calendarPushAttempts, google.pushes)
+	require.NotNil(t, event.LocalChangedAt, "the edit waits for the next sync")
+	assert.Equal(t, int64(2), event.GoogleSequence)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateEvent_EditsMadeInGoogleFollowConflictPolicy(t *testing.T) {
+	cases := []struct {
+		name      string
+		policy    string
+		wantTitle string // Title the event ends with; empty when a conflict is recorded
+	}{
+		{"google wins", ConflictGoogleWins, "Standup (Google)"},
+		{"manual", ConflictManual, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, close := testutils.SetupMockDB()
+			defer close()
+			google := newConflictGoogle(t)
+			cs := newConflictTestService(t, db.DB, google)
+
+			// Last synced at sequence 1, before the rename in Google
+			userID, eventID := uuid.New(), uuid.New()
+			mock.ExpectQuery(`SELECT \* FROM "calendar_events" WHERE \(id = \$1 AND user_id = \$2\)`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "google_event_id", "google_calendar_id", "title", "google_sequence", "google_updated_at"}).
+					AddRow(eventID, userID, "standup", "work", "Standup", 1, time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC)))
+			expectCalendarCredentials(mock, userID)
+			expectEventSaved(mock, "Standup (moved)")
+			mock.ExpectQuery(`SELECT \* FROM "calendar_syncs" WHERE \(user_id = \$1 AND google_calendar_id = \$2\)`).
+				WithArgs(userID, "work", 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "google_calendar_id", "sync_direction", "conflict_policy"}).
+					AddRow(uuid.New(), userID, "work", "bidirectional", tc.policy))
+			title := tc.wantTitle
+			if title != "" {
+				expectEventSaved(mock, title)
+			} else {
+				title = "Standup (moved)"
+				mock.ExpectQuery(`SELECT \* FROM "calendar_conflicts" WHERE event_id = \$1 AND status = \$2`).
+					WithArgs(eventID, ConflictOpen, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "calendar_conflicts"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(uuid.New(), time.Now(), time.Now()))
+				mock.ExpectCommit()
+			}
+			mock.ExpectQuery(`SELECT \* FROM "calendar_events" WHERE id = \$1`).
+				WithArgs(eventID, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).AddRow(eventID, userID, title))
+
+			event, err := cs.UpdateEvent(context.Background(), userID, eventID, CalendarEventRequest{Title: "Standup (moved)"})
+			require.NoError(t, err)
+			assert.Equal(t, title, event.Title)
+			assert.Zero(t, google.pushes, "the Google edit is not overwritten")
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestResolveConflict_TakesGoogleVersion(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	cs := newConflictTestService(t, db.DB, newConflictGoogle(t))
+
+	userID, eventID, conflictID := uuid.New(), uuid.New(), uuid.New()
+	mock.ExpectQuery(`SELECT \* FROM "calendar_conflicts" WHERE id = \$1 AND user_id = \$2 AND status = \$3`).
+		WithArgs(conflictID, userID, ConflictOpen, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "event_id", "google_event_id", "google_calendar_id", "local", "google", "status"}).
+			AddRow(conflictID, userID, eventID, "standup", "work", []byte(`{"title":"Standup (local)"}`),
+				[]byte(`{"title":"Standup (Google)","sequence":2,"updated_at":"2025-03-04T10:00:00Z"}`), ConflictOpen))
+	mock.ExpectQuery(`SELECT \* FROM "calendar_events" WHERE \(id = \$1 AND user_id = \$2\)`).
+		WithArgs(eventID, userID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "google_event_id", "title", "local_changed_at"}).
+			AddRow(eventID, userID, "standup", "Standup (local)", googleEditedAt.Add(time.Hour)))
+	expectEventSaved(mock, "Standup (Google)")
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "calendar_conflicts"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	conflict, err := cs.ResolveConflict(context.Background(), userID, conflictID, ResolveWithGoogle)
+	require.NoError(t, err)
+	assert.Equal(t, ConflictResolved, conflict.Status)
+	assert.Equal(t, ResolveWithGoogle, conflict.Resolution)
+	assert.NotNil(t, conflict.ResolvedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = cs.ResolveConflict(context.Background(), userID, conflictID, "both")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
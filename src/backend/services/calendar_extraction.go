@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"owlistic-notes/owlistic/prompts"
+)
+
+// defaultExtractedEventDuration is used when a message gives neither an end nor a duration
+const defaultExtractedEventDuration = time.Hour
+
+// CalendarEvent holds the event details extracted from a free-form message
+type CalendarEvent struct {
+	Title    string    `json:"title"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Location string    `json:"location,omitempty"`
+	AllDay   bool      `json:"all_day"`
+}
+
+// calendarExtraction is the JSON object the extraction prompt asks for
+type calendarExtraction struct {
+	Title           string `json:"title"`
+	Start           string `json:"start"`
+	End             string `json:"end"`
+	DurationMinutes int    `json:"duration_minutes"`
+	Location        string `json:"location"`
+	AllDay          bool   `json:"all_day"`
+}
+
+// ExtractCalendarEvent asks the model for the structured fields of the event
+// described in text. Relative dates are resolved against the current time.
+func (ai *AIService) ExtractCalendarEvent(ctx context.Context, text string) (CalendarEvent, error) {
+	return ai.extractCalendarEventAt(ctx, text, time.Now())
+}
+
+func (ai *AIService) extractCalendarEventAt(ctx context.Context, text string, now time.Time) (CalendarEvent, error) {
+	ctx = withAICallFeature(ctx, prompts.ExtractCalendarEvent, text)
+	prompt, err := prompts.Render(prompts.ExtractCalendarEvent, map[string]interface{}{
+		"Message": text,
+		"Now":     now.Format(time.RFC3339),
+		"Weekday": now.Weekday().String(),
+	})
+	if err != nil {
+		return CalendarEvent{}, err
+	}
+
+	response, err := ai.callAnthropic(ctx, prompt, 500)
+	if err != nil {
+		return CalendarEvent{}, err
+	}
+
+	return parseCalendarExtraction(response, now.Location())
+}
+
+// parseCalendarExtraction decodes the model's JSON answer. Unknown fields and
+// trailing text are rejected rather than guessed at, so callers can fall back
+// to their own heuristics. Times without an offset are read in loc.
+func parseCalendarExtraction(response string, loc *time.Location) (CalendarEvent, error) {
+	response = strings.TrimSpace(response)
+	response = strings.TrimPrefix(response, "```json")
+	response = strings.TrimPrefix(response, "```")
+	response = strings.TrimSuffix(response, "```")
+	response = strings.TrimSpace(response)
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(response)))
+	decoder.DisallowUnknownFields()
+	var extraction calendarExtraction
+	if err := decoder.Decode(&extraction); err != nil {
+		return CalendarEvent{}, fmt.Errorf("invalid calendar extraction: %w", err)
+	}
+	if decoder.More() {
+		return CalendarEvent{}, fmt.Errorf("invalid calendar extraction: unexpected data after the JSON object")
+	}
+
+	event := CalendarEvent{
+		Title:    strings.TrimSpace(extraction.Title),
+		Location: strings.TrimSpace(extraction.Location),
+		AllDay:   extraction.AllDay,
+	}
+	if event.Title == "" {
+		return CalendarEvent{}, fmt.Errorf("invalid calendar extraction: title is missing")
+	}
+	if extraction.DurationMinutes < 0 {
+		return CalendarEvent{}, fmt.Errorf("invalid calendar extraction: negative duration")
+	}
+
+	start, dateOnly, err := parseExtractedTime(extraction.Start, loc)
+	if err != nil {
+		return CalendarEvent{}, fmt.Errorf("invalid calendar extraction start: %w", err)
+	}
+	// A bare date can only be an all-day event
+	if dateOnly {
+		event.AllDay = true
+	}
+	if event.AllDay {
+		start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	}
+	event.Start = start
+
+	switch {
+	case strings.TrimSpace(extraction.End) != "":
+		end, _, err := parseExtractedTime(extraction.End, loc)
+		if err != nil {
+			return CalendarEvent{}, fmt.Errorf("invalid calendar extraction end: %w", err)
+		}
+		if event.AllDay {
+			// All-day ends are inclusive dates in the message, exclusive in the calendar
+			end = time.Date(end.Year(), end.Month(), end.Day()+1, 0, 0, 0, 0, end.Location())
+		}
+		event.End = end
+	case extraction.DurationMinutes > 0:
+		event.End = start.Add(time.Duration(extraction.DurationMinutes) * time.Minute)
+	case event.AllDay:
+		event.End = start.AddDate(0, 0, 1)
+	default:
+		event.End = start.Add(defaultExtractedEventDuration)
+	}
+	if !event.End.After(event.Start) {
+		return CalendarEvent{}, fmt.Errorf("invalid calendar extraction: end %s is not after start %s",
+			event.End.Format(time.RFC3339), event.Start.Format(time.RFC3339))
+	}
+
+	return event, nil
+}
+
+// parseExtractedTime accepts RFC 3339, a local date-time without offset or a
+// bare date, and reports whether the value was a bare date
+func parseExtractedTime(value string, loc *time.Location) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false, fmt.Errorf("time is missing")
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, false, nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("unrecognized time %q", value)
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStubAIService returns an AI service whose provider answers every message
+// with reply, and the last prompt it received
+func newStubAIService(t *testing.T, reply string) (*AIService, *string) {
+	var prompt string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		var req AnthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		prompt = req.Messages[0].Content
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": reply}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return &AIService{
+		anthropicKey:     "test-key",
+		anthropicBaseURL: server.URL,
+		httpClient:       server.Client(),
+		health:           aiHealth{ttl: time.Minute},
+	}, &prompt
+}
+
+func TestExtractCalendarEvent(t *testing.T) {
+	pacific := time.FixedZone("PDT", -7*60*60)
+	now := time.Date(2024, 5, 2, 10, 0, 0, 0, pacific)
+
+	tests := []struct {
+		name    string
+		message string
+		reply   string
+		want    CalendarEvent
+	}{
+		{
+			name:    "explicit start and end",
+			message: "Dentist tomorrow from 3pm to 4:30pm",
+			reply:   `{"title":"Dentist","start":"2024-05-03T15:00:00-07:00","end":"2024-05-03T16:30:00-07:00","duration_minutes":0,"location":"","all_day":false}`,
+			want: CalendarEvent{
+				Title: "Dentist",
+				Start: time.Date(2024, 5, 3, 15, 0, 0, 0, pacific),
+				End:   time.Date(2024, 5, 3, 16, 30, 0, 0, pacific),
+			},
+		},
+		{
+			name:    "duration without end",
+			message: "Call with Sam on Friday at 9 for 45 minutes",
+			reply:   "```json\n{\"title\":\"Call with Sam\",\"start\":\"2024-05-03T09:00:00\",\"end\":\"\",\"duration_minutes\":45,\"location\":\"\",\"all_day\":false}\n```",
+			want: CalendarEvent{
+				Title: "Call with Sam",
+				Start: time.Date(2024, 5, 3, 9, 0, 0, 0, pacific),
+				End:   time.Date(2024, 5, 3, 9, 45, 0, 0, pacific),
+			},
+		},
+		{
+			name:    "location and default length",
+			message: "Lunch with Ana at Café Luna next Monday at noon",
+			reply:   `{"title":"Lunch with Ana","start":"2024-05-06T12:00:00-07:00","end":"","duration_minutes":0,"location":"Café Luna","all_day":false}`,
+			want: CalendarEvent{
+				Title:    "Lunch with Ana",
+				Start:    time.Date(2024, 5, 6, 12, 0, 0, 0, pacific),
+				End:      time.Date(2024, 5, 6, 13, 0, 0, 0, pacific),
+				Location: "Café Luna",
+			},
+		},
+		{
+			name:    "all-day event",
+			message: "Offsite in Lisbon on May 10",
+			reply:   `{"title":"Offsite","start":"2024-05-10","end":"","duration_minutes":0,"location":"Lisbon","all_day":true}`,
+			want: CalendarEvent{
+				Title:    "Offsite",
+				Start:    time.Date(2024, 5, 10, 0, 0, 0, 0, pacific),
+				End:      time.Date(2024, 5, 11, 0, 0, 0, 0, pacific),
+				Location: "Lisbon",
+				AllDay:   true,
+			},
+		},
+		{
+			name:    "multi-day all-day event",
+			message: "Conference May 13 to May 15",
+			reply:   `{"title":"Conference","start":"2024-05-13","end":"2024-05-15","duration_minutes":0,"location":"","all_day":true}`,
+			want: CalendarEvent{
+				Title:  "Conference",
+				Start:  time.Date(2024, 5, 13, 0, 0, 0, 0, pacific),
+				End:    time.Date(2024, 5, 16, 0, 0, 0, 0, pacific),
+				AllDay: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ai, prompt := newStubAIService(t, tt.reply)
+
+			event, err := ai.extractCalendarEventAt(context.Background(), tt.message, now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want.Title, event.Title)
+			assert.Equal(t, tt.want.Location, event.Location)
+			assert.Equal(t, tt.want.AllDay, event.AllDay)
+			assert.True(t, tt.want.Start.Equal(event.Start), "start %s, want %s", event.Start, tt.want.Start)
+			assert.True(t, tt.want.End.Equal(event.End), "end %s, want %s", event.End, tt.want.End)
+
+			assert.Contains(t, *prompt, tt.message)
+			assert.Contains(t, *prompt, "2024-05-02T10:00:00-07:00 (Thursday)")
+		})
+	}
+}
+
+func TestExtractCalendarEvent_RejectsLooseOutput(t *testing.T) {
+	for name, reply := range map[string]string{
+		"prose":         "Sure! The meeting is tomorrow at 3pm.",
+		"missing start": `{"title":"Dentist","start":"","end":"","duration_minutes":0,"location":"","all_day":false}`,
+		"missing title": `{"title":"","start":"2024-05-03T15:00:00Z","end":"","duration_minutes":0,"location":"","all_day":false}`,
+		"unknown field": `{"title":"Dentist","start":"2024-05-03T15:00:00Z","attendees":["Sam"]}`,
+		"trailing text": `{"title":"Dentist","start":"2024-05-03T15:00:00Z"} Let me know if you need more.`,
+		"end too early": `{"title":"Dentist","start":"2024-05-03T15:00:00Z","end":"2024-05-03T14:00:00Z"}`,
+		"bad time":      `{"title":"Dentist","start":"tomorrow at 3"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ai, _ := newStubAIService(t, reply)
+			_, err := ai.ExtractCalendarEvent(context.Background(), "Dentist tomorrow at 3pm")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExtractCalendarEvent_ProviderDown(t *testing.T) {
+	ai, _ := newDownAIService(t, http.StatusServiceUnavailable)
+	_, err := ai.ExtractCalendarEvent(context.Background(), "Dentist tomorrow at 3pm")
+	assert.ErrorIs(t, err, ErrAIUnavailable)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"google.golang.org/api/calendar/v3"
 	"google.golang.org/api/option"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 
 	"owlistic-notes/owlistic/models"
 	"github.com/google/uuid"
@@ -21,6 +23,11 @@ import (
 type CalendarService struct {
 	db           *gorm.DB
 	oauth2Config *oauth2.Config
+	tokenCipher  *calendarTokenCipher // nil when CALENDAR_TOKEN_ENC_KEY is not set
+	refreshLead  time.Duration        // Tokens expiring within this are refreshed
+	clock        Clock
+	endpoint     string // Google Calendar API base URL when not the default
+	retryDelay   time.Duration        // Wait after the first failed push to Google, growing with each attempt
 }
 
 // FlexibleTime is a custom time type that can parse multiple time formats
@@ -68,8 +75,18 @@ type CalendarEventRequest struct {
 	CalendarID  string       `json:"calendar_id"` // Google Calendar ID
 	NoteID      *string      `json:"note_id,omitempty"`
 	TaskID      *string      `json:"task_id,omitempty"`
+	// Source is where the event comes from, owlistic unless set
+	Source string `json:"-"`
+	// Idempotent returns an event just created with the same title, start
+	// and source instead of creating it again. Defaults to true for events
+	// from Telegram, where messages get resent.
+	Idempotent *bool `json:"idempotent,omitempty"`
 }
 
+// calendarEventDedupeWindow is how recently an identical event must have
+// been created for an idempotent create to return it
+const calendarEventDedupeWindow = 10 * time.Minute
+
 func NewCalendarService(db *gorm.DB) (*CalendarService, error) {
 	clientID := os.Getenv("GOOGLE_CLIENT_ID")
 	clientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
@@ -120,12 +137,28 @@ func NewCalendarService(db *gorm.DB) (*CalendarService, error) {
 		}
 	}
 
+	tokenCipher, err := loadCalendarTokenCipher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load calendar token key: %w", err)
+	}
+	if tokenCipher == nil {
+		log.Printf("Warning: %s not set. Google Calendar can't be connected until it is.", calendarTokenKeyEnv)
+	}
+
 	return &CalendarService{
 		db:           db,
 		oauth2Config: oauth2Config,
+		tokenCipher:  tokenCipher,
+		refreshLead:  calendarRefreshLead(),
+		clock:        SystemClock,
+		retryDelay:   time.Second,
 	}, nil
 }
 
+func (cs *CalendarService) now() time.Time {
+	return clockNow(cs.clock)
+}
+
 // GetAuthURL generates the OAuth2 authorization URL
 func (cs *CalendarService) GetAuthURL(userID uuid.UUID) string {
 	if cs.oauth2Config == nil {
@@ -142,13 +175,16 @@ func (cs *CalendarService) ExchangeCodeForTokens(ctx context.Context, userID uui
 	if cs.oauth2Config == nil {
 		return fmt.Errorf("OAuth2 config not initialized. Missing Google OAuth credentials")
 	}
+	if cs.tokenCipher == nil {
+		return ErrCalendarTokenKeyMissing
+	}
 	token, err := cs.oauth2Config.Exchange(ctx, code)
 	if err != nil {
 		return fmt.Errorf("failed to exchange code for token: %w", err)
 	}
 
-	// Save credentials to database
-	credentials := models.GoogleCalendarCredentials{
+	// Save credentials to database, with the tokens encrypted
+	credentials := &models.GoogleCalendarCredentials{
 		UserID:       userID,
 		AccessToken:  token.AccessToken,
 		RefreshToken: token.RefreshToken,
@@ -156,12 +192,16 @@ func (cs *CalendarService) ExchangeCodeForTokens(ctx context.Context, userID uui
 		ExpiresAt:    token.Expiry,
 		Scope:        "https://www.googleapis.com/auth/calendar",
 	}
+	stored, err := cs.tokenCipher.encryptCredentials(credentials)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt tokens: %w", err)
+	}
 
 	// Delete any existing credentials for this user
 	cs.db.Where("user_id = ?", userID).Delete(&models.GoogleCalendarCredentials{})
 
 	// Save new credentials
-	if err := cs.db.Create(&credentials).Error; err != nil {
+	if err := cs.db.Create(stored).Error; err != nil {
 		return fmt.Errorf("failed to save credentials: %w", err)
 	}
 
@@ -187,7 +227,11 @@ func (cs *CalendarService) GetCalendarClient(ctx context.Context, userID uuid.UU
 		return nil, fmt.Errorf("OAuth2 config not initialized. Missing Google OAuth credentials")
 	}
 	client := cs.oauth2Config.Client(ctx, token)
-	service, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	options := []option.ClientOption{option.WithHTTPClient(client)}
+	if cs.endpoint != "" {
+		options = append(options, option.WithEndpoint(cs.endpoint))
+	}
+	service, err := calendar.NewService(ctx, options...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create calendar service: %w", err)
 	}
@@ -195,15 +239,23 @@ func (cs *CalendarService) GetCalendarClient(ctx context.Context, userID uuid.UU
 	return service, nil
 }
 
-// getValidCredentials gets valid credentials, refreshing if necessary
+// getValidCredentials gets valid credentials with decrypted tokens,
+// refreshing if necessary
 func (cs *CalendarService) getValidCredentials(ctx context.Context, userID uuid.UUID) (*models.GoogleCalendarCredentials, error) {
 	var credentials models.GoogleCalendarCredentials
 	if err := cs.db.Where("user_id = ?", userID).First(&credentials).Error; err != nil {
 		return nil, fmt.Errorf("no calendar credentials found for user: %w", err)
 	}
+	if err := decryptCredentials(cs.tokenCipher, &credentials); err != nil {
+		return nil, fmt.Errorf("failed to decrypt calendar credentials: %w", err)
+	}
+
+	if credentials.InvalidAt != nil {
+		return nil, ErrCalendarReauthRequired
+	}
 
 	// Check if token needs refresh
-	if credentials.NeedsRefresh() {
+	if credentials.NeedsRefresh(cs.now(), cs.refreshLead) {
 		if err := cs.refreshToken(ctx, &credentials); err != nil {
 			return nil, fmt.Errorf("failed to refresh token: %w", err)
 		}
@@ -214,11 +266,11 @@ func (cs *CalendarService) getValidCredentials(ctx context.Context, userID uuid.
 
 // refreshToken refreshes the access token using the refresh token
 func (cs *CalendarService) refreshToken(ctx context.Context, credentials *models.GoogleCalendarCredentials) error {
+	// Without the access token the token source refreshes even a token that
+	// is still valid but within the lead time
 	token := &oauth2.Token{
-		AccessToken:  credentials.AccessToken,
 		RefreshToken: credentials.RefreshToken,
 		TokenType:    credentials.TokenType,
-		Expiry:       credentials.ExpiresAt,
 	}
 
 	if cs.oauth2Config == nil {
@@ -227,11 +279,37 @@ func (cs *CalendarService) refreshToken(ctx context.Context, credentials *models
 	tokenSource := cs.oauth2Config.TokenSource(ctx, token)
 	newToken, err := tokenSource.Token()
 	if err != nil {
+		if isRevokedGrant(err) {
+			cs.markCredentialsInvalid(credentials, err)
+			return fmt.Errorf("%w: %v", ErrCalendarReauthRequired, err)
+		}
 		return err
 	}
 
-	// Update credentials in database
-	return credentials.UpdateTokens(cs.db, newToken.AccessToken, newToken.RefreshToken, newToken.Expiry)
+	credentials.AccessToken = newToken.AccessToken
+	if newToken.RefreshToken != "" {
+		credentials.RefreshToken = newToken.RefreshToken
+	}
+	credentials.ExpiresAt = newToken.Expiry
+	return cs.saveTokens(credentials)
+}
+
+// saveTokens stores the tokens and expiry of credentials, encrypted.
+// credentials itself keeps the plaintext tokens.
+func (cs *CalendarService) saveTokens(credentials *models.GoogleCalendarCredentials) error {
+	if cs.tokenCipher == nil {
+		return ErrCalendarTokenKeyMissing
+	}
+	stored, err := cs.tokenCipher.encryptCredentials(credentials)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt tokens: %w", err)
+	}
+	return cs.db.Model(&models.GoogleCalendarCredentials{}).Where("id = ?", credentials.ID).Updates(map[string]interface{}{
+		"access_token":  stored.AccessToken,
+		"refresh_token": stored.RefreshToken,
+		"key_version":   stored.KeyVersion,
+		"expires_at":    stored.ExpiresAt,
+	}).Error
 }
 
 // ListCalendars retrieves the user's Google Calendars
@@ -249,8 +327,13 @@ func (cs *CalendarService) ListCalendars(ctx context.Context, userID uuid.UUID)
 	return calendarList.Items, nil
 }
 
-// SyncCalendar sets up sync for a specific Google Calendar
-func (cs *CalendarService) SyncCalendar(ctx context.Context, userID uuid.UUID, googleCalendarID, calendarName string, syncDirection string) error {
+// SyncCalendar sets up sync for a specific Google Calendar. An empty
+// conflictPolicy uses CALENDAR_CONFLICT_POLICY.
+func (cs *CalendarService) SyncCalendar(ctx context.Context, userID uuid.UUID, googleCalendarID, calendarName string, syncDirection string, conflictPolicy string) error {
+	if conflictPolicy != "" && !ValidConflictPolicy(conflictPolicy) {
+		return fmt.Errorf("%w: conflict policy must be google-wins, local-wins, newest-wins or manual", ErrInvalidInput)
+	}
+
 	// Create or update calendar sync record
 	sync := models.CalendarSync{
 		UserID:           userID,
@@ -258,6 +341,7 @@ func (cs *CalendarService) SyncCalendar(ctx context.Context, userID uuid.UUID, g
 		CalendarName:     calendarName,
 		SyncEnabled:      true,
 		SyncDirection:    syncDirection,
+		ConflictPolicy:   conflictPolicy,
 	}
 
 	// Try to find existing sync record
@@ -274,6 +358,7 @@ func (cs *CalendarService) SyncCalendar(ctx context.Context, userID uuid.UUID, g
 		// Update existing sync record
 		existing.CalendarName = calendarName
 		existing.SyncDirection = syncDirection
+		existing.ConflictPolicy = conflictPolicy
 		existing.SyncEnabled = true
 		if err := cs.db.Save(&existing).Error; err != nil {
 			return fmt.Errorf("failed to update calendar sync: %w", err)
@@ -286,20 +371,28 @@ func (cs *CalendarService) SyncCalendar(ctx context.Context, userID uuid.UUID, g
 
 // PerformSync syncs events between Google Calendar and our database
 func (cs *CalendarService) PerformSync(ctx context.Context, userID uuid.UUID, googleCalendarID string) error {
-	service, err := cs.GetCalendarClient(ctx, userID)
-	if err != nil {
-		return err
-	}
-
 	// Get sync record
 	var sync models.CalendarSync
 	if err := cs.db.Where("user_id = ? AND google_calendar_id = ?", userID, googleCalendarID).First(&sync).Error; err != nil {
 		return fmt.Errorf("calendar sync not found: %w", err)
 	}
 
+	_, err := cs.performSync(ctx, userID, &sync)
+	return err
+}
+
+// performSync syncs the events of the calendar of sync and returns how many
+// were synced
+func (cs *CalendarService) performSync(ctx context.Context, userID uuid.UUID, sync *models.CalendarSync) (int, error) {
+	googleCalendarID := sync.GoogleCalendarID
+	service, err := cs.GetCalendarClient(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
 	// Sync events from the last 30 days to next 365 days
-	timeMin := time.Now().AddDate(0, 0, -30).Format(time.RFC3339)
-	timeMax := time.Now().AddDate(1, 0, 0).Format(time.RFC3339)
+	timeMin := cs.now().AddDate(0, 0, -30).Format(time.RFC3339)
+	timeMax := cs.now().AddDate(1, 0, 0).Format(time.RFC3339)
 
 	eventsCall := service.Events.List(googleCalendarID).
 		TimeMin(timeMin).
@@ -314,31 +407,40 @@ func (cs *CalendarService) PerformSync(ctx context.Context, userID uuid.UUID, go
 
 	events, err := eventsCall.Do()
 	if err != nil {
-		return fmt.Errorf("failed to fetch events: %w", err)
+		return 0, fmt.Errorf("failed to fetch events: %w", err)
 	}
 
 	// Process each event
+	synced := 0
 	for _, event := range events.Items {
-		if err := cs.syncEvent(userID, googleCalendarID, event); err != nil {
+		if err := cs.syncEvent(service, sync, event); err != nil {
 			log.Printf("Failed to sync event %s: %v", event.Id, err)
 			continue
 		}
+		synced++
+	}
+	if sync.SyncDirection != "read_only" {
+		cs.pushPendingEvents(ctx, service, sync)
 	}
 
 	// Update sync record
-	now := time.Now()
+	now := cs.now()
 	sync.LastSyncAt = &now
 	if events.NextSyncToken != "" {
 		sync.SyncToken = events.NextSyncToken
 	}
-	cs.db.Save(&sync)
+	cs.db.Save(sync)
 
-	log.Printf("Successfully synced %d events for calendar %s", len(events.Items), googleCalendarID)
-	return nil
+	log.Printf("Successfully synced %d events for calendar %s", synced, googleCalendarID)
+	return synced, nil
 }
 
-// syncEvent syncs a single event from Google Calendar
-func (cs *CalendarService) syncEvent(userID uuid.UUID, googleCalendarID string, googleEvent *calendar.Event) error {
+// syncEvent syncs a single event from Google Calendar. An event with a local
+// edit that hasn't reached Google is pushed when Google didn't change it and
+// settled by the calendar's conflict policy when it did.
+func (cs *CalendarService) syncEvent(service *calendar.Service, sync *models.CalendarSync, googleEvent *calendar.Event) error {
+	userID, googleCalendarID := sync.UserID, sync.GoogleCalendarID
+
 	// Skip cancelled events
 	if googleEvent.Status == "cancelled" {
 		// Delete from our database if it exists
@@ -346,22 +448,48 @@ func (cs *CalendarService) syncEvent(userID uuid.UUID, googleCalendarID string,
 		return nil
 	}
 
+	event, err := cs.eventFromGoogle(userID, googleCalendarID, googleEvent)
+	if err != nil {
+		return err
+	}
+
+	// Using Session to suppress 'record not found' logs
+	var existing models.CalendarEvent
+	err = cs.db.Session(&gorm.Session{Logger: cs.db.Logger.LogMode(logger.Silent)}).
+		Where("user_id = ? AND google_event_id = ?", userID, googleEvent.Id).
+		First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return cs.db.Create(&event).Error
+	} else if err != nil {
+		return err
+	}
+
+	if existing.LocalChangedAt == nil {
+		return cs.applyGoogleVersion(&existing, &event)
+	}
+	if !googleChanged(&existing, &event) {
+		return cs.pushLocalVersion(service, &existing)
+	}
+	return cs.resolveSyncConflict(service, sync, &existing, &event)
+}
+
+// eventFromGoogle builds the local record of a Google event
+func (cs *CalendarService) eventFromGoogle(userID uuid.UUID, googleCalendarID string, googleEvent *calendar.Event) (models.CalendarEvent, error) {
 	// Parse start and end times
 	startTime, err := cs.parseEventTime(googleEvent.Start)
 	if err != nil {
-		return fmt.Errorf("failed to parse start time: %w", err)
+		return models.CalendarEvent{}, fmt.Errorf("failed to parse start time: %w", err)
 	}
 
 	endTime, err := cs.parseEventTime(googleEvent.End)
 	if err != nil {
-		return fmt.Errorf("failed to parse end time: %w", err)
+		return models.CalendarEvent{}, fmt.Errorf("failed to parse end time: %w", err)
 	}
 
 	// Determine if it's an all-day event
 	allDay := googleEvent.Start.Date != ""
 
-	// Create or update calendar event
-	event := models.CalendarEvent{
+	return models.CalendarEvent{
 		UserID:           userID,
 		GoogleEventID:    googleEvent.Id,
 		GoogleCalendarID: googleCalendarID,
@@ -383,9 +511,9 @@ func (cs *CalendarService) syncEvent(userID uuid.UUID, googleCalendarID string,
 			"hangout_link":    googleEvent.HangoutLink,
 			"conference_data": googleEvent.ConferenceData,
 		},
-	}
-
-	return models.CreateOrUpdateEvent(cs.db, &event)
+		GoogleSequence:  googleEvent.Sequence,
+		GoogleUpdatedAt: googleUpdatedAt(googleEvent),
+	}, nil
 }
 
 // parseEventTime parses Google Calendar event time
@@ -408,6 +536,25 @@ func (cs *CalendarService) getEventTimeZone(googleEvent *calendar.Event) string
 
 // CreateEvent creates a new event in Google Calendar
 func (cs *CalendarService) CreateEvent(ctx context.Context, userID uuid.UUID, req CalendarEventRequest) (*models.CalendarEvent, error) {
+	source := req.Source
+	if source == "" {
+		source = "owlistic"
+	}
+	idempotent := source == "telegram"
+	if req.Idempotent != nil {
+		idempotent = *req.Idempotent
+	}
+	if idempotent {
+		existing, err := cs.findRecentEvent(ctx, userID, source, req.Title, req.StartTime.Time)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			log.Printf("Returning calendar event %s instead of creating a duplicate", existing.ID)
+			return existing, nil
+		}
+	}
+
 	service, err := cs.GetCalendarClient(ctx, userID)
 	if err != nil {
 		return nil, err
@@ -468,6 +615,11 @@ func (cs *CalendarService) CreateEvent(ctx context.Context, userID uuid.UUID, re
 		}
 	}
 
+	createdVia := "api"
+	if source != "owlistic" {
+		createdVia = source
+	}
+
 	// Create local calendar event record
 	event := models.CalendarEvent{
 		UserID:           userID,
@@ -481,13 +633,15 @@ func (cs *CalendarService) CreateEvent(ctx context.Context, userID uuid.UUID, re
 		AllDay:           req.AllDay,
 		TimeZone:         req.TimeZone,
 		Status:           "confirmed",
-		Source:           "owlistic",
+		Source:           source,
 		NoteID:           noteID,
 		TaskID:           taskID,
 		Metadata: models.CalendarEventMetadata{
-			"created_via": "api",
+			"created_via": createdVia,
 			"html_link":   createdEvent.HtmlLink,
 		},
+		GoogleSequence:  createdEvent.Sequence,
+		GoogleUpdatedAt: googleUpdatedAt(createdEvent),
 	}
 
 	if err := cs.db.Create(&event).Error; err != nil {
@@ -497,6 +651,23 @@ func (cs *CalendarService) CreateEvent(ctx context.Context, userID uuid.UUID, re
 	return &event, nil
 }
 
+// findRecentEvent returns the user's event with the same source, title and
+// start that was created within the dedupe window, or nil
+func (cs *CalendarService) findRecentEvent(ctx context.Context, userID uuid.UUID, source, title string, start time.Time) (*models.CalendarEvent, error) {
+	var events []models.CalendarEvent
+	err := cs.db.WithContext(ctx).
+		Where("user_id = ? AND source = ? AND title = ? AND start_time = ? AND created_at >= ?",
+			userID, source, title, start, cs.now().Add(-calendarEventDedupeWindow)).
+		Order("created_at DESC").Limit(1).Find(&events).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up recent calendar events: %w", err)
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+	return &events[0], nil
+}
+
 // GetEvents retrieves calendar events for a user within a date range
 func (cs *CalendarService) GetEvents(ctx context.Context, userID uuid.UUID, startTime, endTime time.Time) ([]models.CalendarEvent, error) {
 	return models.GetCalendarEvents(cs.db, userID, startTime, endTime)
@@ -516,42 +687,6 @@ func (cs *CalendarService) UpdateEvent(ctx context.Context, userID uuid.UUID, ev
 		return nil, err
 	}
 
-	// Update Google Calendar event
-	googleEvent := &calendar.Event{
-		Summary:     req.Title,
-		Description: req.Description,
-		Location:    req.Location,
-	}
-
-	// Set event times
-	if req.AllDay {
-		googleEvent.Start = &calendar.EventDateTime{
-			Date: req.StartTime.Time.Format("2006-01-02"),
-		}
-		googleEvent.End = &calendar.EventDateTime{
-			Date: req.EndTime.Time.Format("2006-01-02"),
-		}
-	} else {
-		timeZone := req.TimeZone
-		if timeZone == "" {
-			timeZone = event.TimeZone
-		}
-		googleEvent.Start = &calendar.EventDateTime{
-			DateTime: req.StartTime.Time.Format(time.RFC3339),
-			TimeZone: timeZone,
-		}
-		googleEvent.End = &calendar.EventDateTime{
-			DateTime: req.EndTime.Time.Format(time.RFC3339),
-			TimeZone: timeZone,
-		}
-	}
-
-	// Update in Google Calendar
-	_, err = service.Events.Update(event.GoogleCalendarID, event.GoogleEventID, googleEvent).Do()
-	if err != nil {
-		return nil, fmt.Errorf("failed to update Google Calendar event: %w", err)
-	}
-
 	// Update local record
 	event.Title = req.Title
 	event.Description = req.Description
@@ -563,6 +698,46 @@ func (cs *CalendarService) UpdateEvent(ctx context.Context, userID uuid.UUID, ev
 		event.TimeZone = req.TimeZone
 	}
 
+	// Compare with the version Google has now, so an edit made in Google
+	// since the last sync goes through the calendar's conflict policy instead
+	// of being overwritten. When Google stays unreachable the edit is kept
+	// locally and sent, or resolved, with the next sync.
+	remote, err := cs.fetchEvent(service, &event)
+	if err != nil {
+		if !isTransientGoogleError(err) {
+			return nil, fmt.Errorf("failed to load Google Calendar event: %w", err)
+		}
+		log.Printf("Google Calendar unavailable, event %s will be updated on the next sync: %v", event.ID, err)
+		now := cs.now()
+		event.LocalChangedAt = &now
+		if err := cs.db.Save(&event).Error; err != nil {
+			return nil, fmt.Errorf("failed to update calendar event: %w", err)
+		}
+		return &event, nil
+	}
+	incoming, err := cs.eventFromGoogle(userID, event.GoogleCalendarID, remote)
+	if err != nil {
+		return nil, err
+	}
+	// Events last synced before versions were recorded have nothing to
+	// compare with and are pushed as before
+	if event.GoogleUpdatedAt != nil && googleChanged(&event, &incoming) {
+		return cs.resolveUpdateConflict(ctx, service, &event, &incoming)
+	}
+
+	// Update in Google Calendar
+	updated, err := cs.pushEvent(service, &event)
+	if err != nil {
+		if !isTransientGoogleError(err) {
+			return nil, fmt.Errorf("failed to update Google Calendar event: %w", err)
+		}
+		log.Printf("Google Calendar unavailable, event %s will be updated on the next sync: %v", event.ID, err)
+		now := cs.now()
+		event.LocalChangedAt = &now
+	} else {
+		markPushed(&event, updated)
+	}
+
 	if err := cs.db.Save(&event).Error; err != nil {
 		return nil, fmt.Errorf("failed to update calendar event: %w", err)
 	}
@@ -570,6 +745,32 @@ func (cs *CalendarService) UpdateEvent(ctx context.Context, userID uuid.UUID, ev
 	return &event, nil
 }
 
+// resolveUpdateConflict keeps an edit to an event Google changed since the
+// last sync as a pending local edit, then settles it by the conflict policy
+// of its calendar, and returns the event as it ended up
+func (cs *CalendarService) resolveUpdateConflict(ctx context.Context, service *calendar.Service, event, incoming *models.CalendarEvent) (*models.CalendarEvent, error) {
+	now := cs.now()
+	event.LocalChangedAt = &now
+	if err := cs.db.WithContext(ctx).Save(event).Error; err != nil {
+		return nil, fmt.Errorf("failed to update calendar event: %w", err)
+	}
+
+	sync := models.CalendarSync{UserID: event.UserID, GoogleCalendarID: event.GoogleCalendarID}
+	if err := cs.db.WithContext(ctx).Where("user_id = ? AND google_calendar_id = ?", event.UserID, event.GoogleCalendarID).
+		Limit(1).Find(&sync).Error; err != nil {
+		return nil, fmt.Errorf("failed to load calendar sync: %w", err)
+	}
+	if err := cs.resolveSyncConflict(service, &sync, event, incoming); err != nil {
+		return nil, err
+	}
+
+	var resolved models.CalendarEvent
+	if err := cs.db.WithContext(ctx).First(&resolved, "id = ?", event.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to reload calendar event: %w", err)
+	}
+	return &resolved, nil
+}
+
 // DeleteEvent deletes a calendar event
 func (cs *CalendarService) DeleteEvent(ctx context.Context, userID uuid.UUID, eventID uuid.UUID) error {
 	// Get existing event
@@ -619,27 +820,47 @@ func (cs *CalendarService) HasCalendarAccess(ctx context.Context, userID uuid.UU
 
 // GetTodaysEvents retrieves all events for today for a specific user
 func (cs *CalendarService) GetTodaysEvents(ctx context.Context, userID uuid.UUID) ([]models.CalendarEvent, error) {
-	now := time.Now()
+	now := cs.now()
 	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 	endOfDay := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 999999999, now.Location())
 	
 	return cs.GetEvents(ctx, userID, startOfDay, endOfDay)
 }
 
-// SyncAllCalendars syncs all user calendars
-func (cs *CalendarService) SyncAllCalendars(ctx context.Context, userID uuid.UUID) error {
-	// Get user's calendars
-	calendars, err := cs.ListCalendars(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("failed to list calendars: %w", err)
+// CalendarSyncResult is the outcome of syncing one calendar
+type CalendarSyncResult struct {
+	CalendarID   string `json:"calendar_id"`
+	CalendarName string `json:"calendar_name"`
+	Synced       int    `json:"synced"`
+	Error        string `json:"error,omitempty"`
+}
+
+// SyncAllCalendars syncs every calendar the user enabled sync for and
+// reports how each went. A calendar failing doesn't stop the others from
+// syncing; the returned error is only for when there is nothing to sync.
+func (cs *CalendarService) SyncAllCalendars(ctx context.Context, userID uuid.UUID) ([]CalendarSyncResult, error) {
+	var syncs []models.CalendarSync
+	if err := cs.db.WithContext(ctx).Where("user_id = ? AND sync_enabled = ?", userID, true).
+		Order("calendar_name ASC").Find(&syncs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get sync configurations: %w", err)
 	}
-	
-	// Sync primary calendar or first available calendar
-	for _, cal := range calendars {
-		if cal.Primary || len(calendars) == 1 {
-			return cs.PerformSync(ctx, userID, cal.Id)
+	if len(syncs) == 0 {
+		return nil, fmt.Errorf("%w: no calendars are set up for sync", ErrNotFound)
+	}
+
+	results := make([]CalendarSyncResult, 0, len(syncs))
+	for i := range syncs {
+		result := CalendarSyncResult{
+			CalendarID:   syncs[i].GoogleCalendarID,
+			CalendarName: syncs[i].CalendarName,
 		}
+		synced, err := cs.performSync(ctx, userID, &syncs[i])
+		if err != nil {
+			log.Printf("Failed to sync calendar %s of user %s: %v", syncs[i].GoogleCalendarID, userID, err)
+			result.Error = err.Error()
+		}
+		result.Synced = synced
+		results = append(results, result)
 	}
-	
-	return fmt.Errorf("no calendars found to sync")
+	return results, nil
 }
\ No newline at end of file
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const recentEventQuery = `SELECT \* FROM "calendar_events" WHERE \(user_id = \$1 AND source = \$2 AND title = \$3 AND start_time = \$4 AND created_at >= \$5\)`
+
+func TestCreateEvent_RepeatedTelegramCreateReturnsSameEvent(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	inserts := 0
+	google := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/calendars/primary/events" {
+			http.NotFound(w, r)
+			return
+		}
+		inserts++
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"google-event-1","htmlLink":"https://calendar.google.com/event?eid=1"}`)
+	}))
+	defer google.Close()
+
+	now := time.Now()
+	cs, _ := newTokenTestCalendarService(t, db.DB, now, http.StatusOK, `{}`)
+	cs.endpoint = google.URL + "/"
+
+	userID, eventID := uuid.New(), uuid.New()
+	start := time.Date(2025, 3, 4, 15, 0, 0, 0, time.UTC)
+	request := CalendarEventRequest{
+		Title:      "Meeting",
+		StartTime:  FlexibleTime{Time: start},
+		EndTime:    FlexibleTime{Time: start.Add(time.Hour)},
+		CalendarID: "primary",
+		Source:     "telegram",
+	}
+
+	// First send: nothing recent, so the event is created
+	mock.ExpectQuery(recentEventQuery).
+		WithArgs(userID, "telegram", "Meeting", start, now.Add(-calendarEventDedupeWindow), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "google_calendar_credentials" WHERE user_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "access_token", "refresh_token", "token_type", "expires_at", "key_version"}).
+			AddRow(uuid.New(), userID, "access", "refresh", "Bearer", now.Add(time.Hour), 0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "calendar_events"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(eventID))
+	mock.ExpectCommit()
+
+	first, err := cs.CreateEvent(context.Background(), userID, request)
+	require.NoError(t, err)
+	assert.Equal(t, "telegram", first.Source)
+	assert.Equal(t, "telegram", first.Metadata["created_via"])
+
+	// The resent message finds it
+	mock.ExpectQuery(recentEventQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "google_event_id", "title", "start_time", "source"}).
+			AddRow(eventID, userID, "google-event-1", "Meeting", start, "telegram"))
+
+	second, err := cs.CreateEvent(context.Background(), userID, request)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, 1, inserts, "only one Google Calendar event")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateEvent_APICreatesAreNotDedupedByDefault(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	cs, _ := newTokenTestCalendarService(t, db.DB, time.Now(), http.StatusOK, `{}`)
+
+	// Without the lookup the create goes straight to the credentials
+	mock.ExpectQuery(`SELECT \* FROM "google_calendar_credentials"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err := cs.CreateEvent(context.Background(), uuid.New(), CalendarEventRequest{Title: "Meeting"})
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSyncAllCalendars_ReportsEachCalendar(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	google := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/calendars/work/events":
+			io.WriteString(w, `{"items":[{"id":"standup","status":"confirmed","summary":"Standup",`+
+				`"start":{"dateTime":"2025-03-04T09:00:00Z"},"end":{"dateTime":"2025-03-04T09:15:00Z"}}],"nextSyncToken":"next"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":{"code":404,"message":"Not Found"}}`)
+		}
+	}))
+	defer google.Close()
+
+	now := time.Now()
+	cs, _ := newTokenTestCalendarService(t, db.DB, now, http.StatusOK, `{}`)
+	cs.endpoint = google.URL + "/"
+
+	userID := uuid.New()
+	credentials := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "user_id", "access_token", "refresh_token", "token_type", "expires_at", "key_version"}).
+			AddRow(uuid.New(), userID, "access", "refresh", "Bearer", now.Add(time.Hour), 0)
+	}
+
+	mock.ExpectQuery(`SELECT \* FROM "calendar_syncs" WHERE \(user_id = \$1 AND sync_enabled = \$2\) AND "calendar_syncs"."deleted_at" IS NULL ORDER BY calendar_name ASC`).
+		WithArgs(userID, true).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "google_calendar_id", "calendar_name", "sync_enabled"}).
+			AddRow(uuid.New(), userID, "personal", "Personal", true).
+			AddRow(uuid.New(), userID, "work", "Work", true))
+
+	// Personal fails to fetch its events
+	mock.ExpectQuery(`SELECT \* FROM "google_calendar_credentials"`).WillReturnRows(credentials())
+
+	// Work is still synced
+	mock.ExpectQuery(`SELECT \* FROM "google_calendar_credentials"`).WillReturnRows(credentials())
+	mock.ExpectQuery(`SELECT \* FROM "calendar_events" WHERE \(user_id = \$1 AND google_event_id = \$2\)`).
+		WithArgs(userID, "standup", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "calendar_events"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "calendar_events" WHERE \(user_id = \$1 AND google_calendar_id = \$2 AND local_changed_at IS NOT NULL\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "calendar_syncs"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	results, err := cs.SyncAllCalendars(context.Background(), userID)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	assert.Equal(t, "Personal", results[0].CalendarName)
+	assert.Zero(t, results[0].Synced)
+	assert.Contains(t, results[0].Error, "failed to fetch events")
+
+	assert.Equal(t, "Work", results[1].CalendarName)
+	assert.Equal(t, 1, results[1].Synced)
+	assert.Empty(t, results[1].Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	breakdown := formatCalendarSyncResults(context.Background(), results)
+	assert.Contains(t, breakdown, "❌ Personal: failed to fetch events")
+	assert.Contains(t, breakdown, "✅ Work: 1 event\n")
+}
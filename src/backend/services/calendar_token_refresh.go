@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// defaultCalendarRefreshLead is how long before expiry a token is refreshed
+	defaultCalendarRefreshLead = 10 * time.Minute
+	// CalendarRefreshCheckInterval is how often tokens nearing expiry are
+	// looked for
+	CalendarRefreshCheckInterval = time.Minute
+)
+
+// ErrCalendarReauthRequired is returned when Google rejected the refresh
+// token, e.g. because access was revoked, and the user has to reconnect
+var ErrCalendarReauthRequired = errors.New("google calendar access was revoked, reconnect the calendar")
+
+// calendarRefreshLead reads CALENDAR_TOKEN_REFRESH_LEAD_MINUTES
+func calendarRefreshLead() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("CALENDAR_TOKEN_REFRESH_LEAD_MINUTES")); err == nil && value > 0 {
+		return time.Duration(value) * time.Minute
+	}
+	return defaultCalendarRefreshLead
+}
+
+// isRevokedGrant tells whether a refresh failed because Google no longer
+// accepts the refresh token, as opposed to a transient failure
+func isRevokedGrant(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		return false
+	}
+	return retrieveErr.ErrorCode == "invalid_grant" || retrieveErr.ErrorCode == "unauthorized_client"
+}
+
+// markCredentialsInvalid records that the credentials can't be refreshed
+// anymore and tells the user to reconnect
+func (cs *CalendarService) markCredentialsInvalid(credentials *models.GoogleCalendarCredentials, refreshErr error) {
+	now := cs.now()
+	credentials.InvalidAt = &now
+	credentials.RefreshError = refreshErr.Error()
+	if err := cs.db.Model(&models.GoogleCalendarCredentials{}).Where("id = ?", credentials.ID).Updates(map[string]interface{}{
+		"invalid_at":    credentials.InvalidAt,
+		"refresh_error": credentials.RefreshError,
+	}).Error; err != nil {
+		log.Printf("Failed to mark calendar credentials of user %s invalid: %v", credentials.UserID, err)
+	}
+
+	message := fmt.Sprintf("Google Calendar access for your account stopped working (%v). Reconnect the calendar to resume syncing.", refreshErr)
+	if err := NotificationServiceInstance.PublishNotification(credentials.UserID.String(), "calendar.reauthorization_required", message, now.Format(time.RFC3339)); err != nil {
+		log.Printf("Failed to notify user %s about calendar access: %v", credentials.UserID, err)
+	}
+}
+
+// RefreshExpiringTokens refreshes the tokens that expire within the lead
+// time of users with an enabled calendar sync, and returns how many it
+// refreshed. Invalid credentials are skipped until the user reconnects.
+func (cs *CalendarService) RefreshExpiringTokens(ctx context.Context) (int, error) {
+	syncingUsers := cs.db.Model(&models.CalendarSync{}).Select("user_id").Where("sync_enabled = ?", true)
+
+	var expiring []models.GoogleCalendarCredentials
+	if err := cs.db.WithContext(ctx).
+		Where("invalid_at IS NULL AND expires_at <= ? AND user_id IN (?)", cs.now().Add(cs.refreshLead), syncingUsers).
+		Find(&expiring).Error; err != nil {
+		return 0, fmt.Errorf("failed to load expiring calendar credentials: %w", err)
+	}
+
+	refreshed := 0
+	for i := range expiring {
+		credentials := &expiring[i]
+		if err := decryptCredentials(cs.tokenCipher, credentials); err != nil {
+			log.Printf("Failed to decrypt calendar credentials of user %s: %v", credentials.UserID, err)
+			continue
+		}
+		if err := cs.refreshToken(ctx, credentials); err != nil {
+			log.Printf("Failed to refresh calendar token of user %s: %v", credentials.UserID, err)
+			continue
+		}
+		refreshed++
+	}
+	return refreshed, nil
+}
+
+// CalendarTokenRefresher refreshes calendar tokens before they expire, so
+// syncs and other calendar requests don't start with a token about to expire
+type CalendarTokenRefresher struct {
+	service  *CalendarService
+	interval time.Duration
+
+	mu        sync.Mutex
+	isRunning bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewCalendarTokenRefresher creates a refresher for the tokens of service
+func NewCalendarTokenRefresher(service *CalendarService) *CalendarTokenRefresher {
+	return &CalendarTokenRefresher{
+		service:  service,
+		interval: CalendarRefreshCheckInterval,
+	}
+}
+
+// Start begins checking for expiring tokens every interval
+func (r *CalendarTokenRefresher) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.isRunning || r.service.oauth2Config == nil {
+		return
+	}
+
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.isRunning = true
+
+	r.wg.Add(1)
+	go r.loop()
+	log.Println("Calendar token refresher started")
+}
+
+// Stop halts the refresher and waits up to timeout for a refresh in progress
+func (r *CalendarTokenRefresher) Stop(timeout time.Duration) {
+	r.mu.Lock()
+	if !r.isRunning {
+		r.mu.Unlock()
+		return
+	}
+	r.isRunning = false
+	r.cancel()
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("Calendar token refresher stopped")
+	case <-time.After(timeout):
+		log.Printf("Calendar token refresher stopped with a refresh still in progress after %s", timeout)
+	}
+}
+
+func (r *CalendarTokenRefresher) loop() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.service.RefreshExpiringTokens(r.ctx); err != nil && r.ctx.Err() == nil {
+			log.Printf("Calendar token refresher: %v", err)
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
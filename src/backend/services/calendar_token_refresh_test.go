@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// recordingNotifications keeps the notifications it is asked to publish
+type recordingNotifications struct {
+	eventTypes []string
+	userIDs    []string
+}
+
+func (r *recordingNotifications) PublishNotification(userID, eventType, message, timestamp string) error {
+	r.userIDs = append(r.userIDs, userID)
+	r.eventTypes = append(r.eventTypes, eventType)
+	return nil
+}
+
+// newTokenTestCalendarService returns a calendar service whose OAuth token
+// endpoint answers with status and body
+func newTokenTestCalendarService(t *testing.T, db *gorm.DB, now time.Time, status int, body string) (*CalendarService, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	tokenCipher, err := newCalendarTokenCipher(map[int][]byte{1: testCalendarTokenKey(5)}, 1)
+	require.NoError(t, err)
+	return &CalendarService{
+		db:           db,
+		oauth2Config: &oauth2.Config{ClientID: "id", ClientSecret: "secret", Endpoint: oauth2.Endpoint{TokenURL: server.URL}},
+		tokenCipher:  tokenCipher,
+		refreshLead:  10 * time.Minute,
+		clock:        NewFakeClock(now),
+	}, &requests
+}
+
+func TestNeedsRefresh_LeadTime(t *testing.T) {
+	now := time.Now()
+	credentials := models.GoogleCalendarCredentials{ExpiresAt: now.Add(8 * time.Minute)}
+
+	assert.True(t, credentials.NeedsRefresh(now, 10*time.Minute))
+	assert.False(t, credentials.NeedsRefresh(now, 5*time.Minute))
+
+	t.Setenv("CALENDAR_TOKEN_REFRESH_LEAD_MINUTES", "15")
+	assert.Equal(t, 15*time.Minute, calendarRefreshLead())
+	t.Setenv("CALENDAR_TOKEN_REFRESH_LEAD_MINUTES", "soon")
+	assert.Equal(t, defaultCalendarRefreshLead, calendarRefreshLead())
+}
+
+func TestGetValidCredentials_RefreshesWithinLeadTime(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	now := time.Now()
+	cs, requests := newTokenTestCalendarService(t, db.DB, now, http.StatusOK,
+		`{"access_token":"fresh-access","token_type":"Bearer","expires_in":3600}`)
+
+	userID, credentialsID := uuid.New(), uuid.New()
+	// Still valid for 8 minutes, but within the 10 minute lead
+	mock.ExpectQuery(`SELECT \* FROM "google_calendar_credentials" WHERE user_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "access_token", "refresh_token", "token_type", "expires_at", "key_version"}).
+			AddRow(credentialsID, userID, "stale-access", "refresh", "Bearer", now.Add(8*time.Minute), 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "google_calendar_credentials" SET "access_token"=\$1,"expires_at"=\$2,"key_version"=\$3,"refresh_token"=\$4`).
+		WithArgs(sealedToken{cs.tokenCipher, userID, "fresh-access", 1}, sqlmock.AnyArg(), 1,
+			sealedToken{cs.tokenCipher, userID, "refresh", 1}, sqlmock.AnyArg(), credentialsID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	credentials, err := cs.getValidCredentials(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, *requests)
+	assert.Equal(t, "fresh-access", credentials.AccessToken)
+	assert.Equal(t, "refresh", credentials.RefreshToken, "Google kept the refresh token")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshExpiringTokens_RevokedGrantMarksInvalid(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	notifications := &recordingNotifications{}
+	original := NotificationServiceInstance
+	NotificationServiceInstance = notifications
+	defer func() { NotificationServiceInstance = original }()
+
+	now := time.Now()
+	cs, _ := newTokenTestCalendarService(t, db.DB, now, http.StatusBadRequest,
+		`{"error":"invalid_grant","error_description":"Token has been expired or revoked."}`)
+
+	userID, credentialsID := uuid.New(), uuid.New()
+	mock.ExpectQuery(`SELECT \* FROM "google_calendar_credentials" WHERE \(invalid_at IS NULL AND expires_at <= \$1 AND user_id IN \(SELECT "user_id" FROM "calendar_syncs" WHERE sync_enabled = \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "access_token", "refresh_token", "expires_at", "key_version"}).
+			AddRow(credentialsID, userID, "access", "revoked-refresh", now.Add(time.Minute), 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "google_calendar_credentials" SET "invalid_at"=\$1,"refresh_error"=\$2`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	refreshed, err := cs.RefreshExpiringTokens(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, refreshed)
+	assert.Equal(t, []string{"calendar.reauthorization_required"}, notifications.eventTypes)
+	assert.Equal(t, []string{userID.String()}, notifications.userIDs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Invalid credentials are not refreshed again
+	mock.ExpectQuery(`SELECT \* FROM "google_calendar_credentials" WHERE user_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "invalid_at"}).
+			AddRow(credentialsID, userID, now.Add(time.Minute), now))
+	_, err = cs.getValidCredentials(context.Background(), userID)
+	assert.ErrorIs(t, err, ErrCalendarReauthRequired)
+}
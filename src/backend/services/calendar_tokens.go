@@ -0,0 +1,243 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// calendarTokenKeyEnv holds the base64 encoded 32 byte key tokens are
+	// encrypted with
+	calendarTokenKeyEnv = "CALENDAR_TOKEN_ENC_KEY"
+	// calendarTokenKeyVersionEnv numbers the current key, 1 by default
+	calendarTokenKeyVersionEnv = "CALENDAR_TOKEN_ENC_KEY_VERSION"
+	// calendarTokenRetiredKeyEnv, suffixed with a version, holds a previous
+	// key so tokens encrypted with it can be re-encrypted
+	calendarTokenRetiredKeyEnv = "CALENDAR_TOKEN_ENC_KEY_V"
+	// calendarTokenPlaintext is the key version of tokens stored before
+	// encryption was introduced
+	calendarTokenPlaintext = 0
+)
+
+// ErrCalendarTokenKeyMissing is returned when calendar tokens have to be
+// encrypted or decrypted without CALENDAR_TOKEN_ENC_KEY
+var ErrCalendarTokenKeyMissing = errors.New(calendarTokenKeyEnv + " is not set")
+
+// calendarTokenCipher encrypts OAuth tokens with AES-GCM. The user ID is
+// authenticated along with each token, so a token copied to another user's
+// row fails to decrypt.
+type calendarTokenCipher struct {
+	version int
+	aeads   map[int]cipher.AEAD
+}
+
+// newCalendarTokenCipher takes the keys by version; new tokens are encrypted
+// with the key of the current version
+func newCalendarTokenCipher(keys map[int][]byte, current int) (*calendarTokenCipher, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("no calendar token key for version %d", current)
+	}
+	c := &calendarTokenCipher{version: current, aeads: make(map[int]cipher.AEAD, len(keys))}
+	for version, key := range keys {
+		if version <= calendarTokenPlaintext {
+			return nil, fmt.Errorf("calendar token key versions start at 1, got %d", version)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("calendar token key version %d must be 32 bytes, got %d", version, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.aeads[version] = aead
+	}
+	return c, nil
+}
+
+// loadCalendarTokenCipher reads the current key and any retired keys from
+// the environment. It returns nil without error when no key is configured.
+func loadCalendarTokenCipher() (*calendarTokenCipher, error) {
+	encoded := strings.TrimSpace(os.Getenv(calendarTokenKeyEnv))
+	if encoded == "" {
+		return nil, nil
+	}
+
+	current := 1
+	if value := os.Getenv(calendarTokenKeyVersionEnv); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", calendarTokenKeyVersionEnv, err)
+		}
+		current = parsed
+	}
+
+	keys := make(map[int][]byte)
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be base64 encoded: %w", calendarTokenKeyEnv, err)
+	}
+	keys[current] = key
+
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, calendarTokenRetiredKeyEnv) {
+			continue
+		}
+		version, err := strconv.Atoi(strings.TrimPrefix(name, calendarTokenRetiredKeyEnv))
+		if err != nil || version == current {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s must be base64 encoded: %w", name, err)
+		}
+		keys[version] = key
+	}
+
+	return newCalendarTokenCipher(keys, current)
+}
+
+// seal encrypts a token of userID with the current key
+func (c *calendarTokenCipher) seal(userID uuid.UUID, token string) (string, error) {
+	aead := c.aeads[c.version]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(token), userID[:])
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a token of userID that was encrypted with the key of version
+func (c *calendarTokenCipher) open(userID uuid.UUID, sealed string, version int) (string, error) {
+	aead, ok := c.aeads[version]
+	if !ok {
+		return "", fmt.Errorf("no calendar token key for version %d, set %s%d", version, calendarTokenRetiredKeyEnv, version)
+	}
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted calendar token: %w", err)
+	}
+	if len(raw) < aead.NonceSize() {
+		return "", errors.New("invalid encrypted calendar token: too short")
+	}
+	nonce, ciphertext := raw[:aead.NonceSize()], raw[aead.NonceSize():]
+	token, err := aead.Open(nil, nonce, ciphertext, userID[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt calendar token: %w", err)
+	}
+	return string(token), nil
+}
+
+// encryptCredentials returns a copy of credentials with its tokens encrypted
+// for storage
+func (c *calendarTokenCipher) encryptCredentials(credentials *models.GoogleCalendarCredentials) (*models.GoogleCalendarCredentials, error) {
+	stored := *credentials
+	var err error
+	if stored.AccessToken, err = c.seal(credentials.UserID, credentials.AccessToken); err != nil {
+		return nil, err
+	}
+	if stored.RefreshToken, err = c.seal(credentials.UserID, credentials.RefreshToken); err != nil {
+		return nil, err
+	}
+	stored.KeyVersion = c.version
+	return &stored, nil
+}
+
+// decryptCredentials decrypts the tokens of stored credentials in place.
+// Plaintext tokens from before encryption pass through.
+func decryptCredentials(c *calendarTokenCipher, credentials *models.GoogleCalendarCredentials) error {
+	if credentials.KeyVersion == calendarTokenPlaintext {
+		return nil
+	}
+	if c == nil {
+		return ErrCalendarTokenKeyMissing
+	}
+	accessToken, err := c.open(credentials.UserID, credentials.AccessToken, credentials.KeyVersion)
+	if err != nil {
+		return err
+	}
+	refreshToken, err := c.open(credentials.UserID, credentials.RefreshToken, credentials.KeyVersion)
+	if err != nil {
+		return err
+	}
+	credentials.AccessToken, credentials.RefreshToken = accessToken, refreshToken
+	return nil
+}
+
+// rotateCalendarTokens re-encrypts with the current key the stored
+// credentials that are in plaintext or encrypted with a retired key, and
+// returns how many it rewrote
+func (c *calendarTokenCipher) rotateCalendarTokens(db *gorm.DB) (int, error) {
+	var stale []models.GoogleCalendarCredentials
+	if err := db.Where("key_version <> ?", c.version).Find(&stale).Error; err != nil {
+		return 0, fmt.Errorf("failed to load calendar credentials: %w", err)
+	}
+
+	for i := range stale {
+		credentials := &stale[i]
+		if err := decryptCredentials(c, credentials); err != nil {
+			return i, fmt.Errorf("calendar credentials %s: %w", credentials.ID, err)
+		}
+		stored, err := c.encryptCredentials(credentials)
+		if err != nil {
+			return i, err
+		}
+		if err := db.Model(&models.GoogleCalendarCredentials{}).Where("id = ?", credentials.ID).Updates(map[string]interface{}{
+			"access_token":  stored.AccessToken,
+			"refresh_token": stored.RefreshToken,
+			"key_version":   stored.KeyVersion,
+		}).Error; err != nil {
+			return i, fmt.Errorf("failed to save calendar credentials %s: %w", credentials.ID, err)
+		}
+	}
+	return len(stale), nil
+}
+
+// PrepareCalendarTokenEncryption runs at startup. It fails when calendar
+// credentials are stored but CALENDAR_TOKEN_ENC_KEY is not set, and otherwise
+// brings every stored token to the current key.
+func PrepareCalendarTokenEncryption(db *gorm.DB) error {
+	tokenCipher, err := loadCalendarTokenCipher()
+	if err != nil {
+		return err
+	}
+
+	if tokenCipher == nil {
+		var count int64
+		if err := db.Model(&models.GoogleCalendarCredentials{}).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count calendar credentials: %w", err)
+		}
+		if count > 0 {
+			return fmt.Errorf("%w but %d Google Calendar credential(s) are stored; set it to a base64 encoded 32 byte key (e.g. openssl rand -base64 32)",
+				ErrCalendarTokenKeyMissing, count)
+		}
+		return nil
+	}
+
+	rotated, err := tokenCipher.rotateCalendarTokens(db)
+	if err != nil {
+		return err
+	}
+	if rotated > 0 {
+		log.Printf("Encrypted %d Google Calendar credential(s) with key version %d", rotated, tokenCipher.version)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCalendarTokenKey(fill byte) []byte {
+	return bytes.Repeat([]byte{fill}, 32)
+}
+
+// sealedToken matches a token column encrypted for userID that decrypts to want
+type sealedToken struct {
+	cipher  *calendarTokenCipher
+	userID  uuid.UUID
+	want    string
+	version int
+}
+
+func (s sealedToken) Match(v driver.Value) bool {
+	sealed, ok := v.(string)
+	if !ok {
+		return false
+	}
+	token, err := s.cipher.open(s.userID, sealed, s.version)
+	return err == nil && token == s.want
+}
+
+func TestCalendarTokenCipher_RoundTrip(t *testing.T) {
+	tokenCipher, err := newCalendarTokenCipher(map[int][]byte{1: testCalendarTokenKey(7)}, 1)
+	require.NoError(t, err)
+	userID := uuid.New()
+
+	sealed, err := tokenCipher.seal(userID, "ya29.access-token")
+	require.NoError(t, err)
+	assert.NotContains(t, sealed, "ya29")
+
+	again, err := tokenCipher.seal(userID, "ya29.access-token")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "every token gets its own nonce")
+
+	token, err := tokenCipher.open(userID, sealed, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "ya29.access-token", token)
+
+	_, err = tokenCipher.open(uuid.New(), sealed, 1)
+	assert.Error(t, err, "a token moved to another user's row doesn't decrypt")
+
+	raw, _ := base64.StdEncoding.DecodeString(sealed)
+	raw[len(raw)-1] ^= 1
+	_, err = tokenCipher.open(userID, base64.StdEncoding.EncodeToString(raw), 1)
+	assert.Error(t, err, "tampered tokens are rejected")
+
+	_, err = newCalendarTokenCipher(map[int][]byte{1: []byte("short")}, 1)
+	assert.Error(t, err)
+}
+
+func TestCalendarTokenCipher_RotatesToCurrentKey(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	oldCipher, err := newCalendarTokenCipher(map[int][]byte{1: testCalendarTokenKey(1)}, 1)
+	require.NoError(t, err)
+	rotated, err := newCalendarTokenCipher(map[int][]byte{1: testCalendarTokenKey(1), 2: testCalendarTokenKey(2)}, 2)
+	require.NoError(t, err)
+
+	encryptedUser, plaintextUser := uuid.New(), uuid.New()
+	encrypted, err := oldCipher.encryptCredentials(&models.GoogleCalendarCredentials{
+		ID: uuid.New(), UserID: encryptedUser, AccessToken: "old-access", RefreshToken: "old-refresh",
+	})
+	require.NoError(t, err)
+	plaintextID := uuid.New()
+
+	// Tokens of the retired key still decrypt
+	token, err := rotated.open(encryptedUser, encrypted.AccessToken, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "old-access", token)
+
+	mock.ExpectQuery(`SELECT \* FROM "google_calendar_credentials" WHERE key_version <> \$1`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "access_token", "refresh_token", "key_version"}).
+			AddRow(encrypted.ID, encryptedUser, encrypted.AccessToken, encrypted.RefreshToken, 1).
+			AddRow(plaintextID, plaintextUser, "plain-access", "plain-refresh", 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "google_calendar_credentials" SET "access_token"=\$1,"key_version"=\$2,"refresh_token"=\$3`).
+		WithArgs(sealedToken{rotated, encryptedUser, "old-access", 2}, 2, sealedToken{rotated, encryptedUser, "old-refresh", 2},
+			sqlmock.AnyArg(), encrypted.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "google_calendar_credentials" SET "access_token"=\$1,"key_version"=\$2,"refresh_token"=\$3`).
+		WithArgs(sealedToken{rotated, plaintextUser, "plain-access", 2}, 2, sealedToken{rotated, plaintextUser, "plain-refresh", 2},
+			sqlmock.AnyArg(), plaintextID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	count, err := rotated.rotateCalendarTokens(db.DB)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoadCalendarTokenCipher_RetiredKeys(t *testing.T) {
+	t.Setenv(calendarTokenKeyEnv, base64.StdEncoding.EncodeToString(testCalendarTokenKey(3)))
+	t.Setenv(calendarTokenKeyVersionEnv, "3")
+	t.Setenv(calendarTokenRetiredKeyEnv+"2", base64.StdEncoding.EncodeToString(testCalendarTokenKey(2)))
+
+	tokenCipher, err := loadCalendarTokenCipher()
+	require.NoError(t, err)
+	assert.Equal(t, 3, tokenCipher.version)
+	assert.Contains(t, tokenCipher.aeads, 2)
+
+	credentials := &models.GoogleCalendarCredentials{UserID: uuid.New(), AccessToken: "a", RefreshToken: "r"}
+	stored, err := tokenCipher.encryptCredentials(credentials)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stored.KeyVersion)
+	assert.Equal(t, "a", credentials.AccessToken, "the caller's copy keeps the plaintext")
+
+	require.NoError(t, decryptCredentials(tokenCipher, stored))
+	assert.Equal(t, "r", stored.RefreshToken)
+
+	stored.KeyVersion = 1
+	assert.Error(t, decryptCredentials(tokenCipher, stored), "there is no key for version 1")
+}
+
+func TestPrepareCalendarTokenEncryption_FailsWithoutKey(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	t.Setenv(calendarTokenKeyEnv, "")
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "google_calendar_credentials"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	err := PrepareCalendarTokenEncryption(db.DB)
+	assert.ErrorIs(t, err, ErrCalendarTokenKeyMissing)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "google_calendar_credentials"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	assert.NoError(t, PrepareCalendarTokenEncryption(db.DB), "nothing to protect yet")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
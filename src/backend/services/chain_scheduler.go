@@ -0,0 +1,629 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// SchedulerCheckInterval is how often the scheduler looks for due chains
+	SchedulerCheckInterval = time.Minute
+	// scheduleGracePeriod is how late a run may start and still count as on time
+	scheduleGracePeriod = 2 * SchedulerCheckInterval
+	// maxCatchUpScan bounds how many missed occurrences are counted after downtime
+	maxCatchUpScan = 1000
+)
+
+// CronSchedule is a parsed five-field cron expression bound to a timezone
+type CronSchedule struct {
+	minute   uint64
+	hour     uint64
+	dom      uint64
+	month    uint64
+	dow      uint64
+	domStar  bool
+	dowStar  bool
+	location *time.Location
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCronSchedule parses a standard cron expression evaluated in the given IANA timezone
+func ParseCronSchedule(expr string, timezone string) (*CronSchedule, error) {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidInput, timezone)
+	}
+
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("%w: cron expression must have 5 fields, got %d", ErrInvalidInput, len(parts))
+	}
+
+	schedule := &CronSchedule{location: location}
+	masks := make([]uint64, len(cronFields))
+	for i, part := range parts {
+		mask, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		masks[i] = mask
+	}
+
+	schedule.minute, schedule.hour, schedule.dom, schedule.month, schedule.dow = masks[0], masks[1], masks[2], masks[3], masks[4]
+	schedule.domStar = parts[2] == "*" || strings.HasPrefix(parts[2], "*/")
+	schedule.dowStar = parts[4] == "*" || strings.HasPrefix(parts[4], "*/")
+
+	return schedule, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges and steps into a bit mask
+func parseCronField(value string, field cronField) (uint64, error) {
+	var mask uint64
+	for _, item := range strings.Split(value, ",") {
+		step := 1
+		if idx := strings.Index(item, "/"); idx >= 0 {
+			n, err := strconv.Atoi(item[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%w: invalid step in %s field %q", ErrInvalidInput, field.name, value)
+			}
+			step = n
+			item = item[:idx]
+		}
+
+		start, end := field.min, field.max
+		switch {
+		case item == "*":
+		case strings.Contains(item, "-"):
+			bounds := strings.SplitN(item, "-", 2)
+			var err1, err2 error
+			start, err1 = strconv.Atoi(bounds[0])
+			end, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("%w: invalid range in %s field %q", ErrInvalidInput, field.name, value)
+			}
+		default:
+			n, err := strconv.Atoi(item)
+			if err != nil {
+				return 0, fmt.Errorf("%w: invalid value in %s field %q", ErrInvalidInput, field.name, value)
+			}
+			start = n
+			if step == 1 {
+				end = n
+			}
+		}
+
+		// Allow 7 as Sunday in the day of week field
+		if field.name == "day of week" && end == 7 {
+			if start == 7 {
+				start, end = 0, 0
+			} else {
+				end = 6
+				mask |= 1
+			}
+		}
+
+		if start < field.min || end > field.max || start > end {
+			return 0, fmt.Errorf("%w: %s field %q out of range %d-%d", ErrInvalidInput, field.name, value, field.min, field.max)
+		}
+
+		for i := start; i <= end; i += step {
+			mask |= 1 << uint(i)
+		}
+	}
+	return mask, nil
+}
+
+// Location returns the timezone the schedule is evaluated in
+func (c *CronSchedule) Location() *time.Location {
+	return c.location
+}
+
+// Next returns the first scheduled time strictly after the given time
+func (c *CronSchedule) Next(after time.Time) time.Time {
+	t := after.In(c.location).Truncate(time.Minute).Add(time.Minute)
+
+	// Give up after five years; only impossible dates such as Feb 30 get here
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.location)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.location)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.location)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches applies cron's rule that restricted day-of-month and day-of-week fields are ORed
+func (c *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// DueRuns reports how many runs should start now for a schedule whose next run was
+// nextRun, and the following run time. A run that is on time always executes; runs
+// missed while the scheduler was down are replayed up to maxMissed times.
+func (c *CronSchedule) DueRuns(nextRun, now time.Time, maxMissed int) (int, time.Time) {
+	if now.Before(nextRun) {
+		return 0, nextRun
+	}
+
+	occurrences := 0
+	latest := nextRun
+	for t := nextRun; !t.IsZero() && !t.After(now) && occurrences < maxCatchUpScan; t = c.Next(t) {
+		occurrences++
+		latest = t
+	}
+
+	following := c.Next(now)
+
+	runs := 0
+	missed := occurrences
+	if now.Sub(latest) < scheduleGracePeriod {
+		runs = 1
+		missed--
+	}
+	if maxMissed > 0 {
+		if missed > maxMissed {
+			missed = maxMissed
+		}
+		runs += missed
+	}
+
+	return runs, following
+}
+
+// ChainScheduler runs scheduled agent chains in the background
+type ChainScheduler struct {
+	db           *gorm.DB
+	orchestrator *AgentOrchestrator
+	interval     time.Duration
+	clock        Clock
+
+	mu        sync.Mutex
+	running   map[uuid.UUID]bool
+	isRunning bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewChainScheduler creates a scheduler that executes chains through the given orchestrator
+func NewChainScheduler(db *gorm.DB, orchestrator *AgentOrchestrator) *ChainScheduler {
+	return &ChainScheduler{
+		db:           db,
+		orchestrator: orchestrator,
+		interval:     SchedulerCheckInterval,
+		clock:        SystemClock,
+		running:      make(map[uuid.UUID]bool),
+	}
+}
+
+func (s *ChainScheduler) now() time.Time {
+	return clockNow(s.clock)
+}
+
+// Start begins checking for due schedules every interval
+func (s *ChainScheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isRunning {
+		return
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.isRunning = true
+
+	s.wg.Add(1)
+	go s.loop()
+	log.Println("Chain scheduler started")
+}
+
+// Stop halts the scheduler and waits up to timeout for in-flight runs to finish
+func (s *ChainScheduler) Stop(timeout time.Duration) {
+	s.mu.Lock()
+	if !s.isRunning {
+		s.mu.Unlock()
+		return
+	}
+	s.isRunning = false
+	s.cancel()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("Chain scheduler stopped")
+	case <-time.After(timeout):
+		log.Printf("Chain scheduler stopped with runs still in progress after %s", timeout)
+	}
+}
+
+func (s *ChainScheduler) loop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.RunDue()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.RunDue()
+		}
+	}
+}
+
+// RunDue starts every enabled schedule whose next run has passed
+func (s *ChainScheduler) RunDue() {
+	if AIPauseInstance.Paused() {
+		// Schedules stay due and run at the first check after AI resumes
+		return
+	}
+	now := s.now()
+
+	var schedules []models.ScheduledChain
+	if err := s.db.Where("enabled = ? AND (next_run IS NULL OR next_run <= ?)", true, now).Find(&schedules).Error; err != nil {
+		log.Printf("Chain scheduler: failed to load schedules: %v", err)
+		return
+	}
+
+	for i := range schedules {
+		schedule := schedules[i]
+
+		cron, err := ParseCronSchedule(schedule.CronExpression, schedule.Timezone)
+		if err != nil {
+			log.Printf("Chain scheduler: disabling schedule %s with invalid cron: %v", schedule.ID, err)
+			s.db.Model(&schedule).Updates(map[string]interface{}{"enabled": false, "last_error": err.Error()})
+			continue
+		}
+
+		// New schedules only get their first run time
+		if schedule.NextRun == nil {
+			next := cron.Next(now)
+			s.db.Model(&schedule).Update("next_run", next)
+			continue
+		}
+
+		runs, next := cron.DueRuns(*schedule.NextRun, now, schedule.MaxMissedRuns)
+		updates := map[string]interface{}{"next_run": next}
+		if runs == 0 {
+			updates["last_status"] = "skipped"
+			s.db.Model(&schedule).Updates(updates)
+			continue
+		}
+
+		if !s.markRunning(schedule.ID) {
+			// Previous run still in progress; try again at the next occurrence
+			log.Printf("Chain scheduler: schedule %s still running, skipping", schedule.ID)
+			s.db.Model(&schedule).Updates(updates)
+			continue
+		}
+
+		s.db.Model(&schedule).Updates(updates)
+
+		s.wg.Add(1)
+		go func(schedule models.ScheduledChain, runs int) {
+			defer s.wg.Done()
+			defer s.clearRunning(schedule.ID)
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Chain scheduler: schedule %s panicked: %v", schedule.ID, r)
+				}
+			}()
+
+			for i := 0; i < runs; i++ {
+				if s.ctx.Err() != nil {
+					return
+				}
+				s.runSchedule(schedule)
+			}
+		}(schedule, runs)
+	}
+}
+
+func (s *ChainScheduler) markRunning(id uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[id] {
+		return false
+	}
+	s.running[id] = true
+	return true
+}
+
+func (s *ChainScheduler) clearRunning(id uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, id)
+}
+
+// runSchedule executes one run of a schedule and records the outcome
+func (s *ChainScheduler) runSchedule(schedule models.ScheduledChain) {
+	startedAt := s.now()
+	updates := map[string]interface{}{"last_run": startedAt}
+
+	result, err := s.executeScheduledChain(schedule)
+	if result != nil {
+		updates["last_execution_id"] = result.ID
+	}
+	if err != nil {
+		log.Printf("Chain scheduler: schedule %s failed: %v", schedule.ID, err)
+		updates["last_status"] = "failed"
+		updates["last_error"] = err.Error()
+	} else {
+		updates["last_status"] = "completed"
+		updates["last_error"] = ""
+	}
+
+	if err := s.db.Model(&models.ScheduledChain{}).Where("id = ?", schedule.ID).Updates(updates).Error; err != nil {
+		log.Printf("Chain scheduler: failed to record run for schedule %s: %v", schedule.ID, err)
+	}
+}
+
+// executeScheduledChain runs a fresh copy of the scheduled chain so each run gets its own execution record
+func (s *ChainScheduler) executeScheduledChain(schedule models.ScheduledChain) (*ChainExecutionResult, error) {
+	chain, err := s.orchestrator.LoadChainDefinition(schedule.ChainID)
+	if err != nil {
+		chain, err = ChainFromSnapshot(schedule.ChainDefinition)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load chain %s: %w", schedule.ChainID, err)
+		}
+	}
+
+	run := *chain
+	run.ID = uuid.New().String()
+	run.UserID = schedule.UserID
+	run.CreatedAt = s.now()
+	run.UpdatedAt = run.CreatedAt
+	if schedule.Name != "" {
+		run.Name = schedule.Name
+	}
+
+	if err := s.orchestrator.CreateCustomChain(&run); err != nil {
+		return nil, err
+	}
+
+	// Runs are cancelled when the scheduler stops
+	return s.orchestrator.ExecuteChain(s.ctx, ChainExecutionRequest{
+		ChainID:     run.ID,
+		InitialData: schedule.InitialData,
+		UserID:      schedule.UserID,
+	})
+}
+
+// ChainSnapshot serializes a chain definition for storage with a schedule
+func ChainSnapshot(chain *AgentChain) (models.AIMetadata, error) {
+	data, err := json.Marshal(chain)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot models.AIMetadata
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// ChainFromSnapshot restores a chain definition stored with a schedule
+func ChainFromSnapshot(snapshot models.AIMetadata) (*AgentChain, error) {
+	if len(snapshot) == 0 {
+		return nil, fmt.Errorf("no chain definition stored")
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var chain AgentChain
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return nil, err
+	}
+	if len(chain.Agents) == 0 {
+		return nil, fmt.Errorf("stored chain definition has no agents")
+	}
+	return &chain, nil
+}
+
+// ScheduleInput holds the user-editable fields of a scheduled chain
+type ScheduleInput struct {
+	ChainID        *string                `json:"chain_id"`
+	Name           *string                `json:"name"`
+	CronExpression *string                `json:"cron_expression"`
+	Timezone       *string                `json:"timezone"`
+	InitialData    map[string]interface{} `json:"initial_data"`
+	Enabled        *bool                  `json:"enabled"`
+	MaxMissedRuns  *int                   `json:"max_missed_runs"`
+}
+
+// ListSchedules returns the user's scheduled chains
+func (s *ChainScheduler) ListSchedules(userID uuid.UUID) ([]models.ScheduledChain, error) {
+	var schedules []models.ScheduledChain
+	if err := s.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// GetSchedule returns a single scheduled chain owned by the user
+func (s *ChainScheduler) GetSchedule(userID uuid.UUID, id string) (*models.ScheduledChain, error) {
+	var schedule models.ScheduledChain
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&schedule).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// CreateSchedule validates and stores a new scheduled chain
+func (s *ChainScheduler) CreateSchedule(userID uuid.UUID, input ScheduleInput) (*models.ScheduledChain, error) {
+	if input.ChainID == nil || *input.ChainID == "" {
+		return nil, fmt.Errorf("%w: chain_id is required", ErrInvalidInput)
+	}
+	if input.CronExpression == nil || *input.CronExpression == "" {
+		return nil, fmt.Errorf("%w: cron_expression is required", ErrInvalidInput)
+	}
+
+	schedule := &models.ScheduledChain{
+		UserID:        userID,
+		Timezone:      "UTC",
+		Enabled:       true,
+		MaxMissedRuns: 1,
+		InitialData:   models.AIMetadata{},
+	}
+	if err := s.applyScheduleInput(schedule, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(schedule).Error; err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// UpdateSchedule applies changes to a scheduled chain and recomputes its next run
+func (s *ChainScheduler) UpdateSchedule(userID uuid.UUID, id string, input ScheduleInput) (*models.ScheduledChain, error) {
+	schedule, err := s.GetSchedule(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyScheduleInput(schedule, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(schedule).Error; err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// DeleteSchedule removes a scheduled chain
+func (s *ChainScheduler) DeleteSchedule(userID uuid.UUID, id string) error {
+	result := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.ScheduledChain{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// applyScheduleInput validates the input and copies it onto the schedule
+func (s *ChainScheduler) applyScheduleInput(schedule *models.ScheduledChain, input ScheduleInput) error {
+	if input.ChainID != nil {
+		chain, err := s.orchestrator.LoadChainDefinition(*input.ChainID)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		// Built-in chains have no owner; anyone else's chain is not found
+		if chain.UserID != uuid.Nil && chain.UserID != schedule.UserID {
+			return fmt.Errorf("%w: chain %s", ErrNotFound, *input.ChainID)
+		}
+		// Custom chains only live in memory, so keep a copy to run from later
+		snapshot, err := ChainSnapshot(chain)
+		if err != nil {
+			return err
+		}
+		schedule.ChainID = *input.ChainID
+		schedule.ChainDefinition = snapshot
+	}
+	if input.Name != nil {
+		schedule.Name = *input.Name
+	}
+	if input.CronExpression != nil {
+		schedule.CronExpression = *input.CronExpression
+	}
+	if input.Timezone != nil {
+		schedule.Timezone = *input.Timezone
+	}
+	if input.InitialData != nil {
+		schedule.InitialData = models.AIMetadata(input.InitialData)
+	}
+	if input.Enabled != nil {
+		schedule.Enabled = *input.Enabled
+	}
+	if input.MaxMissedRuns != nil {
+		if *input.MaxMissedRuns < 0 {
+			return fmt.Errorf("%w: max_missed_runs must not be negative", ErrInvalidInput)
+		}
+		schedule.MaxMissedRuns = *input.MaxMissedRuns
+	}
+
+	cron, err := ParseCronSchedule(schedule.CronExpression, schedule.Timezone)
+	if err != nil {
+		return err
+	}
+
+	next := cron.Next(s.now())
+	schedule.NextRun = &next
+	return nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronSchedule_Valid(t *testing.T) {
+	expressions := []string{
+		"* * * * *",
+		"0 9 * * 1-5",
+		"*/15 * * * *",
+		"0 0,12 1 */2 *",
+		"30 6 * * 7",
+		"@daily",
+		"@hourly",
+	}
+
+	for _, expr := range expressions {
+		_, err := ParseCronSchedule(expr, "UTC")
+		assert.NoError(t, err, expr)
+	}
+}
+
+func TestParseCronSchedule_Invalid(t *testing.T) {
+	expressions := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	}
+
+	for _, expr := range expressions {
+		_, err := ParseCronSchedule(expr, "UTC")
+		assert.Error(t, err, expr)
+		assert.True(t, errors.Is(err, ErrInvalidInput), expr)
+	}
+
+	_, err := ParseCronSchedule("* * * * *", "Mars/Olympus_Mons")
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	base := time.Date(2024, 3, 15, 10, 30, 45, 0, time.UTC) // Friday
+
+	cases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2024, 3, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 3, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2024, 3, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		schedule, err := ParseCronSchedule(tc.expr, "UTC")
+		require.NoError(t, err, tc.expr)
+		assert.True(t, tc.expected.Equal(schedule.Next(base)), "%s: got %s", tc.expr, schedule.Next(base))
+	}
+}
+
+func TestCronSchedule_NextTimezone(t *testing.T) {
+	schedule, err := ParseCronSchedule("0 8 * * *", "America/New_York")
+	require.NoError(t, err)
+
+	// 08:00 in New York is 12:00 UTC during daylight saving time
+	next := schedule.Next(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC))
+	assert.True(t, time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC).Equal(next), next.String())
+
+	// and 13:00 UTC in winter
+	next = schedule.Next(time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC))
+	assert.True(t, time.Date(2024, 1, 10, 13, 0, 0, 0, time.UTC).Equal(next), next.String())
+}
+
+func TestCronSchedule_DueRuns(t *testing.T) {
+	schedule, err := ParseCronSchedule("0 * * * *", "UTC")
+	require.NoError(t, err)
+
+	nextRun := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	// Not yet due
+	runs, next := schedule.DueRuns(nextRun, nextRun.Add(-time.Minute), 1)
+	assert.Equal(t, 0, runs)
+	assert.True(t, nextRun.Equal(next))
+
+	// Due on time
+	runs, next = schedule.DueRuns(nextRun, nextRun.Add(30*time.Second), 1)
+	assert.Equal(t, 1, runs)
+	assert.True(t, nextRun.Add(time.Hour).Equal(next))
+
+	// Down for five hours with the latest occurrence on time: one on time, missed capped
+	now := nextRun.Add(5*time.Hour + 10*time.Second)
+	runs, next = schedule.DueRuns(nextRun, now, 2)
+	assert.Equal(t, 3, runs)
+	assert.True(t, nextRun.Add(6*time.Hour).Equal(next))
+
+	// Missed runs are dropped when the policy allows none
+	runs, _ = schedule.DueRuns(nextRun, nextRun.Add(90*time.Minute), 0)
+	assert.Equal(t, 0, runs)
+
+	// Missed runs are replayed up to the policy limit
+	runs, _ = schedule.DueRuns(nextRun, nextRun.Add(150*time.Minute), 5)
+	assert.Equal(t, 3, runs)
+}
+
+func TestChainSnapshotRoundTrip(t *testing.T) {
+	chain := &AgentChain{
+		ID:   "custom",
+		Name: "Daily News",
+		Mode: ChainModeSequential,
+		Agents: []AgentDefinition{
+			{ID: "search", Type: AgentTypeWebSearch, Name: "Search", OutputKey: "search_results"},
+		},
+	}
+
+	snapshot, err := ChainSnapshot(chain)
+	require.NoError(t, err)
+
+	restored, err := ChainFromSnapshot(snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, chain.Name, restored.Name)
+	assert.Equal(t, chain.Mode, restored.Mode)
+	assert.Equal(t, chain.Agents[0].Type, restored.Agents[0].Type)
+
+	_, err = ChainFromSnapshot(nil)
+	assert.Error(t, err)
+}
+
+func TestCreateSchedule_StoresDisabledScheduleWithoutReplays(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	s := NewChainScheduler(db.DB, &AgentOrchestrator{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "scheduled_chains" \(.*"enabled","max_missed_runs",.*\) VALUES`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+
+	chainID, cron, enabled, maxMissedRuns := "research-and-summarize", "0 9 * * *", false, 0
+	schedule, err := s.CreateSchedule(uuid.New(), ScheduleInput{
+		ChainID: &chainID, CronExpression: &cron, Enabled: &enabled, MaxMissedRuns: &maxMissedRuns,
+	})
+	require.NoError(t, err)
+	assert.False(t, schedule.Enabled)
+	assert.Zero(t, schedule.MaxMissedRuns)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateSchedule_RejectsAnotherUsersChain(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	chainID := uuid.New().String()
+	s := NewChainScheduler(db.DB, &AgentOrchestrator{
+		activeChains: map[string]*AgentChain{
+			chainID: {ID: chainID, Name: "Private", Mode: ChainModeSequential, UserID: uuid.New()},
+		},
+	})
+
+	cron := "0 9 * * *"
+	_, err := s.CreateSchedule(uuid.New(), ScheduleInput{ChainID: &chainID, CronExpression: &cron})
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// chatTranscriptTitleChars is how much of the first question titles a transcript
+const chatTranscriptTitleChars = 80
+
+// chatRoleLabels are the headings of the messages in a transcript
+var chatRoleLabels = map[string]string{
+	"user":      "You",
+	"assistant": "Assistant",
+	"system":    "System",
+}
+
+// ChatTranscript is a chat session rendered as Markdown
+type ChatTranscript struct {
+	SessionID string    `json:"session_id"`
+	Title     string    `json:"title"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	Messages  int       `json:"messages"`
+	Markdown  string    `json:"markdown"`
+}
+
+// Filename is the name a transcript is downloaded as
+func (t *ChatTranscript) Filename() string {
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, t.SessionID)
+	return fmt.Sprintf("chat-%s-%s.md", t.StartedAt.Format("2006-01-02"), name)
+}
+
+// ExportChatSession renders the messages of one of the user's chat sessions
+// as a Markdown transcript, oldest first, with the sources the assistant
+// cited. It returns ErrNotFound when the user has no such session.
+func (c *ChatService) ExportChatSession(ctx context.Context, userID uuid.UUID, sessionID string) (*ChatTranscript, error) {
+	if strings.TrimSpace(sessionID) == "" {
+		return nil, fmt.Errorf("%w: session id is required", ErrInvalidInput)
+	}
+
+	var messages []models.ChatMemory
+	if err := c.db.WithContext(ctx).
+		Where("user_id = ? AND session_id = ?", userID, sessionID).
+		Order("created_at ASC").
+		Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to load chat session: %w", err)
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("%w: chat session %s", ErrNotFound, sessionID)
+	}
+
+	transcript := &ChatTranscript{
+		SessionID: sessionID,
+		Title:     "Chat session",
+		StartedAt: messages[0].CreatedAt,
+		EndedAt:   messages[len(messages)-1].CreatedAt,
+		Messages:  len(messages),
+	}
+	for _, message := range messages {
+		if message.Role == "user" && strings.TrimSpace(message.Content) != "" {
+			transcript.Title, _ = trimNoteContent(strings.Join(strings.Fields(message.Content), " "), chatTranscriptTitleChars)
+			break
+		}
+	}
+	transcript.Markdown = renderChatTranscript(transcript, messages)
+	return transcript, nil
+}
+
+// renderChatTranscript writes the session metadata followed by one section
+// per message
+func renderChatTranscript(transcript *ChatTranscript, messages []models.ChatMemory) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", transcript.Title)
+	fmt.Fprintf(&b, "- Session: `%s`\n", transcript.SessionID)
+	fmt.Fprintf(&b, "- Started: %s\n", transcript.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Ended: %s\n", transcript.EndedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Messages: %d\n", transcript.Messages)
+
+	for _, message := range messages {
+		label, ok := chatRoleLabels[message.Role]
+		if !ok {
+			label = message.Role
+		}
+		fmt.Fprintf(&b, "\n---\n\n### %s · %s\n\n%s\n", label, message.CreatedAt.Format("2006-01-02 15:04"), strings.TrimSpace(message.Content))
+
+		if citations := chatCitations(message.Metadata); len(citations) > 0 {
+			b.WriteString("\n**Sources:**\n")
+			for i, citation := range citations {
+				fmt.Fprintf(&b, "%d. %s\n", i+1, citation)
+			}
+		}
+	}
+	return b.String()
+}
+
+// chatCitations lists the sources stored with an assistant message
+func chatCitations(metadata models.AIMetadata) []string {
+	sources, _ := metadata["sources"].([]interface{})
+	var citations []string
+	for _, raw := range sources {
+		source, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		title, _ := source["title"].(string)
+		sourceType, _ := source["type"].(string)
+		id, _ := source["id"].(string)
+		if title == "" {
+			title = id
+		}
+		citation := title
+		if sourceType != "" {
+			citation = fmt.Sprintf("%s (%s)", title, sourceType)
+		}
+		citations = append(citations, citation)
+	}
+	return citations
+}
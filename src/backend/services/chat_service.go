@@ -2,11 +2,13 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
 	"strings"
 	"time"
+	"unicode"
 
 	"owlistic-notes/owlistic/models"
 
@@ -26,6 +28,33 @@ type ChatRequest struct {
 	Message   string `json:"message"`
 	SessionID string `json:"session_id"`
 	Context   string `json:"context"` // optional context override
+	TopK      int    `json:"top_k,omitempty"`              // notes retrieved for context, capped at MaxChatTopK
+	NoteChars int    `json:"note_content_chars,omitempty"` // content budget per note, capped at MaxChatNoteChars
+}
+
+// Retrieval defaults and server-side caps for chat RAG context
+const (
+	DefaultChatTopK      = 5
+	MaxChatTopK          = 20
+	DefaultChatNoteChars = 2000
+	MaxChatNoteChars     = 8000
+)
+
+// retrievalLimits returns the number of notes to retrieve and the per-note
+// content budget, applying defaults and caps
+func (req ChatRequest) retrievalLimits() (topK, noteChars int) {
+	topK, noteChars = req.TopK, req.NoteChars
+	if topK <= 0 {
+		topK = DefaultChatTopK
+	} else if topK > MaxChatTopK {
+		topK = MaxChatTopK
+	}
+	if noteChars <= 0 {
+		noteChars = DefaultChatNoteChars
+	} else if noteChars > MaxChatNoteChars {
+		noteChars = MaxChatNoteChars
+	}
+	return topK, noteChars
 }
 
 // ChatResponse represents the AI's response
@@ -43,6 +72,7 @@ type ChatSource struct {
 	Title     string `json:"title"`
 	Excerpt   string `json:"excerpt"`
 	Relevance float64 `json:"relevance"`
+	Truncated bool    `json:"truncated,omitempty"` // note content was trimmed to the budget
 }
 
 func NewChatService(db *gorm.DB, ai *AIService, noteService *NoteService) *ChatService {
@@ -61,7 +91,7 @@ func (c *ChatService) Chat(ctx context.Context, userID uuid.UUID, req ChatReques
 	}
 
 	// Store the user message in chat memory
-	if err := c.storeChatMessage(ctx, userID, req.SessionID, "user", req.Message); err != nil {
+	if err := c.storeChatMessage(ctx, userID, req.SessionID, "user", req.Message, models.AIMetadata{}); err != nil {
 		log.Printf("Failed to store user message: %v", err)
 	}
 
@@ -73,6 +103,7 @@ func (c *ChatService) Chat(ctx context.Context, userID uuid.UUID, req ChatReques
 
 	// Analyze the message to determine intent and extract key topics
 	intent, topics := c.analyzeMessage(ctx, req.Message)
+	topK, noteChars := req.retrievalLimits()
 	
 	// Retrieve relevant context based on intent
 	sources := []ChatSource{}
@@ -81,7 +112,7 @@ func (c *ChatService) Chat(ctx context.Context, userID uuid.UUID, req ChatReques
 	switch intent {
 	case "search", "question":
 		// Search for relevant notes and information
-		noteSources, noteContext := c.searchNotes(ctx, userID, req.Message, topics)
+		noteSources, noteContext := c.searchNotes(ctx, userID, req.Message, topics, topK, noteChars)
 		sources = append(sources, noteSources...)
 		contextText += noteContext
 		
@@ -100,7 +131,7 @@ func (c *ChatService) Chat(ctx context.Context, userID uuid.UUID, req ChatReques
 		
 	case "create", "generate":
 		// Gather context for creation
-		noteSources, noteContext := c.searchNotes(ctx, userID, req.Message, topics)
+		noteSources, noteContext := c.searchNotes(ctx, userID, req.Message, topics, topK, noteChars)
 		sources = append(sources, noteSources...)
 		contextText += noteContext
 		
@@ -118,12 +149,27 @@ func (c *ChatService) Chat(ctx context.Context, userID uuid.UUID, req ChatReques
 
 	// Generate response using AI with retrieved context
 	response, err := c.generateResponse(ctx, req.Message, contextText, history, intent)
+	if errors.Is(err, ErrAIUnavailable) {
+		// Still hand back what retrieval found, the notes may answer the question
+		return &ChatResponse{
+			Message:   AIUnavailableMessage,
+			Sources:   sources,
+			SessionID: req.SessionID,
+			Metadata: map[string]interface{}{
+				"intent":         intent,
+				"topics":         topics,
+				"source_count":   len(sources),
+				"ai_unavailable": true,
+			},
+		}, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate response: %w", err)
 	}
 
-	// Store the assistant's response
-	if err := c.storeChatMessage(ctx, userID, req.SessionID, "assistant", response); err != nil {
+	// Store the assistant's response along with what it drew on, so
+	// exported transcripts can cite it
+	if err := c.storeChatMessage(ctx, userID, req.SessionID, "assistant", response, models.AIMetadata{"sources": sources}); err != nil {
 		log.Printf("Failed to store assistant message: %v", err)
 	}
 
@@ -134,7 +180,10 @@ func (c *ChatService) Chat(ctx context.Context, userID uuid.UUID, req ChatReques
 		Metadata: map[string]interface{}{
 			"intent":       intent,
 			"topics":       topics,
-			"source_count": len(sources),
+			"source_count":       len(sources),
+			"top_k":              topK,
+			"note_content_chars": noteChars,
+			"included_note_ids":  includedNoteIDs(sources),
 		},
 	}, nil
 }
@@ -200,49 +249,56 @@ func (c *ChatService) extractTopics(message string) []string {
 	return topics
 }
 
-// searchNotes searches user's notes for relevant information
-func (c *ChatService) searchNotes(ctx context.Context, userID uuid.UUID, query string, topics []string) ([]ChatSource, string) {
+// searchNotes retrieves up to topK notes relevant to the query, preferring
+// semantic search and falling back to title and tag matching. Each note's
+// content is trimmed to noteChars before it goes into the prompt.
+func (c *ChatService) searchNotes(ctx context.Context, userID uuid.UUID, query string, topics []string, topK, noteChars int) ([]ChatSource, string) {
 	sources := []ChatSource{}
 	contextParts := []string{}
-	
-	// Search by query
-	var notes []models.Note
-	searchQuery := c.db.Where("user_id = ?", userID).
-		Where("deleted_at IS NULL")
-	
-	// Add topic-based search
-	if len(topics) > 0 {
-		for _, topic := range topics {
-			searchQuery = searchQuery.Where("title ILIKE ? OR tags::text ILIKE ?", 
-				"%"+topic+"%", "%"+topic+"%")
+
+	notes, relevance := c.semanticNotes(ctx, userID, query, topK)
+	if len(notes) == 0 {
+		// Search by query
+		searchQuery := c.db.Where("user_id = ?", userID).
+			Where("deleted_at IS NULL")
+		
+		// Add topic-based search
+		if len(topics) > 0 {
+			for _, topic := range topics {
+				searchQuery = searchQuery.Where("title ILIKE ? OR tags::text ILIKE ?", 
+					"%"+topic+"%", "%"+topic+"%")
+			}
 		}
+		
+		searchQuery.Limit(topK).Find(&notes)
 	}
 	
-	searchQuery.Limit(5).Find(&notes)
-	
 	// Process found notes
 	for _, note := range notes {
 		// Get note content
 		content := c.extractNoteContent(&note)
-		excerpt := content
-		if len(excerpt) > 200 {
-			excerpt = excerpt[:200] + "..."
+		score, ok := relevance[note.ID]
+		if !ok {
+			score = c.calculateRelevance(query, note.Title+" "+content)
 		}
+		trimmed, truncated := trimNoteContent(content, noteChars)
+		excerpt, _ := trimNoteContent(content, 200)
 		
 		source := ChatSource{
 			Type:      "note",
 			ID:        note.ID.String(),
 			Title:     note.Title,
 			Excerpt:   excerpt,
-			Relevance: c.calculateRelevance(query, note.Title + " " + content),
+			Relevance: score,
+			Truncated: truncated,
 		}
 		sources = append(sources, source)
 		
-		contextParts = append(contextParts, fmt.Sprintf("Note '%s': %s", note.Title, content))
+		contextParts = append(contextParts, fmt.Sprintf("Note '%s': %s", note.Title, trimmed))
 	}
 	
 	// Sort by relevance
-	sort.Slice(sources, func(i, j int) bool {
+	sort.SliceStable(sources, func(i, j int) bool {
 		return sources[i].Relevance > sources[j].Relevance
 	})
 	
@@ -250,6 +306,90 @@ func (c *ChatService) searchNotes(ctx context.Context, userID uuid.UUID, query s
 	return sources, context
 }
 
+// semanticNotes fetches the topK notes closest to the query from ChromaDB,
+// in rank order, along with their similarity. It returns nothing when vector
+// search is unavailable.
+func (c *ChatService) semanticNotes(ctx context.Context, userID uuid.UUID, query string, topK int) ([]models.Note, map[uuid.UUID]float64) {
+	if c.ai == nil || c.ai.chromaService == nil {
+		return nil, nil
+	}
+	where := map[string]interface{}{
+		"user_id": userID.String(),
+	}
+	results, err := c.ai.chromaService.QueryByText(ctx, c.ai.noteCollection(), []string{query}, topK, where)
+	if err != nil {
+		log.Printf("Semantic note search failed, falling back to keyword search: %v", err)
+		return nil, nil
+	}
+	if len(results.IDs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(results.IDs[0]))
+	relevance := make(map[uuid.UUID]float64, len(results.IDs[0]))
+	for i, chromaID := range results.IDs[0] {
+		noteID, err := ChromaIDToNoteID(chromaID)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, noteID)
+		if len(results.Distances) > 0 && len(results.Distances[0]) > i {
+			relevance[noteID] = distanceSimilarity(c.ai.collectionSpace(), results.Distances[0][i])
+		}
+	}
+	if len(ids) > topK {
+		ids = ids[:topK]
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var found []models.Note
+	if err := c.db.Where("id IN ? AND user_id = ?", ids, userID).Scopes(models.NotTrashed).Find(&found).Error; err != nil {
+		log.Printf("Failed to load notes from semantic search: %v", err)
+		return nil, nil
+	}
+	byID := make(map[uuid.UUID]models.Note, len(found))
+	for _, note := range found {
+		byID[note.ID] = note
+	}
+	notes := make([]models.Note, 0, len(found))
+	for _, id := range ids {
+		if note, ok := byID[id]; ok {
+			notes = append(notes, note)
+		}
+	}
+	return notes, relevance
+}
+
+// trimNoteContent cuts content to at most budget characters, preferring to
+// break at whitespace
+func trimNoteContent(content string, budget int) (string, bool) {
+	runes := []rune(content)
+	if budget <= 0 || len(runes) <= budget {
+		return content, false
+	}
+	cut := budget
+	for i := budget; i > budget*3/4; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimSpace(string(runes[:cut])) + "...", true
+}
+
+// includedNoteIDs lists the notes that were put into the prompt
+func includedNoteIDs(sources []ChatSource) []string {
+	ids := []string{}
+	for _, source := range sources {
+		if source.Type == "note" {
+			ids = append(ids, source.ID)
+		}
+	}
+	return ids
+}
+
 // searchTasks searches for relevant tasks
 func (c *ChatService) searchTasks(ctx context.Context, userID uuid.UUID, topics []string) ([]ChatSource, string) {
 	sources := []ChatSource{}
@@ -406,13 +546,13 @@ Please provide a helpful response that addresses the user's message, incorporati
 }
 
 // storeChatMessage stores a message in chat memory
-func (c *ChatService) storeChatMessage(ctx context.Context, userID uuid.UUID, sessionID, role, content string) error {
+func (c *ChatService) storeChatMessage(ctx context.Context, userID uuid.UUID, sessionID, role, content string, metadata models.AIMetadata) error {
 	memory := models.ChatMemory{
 		UserID:    userID,
 		SessionID: sessionID,
 		Role:      role,
 		Content:   content,
-		Metadata:  models.AIMetadata{},
+		Metadata:  metadata,
 	}
 	
 	return c.db.WithContext(ctx).Create(&memory).Error
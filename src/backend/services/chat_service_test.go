@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const chatQueryPath = "/api/v2/tenants/default_tenant/databases/default_database/collections/note_embeddings/query"
+
+func TestChatRequest_RetrievalLimits(t *testing.T) {
+	topK, noteChars := ChatRequest{}.retrievalLimits()
+	assert.Equal(t, DefaultChatTopK, topK)
+	assert.Equal(t, DefaultChatNoteChars, noteChars)
+
+	topK, noteChars = ChatRequest{TopK: 3, NoteChars: 500}.retrievalLimits()
+	assert.Equal(t, 3, topK)
+	assert.Equal(t, 500, noteChars)
+
+	topK, noteChars = ChatRequest{TopK: 1000, NoteChars: 1000000}.retrievalLimits()
+	assert.Equal(t, MaxChatTopK, topK)
+	assert.Equal(t, MaxChatNoteChars, noteChars)
+}
+
+func TestTrimNoteContent(t *testing.T) {
+	text, truncated := trimNoteContent("short note", 100)
+	assert.Equal(t, "short note", text)
+	assert.False(t, truncated)
+
+	text, truncated = trimNoteContent("the quick brown fox jumps over the lazy dog", 20)
+	assert.True(t, truncated)
+	assert.Equal(t, "the quick brown fox...", text)
+
+	// Multi-byte content is cut on rune boundaries
+	text, truncated = trimNoteContent(strings.Repeat("ü", 50), 10)
+	assert.True(t, truncated)
+	assert.Equal(t, strings.Repeat("ü", 10)+"...", text)
+}
+
+func TestChatSearchNotes_TopKAndTrimming(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteIDs := []uuid.UUID{uuid.New(), uuid.New()}
+	server := newChromaMockServer(t, map[string]string{
+		"POST " + chatQueryPath: fmt.Sprintf(`{"ids":[["%s","%s"]],"distances":[[0.1,0.3]]}`,
+			NoteIDToChromaID(noteIDs[0]), NoteIDToChromaID(noteIDs[1])),
+	})
+	chat := &ChatService{db: db.DB, ai: &AIService{chromaService: NewChromaService(server.URL, nil)}}
+
+	// Rows come back out of rank order, the service restores it
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE \(id IN \(\$1,\$2\) AND user_id = \$3\) AND "notes"."deleted_at" IS NULL`).
+		WithArgs(noteIDs[0], noteIDs[1], userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(noteIDs[1], userID, "Second").
+			AddRow(noteIDs[0], userID, "First"))
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE note_id = \$1`).
+		WithArgs(noteIDs[0]).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "content"}).
+			AddRow(uuid.New(), noteIDs[0], []byte(`{"text":"`+strings.Repeat("word ", 100)+`"}`)))
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE note_id = \$1`).
+		WithArgs(noteIDs[1]).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "content"}).
+			AddRow(uuid.New(), noteIDs[1], []byte(`{"text":"brief"}`)))
+
+	sources, context := chat.searchNotes(context.Background(), userID, "words", nil, 2, 50)
+
+	require.Len(t, sources, 2)
+	assert.Equal(t, noteIDs[0].String(), sources[0].ID)
+	assert.InDelta(t, 0.9, sources[0].Relevance, 1e-9)
+	assert.True(t, sources[0].Truncated)
+	assert.False(t, sources[1].Truncated)
+	assert.Equal(t, []string{noteIDs[0].String(), noteIDs[1].String()}, includedNoteIDs(sources))
+
+	query, ok := server.last("POST", chatQueryPath)
+	require.True(t, ok)
+	assert.Equal(t, float64(2), query.Body["n_results"])
+	assert.Equal(t, map[string]interface{}{"user_id": userID.String()}, query.Body["where"])
+
+	firstNote := strings.SplitN(context, "\n\n", 2)[0]
+	assert.Contains(t, firstNote, "Note 'First': First")
+	assert.LessOrEqual(t, len(firstNote), len("Relevant notes from user's knowledge base:\nNote 'First': ")+50+len("..."))
+	assert.NotContains(t, context, strings.Repeat("word ", 20))
+	assert.Contains(t, context, "brief")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChatSearchNotes_KeywordFallbackUsesTopK(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	server := newChromaMockServer(t, map[string]string{})
+	chat := &ChatService{db: db.DB, ai: &AIService{chromaService: NewChromaService(server.URL, nil)}}
+
+	noteID := uuid.New()
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE user_id = \$1 AND deleted_at IS NULL AND \(title ILIKE \$2 OR tags::text ILIKE \$3\) AND "notes"."deleted_at" IS NULL LIMIT \$4`).
+		WithArgs(userID, "%golang%", "%golang%", 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).AddRow(noteID, userID, "Golang"))
+	mock.ExpectQuery(`SELECT \* FROM "blocks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "content"}))
+
+	sources, _ := chat.searchNotes(context.Background(), userID, "golang", []string{"golang"}, 7, 100)
+	require.Len(t, sources, 1)
+	assert.Equal(t, noteID.String(), sources[0].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportChatSession_TranscriptInOrderWithRoles(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	start := time.Date(2025, 3, 4, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT \* FROM "chat_memories" WHERE \(user_id = \$1 AND session_id = \$2\) AND "chat_memories"."deleted_at" IS NULL ORDER BY created_at ASC`).
+		WithArgs(userID, "session-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "session_id", "role", "content", "metadata", "created_at"}).
+			AddRow(uuid.New(), userID, "session-1", "user", "What did I write about  Go generics?", []byte(`{}`), start).
+			AddRow(uuid.New(), userID, "session-1", "assistant", "You noted that generics reduce duplication.",
+				[]byte(`{"sources":[{"type":"note","id":"n1","title":"Go generics"},{"type":"task","id":"t1","title":"Try type sets"}]}`), start.Add(time.Minute)).
+			AddRow(uuid.New(), userID, "session-1", "user", "Anything else?", []byte(`{}`), start.Add(2*time.Minute)).
+			AddRow(uuid.New(), userID, "session-1", "assistant", "That's all I found.", []byte(`{"sources":[]}`), start.Add(3*time.Minute)))
+
+	chat := &ChatService{db: db.DB}
+	transcript, err := chat.ExportChatSession(context.Background(), userID, "session-1")
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, "What did I write about Go generics?", transcript.Title)
+	assert.Equal(t, start, transcript.StartedAt)
+	assert.Equal(t, start.Add(3*time.Minute), transcript.EndedAt)
+	assert.Equal(t, 4, transcript.Messages)
+	assert.Equal(t, "chat-2025-03-04-session-1.md", transcript.Filename())
+
+	markdown := transcript.Markdown
+	assert.True(t, strings.HasPrefix(markdown, "# What did I write about Go generics?\n"))
+	assert.Contains(t, markdown, "- Started: 2025-03-04T09:00:00Z\n- Ended: 2025-03-04T09:03:00Z\n")
+
+	// Turns alternate in the order they were sent
+	headings := []string{
+		"### You · 2025-03-04 09:00\n\nWhat did I write about  Go generics?",
+		"### Assistant · 2025-03-04 09:01\n\nYou noted that generics reduce duplication.",
+		"### You · 2025-03-04 09:02\n\nAnything else?",
+		"### Assistant · 2025-03-04 09:03\n\nThat's all I found.",
+	}
+	last := -1
+	for _, heading := range headings {
+		at := strings.Index(markdown, heading)
+		require.NotEqual(t, -1, at, heading)
+		assert.Greater(t, at, last, heading)
+		last = at
+	}
+
+	// Only the answer that cited something lists its sources
+	assert.Equal(t, 1, strings.Count(markdown, "**Sources:**"))
+	assert.Contains(t, markdown, "**Sources:**\n1. Go generics (note)\n2. Try type sets (task)\n")
+
+	// Another user's session, or a missing one, isn't found
+	mock.ExpectQuery(`FROM "chat_memories"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = chat.ExportChatSession(context.Background(), uuid.New(), "session-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
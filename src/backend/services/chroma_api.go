@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ChromaAPIVersion identifies the REST API generation a ChromaDB server speaks
+type ChromaAPIVersion string
+
+const (
+	ChromaAPIv1 ChromaAPIVersion = "v1" // ChromaDB 0.4.x/0.5.x, /api/v1/collections
+	ChromaAPIv2 ChromaAPIVersion = "v2" // ChromaDB 0.6+, /api/v2/tenants/.../collections
+)
+
+const (
+	chromaDefaultTenant   = "default_tenant"
+	chromaDefaultDatabase = "default_database"
+)
+
+// chromaURLBuilder builds collection endpoints for one API version
+type chromaURLBuilder interface {
+	// collectionsURL is the endpoint for listing and creating collections
+	collectionsURL() string
+	// collectionURL addresses a single collection by name or ID
+	collectionURL(ref string) string
+	// addressesByID reports whether document operations need the collection ID
+	// instead of its name
+	addressesByID() bool
+}
+
+type chromaV1URLs struct {
+	baseURL string
+}
+
+func (u chromaV1URLs) collectionsURL() string {
+	return u.baseURL + "/api/v1/collections"
+}
+
+func (u chromaV1URLs) collectionURL(ref string) string {
+	return fmt.Sprintf("%s/api/v1/collections/%s", u.baseURL, ref)
+}
+
+func (u chromaV1URLs) addressesByID() bool {
+	return true
+}
+
+type chromaV2URLs struct {
+	baseURL  string
+	tenant   string
+	database string
+}
+
+func (u chromaV2URLs) collectionsURL() string {
+	return fmt.Sprintf("%s/api/v2/tenants/%s/databases/%s/collections", u.baseURL, u.tenant, u.database)
+}
+
+func (u chromaV2URLs) collectionURL(ref string) string {
+	return fmt.Sprintf("%s/api/v2/tenants/%s/databases/%s/collections/%s", u.baseURL, u.tenant, u.database, ref)
+}
+
+func (u chromaV2URLs) addressesByID() bool {
+	return false
+}
+
+// newChromaURLBuilder returns the URL builder for an API version
+func newChromaURLBuilder(baseURL string, version ChromaAPIVersion) chromaURLBuilder {
+	if version == ChromaAPIv1 {
+		return chromaV1URLs{baseURL: baseURL}
+	}
+	return chromaV2URLs{baseURL: baseURL, tenant: chromaDefaultTenant, database: chromaDefaultDatabase}
+}
+
+// DetectAPIVersion probes the server's heartbeat and version endpoints and
+// switches the service to the matching API. When neither answers the current
+// version is kept and an error is returned.
+func (cs *ChromaService) DetectAPIVersion(ctx context.Context) (ChromaAPIVersion, error) {
+	if status, _, err := cs.probe(ctx, "/api/v2/heartbeat"); err == nil && status == http.StatusOK {
+		_, serverVersion, _ := cs.probe(ctx, "/api/v2/version")
+		cs.setAPIVersion(ChromaAPIv2)
+		log.Printf("Detected ChromaDB %s using API v2", chromaServerVersion(serverVersion))
+		return ChromaAPIv2, nil
+	}
+
+	status, serverVersion, err := cs.probe(ctx, "/api/v1/version")
+	if err != nil {
+		return cs.apiVersion, fmt.Errorf("failed to detect ChromaDB API version: %w", err)
+	}
+	if status != http.StatusOK {
+		return cs.apiVersion, fmt.Errorf("failed to detect ChromaDB API version: version endpoints returned status %d", status)
+	}
+	cs.setAPIVersion(ChromaAPIv1)
+	log.Printf("Detected ChromaDB %s using API v1", chromaServerVersion(serverVersion))
+	return ChromaAPIv1, nil
+}
+
+// APIVersion returns the API version requests are built for
+func (cs *ChromaService) APIVersion() ChromaAPIVersion {
+	return cs.apiVersion
+}
+
+func (cs *ChromaService) setAPIVersion(version ChromaAPIVersion) {
+	cs.apiVersion = version
+	cs.urls = newChromaURLBuilder(cs.baseURL, version)
+	cs.collectionIDsMu.Lock()
+	cs.collectionIDs = make(map[string]string)
+	cs.collectionIDsMu.Unlock()
+}
+
+// probe issues a GET against path and returns the status and body
+func (cs *ChromaService) probe(ctx context.Context, path string) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", cs.baseURL+path, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	resp, err := cs.httpClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), nil
+}
+
+// chromaServerVersion extracts the version string from a /version response,
+// which is returned as a bare JSON string
+func chromaServerVersion(body string) string {
+	var version string
+	if err := json.Unmarshal([]byte(body), &version); err == nil && version != "" {
+		return version
+	}
+	if trimmed := strings.TrimSpace(body); trimmed != "" {
+		return trimmed
+	}
+	return "(unknown version)"
+}
+
+// createCollectionPayload builds the create request for the active API. v2
+// takes index settings as a configuration object while v1 reads them from
+// "hnsw:*" metadata keys.
+func (cs *ChromaService) createCollectionPayload(name string, config *ChromaConfiguration, metadata map[string]interface{}) map[string]interface{} {
+	payload := map[string]interface{}{
+		"name":          name,
+		"get_or_create": true, // Use get_or_create to avoid conflicts
+		"metadata":      metadata,
+	}
+	if config == nil || config.HNSW == nil {
+		return payload
+	}
+
+	hnsw := config.HNSW
+	if cs.apiVersion == ChromaAPIv1 {
+		if hnsw.Space != "" {
+			metadata["hnsw:space"] = hnsw.Space
+		}
+		if hnsw.EFConstruction > 0 {
+			metadata["hnsw:construction_ef"] = hnsw.EFConstruction
+		}
+		if hnsw.EFSearch > 0 {
+			metadata["hnsw:search_ef"] = hnsw.EFSearch
+		}
+		if hnsw.MaxNeighbors > 0 {
+			metadata["hnsw:M"] = hnsw.MaxNeighbors
+		}
+		return payload
+	}
+
+	hnswMap := map[string]interface{}{
+		"space": hnsw.Space,
+	}
+	if hnsw.EFConstruction > 0 {
+		hnswMap["ef_construction"] = hnsw.EFConstruction
+	}
+	if hnsw.EFSearch > 0 {
+		hnswMap["ef_search"] = hnsw.EFSearch
+	}
+	if hnsw.MaxNeighbors > 0 {
+		hnswMap["max_neighbors"] = hnsw.MaxNeighbors
+	}
+	payload["configuration"] = map[string]interface{}{"hnsw": hnswMap}
+	return payload
+}
+
+// documentsURL returns the base URL for document operations on a collection.
+// v1 addresses collections by ID there, so the ID is looked up and cached.
+func (cs *ChromaService) documentsURL(ctx context.Context, collectionName string) (string, error) {
+	if !cs.urls.addressesByID() {
+		return cs.urls.collectionURL(collectionName), nil
+	}
+
+	cs.collectionIDsMu.Lock()
+	id, ok := cs.collectionIDs[collectionName]
+	cs.collectionIDsMu.Unlock()
+	if ok {
+		return cs.urls.collectionURL(id), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", cs.urls.collectionURL(collectionName), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := cs.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up collection: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to look up collection, status %d: %s", resp.StatusCode, string(body))
+	}
+	id, err = chromaCollectionID(body)
+	if err != nil {
+		return "", err
+	}
+	cs.rememberCollectionID(collectionName, id)
+	return cs.urls.collectionURL(id), nil
+}
+
+func (cs *ChromaService) rememberCollectionID(name, id string) {
+	cs.collectionIDsMu.Lock()
+	cs.collectionIDs[name] = id
+	cs.collectionIDsMu.Unlock()
+}
+
+func (cs *ChromaService) forgetCollectionID(name string) {
+	cs.collectionIDsMu.Lock()
+	delete(cs.collectionIDs, name)
+	cs.collectionIDsMu.Unlock()
+}
+
+// chromaCollectionID reads the id from a collection response
+func chromaCollectionID(body []byte) (string, error) {
+	var collection struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &collection); err != nil {
+		return "", fmt.Errorf("failed to decode collection response: %w", err)
+	}
+	if collection.ID == "" {
+		return "", fmt.Errorf("collection response has no id")
+	}
+	return collection.ID, nil
+}
+
+// decodeChromaCount reads a count response. Servers return a bare integer,
+// older builds of this service expected a {"count": n} object.
+func decodeChromaCount(body []byte) (int, error) {
+	var count int
+	if err := json.Unmarshal(body, &count); err == nil {
+		return count, nil
+	}
+	var wrapped map[string]int
+	if err := json.Unmarshal(body, &wrapped); err != nil {
+		return 0, fmt.Errorf("failed to decode count response: %w", err)
+	}
+	count, ok := wrapped["count"]
+	if !ok {
+		return 0, fmt.Errorf("count not found in response")
+	}
+	return count, nil
+}
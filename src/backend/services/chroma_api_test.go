@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chromaMockServer records requests and answers them from a route table
+type chromaMockServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []chromaMockRequest
+}
+
+type chromaMockRequest struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+func newChromaMockServer(t *testing.T, routes map[string]string) *chromaMockServer {
+	m := &chromaMockServer{}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		_ = json.Unmarshal(raw, &body)
+		m.mu.Lock()
+		m.requests = append(m.requests, chromaMockRequest{Method: r.Method, Path: r.URL.Path, Body: body})
+		m.mu.Unlock()
+
+		response, ok := routes[r.Method+" "+r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *chromaMockServer) last(method, path string) (chromaMockRequest, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.requests) - 1; i >= 0; i-- {
+		if m.requests[i].Method == method && m.requests[i].Path == path {
+			return m.requests[i], true
+		}
+	}
+	return chromaMockRequest{}, false
+}
+
+var testHNSWConfig = &ChromaConfiguration{
+	HNSW: &HNSWConfig{Space: "cosine", EFConstruction: 200, EFSearch: 100, MaxNeighbors: 32},
+}
+
+func TestChromaURLBuilders(t *testing.T) {
+	v1 := newChromaURLBuilder("http://chroma:8000", ChromaAPIv1)
+	assert.Equal(t, "http://chroma:8000/api/v1/collections", v1.collectionsURL())
+	assert.Equal(t, "http://chroma:8000/api/v1/collections/abc", v1.collectionURL("abc"))
+	assert.True(t, v1.addressesByID())
+
+	v2 := newChromaURLBuilder("http://chroma:8000", ChromaAPIv2)
+	assert.Equal(t, "http://chroma:8000/api/v2/tenants/default_tenant/databases/default_database/collections", v2.collectionsURL())
+	assert.Equal(t, "http://chroma:8000/api/v2/tenants/default_tenant/databases/default_database/collections/notes", v2.collectionURL("notes"))
+	assert.False(t, v2.addressesByID())
+}
+
+func TestChromaDetectAPIVersion_V2(t *testing.T) {
+	server := newChromaMockServer(t, map[string]string{
+		"GET /api/v2/heartbeat":                         `{"nanosecond heartbeat": 1}`,
+		"GET /api/v2/version":                           `"1.0.0"`,
+		"POST /api/v2/tenants":                          `{}`,
+		"POST /api/v2/tenants/default_tenant/databases": `{}`,
+		"POST /api/v2/tenants/default_tenant/databases/default_database/collections":            `{"id":"c2","name":"notes"}`,
+		"POST /api/v2/tenants/default_tenant/databases/default_database/collections/notes/add":  `{}`,
+		"GET /api/v2/tenants/default_tenant/databases/default_database/collections/notes/count": `3`,
+	})
+	cs := NewChromaService(server.URL, nil)
+	ctx := context.Background()
+
+	version, err := cs.DetectAPIVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ChromaAPIv2, version)
+
+	require.NoError(t, cs.GetOrCreateCollection(ctx, "notes", testHNSWConfig))
+	create, ok := server.last("POST", "/api/v2/tenants/default_tenant/databases/default_database/collections")
+	require.True(t, ok)
+	configuration := create.Body["configuration"].(map[string]interface{})
+	hnsw := configuration["hnsw"].(map[string]interface{})
+	assert.Equal(t, "cosine", hnsw["space"])
+	assert.Equal(t, float64(200), hnsw["ef_construction"])
+	assert.NotContains(t, create.Body["metadata"], "hnsw:space")
+
+	require.NoError(t, cs.AddDocuments(ctx, "notes", []string{"note_1"}, []string{"hello"}, []map[string]interface{}{{"title": "t"}}))
+	add, ok := server.last("POST", "/api/v2/tenants/default_tenant/databases/default_database/collections/notes/add")
+	require.True(t, ok)
+	assert.Equal(t, []interface{}{"note_1"}, add.Body["ids"])
+	assert.Equal(t, []interface{}{"hello"}, add.Body["documents"])
+
+	count, err := cs.CountDocuments(ctx, "notes")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func TestChromaDetectAPIVersion_V1(t *testing.T) {
+	server := newChromaMockServer(t, map[string]string{
+		"GET /api/v1/version":                 `"0.4.24"`,
+		"POST /api/v1/collections":            `{"id":"6f1c","name":"notes","metadata":{}}`,
+		"GET /api/v1/collections/notes":       `{"id":"6f1c","name":"notes","metadata":{}}`,
+		"POST /api/v1/collections/6f1c/add":   `true`,
+		"POST /api/v1/collections/6f1c/query": `{"ids":[["note_1"]],"documents":[["hello"]],"metadatas":[[{}]],"distances":[[0.1]]}`,
+		"GET /api/v1/collections/6f1c/count":  `7`,
+	})
+	cs := NewChromaService(server.URL, nil)
+	ctx := context.Background()
+
+	version, err := cs.DetectAPIVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ChromaAPIv1, version)
+
+	require.NoError(t, cs.GetOrCreateCollection(ctx, "notes", testHNSWConfig))
+	_, triedTenant := server.last("POST", "/api/v2/tenants")
+	assert.False(t, triedTenant, "v1 servers have no tenant endpoints")
+	create, ok := server.last("POST", "/api/v1/collections")
+	require.True(t, ok)
+	assert.NotContains(t, create.Body, "configuration")
+	metadata := create.Body["metadata"].(map[string]interface{})
+	assert.Equal(t, "cosine", metadata["hnsw:space"])
+	assert.Equal(t, float64(200), metadata["hnsw:construction_ef"])
+	assert.Equal(t, float64(100), metadata["hnsw:search_ef"])
+	assert.Equal(t, float64(32), metadata["hnsw:M"])
+
+	// Document operations address the collection by the ID returned on create
+	require.NoError(t, cs.AddDocuments(ctx, "notes", []string{"note_1"}, []string{"hello"}, []map[string]interface{}{{"title": "t"}}))
+	add, ok := server.last("POST", "/api/v1/collections/6f1c/add")
+	require.True(t, ok)
+	assert.Equal(t, []interface{}{"note_1"}, add.Body["ids"])
+
+	results, err := cs.QueryByText(ctx, "notes", []string{"hello"}, 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"note_1"}}, results.IDs)
+	query, _ := server.last("POST", "/api/v1/collections/6f1c/query")
+	assert.Equal(t, float64(2), query.Body["n_results"])
+	assert.Equal(t, []interface{}{"hello"}, query.Body["query_texts"])
+
+	count, err := cs.CountDocuments(ctx, "notes")
+	require.NoError(t, err)
+	assert.Equal(t, 7, count)
+}
+
+func TestChromaDocumentsURL_V1LooksUpCollectionID(t *testing.T) {
+	server := newChromaMockServer(t, map[string]string{
+		"GET /api/v1/version":                `"0.5.0"`,
+		"GET /api/v1/collections/notes":      `{"id":"abcd","name":"notes"}`,
+		"GET /api/v1/collections/abcd/count": `1`,
+	})
+	cs := NewChromaService(server.URL, nil)
+	ctx := context.Background()
+	_, err := cs.DetectAPIVersion(ctx)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		count, err := cs.CountDocuments(ctx, "notes")
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	}
+
+	lookups := 0
+	for _, req := range server.requests {
+		if req.Path == "/api/v1/collections/notes" {
+			lookups++
+		}
+	}
+	assert.Equal(t, 1, lookups, "collection ID should be cached")
+}
+
+func TestChromaDetectAPIVersion_Unreachable(t *testing.T) {
+	server := newChromaMockServer(t, map[string]string{})
+	cs := NewChromaService(server.URL, nil)
+
+	_, err := cs.DetectAPIVersion(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, ChromaAPIv2, cs.APIVersion())
+}
+
+func TestDecodeChromaCount(t *testing.T) {
+	count, err := decodeChromaCount([]byte(`5`))
+	require.NoError(t, err)
+	assert.Equal(t, 5, count)
+
+	count, err = decodeChromaCount([]byte(`{"count": 4}`))
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	_, err = decodeChromaCount([]byte(`"five"`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// chromaCollectionPattern is what Chroma accepts as a collection name: 3 to
+// 63 characters of letters, digits, dots, dashes and underscores, starting
+// and ending with a letter or digit
+var chromaCollectionPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{1,61}[a-zA-Z0-9]$`)
+
+// validChromaCollectionName tells whether Chroma accepts name
+func validChromaCollectionName(name string) bool {
+	return chromaCollectionPattern.MatchString(name) && !strings.Contains(name, "..")
+}
+
+// chromaCollectionName reads CHROMA_COLLECTION, the collection notes are
+// embedded in. Deployments sharing a Chroma server, such as staging and
+// production, keep their notes apart with different names. A name Chroma
+// would refuse is an error rather than a silent switch to the default
+// collection, which another deployment may be using.
+func chromaCollectionName() (string, error) {
+	name := strings.TrimSpace(os.Getenv("CHROMA_COLLECTION"))
+	if name == "" {
+		return NoteEmbeddingsCollection, nil
+	}
+	if !validChromaCollectionName(name) {
+		return "", fmt.Errorf("%w: CHROMA_COLLECTION %q must be 3 to 63 letters, digits, dots, dashes or underscores, starting and ending with a letter or digit", ErrInvalidInput, name)
+	}
+	return name, nil
+}
+
+// CheckChromaEnv reports invalid CHROMA_COLLECTION and CHROMA_HNSW_*
+// settings, so the server refuses to start with them
+func CheckChromaEnv() error {
+	if _, err := chromaCollectionName(); err != nil {
+		return err
+	}
+	_, err := defaultHNSWConfig()
+	return err
+}
+
+// noteCollection is the collection the service embeds notes in
+func (ai *AIService) noteCollection() string {
+	if ai.chromaCollection == "" {
+		return NoteEmbeddingsCollection
+	}
+	return ai.chromaCollection
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChromaCollection_ConfiguredNameUsedEverywhere(t *testing.T) {
+	t.Setenv("CHROMA_COLLECTION", "staging_notes")
+	collections := "/api/v2/tenants/default_tenant/databases/default_database/collections"
+	collection := collections + "/staging_notes"
+	server := newChromaMockServer(t, map[string]string{
+		"GET /api/v2/heartbeat":                         `{"nanosecond heartbeat": 1}`,
+		"GET /api/v2/version":                           `"1.0.0"`,
+		"POST /api/v2/tenants":                          `{}`,
+		"POST /api/v2/tenants/default_tenant/databases": `{}`,
+		"POST " + collections:                           `{"id":"c1","name":"staging_notes"}`,
+		"POST " + collection + "/add":                   `{}`,
+		"POST " + collection + "/query":                 `{"ids":[[]],"distances":[[]]}`,
+		"POST " + collection + "/delete":                `{}`,
+		"GET " + collection + "/count":                  `1`,
+	})
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	name, err := chromaCollectionName()
+	require.NoError(t, err)
+	ai := &AIService{db: db.DB, chromaService: NewChromaService(server.URL, nil), chromaCollection: name}
+	ctx := context.Background()
+	note := &models.Note{ID: uuid.New(), UserID: uuid.New(), Title: "Release plan"}
+
+	require.NoError(t, ai.initializeChromaCollection(ctx))
+	mock.ExpectQuery(`SELECT \* FROM "blocks"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	require.NoError(t, ai.AddNoteToChroma(ctx, note, nil))
+	_, err = ai.SearchNotesByEmbedding(ctx, "release", note.UserID, 5, RelevanceRanking, BackfillNone)
+	require.NoError(t, err)
+	require.NoError(t, ai.RemoveNoteFromChroma(ctx, note.ID))
+	stats, err := ai.GetChromaCollectionStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "staging_notes", stats["collection_name"])
+
+	create, ok := server.last("POST", collections)
+	require.True(t, ok)
+	assert.Equal(t, "staging_notes", create.Body["name"])
+	for _, path := range []string{"/add", "/query", "/delete"} {
+		_, ok := server.last("POST", collection+path)
+		assert.True(t, ok, "POST %s went to the configured collection", path)
+	}
+	_, ok = server.last("GET", collection+"/count")
+	assert.True(t, ok)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	for _, request := range server.requests {
+		assert.NotContains(t, request.Path, NoteEmbeddingsCollection)
+	}
+}
+
+func TestChromaCollectionName(t *testing.T) {
+	t.Setenv("CHROMA_COLLECTION", "")
+	name, err := chromaCollectionName()
+	require.NoError(t, err)
+	assert.Equal(t, NoteEmbeddingsCollection, name)
+
+	for _, invalid := range []string{"bad name!", "ab", "_notes", "notes..staging", strings.Repeat("n", 64)} {
+		t.Setenv("CHROMA_COLLECTION", invalid)
+		_, err := chromaCollectionName()
+		assert.ErrorIs(t, err, ErrInvalidInput, invalid)
+		assert.ErrorIs(t, CheckChromaEnv(), ErrInvalidInput, "an invalid collection stops startup")
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"owlistic-notes/owlistic/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// aiSettingHNSW is the AISetting key of the note collection's index parameters
+const aiSettingHNSW = "chroma_hnsw"
+
+// Accepted ranges of the tunable HNSW parameters
+const (
+	minHNSWEF           = 10
+	maxHNSWEF           = 1000
+	minHNSWMaxNeighbors = 2
+	maxHNSWMaxNeighbors = 128
+)
+
+// builtinHNSWConfig are the index parameters tuned for note search
+var builtinHNSWConfig = HNSWConfig{
+	Space:          "cosine", // Cosine similarity works well for text
+	EFConstruction: 200,      // Higher for better quality
+	EFSearch:       100,      // Good balance of speed and accuracy
+	MaxNeighbors:   32,       // More connections for better recall
+}
+
+// defaultHNSWConfig returns the note collection's index parameters from the
+// CHROMA_HNSW_* environment variables, the built-in ones where unset.
+// Values outside the ranges clients may pick are an error.
+func defaultHNSWConfig() (HNSWConfig, error) {
+	config := builtinHNSWConfig
+	if space := os.Getenv("CHROMA_HNSW_SPACE"); space != "" {
+		config.Space = space
+	}
+	for _, setting := range []struct {
+		key    string
+		target *int
+	}{
+		{"CHROMA_HNSW_EF_CONSTRUCTION", &config.EFConstruction},
+		{"CHROMA_HNSW_EF_SEARCH", &config.EFSearch},
+		{"CHROMA_HNSW_MAX_NEIGHBORS", &config.MaxNeighbors},
+	} {
+		value := os.Getenv(setting.key)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return HNSWConfig{}, fmt.Errorf("%w: %s must be a positive integer, got %q", ErrInvalidInput, setting.key, value)
+		}
+		*setting.target = parsed
+	}
+	if err := ValidateHNSWConfig(config); err != nil {
+		return HNSWConfig{}, fmt.Errorf("CHROMA_HNSW_* settings: %w", err)
+	}
+	return config, nil
+}
+
+// ValidateHNSWConfig checks the parameters a client may tune
+func ValidateHNSWConfig(config HNSWConfig) error {
+	switch config.Space {
+	case "cosine", "l2", "ip":
+	default:
+		return fmt.Errorf("%w: space must be cosine, l2 or ip", ErrInvalidInput)
+	}
+	if config.EFConstruction < minHNSWEF || config.EFConstruction > maxHNSWEF {
+		return fmt.Errorf("%w: ef_construction must be between %d and %d", ErrInvalidInput, minHNSWEF, maxHNSWEF)
+	}
+	if config.EFSearch < minHNSWEF || config.EFSearch > maxHNSWEF {
+		return fmt.Errorf("%w: ef_search must be between %d and %d", ErrInvalidInput, minHNSWEF, maxHNSWEF)
+	}
+	if config.MaxNeighbors < minHNSWMaxNeighbors || config.MaxNeighbors > maxHNSWMaxNeighbors {
+		return fmt.Errorf("%w: max_neighbors must be between %d and %d", ErrInvalidInput, minHNSWMaxNeighbors, maxHNSWMaxNeighbors)
+	}
+	return nil
+}
+
+// HNSWConfig returns the index parameters of the note collection: the ones
+// set through UpdateHNSWConfig, or the environment defaults
+func (ai *AIService) HNSWConfig(ctx context.Context) HNSWConfig {
+	config, err := defaultHNSWConfig()
+	if err != nil {
+		// Checked at startup, so only reached when the environment changed since
+		log.Printf("Ignoring %v", err)
+		config = builtinHNSWConfig
+	}
+	if ai.db == nil {
+		return config
+	}
+
+	var setting models.AISetting
+	err = ai.db.WithContext(ctx).Where("key = ?", aiSettingHNSW).First(&setting).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to read stored HNSW config, using defaults: %v", err)
+		}
+		return config
+	}
+
+	var stored HNSWConfig
+	if err := json.Unmarshal(setting.Value, &stored); err != nil || ValidateHNSWConfig(stored) != nil {
+		log.Printf("Ignoring invalid stored HNSW config: %s", setting.Value)
+		return config
+	}
+	return stored
+}
+
+// UpdateHNSWConfig recreates the note collection with new index parameters
+// and stores them. The collection is empty afterwards, so notes need a
+// reindex before semantic search finds them again. Returns the parameters
+// applied.
+func (ai *AIService) UpdateHNSWConfig(ctx context.Context, config HNSWConfig) (HNSWConfig, error) {
+	// Only the validated parameters are tunable, the rest keep Chroma's defaults
+	config = HNSWConfig{
+		Space:          config.Space,
+		EFConstruction: config.EFConstruction,
+		EFSearch:       config.EFSearch,
+		MaxNeighbors:   config.MaxNeighbors,
+	}
+	if err := ValidateHNSWConfig(config); err != nil {
+		return config, err
+	}
+	if BulkJobServiceInstance != nil {
+		running, err := BulkJobServiceInstance.isTypeRunning(models.BulkJobReindex)
+		if err != nil {
+			return config, err
+		}
+		if running {
+			return config, fmt.Errorf("%w: wait for the running reindex to finish", ErrBulkJobRunning)
+		}
+	}
+
+	value, err := json.Marshal(config)
+	if err != nil {
+		return config, err
+	}
+
+	if err := ai.chromaService.DeleteCollection(ctx, ai.noteCollection()); err != nil {
+		log.Printf("Failed to delete collection (may not exist): %v", err)
+	}
+	if err := ai.chromaService.GetOrCreateCollection(ctx, ai.noteCollection(), &ChromaConfiguration{HNSW: &config}); err != nil {
+		return config, fmt.Errorf("failed to recreate collection: %w", err)
+	}
+	ai.space.Store(config.Space)
+
+	setting := models.AISetting{Key: aiSettingHNSW, Value: value}
+	err = ai.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&setting).Error
+	return config, err
+}
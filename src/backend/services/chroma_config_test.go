@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateHNSWConfig(t *testing.T) {
+	valid := HNSWConfig{Space: "cosine", EFConstruction: 200, EFSearch: 100, MaxNeighbors: 32}
+	require.NoError(t, ValidateHNSWConfig(valid))
+
+	tests := []struct {
+		name   string
+		change func(*HNSWConfig)
+	}{
+		{"unknown space", func(c *HNSWConfig) { c.Space = "manhattan" }},
+		{"ef_construction too low", func(c *HNSWConfig) { c.EFConstruction = 5 }},
+		{"ef_construction too high", func(c *HNSWConfig) { c.EFConstruction = 5000 }},
+		{"ef_search too low", func(c *HNSWConfig) { c.EFSearch = 0 }},
+		{"max_neighbors too low", func(c *HNSWConfig) { c.MaxNeighbors = 1 }},
+		{"max_neighbors too high", func(c *HNSWConfig) { c.MaxNeighbors = 512 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.change(&config)
+			assert.ErrorIs(t, ValidateHNSWConfig(config), ErrInvalidInput)
+		})
+	}
+}
+
+func TestDefaultHNSWConfig_FromEnv(t *testing.T) {
+	t.Setenv("CHROMA_HNSW_SPACE", "l2")
+	t.Setenv("CHROMA_HNSW_EF_SEARCH", "250")
+
+	config, err := defaultHNSWConfig()
+	require.NoError(t, err)
+	assert.Equal(t, HNSWConfig{Space: "l2", EFConstruction: 200, EFSearch: 250, MaxNeighbors: 32}, config)
+}
+
+func TestCheckChromaEnv_RejectsInvalidHNSWSettings(t *testing.T) {
+	require.NoError(t, CheckChromaEnv())
+
+	for key, value := range map[string]string{
+		"CHROMA_HNSW_SPACE":           "manhattan",
+		"CHROMA_HNSW_EF_CONSTRUCTION": "-1",
+		"CHROMA_HNSW_EF_SEARCH":       "fast",
+		"CHROMA_HNSW_MAX_NEIGHBORS":   "0",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			err := CheckChromaEnv()
+			assert.ErrorIs(t, err, ErrInvalidInput)
+			assert.Contains(t, err.Error(), "CHROMA_HNSW_")
+		})
+	}
+}
+
+func TestUpdateHNSWConfig_RecreatesCollection(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	collections := "/api/v2/tenants/default_tenant/databases/default_database/collections"
+	server := newChromaMockServer(t, map[string]string{
+		"POST /api/v2/tenants":                                   `{}`,
+		"POST /api/v2/tenants/default_tenant/databases":          `{}`,
+		"DELETE " + collections + "/" + NoteEmbeddingsCollection: `{}`,
+		"POST " + collections:                                    `{"id":"c2","name":"note_embeddings"}`,
+	})
+	ai := &AIService{db: db.DB, chromaService: NewChromaService(server.URL, nil)}
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery(`INSERT INTO "ai_settings" .* ON CONFLICT \("key"\) DO UPDATE SET "value"="excluded"."value","updated_at"="excluded"."updated_at"`).
+		WithArgs(aiSettingHNSW, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(time.Now()))
+	dbMock.ExpectCommit()
+
+	applied, err := ai.UpdateHNSWConfig(context.Background(), HNSWConfig{
+		Space: "ip", EFConstruction: 400, EFSearch: 150, MaxNeighbors: 48, NumThreads: 64,
+	})
+	require.NoError(t, err)
+	assert.Zero(t, applied.NumThreads, "only the validated parameters are applied")
+
+	_, deleted := server.last("DELETE", collections+"/"+NoteEmbeddingsCollection)
+	assert.True(t, deleted)
+	create, ok := server.last("POST", collections)
+	require.True(t, ok)
+	hnsw := create.Body["configuration"].(map[string]interface{})["hnsw"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"space":           "ip",
+		"ef_construction": float64(400),
+		"ef_search":       float64(150),
+		"max_neighbors":   float64(48),
+	}, hnsw)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestUpdateHNSWConfig_RejectsInvalid(t *testing.T) {
+	server := newChromaMockServer(t, map[string]string{})
+	ai := &AIService{chromaService: NewChromaService(server.URL, nil)}
+
+	_, err := ai.UpdateHNSWConfig(context.Background(), HNSWConfig{Space: "cosine", EFConstruction: 200, EFSearch: 100, MaxNeighbors: 0})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Empty(t, server.requests, "an invalid config must not touch the collection")
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"unicode/utf8"
+)
+
+// ChromaStatusError is a document request ChromaDB answered with an error
+// status
+type ChromaStatusError struct {
+	Operation  string
+	StatusCode int
+	Body       string
+}
+
+func (e *ChromaStatusError) Error() string {
+	return fmt.Sprintf("failed to %s, status %d: %s", e.Operation, e.StatusCode, e.Body)
+}
+
+// rejectsDocuments reports whether ChromaDB turned the documents down, as
+// opposed to being unavailable, in which case a smaller batch fails too
+func (e *ChromaStatusError) rejectsDocuments() bool {
+	switch e.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return false
+	}
+	return e.StatusCode >= http.StatusBadRequest
+}
+
+// ChromaRejectedDocument is a document ChromaDB refused to index
+type ChromaRejectedDocument struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// chromaMaxDocumentBytes reads CHROMA_MAX_DOCUMENT_BYTES, the largest
+// document sent to ChromaDB in bytes. By default it is what MaxDocumentLength
+// characters can take in UTF-8, so only the length limit applies.
+func chromaMaxDocumentBytes() int {
+	if value, err := strconv.Atoi(os.Getenv("CHROMA_MAX_DOCUMENT_BYTES")); err == nil && value > 0 {
+		return value
+	}
+	return MaxDocumentLength * utf8.UTFMax
+}
+
+// fitChromaDocument truncates document to MaxDocumentLength characters and
+// CHROMA_MAX_DOCUMENT_BYTES bytes, whichever is shorter, without cutting a
+// character in two
+func fitChromaDocument(document string) string {
+	maxBytes := chromaMaxDocumentBytes()
+	if len(document) <= maxBytes && utf8.RuneCountInString(document) <= MaxDocumentLength {
+		return document
+	}
+
+	end, chars := 0, 0
+	for i, r := range document {
+		if chars == MaxDocumentLength || i+utf8.RuneLen(r) > maxBytes {
+			break
+		}
+		end = i + utf8.RuneLen(r)
+		chars++
+	}
+	return document[:end]
+}
+
+// UpsertDocumentsIsolated upserts documents like UpsertDocuments. When
+// ChromaDB rejects the batch it is retried in halves, so the documents it
+// accepts are still indexed, down to the single documents it rejects, which
+// are returned. Failing to reach ChromaDB fails the whole batch.
+func (cs *ChromaService) UpsertDocumentsIsolated(ctx context.Context, collectionName string, ids []string, documents []string, metadatas []map[string]interface{}) ([]ChromaRejectedDocument, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	err := cs.UpsertDocuments(ctx, collectionName, ids, documents, metadatas)
+	if err == nil {
+		return nil, nil
+	}
+	var statusErr *ChromaStatusError
+	if !errors.As(err, &statusErr) || !statusErr.rejectsDocuments() || ctx.Err() != nil {
+		return nil, err
+	}
+	if len(ids) == 1 {
+		log.Printf("ChromaDB rejected document %s: %v", ids[0], err)
+		return []ChromaRejectedDocument{{ID: ids[0], Error: err.Error()}}, nil
+	}
+
+	half := len(ids) / 2
+	rejected, err := cs.UpsertDocumentsIsolated(ctx, collectionName, ids[:half], documents[:half], metadatas[:half])
+	if err != nil {
+		return rejected, err
+	}
+	more, err := cs.UpsertDocumentsIsolated(ctx, collectionName, ids[half:], documents[half:], metadatas[half:])
+	return append(rejected, more...), err
+}
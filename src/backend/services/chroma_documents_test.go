@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSizeLimitedChromaServer is a ChromaDB that rejects any add request with
+// a document over maxBytes, and returns the IDs it added
+func newSizeLimitedChromaServer(t *testing.T, maxBytes int, status int) (*httptest.Server, func() []string) {
+	collections := "/api/v2/tenants/default_tenant/databases/default_database/collections"
+	var mu sync.Mutex
+	var added []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case collections:
+			io.WriteString(w, `{"id":"c1","name":"`+NoteEmbeddingsCollection+`"}`)
+		case collections + "/" + NoteEmbeddingsCollection + "/get":
+			io.WriteString(w, `{"ids":[]}`)
+		case collections + "/" + NoteEmbeddingsCollection + "/add":
+			var body struct {
+				IDs       []string `json:"ids"`
+				Documents []string `json:"documents"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			for _, document := range body.Documents {
+				if len(document) > maxBytes {
+					w.WriteHeader(status)
+					io.WriteString(w, `{"error":"document too large"}`)
+					return
+				}
+			}
+			mu.Lock()
+			added = append(added, body.IDs...)
+			mu.Unlock()
+			io.WriteString(w, `{}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), added...)
+	}
+}
+
+func TestIndexNotes_OversizedDocumentDoesNotFailBatch(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	server, added := newSizeLimitedChromaServer(t, 1000, http.StatusUnprocessableEntity)
+	ai := &AIService{db: db.DB, chromaService: NewChromaService(server.URL, nil)}
+
+	notes := make([]models.Note, 5)
+	for i := range notes {
+		notes[i] = models.Note{ID: uuid.New(), Title: "Note"}
+	}
+	oversized := notes[3].ID
+	for _, note := range notes {
+		text := "Short note"
+		if note.ID == oversized {
+			text = strings.Repeat("long ", 500)
+		}
+		mock.ExpectQuery(`SELECT \* FROM "ai_enhanced_notes" WHERE note_id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"note_id"}))
+		mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE note_id = \$1`).
+			WithArgs(note.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "type", "content", "order"}).
+				AddRow(uuid.New(), note.ID, "text", []byte(`{"text":"`+text+`"}`), 1))
+	}
+
+	notIndexed, err := ai.indexNotes(context.Background(), notes)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{oversized}, notIndexed)
+
+	var want []string
+	for _, note := range notes {
+		if note.ID != oversized {
+			want = append(want, NoteIDToChromaID(note.ID))
+		}
+	}
+	assert.ElementsMatch(t, want, added(), "the rest of the batch is indexed")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpsertDocumentsIsolated_UnavailableFailsBatch(t *testing.T) {
+	server, added := newSizeLimitedChromaServer(t, 10, http.StatusServiceUnavailable)
+	cs := NewChromaService(server.URL, nil)
+
+	ids := []string{"a", "b", "c"}
+	documents := []string{"short", strings.Repeat("x", 20), "short"}
+	metadatas := []map[string]interface{}{{}, {}, {}}
+
+	rejected, err := cs.UpsertDocumentsIsolated(context.Background(), NoteEmbeddingsCollection, ids, documents, metadatas)
+	assert.Error(t, err, "an unavailable ChromaDB isn't retried document by document")
+	assert.Empty(t, rejected)
+	assert.Empty(t, added())
+}
+
+func TestFitChromaDocument(t *testing.T) {
+	assert.Equal(t, "short", fitChromaDocument("short"))
+
+	long := strings.Repeat("a", MaxDocumentLength+10)
+	assert.Len(t, fitChromaDocument(long), MaxDocumentLength)
+
+	t.Setenv("CHROMA_MAX_DOCUMENT_BYTES", "10")
+	fitted := fitChromaDocument("abcdéfghijk")
+	assert.Equal(t, "abcdéfghi", fitted)
+	assert.LessOrEqual(t, len(fitted), 10)
+
+	// é takes two bytes and isn't cut in half
+	fitted = fitChromaDocument("abcdefghiéj")
+	assert.Equal(t, "abcdefghi", fitted)
+	assert.True(t, utf8.ValidString(fitted))
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// defaultChromaSyncDebounce is how long a note has to go without changes
+// before it is re-embedded
+const defaultChromaSyncDebounce = 10 * time.Second
+
+// chromaSyncDebounce reads CHROMA_SYNC_DEBOUNCE_SECONDS
+func chromaSyncDebounce() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("CHROMA_SYNC_DEBOUNCE_SECONDS")); err == nil && value > 0 {
+		return time.Duration(value) * time.Second
+	}
+	return defaultChromaSyncDebounce
+}
+
+// ChromaNoteSyncer keeps ChromaDB up to date as notes are edited. Every
+// change restarts the note's timer, so a note saved on each keystroke is
+// re-embedded once, after it has been quiet for the debounce interval.
+// Deleted notes are removed right away.
+type ChromaNoteSyncer struct {
+	debounce time.Duration
+	upsert   func(ctx context.Context, noteID uuid.UUID) error
+	remove   func(ctx context.Context, noteID uuid.UUID) error
+
+	mu      sync.Mutex
+	timers  map[uuid.UUID]*time.Timer
+	stopped bool
+}
+
+// ChromaNoteSyncerInstance is set in main.go once the AI service exists
+var ChromaNoteSyncerInstance *ChromaNoteSyncer
+
+// NewChromaNoteSyncer creates a syncer re-embedding notes with ai
+func NewChromaNoteSyncer(ai *AIService) *ChromaNoteSyncer {
+	return newChromaNoteSyncer(chromaSyncDebounce(),
+		func(ctx context.Context, noteID uuid.UUID) error {
+			return ai.RefreshNotesInChroma(ctx, []uuid.UUID{noteID})
+		},
+		ai.removeNoteFromChroma)
+}
+
+func newChromaNoteSyncer(debounce time.Duration, upsert, remove func(ctx context.Context, noteID uuid.UUID) error) *ChromaNoteSyncer {
+	return &ChromaNoteSyncer{
+		debounce: debounce,
+		upsert:   upsert,
+		remove:   remove,
+		timers:   make(map[uuid.UUID]*time.Timer),
+	}
+}
+
+// NoteChanged schedules the re-embedding of the note an event changed, or
+// removes a deleted note. Reports whether the event concerned a note.
+func (s *ChromaNoteSyncer) NoteChanged(event models.Event, data map[string]interface{}) bool {
+	noteIDStr, _ := data["note_id"].(string)
+	noteID, err := uuid.Parse(noteIDStr)
+	if err != nil {
+		return false
+	}
+
+	switch broker.EventType(event.Event) {
+	case broker.NoteCreated, broker.NoteUpdated, broker.NoteRestored, broker.BlockCreated, broker.BlockUpdated, broker.BlockDeleted:
+		s.schedule(noteID)
+		return true
+	case broker.NoteDeleted:
+		s.Cancel(noteID)
+		if err := s.remove(context.Background(), noteID); err != nil {
+			log.Printf("Failed to remove deleted note %s from ChromaDB: %v", noteID, err)
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// schedule (re)starts the note's timer
+func (s *ChromaNoteSyncer) schedule(noteID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	if timer, ok := s.timers[noteID]; ok {
+		timer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(s.debounce, func() {
+		s.mu.Lock()
+		if s.timers[noteID] != timer {
+			// Rescheduled or cancelled since
+			s.mu.Unlock()
+			return
+		}
+		delete(s.timers, noteID)
+		s.mu.Unlock()
+
+		s.sync(noteID)
+	})
+	s.timers[noteID] = timer
+}
+
+func (s *ChromaNoteSyncer) sync(noteID uuid.UUID) {
+	if err := s.upsert(context.Background(), noteID); err != nil {
+		log.Printf("Failed to re-embed note %s in ChromaDB: %v", noteID, err)
+	}
+}
+
+// Cancel drops the note's pending re-embedding, for when the note was just
+// upserted or removed directly
+func (s *ChromaNoteSyncer) Cancel(noteID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if timer, ok := s.timers[noteID]; ok {
+		timer.Stop()
+		delete(s.timers, noteID)
+	}
+}
+
+// Stop re-embeds the notes still waiting and stops scheduling new ones
+func (s *ChromaNoteSyncer) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	pending := make([]uuid.UUID, 0, len(s.timers))
+	for noteID, timer := range s.timers {
+		if timer.Stop() {
+			pending = append(pending, noteID)
+		}
+		delete(s.timers, noteID)
+	}
+	s.mu.Unlock()
+
+	for _, noteID := range pending {
+		s.sync(noteID)
+	}
+}
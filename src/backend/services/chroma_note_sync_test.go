@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingChromaSync counts the upserts and removals of each note
+type countingChromaSync struct {
+	mu       sync.Mutex
+	upserts  map[uuid.UUID]int
+	removals map[uuid.UUID]int
+}
+
+func newTestChromaNoteSyncer(debounce time.Duration) (*ChromaNoteSyncer, *countingChromaSync) {
+	counts := &countingChromaSync{upserts: map[uuid.UUID]int{}, removals: map[uuid.UUID]int{}}
+	syncer := newChromaNoteSyncer(debounce,
+		func(ctx context.Context, noteID uuid.UUID) error {
+			counts.mu.Lock()
+			defer counts.mu.Unlock()
+			counts.upserts[noteID]++
+			return nil
+		},
+		func(ctx context.Context, noteID uuid.UUID) error {
+			counts.mu.Lock()
+			defer counts.mu.Unlock()
+			counts.removals[noteID]++
+			return nil
+		})
+	return syncer, counts
+}
+
+func (c *countingChromaSync) count(counts map[uuid.UUID]int, noteID uuid.UUID) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return counts[noteID]
+}
+
+func TestChromaNoteSyncer_RapidUpdatesUpsertOnce(t *testing.T) {
+	syncer, counts := newTestChromaNoteSyncer(50 * time.Millisecond)
+	noteID, otherID := uuid.New(), uuid.New()
+
+	for i := 0; i < 10; i++ {
+		event, data := blockUpdatedEvent(t, noteID)
+		assert.True(t, syncer.NoteChanged(event, data))
+		time.Sleep(5 * time.Millisecond)
+	}
+	event, data := blockUpdatedEvent(t, otherID)
+	syncer.NoteChanged(event, data)
+
+	// Still within the window of the last edit
+	assert.Zero(t, counts.count(counts.upserts, noteID))
+
+	assert.Eventually(t, func() bool { return counts.count(counts.upserts, noteID) == 1 }, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, counts.count(counts.upserts, noteID))
+	assert.Equal(t, 1, counts.count(counts.upserts, otherID))
+}
+
+func TestChromaNoteSyncer_DeleteAndDirectUpsertBypassDebounce(t *testing.T) {
+	syncer, counts := newTestChromaNoteSyncer(50 * time.Millisecond)
+	deletedID, processedID := uuid.New(), uuid.New()
+
+	for _, noteID := range []uuid.UUID{deletedID, processedID} {
+		event, data := blockUpdatedEvent(t, noteID)
+		syncer.NoteChanged(event, data)
+	}
+
+	// Deleting removes the note at once and drops its pending upsert
+	deleted := models.Event{Event: string(broker.NoteDeleted), Entity: "note", Timestamp: time.Now()}
+	assert.True(t, syncer.NoteChanged(deleted, map[string]interface{}{"note_id": deletedID.String()}))
+	assert.Equal(t, 1, counts.count(counts.removals, deletedID))
+
+	// Processing upserts the note itself
+	syncer.Cancel(processedID)
+
+	time.Sleep(150 * time.Millisecond)
+	assert.Zero(t, counts.count(counts.upserts, deletedID))
+	assert.Zero(t, counts.count(counts.upserts, processedID))
+}
+
+func TestChromaNoteSyncer_StopFlushesPendingNotes(t *testing.T) {
+	syncer, counts := newTestChromaNoteSyncer(time.Hour)
+	noteID := uuid.New()
+
+	event, data := blockUpdatedEvent(t, noteID)
+	syncer.NoteChanged(event, data)
+	syncer.Stop()
+	assert.Equal(t, 1, counts.count(counts.upserts, noteID))
+
+	// Nothing is scheduled once stopped
+	syncer.NoteChanged(event, data)
+	assert.Empty(t, syncer.timers)
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// chromaPruneListBatch is how many document IDs are listed per request
+	chromaPruneListBatch = 1000
+	// chromaPruneDeleteBatch is how many orphans are deleted per request
+	chromaPruneDeleteBatch = 100
+)
+
+// ChromaPruneResult reports what a prune of the note collection did
+type ChromaPruneResult struct {
+	Checked int `json:"checked"` // Documents in the collection
+	Pruned  int `json:"pruned"`  // Documents deleted because their note is gone
+}
+
+// PruneOrphanedChromaDocuments deletes the documents of the note collection
+// whose note was deleted or moved to the trash, and those whose ID isn't a
+// note ID at all. Every ID is listed before anything is deleted, so the
+// deletes don't shift the pages being read.
+func (ai *AIService) PruneOrphanedChromaDocuments(ctx context.Context) (*ChromaPruneResult, error) {
+	result := &ChromaPruneResult{}
+	var orphans []string
+
+	for offset := 0; ; offset += chromaPruneListBatch {
+		ids, err := ai.chromaService.ListDocumentIDs(ctx, ai.noteCollection(), chromaPruneListBatch, offset)
+		if err != nil {
+			return nil, err
+		}
+		result.Checked += len(ids)
+
+		pageOrphans, err := ai.orphanedChromaIDs(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, pageOrphans...)
+
+		if len(ids) < chromaPruneListBatch {
+			break
+		}
+	}
+
+	for i := 0; i < len(orphans); i += chromaPruneDeleteBatch {
+		end := min(i+chromaPruneDeleteBatch, len(orphans))
+		if err := ai.chromaService.DeleteDocuments(ctx, ai.noteCollection(), orphans[i:end]); err != nil {
+			return result, fmt.Errorf("failed to delete orphaned documents: %w", err)
+		}
+		result.Pruned = end
+	}
+
+	if result.Pruned > 0 {
+		log.Printf("Pruned %d orphaned ChromaDB documents of %d", result.Pruned, result.Checked)
+	}
+	return result, nil
+}
+
+// orphanedChromaIDs returns the IDs in chromaIDs that have no live note
+func (ai *AIService) orphanedChromaIDs(ctx context.Context, chromaIDs []string) ([]string, error) {
+	var orphans []string
+	noteIDs := make([]uuid.UUID, 0, len(chromaIDs))
+	byNoteID := make(map[uuid.UUID]string, len(chromaIDs))
+	for _, chromaID := range chromaIDs {
+		noteID, err := ChromaIDToNoteID(chromaID)
+		if err != nil {
+			orphans = append(orphans, chromaID)
+			continue
+		}
+		noteIDs = append(noteIDs, noteID)
+		byNoteID[noteID] = chromaID
+	}
+	if len(noteIDs) == 0 {
+		return orphans, nil
+	}
+
+	var live []uuid.UUID
+	if err := ai.db.WithContext(ctx).Model(&models.Note{}).Scopes(models.NotTrashed).
+		Where("id IN ?", noteIDs).Pluck("id", &live).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up notes: %w", err)
+	}
+	for _, noteID := range live {
+		delete(byNoteID, noteID)
+	}
+
+	for _, noteID := range noteIDs {
+		if chromaID, ok := byNoteID[noteID]; ok {
+			orphans = append(orphans, chromaID)
+		}
+	}
+	return orphans, nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneOrphanedChromaDocuments_DeletesOrphans(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	live, deleted, trashed := uuid.New(), uuid.New(), uuid.New()
+	collection := "/api/v2/tenants/default_tenant/databases/default_database/collections/" + NoteEmbeddingsCollection
+	server := newChromaMockServer(t, map[string]string{
+		"POST " + collection + "/get": `{"ids": ["` + NoteIDToChromaID(live) + `", "` + NoteIDToChromaID(deleted) + `", "scratch", "` +
+			NoteIDToChromaID(trashed) + `"]}`,
+		"POST " + collection + "/delete": `{}`,
+	})
+	ai := &AIService{db: db.DB, chromaService: NewChromaService(server.URL, nil)}
+
+	// Only the live note comes back; deleted and trashed notes are filtered out
+	dbMock.ExpectQuery(`SELECT "id" FROM "notes" WHERE id IN \(\$1,\$2,\$3\)`).
+		WithArgs(live, deleted, trashed).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(live))
+
+	result, err := ai.PruneOrphanedChromaDocuments(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &ChromaPruneResult{Checked: 4, Pruned: 3}, result)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+
+	list, ok := server.last("POST", collection+"/get")
+	require.True(t, ok)
+	assert.Equal(t, []interface{}{}, list.Body["include"], "only IDs are listed")
+
+	del, ok := server.last("POST", collection+"/delete")
+	require.True(t, ok)
+	assert.ElementsMatch(t, []interface{}{"scratch", NoteIDToChromaID(deleted), NoteIDToChromaID(trashed)}, del.Body["ids"])
+}
+
+func TestPruneOrphanedChromaDocuments_NothingToPrune(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID := uuid.New()
+	collection := "/api/v2/tenants/default_tenant/databases/default_database/collections/" + NoteEmbeddingsCollection
+	server := newChromaMockServer(t, map[string]string{
+		"POST " + collection + "/get": `{"ids": ["` + NoteIDToChromaID(noteID) + `"]}`,
+	})
+	ai := &AIService{db: db.DB, chromaService: NewChromaService(server.URL, nil)}
+
+	dbMock.ExpectQuery(`SELECT "id" FROM "notes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(noteID))
+
+	result, err := ai.PruneOrphanedChromaDocuments(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Pruned)
+	_, deleted := server.last("POST", collection+"/delete")
+	assert.False(t, deleted)
+}
@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,6 +21,11 @@ type ChromaService struct {
 	baseURL    string
 	httpClient *http.Client
 	db         *gorm.DB
+	apiVersion ChromaAPIVersion
+	urls       chromaURLBuilder
+
+	collectionIDsMu sync.Mutex
+	collectionIDs   map[string]string // v1 collection IDs by name
 }
 
 // ChromaCollection represents a collection in ChromaDB
@@ -92,55 +98,29 @@ func NewChromaService(baseURL string, db *gorm.DB) *ChromaService {
 	}
 	
 	return &ChromaService{
-		baseURL:    baseURL,
-		httpClient: &http.Client{Timeout: 10 * time.Second}, // Reduced to minimize context goroutines
-		db:         db,
+		baseURL:       baseURL,
+		httpClient:    &http.Client{Timeout: 10 * time.Second}, // Reduced to minimize context goroutines
+		db:            db,
+		apiVersion:    ChromaAPIv2, // Until DetectAPIVersion says otherwise
+		urls:          newChromaURLBuilder(baseURL, ChromaAPIv2),
+		collectionIDs: make(map[string]string),
 	}
 }
 
 // CreateCollection creates a new collection with specified configuration
 func (cs *ChromaService) CreateCollection(ctx context.Context, name string, config *ChromaConfiguration) error {
-	// Collection configuration for optimal note search  
-	payload := map[string]interface{}{
-		"name": name,
-		"get_or_create": true, // Use get_or_create to avoid conflicts
-		"metadata": map[string]interface{}{
-			"description": "Owlistic AI note embeddings collection",
-			"created":     time.Now().Format(time.RFC3339),
-		},
-	}
-	
-	// Add configuration if provided
-	if config != nil {
-		configMap := map[string]interface{}{}
-		if config.HNSW != nil {
-			hnswMap := map[string]interface{}{
-				"space": config.HNSW.Space,
-			}
-			if config.HNSW.EFConstruction > 0 {
-				hnswMap["ef_construction"] = config.HNSW.EFConstruction
-			}
-			if config.HNSW.EFSearch > 0 {
-				hnswMap["ef_search"] = config.HNSW.EFSearch
-			}
-			if config.HNSW.MaxNeighbors > 0 {
-				hnswMap["max_neighbors"] = config.HNSW.MaxNeighbors
-			}
-			configMap["hnsw"] = hnswMap
-		}
-		
-		if len(configMap) > 0 {
-			payload["configuration"] = configMap
-		}
-	}
+	// Collection configuration for optimal note search
+	payload := cs.createCollectionPayload(name, config, map[string]interface{}{
+		"description": "Owlistic AI note embeddings collection",
+		"created":     time.Now().Format(time.RFC3339),
+	})
 	
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal create collection request: %w", err)
 	}
 	
-	// Use ChromaDB v2 API with default tenant and database
-	url := cs.getCollectionsURL()
+	url := cs.urls.collectionsURL()
 	log.Printf("Creating ChromaDB collection at URL: %s", url)
 	
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
@@ -162,11 +142,17 @@ func (cs *ChromaService) CreateCollection(ctx context.Context, name string, conf
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		// Log the error but don't fail completely - AI features can work without vector search
 		log.Printf("ChromaDB collection creation failed (status %d): %s", resp.StatusCode, string(body))
-		log.Printf("This likely means ChromaDB is using a different API version or is not properly configured")
+		log.Printf("Requests were built for ChromaDB API %s; check that CHROMA_BASE_URL points at a supported server", cs.apiVersion)
 		log.Printf("Vector search will be disabled, but all other AI features will continue to work")
 		return fmt.Errorf("failed to create collection, status %d: %s", resp.StatusCode, string(body))
 	}
 	
+	if cs.urls.addressesByID() {
+		if id, err := chromaCollectionID(body); err == nil {
+			cs.rememberCollectionID(name, id)
+		}
+	}
+	
 	log.Printf("Successfully created ChromaDB collection: %s", name)
 	return nil
 }
@@ -174,17 +160,16 @@ func (cs *ChromaService) CreateCollection(ctx context.Context, name string, conf
 // GetOrCreateCollection gets an existing collection or creates it if it doesn't exist
 func (cs *ChromaService) GetOrCreateCollection(ctx context.Context, name string, config *ChromaConfiguration) error {
 	// For v2 API, we need to ensure tenant and database exist first
-	tenant := "default_tenant" 
-	database := "default_database"
-	
-	// Create tenant if needed
-	if err := cs.ensureTenant(ctx, tenant); err != nil {
-		log.Printf("Warning: Could not ensure tenant exists: %v", err)
-	}
-	
-	// Create database if needed
-	if err := cs.ensureDatabase(ctx, tenant, database); err != nil {
-		log.Printf("Warning: Could not ensure database exists: %v", err)
+	if cs.apiVersion == ChromaAPIv2 {
+		// Create tenant if needed
+		if err := cs.ensureTenant(ctx, chromaDefaultTenant); err != nil {
+			log.Printf("Warning: Could not ensure tenant exists: %v", err)
+		}
+		
+		// Create database if needed
+		if err := cs.ensureDatabase(ctx, chromaDefaultTenant, chromaDefaultDatabase); err != nil {
+			log.Printf("Warning: Could not ensure database exists: %v", err)
+		}
 	}
 	
 	// Create the collection
@@ -193,7 +178,8 @@ func (cs *ChromaService) GetOrCreateCollection(ctx context.Context, name string,
 
 // DeleteCollection deletes a collection and all its data
 func (cs *ChromaService) DeleteCollection(ctx context.Context, name string) error {
-	url := cs.getCollectionURL(name)
+	cs.forgetCollectionID(name)
+	url := cs.urls.collectionURL(name)
 	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
@@ -226,7 +212,11 @@ func (cs *ChromaService) AddDocuments(ctx context.Context, collectionName string
 		return fmt.Errorf("failed to marshal add request: %w", err)
 	}
 	
-	url := cs.getCollectionURL(collectionName) + "/add"
+	collectionURL, err := cs.documentsURL(ctx, collectionName)
+	if err != nil {
+		return fmt.Errorf("failed to resolve collection: %w", err)
+	}
+	url := collectionURL + "/add"
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
@@ -241,7 +231,7 @@ func (cs *ChromaService) AddDocuments(ctx context.Context, collectionName string
 	
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to add documents, status %d: %s", resp.StatusCode, string(body))
+		return &ChromaStatusError{Operation: "add documents", StatusCode: resp.StatusCode, Body: string(body)}
 	}
 	
 	return nil
@@ -260,7 +250,11 @@ func (cs *ChromaService) UpdateDocuments(ctx context.Context, collectionName str
 		return fmt.Errorf("failed to marshal update request: %w", err)
 	}
 	
-	url := cs.getCollectionURL(collectionName) + "/update"
+	collectionURL, err := cs.documentsURL(ctx, collectionName)
+	if err != nil {
+		return fmt.Errorf("failed to resolve collection: %w", err)
+	}
+	url := collectionURL + "/update"
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
@@ -275,7 +269,7 @@ func (cs *ChromaService) UpdateDocuments(ctx context.Context, collectionName str
 	
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to update documents, status %d: %s", resp.StatusCode, string(body))
+		return &ChromaStatusError{Operation: "update documents", StatusCode: resp.StatusCode, Body: string(body)}
 	}
 	
 	return nil
@@ -349,7 +343,11 @@ func (cs *ChromaService) DeleteDocuments(ctx context.Context, collectionName str
 		return fmt.Errorf("failed to marshal delete request: %w", err)
 	}
 	
-	url := cs.getCollectionURL(collectionName) + "/delete"
+	collectionURL, err := cs.documentsURL(ctx, collectionName)
+	if err != nil {
+		return fmt.Errorf("failed to resolve collection: %w", err)
+	}
+	url := collectionURL + "/delete"
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
@@ -384,7 +382,11 @@ func (cs *ChromaService) QueryByText(ctx context.Context, collectionName string,
 		return nil, fmt.Errorf("failed to marshal query request: %w", err)
 	}
 	
-	url := cs.getCollectionURL(collectionName) + "/query"
+	collectionURL, err := cs.documentsURL(ctx, collectionName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve collection: %w", err)
+	}
+	url := collectionURL + "/query"
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -424,7 +426,11 @@ func (cs *ChromaService) QueryByEmbedding(ctx context.Context, collectionName st
 		return nil, fmt.Errorf("failed to marshal query request: %w", err)
 	}
 	
-	url := cs.getCollectionURL(collectionName) + "/query"
+	collectionURL, err := cs.documentsURL(ctx, collectionName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve collection: %w", err)
+	}
+	url := collectionURL + "/query"
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -462,7 +468,11 @@ func (cs *ChromaService) GetDocuments(ctx context.Context, collectionName string
 		return nil, fmt.Errorf("failed to marshal get request: %w", err)
 	}
 	
-	url := cs.getCollectionURL(collectionName) + "/get"
+	collectionURL, err := cs.documentsURL(ctx, collectionName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve collection: %w", err)
+	}
+	url := collectionURL + "/get"
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -488,9 +498,57 @@ func (cs *ChromaService) GetDocuments(ctx context.Context, collectionName string
 	return &result, nil
 }
 
+// ListDocumentIDs returns a page of the IDs in a collection, without their
+// documents or embeddings
+func (cs *ChromaService) ListDocumentIDs(ctx context.Context, collectionName string, limit, offset int) ([]string, error) {
+	payload := map[string]interface{}{
+		"limit":   limit,
+		"offset":  offset,
+		"include": []string{},
+	}
+	
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal get request: %w", err)
+	}
+	
+	collectionURL, err := cs.documentsURL(ctx, collectionName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve collection: %w", err)
+	}
+	url := collectionURL + "/get"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	
+	resp, err := cs.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer resp.Body.Close()
+	
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to list documents, status %d: %s", resp.StatusCode, string(body))
+	}
+	
+	var result ChromaGetResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode get response: %w", err)
+	}
+	
+	return result.IDs, nil
+}
+
 // CountDocuments returns the number of documents in a collection
 func (cs *ChromaService) CountDocuments(ctx context.Context, collectionName string) (int, error) {
-	url := cs.getCollectionURL(collectionName) + "/count"
+	collectionURL, err := cs.documentsURL(ctx, collectionName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve collection: %w", err)
+	}
+	url := collectionURL + "/count"
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create request: %w", err)
@@ -507,17 +565,11 @@ func (cs *ChromaService) CountDocuments(ctx context.Context, collectionName stri
 		return 0, fmt.Errorf("failed to count documents, status %d: %s", resp.StatusCode, string(body))
 	}
 	
-	var result map[string]int
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, fmt.Errorf("failed to decode count response: %w", err)
-	}
-	
-	count, ok := result["count"]
-	if !ok {
-		return 0, fmt.Errorf("count not found in response")
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read count response: %w", err)
 	}
-	
-	return count, nil
+	return decodeChromaCount(body)
 }
 
 // Helper function to convert note ID to ChromaDB document ID
@@ -558,20 +610,6 @@ func (cs *ChromaService) ensureTenant(ctx context.Context, tenantName string) er
 	return nil
 }
 
-// getCollectionURL returns the v2 API URL for a collection
-func (cs *ChromaService) getCollectionURL(collectionName string) string {
-	tenant := "default_tenant"
-	database := "default_database" 
-	return fmt.Sprintf("%s/api/v2/tenants/%s/databases/%s/collections/%s", cs.baseURL, tenant, database, collectionName)
-}
-
-// getCollectionsURL returns the v2 API URL for collections
-func (cs *ChromaService) getCollectionsURL() string {
-	tenant := "default_tenant"
-	database := "default_database"
-	return fmt.Sprintf("%s/api/v2/tenants/%s/databases/%s/collections", cs.baseURL, tenant, database)
-}
-
 // ensureDatabase creates a database if it doesn't exist
 func (cs *ChromaService) ensureDatabase(ctx context.Context, tenantName, databaseName string) error {
 	payload := map[string]interface{}{
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/prompts"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultContinueWords = 150
+	maxContinueWords     = 1000
+	// continueContextTokens is how much of the end of the draft the model sees
+	continueContextTokens = 6000
+)
+
+// ContinueWritingOptions tunes a "continue writing" request
+type ContinueWritingOptions struct {
+	Words       int    // Approximate length of the continuation, defaultContinueWords when 0
+	Tone        string // e.g. "formal" or "playful"; empty keeps the draft's tone
+	Instruction string // Free-form direction such as "wrap up with next steps"
+}
+
+// ContinueNote asks the model to extend a note in the style of its existing
+// text and appends the result as text blocks at the end of the note. The new
+// blocks are flagged with ai_generated metadata so they can be told apart or
+// removed later. Returns the created blocks.
+func (ai *AIService) ContinueNote(ctx context.Context, noteID, userID uuid.UUID, opts ContinueWritingOptions) ([]models.Block, error) {
+	if opts.Words == 0 {
+		opts.Words = defaultContinueWords
+	}
+	if opts.Words < 0 || opts.Words > maxContinueWords {
+		return nil, fmt.Errorf("%w: length must be between 1 and %d words", ErrInvalidInput, maxContinueWords)
+	}
+
+	var note models.Note
+	if err := ai.db.WithContext(ctx).Where("id = ? AND user_id = ?", noteID, userID).First(&note).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoteNotFound
+		}
+		return nil, err
+	}
+
+	content := ai.extractNoteContent(&note)
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("%w: the note has no text to continue", ErrInvalidInput)
+	}
+
+	prompt, err := prompts.Render(prompts.ContinueWriting, map[string]interface{}{
+		"Title":       note.Title,
+		"Content":     tailToTokens(content, continueContextTokens),
+		"Words":       opts.Words,
+		"Tone":        opts.Tone,
+		"Instruction": opts.Instruction,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = withAICallFeature(WithAICallUser(ctx, userID), "continue-writing", note.Title, content)
+	// Roughly two tokens per word leaves room for the requested length
+	response, err := ai.callAnthropic(ctx, prompt, opts.Words*2+200)
+	if err != nil {
+		return nil, err
+	}
+	paragraphs := continuationParagraphs(response)
+	if len(paragraphs) == 0 {
+		return nil, errors.New("the model returned no text")
+	}
+
+	var lastOrder float64
+	if err := ai.db.WithContext(ctx).Model(&models.Block{}).
+		Where("note_id = ?", noteID).
+		Select("COALESCE(MAX(\"order\"), 0)").
+		Row().Scan(&lastOrder); err != nil {
+		return nil, err
+	}
+
+	db := &database.Database{DB: ai.db}
+	params := map[string]interface{}{"user_id": userID.String()}
+	generatedAt := time.Now().UTC().Format(time.RFC3339)
+	blocks := make([]models.Block, 0, len(paragraphs))
+	for i, paragraph := range paragraphs {
+		block, err := BlockServiceInstance.CreateBlock(db, map[string]interface{}{
+			"note_id": noteID.String(),
+			"type":    string(models.TextBlock),
+			"order":   lastOrder + float64(i+1)*1000.0,
+			"content": map[string]interface{}{"text": paragraph},
+			"metadata": map[string]interface{}{
+				"spans":        []interface{}{},
+				"ai_generated": true,
+				"ai_action":    "continue",
+				"generated_at": generatedAt,
+			},
+		}, params)
+		if err != nil {
+			return blocks, fmt.Errorf("failed to append generated text: %w", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	// Keep semantic search in step with the longer note
+	if ai.chromaService != nil {
+		var enhanced *models.AIEnhancedNote
+		var stored models.AIEnhancedNote
+		if err := ai.db.WithContext(ctx).Where("note_id = ?", noteID).First(&stored).Error; err == nil {
+			enhanced = &stored
+		}
+		if err := ai.AddNoteToChroma(ctx, &note, enhanced); err != nil {
+			log.Printf("Failed to update note %s in ChromaDB after continuing it: %v", noteID, err)
+		}
+	}
+
+	return blocks, nil
+}
+
+// continuationParagraphs splits generated text into paragraphs, one per block
+func continuationParagraphs(response string) []string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(response, "\r\n", "\n"), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return paragraphs
+}
+
+// tailToTokens keeps the end of text within budget tokens, the part a
+// continuation has to follow on from
+func tailToTokens(text string, budget int) string {
+	runes := []rune(text)
+	if limit := budget * 4; len(runes) > limit {
+		return string(runes[len(runes)-limit:])
+	}
+	return text
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingBlockService keeps the blocks it is asked to create
+type recordingBlockService struct {
+	BlockServiceInterface
+	created []map[string]interface{}
+}
+
+func (r *recordingBlockService) CreateBlock(db *database.Database, blockData map[string]interface{}, params map[string]interface{}) (models.Block, error) {
+	r.created = append(r.created, blockData)
+	content, _ := blockData["content"].(map[string]interface{})
+	metadata, _ := blockData["metadata"].(map[string]interface{})
+	return models.Block{
+		ID:       uuid.New(),
+		Type:     models.BlockType(blockData["type"].(string)),
+		Order:    blockData["order"].(float64),
+		Content:  content,
+		Metadata: metadata,
+	}, nil
+}
+
+func TestContinueNote_AppendsFlaggedBlocks(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	blocks := &recordingBlockService{}
+	original := BlockServiceInstance
+	BlockServiceInstance = blocks
+	t.Cleanup(func() { BlockServiceInstance = original })
+
+	ai, prompt := newStubAIService(t, "The storm passed by midnight.\n\nBy morning the harbour was calm again.")
+	ai.db = db.DB
+
+	noteID, userID := uuid.New(), uuid.New()
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE \(id = \$1 AND user_id = \$2\)`).
+		WithArgs(noteID, userID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).AddRow(noteID, userID, "Harbour log"))
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE note_id = \$1`).
+		WithArgs(noteID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content"}).
+			AddRow(uuid.New(), []byte(`{"text":"The wind rose all evening."}`)))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\("order"\), 0\) FROM "blocks" WHERE note_id = \$1`).
+		WithArgs(noteID).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(3000.0))
+
+	created, err := ai.ContinueNote(context.Background(), noteID, userID, ContinueWritingOptions{
+		Words:       80,
+		Tone:        "wistful",
+		Instruction: "end with the boats going out",
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Contains(t, *prompt, "The wind rose all evening.")
+	assert.Contains(t, *prompt, "wistful")
+	assert.Contains(t, *prompt, "end with the boats going out")
+	assert.Contains(t, *prompt, "about 80 words")
+
+	require.Len(t, created, 2)
+	require.Len(t, blocks.created, 2)
+	assert.Equal(t, "The storm passed by midnight.", created[0].Content["text"])
+	assert.Equal(t, "By morning the harbour was calm again.", created[1].Content["text"])
+	for i, block := range created {
+		assert.Equal(t, models.TextBlock, block.Type)
+		assert.Equal(t, 3000.0+float64(i+1)*1000, block.Order, "blocks go after the existing ones")
+		assert.Equal(t, true, block.Metadata["ai_generated"])
+		assert.Equal(t, "continue", block.Metadata["ai_action"])
+		assert.Equal(t, noteID.String(), blocks.created[i]["note_id"])
+	}
+}
+
+func TestContinueNote_Validation(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	ai, _ := newStubAIService(t, "unused")
+	ai.db = db.DB
+
+	_, err := ai.ContinueNote(context.Background(), uuid.New(), uuid.New(), ContinueWritingOptions{Words: maxContinueWords + 1})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	// Notes of other users aren't found
+	mock.ExpectQuery(`SELECT \* FROM "notes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = ai.ContinueNote(context.Background(), uuid.New(), uuid.New(), ContinueWritingOptions{})
+	assert.ErrorIs(t, err, ErrNoteNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTailToTokens(t *testing.T) {
+	assert.Equal(t, "short", tailToTokens("short", 10))
+	assert.Equal(t, "efgh", tailToTokens("abcdefgh", 1))
+}
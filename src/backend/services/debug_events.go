@@ -0,0 +1,279 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"owlistic-notes/owlistic/config"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultDebugEventLimit = 100
+	maxDebugEventLimit     = 500
+	// debugStreamBuffer is how many live events a slow client may fall behind
+	// before events are dropped for it
+	debugStreamBuffer  = 64
+	eventPruneInterval = time.Hour
+)
+
+// DebugEventFilter narrows the events returned by ListEvents or streamed to
+// a subscriber
+type DebugEventFilter struct {
+	UserID   string // Only events of this user; empty means all users
+	Type     string // Event name such as note.created, or note.* for all events of an entity
+	EntityID string // Note, notebook, block or task the event is about
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+// DebugEventService gives structured access to the event pipeline: recent
+// events from the events table, a live feed of dispatched events, and
+// pruning of dispatched events past the configured retention
+type DebugEventService struct {
+	db       *database.Database
+	maxAge   time.Duration
+	maxCount int
+
+	mu          sync.RWMutex
+	subscribers map[chan models.Event]DebugEventFilter
+	stop        chan struct{}
+}
+
+// DebugEventServiceInstance is the shared event debugging service; nil until set up in main
+var DebugEventServiceInstance *DebugEventService
+
+func NewDebugEventService(db *database.Database) *DebugEventService {
+	return &DebugEventService{
+		db:          db,
+		subscribers: make(map[chan models.Event]DebugEventFilter),
+	}
+}
+
+// Start applies the retention settings and prunes old events every hour
+func (s *DebugEventService) Start(cfg config.Config) {
+	if s.stop != nil {
+		return
+	}
+	s.maxAge = time.Duration(cfg.EventRetainHours) * time.Hour
+	s.maxCount = cfg.EventRetainMax
+	stop := make(chan struct{})
+	s.stop = stop
+
+	go func() {
+		ticker := time.NewTicker(eventPruneInterval)
+		defer ticker.Stop()
+		for {
+			if removed, err := s.PruneEvents(); err != nil {
+				log.Printf("Failed to prune events: %v", err)
+			} else if removed > 0 {
+				log.Printf("Pruned %d dispatched events past retention", removed)
+			}
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *DebugEventService) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// PruneEvents deletes dispatched events older than the retention age and
+// beyond the newest retention count. Undispatched events are always kept.
+func (s *DebugEventService) PruneEvents() (int64, error) {
+	var removed int64
+	if s.maxAge > 0 {
+		result := s.db.DB.Where("dispatched = ? AND timestamp < ?", true, time.Now().Add(-s.maxAge)).
+			Delete(&models.Event{})
+		if result.Error != nil {
+			return removed, result.Error
+		}
+		removed += result.RowsAffected
+	}
+	if s.maxCount > 0 {
+		result := s.db.DB.Exec(`DELETE FROM events WHERE dispatched = ? AND id NOT IN (
+			SELECT id FROM events ORDER BY timestamp DESC LIMIT ?)`, true, s.maxCount)
+		if result.Error != nil {
+			return removed, result.Error
+		}
+		removed += result.RowsAffected
+	}
+	return removed, nil
+}
+
+// ListEvents returns the most recent events matching filter, newest first
+func (s *DebugEventService) ListEvents(filter DebugEventFilter) ([]models.Event, error) {
+	query := s.db.DB.Model(&models.Event{})
+	if filter.UserID != "" {
+		query = query.Where("data->>'user_id' = ?", filter.UserID)
+	}
+	if entity, ok := strings.CutSuffix(filter.Type, ".*"); ok {
+		query = query.Where("entity = ?", entity)
+	} else if filter.Type != "" {
+		query = query.Where("event = ?", filter.Type)
+	}
+	if filter.EntityID != "" {
+		query = query.Where("? IN (data->>'note_id', data->>'notebook_id', data->>'block_id', data->>'task_id')", filter.EntityID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("timestamp >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("timestamp <= ?", filter.Until)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultDebugEventLimit
+	} else if limit > maxDebugEventLimit {
+		limit = maxDebugEventLimit
+	}
+
+	var events []models.Event
+	err := query.Order("timestamp DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// Subscribe returns a channel of dispatched events matching filter and a
+// function that ends the subscription
+func (s *DebugEventService) Subscribe(filter DebugEventFilter) (<-chan models.Event, func()) {
+	events := make(chan models.Event, debugStreamBuffer)
+	s.mu.Lock()
+	s.subscribers[events] = filter
+	s.mu.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subscribers, events)
+			s.mu.Unlock()
+		})
+	}
+}
+
+// Publish hands a dispatched event to the subscribers it matches
+func (s *DebugEventService) Publish(event models.Event) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		data = map[string]interface{}{}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for events, filter := range s.subscribers {
+		if !debugEventMatches(filter, event, data) {
+			continue
+		}
+		select {
+		case events <- event:
+		default:
+			log.Printf("Debug stream subscriber is behind, dropping event %s", event.ID)
+		}
+	}
+}
+
+// HandleStream streams live events of the authenticated user over a
+// WebSocket, optionally filtered by the type and entity_id query parameters
+func (s *DebugEventService) HandleStream(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade debug stream connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	events, unsubscribe := s.Subscribe(DebugEventFilter{
+		UserID:   userID.(uuid.UUID).String(),
+		Type:     c.Query("type"),
+		EntityID: c.Query("entity_id"),
+	})
+	defer unsubscribe()
+
+	// The client only reads; a failed read means it went away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case event := <-events:
+			conn.SetWriteDeadline(time.Now().Add(15 * time.Second))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(15 * time.Second))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// debugEventMatches applies a filter to a live event, the same way
+// ListEvents applies it in SQL
+func debugEventMatches(filter DebugEventFilter, event models.Event, data map[string]interface{}) bool {
+	if filter.UserID != "" && data["user_id"] != filter.UserID {
+		return false
+	}
+	if entity, ok := strings.CutSuffix(filter.Type, ".*"); ok {
+		if event.Entity != entity {
+			return false
+		}
+	} else if filter.Type != "" && event.Event != filter.Type {
+		return false
+	}
+	if filter.EntityID != "" {
+		found := false
+		for _, key := range []string{"note_id", "notebook_id", "block_id", "task_id"} {
+			if data[key] == filter.EntityID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !filter.Since.IsZero() && event.Timestamp.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && event.Timestamp.After(filter.Until) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatedNoteAppearsInEventStream(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	debugEvents := NewDebugEventService(db)
+	userID, otherUserID, notebookID := uuid.New(), uuid.New(), uuid.New()
+	mine, unsubscribe := debugEvents.Subscribe(DebugEventFilter{UserID: userID.String(), Type: "note.*"})
+	defer unsubscribe()
+	theirs, unsubscribeOther := debugEvents.Subscribe(DebugEventFilter{UserID: otherUserID.String()})
+	defer unsubscribeOther()
+
+	eventData := expectCreateNote(dbMock)
+	_, err := (&NoteService{}).CreateNote(db, map[string]interface{}{
+		"title":       "Trace me",
+		"user_id":     userID.String(),
+		"notebook_id": notebookID.String(),
+	})
+	require.NoError(t, err)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`UPDATE "events" SET`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`DELETE FROM "ai_artifacts"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectCommit()
+
+	producer := NewMockProducer()
+	producer.On("PublishMessage", mock.Anything, mock.Anything).Return(nil)
+	handler := &EventHandlerService{db: db, producer: producer, debug: debugEvents}
+	event := models.Event{ID: uuid.New(), Event: "note.created", Entity: "note", Timestamp: time.Now().UTC(), Data: eventData.value}
+	require.NoError(t, handler.dispatchEvent(event))
+
+	select {
+	case got := <-mine:
+		assert.Equal(t, event.ID, got.ID)
+		var data map[string]interface{}
+		require.NoError(t, json.Unmarshal(got.Data, &data))
+		assert.Equal(t, "Trace me", data["title"])
+		assert.Equal(t, notebookID.String(), data["notebook_id"])
+	default:
+		t.Fatal("the created note was not streamed to its owner")
+	}
+	assert.Empty(t, theirs, "other users must not see the event")
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestListEvents_AppliesFilters(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID, noteID := uuid.New().String(), uuid.New().String()
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	dbMock.ExpectQuery(`SELECT \* FROM "events" WHERE data->>'user_id' = \$1 AND entity = \$2 AND \$3 IN \(data->>'note_id', data->>'notebook_id', data->>'block_id', data->>'task_id'\) AND timestamp >= \$4 ORDER BY timestamp DESC LIMIT \$5`).
+		WithArgs(userID, "block", noteID, since, maxDebugEventLimit).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "event"}).AddRow(uuid.New(), "block.updated"))
+
+	events, err := NewDebugEventService(db).ListEvents(DebugEventFilter{
+		UserID:   userID,
+		Type:     "block.*",
+		EntityID: noteID,
+		Since:    since,
+		Limit:    10000,
+	})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestPruneEvents_KeepsUndispatchedEvents(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	debugEvents := NewDebugEventService(db)
+	debugEvents.maxAge = 24 * time.Hour
+	debugEvents.maxCount = 500
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`DELETE FROM "events" WHERE dispatched = \$1 AND timestamp < \$2`).
+		WithArgs(true, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	dbMock.ExpectCommit()
+	dbMock.ExpectExec(`DELETE FROM events WHERE dispatched = \$1 AND id NOT IN \(\s+SELECT id FROM events ORDER BY timestamp DESC LIMIT \$2\)`).
+		WithArgs(true, 500).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	removed, err := debugEvents.PruneEvents()
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), removed)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
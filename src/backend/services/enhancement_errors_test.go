@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateEnhancements_TagFailureIsPartial(t *testing.T) {
+	// The AI rejects the tag extraction prompt only
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		var req AnthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if strings.HasPrefix(req.Messages[0].Content, "Extract 3-5 relevant tags") {
+			http.Error(w, `{"error":{"message":"tags rejected"}}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": "A short summary"}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	ai := &AIService{
+		anthropicKey:     "test-key",
+		anthropicBaseURL: server.URL,
+		httpClient:       server.Client(),
+		health:           aiHealth{ttl: time.Minute},
+	}
+
+	settings := EffectiveAISettings{Enhancements: []string{models.EnhancementSummary, models.EnhancementTags}}
+	note := &models.Note{ID: uuid.New(), Title: "Garden"}
+	results, err := ai.generateEnhancements(context.Background(), note, "Plant tomatoes", "English", settings, settings.Enabled)
+	require.NoError(t, err)
+
+	assert.Equal(t, "A short summary", results.summary)
+	assert.Equal(t, []string{models.EnhancementSummary}, results.succeeded)
+	assert.Empty(t, results.tags)
+	require.Len(t, results.failures, 1)
+	assert.Equal(t, models.EnhancementTags, results.failures[0].Enhancement)
+	assert.Contains(t, results.failures[0].Error, "400")
+	assert.False(t, results.failures[0].FailedAt.IsZero())
+
+	assert.Equal(t, models.ProcessingPartial, processingStatus(results.failures, len(results.succeeded) > 0))
+	assert.Equal(t, models.ProcessingFailed, processingStatus(results.failures, false))
+	assert.Equal(t, models.ProcessingCompleted, processingStatus(nil, true))
+}
+
+func TestRetryFailedEnhancements_OnlyFailedOnes(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	ai := &AIService{db: db.DB}
+
+	noteID, userID := uuid.New(), uuid.New()
+	enhancedNote := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"note_id", "processing_status", "processing_errors"}).
+			AddRow(noteID, models.ProcessingPartial, []byte(`[{"enhancement":"tags","error":"status 400","failed_at":"2024-05-01T09:00:00Z"}]`))
+	}
+	mock.ExpectQuery(`SELECT .* FROM "ai_enhanced_notes" JOIN notes`).WillReturnRows(enhancedNote())
+	mock.ExpectQuery(`SELECT \* FROM "notes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(noteID))
+
+	_, err := ai.RetryFailedEnhancements(context.Background(), noteID, userID, []string{models.EnhancementSummary})
+	assert.True(t, errors.Is(err, ErrInvalidInput), "only failed enhancements are retried")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"fmt"
 )
 
 // Common errors
@@ -19,17 +20,25 @@ var (
 	ErrUnauthorized       = errors.New("unauthorized")
 
 	// Resource-specific errors
-	ErrUserNotFound      = errors.New("user not found")
-	ErrNoteNotFound      = errors.New("note not found")
-	ErrBlockNotFound     = errors.New("block not found")
-	ErrNotebookNotFound  = errors.New("notebook not found")
-	ErrTaskNotFound      = errors.New("task not found")
-	ErrEventNotFound     = errors.New("event not found")
-	ErrUserAlreadyExists = errors.New("user with that email already exists")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrNoteNotFound          = errors.New("note not found")
+	ErrBlockNotFound         = errors.New("block not found")
+	ErrNotebookNotFound      = errors.New("notebook not found")
+	ErrTaskNotFound          = errors.New("task not found")
+	ErrEventNotFound         = errors.New("event not found")
+	ErrUserAlreadyExists     = errors.New("user with that email already exists")
+	ErrNoteLocked            = errors.New("note is locked by another user")
+	ErrBulkJobRunning        = errors.New("a job of this type is already running")
+	ErrAgentPanicked         = errors.New("agent panicked")
+	ErrLimitExceeded         = errors.New("usage limit exceeded")
+	ErrExecutionNotCompleted = errors.New("execution has not completed")
 
 	// Type errors
 	ErrInvalidBlockType = errors.New("invalid block type")
 
 	// Connection errors
 	ErrWebSocketConnection = errors.New("websocket connection error")
+	ErrAIUnavailable       = errors.New("AI provider unavailable")
+	// ErrAIPaused is an ErrAIUnavailable, so paused AI degrades the same way
+	ErrAIPaused = fmt.Errorf("%w: AI processing is paused", ErrAIUnavailable)
 )
@@ -17,29 +17,41 @@ type EventHandlerServiceInterface interface {
 }
 
 type EventHandlerService struct {
-	db        *database.Database
-	isRunning bool
-	ticker    *time.Ticker
-	producer  broker.Producer
+	db          *database.Database
+	isRunning   bool
+	ticker      *time.Ticker
+	producer    broker.Producer
+	webhooks    WebhookServiceInterface
+	debug       *DebugEventService
+	autoEnhance *AutoEnhancer
+	chromaSync  *ChromaNoteSyncer
 }
 
 // NewEventHandlerService creates a new service with the default producer
 func NewEventHandlerService(db *database.Database) EventHandlerServiceInterface {
 	return &EventHandlerService{
-		db:        db,
-		isRunning: false,
-		ticker:    time.NewTicker(1 * time.Second),
-		producer:  broker.DefaultProducer,
+		db:          db,
+		isRunning:   false,
+		ticker:      time.NewTicker(1 * time.Second),
+		producer:    broker.DefaultProducer,
+		webhooks:    WebhookServiceInstance,
+		debug:       DebugEventServiceInstance,
+		autoEnhance: AutoEnhancerInstance,
+		chromaSync:  ChromaNoteSyncerInstance,
 	}
 }
 
 // NewEventHandlerServiceWithProducer creates a service with a custom producer (for testing)
 func NewEventHandlerServiceWithProducer(db *database.Database, producer broker.Producer) EventHandlerServiceInterface {
 	return &EventHandlerService{
-		db:        db,
-		isRunning: false,
-		ticker:    time.NewTicker(1 * time.Second),
-		producer:  producer,
+		db:          db,
+		isRunning:   false,
+		ticker:      time.NewTicker(1 * time.Second),
+		producer:    producer,
+		webhooks:    WebhookServiceInstance,
+		debug:       DebugEventServiceInstance,
+		autoEnhance: AutoEnhancerInstance,
+		chromaSync:  ChromaNoteSyncerInstance,
 	}
 }
 
@@ -155,11 +167,31 @@ func (s *EventHandlerService) dispatchEvent(event models.Event) error {
 
 	// Mark the event as dispatched in the database
 	now := time.Now()
-	return s.db.DB.Model(&event).Updates(map[string]interface{}{
+	if err := s.db.DB.Model(&event).Updates(map[string]interface{}{
 		"dispatched":    true,
 		"dispatched_at": now,
 		"status":        "completed",
-	}).Error
+	}).Error; err != nil {
+		return err
+	}
+
+	// Cached summaries of what changed are no longer current
+	invalidateArtifacts(s.db.DB, event, dataMap)
+
+	// Webhooks only see events once, after they are marked as dispatched
+	if s.webhooks != nil {
+		s.webhooks.Deliver(s.db, event)
+	}
+	if s.debug != nil {
+		s.debug.Publish(event)
+	}
+	if s.autoEnhance != nil {
+		s.autoEnhance.NoteChanged(event, dataMap)
+	}
+	if s.chromaSync != nil {
+		s.chromaSync.NoteChanged(event, dataMap)
+	}
+	return nil
 }
 
 func getTopicForEvent(entity string) string {
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/google/uuid"
+)
+
+// Formats an ExecutionReport is downloaded in
+const (
+	ExecutionReportMarkdown = "md"
+	ExecutionReportPDF      = "pdf"
+)
+
+// reportFontFamily is the UTF-8 font family of PDF reports
+const reportFontFamily = "DejaVu"
+
+//go:embed fonts/*.ttf
+var reportFonts embed.FS
+
+// reportFontStyles maps the font styles PDF reports use to their files
+var reportFontStyles = map[string]string{
+	"":  "fonts/DejaVuSansCondensed.ttf",
+	"B": "fonts/DejaVuSansCondensed-Bold.ttf",
+	"I": "fonts/DejaVuSansCondensed-Oblique.ttf",
+}
+
+// ExecutionReport is a stored chain execution compiled into one document: a
+// title page, the final results and the output of every step
+type ExecutionReport struct {
+	ExecutionID string
+	ChainID     string
+	ChainName   string
+	Status      string
+	StartedAt   time.Time
+	CompletedAt *time.Time
+	GeneratedAt time.Time
+	// Blocks are the report body, formatted like a saved results note
+	Blocks []models.Block
+}
+
+// Title is the report's heading
+func (r *ExecutionReport) Title() string {
+	if r.ChainName != "" {
+		return r.ChainName + " Report"
+	}
+	return "Chain Execution Report"
+}
+
+// Duration is how long the execution ran, zero while it has no end
+func (r *ExecutionReport) Duration() time.Duration {
+	if r.CompletedAt == nil {
+		return 0
+	}
+	return r.CompletedAt.Sub(r.StartedAt)
+}
+
+// Filename is the name a report in format is downloaded as
+func (r *ExecutionReport) Filename(format string) string {
+	id := r.ExecutionID
+	if id == "" {
+		id = r.ChainID
+	}
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, id)
+	return fmt.Sprintf("chain-report-%s-%s.%s", r.StartedAt.Format("2006-01-02"), name, format)
+}
+
+// titlePage lists what the title page shows under the title, as label and
+// value pairs
+func (r *ExecutionReport) titlePage() [][2]string {
+	var lines [][2]string
+	if r.ChainName != "" {
+		lines = append(lines, [2]string{"Chain", r.ChainName})
+	}
+	lines = append(lines,
+		[2]string{"Status", r.Status},
+		[2]string{"Started", r.StartedAt.Format(time.RFC3339)})
+	if r.CompletedAt != nil {
+		lines = append(lines,
+			[2]string{"Completed", r.CompletedAt.Format(time.RFC3339)},
+			[2]string{"Duration", formatReportDuration(r.Duration())})
+	}
+	if r.ExecutionID != "" {
+		lines = append(lines, [2]string{"Execution", r.ExecutionID})
+	}
+	return append(lines, [2]string{"Generated", r.GeneratedAt.Format(time.RFC3339)})
+}
+
+// Markdown renders the report with its title page as a metadata list
+func (r *ExecutionReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", r.Title())
+	for _, line := range r.titlePage() {
+		fmt.Fprintf(&b, "- %s: %s\n", line[0], line[1])
+	}
+	b.WriteString("\n---\n\n")
+	b.WriteString(renderNoteBlocks(r.Blocks, NoteContentStructured))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// WritePDF lays the report out as an A4 PDF and writes it to w. The title
+// page is followed by the body, which breaks onto as many numbered pages as
+// it needs. The PDF embeds DejaVu Sans, which covers Latin, Greek and
+// Cyrillic text; emoji are dropped, and CJK text doesn't render as the font
+// has no glyphs for it.
+func (r *ExecutionReport) WritePDF(w io.Writer) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	for style, file := range reportFontStyles {
+		font, err := reportFonts.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		pdf.AddUTF8FontFromBytes(reportFontFamily, style, font)
+	}
+	text := reportPDFText
+
+	pdf.SetTitle(r.Title(), true)
+	pdf.SetCreator("Owlistic", false)
+	pdf.SetCreationDate(r.GeneratedAt)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		if pdf.PageNo() == 1 {
+			return
+		}
+		pdf.SetY(-15)
+		pdf.SetFont(reportFontFamily, "I", 8)
+		pdf.CellFormat(0, 10, fmt.Sprintf("%s - page %d of {nb}", text(r.Title()), pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	pdf.AddPage()
+	pdf.SetY(80)
+	pdf.SetFont(reportFontFamily, "B", 24)
+	pdf.MultiCell(0, 11, text(r.Title()), "", "C", false)
+	pdf.Ln(10)
+	pdf.SetFont(reportFontFamily, "", 12)
+	for _, line := range r.titlePage() {
+		pdf.MultiCell(0, 7, text(line[0]+": "+line[1]), "", "C", false)
+	}
+
+	pdf.AddPage()
+	left, _, _, _ := pdf.GetMargins()
+	for i := range r.Blocks {
+		block := &r.Blocks[i]
+		content, _ := block.Content["text"].(string)
+		content = text(content)
+		if content == "" {
+			continue
+		}
+		switch block.Type {
+		case models.HeadingBlock:
+			size := 12.0
+			switch block.GetHeadingLevel() {
+			case 1:
+				size = 16
+			case 2:
+				size = 13.5
+			}
+			pdf.Ln(3)
+			pdf.SetFont(reportFontFamily, "B", size)
+			pdf.MultiCell(0, size*0.5, content, "", "L", false)
+			pdf.Ln(1.5)
+		case models.ListItemBlock:
+			pdf.SetFont(reportFontFamily, "", 11)
+			pdf.SetLeftMargin(left + 5)
+			pdf.SetX(left + 5)
+			pdf.MultiCell(0, 5.5, "- "+content, "", "L", false)
+			pdf.SetLeftMargin(left)
+			pdf.SetX(left)
+		case models.CodeBlock:
+			pdf.SetFont(reportFontFamily, "", 9)
+			pdf.MultiCell(0, 4.5, content, "", "L", false)
+			pdf.Ln(1.5)
+		case models.QuoteBlock, models.CalloutBlock:
+			pdf.SetFont(reportFontFamily, "I", 11)
+			pdf.MultiCell(0, 5.5, content, "", "L", false)
+			pdf.Ln(1.5)
+		default:
+			pdf.SetFont(reportFontFamily, "", 11)
+			pdf.MultiCell(0, 5.5, content, "", "L", false)
+			pdf.Ln(1.5)
+		}
+	}
+
+	return pdf.Output(w)
+}
+
+// reportPDFText trims s and drops the emoji the report font has no glyphs
+// for, along with the modifiers, joiners and marks that build them
+func reportPDFText(s string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.So, r) || unicode.Is(unicode.Sk, r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, s))
+}
+
+// ExportExecutionReport compiles the stored results of an execution owned by
+// userID into a report: the final results as SaveExecutionAsNote formats
+// them, then a section per step with its status, timing and output
+func (o *AgentOrchestrator) ExportExecutionReport(userID uuid.UUID, executionID string) (*ExecutionReport, error) {
+	stored, err := o.GetExecutionResults(userID, executionID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ExecutionReport{
+		ExecutionID: stored.ExecutionID,
+		ChainID:     stored.ChainID,
+		ChainName:   stored.ChainName,
+		Status:      stored.Status,
+		StartedAt:   stored.StartedAt,
+		CompletedAt: stored.CompletedAt,
+		GeneratedAt: time.Now(),
+	}
+	report.Blocks = o.resultsNoteBlocks(stored.Results, userID, uuid.Nil)
+	report.Blocks = append(report.Blocks, executionErrorBlocks(stored.Errors, userID)...)
+
+	if len(stored.Steps) > 0 {
+		report.Blocks = append(report.Blocks, reportBlock(userID, models.HeadingBlock, "Steps", models.BlockMetadata{"level": 1}))
+	}
+	for _, step := range stored.Steps {
+		report.Blocks = append(report.Blocks, reportBlock(userID, models.HeadingBlock,
+			fmt.Sprintf("Step %d: %s", step.StepNumber, step.Name), models.BlockMetadata{"level": 2}))
+
+		status := "Status: " + step.Status
+		if duration := step.ExecutionTime(); duration != nil {
+			status += " · Duration: " + formatReportDuration(*duration)
+		}
+		report.Blocks = append(report.Blocks, reportBlock(userID, models.TextBlock, status, nil))
+		if step.Description != "" {
+			report.Blocks = append(report.Blocks, reportBlock(userID, models.TextBlock, step.Description, nil))
+		}
+		if step.Error != "" {
+			report.Blocks = append(report.Blocks, reportBlock(userID, models.QuoteBlock, "Error: "+step.Error, nil))
+		}
+		report.Blocks = append(report.Blocks, o.formatMapAsBlocks(step.OutputData, userID, uuid.Nil, 0)...)
+	}
+	return report, nil
+}
+
+// executionErrorBlocks lists the errors stored with an execution under an
+// Errors heading, nothing when there were none
+func executionErrorBlocks(errs interface{}, userID uuid.UUID) []models.Block {
+	list, _ := errs.([]interface{})
+	if len(list) == 0 {
+		return nil
+	}
+	blocks := []models.Block{reportBlock(userID, models.HeadingBlock, "Errors", models.BlockMetadata{"level": 2})}
+	for _, raw := range list {
+		text := fmt.Sprintf("%v", raw)
+		if entry, ok := raw.(map[string]interface{}); ok {
+			message, _ := entry["error"].(string)
+			text = message
+			if agent, _ := entry["agent_name"].(string); agent != "" {
+				text = agent + ": " + message
+			}
+		}
+		blocks = append(blocks, reportBlock(userID, models.ListItemBlock, text, models.BlockMetadata{"listType": "unordered"}))
+	}
+	return blocks
+}
+
+// reportBlock is a block of a report body, which isn't stored in a note
+func reportBlock(userID uuid.UUID, blockType models.BlockType, text string, metadata models.BlockMetadata) models.Block {
+	if metadata == nil {
+		metadata = models.BlockMetadata{}
+	}
+	metadata["spans"] = []interface{}{}
+	return models.Block{
+		ID:       uuid.New(),
+		UserID:   userID,
+		Type:     blockType,
+		Content:  models.BlockContent{"text": text},
+		Metadata: metadata,
+	}
+}
+
+// formatReportDuration rounds d to milliseconds under a second and to
+// seconds above
+func formatReportDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectReportExecution answers the lookup of a stored research chain whose
+// last step failed
+func expectReportExecution(mock sqlmock.Sqlmock, userID, chainID uuid.UUID, executionID, writerOutput string) {
+	started := time.Date(2025, 3, 4, 15, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT \* FROM "ai_agents"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "agent_type", "status", "input_data", "output_data", "started_at", "completed_at"}).
+			AddRow(chainID, userID, "agent_chain", "completed", []byte(`{"chain_name":"Research and Summarize"}`),
+				[]byte(`{"summary":"Go 1.23 adds range over functions","sources":["go.dev/blog"],"execution_id":"`+executionID+`"}`),
+				started, started.Add(90*time.Second)))
+	mock.ExpectQuery(`SELECT \* FROM "ai_agent_steps"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "agent_id", "step_number", "name", "status", "output_data", "error", "started_at", "completed_at"}).
+			AddRow(uuid.New(), chainID, 1, "Researcher", "completed", []byte(`{"findings":"Iterators are in the spec"}`), "", started, started.Add(40*time.Second)).
+			AddRow(uuid.New(), chainID, 2, "Writer", "completed", []byte(writerOutput), "", started.Add(40*time.Second), started.Add(85*time.Second)).
+			AddRow(uuid.New(), chainID, 3, "Publisher", "failed", []byte(`{}`), "no destination configured", started.Add(85*time.Second), started.Add(90*time.Second)))
+}
+
+func TestExportExecutionReport_MarkdownHasStepsAndSummary(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	o := &AgentOrchestrator{db: db.DB}
+
+	userID, chainID := uuid.New(), uuid.New()
+	executionID := uuid.New().String()
+	expectReportExecution(mock, userID, chainID, executionID, `{"draft":"Range over func lets you write iterators"}`)
+
+	report, err := o.ExportExecutionReport(userID, executionID)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "chain-report-2025-03-04-"+executionID+".md", report.Filename(ExecutionReportMarkdown))
+
+	markdown := report.Markdown()
+	assert.True(t, strings.HasPrefix(markdown, "# Research and Summarize Report\n"))
+	assert.Contains(t, markdown, "- Status: completed\n- Started: 2025-03-04T15:00:00Z\n- Completed: 2025-03-04T15:01:30Z\n- Duration: 1m30s\n")
+
+	// The final summary leads the results, then every step follows in order
+	sections := []string{
+		"## 📋 Summary\nGo 1.23 adds range over functions",
+		"## Sources\n- go.dev/blog",
+		"# Steps",
+		"## Step 1: Researcher\nStatus: completed · Duration: 40s\nFindings: Iterators are in the spec",
+		"## Step 2: Writer\nStatus: completed · Duration: 45s\nDraft: Range over func lets you write iterators",
+		"## Step 3: Publisher\nStatus: failed · Duration: 5s\n> Error: no destination configured",
+	}
+	last := -1
+	for _, section := range sections {
+		at := strings.Index(markdown, section)
+		require.NotEqual(t, -1, at, section)
+		assert.Greater(t, at, last, section)
+		last = at
+	}
+}
+
+func TestExecutionReport_PDFPaginatesLongOutput(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	o := &AgentOrchestrator{db: db.DB}
+
+	userID := uuid.New()
+	executionID := uuid.New().String()
+	draft := strings.Repeat("Range over func lets you write iterators. ", 800)
+	expectReportExecution(mock, userID, uuid.New(), executionID, `{"draft":"`+draft+`"}`)
+
+	report, err := o.ExportExecutionReport(userID, executionID)
+	require.NoError(t, err)
+
+	var pdf bytes.Buffer
+	require.NoError(t, report.WritePDF(&pdf))
+	assert.True(t, bytes.HasPrefix(pdf.Bytes(), []byte("%PDF-")))
+	// The title page, then a body too long for a single page
+	assert.Greater(t, bytes.Count(pdf.Bytes(), []byte("/Type /Page\n")), 3)
+}
+
+func TestExecutionReport_PDFEmbedsAUnicodeFont(t *testing.T) {
+	report := &ExecutionReport{
+		ChainName:   "Исследование",
+		Status:      "completed",
+		GeneratedAt: time.Now(),
+		Blocks: []models.Block{
+			reportBlock(uuid.New(), models.HeadingBlock, "Итоги 🚀", models.BlockMetadata{"level": 1}),
+			reportBlock(uuid.New(), models.TextBlock, "Диапазоны по функциям", nil),
+		},
+	}
+
+	var pdf bytes.Buffer
+	require.NoError(t, report.WritePDF(&pdf))
+	assert.Contains(t, pdf.String(), "/BaseFont /utf8dejavu", "Cyrillic needs the embedded font, not the built-in cp1252 ones")
+	assert.Contains(t, pdf.String(), "/FontFile2")
+	assert.NotContains(t, pdf.String(), "/BaseFont /Helvetica")
+
+	// Only the emoji is dropped, Cyrillic text is kept as is
+	assert.Equal(t, "Итоги", reportPDFText(" Итоги 🚀 "))
+}
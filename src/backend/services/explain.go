@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/prompts"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Explanation levels
+const (
+	ExplainELI5     = "eli5"
+	ExplainStandard = "standard"
+	ExplainExpert   = "expert"
+)
+
+const (
+	// explainContextTokens is how much of the selected text the model sees
+	explainContextTokens = 6000
+	explainMaxTokens     = 800
+)
+
+// ExplainOptions picks what to explain and how
+type ExplainOptions struct {
+	BlockIDs  []uuid.UUID // Blocks to explain, in note order; the whole note when empty
+	Selection string      // Selected text, explained instead of blocks when set
+	Level     string      // eli5, standard or expert; standard when empty
+	Append    bool        // Add the explanation to the note as a callout block
+}
+
+// Explanation is a plain-language explanation of part of a note
+type Explanation struct {
+	NoteID      uuid.UUID     `json:"note_id"`
+	Scope       string        `json:"scope"` // selection, blocks or note
+	Level       string        `json:"level"`
+	Explanation string        `json:"explanation"`
+	Block       *models.Block `json:"block,omitempty"` // The callout added with Append
+}
+
+// ExplainNote explains the selected text, the given blocks or the whole note
+// at the requested level. The note is left alone unless opts.Append is set,
+// which adds the explanation as a callout after the explained blocks, or at
+// the end of the note.
+func (ai *AIService) ExplainNote(ctx context.Context, noteID, userID uuid.UUID, opts ExplainOptions) (*Explanation, error) {
+	if opts.Level == "" {
+		opts.Level = ExplainStandard
+	}
+	switch opts.Level {
+	case ExplainELI5, ExplainStandard, ExplainExpert:
+	default:
+		return nil, fmt.Errorf("%w: level must be %s, %s or %s", ErrInvalidInput, ExplainELI5, ExplainStandard, ExplainExpert)
+	}
+
+	// Notes shared with the user can be explained, appending needs an editor.
+	// Without access the note is reported missing, as with notes that aren't.
+	db := &database.Database{DB: ai.db.WithContext(ctx)}
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userID.String(), noteID.String(), "viewer")
+	if err != nil {
+		return nil, err
+	}
+	if !hasAccess {
+		return nil, ErrNoteNotFound
+	}
+	if opts.Append {
+		canEdit, err := RoleServiceInstance.HasNoteAccess(db, userID.String(), noteID.String(), "editor")
+		if err != nil {
+			return nil, err
+		}
+		if !canEdit {
+			return nil, ErrInsufficientAccess
+		}
+	}
+
+	var note models.Note
+	if err := db.DB.Where("id = ?", noteID).First(&note).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoteNotFound
+		}
+		return nil, err
+	}
+
+	result := &Explanation{NoteID: noteID, Level: opts.Level}
+	var content string
+	var selected []models.Block
+	switch {
+	case strings.TrimSpace(opts.Selection) != "":
+		result.Scope = "selection"
+		content = strings.TrimSpace(opts.Selection)
+	case len(opts.BlockIDs) > 0:
+		result.Scope = "blocks"
+		blocks, err := ai.noteBlocksByID(ctx, noteID, opts.BlockIDs)
+		if err != nil {
+			return nil, err
+		}
+		selected = blocks
+		content = renderNoteBlocks(blocks, noteContentFormat())
+	default:
+		result.Scope = "note"
+		content = ai.extractNoteContent(&note)
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("%w: there is no text to explain", ErrInvalidInput)
+	}
+
+	prompt, err := prompts.Render(prompts.Explain, map[string]interface{}{
+		"Title":   note.Title,
+		"Content": truncateToTokens(content, explainContextTokens),
+		"Level":   opts.Level,
+		"Scope":   result.Scope,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = withAICallFeature(WithAICallUser(ctx, userID), "explain", note.Title, content)
+	response, err := ai.callAnthropic(ctx, prompt, explainMaxTokens)
+	if err != nil {
+		return nil, err
+	}
+	result.Explanation = strings.TrimSpace(response)
+	if result.Explanation == "" {
+		return nil, errors.New("the model returned no text")
+	}
+
+	if opts.Append {
+		order, err := ai.explanationOrder(ctx, noteID, selected)
+		if err != nil {
+			return nil, err
+		}
+		block, err := BlockServiceInstance.CreateBlock(&database.Database{DB: ai.db}, map[string]interface{}{
+			"note_id": noteID.String(),
+			"type":    string(models.CalloutBlock),
+			"order":   order,
+			"content": map[string]interface{}{"text": result.Explanation},
+			"metadata": map[string]interface{}{
+				"spans":         []interface{}{},
+				"ai_generated":  true,
+				"ai_action":     "explain",
+				"explain_level": opts.Level,
+				"generated_at":  time.Now().UTC().Format(time.RFC3339),
+			},
+		}, map[string]interface{}{"user_id": userID.String()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add explanation: %w", err)
+		}
+		result.Block = &block
+	}
+
+	return result, nil
+}
+
+// noteBlocksByID loads the blocks, in note order, requiring all of them to
+// belong to the note
+func (ai *AIService) noteBlocksByID(ctx context.Context, noteID uuid.UUID, blockIDs []uuid.UUID) ([]models.Block, error) {
+	unique := make(map[uuid.UUID]bool, len(blockIDs))
+	for _, id := range blockIDs {
+		unique[id] = true
+	}
+
+	var blocks []models.Block
+	if err := ai.db.WithContext(ctx).Where("note_id = ? AND id IN ?", noteID, blockIDs).Order("\"order\"").Find(&blocks).Error; err != nil {
+		return nil, err
+	}
+	if len(blocks) != len(unique) {
+		return nil, fmt.Errorf("%w: block_ids must be blocks of the note", ErrInvalidInput)
+	}
+	return blocks, nil
+}
+
+// explanationOrder places a callout right after the last explained block,
+// before the block that follows it, or at the end of the note
+func (ai *AIService) explanationOrder(ctx context.Context, noteID uuid.UUID, selected []models.Block) (float64, error) {
+	db := ai.db.WithContext(ctx).Model(&models.Block{})
+	if len(selected) == 0 {
+		var lastOrder float64
+		if err := db.Where("note_id = ?", noteID).Select("COALESCE(MAX(\"order\"), 0)").Row().Scan(&lastOrder); err != nil {
+			return 0, err
+		}
+		return lastOrder + 1000.0, nil
+	}
+
+	after := selected[len(selected)-1].Order
+	var next *float64
+	if err := db.Where("note_id = ? AND \"order\" > ?", noteID, after).Select("MIN(\"order\")").Row().Scan(&next); err != nil {
+		return 0, err
+	}
+	if next == nil {
+		return after + 1000.0, nil
+	}
+	return (after + *next) / 2, nil
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// viewerRoles lets the user view notes but not edit them
+type viewerRoles struct {
+	RoleServiceInterface
+}
+
+func (viewerRoles) HasNoteAccess(db *database.Database, userID string, noteID string, requiredRole string) (bool, error) {
+	return requiredRole == "viewer", nil
+}
+
+// noRoles grants no access at all
+type noRoles struct {
+	RoleServiceInterface
+}
+
+func (noRoles) HasNoteAccess(db *database.Database, userID string, noteID string, requiredRole string) (bool, error) {
+	return false, nil
+}
+
+func withRoles(t *testing.T, roles RoleServiceInterface) {
+	original := RoleServiceInstance
+	RoleServiceInstance = roles
+	t.Cleanup(func() { RoleServiceInstance = original })
+}
+
+func expectExplainedNote(mock sqlmock.Sqlmock, noteID, userID uuid.UUID) {
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE id = \$1`).
+		WithArgs(noteID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).AddRow(noteID, userID, "Thermodynamics"))
+}
+
+func TestExplainNote_SelectedBlocksOnly(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	blocks := &recordingBlockService{}
+	original := BlockServiceInstance
+	BlockServiceInstance = blocks
+	t.Cleanup(func() { BlockServiceInstance = original })
+
+	ai, prompt := newStubAIService(t, "Heat always spreads out.")
+	ai.db = db.DB
+
+	noteID, userID := uuid.New(), uuid.New()
+	headingID, textID := uuid.New(), uuid.New()
+	expectExplainedNote(mock, noteID, userID)
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE \(note_id = \$1 AND id IN \(\$2,\$3\)\)`).
+		WithArgs(noteID, textID, headingID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "content", "metadata", "order"}).
+			AddRow(headingID, "header", []byte(`{"text":"Second law"}`), []byte(`{"level":2}`), 1000.0).
+			AddRow(textID, "text", []byte(`{"text":"Entropy of an isolated system never decreases."}`), []byte(`{}`), 2000.0))
+
+	explanation, err := ai.ExplainNote(context.Background(), noteID, userID, ExplainOptions{
+		BlockIDs: []uuid.UUID{textID, headingID},
+		Level:    ExplainELI5,
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, "blocks", explanation.Scope)
+	assert.Equal(t, ExplainELI5, explanation.Level)
+	assert.Equal(t, "Heat always spreads out.", explanation.Explanation)
+	assert.Nil(t, explanation.Block)
+	assert.Contains(t, *prompt, "passage from the note \"Thermodynamics\"")
+	assert.Contains(t, *prompt, "## Second law\nEntropy of an isolated system never decreases.")
+	assert.Contains(t, *prompt, "like I'm five")
+	assert.Empty(t, blocks.created, "the note is left alone without append")
+}
+
+func TestExplainNote_WholeNote(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	ai, prompt := newStubAIService(t, "It is about energy.")
+	ai.db = db.DB
+
+	noteID, userID := uuid.New(), uuid.New()
+	expectExplainedNote(mock, noteID, userID)
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE note_id = \$1`).
+		WithArgs(noteID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "content"}).
+			AddRow(uuid.New(), "text", []byte(`{"text":"Energy is conserved."}`)).
+			AddRow(uuid.New(), "text", []byte(`{"text":"Entropy increases."}`)))
+
+	explanation, err := ai.ExplainNote(context.Background(), noteID, userID, ExplainOptions{Level: ExplainExpert})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, "note", explanation.Scope)
+	assert.Contains(t, *prompt, "Explain the following note \"Thermodynamics\"")
+	assert.Contains(t, *prompt, "Energy is conserved.\nEntropy increases.")
+	assert.Contains(t, *prompt, "The reader is an expert")
+}
+
+func TestExplainNote_AppendAddsCalloutAfterBlocks(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	blocks := &recordingBlockService{}
+	original := BlockServiceInstance
+	BlockServiceInstance = blocks
+	t.Cleanup(func() { BlockServiceInstance = original })
+
+	ai, _ := newStubAIService(t, "Things get messier over time.")
+	ai.db = db.DB
+
+	noteID, userID, blockID := uuid.New(), uuid.New(), uuid.New()
+	expectExplainedNote(mock, noteID, userID)
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE \(note_id = \$1 AND id IN \(\$2\)\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "content", "order"}).
+			AddRow(blockID, "text", []byte(`{"text":"Entropy increases."}`), 2000.0))
+	mock.ExpectQuery(`SELECT MIN\("order"\) FROM "blocks" WHERE \(note_id = \$1 AND "order" > \$2\)`).
+		WithArgs(noteID, 2000.0).
+		WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(3000.0))
+
+	explanation, err := ai.ExplainNote(context.Background(), noteID, userID, ExplainOptions{
+		BlockIDs: []uuid.UUID{blockID},
+		Append:   true,
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	require.NotNil(t, explanation.Block)
+	require.Len(t, blocks.created, 1)
+	assert.Equal(t, models.CalloutBlock, explanation.Block.Type)
+	assert.Equal(t, 2500.0, explanation.Block.Order, "the callout goes between the block and the next one")
+	assert.Equal(t, "Things get messier over time.", explanation.Block.Content["text"])
+	assert.Equal(t, "explain", explanation.Block.Metadata["ai_action"])
+	assert.Equal(t, ExplainStandard, explanation.Block.Metadata["explain_level"])
+}
+
+func TestExplainNote_Validation(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	ai, _ := newStubAIService(t, "unused")
+	ai.db = db.DB
+
+	_, err := ai.ExplainNote(context.Background(), uuid.New(), uuid.New(), ExplainOptions{Level: "phd"})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	// Blocks of other notes can't be explained through this one
+	noteID, userID := uuid.New(), uuid.New()
+	expectExplainedNote(mock, noteID, userID)
+	mock.ExpectQuery(`SELECT \* FROM "blocks"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = ai.ExplainNote(context.Background(), noteID, userID, ExplainOptions{BlockIDs: []uuid.UUID{uuid.New()}})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExplainNote_ChecksNoteAccess(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	ai, _ := newStubAIService(t, "Heat always spreads out.")
+	ai.db = db.DB
+	noteID, userID := uuid.New(), uuid.New()
+
+	// A note shared for viewing can be explained
+	withRoles(t, viewerRoles{})
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE id = \$1`).
+		WithArgs(noteID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).AddRow(noteID, uuid.New(), "Thermodynamics"))
+	_, err := ai.ExplainNote(context.Background(), noteID, userID, ExplainOptions{Selection: "entropy"})
+	require.NoError(t, err)
+
+	// but not added to
+	_, err = ai.ExplainNote(context.Background(), noteID, userID, ExplainOptions{Selection: "entropy", Append: true})
+	assert.ErrorIs(t, err, ErrInsufficientAccess)
+
+	withRoles(t, noRoles{})
+	_, err = ai.ExplainNote(context.Background(), noteID, userID, ExplainOptions{Selection: "entropy"})
+	assert.ErrorIs(t, err, ErrNoteNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
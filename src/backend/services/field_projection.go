@@ -0,0 +1,47 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Columns a client may select with the fields parameter of the note and task
+// list endpoints. JSON names match the column names.
+var (
+	NoteFields = []string{"id", "user_id", "notebook_id", "title", "position", "preview", "tags", "language", "created_at", "updated_at"}
+	TaskFields = []string{"id", "user_id", "note_id", "title", "description", "is_completed", "due_date", "metadata", "created_at", "updated_at"}
+)
+
+// Columns returned by list endpoints when no fields are requested: enough to
+// show and open an item
+var (
+	NoteListFields = []string{"id", "user_id", "notebook_id", "title", "position", "preview", "tags", "created_at", "updated_at"}
+	TaskListFields = []string{"id", "user_id", "note_id", "title", "is_completed", "due_date", "created_at", "updated_at"}
+)
+
+// ParseFields turns a comma-separated fields parameter into the columns to
+// select, keeping the order given and dropping duplicates. An empty value
+// selects defaults; a field missing from allowed is an ErrInvalidInput.
+func ParseFields(raw string, allowed, defaults []string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return defaults, nil
+	}
+
+	var fields []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || seen[field] {
+			continue
+		}
+		if !contains(allowed, field) {
+			return nil, fmt.Errorf("%w: unknown field %q, expected one of %s", ErrInvalidInput, field, strings.Join(allowed, ", "))
+		}
+		seen[field] = true
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return defaults, nil
+	}
+	return fields, nil
+}
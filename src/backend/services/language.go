@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// AILanguagePreference is the user preference holding the language AI
+// summaries, tags and titles are written in, as an ISO 639-1 code such as
+// "de". When unset they follow the language of each note.
+const AILanguagePreference = "ai_language"
+
+// minLanguageHits is how many common words a text needs before its language
+// is trusted
+const minLanguageHits = 3
+
+var languageNames = map[string]string{
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"de": "German",
+	"it": "Italian",
+	"pt": "Portuguese",
+	"nl": "Dutch",
+	"ru": "Russian",
+	"el": "Greek",
+	"ar": "Arabic",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"th": "Thai",
+	"zh": "Chinese",
+	"ja": "Japanese",
+	"ko": "Korean",
+}
+
+// languageStopwords are frequent function words that tell Latin-script
+// languages apart
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "of", "to", "that", "it", "with", "for", "this", "was", "you", "not", "have", "be", "on"},
+	"es": {"el", "los", "las", "que", "y", "un", "una", "es", "por", "con", "para", "del", "se", "lo", "como", "pero", "está", "muy"},
+	"fr": {"le", "les", "des", "et", "est", "une", "du", "qui", "pour", "dans", "pas", "ce", "sur", "avec", "je", "nous", "vous", "au"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "mit", "den", "von", "sich", "auch", "auf", "für", "ich", "wir"},
+	"it": {"il", "gli", "di", "che", "è", "per", "non", "della", "sono", "anche", "ma", "una", "nel", "questo", "come"},
+	"pt": {"os", "que", "do", "da", "em", "um", "uma", "para", "com", "não", "é", "dos", "das", "mas", "por", "você"},
+	"nl": {"het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "ook", "er", "maar", "ik", "wij"},
+}
+
+// scriptLanguages maps non-Latin scripts to the language they most likely
+// indicate
+var scriptLanguages = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Thai, "th"},
+}
+
+// LanguageName returns the English name of an ISO 639-1 code, or the value
+// itself when it isn't a known code
+func LanguageName(code string) string {
+	if name, ok := languageNames[strings.ToLower(code)]; ok {
+		return name
+	}
+	return code
+}
+
+// detectLanguage guesses the ISO 639-1 code of text: from the script for
+// non-Latin scripts, and by counting common words for Latin ones. Returns
+// "" when the text is too short to tell.
+func detectLanguage(text string) string {
+	scripts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, script := range scriptLanguages {
+			if unicode.Is(script.table, r) {
+				scripts[script.language]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	// Japanese mixes kana with Han characters, so any kana decides it
+	if scripts["ja"] > 0 && scripts["ja"]+scripts["zh"] > letters*2/5 {
+		return "ja"
+	}
+	for _, script := range scriptLanguages {
+		if scripts[script.language] > letters*2/5 {
+			return script.language
+		}
+	}
+
+	hits := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, word := range words {
+		for language, stopwords := range languageStopwords {
+			for _, stopword := range stopwords {
+				if word == stopword {
+					hits[language]++
+					break
+				}
+			}
+		}
+	}
+
+	// A tie between the two best languages means neither is detected
+	languages := make([]string, 0, len(hits))
+	for language := range hits {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	best, bestHits, runnerUp := "", 0, 0
+	for _, language := range languages {
+		count := hits[language]
+		switch {
+		case count > bestHits:
+			best, bestHits, runnerUp = language, count, bestHits
+		case count == bestHits:
+			runnerUp = count
+		case count > runnerUp:
+			runnerUp = count
+		}
+	}
+	if bestHits < minLanguageHits || bestHits == runnerUp {
+		return ""
+	}
+	return best
+}
+
+// noteLanguage detects the language of a note's content and stores it on the
+// note when it changed. Returns the name of the language AI output for the
+// note is written in: the user's preferred language when set, otherwise the
+// detected one, or "" when neither is known.
+func (ai *AIService) noteLanguage(ctx context.Context, note *models.Note, content string) string {
+	if detected := detectLanguage(note.Title + "\n" + content); detected != "" && detected != note.Language {
+		if err := ai.db.WithContext(ctx).Model(&models.Note{}).
+			Where("id = ?", note.ID).
+			UpdateColumn("language", detected).Error; err != nil {
+			log.Printf("Failed to store language of note %s: %v", note.ID, err)
+		} else {
+			note.Language = detected
+		}
+	}
+
+	if preferred := ai.preferredLanguage(ctx, note.UserID); preferred != "" {
+		return LanguageName(preferred)
+	}
+	if note.Language != "" {
+		return LanguageName(note.Language)
+	}
+	return ""
+}
+
+// preferredLanguage returns the user's AI output language preference
+func (ai *AIService) preferredLanguage(ctx context.Context, userID uuid.UUID) string {
+	var preferred string
+	err := ai.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ?", userID).
+		Select("COALESCE(preferences->>?, '')", AILanguagePreference).
+		Row().Scan(&preferred)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to read language preference of user %s: %v", userID, err)
+	}
+	return strings.TrimSpace(preferred)
+}
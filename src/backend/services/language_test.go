@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"english", "The meeting is on Monday and we have to prepare the slides for it.", "en"},
+		{"spanish", "La reunión es el lunes y tenemos que preparar las diapositivas para la presentación.", "es"},
+		{"german", "Das Treffen ist am Montag und wir müssen die Folien auch noch vorbereiten.", "de"},
+		{"french", "Nous avons une réunion lundi et les diapositives sont dans le dossier partagé.", "fr"},
+		{"russian", "Встреча в понедельник, нужно подготовить слайды.", "ru"},
+		{"japanese", "月曜日に会議があります。スライドを準備してください。", "ja"},
+		{"chinese", "星期一开会，需要准备幻灯片。", "zh"},
+		{"too short", "Groceries", ""},
+		{"no letters", "12:30 - 14:00", ""},
+		{"tie", "the cat and the dog, der Hund und die Katze", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, detectLanguage(tt.text))
+		})
+	}
+}
+
+func TestGenerateSummary_AsksForLanguage(t *testing.T) {
+	ai, prompt := newStubAIService(t, "Resumen de la reunión.")
+
+	summary, err := ai.generateSummary(context.Background(), "La reunión es el lunes.", "Reunión", "Spanish", SummaryStyle{})
+	require.NoError(t, err)
+	assert.Equal(t, "Resumen de la reunión.", summary)
+	assert.Contains(t, *prompt, "Write the summary in Spanish.")
+
+	_, err = ai.generateSummary(context.Background(), "The meeting is on Monday.", "Meeting", "", SummaryStyle{})
+	require.NoError(t, err)
+	assert.NotContains(t, *prompt, "Write the summary in")
+}
+
+func TestNoteLanguage_StoresDetectedLanguage(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	ai, _ := newStubAIService(t, "")
+	ai.db = db.DB
+
+	note := &models.Note{ID: uuid.New(), UserID: uuid.New(), Title: "Notas de la reunión"}
+	content := "La reunión es el lunes y tenemos que preparar las diapositivas para los clientes."
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`UPDATE "notes" SET "language"=\$1 WHERE id = \$2`).
+		WithArgs("es", note.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+	dbMock.ExpectQuery(`SELECT COALESCE\(preferences->>\$1, ''\) FROM "users" WHERE id = \$2`).
+		WithArgs(AILanguagePreference, note.UserID).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(""))
+
+	assert.Equal(t, "Spanish", ai.noteLanguage(context.Background(), note, content))
+	assert.Equal(t, "es", note.Language)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestNoteLanguage_PrefersUserLanguage(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	ai, _ := newStubAIService(t, "")
+	ai.db = db.DB
+
+	// The language is already stored, so only the preference is read
+	note := &models.Note{ID: uuid.New(), UserID: uuid.New(), Language: "es"}
+	dbMock.ExpectQuery(`SELECT COALESCE\(preferences->>\$1, ''\) FROM "users"`).
+		WithArgs(AILanguagePreference, note.UserID).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow("de"))
+
+	language := ai.noteLanguage(context.Background(), note, "La reunión es el lunes y tenemos que preparar las diapositivas.")
+	assert.Equal(t, "German", language)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// linkFetchMaxBytes caps how much of a page is read for its metadata
+	linkFetchMaxBytes  = 1 << 20
+	linkFetchRedirects = 5
+	linkTitleMaxChars  = 300
+	linkDescMaxChars   = 1000
+)
+
+// ErrBlockedAddress is returned for links to loopback, private, link-local
+// and other non-public addresses
+var ErrBlockedAddress = errors.New("link points to a non-public address")
+
+// LinkPreview is what a bookmark shows of a page
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	SiteName    string `json:"site_name"`
+}
+
+type LinkServiceInterface interface {
+	AddLink(ctx context.Context, db *database.Database, noteID string, rawURL string, params map[string]interface{}) (models.Block, error)
+	FetchPreview(ctx context.Context, rawURL string) (LinkPreview, error)
+}
+
+type LinkService struct {
+	client *http.Client
+}
+
+var LinkServiceInstance LinkServiceInterface = NewLinkService()
+
+// NewLinkService fetches pages with LINK_FETCH_TIMEOUT (10s by default),
+// refusing to connect to non-public addresses
+func NewLinkService() LinkServiceInterface {
+	timeout := 10 * time.Second
+	if value := os.Getenv("LINK_FETCH_TIMEOUT"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			timeout = parsed
+		}
+	}
+	return &LinkService{client: newLinkClient(timeout)}
+}
+
+// newLinkClient checks every address it connects to, so redirects and DNS
+// answers can't reach internal hosts either. Proxies are not used as the
+// check would then only see the proxy.
+func newLinkClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicIP(net.ParseIP(host)) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= linkFetchRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkLinkURL(req.URL)
+		},
+	}
+}
+
+// isPublicIP reports whether ip is a globally routable unicast address
+func isPublicIP(ip net.IP) bool {
+	if ip == nil || ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		// "This network" and carrier-grade NAT
+		if ip4[0] == 0 || (ip4[0] == 100 && ip4[1]&0xc0 == 64) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLinkURL accepts absolute http and https URLs
+func parseLinkURL(rawURL string) (*url.URL, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid url", ErrInvalidInput)
+	}
+	if err := checkLinkURL(parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// checkLinkURL rejects other schemes and literal non-public addresses.
+// Host names are checked when connecting.
+func checkLinkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: only http and https links are supported", ErrInvalidInput)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: url has no host", ErrInvalidInput)
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	return nil
+}
+
+// FetchPreview reads a page's title and description. Pages that aren't
+// HTML get a preview with only the URL.
+func (s *LinkService) FetchPreview(ctx context.Context, rawURL string) (LinkPreview, error) {
+	parsed, err := parseLinkURL(rawURL)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return LinkPreview{}, fmt.Errorf("%w: invalid url", ErrInvalidInput)
+	}
+	req.Header.Set("User-Agent", "Owlistic link preview")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.5")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// A redirect or DNS answer led somewhere not allowed
+		if errors.Is(err, ErrBlockedAddress) {
+			return LinkPreview{}, fmt.Errorf("%w: %s", ErrBlockedAddress, parsed.Hostname())
+		}
+		if errors.Is(err, ErrInvalidInput) {
+			return LinkPreview{}, fmt.Errorf("%w: link redirects to an unsupported url", ErrInvalidInput)
+		}
+		return LinkPreview{}, fmt.Errorf("failed to fetch link: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return LinkPreview{}, fmt.Errorf("failed to fetch link: status %d", resp.StatusCode)
+	}
+
+	preview := LinkPreview{URL: parsed.String()}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		preview = parseLinkPreview(io.LimitReader(resp.Body, linkFetchMaxBytes), preview.URL)
+	}
+	return preview, nil
+}
+
+// parseLinkPreview reads the title and description of an HTML page,
+// preferring Open Graph tags over <title> and the description meta tag
+func parseLinkPreview(body io.Reader, pageURL string) LinkPreview {
+	preview := LinkPreview{URL: pageURL}
+	var title, ogTitle, description, ogDescription string
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		switch token.Data {
+		case "title":
+			if title == "" && tokenizer.Next() == html.TextToken {
+				title = string(tokenizer.Text())
+			}
+		case "meta":
+			var key, content string
+			for _, attr := range token.Attr {
+				switch strings.ToLower(attr.Key) {
+				case "name", "property":
+					key = strings.ToLower(attr.Val)
+				case "content":
+					content = attr.Val
+				}
+			}
+			switch key {
+			case "og:title":
+				ogTitle = content
+			case "og:description":
+				ogDescription = content
+			case "description":
+				description = content
+			case "og:site_name":
+				preview.SiteName = cleanLinkText(content, linkTitleMaxChars)
+			}
+		case "body":
+			// Metadata lives in the head
+			if title != "" || ogTitle != "" {
+				return finishLinkPreview(preview, title, ogTitle, description, ogDescription)
+			}
+		}
+	}
+	return finishLinkPreview(preview, title, ogTitle, description, ogDescription)
+}
+
+func finishLinkPreview(preview LinkPreview, title, ogTitle, description, ogDescription string) LinkPreview {
+	preview.Title = cleanLinkText(firstNonEmpty(ogTitle, title), linkTitleMaxChars)
+	preview.Description = cleanLinkText(firstNonEmpty(ogDescription, description), linkDescMaxChars)
+	return preview
+}
+
+// cleanLinkText collapses whitespace and caps the text at maxChars runes
+func cleanLinkText(text string, maxChars int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > maxChars {
+		text = string(runes[:maxChars]) + "..."
+	}
+	return text
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// linkBlockContent is the content of a bookmark block. The text is the
+// title, or the URL when the page has none.
+func linkBlockContent(preview LinkPreview) map[string]interface{} {
+	text := preview.Title
+	if text == "" {
+		text = preview.URL
+	}
+	return map[string]interface{}{
+		"text":        text,
+		"url":         preview.URL,
+		"title":       preview.Title,
+		"description": preview.Description,
+		"site_name":   preview.SiteName,
+	}
+}
+
+// AddLink appends a bookmark block for the URL to the note, editors only.
+// A page that can't be fetched still gets a bookmark with just its URL.
+func (s *LinkService) AddLink(ctx context.Context, db *database.Database, noteID string, rawURL string, params map[string]interface{}) (models.Block, error) {
+	userID, ok := params["user_id"].(string)
+	if !ok || userID == "" {
+		return models.Block{}, errors.New("user_id must be provided in parameters")
+	}
+
+	parsed, err := parseLinkURL(rawURL)
+	if err != nil {
+		return models.Block{}, err
+	}
+
+	// Check access before fetching anything on the user's behalf
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userID, noteID, "editor")
+	if err != nil {
+		return models.Block{}, err
+	}
+	if !hasAccess {
+		return models.Block{}, ErrInsufficientAccess
+	}
+
+	preview, err := s.FetchPreview(ctx, parsed.String())
+	if errors.Is(err, ErrBlockedAddress) || errors.Is(err, ErrInvalidInput) {
+		return models.Block{}, err
+	}
+	if err != nil {
+		log.Printf("Link preview of %s failed: %v", parsed.String(), err)
+		preview = LinkPreview{URL: parsed.String()}
+	}
+
+	return BlockServiceInstance.CreateBlock(db, map[string]interface{}{
+		"type":     string(models.LinkBlock),
+		"note_id":  noteID,
+		"content":  linkBlockContent(preview),
+		"metadata": map[string]interface{}{"fetched_at": time.Now().UTC().Format(time.RFC3339)},
+	}, params)
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLinkPreview_PrefersOpenGraph(t *testing.T) {
+	page := `<!doctype html><html><head>
+		<title>Fallback   title</title>
+		<meta property="og:title" content="Go 1.23 is released">
+		<meta name="description" content="Plain description">
+		<meta property="og:description" content="Iterators &amp; more">
+		<meta property="og:site_name" content="The Go Blog">
+		</head><body><h1>Ignored</h1></body></html>`
+
+	preview := parseLinkPreview(strings.NewReader(page), "https://go.dev/blog/go1.23")
+
+	assert.Equal(t, LinkPreview{
+		URL:         "https://go.dev/blog/go1.23",
+		Title:       "Go 1.23 is released",
+		Description: "Iterators & more",
+		SiteName:    "The Go Blog",
+	}, preview)
+}
+
+func TestParseLinkPreview_FallsBackToTitleTag(t *testing.T) {
+	page := "<html><head><title>\n  Example Domain\n</title><meta name=\"description\" content=\"For examples\"></head><body></body></html>"
+
+	preview := parseLinkPreview(strings.NewReader(page), "https://example.com")
+
+	assert.Equal(t, "Example Domain", preview.Title)
+	assert.Equal(t, "For examples", preview.Description)
+}
+
+func TestFetchPreview_RejectsInternalAddresses(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>internal</title>"))
+	}))
+	defer server.Close()
+
+	service := &LinkService{client: newLinkClient(2 * time.Second)}
+
+	for _, link := range []string{
+		server.URL,
+		"http://localhost:8080/admin",
+		"http://10.0.0.5/",
+		"http://192.168.1.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]:8080/",
+		"http://[::ffff:127.0.0.1]/",
+		"http://100.64.0.1/",
+	} {
+		_, err := service.FetchPreview(context.Background(), link)
+		assert.ErrorIs(t, err, ErrBlockedAddress, link)
+	}
+	assert.Zero(t, atomic.LoadInt32(&hits))
+
+	_, err := service.FetchPreview(context.Background(), "file:///etc/passwd")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestNewLinkClient_DialRejectsInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// Bypasses the URL check, as a host name resolving to loopback would
+	resp, err := newLinkClient(2 * time.Second).Get(server.URL)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	assert.ErrorIs(t, err, ErrBlockedAddress)
+}
+
+func TestRenderNoteBlocks_IncludesLinks(t *testing.T) {
+	blocks := []models.Block{{
+		Type:    models.LinkBlock,
+		Content: models.BlockContent(linkBlockContent(LinkPreview{URL: "https://go.dev", Title: "The Go Programming Language", Description: "Build simple, secure systems"})),
+	}}
+
+	assert.Equal(t, "🔗 [The Go Programming Language](https://go.dev)\nBuild simple, secure systems", renderNoteBlocks(blocks, NoteContentStructured))
+	assert.Equal(t, "The Go Programming Language\nhttps://go.dev\nBuild simple, secure systems", renderNoteBlocks(blocks, NoteContentPlain))
+}
+
+func TestBareLink(t *testing.T) {
+	link, ok := bareLink("  https://go.dev/doc  ")
+	assert.True(t, ok)
+	assert.Equal(t, "https://go.dev/doc", link)
+
+	for _, text := range []string{"read https://go.dev", "go.dev", "ftp://example.com/file", "/start"} {
+		_, ok := bareLink(text)
+		assert.False(t, ok, text)
+	}
+}
@@ -0,0 +1,15 @@
+package services
+
+import "gorm.io/gorm"
+
+// pagedList applies the limit and offset params of a list a client pages
+// through, leaving query alone for a whole list. orderBy is added as the
+// last sort key so pages don't overlap when other keys tie.
+func pagedList(query *gorm.DB, params map[string]interface{}, orderBy string) *gorm.DB {
+	limit, ok := params["limit"].(int)
+	if !ok || limit <= 0 {
+		return query
+	}
+	offset, _ := params["offset"].(int)
+	return query.Order(orderBy).Offset(offset).Limit(limit)
+}
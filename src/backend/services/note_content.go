@@ -0,0 +1,143 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"owlistic-notes/owlistic/models"
+)
+
+// NoteContentFormat is how note blocks are rendered to text for AI use
+type NoteContentFormat string
+
+const (
+	// NoteContentStructured keeps the note's shape in lightweight markdown:
+	// # headings, - list items, [ ] tasks and fenced code
+	NoteContentStructured NoteContentFormat = "structured"
+	// NoteContentPlain is the block text only, a line per block
+	NoteContentPlain NoteContentFormat = "plain"
+)
+
+// noteContentFormat is the format set by AI_NOTE_CONTENT_FORMAT, structured
+// by default
+func noteContentFormat() NoteContentFormat {
+	if NoteContentFormat(strings.ToLower(strings.TrimSpace(os.Getenv("AI_NOTE_CONTENT_FORMAT")))) == NoteContentPlain {
+		return NoteContentPlain
+	}
+	return NoteContentStructured
+}
+
+// renderNoteBlocks renders blocks, in order, as text in the format. Empty
+// blocks are skipped.
+func renderNoteBlocks(blocks []models.Block, format NoteContentFormat) string {
+	var builder strings.Builder
+	ordered := 0 // Number of the previous item of an ordered list
+	for i := range blocks {
+		block := &blocks[i]
+		text, _ := block.Content["text"].(string)
+
+		if block.Type == models.LinkBlock {
+			if link := renderLinkBlock(block, format); link != "" {
+				builder.WriteString(link)
+				builder.WriteString("\n")
+			}
+			ordered = 0
+			continue
+		}
+
+		if format == NoteContentPlain {
+			if strings.TrimSpace(text) != "" {
+				builder.WriteString(text)
+				builder.WriteString("\n")
+			}
+			continue
+		}
+
+		if block.Type != models.ListItemBlock || !isOrderedListItem(block) {
+			ordered = 0
+		}
+		if block.Type == models.HorizontalRuleBlock {
+			builder.WriteString("---\n")
+			continue
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		switch block.Type {
+		case models.HeadingBlock:
+			level := block.GetHeadingLevel()
+			if level < 1 || level > 6 {
+				level = 1
+			}
+			builder.WriteString(strings.Repeat("#", level) + " " + text)
+		case models.ListItemBlock:
+			if isOrderedListItem(block) {
+				ordered++
+				builder.WriteString(fmt.Sprintf("%d. %s", ordered, text))
+			} else {
+				builder.WriteString("- " + text)
+			}
+		case models.TaskBlock:
+			if block.IsTaskCompleted() {
+				builder.WriteString("- [x] " + text)
+			} else {
+				builder.WriteString("- [ ] " + text)
+			}
+		case models.CodeBlock:
+			language, _ := block.Metadata["language"].(string)
+			builder.WriteString("```" + language + "\n" + strings.TrimRight(text, "\n") + "\n```")
+		case models.QuoteBlock, models.CalloutBlock:
+			builder.WriteString("> " + strings.ReplaceAll(text, "\n", "\n> "))
+		default:
+			builder.WriteString(text)
+		}
+		builder.WriteString("\n")
+	}
+	return strings.TrimSpace(builder.String())
+}
+
+// renderLinkBlock renders a bookmark with its title, URL and description so
+// all three are searchable
+func renderLinkBlock(block *models.Block, format NoteContentFormat) string {
+	linkURL, _ := block.Content["url"].(string)
+	title, _ := block.Content["title"].(string)
+	description, _ := block.Content["description"].(string)
+	if title == "" {
+		title, _ = block.Content["text"].(string)
+	}
+	if title == "" {
+		title = linkURL
+	}
+	if title == "" {
+		return ""
+	}
+
+	var lines []string
+	switch {
+	case format == NoteContentPlain:
+		lines = append(lines, title)
+		if linkURL != "" && linkURL != title {
+			lines = append(lines, linkURL)
+		}
+	case linkURL != "" && linkURL != title:
+		lines = append(lines, fmt.Sprintf("🔗 [%s](%s)", title, linkURL))
+	default:
+		lines = append(lines, "🔗 "+title)
+	}
+	if strings.TrimSpace(description) != "" {
+		lines = append(lines, description)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isOrderedListItem reports whether a list item is numbered. The editor has
+// stored the list type under both keys.
+func isOrderedListItem(block *models.Block) bool {
+	listType, _ := block.Metadata["listType"].(string)
+	if listType == "" {
+		listType, _ = block.Metadata["item_type"].(string)
+	}
+	return listType == "ordered"
+}
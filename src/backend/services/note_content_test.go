@@ -0,0 +1,48 @@
+package services
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func noteContentBlocks() []models.Block {
+	return []models.Block{
+		{Type: models.HeadingBlock, Content: models.BlockContent{"text": "Setup"}, Metadata: models.BlockMetadata{"level": float64(2)}},
+		{Type: models.TextBlock, Content: models.BlockContent{"text": "Install the tools."}},
+		{Type: models.ListItemBlock, Content: models.BlockContent{"text": "Go"}, Metadata: models.BlockMetadata{"listType": "unordered"}},
+		{Type: models.ListItemBlock, Content: models.BlockContent{"text": "Clone"}, Metadata: models.BlockMetadata{"listType": "ordered"}},
+		{Type: models.ListItemBlock, Content: models.BlockContent{"text": "Build"}, Metadata: models.BlockMetadata{"listType": "ordered"}},
+		{Type: models.TaskBlock, Content: models.BlockContent{"text": "Run tests"}, Metadata: models.BlockMetadata{"is_completed": true}},
+		{Type: models.CodeBlock, Content: models.BlockContent{"text": "go build ./..."}, Metadata: models.BlockMetadata{"language": "sh"}},
+		{Type: models.TextBlock, Content: models.BlockContent{"text": "  "}},
+	}
+}
+
+func TestRenderNoteBlocks_StructuredKeepsHeadingsAndCode(t *testing.T) {
+	content := renderNoteBlocks(noteContentBlocks(), NoteContentStructured)
+
+	assert.Equal(t, "## Setup\n"+
+		"Install the tools.\n"+
+		"- Go\n"+
+		"1. Clone\n"+
+		"2. Build\n"+
+		"- [x] Run tests\n"+
+		"```sh\ngo build ./...\n```", content)
+}
+
+func TestRenderNoteBlocks_PlainIsTextOnly(t *testing.T) {
+	content := renderNoteBlocks(noteContentBlocks(), NoteContentPlain)
+
+	assert.Equal(t, "Setup\nInstall the tools.\nGo\nClone\nBuild\nRun tests\ngo build ./...", content)
+}
+
+func TestNoteContentFormat_FromEnv(t *testing.T) {
+	t.Setenv("AI_NOTE_CONTENT_FORMAT", "")
+	assert.Equal(t, NoteContentStructured, noteContentFormat())
+
+	t.Setenv("AI_NOTE_CONTENT_FORMAT", "plain")
+	assert.Equal(t, NoteContentPlain, noteContentFormat())
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// Block diff statuses
+const (
+	BlockDiffAdded     = "added"
+	BlockDiffRemoved   = "removed"
+	BlockDiffModified  = "modified"
+	BlockDiffUnchanged = "unchanged"
+)
+
+// Text diff operations
+const (
+	TextDiffEqual  = "equal"
+	TextDiffInsert = "insert"
+	TextDiffDelete = "delete"
+)
+
+// maxDiffCells bounds the LCS table of diffSequences. Past it the part
+// between the common prefix and suffix is reported as a whole delete
+// followed by a whole insert.
+const maxDiffCells = 1000000
+
+var diffTokenPattern = regexp.MustCompile(`\s+|[^\s]+`)
+
+// TextDiffOp is one run of a word-level text diff
+type TextDiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// BlockDiff describes how a single block changed between two notes
+type BlockDiff struct {
+	Status         string           `json:"status"`
+	BlockID        *uuid.UUID       `json:"block_id,omitempty"`
+	AgainstBlockID *uuid.UUID       `json:"against_block_id,omitempty"`
+	Type           models.BlockType `json:"type"`
+	OldText        string           `json:"old_text,omitempty"`
+	NewText        string           `json:"new_text,omitempty"`
+	TextDiff       []TextDiffOp     `json:"text_diff,omitempty"`
+}
+
+// NoteDiffSummary counts blocks by diff status
+type NoteDiffSummary struct {
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Modified  int `json:"modified"`
+	Unchanged int `json:"unchanged"`
+}
+
+// NoteDiff is the block-level diff of a note against another note
+type NoteDiff struct {
+	NoteID       uuid.UUID       `json:"note_id"`
+	AgainstID    uuid.UUID       `json:"against_id"`
+	Title        string          `json:"title"`
+	AgainstTitle string          `json:"against_title"`
+	TitleChanged bool            `json:"title_changed"`
+	Blocks       []BlockDiff     `json:"blocks"`
+	Summary      NoteDiffSummary `json:"summary"`
+}
+
+// DiffNoteBlocks compares the blocks of note against those of base. Blocks are
+// aligned on their rendered text; unmatched removals and additions that sit
+// between the same matched blocks are paired up as modifications.
+func DiffNoteBlocks(base, note models.Note) NoteDiff {
+	diff := NoteDiff{
+		NoteID:       note.ID,
+		AgainstID:    base.ID,
+		Title:        note.Title,
+		AgainstTitle: base.Title,
+		TitleChanged: note.Title != base.Title,
+		Blocks:       []BlockDiff{},
+	}
+
+	oldKeys := make([]string, len(base.Blocks))
+	for i, block := range base.Blocks {
+		oldKeys[i] = blockDiffKey(block)
+	}
+	newKeys := make([]string, len(note.Blocks))
+	for i, block := range note.Blocks {
+		newKeys[i] = blockDiffKey(block)
+	}
+
+	var removed, added []models.Block
+	flush := func() {
+		paired := min(len(removed), len(added))
+		for i := 0; i < paired; i++ {
+			diff.Blocks = append(diff.Blocks, modifiedBlockDiff(removed[i], added[i]))
+		}
+		for _, block := range removed[paired:] {
+			diff.Blocks = append(diff.Blocks, removedBlockDiff(block))
+		}
+		for _, block := range added[paired:] {
+			diff.Blocks = append(diff.Blocks, addedBlockDiff(block))
+		}
+		removed, added = nil, nil
+	}
+
+	for _, op := range diffSequences(oldKeys, newKeys) {
+		switch op.op {
+		case TextDiffDelete:
+			removed = append(removed, base.Blocks[op.oldIndex])
+		case TextDiffInsert:
+			added = append(added, note.Blocks[op.newIndex])
+		default:
+			flush()
+			oldBlock, newBlock := base.Blocks[op.oldIndex], note.Blocks[op.newIndex]
+			diff.Blocks = append(diff.Blocks, BlockDiff{
+				Status:         BlockDiffUnchanged,
+				BlockID:        &newBlock.ID,
+				AgainstBlockID: &oldBlock.ID,
+				Type:           newBlock.Type,
+				OldText:        blockDiffText(oldBlock),
+				NewText:        blockDiffText(newBlock),
+			})
+		}
+	}
+	flush()
+
+	for _, block := range diff.Blocks {
+		switch block.Status {
+		case BlockDiffAdded:
+			diff.Summary.Added++
+		case BlockDiffRemoved:
+			diff.Summary.Removed++
+		case BlockDiffModified:
+			diff.Summary.Modified++
+		default:
+			diff.Summary.Unchanged++
+		}
+	}
+
+	return diff
+}
+
+// DiffText returns a word-level diff turning oldText into newText
+func DiffText(oldText, newText string) []TextDiffOp {
+	oldTokens := diffTokenPattern.FindAllString(oldText, -1)
+	newTokens := diffTokenPattern.FindAllString(newText, -1)
+
+	var ops []TextDiffOp
+	for _, op := range diffSequences(oldTokens, newTokens) {
+		text := ""
+		if op.op == TextDiffInsert {
+			text = newTokens[op.newIndex]
+		} else {
+			text = oldTokens[op.oldIndex]
+		}
+		// Merge runs of the same operation
+		if last := len(ops) - 1; last >= 0 && ops[last].Op == op.op {
+			ops[last].Text += text
+			continue
+		}
+		ops = append(ops, TextDiffOp{Op: op.op, Text: text})
+	}
+	return ops
+}
+
+type sequenceOp struct {
+	op       string
+	oldIndex int
+	newIndex int
+}
+
+// diffSequences computes an edit script between two sequences from their
+// longest common subsequence. Deletions are emitted before insertions.
+func diffSequences(oldSeq, newSeq []string) []sequenceOp {
+	// The common prefix and suffix are equal runs and need no table
+	prefix := 0
+	for prefix < len(oldSeq) && prefix < len(newSeq) && oldSeq[prefix] == newSeq[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldSeq)-prefix && suffix < len(newSeq)-prefix &&
+		oldSeq[len(oldSeq)-1-suffix] == newSeq[len(newSeq)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]sequenceOp, 0, len(oldSeq)+len(newSeq)-prefix-suffix)
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, sequenceOp{op: TextDiffEqual, oldIndex: i, newIndex: i})
+	}
+	oldMiddle, newMiddle := oldSeq[prefix:len(oldSeq)-suffix], newSeq[prefix:len(newSeq)-suffix]
+	var middle []sequenceOp
+	if len(oldMiddle)*len(newMiddle) > maxDiffCells {
+		middle = replaceSequence(len(oldMiddle), len(newMiddle))
+	} else {
+		middle = diffSequencesLCS(oldMiddle, newMiddle)
+	}
+	for _, op := range middle {
+		ops = append(ops, sequenceOp{op: op.op, oldIndex: prefix + op.oldIndex, newIndex: prefix + op.newIndex})
+	}
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, sequenceOp{op: TextDiffEqual, oldIndex: len(oldSeq) - suffix + i, newIndex: len(newSeq) - suffix + i})
+	}
+	return ops
+}
+
+// replaceSequence is the edit script deleting all n old items and then
+// inserting all m new ones
+func replaceSequence(n, m int) []sequenceOp {
+	ops := make([]sequenceOp, 0, n+m)
+	for i := 0; i < n; i++ {
+		ops = append(ops, sequenceOp{op: TextDiffDelete, oldIndex: i, newIndex: 0})
+	}
+	for j := 0; j < m; j++ {
+		ops = append(ops, sequenceOp{op: TextDiffInsert, oldIndex: n, newIndex: j})
+	}
+	return ops
+}
+
+// diffSequencesLCS is diffSequences over a full LCS table
+func diffSequencesLCS(oldSeq, newSeq []string) []sequenceOp {
+	n, m := len(oldSeq), len(newSeq)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if oldSeq[i] == newSeq[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]sequenceOp, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case oldSeq[i] == newSeq[j]:
+			ops = append(ops, sequenceOp{op: TextDiffEqual, oldIndex: i, newIndex: j})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, sequenceOp{op: TextDiffDelete, oldIndex: i, newIndex: j})
+			i++
+		default:
+			ops = append(ops, sequenceOp{op: TextDiffInsert, oldIndex: i, newIndex: j})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, sequenceOp{op: TextDiffDelete, oldIndex: i, newIndex: j})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, sequenceOp{op: TextDiffInsert, oldIndex: i, newIndex: j})
+	}
+	return ops
+}
+
+// blockDiffText renders the comparable text of a block
+func blockDiffText(block models.Block) string {
+	text, _ := block.Content["text"].(string)
+	if block.Type == models.TaskBlock {
+		if completed, _ := block.Metadata["is_completed"].(bool); completed {
+			return "[x] " + text
+		}
+		return "[ ] " + text
+	}
+	return text
+}
+
+func blockDiffKey(block models.Block) string {
+	return fmt.Sprintf("%s\x00%s", block.Type, blockDiffText(block))
+}
+
+func addedBlockDiff(block models.Block) BlockDiff {
+	text := blockDiffText(block)
+	return BlockDiff{
+		Status:   BlockDiffAdded,
+		BlockID:  &block.ID,
+		Type:     block.Type,
+		NewText:  text,
+		TextDiff: DiffText("", text),
+	}
+}
+
+func removedBlockDiff(block models.Block) BlockDiff {
+	text := blockDiffText(block)
+	return BlockDiff{
+		Status:         BlockDiffRemoved,
+		AgainstBlockID: &block.ID,
+		Type:           block.Type,
+		OldText:        text,
+		TextDiff:       DiffText(text, ""),
+	}
+}
+
+func modifiedBlockDiff(oldBlock, newBlock models.Block) BlockDiff {
+	oldText, newText := blockDiffText(oldBlock), blockDiffText(newBlock)
+	return BlockDiff{
+		Status:         BlockDiffModified,
+		BlockID:        &newBlock.ID,
+		AgainstBlockID: &oldBlock.ID,
+		Type:           newBlock.Type,
+		OldText:        oldText,
+		NewText:        newText,
+		TextDiff:       DiffText(oldText, newText),
+	}
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func diffTestBlock(text string) models.Block {
+	return models.Block{
+		ID:      uuid.New(),
+		Type:    models.TextBlock,
+		Content: models.BlockContent{"text": text},
+	}
+}
+
+func diffTestNote(blocks ...models.Block) models.Note {
+	return models.Note{ID: uuid.New(), Title: "Note", Blocks: blocks}
+}
+
+func TestDiffNoteBlocks_Added(t *testing.T) {
+	first, second := diffTestBlock("First"), diffTestBlock("Second")
+	base := diffTestNote(first)
+	note := diffTestNote(diffTestBlock("First"), second)
+
+	diff := DiffNoteBlocks(base, note)
+
+	require.Len(t, diff.Blocks, 2)
+	assert.Equal(t, BlockDiffUnchanged, diff.Blocks[0].Status)
+	assert.Equal(t, BlockDiffAdded, diff.Blocks[1].Status)
+	assert.Equal(t, second.ID, *diff.Blocks[1].BlockID)
+	assert.Nil(t, diff.Blocks[1].AgainstBlockID)
+	assert.Equal(t, []TextDiffOp{{Op: TextDiffInsert, Text: "Second"}}, diff.Blocks[1].TextDiff)
+	assert.Equal(t, NoteDiffSummary{Added: 1, Unchanged: 1}, diff.Summary)
+}
+
+func TestDiffNoteBlocks_Removed(t *testing.T) {
+	removed := diffTestBlock("Gone")
+	base := diffTestNote(diffTestBlock("Keep"), removed, diffTestBlock("Tail"))
+	note := diffTestNote(diffTestBlock("Keep"), diffTestBlock("Tail"))
+
+	diff := DiffNoteBlocks(base, note)
+
+	require.Len(t, diff.Blocks, 3)
+	assert.Equal(t, BlockDiffRemoved, diff.Blocks[1].Status)
+	assert.Equal(t, removed.ID, *diff.Blocks[1].AgainstBlockID)
+	assert.Nil(t, diff.Blocks[1].BlockID)
+	assert.Equal(t, "Gone", diff.Blocks[1].OldText)
+	assert.Equal(t, NoteDiffSummary{Removed: 1, Unchanged: 2}, diff.Summary)
+}
+
+func TestDiffNoteBlocks_Modified(t *testing.T) {
+	oldBlock, newBlock := diffTestBlock("Buy milk today"), diffTestBlock("Buy oat milk tomorrow")
+	base := diffTestNote(diffTestBlock("Groceries"), oldBlock)
+	note := diffTestNote(diffTestBlock("Groceries"), newBlock)
+
+	diff := DiffNoteBlocks(base, note)
+
+	require.Len(t, diff.Blocks, 2)
+	modified := diff.Blocks[1]
+	assert.Equal(t, BlockDiffModified, modified.Status)
+	assert.Equal(t, newBlock.ID, *modified.BlockID)
+	assert.Equal(t, oldBlock.ID, *modified.AgainstBlockID)
+	assert.Equal(t, []TextDiffOp{
+		{Op: TextDiffEqual, Text: "Buy "},
+		{Op: TextDiffInsert, Text: "oat "},
+		{Op: TextDiffEqual, Text: "milk "},
+		{Op: TextDiffDelete, Text: "today"},
+		{Op: TextDiffInsert, Text: "tomorrow"},
+	}, modified.TextDiff)
+	assert.Equal(t, NoteDiffSummary{Modified: 1, Unchanged: 1}, diff.Summary)
+}
+
+func TestDiffNoteBlocks_TaskCompletionIsModification(t *testing.T) {
+	oldTask := models.Block{ID: uuid.New(), Type: models.TaskBlock, Content: models.BlockContent{"text": "Ship it"}}
+	newTask := models.Block{
+		ID:       uuid.New(),
+		Type:     models.TaskBlock,
+		Content:  models.BlockContent{"text": "Ship it"},
+		Metadata: models.BlockMetadata{"is_completed": true},
+	}
+
+	diff := DiffNoteBlocks(diffTestNote(oldTask), diffTestNote(newTask))
+
+	require.Len(t, diff.Blocks, 1)
+	assert.Equal(t, BlockDiffModified, diff.Blocks[0].Status)
+	assert.Equal(t, "[ ] Ship it", diff.Blocks[0].OldText)
+	assert.Equal(t, "[x] Ship it", diff.Blocks[0].NewText)
+}
+
+func TestDiffText_Identical(t *testing.T) {
+	assert.Equal(t, []TextDiffOp{{Op: TextDiffEqual, Text: "same text"}}, DiffText("same text", "same text"))
+	assert.Nil(t, DiffText("", ""))
+}
+
+func TestDiffNoteBlocks_LongNotesSkipTheLCSTable(t *testing.T) {
+	// 1500 changed blocks on each side would need a 2.25M cell table
+	var oldBlocks, newBlocks []models.Block
+	oldBlocks = append(oldBlocks, diffTestBlock("Heading"))
+	newBlocks = append(newBlocks, diffTestBlock("Heading"))
+	for i := 0; i < 1500; i++ {
+		oldBlocks = append(oldBlocks, diffTestBlock(fmt.Sprintf("old line %d", i)))
+		newBlocks = append(newBlocks, diffTestBlock(fmt.Sprintf("new line %d", i)))
+	}
+	oldBlocks = append(oldBlocks, diffTestBlock("Footer"))
+	newBlocks = append(newBlocks, diffTestBlock("Footer"))
+
+	diff := DiffNoteBlocks(diffTestNote(oldBlocks...), diffTestNote(newBlocks...))
+
+	// The common ends still line up around the replaced middle
+	require.Len(t, diff.Blocks, 1502)
+	assert.Equal(t, BlockDiffUnchanged, diff.Blocks[0].Status)
+	assert.Equal(t, BlockDiffUnchanged, diff.Blocks[1501].Status)
+	assert.Equal(t, NoteDiffSummary{Modified: 1500, Unchanged: 2}, diff.Summary)
+}
+
+func TestDiffText_LongTextKeepsCommonEnds(t *testing.T) {
+	oldMiddle := strings.Repeat("a ", 1200)
+	newMiddle := strings.Repeat("b ", 1200)
+
+	ops := DiffText("start "+oldMiddle+"end", "start "+newMiddle+"end")
+
+	// Both middles end in a space, which joins the common suffix
+	assert.Equal(t, []TextDiffOp{
+		{Op: TextDiffEqual, Text: "start "},
+		{Op: TextDiffDelete, Text: strings.TrimSuffix(oldMiddle, " ")},
+		{Op: TextDiffInsert, Text: strings.TrimSuffix(newMiddle, " ")},
+		{Op: TextDiffEqual, Text: " end"},
+	}, ops)
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"owlistic-notes/owlistic/models"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	markdownHeadingPattern  = regexp.MustCompile(`^(#{1,6}) (.*)$`)
+	markdownTaskPattern     = regexp.MustCompile(`^- \[([ xX])\] (.*)$`)
+	markdownOrderedPattern  = regexp.MustCompile(`^\d+\. (.*)$`)
+	markdownLinkPattern     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	markdownStrongPattern   = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	markdownEmphasisPattern = regexp.MustCompile(`\*([^*]+)\*`)
+	codeLanguagePattern     = regexp.MustCompile(`^[A-Za-z0-9_+-]+$`)
+)
+
+// allowedHTMLElements are the elements kept in sanitized HTML, the ones
+// note Markdown renders to. Any other element is replaced by its content.
+var allowedHTMLElements = map[atom.Atom]bool{
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.P: true, atom.Br: true, atom.Hr: true, atom.Blockquote: true, atom.Pre: true, atom.Code: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true,
+	atom.A: true, atom.Em: true, atom.Strong: true, atom.B: true, atom.I: true, atom.Del: true, atom.S: true,
+}
+
+// droppedHTMLElements are removed from sanitized HTML with their content
+var droppedHTMLElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Frame: true, atom.Frameset: true,
+	atom.Object: true, atom.Embed: true, atom.Noscript: true, atom.Template: true, atom.Title: true,
+	atom.Textarea: true, atom.Select: true, atom.Svg: true, atom.Math: true,
+}
+
+// RenderNoteMarkdown renders a note as Markdown: its title as a heading,
+// then its blocks as they are rendered for AI use
+func RenderNoteMarkdown(note models.Note) string {
+	content := renderNoteBlocks(note.Blocks, NoteContentStructured)
+	title := strings.TrimSpace(note.Title)
+	if title == "" {
+		return content
+	}
+	return strings.TrimSpace("# " + title + "\n\n" + content)
+}
+
+// RenderNoteHTML renders a note as a standalone HTML page. Its Markdown is
+// converted to HTML and then sanitized against an allow-list, so markup in
+// a note, typed by the user or written by the AI, cannot run scripts.
+func RenderNoteHTML(note models.Note) string {
+	body := sanitizeHTML(markdownToHTML(RenderNoteMarkdown(note)))
+	return "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>" +
+		html.EscapeString(note.Title) + "</title>\n</head>\n<body>\n<article>\n" +
+		body + "</article>\n</body>\n</html>\n"
+}
+
+// markdownToHTML converts the Markdown renderNoteBlocks writes to HTML.
+// As in Markdown, HTML in the text is passed through: the result has to be
+// sanitized before it is served.
+func markdownToHTML(markdown string) string {
+	var out strings.Builder
+	var paragraph, quote []string
+	list := "" // Tag of the list being written, if any
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>\n") + "</p>\n")
+			paragraph = nil
+		}
+	}
+	flushQuote := func() {
+		if len(quote) > 0 {
+			out.WriteString("<blockquote><p>" + strings.Join(quote, "<br>\n") + "</p></blockquote>\n")
+			quote = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			out.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(tag string) {
+		flushParagraph()
+		flushQuote()
+		if list != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			list = tag
+		}
+	}
+	flush := func() {
+		flushParagraph()
+		flushQuote()
+		closeList()
+	}
+
+	lines := strings.Split(markdown, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(line, "```"):
+			flush()
+			var code []string
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != "```"; i++ {
+				code = append(code, lines[i])
+			}
+			class := ""
+			if language := strings.TrimSpace(line[3:]); codeLanguagePattern.MatchString(language) {
+				class = ` class="language-` + language + `"`
+			}
+			out.WriteString("<pre><code" + class + ">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case line == "":
+			flush()
+		case line == "---":
+			flush()
+			out.WriteString("<hr>\n")
+		case markdownHeadingPattern.MatchString(line):
+			flush()
+			match := markdownHeadingPattern.FindStringSubmatch(line)
+			tag := "h" + string(rune('0'+len(match[1])))
+			out.WriteString("<" + tag + ">" + markdownInline(match[2]) + "</" + tag + ">\n")
+		case strings.HasPrefix(line, ">"):
+			flushParagraph()
+			closeList()
+			quote = append(quote, markdownInline(strings.TrimSpace(strings.TrimPrefix(line, ">"))))
+		case markdownTaskPattern.MatchString(line):
+			openList("ul")
+			match := markdownTaskPattern.FindStringSubmatch(line)
+			box := "☐"
+			if match[1] != " " {
+				box = "☑"
+			}
+			out.WriteString("<li>" + box + " " + markdownInline(match[2]) + "</li>\n")
+		case strings.HasPrefix(line, "- "), strings.HasPrefix(line, "* "):
+			openList("ul")
+			out.WriteString("<li>" + markdownInline(line[2:]) + "</li>\n")
+		case markdownOrderedPattern.MatchString(line):
+			openList("ol")
+			out.WriteString("<li>" + markdownInline(markdownOrderedPattern.FindStringSubmatch(line)[1]) + "</li>\n")
+		default:
+			flushQuote()
+			closeList()
+			paragraph = append(paragraph, markdownInline(line))
+		}
+	}
+	flush()
+	return out.String()
+}
+
+// markdownInline converts code spans, links, bold and italics in a line
+func markdownInline(text string) string {
+	parts := strings.Split(text, "`")
+	if len(parts)%2 == 0 {
+		// The last backtick has no match: it is text
+		parts[len(parts)-2] += "`" + parts[len(parts)-1]
+		parts = parts[:len(parts)-1]
+	}
+
+	var out strings.Builder
+	for i, part := range parts {
+		if i%2 == 1 {
+			out.WriteString("<code>" + html.EscapeString(part) + "</code>")
+			continue
+		}
+		part = markdownLinkPattern.ReplaceAllStringFunc(part, func(link string) string {
+			match := markdownLinkPattern.FindStringSubmatch(link)
+			return `<a href="` + html.EscapeString(match[2]) + `">` + match[1] + "</a>"
+		})
+		part = markdownStrongPattern.ReplaceAllString(part, "<strong>$1</strong>")
+		part = markdownEmphasisPattern.ReplaceAllString(part, "<em>$1</em>")
+		out.WriteString(part)
+	}
+	return out.String()
+}
+
+// sanitizeHTML keeps only allow-listed elements and attributes of an HTML
+// fragment. Scripts and other active content are removed with what they
+// contain, event handler attributes are dropped and links are kept only
+// for http, https and mailto URLs.
+func sanitizeHTML(fragment string) string {
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return html.EscapeString(fragment)
+	}
+
+	var out strings.Builder
+	for _, node := range nodes {
+		writeSanitizedNode(&out, node)
+	}
+	return out.String()
+}
+
+func writeSanitizedNode(out *strings.Builder, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		out.WriteString(html.EscapeString(node.Data))
+		return
+	case html.ElementNode:
+	default:
+		// Comments and doctypes are dropped
+		return
+	}
+
+	if droppedHTMLElements[node.DataAtom] {
+		return
+	}
+	allowed := allowedHTMLElements[node.DataAtom]
+	if allowed {
+		out.WriteString("<" + node.Data + sanitizedAttributes(node) + ">")
+		if node.DataAtom == atom.Br || node.DataAtom == atom.Hr {
+			return
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeSanitizedNode(out, child)
+	}
+	if allowed {
+		out.WriteString("</" + node.Data + ">")
+	}
+}
+
+// sanitizedAttributes writes the allowed attributes of an element
+func sanitizedAttributes(node *html.Node) string {
+	var attributes strings.Builder
+	for _, attribute := range node.Attr {
+		if attribute.Namespace != "" {
+			continue
+		}
+		keep := false
+		switch {
+		case node.DataAtom == atom.A && attribute.Key == "href":
+			keep = isSafeLinkURL(attribute.Val)
+		case node.DataAtom == atom.A && attribute.Key == "title":
+			keep = true
+		case node.DataAtom == atom.Code && attribute.Key == "class":
+			keep = strings.HasPrefix(attribute.Val, "language-") &&
+				codeLanguagePattern.MatchString(strings.TrimPrefix(attribute.Val, "language-"))
+		}
+		if keep {
+			attributes.WriteString(" " + attribute.Key + `="` + html.EscapeString(attribute.Val) + `"`)
+		}
+	}
+	if node.DataAtom == atom.A {
+		attributes.WriteString(` rel="nofollow noopener noreferrer"`)
+	}
+	return attributes.String()
+}
+
+// isSafeLinkURL reports whether a link URL is relative or http, https or
+// mailto; javascript: and data: URLs are not
+func isSafeLinkURL(raw string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
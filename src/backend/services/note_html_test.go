@@ -0,0 +1,66 @@
+package services
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderNoteMarkdown_TitleThenBlocks(t *testing.T) {
+	markdown := RenderNoteMarkdown(models.Note{Title: "Build notes", Blocks: noteContentBlocks()})
+
+	assert.Equal(t, "# Build notes\n\n"+renderNoteBlocks(noteContentBlocks(), NoteContentStructured), markdown)
+}
+
+func TestRenderNoteHTML_ConvertsMarkdown(t *testing.T) {
+	page := RenderNoteHTML(models.Note{Title: "Build notes", Blocks: append(noteContentBlocks(),
+		models.Block{Type: models.QuoteBlock, Content: models.BlockContent{"text": "Read the **docs**"}},
+		models.Block{Type: models.LinkBlock, Content: models.BlockContent{"url": "https://go.dev", "title": "Go"}},
+	)})
+
+	assert.Contains(t, page, "<title>Build notes</title>")
+	assert.Contains(t, page, "<h1>Build notes</h1>")
+	assert.Contains(t, page, "<h2>Setup</h2>")
+	assert.Contains(t, page, "<p>Install the tools.</p>")
+	assert.Contains(t, page, "<ul>\n<li>Go</li>\n</ul>")
+	assert.Contains(t, page, "<ol>\n<li>Clone</li>\n<li>Build</li>\n</ol>")
+	assert.Contains(t, page, "<li>☑ Run tests</li>")
+	assert.Contains(t, page, `<pre><code class="language-sh">go build ./...</code></pre>`)
+	assert.Contains(t, page, "<blockquote><p>Read the <strong>docs</strong></p></blockquote>")
+	assert.Contains(t, page, `🔗 <a href="https://go.dev" rel="nofollow noopener noreferrer">Go</a>`)
+}
+
+func TestRenderNoteHTML_StripsScripts(t *testing.T) {
+	page := RenderNoteHTML(models.Note{Title: "<script>alert('title')</script>", Blocks: []models.Block{
+		{Type: models.TextBlock, Content: models.BlockContent{"text": "Hello <script>alert('xss')</script>world"}},
+		{Type: models.TextBlock, Content: models.BlockContent{"text": `<img src=x onerror="alert(1)"><b onclick="alert(2)">bold</b>`}},
+		{Type: models.TextBlock, Content: models.BlockContent{"text": "[click](javascript:alert(3)) <a href=\"jav&#x61;script:alert(4)\">me</a>"}},
+		{Type: models.TextBlock, Content: models.BlockContent{"text": "<iframe src=\"https://evil.example\"></iframe><style>body{}</style>"}},
+		{Type: models.CodeBlock, Content: models.BlockContent{"text": "<script>kept as code</script>"}},
+	}})
+
+	assert.NotContains(t, page, "<script")
+	assert.NotContains(t, page, "alert('xss')")
+	assert.NotContains(t, page, "onerror")
+	assert.NotContains(t, page, "onclick")
+	assert.NotContains(t, page, "javascript:")
+	assert.NotContains(t, page, "<iframe")
+	assert.NotContains(t, page, "<style")
+	assert.NotContains(t, page, "<img")
+	assert.Contains(t, page, "<title>&lt;script&gt;alert(&#39;title&#39;)&lt;/script&gt;</title>")
+	assert.Contains(t, page, "Hello world")
+	assert.Contains(t, page, "<b>bold</b>")
+	assert.Contains(t, page, `<a rel="nofollow noopener noreferrer">click</a>`)
+	assert.Contains(t, page, "<code>&lt;script&gt;kept as code&lt;/script&gt;</code>")
+}
+
+func TestIsSafeLinkURL(t *testing.T) {
+	for _, link := range []string{"https://example.com", "http://example.com", "mailto:me@example.com", "/notes/1", "#top"} {
+		assert.True(t, isSafeLinkURL(link), link)
+	}
+	for _, link := range []string{"javascript:alert(1)", " JavaScript:alert(1)", "data:text/html,<script>", "vbscript:x", "java\tscript:alert(1)"} {
+		assert.False(t, isSafeLinkURL(link), link)
+	}
+}
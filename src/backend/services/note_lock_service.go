@@ -0,0 +1,239 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DefaultNoteLockTTL is used when a client doesn't ask for a lock duration
+	DefaultNoteLockTTL = 60 * time.Second
+	// MaxNoteLockTTL bounds how long a single lock request can hold a note
+	MaxNoteLockTTL = 10 * time.Minute
+)
+
+type NoteLockServiceInterface interface {
+	AcquireLock(db *database.Database, noteID string, params map[string]interface{}) (models.NoteLock, error)
+	ReleaseLock(db *database.Database, noteID string, params map[string]interface{}) error
+	GetLock(db *database.Database, noteID string, params map[string]interface{}) (models.NoteLock, error)
+	ReleaseClientLocks(db *database.Database, clientID string) error
+}
+
+type NoteLockService struct{}
+
+var NoteLockServiceInstance NoteLockServiceInterface = NewNoteLockService()
+
+func NewNoteLockService() NoteLockServiceInterface {
+	return &NoteLockService{}
+}
+
+// AcquireLock takes or refreshes the editing lock on a note. params must hold
+// user_id and may hold ttl_seconds and client_id.
+func (s *NoteLockService) AcquireLock(db *database.Database, noteID string, params map[string]interface{}) (models.NoteLock, error) {
+	userID, ok := params["user_id"].(string)
+	if !ok {
+		return models.NoteLock{}, errors.New("user_id must be provided in parameters")
+	}
+	noteUUID, err := uuid.Parse(noteID)
+	if err != nil {
+		return models.NoteLock{}, fmt.Errorf("%w: invalid note id", ErrInvalidInput)
+	}
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return models.NoteLock{}, fmt.Errorf("%w: invalid user id", ErrInvalidInput)
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userID, noteID, "editor")
+	if err != nil {
+		return models.NoteLock{}, err
+	}
+	if !hasAccess {
+		return models.NoteLock{}, errors.New("not authorized to lock this note")
+	}
+
+	ttl, err := noteLockTTL(params["ttl_seconds"])
+	if err != nil {
+		return models.NoteLock{}, err
+	}
+	clientID, _ := params["client_id"].(string)
+
+	// Two first acquires can both find the note unlocked; the one whose
+	// insert loses takes the update path on the next attempt
+	for attempt := 1; ; attempt++ {
+		now := time.Now()
+		lock, err := tryAcquireLock(db, models.NoteLock{
+			NoteID:    noteUUID,
+			UserID:    userUUID,
+			ClientID:  clientID,
+			ExpiresAt: now.Add(ttl),
+			UpdatedAt: now,
+		}, now)
+		if errors.Is(err, errNoteLockRaced) && attempt < 3 {
+			continue
+		}
+		return lock, err
+	}
+}
+
+// errNoteLockRaced means another request created the lock row first
+var errNoteLockRaced = errors.New("note lock was created concurrently")
+
+// tryAcquireLock takes or refreshes lock in one transaction
+func tryAcquireLock(db *database.Database, lock models.NoteLock, now time.Time) (models.NoteLock, error) {
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return models.NoteLock{}, tx.Error
+	}
+
+	var existing models.NoteLock
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("note_id = ?", lock.NoteID).First(&existing).Error
+	switch {
+	case err == nil:
+		if existing.Active(now) && existing.UserID != lock.UserID {
+			tx.Rollback()
+			return existing, ErrNoteLocked
+		}
+		if err := tx.Model(&existing).Updates(map[string]interface{}{
+			"user_id":    lock.UserID,
+			"client_id":  lock.ClientID,
+			"expires_at": lock.ExpiresAt,
+			"updated_at": lock.UpdatedAt,
+		}).Error; err != nil {
+			tx.Rollback()
+			return models.NoteLock{}, err
+		}
+		lock.CreatedAt = existing.CreatedAt
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		lock.CreatedAt = now
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&lock)
+		if created.Error != nil {
+			tx.Rollback()
+			return models.NoteLock{}, created.Error
+		}
+		if created.RowsAffected == 0 {
+			tx.Rollback()
+			return models.NoteLock{}, errNoteLockRaced
+		}
+	default:
+		tx.Rollback()
+		return models.NoteLock{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.NoteLock{}, err
+	}
+	return lock, nil
+}
+
+// ReleaseLock drops the caller's lock on a note
+func (s *NoteLockService) ReleaseLock(db *database.Database, noteID string, params map[string]interface{}) error {
+	userID, ok := params["user_id"].(string)
+	if !ok {
+		return errors.New("user_id must be provided in parameters")
+	}
+	if _, err := uuid.Parse(noteID); err != nil {
+		return fmt.Errorf("%w: invalid note id", ErrInvalidInput)
+	}
+
+	result := db.DB.Where("note_id = ? AND user_id = ?", noteID, userID).Delete(&models.NoteLock{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Nothing to release, or the lock belongs to someone else
+		var lock models.NoteLock
+		if err := db.DB.Where("note_id = ?", noteID).First(&lock).Error; err == nil && lock.Active(time.Now()) {
+			return ErrNoteLocked
+		}
+	}
+	return nil
+}
+
+// GetLock returns the active lock on a note, or ErrNotFound
+func (s *NoteLockService) GetLock(db *database.Database, noteID string, params map[string]interface{}) (models.NoteLock, error) {
+	userID, ok := params["user_id"].(string)
+	if !ok {
+		return models.NoteLock{}, errors.New("user_id must be provided in parameters")
+	}
+	if _, err := uuid.Parse(noteID); err != nil {
+		return models.NoteLock{}, fmt.Errorf("%w: invalid note id", ErrInvalidInput)
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userID, noteID, "viewer")
+	if err != nil {
+		return models.NoteLock{}, err
+	}
+	if !hasAccess {
+		return models.NoteLock{}, errors.New("not authorized to access this note")
+	}
+
+	var lock models.NoteLock
+	if err := db.DB.Where("note_id = ? AND expires_at > ?", noteID, time.Now()).First(&lock).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.NoteLock{}, ErrNotFound
+		}
+		return models.NoteLock{}, err
+	}
+	return lock, nil
+}
+
+// ReleaseClientLocks drops every lock held by a WebSocket connection
+func (s *NoteLockService) ReleaseClientLocks(db *database.Database, clientID string) error {
+	if clientID == "" {
+		return nil
+	}
+	return db.DB.Where("client_id = ?", clientID).Delete(&models.NoteLock{}).Error
+}
+
+// NoteLockedUntil returns the expiry of the active lock on a note, or nil
+// when the note is free. Lookup errors are logged and treated as unlocked so
+// background work isn't blocked by a broken lock table.
+func NoteLockedUntil(db *gorm.DB, noteID uuid.UUID) *time.Time {
+	var lock models.NoteLock
+	err := db.Where("note_id = ? AND expires_at > ?", noteID, time.Now()).Limit(1).Find(&lock).Error
+	if err != nil {
+		log.Printf("Failed to check lock for note %s: %v", noteID, err)
+		return nil
+	}
+	if lock.NoteID == uuid.Nil {
+		return nil
+	}
+	return &lock.ExpiresAt
+}
+
+// IsNoteLocked reports whether a note currently has an active editing lock
+func IsNoteLocked(db *gorm.DB, noteID uuid.UUID) bool {
+	return NoteLockedUntil(db, noteID) != nil
+}
+
+// noteLockTTL converts a requested TTL in seconds to a clamped duration
+func noteLockTTL(value interface{}) (time.Duration, error) {
+	var seconds float64
+	switch v := value.(type) {
+	case nil:
+		return DefaultNoteLockTTL, nil
+	case int:
+		seconds = float64(v)
+	case float64:
+		seconds = v
+	default:
+		return 0, fmt.Errorf("%w: ttl_seconds must be a number", ErrInvalidInput)
+	}
+	if seconds <= 0 {
+		return DefaultNoteLockTTL, nil
+	}
+	ttl := time.Duration(seconds * float64(time.Second))
+	if ttl > MaxNoteLockTTL {
+		ttl = MaxNoteLockTTL
+	}
+	return ttl, nil
+}
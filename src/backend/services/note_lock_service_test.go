@@ -0,0 +1,102 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyGeneratedTitle_SkippedWhileLocked(t *testing.T) {
+	db, mock, closeDB := testutils.SetupMockDB()
+	defer closeDB()
+
+	note := models.Note{ID: uuid.New()}
+	mock.ExpectQuery(`SELECT \* FROM "note_locks" WHERE note_id = \$1 AND expires_at > \$2 LIMIT \$3`).
+		WithArgs(note.ID, sqlmock.AnyArg(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"note_id", "user_id", "expires_at"}).
+			AddRow(note.ID, uuid.New(), time.Now().Add(time.Minute)))
+
+	ai := &AIService{db: db.DB}
+	applied := ai.applyGeneratedTitle(&note, "Generated title")
+
+	assert.False(t, applied)
+	assert.Empty(t, note.Title)
+	// No UPDATE may be issued for a locked note
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyGeneratedTitle_UpdatesUnlockedNote(t *testing.T) {
+	db, mock, closeDB := testutils.SetupMockDB()
+	defer closeDB()
+
+	note := models.Note{ID: uuid.New()}
+	mock.ExpectQuery(`SELECT \* FROM "note_locks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"note_id", "user_id", "expires_at"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "notes" SET "title"=\$1,"updated_at"=\$2 WHERE \(id = \$3 AND title = ''\) AND "notes"."deleted_at" IS NULL`).
+		WithArgs("Generated title", sqlmock.AnyArg(), note.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ai := &AIService{db: db.DB}
+	applied := ai.applyGeneratedTitle(&note, "Generated title")
+
+	assert.True(t, applied)
+	assert.Equal(t, "Generated title", note.Title)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNoteLockTTL(t *testing.T) {
+	ttl, err := noteLockTTL(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultNoteLockTTL, ttl)
+
+	ttl, err = noteLockTTL(float64(30))
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, ttl)
+
+	ttl, err = noteLockTTL(3600)
+	assert.NoError(t, err)
+	assert.Equal(t, MaxNoteLockTTL, ttl)
+
+	_, err = noteLockTTL("soon")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestNoteLock_Active(t *testing.T) {
+	now := time.Now()
+	assert.True(t, models.NoteLock{ExpiresAt: now.Add(time.Second)}.Active(now))
+	assert.False(t, models.NoteLock{ExpiresAt: now.Add(-time.Second)}.Active(now))
+}
+
+func TestAcquireLock_LosingTheFirstInsertSeesTheWinner(t *testing.T) {
+	db, mock, closeDB := testutils.SetupMockDB()
+	defer closeDB()
+	withAllowAllRoles(t)
+
+	noteID, userID, otherUserID := uuid.New(), uuid.New(), uuid.New()
+	lockColumns := []string{"note_id", "user_id", "expires_at"}
+
+	// Both requests find no lock, the other one inserts first
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "note_locks" WHERE note_id = \$1 .*FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows(lockColumns))
+	mock.ExpectQuery(`INSERT INTO "note_locks" .* ON CONFLICT DO NOTHING`).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "note_locks" WHERE note_id = \$1 .*FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows(lockColumns).AddRow(noteID, otherUserID, time.Now().Add(time.Minute)))
+	mock.ExpectRollback()
+
+	lock, err := (&NoteLockService{}).AcquireLock(db, noteID.String(), map[string]interface{}{"user_id": userID.String()})
+	assert.ErrorIs(t, err, ErrNoteLocked)
+	assert.Equal(t, otherUserID, lock.UserID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
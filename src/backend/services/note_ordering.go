@@ -0,0 +1,234 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// notePositionGap is the spacing between notes appended or rebalanced in a
+	// notebook, the same room blocks get for later inserts
+	notePositionGap = 1000.0
+	// minNotePositionGap is the smallest gap a note is inserted into before
+	// the notebook is rebalanced, well above float64 precision at these magnitudes
+	minNotePositionGap = 1e-6
+
+	// NewNotePositionPreference is the user preference that places new notes
+	// at the "top" (default) or "bottom" of their notebook
+	NewNotePositionPreference = "new_note_position"
+)
+
+// notePosition is the ordering state of a note within its notebook
+type notePosition struct {
+	ID       uuid.UUID
+	Position float64
+}
+
+// orderedNotebookNotes loads the positions of the live notes in a notebook in
+// display order. Notes created before positions existed all sit at 0 and
+// fall back to newest first.
+func orderedNotebookNotes(tx *gorm.DB, notebookID uuid.UUID) ([]notePosition, error) {
+	var positions []notePosition
+	err := tx.Model(&models.Note{}).
+		Select("id", "position").
+		Where("notebook_id = ?", notebookID).
+		Order("position ASC, created_at DESC").
+		Scan(&positions).Error
+	return positions, err
+}
+
+// newNotePosition returns the position of a note added to a notebook, at
+// the top or bottom depending on the user's preference
+func newNotePosition(tx *gorm.DB, userID, notebookID uuid.UUID) (float64, error) {
+	var placement string
+	err := tx.Model(&models.User{}).
+		Where("id = ?", userID).
+		Select("COALESCE(preferences->>?, '')", NewNotePositionPreference).
+		Row().Scan(&placement)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	aggregate := "MIN(position) - ?"
+	if placement == "bottom" {
+		aggregate = "MAX(position) + ?"
+	}
+	var position float64
+	err = tx.Model(&models.Note{}).
+		Where("notebook_id = ?", notebookID).
+		Select("COALESCE("+aggregate+", 0)", notePositionGap).
+		Row().Scan(&position)
+	return position, err
+}
+
+// ReorderNotes moves a note right after after_note_id in its notebook, or to
+// the top when after_note_id is empty. The note gets the midpoint between its
+// new neighbours; when they are too close for that, all notes of the notebook
+// are spread out again. Returns the notebook's notes in their new order.
+func (s *NotebookService) ReorderNotes(db *database.Database, notebookID string, reorderData map[string]interface{}, params map[string]interface{}) ([]models.Note, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return nil, errors.New("user_id must be provided in parameters")
+	}
+
+	notebookUUID, err := uuid.Parse(notebookID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid notebook id", ErrInvalidInput)
+	}
+	noteIDStr, _ := reorderData["note_id"].(string)
+	noteID, err := uuid.Parse(noteIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: note_id must be a valid UUID", ErrInvalidInput)
+	}
+	afterID := uuid.Nil
+	if afterStr, _ := reorderData["after_note_id"].(string); afterStr != "" {
+		if afterID, err = uuid.Parse(afterStr); err != nil {
+			return nil, fmt.Errorf("%w: after_note_id must be a valid UUID", ErrInvalidInput)
+		}
+		if afterID == noteID {
+			return nil, fmt.Errorf("%w: a note can't be moved after itself", ErrInvalidInput)
+		}
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNotebookAccess(db, userIDStr, notebookID, "editor")
+	if err != nil {
+		return nil, err
+	}
+	if !hasAccess {
+		return nil, errors.New("not authorized to reorder notes in this notebook")
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	positions, err := orderedNotebookNotes(tx, notebookUUID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Take the note out of the list, then find where it goes back in
+	others := make([]notePosition, 0, len(positions))
+	found := false
+	for _, p := range positions {
+		if p.ID == noteID {
+			found = true
+			continue
+		}
+		others = append(others, p)
+	}
+	if !found {
+		tx.Rollback()
+		return nil, ErrNoteNotFound
+	}
+	index := 0
+	if afterID != uuid.Nil {
+		index = -1
+		for i, p := range others {
+			if p.ID == afterID {
+				index = i + 1
+				break
+			}
+		}
+		if index < 0 {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: after_note_id is not in this notebook", ErrNoteNotFound)
+		}
+	}
+
+	if position, ok := positionBetween(others, index); ok {
+		err = tx.Model(&models.Note{}).Where("id = ?", noteID).UpdateColumn("position", position).Error
+	} else {
+		err = rebalanceNotePositions(tx, others, index, noteID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	event, err := models.NewEvent(
+		string(broker.NoteUpdated),
+		"note",
+		map[string]interface{}{
+			"note_id":     noteID.String(),
+			"notebook_id": notebookID,
+			"user_id":     userIDStr,
+			"reordered":   true,
+		},
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Create(event).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	var notes []models.Note
+	if err := db.DB.Where("notebook_id = ?", notebookUUID).
+		Order("position ASC, created_at DESC").
+		Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// positionBetween returns the position for a note inserted at index of the
+// ordered others, or false when its neighbours leave no usable gap
+func positionBetween(others []notePosition, index int) (float64, bool) {
+	switch {
+	case len(others) == 0:
+		return 0, true
+	case index == 0:
+		return others[0].Position - notePositionGap, true
+	case index == len(others):
+		return others[len(others)-1].Position + notePositionGap, true
+	}
+
+	prev, next := others[index-1].Position, others[index].Position
+	if next-prev < 2*minNotePositionGap {
+		return 0, false
+	}
+	// Far from zero the midpoint can round onto a neighbour
+	mid := prev + (next-prev)/2
+	if mid <= prev || mid >= next {
+		return 0, false
+	}
+	return mid, true
+}
+
+// rebalanceNotePositions spreads the notes of a notebook notePositionGap
+// apart, with the moved note inserted at index
+func rebalanceNotePositions(tx *gorm.DB, others []notePosition, index int, noteID uuid.UUID) error {
+	ordered := make([]uuid.UUID, 0, len(others)+1)
+	for _, p := range others[:index] {
+		ordered = append(ordered, p.ID)
+	}
+	ordered = append(ordered, noteID)
+	for _, p := range others[index:] {
+		ordered = append(ordered, p.ID)
+	}
+
+	for i, id := range ordered {
+		position := float64(i+1) * notePositionGap
+		if err := tx.Model(&models.Note{}).Where("id = ?", id).UpdateColumn("position", position).Error; err != nil {
+			return fmt.Errorf("failed to rebalance note positions: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"regexp"
+	"testing"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	notebookPositionsQuery = `SELECT "id","position" FROM "notes" WHERE notebook_id = \$1 AND "notes"."deleted_at" IS NULL ORDER BY position ASC, created_at DESC`
+	notePositionUpdate     = `UPDATE "notes" SET "position"=\$1 WHERE id = \$2 AND "notes"."deleted_at" IS NULL`
+)
+
+// expectReorderCommit expects the event and the reload that finish a reorder
+func expectReorderCommit(mock sqlmock.Sqlmock, notebookID uuid.UUID) {
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "events"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE notebook_id = \$1 AND "notes"."deleted_at" IS NULL ORDER BY position ASC, created_at DESC`).
+		WithArgs(notebookID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+func TestReorderNotes_MovesBetweenNeighbours(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	notebookID, a, b, c := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(notebookPositionsQuery).
+		WithArgs(notebookID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "position"}).
+			AddRow(a, 1000.0).AddRow(b, 2000.0).AddRow(c, 3000.0))
+	mock.ExpectExec(notePositionUpdate).
+		WithArgs(1500.0, c).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectReorderCommit(mock, notebookID)
+
+	_, err := (&NotebookService{}).ReorderNotes(db, notebookID.String(),
+		map[string]interface{}{"note_id": c.String(), "after_note_id": a.String()},
+		map[string]interface{}{"user_id": uuid.New().String()})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReorderNotes_MoveToTop(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	notebookID, a, b := uuid.New(), uuid.New(), uuid.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(notebookPositionsQuery).
+		WithArgs(notebookID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "position"}).AddRow(a, 1000.0).AddRow(b, 2000.0))
+	mock.ExpectExec(notePositionUpdate).
+		WithArgs(0.0, b).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectReorderCommit(mock, notebookID)
+
+	_, err := (&NotebookService{}).ReorderNotes(db, notebookID.String(),
+		map[string]interface{}{"note_id": b.String()},
+		map[string]interface{}{"user_id": uuid.New().String()})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReorderNotes_RebalancesWhenGapIsTooSmall(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	// Repeated moves between the same neighbours halve the gap until it runs out
+	notebookID, a, b, c := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(notebookPositionsQuery).
+		WithArgs(notebookID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "position"}).
+			AddRow(a, 1000.0).AddRow(b, 1000.0000001).AddRow(c, 5000.0))
+	for i, id := range []uuid.UUID{a, c, b} {
+		mock.ExpectExec(notePositionUpdate).
+			WithArgs(float64(i+1)*notePositionGap, id).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	expectReorderCommit(mock, notebookID)
+
+	_, err := (&NotebookService{}).ReorderNotes(db, notebookID.String(),
+		map[string]interface{}{"note_id": c.String(), "after_note_id": a.String()},
+		map[string]interface{}{"user_id": uuid.New().String()})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReorderNotes_Validation(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	service := &NotebookService{}
+	params := map[string]interface{}{"user_id": uuid.New().String()}
+	notebookID, noteID := uuid.New(), uuid.New()
+
+	_, err := service.ReorderNotes(db, notebookID.String(), map[string]interface{}{"note_id": "nope"}, params)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = service.ReorderNotes(db, notebookID.String(),
+		map[string]interface{}{"note_id": noteID.String(), "after_note_id": noteID.String()}, params)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	// Notes of other notebooks can't be moved here
+	mock.ExpectBegin()
+	mock.ExpectQuery(notebookPositionsQuery).
+		WithArgs(notebookID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "position"}).AddRow(uuid.New(), 1000.0))
+	mock.ExpectRollback()
+	_, err = service.ReorderNotes(db, notebookID.String(), map[string]interface{}{"note_id": noteID.String()}, params)
+	assert.ErrorIs(t, err, ErrNoteNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPositionBetween(t *testing.T) {
+	others := []notePosition{{Position: 1000}, {Position: 2000}}
+
+	position, ok := positionBetween(others, 1)
+	assert.True(t, ok)
+	assert.Equal(t, 1500.0, position)
+
+	position, ok = positionBetween(others, 2)
+	assert.True(t, ok)
+	assert.Equal(t, 3000.0, position)
+
+	// Large positions can't be split even when they differ
+	_, ok = positionBetween([]notePosition{{Position: 1e17}, {Position: 1e17 + 16}}, 1)
+	assert.False(t, ok)
+}
+
+func TestNewNotePosition(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID, notebookID := uuid.New(), uuid.New()
+	for _, tc := range []struct {
+		placement string
+		aggregate string
+	}{
+		{placement: "", aggregate: "MIN(position) - $1"},
+		{placement: "bottom", aggregate: "MAX(position) + $1"},
+	} {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(preferences->>$1, '') FROM "users" WHERE id = $2`)).
+			WithArgs(NewNotePositionPreference, userID).
+			WillReturnRows(sqlmock.NewRows([]string{"placement"}).AddRow(tc.placement))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(`+tc.aggregate+`, 0) FROM "notes" WHERE notebook_id = $2`)).
+			WithArgs(notePositionGap, notebookID).
+			WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(-1000.0))
+
+		position, err := newNotePosition(db.DB, userID, notebookID)
+		require.NoError(t, err, tc.placement)
+		assert.Equal(t, -1000.0, position)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
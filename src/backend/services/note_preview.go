@@ -0,0 +1,58 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshNotePreview recomputes the stored preview of a note from its blocks
+func RefreshNotePreview(db *gorm.DB, noteID uuid.UUID) error {
+	return db.Exec(`UPDATE notes SET preview = `+models.NotePreviewSQL+` WHERE id = ?`, noteID).Error
+}
+
+// refreshNotePreview refreshes a note's preview after its blocks changed. A
+// stale preview isn't worth failing the block write over, so errors are logged.
+func refreshNotePreview(db *gorm.DB, noteID uuid.UUID) {
+	if noteID == uuid.Nil {
+		return
+	}
+	if err := RefreshNotePreview(db, noteID); err != nil {
+		log.Printf("Failed to refresh preview for note %s: %v", noteID, err)
+	}
+}
+
+// PreviewText returns the start of a note's content, at most maxLen
+// characters, for lists, search results and exports. It is the text of the
+// first block that has any, so empty blocks are skipped; notes loaded without
+// their blocks use the stored preview, which starts with that text. A maxLen
+// of 0 or less keeps the whole text.
+func PreviewText(note models.Note, maxLen int) string {
+	text := note.Preview
+	if len(note.Blocks) > 0 {
+		text = firstBlockText(note.Blocks)
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if maxLen <= 0 {
+		return text
+	}
+	return shortenText(text, maxLen)
+}
+
+// firstBlockText returns the text of the first block, in note order, whose
+// text isn't blank
+func firstBlockText(blocks []models.Block) string {
+	sorted := append([]models.Block(nil), blocks...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Order < sorted[j].Order })
+	for _, block := range sorted {
+		if text, _ := block.Content["text"].(string); strings.TrimSpace(text) != "" {
+			return text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// allowAllRoles grants every block, note, notebook and resource access check
+type allowAllRoles struct {
+	RoleServiceInterface
+}
+
+func (allowAllRoles) HasBlockAccess(db *database.Database, userID string, blockID string, requiredRole string) (bool, error) {
+	return true, nil
+}
+
+func (allowAllRoles) HasNoteAccess(db *database.Database, userID string, noteID string, requiredRole string) (bool, error) {
+	return true, nil
+}
+
+func (allowAllRoles) HasNotebookAccess(db *database.Database, userID string, notebookID string, requiredRole string) (bool, error) {
+	return true, nil
+}
+
+func (allowAllRoles) HasAccessByStrings(db *database.Database, userID, resourceID, resourceType, requiredRole string) (bool, error) {
+	return true, nil
+}
+
+func withAllowAllRoles(t *testing.T) {
+	original := RoleServiceInstance
+	RoleServiceInstance = allowAllRoles{}
+	t.Cleanup(func() { RoleServiceInstance = original })
+}
+
+var notePreviewUpdate = regexp.QuoteMeta(`UPDATE notes SET preview = COALESCE((`)
+
+func TestRefreshNotePreview(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID := uuid.New()
+	mock.ExpectExec(notePreviewUpdate + `.*WHERE id = \$1`).
+		WithArgs(noteID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, RefreshNotePreview(db.DB, noteID))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateBlock_RefreshesNotePreview(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	blockID := uuid.New()
+	noteID := uuid.New()
+	userID := uuid.New()
+	now := time.Now()
+	columns := []string{"id", "note_id", "user_id", "type", "content", "metadata", "order", "created_at", "updated_at"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(blockID, noteID, userID, "text", []byte(`{"text":"Old first line"}`), []byte(`{}`), 1, now, now))
+	mock.ExpectQuery(`INSERT INTO "events"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectExec(`UPDATE "blocks" SET`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(blockID, noteID, userID, "text", []byte(`{"text":"New first line"}`), []byte(`{}`), 1, now, now))
+	mock.ExpectCommit()
+	// The preview of the block's note is recomputed once the change is committed
+	mock.ExpectExec(notePreviewUpdate + `.*WHERE id = \$1`).
+		WithArgs(noteID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	block, err := (&BlockService{}).UpdateBlock(db, blockID.String(), map[string]interface{}{
+		"content": map[string]interface{}{"text": "New first line"},
+	}, map[string]interface{}{"user_id": userID.String()})
+	require.NoError(t, err)
+	assert.Equal(t, "New first line", block.Content["text"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteBlock_RefreshesNotePreview(t *testing.T) {
+	withAllowAllRoles(t)
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	blockID := uuid.New()
+	noteID := uuid.New()
+	userID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "user_id", "type"}).
+			AddRow(blockID, noteID, userID, "text"))
+	mock.ExpectExec(`UPDATE "blocks" SET "deleted_at"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "events"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+	mock.ExpectExec(notePreviewUpdate + `.*WHERE id = \$1`).
+		WithArgs(noteID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, (&BlockService{}).DeleteBlock(db, blockID.String(), map[string]interface{}{"user_id": userID.String()}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPreviewText_SkipsEmptyBlocks(t *testing.T) {
+	note := models.Note{
+		Title:   "Trip",
+		Preview: "stale preview",
+		Blocks: []models.Block{
+			{Type: models.TextBlock, Order: 3000, Content: models.BlockContent{"text": "Book the hotel"}},
+			{Type: models.TextBlock, Order: 1000, Content: models.BlockContent{"text": "  \n "}},
+			{Type: models.TaskBlock, Order: 500, Content: models.BlockContent{}},
+			{Type: models.TextBlock, Order: 2000, Content: models.BlockContent{"text": "Pack   light,\nbring a rain jacket"}},
+		},
+	}
+
+	assert.Equal(t, "Pack light, bring a rain jacket", PreviewText(note, 0))
+	assert.Equal(t, "Pack light,...", PreviewText(note, 11))
+}
+
+func TestPreviewText_CutsRunesAndFallsBackToStoredPreview(t *testing.T) {
+	note := models.Note{Preview: "Čaj s medem a citronem"}
+
+	assert.Equal(t, "Čaj s...", PreviewText(note, 5))
+	assert.Equal(t, "Čaj s medem a citronem", PreviewText(note, 100))
+	assert.Equal(t, "", PreviewText(models.Note{}, 10))
+}
@@ -2,7 +2,9 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"owlistic-notes/owlistic/broker"
@@ -10,10 +12,14 @@ import (
 	"owlistic-notes/owlistic/models"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 
 	"gorm.io/gorm"
 )
 
+// mergeBlockOrderGap is the spacing used between blocks appended by a merge
+const mergeBlockOrderGap = 1000.0
+
 type NoteServiceInterface interface {
 	CreateNote(db *database.Database, noteData map[string]interface{}) (models.Note, error)
 	GetNoteById(db *database.Database, id string, params map[string]interface{}) (models.Note, error)
@@ -21,7 +27,11 @@ type NoteServiceInterface interface {
 	DeleteNote(db *database.Database, id string, params map[string]interface{}) error
 	ListNotesByUser(db *database.Database, userID string) ([]models.Note, error)
 	GetAllNotes(db *database.Database) ([]models.Note, error)
+	// GetNotes lists notes matching params; limit and offset load one page
 	GetNotes(db *database.Database, params map[string]interface{}) ([]models.Note, error)
+	CountNotes(db *database.Database, params map[string]interface{}) (int64, error)
+	MergeNotes(db *database.Database, targetID string, sourceIDs []string, params map[string]interface{}) (models.Note, error)
+	DiffNotes(db *database.Database, id string, againstID string, params map[string]interface{}) (NoteDiff, error)
 }
 
 type NoteService struct{}
@@ -58,6 +68,11 @@ func (s *NoteService) CreateNote(db *database.Database, noteData map[string]inte
 		return models.Note{}, errors.New("user not found")
 	}
 
+	if err := checkNoteLimit(tx, userID); err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
 	// Extract notebook_id and validate notebook exists
 	notebookIDStr, ok := noteData["notebook_id"].(string)
 	if !ok {
@@ -82,8 +97,19 @@ func (s *NoteService) CreateNote(db *database.Database, noteData map[string]inte
 		return models.Note{}, errors.New("notebook not found")
 	}
 
+	position, err := newNotePosition(tx, userID, notebookID)
+	if err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
 	// Create note
 	title, _ := noteData["title"].(string)
+	// source says what created the note, for event consumers such as webhooks
+	source, _ := noteData["source"].(string)
+	if source == "" {
+		source = "api"
+	}
 	noteID := uuid.New()
 
 	note := models.Note{
@@ -91,6 +117,7 @@ func (s *NoteService) CreateNote(db *database.Database, noteData map[string]inte
 		UserID:     userID,
 		NotebookID: notebookID,
 		Title:      title,
+		Position:   position,
 	}
 
 	if err := tx.Create(&note).Error; err != nil {
@@ -135,7 +162,9 @@ func (s *NoteService) CreateNote(db *database.Database, noteData map[string]inte
 		map[string]interface{}{
 			"note_id":     note.ID.String(),
 			"notebook_id": note.NotebookID.String(),
+			"user_id":     note.UserID.String(),
 			"title":       note.Title,
+			"source":      source,
 			"blocks":      []string{block.ID.String()},
 		},
 	)
@@ -248,6 +277,30 @@ func (s *NoteService) UpdateNote(db *database.Database, id string, noteData map[
 			return models.Note{}, errors.New("notebook not found")
 		}
 
+		// A note moved to another notebook is placed like a new note there
+		if notebookID != note.NotebookID {
+			userID, err := uuid.Parse(userIDStr)
+			if err != nil {
+				tx.Rollback()
+				return models.Note{}, errors.New("user_id must be a valid UUID")
+			}
+			canMove, err := RoleServiceInstance.CanMoveNote(db, userID, note.ID, notebookID)
+			if err != nil {
+				tx.Rollback()
+				return models.Note{}, err
+			}
+			if !canMove {
+				tx.Rollback()
+				return models.Note{}, fmt.Errorf("%w: moving a note needs ownership of it or editor access to its notebook, and editor access to the target notebook", ErrInsufficientAccess)
+			}
+
+			position, err := newNotePosition(tx, note.UserID, notebookID)
+			if err != nil {
+				tx.Rollback()
+				return models.Note{}, err
+			}
+			note.Position = position
+		}
 		note.NotebookID = notebookID
 	}
 
@@ -265,6 +318,7 @@ func (s *NoteService) UpdateNote(db *database.Database, id string, noteData map[
 		map[string]interface{}{
 			"note_id":     note.ID.String(),
 			"notebook_id": note.NotebookID.String(),
+			"user_id":     note.UserID.String(),
 			"title":       note.Title,
 		},
 	)
@@ -346,6 +400,8 @@ func (s *NoteService) DeleteNote(db *database.Database, id string, params map[st
 		map[string]interface{}{
 			"note_id":     note.ID.String(),
 			"notebook_id": note.NotebookID.String(),
+			"user_id":     note.UserID.String(),
+			"title":       note.Title,
 		},
 	)
 
@@ -385,32 +441,26 @@ func (s *NoteService) GetAllNotes(db *database.Database) ([]models.Note, error)
 // GetNotes retrieves notes based on query parameters with access control
 func (s *NoteService) GetNotes(db *database.Database, params map[string]interface{}) ([]models.Note, error) {
 	var notes []models.Note
-	query := db.DB
-
-	// Always filter by user_id if provided - this is critical for RBAC
-	userID, ok := params["user_id"].(string)
-	if !ok || userID == "" {
-		return nil, errors.New("user_id is required for security reasons")
+	query, err := noteListQuery(db, params)
+	if err != nil {
+		return nil, err
 	}
+	userID := params["user_id"].(string)
 
 	// Log for debugging
 	log.Printf("Fetching notes for user: %s", userID)
 
-	// Get all notes owned by the user
-	query = query.Where("user_id = ?", userID)
-
-	// Apply other filters
+	// Notes of a single notebook follow their manual order
 	if notebookID, ok := params["notebook_id"].(string); ok && notebookID != "" {
-		query = query.Where("notebook_id = ?", notebookID)
+		query = query.Order("position ASC, created_at DESC")
 	}
+	query = pagedList(query, params, "id ASC")
 
-	if title, ok := params["title"].(string); ok && title != "" {
-		query = query.Where("title LIKE ?", "%"+title+"%")
+	// Only load the requested columns
+	if fields, ok := params["fields"].([]string); ok && len(fields) > 0 {
+		query = query.Select(fields)
 	}
 
-	// Include or exclude deleted notes
-	query = query.Where("deleted_at IS NULL")
-
 	// Execute the query
 	if err := query.Find(&notes).Error; err != nil {
 		log.Printf("Error executing note query: %v", err)
@@ -462,6 +512,389 @@ func (s *NoteService) GetNotes(db *database.Database, params map[string]interfac
 	return notes, nil
 }
 
+// CountNotes counts the notes GetNotes lists for params, ignoring the page
+func (s *NoteService) CountNotes(db *database.Database, params map[string]interface{}) (int64, error) {
+	query, err := noteListQuery(db, params)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	if err := query.Model(&models.Note{}).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// noteListQuery filters notes by the list params
+func noteListQuery(db *database.Database, params map[string]interface{}) (*gorm.DB, error) {
+	// Always filter by user_id if provided - this is critical for RBAC
+	userID, ok := params["user_id"].(string)
+	if !ok || userID == "" {
+		return nil, errors.New("user_id is required for security reasons")
+	}
+
+	// Get all notes owned by the user
+	query := db.DB.Where("user_id = ?", userID)
+
+	if notebookID, ok := params["notebook_id"].(string); ok && notebookID != "" {
+		query = query.Where("notebook_id = ?", notebookID)
+	}
+
+	if title, ok := params["title"].(string); ok && title != "" {
+		query = query.Where("title LIKE ?", "%"+title+"%")
+	}
+
+	// Include or exclude deleted notes
+	return query.Where("deleted_at IS NULL"), nil
+}
+
+// MergeNotes folds the source notes into the target note. Source blocks are
+// appended after the target's blocks, tags and AI enhancements are combined,
+// a provenance block is added and the source notes are moved to the trash.
+func (s *NoteService) MergeNotes(db *database.Database, targetID string, sourceIDs []string, params map[string]interface{}) (models.Note, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return models.Note{}, errors.New("user_id must be provided in parameters")
+	}
+
+	sourceIDs = uniqueMergeSources(targetID, sourceIDs)
+	if len(sourceIDs) == 0 {
+		return models.Note{}, fmt.Errorf("%w: at least one source note other than the target is required", ErrInvalidInput)
+	}
+
+	// The target is edited, the sources are trashed
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, targetID, "editor")
+	if err != nil {
+		return models.Note{}, err
+	}
+	if !hasAccess {
+		return models.Note{}, errors.New("not authorized to update this note")
+	}
+	for _, sourceID := range sourceIDs {
+		hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, sourceID, "owner")
+		if err != nil {
+			return models.Note{}, err
+		}
+		if !hasAccess {
+			return models.Note{}, errors.New("not authorized to delete this note")
+		}
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return models.Note{}, tx.Error
+	}
+
+	orderBlocks := func(db *gorm.DB) *gorm.DB {
+		return db.Order("\"blocks\".\"order\" ASC")
+	}
+
+	var target models.Note
+	if err := tx.Preload("Blocks", orderBlocks).First(&target, "id = ?", targetID).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Note{}, ErrNoteNotFound
+		}
+		return models.Note{}, err
+	}
+
+	// Load sources in the order they were requested
+	sources := make([]models.Note, 0, len(sourceIDs))
+	for _, sourceID := range sourceIDs {
+		var source models.Note
+		if err := tx.Preload("Blocks", orderBlocks).First(&source, "id = ?", sourceID).Error; err != nil {
+			tx.Rollback()
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return models.Note{}, ErrNoteNotFound
+			}
+			return models.Note{}, err
+		}
+		sources = append(sources, source)
+	}
+
+	// Move source blocks into the target after its existing blocks
+	movedBlocks := planMergedBlocks(target, sources)
+	for _, block := range movedBlocks {
+		if err := tx.Model(&models.Block{}).Where("id = ?", block.ID).Updates(map[string]interface{}{
+			"note_id": target.ID,
+			"order":   block.Order,
+		}).Error; err != nil {
+			tx.Rollback()
+			return models.Note{}, err
+		}
+	}
+
+	// Tasks follow their blocks
+	if err := tx.Model(&models.Task{}).Where("note_id IN ?", sourceIDs).Update("note_id", target.ID).Error; err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	// Record where the merged content came from
+	lastOrder := lastBlockOrder(target.Blocks)
+	if len(movedBlocks) > 0 {
+		lastOrder = movedBlocks[len(movedBlocks)-1].Order
+	}
+	provenance := buildMergeProvenanceBlock(target, sources, lastOrder+mergeBlockOrderGap, time.Now())
+	if err := tx.Create(&provenance).Error; err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	tagSets := []pq.StringArray{target.Tags}
+	for _, source := range sources {
+		tagSets = append(tagSets, source.Tags)
+	}
+	target.Tags = mergeTags(tagSets...)
+	target.UpdatedAt = time.Now()
+	if err := tx.Model(&target).Updates(map[string]interface{}{
+		"tags":       target.Tags,
+		"updated_at": target.UpdatedAt,
+	}).Error; err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	if err := mergeAIEnhancements(tx, target.ID, sources); err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	// Trash the sources; their remaining blocks go with them
+	for i := range sources {
+		if err := tx.Exec("UPDATE blocks SET deleted_at = NOW() WHERE note_id = ?", sources[i].ID).Error; err != nil {
+			tx.Rollback()
+			return models.Note{}, err
+		}
+
+		if err := tx.Delete(&sources[i]).Error; err != nil {
+			tx.Rollback()
+			return models.Note{}, err
+		}
+
+		event, err := models.NewEvent(
+			string(broker.NoteDeleted),
+			"note",
+			map[string]interface{}{
+				"note_id":     sources[i].ID.String(),
+				"notebook_id": sources[i].NotebookID.String(),
+				"user_id":     sources[i].UserID.String(),
+				"title":       sources[i].Title,
+				"merged_into": target.ID.String(),
+			},
+		)
+		if err != nil {
+			tx.Rollback()
+			return models.Note{}, err
+		}
+
+		if err := tx.Create(event).Error; err != nil {
+			tx.Rollback()
+			return models.Note{}, err
+		}
+	}
+
+	event, err := models.NewEvent(
+		string(broker.NoteUpdated),
+		"note",
+		map[string]interface{}{
+			"note_id":     target.ID.String(),
+			"notebook_id": target.NotebookID.String(),
+			"user_id":     target.UserID.String(),
+			"title":       target.Title,
+			"merged_from": sourceIDs,
+		},
+	)
+	if err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	if err := tx.Create(event).Error; err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.Note{}, err
+	}
+
+	refreshNotePreview(db.DB, target.ID)
+
+	var mergedNote models.Note
+	if err := db.DB.Preload("Blocks", orderBlocks).First(&mergedNote, "id = ?", target.ID).Error; err != nil {
+		return models.Note{}, err
+	}
+
+	return mergedNote, nil
+}
+
+// DiffNotes returns the block-level changes of a note relative to againstID
+func (s *NoteService) DiffNotes(db *database.Database, id string, againstID string, params map[string]interface{}) (NoteDiff, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return NoteDiff{}, fmt.Errorf("%w: invalid note id", ErrInvalidInput)
+	}
+	if _, err := uuid.Parse(againstID); err != nil {
+		return NoteDiff{}, fmt.Errorf("%w: invalid against id", ErrInvalidInput)
+	}
+
+	note, err := s.GetNoteById(db, id, params)
+	if err != nil {
+		return NoteDiff{}, err
+	}
+	against, err := s.GetNoteById(db, againstID, params)
+	if err != nil {
+		return NoteDiff{}, err
+	}
+
+	return DiffNoteBlocks(against, note), nil
+}
+
+// uniqueMergeSources drops duplicates, blanks and the target from the source list
+func uniqueMergeSources(targetID string, sourceIDs []string) []string {
+	seen := map[string]bool{targetID: true}
+	var result []string
+	for _, id := range sourceIDs {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
+
+// lastBlockOrder returns the highest block order in the list
+func lastBlockOrder(blocks []models.Block) float64 {
+	last := 0.0
+	for _, block := range blocks {
+		if block.Order > last {
+			last = block.Order
+		}
+	}
+	return last
+}
+
+// planMergedBlocks returns the source blocks re-parented to the target and
+// re-ordered after the target's last block, keeping source order intact
+func planMergedBlocks(target models.Note, sources []models.Note) []models.Block {
+	var planned []models.Block
+	order := lastBlockOrder(target.Blocks)
+
+	for _, source := range sources {
+		for _, block := range source.Blocks {
+			order += mergeBlockOrderGap
+			block.NoteID = target.ID
+			block.Order = order
+			planned = append(planned, block)
+		}
+	}
+
+	return planned
+}
+
+// mergeTags combines tag lists, dropping blanks and case-insensitive duplicates
+func mergeTags(tagSets ...pq.StringArray) pq.StringArray {
+	seen := make(map[string]bool)
+	merged := pq.StringArray{}
+	for _, tags := range tagSets {
+		for _, tag := range tags {
+			tag = strings.TrimSpace(tag)
+			key := strings.ToLower(tag)
+			if tag == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// buildMergeProvenanceBlock creates the block that records which notes were merged
+func buildMergeProvenanceBlock(target models.Note, sources []models.Note, order float64, mergedAt time.Time) models.Block {
+	titles := make([]string, 0, len(sources))
+	ids := make([]interface{}, 0, len(sources))
+	for _, source := range sources {
+		title := source.Title
+		if title == "" {
+			title = "Untitled"
+		}
+		titles = append(titles, title)
+		ids = append(ids, source.ID.String())
+	}
+
+	label := "Merged from:"
+	text := fmt.Sprintf("%s %s (%s)", label, strings.Join(titles, ", "), mergedAt.Format("2006-01-02 15:04"))
+
+	return models.Block{
+		ID:      uuid.New(),
+		UserID:  target.UserID,
+		NoteID:  target.ID,
+		Type:    models.TextBlock,
+		Content: models.BlockContent{"text": text},
+		Metadata: models.BlockMetadata{
+			"spans":       []interface{}{models.NewSpan(text, 0, len(label), "italic")},
+			"merged_from": ids,
+			"merged_at":   mergedAt.Format(time.RFC3339),
+		},
+		Order: order,
+	}
+}
+
+// mergeAIEnhancements folds the sources' AI data into the target's enhancement
+// and marks it pending so the merged content gets reprocessed
+func mergeAIEnhancements(tx *gorm.DB, targetID uuid.UUID, sources []models.Note) error {
+	sourceIDs := make([]uuid.UUID, 0, len(sources))
+	for _, source := range sources {
+		sourceIDs = append(sourceIDs, source.ID)
+	}
+
+	var sourceEnhanced []models.AIEnhancedNote
+	if err := tx.Where("note_id IN ?", sourceIDs).Find(&sourceEnhanced).Error; err != nil {
+		return err
+	}
+
+	var enhanced models.AIEnhancedNote
+	err := tx.Where("note_id = ?", targetID).First(&enhanced).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	isNew := errors.Is(err, gorm.ErrRecordNotFound)
+	if isNew && len(sourceEnhanced) == 0 {
+		return nil
+	}
+	if isNew {
+		enhanced = models.AIEnhancedNote{NoteID: targetID}
+	}
+
+	tags := []pq.StringArray{enhanced.AITags}
+	steps := []pq.StringArray{enhanced.ActionSteps}
+	learning := []pq.StringArray{enhanced.LearningItems}
+	for _, source := range sourceEnhanced {
+		tags = append(tags, source.AITags)
+		steps = append(steps, source.ActionSteps)
+		learning = append(learning, source.LearningItems)
+	}
+	enhanced.AITags = mergeTags(tags...)
+	enhanced.ActionSteps = mergeTags(steps...)
+	enhanced.LearningItems = mergeTags(learning...)
+
+	if enhanced.AIMetadata == nil {
+		enhanced.AIMetadata = models.AIMetadata{}
+	}
+	enhanced.AIMetadata["merged_from"] = sourceIDs
+	enhanced.ProcessingStatus = models.ProcessingPending
+	enhanced.UpdatedAt = time.Now()
+
+	if isNew {
+		enhanced.CreatedAt = time.Now()
+		return tx.Create(&enhanced).Error
+	}
+	return tx.Save(&enhanced).Error
+}
+
 // NewNoteService creates a new instance of NoteService
 func NewNoteService() NoteServiceInterface {
 	return &NoteService{}
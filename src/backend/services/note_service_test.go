@@ -4,10 +4,12 @@ import (
 	"testing"
 	"time"
 
+	"owlistic-notes/owlistic/models"
 	"owlistic-notes/owlistic/testutils"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 )
@@ -225,3 +227,114 @@ func TestListNotesByUser_Success(t *testing.T) {
 	assert.NotEmpty(t, notes)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestGetNotes_SelectsRequestedFields(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	mock.ExpectQuery(`SELECT "id","title" FROM "notes" WHERE user_id = \$1 AND deleted_at IS NULL`).
+		WithArgs(userID.String()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(uuid.New(), "Test Note"))
+
+	notes, err := (&NoteService{}).GetNotes(db, map[string]interface{}{
+		"user_id": userID.String(),
+		"fields":  []string{"id", "title"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, notes, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetNotes_PagesInTheDatabase(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	params := map[string]interface{}{
+		"user_id": userID.String(),
+		"fields":  []string{"id", "title"},
+		"limit":   20,
+		"offset":  40,
+	}
+	mock.ExpectQuery(`SELECT "id","title" FROM "notes" WHERE user_id = \$1 AND deleted_at IS NULL.* ORDER BY id ASC LIMIT \$2 OFFSET \$3`).
+		WithArgs(userID.String(), 20, 40).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(uuid.New(), "Test Note"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "notes" WHERE user_id = \$1 AND deleted_at IS NULL`).
+		WithArgs(userID.String()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(41))
+
+	notes, err := (&NoteService{}).GetNotes(db, params)
+	assert.NoError(t, err)
+	assert.Len(t, notes, 1)
+
+	total, err := (&NoteService{}).CountNotes(db, params)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(41), total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields("", NoteFields, NoteListFields)
+	assert.NoError(t, err)
+	assert.Equal(t, NoteListFields, fields)
+
+	fields, err = ParseFields(" title, id,title ", NoteFields, NoteListFields)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"title", "id"}, fields)
+
+	_, err = ParseFields("id,password_hash", NoteFields, NoteListFields)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestPlanMergedBlocks_AppendsAfterTarget(t *testing.T) {
+	targetID := uuid.New()
+	target := models.Note{
+		ID: targetID,
+		Blocks: []models.Block{
+			{ID: uuid.New(), NoteID: targetID, Order: 1},
+			{ID: uuid.New(), NoteID: targetID, Order: 2500},
+		},
+	}
+	sourceA := models.Note{ID: uuid.New(), Blocks: []models.Block{
+		{ID: uuid.New(), Order: 1},
+		{ID: uuid.New(), Order: 2},
+	}}
+	sourceB := models.Note{ID: uuid.New(), Blocks: []models.Block{
+		{ID: uuid.New(), Order: 1},
+	}}
+
+	planned := planMergedBlocks(target, []models.Note{sourceA, sourceB})
+
+	assert.Len(t, planned, 3)
+	assert.Equal(t, sourceA.Blocks[0].ID, planned[0].ID)
+	assert.Equal(t, sourceA.Blocks[1].ID, planned[1].ID)
+	assert.Equal(t, sourceB.Blocks[0].ID, planned[2].ID)
+	previous := 2500.0
+	for _, block := range planned {
+		assert.Equal(t, targetID, block.NoteID)
+		assert.Greater(t, block.Order, previous)
+		previous = block.Order
+	}
+}
+
+func TestMergeTags_Dedup(t *testing.T) {
+	merged := mergeTags(
+		pq.StringArray{"go", "Notes"},
+		pq.StringArray{"notes", " ai ", ""},
+		nil,
+		pq.StringArray{"GO", "research"},
+	)
+
+	assert.Equal(t, pq.StringArray{"go", "Notes", "ai", "research"}, merged)
+}
+
+func TestUniqueMergeSources(t *testing.T) {
+	target := uuid.New().String()
+	a := uuid.New().String()
+	b := uuid.New().String()
+
+	sources := uniqueMergeSources(target, []string{a, target, b, a, " "})
+
+	assert.Equal(t, []string{a, b}, sources)
+}
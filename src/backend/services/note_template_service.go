@@ -0,0 +1,190 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"text/template"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type NoteTemplateServiceInterface interface {
+	CreateTemplate(db *database.Database, templateData map[string]interface{}, params map[string]interface{}) (models.NoteTemplate, error)
+	GetTemplates(db *database.Database, params map[string]interface{}) ([]models.NoteTemplate, error)
+	GetTemplateById(db *database.Database, id string, params map[string]interface{}) (models.NoteTemplate, error)
+	DeleteTemplate(db *database.Database, id string, params map[string]interface{}) error
+}
+
+type NoteTemplateService struct{}
+
+var NoteTemplateServiceInstance NoteTemplateServiceInterface = NewNoteTemplateService()
+
+func NewNoteTemplateService() NoteTemplateServiceInterface {
+	return &NoteTemplateService{}
+}
+
+// StepNoteData is what step note templates can refer to, e.g. {{.Title}} or
+// {{.Step.acceptance_criteria}} for fields of the AI breakdown step. As with
+// prompts, a field the step doesn't have fails the render instead of leaving
+// "<no value>" in the note.
+type StepNoteData struct {
+	ProjectName        string
+	ProjectDescription string
+	Number             int
+	Title              string
+	Description        string
+	DueDate            string
+	Step               map[string]interface{}
+}
+
+// DefaultStepNoteTemplate is the step note structure used when no template is chosen
+var DefaultStepNoteTemplate = models.NoteTemplateBlocks{
+	{Type: models.HeadingBlock, Content: models.BlockContent{"text": "Step {{.Number}}: {{.Title}}", "level": 1}},
+	{Type: models.TextBlock, Content: models.BlockContent{"text": "{{.Description}}"}},
+	{Type: models.HeadingBlock, Content: models.BlockContent{"text": "Progress & Notes", "level": 2}},
+	{Type: models.TextBlock, Content: models.BlockContent{"text": "Status: Not started\n\nAdd your progress notes here..."}},
+}
+
+// CreateTemplate stores a note template. templateData holds name, description
+// and blocks (models.NoteTemplateBlocks).
+func (s *NoteTemplateService) CreateTemplate(db *database.Database, templateData map[string]interface{}, params map[string]interface{}) (models.NoteTemplate, error) {
+	userID, ok := params["user_id"].(string)
+	if !ok {
+		return models.NoteTemplate{}, errors.New("user_id must be provided in parameters")
+	}
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return models.NoteTemplate{}, fmt.Errorf("%w: invalid user id", ErrInvalidInput)
+	}
+
+	name, _ := templateData["name"].(string)
+	if name == "" {
+		return models.NoteTemplate{}, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	description, _ := templateData["description"].(string)
+	blocks, _ := templateData["blocks"].(models.NoteTemplateBlocks)
+	if err := validateNoteTemplateBlocks(blocks); err != nil {
+		return models.NoteTemplate{}, err
+	}
+
+	noteTemplate := models.NoteTemplate{
+		ID:          uuid.New(),
+		UserID:      userUUID,
+		Name:        name,
+		Description: description,
+		Blocks:      blocks,
+	}
+	if err := db.DB.Create(&noteTemplate).Error; err != nil {
+		return models.NoteTemplate{}, err
+	}
+	return noteTemplate, nil
+}
+
+// GetTemplates lists the caller's note templates
+func (s *NoteTemplateService) GetTemplates(db *database.Database, params map[string]interface{}) ([]models.NoteTemplate, error) {
+	userID, ok := params["user_id"].(string)
+	if !ok {
+		return nil, errors.New("user_id must be provided in parameters")
+	}
+
+	var templates []models.NoteTemplate
+	if err := db.DB.Where("user_id = ?", userID).Order("name ASC").Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// GetTemplateById returns one of the caller's note templates, or ErrNotFound
+func (s *NoteTemplateService) GetTemplateById(db *database.Database, id string, params map[string]interface{}) (models.NoteTemplate, error) {
+	userID, ok := params["user_id"].(string)
+	if !ok {
+		return models.NoteTemplate{}, errors.New("user_id must be provided in parameters")
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return models.NoteTemplate{}, fmt.Errorf("%w: invalid template id", ErrInvalidInput)
+	}
+
+	var noteTemplate models.NoteTemplate
+	if err := db.DB.Where("id = ? AND user_id = ?", id, userID).First(&noteTemplate).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.NoteTemplate{}, ErrNotFound
+		}
+		return models.NoteTemplate{}, err
+	}
+	return noteTemplate, nil
+}
+
+// DeleteTemplate removes one of the caller's note templates
+func (s *NoteTemplateService) DeleteTemplate(db *database.Database, id string, params map[string]interface{}) error {
+	userID, ok := params["user_id"].(string)
+	if !ok {
+		return errors.New("user_id must be provided in parameters")
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("%w: invalid template id", ErrInvalidInput)
+	}
+
+	result := db.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.NoteTemplate{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// validateNoteTemplateBlocks checks block types and that every string value parses as a template
+func validateNoteTemplateBlocks(blocks models.NoteTemplateBlocks) error {
+	if len(blocks) == 0 {
+		return fmt.Errorf("%w: a template needs at least one block", ErrInvalidInput)
+	}
+	for i, block := range blocks {
+		switch block.Type {
+		case models.TextBlock, models.TaskBlock, models.HeadingBlock, models.ListItemBlock, models.HorizontalRuleBlock:
+		default:
+			return fmt.Errorf("%w: block %d has unknown type %q", ErrInvalidInput, i+1, block.Type)
+		}
+		for key, value := range block.Content {
+			text, ok := value.(string)
+			if !ok {
+				continue
+			}
+			if _, err := template.New(key).Parse(text); err != nil {
+				return fmt.Errorf("%w: block %d field %s: %v", ErrInvalidInput, i+1, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// renderNoteTemplate fills in the string values of each block with data
+func renderNoteTemplate(blocks models.NoteTemplateBlocks, data interface{}) (models.NoteTemplateBlocks, error) {
+	rendered := make(models.NoteTemplateBlocks, 0, len(blocks))
+	for i, block := range blocks {
+		content := make(models.BlockContent, len(block.Content))
+		for key, value := range block.Content {
+			text, ok := value.(string)
+			if !ok {
+				content[key] = value
+				continue
+			}
+			tmpl, err := template.New(key).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("block %d field %s: %w", i+1, key, err)
+			}
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, data); err != nil {
+				return nil, fmt.Errorf("block %d field %s: %w", i+1, key, err)
+			}
+			content[key] = buf.String()
+		}
+		rendered = append(rendered, models.NoteTemplateBlock{Type: block.Type, Content: content})
+	}
+	return rendered, nil
+}
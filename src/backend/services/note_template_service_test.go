@@ -0,0 +1,111 @@
+package services
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStepNoteData() StepNoteData {
+	return StepNoteData{
+		ProjectName: "Garden",
+		Number:      2,
+		Title:       "Build raised beds",
+		Description: "Cut and assemble the boards",
+		DueDate:     "2026-05-01",
+		Step: map[string]interface{}{
+			"title":               "Build raised beds",
+			"acceptance_criteria": "Beds are level and filled with soil",
+		},
+	}
+}
+
+func TestBuildStepNoteBlocks_Default(t *testing.T) {
+	noteID := uuid.New()
+	blocks, err := buildStepNoteBlocks(DefaultStepNoteTemplate, testStepNoteData(), uuid.New(), noteID)
+	require.NoError(t, err)
+	require.Len(t, blocks, 4)
+
+	assert.Equal(t, models.HeadingBlock, blocks[0].Type)
+	assert.Equal(t, "Step 2: Build raised beds", blocks[0].Content["text"])
+	assert.Equal(t, "Cut and assemble the boards", blocks[1].Content["text"])
+	assert.Equal(t, "Progress & Notes", blocks[2].Content["text"])
+	assert.Equal(t, "Status: Not started\n\nAdd your progress notes here...", blocks[3].Content["text"])
+	for i, block := range blocks {
+		assert.Equal(t, noteID, block.NoteID)
+		assert.Equal(t, float64(i+1)*1000.0, block.Order)
+	}
+}
+
+func TestBuildStepNoteBlocks_CustomTemplate(t *testing.T) {
+	custom := models.NoteTemplateBlocks{
+		{Type: models.HeadingBlock, Content: models.BlockContent{"text": "{{.Title}} ({{.ProjectName}})", "level": 1}},
+		{Type: models.TextBlock, Content: models.BlockContent{"text": "Due: {{.DueDate}}"}},
+		{Type: models.HeadingBlock, Content: models.BlockContent{"text": "Acceptance criteria", "level": 2}},
+		{Type: models.TaskBlock, Content: models.BlockContent{"text": "{{.Step.acceptance_criteria}}", "is_completed": false}},
+	}
+
+	blocks, err := buildStepNoteBlocks(custom, testStepNoteData(), uuid.New(), uuid.New())
+	require.NoError(t, err)
+	require.Len(t, blocks, 4)
+
+	assert.Equal(t, "Build raised beds (Garden)", blocks[0].Content["text"])
+	assert.Equal(t, 1, blocks[0].Content["level"])
+	assert.Equal(t, "Due: 2026-05-01", blocks[1].Content["text"])
+	assert.Equal(t, "Acceptance criteria", blocks[2].Content["text"])
+	assert.Equal(t, models.TaskBlock, blocks[3].Type)
+	assert.Equal(t, "Beds are level and filled with soil", blocks[3].Content["text"])
+	assert.Equal(t, false, blocks[3].Content["is_completed"])
+}
+
+func TestBuildStepNoteBlocks_MissingStepFieldFails(t *testing.T) {
+	custom := models.NoteTemplateBlocks{
+		{Type: models.TextBlock, Content: models.BlockContent{"text": "Budget: {{.Step.budget}}"}},
+	}
+
+	_, err := buildStepNoteBlocks(custom, testStepNoteData(), uuid.New(), uuid.New())
+	assert.ErrorContains(t, err, "budget")
+}
+
+func TestCreateTemplate_RejectsInvalidBlocks(t *testing.T) {
+	db, _, close := testutils.SetupMockDB()
+	defer close()
+	service := NewNoteTemplateService()
+	params := map[string]interface{}{"user_id": uuid.New().String()}
+
+	_, err := service.CreateTemplate(db, map[string]interface{}{
+		"name":   "Broken",
+		"blocks": models.NoteTemplateBlocks{{Type: models.TextBlock, Content: models.BlockContent{"text": "{{.Title"}}},
+	}, params)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = service.CreateTemplate(db, map[string]interface{}{
+		"name":   "Unknown type",
+		"blocks": models.NoteTemplateBlocks{{Type: "video", Content: models.BlockContent{}}},
+	}, params)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = service.CreateTemplate(db, map[string]interface{}{"name": "Empty"}, params)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestGetTemplateById_NotFound(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	userID := uuid.New().String()
+	templateID := uuid.New().String()
+
+	mock.ExpectQuery(`SELECT \* FROM "note_templates" WHERE \(id = \$1 AND user_id = \$2\)`).
+		WithArgs(templateID, userID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err := NewNoteTemplateService().GetTemplateById(db, templateID, map[string]interface{}{"user_id": userID})
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
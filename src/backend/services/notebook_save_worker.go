@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultNotebookSaveConcurrency caps how many chain executions are written
+// to notebooks at the same time
+const defaultNotebookSaveConcurrency = 4
+
+// NotebookSaveWorker runs notebook saves of finished chain executions in the
+// background, at most a fixed number at a time. Its context is cancelled only
+// when Stop gives up waiting, so a shutdown lets saves in progress finish.
+type NotebookSaveWorker struct {
+	slots chan struct{}
+
+	mu      sync.Mutex
+	stopped bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+var (
+	chainNotebookSaves     *NotebookSaveWorker
+	chainNotebookSavesOnce sync.Once
+)
+
+// NewNotebookSaveWorker creates a worker running up to concurrency saves at once
+func NewNotebookSaveWorker(concurrency int) *NotebookSaveWorker {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &NotebookSaveWorker{
+		slots:  make(chan struct{}, concurrency),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// ChainNotebookSaves returns the worker shared by all orchestrators, sized by
+// AGENT_NOTEBOOK_SAVE_CONCURRENCY
+func ChainNotebookSaves() *NotebookSaveWorker {
+	chainNotebookSavesOnce.Do(func() {
+		concurrency := defaultNotebookSaveConcurrency
+		if value, err := strconv.Atoi(os.Getenv("AGENT_NOTEBOOK_SAVE_CONCURRENCY")); err == nil && value > 0 {
+			concurrency = value
+		}
+		chainNotebookSaves = NewNotebookSaveWorker(concurrency)
+	})
+	return chainNotebookSaves
+}
+
+// Submit queues save to run once a slot is free, with a context keeping the
+// values of parent, such as its request ID. Returns false when the worker is
+// stopped and the save was not queued.
+func (w *NotebookSaveWorker) Submit(parent context.Context, save func(ctx context.Context)) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return false
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		select {
+		case w.slots <- struct{}{}:
+		case <-w.ctx.Done():
+			return
+		}
+		defer func() { <-w.slots }()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Notebook save panic recovered: %v", r)
+			}
+		}()
+		save(detach(w.ctx, parent))
+	}()
+	return true
+}
+
+// Stop stops accepting saves and waits up to timeout for queued and running
+// saves to finish, then cancels the ones still left
+func (w *NotebookSaveWorker) Stop(timeout time.Duration) {
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return
+	}
+	w.stopped = true
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("Notebook save worker stopped")
+	case <-time.After(timeout):
+		log.Printf("Notebook save worker cancelled saves still in progress after %s", timeout)
+	}
+	w.cancel()
+}
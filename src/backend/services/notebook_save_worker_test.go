@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotebookSaveWorker_RespectsConcurrencyCap(t *testing.T) {
+	worker := NewNotebookSaveWorker(2)
+
+	var running, peak, finished int32
+	started := make(chan struct{}, 6)
+	release := make(chan struct{})
+	for i := 0; i < 6; i++ {
+		require.True(t, worker.Submit(context.Background(), func(ctx context.Context) {
+			now := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+					break
+				}
+			}
+			started <- struct{}{}
+			<-release
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&finished, 1)
+		}))
+	}
+
+	// Two saves start; the rest wait for a slot
+	<-started
+	<-started
+	select {
+	case <-started:
+		t.Fatal("a third save started while two were running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	worker.Stop(time.Second)
+	assert.Equal(t, int32(6), atomic.LoadInt32(&finished))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+}
+
+func TestNotebookSaveWorker_StopWaitsThenCancels(t *testing.T) {
+	worker := NewNotebookSaveWorker(1)
+
+	var mu sync.Mutex
+	var saveErr error
+	started := make(chan struct{})
+	done := make(chan struct{})
+	require.True(t, worker.Submit(context.Background(), func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		mu.Lock()
+		saveErr = ctx.Err()
+		mu.Unlock()
+		close(done)
+	}))
+	<-started
+
+	worker.Stop(50 * time.Millisecond)
+	<-done
+	mu.Lock()
+	assert.ErrorIs(t, saveErr, context.Canceled)
+	mu.Unlock()
+
+	assert.False(t, worker.Submit(context.Background(), func(ctx context.Context) {}), "a stopped worker must not accept saves")
+}
@@ -11,6 +11,7 @@ import (
 	"owlistic-notes/owlistic/models"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type NotebookServiceInterface interface {
@@ -21,6 +22,8 @@ type NotebookServiceInterface interface {
 	ListNotebooksByUser(db *database.Database, userID string) ([]models.Notebook, error)
 	GetAllNotebooks(db *database.Database) ([]models.Notebook, error)
 	GetNotebooks(db *database.Database, params map[string]interface{}) ([]models.Notebook, error)
+	CountNotebooks(db *database.Database, params map[string]interface{}) (int64, error)
+	ReorderNotes(db *database.Database, notebookID string, reorderData map[string]interface{}, params map[string]interface{}) ([]models.Note, error)
 }
 
 type NotebookService struct{}
@@ -57,6 +60,11 @@ func (s *NotebookService) CreateNotebook(db *database.Database, notebookData map
 		return models.Notebook{}, ErrUserNotFound
 	}
 
+	if err := checkNotebookLimit(tx, userID); err != nil {
+		tx.Rollback()
+		return models.Notebook{}, err
+	}
+
 	// Create notebook
 	name, _ := notebookData["name"].(string)
 	description, _ := notebookData["description"].(string)
@@ -94,6 +102,7 @@ func (s *NotebookService) CreateNotebook(db *database.Database, notebookData map
 		"notebook",
 		map[string]interface{}{
 			"notebook_id": notebook.ID.String(),
+			"user_id":     notebook.UserID.String(),
 			"name":        notebook.Name,
 			"description": notebook.Description,
 		},
@@ -193,6 +202,7 @@ func (s *NotebookService) UpdateNotebook(db *database.Database, id string, noteb
 		"notebook",
 		map[string]interface{}{
 			"notebook_id": notebook.ID.String(),
+			"user_id":     notebook.UserID.String(),
 			"name":        notebook.Name,
 			"description": notebook.Description,
 		},
@@ -278,6 +288,8 @@ func (s *NotebookService) DeleteNotebook(db *database.Database, id string, param
 		"notebook",
 		map[string]interface{}{
 			"notebook_id": notebook.ID.String(),
+			"user_id":     notebook.UserID.String(),
+			"name":        notebook.Name,
 		},
 	)
 
@@ -316,8 +328,35 @@ func (s *NotebookService) GetAllNotebooks(db *database.Database) ([]models.Noteb
 
 func (s *NotebookService) GetNotebooks(db *database.Database, params map[string]interface{}) ([]models.Notebook, error) {
 	var notebooks []models.Notebook
-	query := db.DB
+	query, err := notebookListQuery(db, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pagedList(query, params, "created_at ASC, id ASC").Find(&notebooks).Error; err != nil {
+		return nil, err
+	}
+
+	log.Printf("Found %d notebooks owned by or shared with user %v", len(notebooks), params["user_id"])
+	return notebooks, nil
+}
+
+// CountNotebooks counts the notebooks GetNotebooks lists for params, ignoring the page
+func (s *NotebookService) CountNotebooks(db *database.Database, params map[string]interface{}) (int64, error) {
+	query, err := notebookListQuery(db, params)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	if err := query.Model(&models.Notebook{}).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
 
+// notebookListQuery filters the notebooks a user owns or holds an explicit
+// role on by the list params
+func notebookListQuery(db *database.Database, params map[string]interface{}) (*gorm.DB, error) {
 	// More robust handling of user_id parameter
 	userIDValue, userIDExists := params["user_id"]
 	if !userIDExists {
@@ -342,8 +381,11 @@ func (s *NotebookService) GetNotebooks(db *database.Database, params map[string]
 		return nil, errors.New("user_id cannot be empty")
 	}
 
-	// Apply user filter - only do this once
-	query = query.Where("user_id = ?", userIDStr)
+	// Owned notebooks and the ones shared through a role, in one query so
+	// the database can page them
+	shared := db.DB.Model(&models.Role{}).Select("resource_id").
+		Where("user_id = ? AND resource_type = ?", userIDStr, string(models.NotebookResource))
+	query := db.DB.Where("user_id = ? OR id IN (?)", userIDStr, shared)
 
 	// Apply other filters
 	if name, ok := params["name"].(string); ok && name != "" {
@@ -351,47 +393,7 @@ func (s *NotebookService) GetNotebooks(db *database.Database, params map[string]
 	}
 
 	// Include or exclude deleted notebooks
-	query = query.Where("deleted_at IS NULL")
-
-	if err := query.Find(&notebooks).Error; err != nil {
-		return nil, err
-	}
-
-	log.Printf("Found %d notebooks directly owned by user %s", len(notebooks), userIDStr)
-
-	// Also find notebooks where the user has been given an explicit role
-	roleParams := map[string]interface{}{
-		"user_id":       userIDStr,
-		"resource_type": string(models.NotebookResource),
-	}
-
-	sharedRoles, err := RoleServiceInstance.GetRoles(db, roleParams)
-	if err != nil {
-		log.Printf("Error finding role-based notebooks: %v", err)
-	} else {
-		for _, role := range sharedRoles {
-			// Skip notebooks the user already owns
-			var isOwned bool
-			for _, notebook := range notebooks {
-				if notebook.ID == role.ResourceID {
-					isOwned = true
-					break
-				}
-			}
-
-			if !isOwned {
-				var sharedNotebook models.Notebook
-				if err := db.DB.Where("id = ? AND deleted_at IS NULL", role.ResourceID).
-					First(&sharedNotebook).Error; err == nil {
-					notebooks = append(notebooks, sharedNotebook)
-				}
-			}
-		}
-		log.Printf("Found %d additional notebooks where user has an explicit role",
-			len(sharedRoles)-len(notebooks))
-	}
-
-	return notebooks, nil
+	return query.Where("deleted_at IS NULL"), nil
 }
 
 // NewNotebookService creates a new instance of NotebookService
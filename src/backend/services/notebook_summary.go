@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/prompts"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// notebookSummaryTokenBudget is the approximate number of input tokens sent
+// in a single summarization call. Larger notebooks are summarized in chunks.
+const notebookSummaryTokenBudget = 12000
+
+// notebookSummaryMaxRounds bounds the number of reduce rounds
+const notebookSummaryMaxRounds = 5
+
+// completionFunc sends a prompt to the LLM and returns the response
+type completionFunc func(ctx context.Context, prompt string) (string, error)
+
+// notebookSummaryDoc is one note prepared for summarization
+type notebookSummaryDoc struct {
+	Title   string
+	Content string
+}
+
+func (d notebookSummaryDoc) render() string {
+	return fmt.Sprintf("## %s\n%s", d.Title, d.Content)
+}
+
+// estimateTokens roughly approximates the token count of text
+func estimateTokens(text string) int {
+	return (len([]rune(text)) + 3) / 4
+}
+
+// GenerateNotebookSummary synthesizes an overview of a notebook's notes and
+// stores it on the notebook. The summary is cached against a hash of the
+// notes, so asking again before anything changed doesn't call the LLM.
+func (ai *AIService) GenerateNotebookSummary(ctx context.Context, notebookID, userID uuid.UUID) (*models.Notebook, error) {
+	var notebook models.Notebook
+	if err := ai.db.WithContext(ctx).Where("id = ? AND user_id = ?", notebookID, userID).First(&notebook).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotebookNotFound
+		}
+		return nil, err
+	}
+
+	docs, err := ai.notebookSummaryDocs(ctx, notebookID)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("%w: notebook has no notes to summarize", ErrInvalidInput)
+	}
+
+	// Regenerating an unchanged notebook would only cost another LLM call
+	parts := []string{notebook.Name, notebook.Description}
+	for _, doc := range docs {
+		parts = append(parts, doc.render())
+	}
+	hash := artifactHash(ArtifactNotebookSummary, parts...)
+
+	var summary string
+	generatedAt := time.Now()
+	if cached, ok := cachedArtifact(ctx, ai.db, ArtifactNotebookSummary, notebookID, hash); ok {
+		summary = cached.Result
+		generatedAt = cached.UpdatedAt
+	} else {
+		ctx = WithAICallUser(ctx, userID)
+		complete := func(ctx context.Context, prompt string) (string, error) {
+			return ai.GenerateResponse(ctx, prompt, nil)
+		}
+		summary, err = summarizeNotebook(ctx, notebook, docs, notebookSummaryTokenBudget, complete)
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize notebook: %w", err)
+		}
+		if err := storeArtifact(ctx, ai.db, ArtifactNotebookSummary, notebookID, hash, summary); err != nil {
+			log.Printf("Failed to cache summary of notebook %s: %v", notebookID, err)
+		}
+	}
+
+	if err := ai.db.WithContext(ctx).Model(&notebook).Updates(map[string]interface{}{
+		"ai_summary":           summary,
+		"summary_generated_at": generatedAt,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to store notebook summary: %w", err)
+	}
+	notebook.AISummary = summary
+	notebook.SummaryGeneratedAt = &generatedAt
+
+	return &notebook, nil
+}
+
+// notebookSummaryDocs loads the notebook's notes, preferring their existing
+// AI summaries over the full block content
+func (ai *AIService) notebookSummaryDocs(ctx context.Context, notebookID uuid.UUID) ([]notebookSummaryDoc, error) {
+	var notes []models.Note
+	if err := ai.db.WithContext(ctx).Scopes(models.NotTrashed).
+		Where("notebook_id = ?", notebookID).
+		Order("created_at ASC").
+		Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	if len(notes) == 0 {
+		return nil, nil
+	}
+
+	noteIDs := make([]uuid.UUID, len(notes))
+	for i, note := range notes {
+		noteIDs[i] = note.ID
+	}
+	var enhanced []models.AIEnhancedNote
+	if err := ai.db.WithContext(ctx).Where("note_id IN ? AND summary <> ''", noteIDs).Find(&enhanced).Error; err != nil {
+		return nil, err
+	}
+	summaries := make(map[uuid.UUID]string, len(enhanced))
+	for _, e := range enhanced {
+		summaries[e.NoteID] = e.Summary
+	}
+
+	docs := make([]notebookSummaryDoc, 0, len(notes))
+	for i := range notes {
+		content, ok := summaries[notes[i].ID]
+		if !ok {
+			content = ai.extractNoteContent(&notes[i])
+		}
+		if strings.TrimSpace(content) == "" && strings.TrimSpace(notes[i].Title) == "" {
+			continue
+		}
+		docs = append(docs, notebookSummaryDoc{Title: notes[i].Title, Content: content})
+	}
+	return docs, nil
+}
+
+// summarizeNotebook summarizes docs in a single call when they fit the token
+// budget, and otherwise map-reduces: each chunk is summarized on its own and
+// the partial summaries are combined until they fit.
+func summarizeNotebook(ctx context.Context, notebook models.Notebook, docs []notebookSummaryDoc, budget int, complete completionFunc) (string, error) {
+	ctx = withAICallFeature(ctx, "notebook-summary", notebook.Name, notebook.Description)
+
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = truncateToTokens(doc.render(), budget)
+	}
+
+	for round := 0; ; round++ {
+		chunks := chunkByTokens(texts, budget)
+		if len(chunks) == 1 {
+			prompt, err := prompts.Render(prompts.NotebookSummaryReduce, map[string]interface{}{
+				"Notebook":    notebook.Name,
+				"Description": notebook.Description,
+				"Notes":       chunks[0],
+			})
+			if err != nil {
+				return "", err
+			}
+			summary, err := complete(ctx, prompt)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(summary), nil
+		}
+		if round >= notebookSummaryMaxRounds {
+			return "", fmt.Errorf("notebook summary did not converge after %d rounds", round)
+		}
+
+		partials := make([]string, 0, len(chunks))
+		for i, chunk := range chunks {
+			prompt, err := prompts.Render(prompts.NotebookSummaryMap, map[string]interface{}{
+				"Notebook": notebook.Name,
+				"Part":     i + 1,
+				"Parts":    len(chunks),
+				"Notes":    chunk,
+			})
+			if err != nil {
+				return "", err
+			}
+			partial, err := complete(ctx, prompt)
+			if err != nil {
+				return "", err
+			}
+			partials = append(partials, truncateToTokens(strings.TrimSpace(partial), budget))
+		}
+		texts = partials
+	}
+}
+
+// chunkByTokens packs texts in order into chunks of at most budget tokens
+func chunkByTokens(texts []string, budget int) []string {
+	var chunks []string
+	var current strings.Builder
+	currentTokens := 0
+	for _, text := range texts {
+		tokens := estimateTokens(text)
+		if currentTokens > 0 && currentTokens+tokens > budget {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			currentTokens = 0
+		}
+		if currentTokens > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(text)
+		currentTokens += tokens
+	}
+	if currentTokens > 0 || len(chunks) == 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+// truncateToTokens cuts text so it fits within budget tokens
+func truncateToTokens(text string, budget int) string {
+	runes := []rune(text)
+	if limit := budget * 4; len(runes) > limit {
+		return string(runes[:limit])
+	}
+	return text
+}
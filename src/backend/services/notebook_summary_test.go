@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCompletion struct {
+	prompts []string
+}
+
+func (f *fakeCompletion) complete(ctx context.Context, prompt string) (string, error) {
+	f.prompts = append(f.prompts, prompt)
+	if strings.Contains(prompt, "Create an overview") {
+		return "final digest", nil
+	}
+	return fmt.Sprintf("partial %d", len(f.prompts)), nil
+}
+
+func TestSummarizeNotebook_SingleCallWithinBudget(t *testing.T) {
+	llm := &fakeCompletion{}
+	docs := []notebookSummaryDoc{{Title: "One", Content: "short"}, {Title: "Two", Content: "also short"}}
+
+	summary, err := summarizeNotebook(context.Background(), models.Notebook{Name: "Ideas"}, docs, 1000, llm.complete)
+
+	require.NoError(t, err)
+	assert.Equal(t, "final digest", summary)
+	require.Len(t, llm.prompts, 1)
+	assert.Contains(t, llm.prompts[0], "## One\nshort")
+	assert.Contains(t, llm.prompts[0], "## Two\nalso short")
+}
+
+func TestSummarizeNotebook_MapReduceOverBudget(t *testing.T) {
+	llm := &fakeCompletion{}
+	docs := make([]notebookSummaryDoc, 6)
+	for i := range docs {
+		// ~50 tokens each, two fit in a 120 token chunk
+		docs[i] = notebookSummaryDoc{Title: fmt.Sprintf("Note %d", i), Content: strings.Repeat("word ", 40)}
+	}
+
+	summary, err := summarizeNotebook(context.Background(), models.Notebook{Name: "Research"}, docs, 120, llm.complete)
+
+	require.NoError(t, err)
+	assert.Equal(t, "final digest", summary)
+	// Three map calls followed by one reduce over the partial summaries
+	require.Len(t, llm.prompts, 4)
+	for i, prompt := range llm.prompts[:3] {
+		assert.Contains(t, prompt, fmt.Sprintf("part %d of 3", i+1))
+	}
+	reduce := llm.prompts[3]
+	assert.Contains(t, reduce, "Create an overview of the notebook \"Research\"")
+	assert.Contains(t, reduce, "partial 1")
+	assert.Contains(t, reduce, "partial 2")
+	assert.Contains(t, reduce, "partial 3")
+	assert.NotContains(t, reduce, "word word")
+}
+
+func TestSummarizeNotebook_PropagatesLLMError(t *testing.T) {
+	failing := func(ctx context.Context, prompt string) (string, error) {
+		return "", errors.New("llm down")
+	}
+
+	_, err := summarizeNotebook(context.Background(), models.Notebook{Name: "Ideas"}, []notebookSummaryDoc{{Title: "One", Content: "x"}}, 100, failing)
+	assert.EqualError(t, err, "llm down")
+}
+
+func TestChunkByTokens(t *testing.T) {
+	texts := []string{strings.Repeat("a", 40), strings.Repeat("b", 40), strings.Repeat("c", 40)}
+
+	chunks := chunkByTokens(texts, 20)
+	require.Len(t, chunks, 2)
+	assert.Equal(t, strings.Repeat("a", 40)+"\n\n"+strings.Repeat("b", 40), chunks[0])
+	assert.Equal(t, strings.Repeat("c", 40), chunks[1])
+
+	assert.Equal(t, []string{""}, chunkByTokens(nil, 20))
+}
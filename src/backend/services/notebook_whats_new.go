@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/prompts"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Kinds of NotebookChange
+const (
+	NoteChangeCreated  = "created"
+	NoteChangeModified = "modified"
+)
+
+// NotebookChange is a note created or modified in a notebook
+type NotebookChange struct {
+	NoteID    uuid.UUID `json:"note_id"`
+	Title     string    `json:"title"`
+	Preview   string    `json:"preview"`
+	Change    string    `json:"change"` // NoteChangeCreated or NoteChangeModified
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	content string // The note's text, for the AI summary
+}
+
+// NotebookWhatsNew is what changed in a notebook since a point in time
+type NotebookWhatsNew struct {
+	NotebookID uuid.UUID        `json:"notebook_id"`
+	Since      *time.Time       `json:"since"` // Nil when the notebook was never visited, every note is then new
+	Changes    []NotebookChange `json:"changes"`
+	Summary    string           `json:"summary,omitempty"`
+}
+
+// NotebookChangeCount is how many notes changed in a notebook since the
+// user's last visit
+type NotebookChangeCount struct {
+	NotebookID uuid.UUID `json:"notebook_id"`
+	Name       string    `json:"name"`
+	Changes    int       `json:"changes"`
+}
+
+// GetNotebookWhatsNew lists the notes of the notebook created or modified
+// after since, most recent first. A nil since means the user's last visit,
+// see RecordNotebookVisit.
+func GetNotebookWhatsNew(ctx context.Context, db *gorm.DB, userID, notebookID uuid.UUID, since *time.Time) (*NotebookWhatsNew, error) {
+	if since == nil {
+		lastVisit, err := LastNotebookVisit(ctx, db, userID, notebookID)
+		if err != nil {
+			return nil, err
+		}
+		since = lastVisit
+	}
+
+	query := db.WithContext(ctx).Scopes(models.NotTrashed).
+		Preload("Blocks", func(db *gorm.DB) *gorm.DB { return db.Scopes(models.NotTrashed).Order(`"order"`) }).
+		Where("notebook_id = ?", notebookID)
+	if since != nil {
+		query = query.Where("updated_at > ?", *since)
+	}
+	var notes []models.Note
+	if err := query.Order("updated_at DESC").Find(&notes).Error; err != nil {
+		return nil, err
+	}
+
+	whatsNew := &NotebookWhatsNew{NotebookID: notebookID, Since: since, Changes: make([]NotebookChange, len(notes))}
+	for i, note := range notes {
+		change := NoteChangeModified
+		if since == nil || note.CreatedAt.After(*since) {
+			change = NoteChangeCreated
+		}
+		whatsNew.Changes[i] = NotebookChange{
+			NoteID:    note.ID,
+			Title:     note.Title,
+			Preview:   note.Preview,
+			Change:    change,
+			CreatedAt: note.CreatedAt,
+			UpdatedAt: note.UpdatedAt,
+			content:   renderNoteBlocks(note.Blocks, noteContentFormat()),
+		}
+	}
+	return whatsNew, nil
+}
+
+// LastNotebookVisit returns when the user last visited the notebook, nil if never
+func LastNotebookVisit(ctx context.Context, db *gorm.DB, userID, notebookID uuid.UUID) (*time.Time, error) {
+	var visit models.NotebookVisit
+	err := db.WithContext(ctx).Where("user_id = ? AND notebook_id = ?", userID, notebookID).First(&visit).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &visit.VisitedAt, nil
+}
+
+// RecordNotebookVisit stores at as the user's last visit of the notebook
+func RecordNotebookVisit(ctx context.Context, db *gorm.DB, userID, notebookID uuid.UUID, at time.Time) error {
+	visit := models.NotebookVisit{UserID: userID, NotebookID: notebookID, VisitedAt: at}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "notebook_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"visited_at"}),
+	}).Create(&visit).Error
+}
+
+// NotebookChangeCounts counts, for each notebook the user visited, the notes
+// changed since the visit. Notebooks without changes are left out.
+func NotebookChangeCounts(ctx context.Context, db *gorm.DB, userID uuid.UUID) ([]NotebookChangeCount, error) {
+	var counts []NotebookChangeCount
+	err := db.WithContext(ctx).Table("notebook_visits").
+		Select("notebooks.id AS notebook_id, notebooks.name, COUNT(notes.id) AS changes").
+		Joins("JOIN notebooks ON notebooks.id = notebook_visits.notebook_id AND notebooks.deleted_at IS NULL").
+		Joins("JOIN notes ON notes.notebook_id = notebooks.id AND notes.deleted_at IS NULL AND notes.updated_at > notebook_visits.visited_at").
+		Where("notebook_visits.user_id = ?", userID).
+		Group("notebooks.id, notebooks.name").
+		Order("changes DESC").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// SummarizeNotebookChanges has the AI write a changelog of the changes
+func (ai *AIService) SummarizeNotebookChanges(ctx context.Context, userID uuid.UUID, notebook models.Notebook, whatsNew *NotebookWhatsNew) (string, error) {
+	ctx = WithAICallUser(ctx, userID)
+	return summarizeNotebookChanges(ctx, notebook, whatsNew, func(ctx context.Context, prompt string) (string, error) {
+		return ai.GenerateResponse(ctx, prompt, nil)
+	})
+}
+
+// summarizeNotebookChanges summarizes the changed notes in a single call.
+// Past the token budget the oldest changes are cut, being listed last.
+func summarizeNotebookChanges(ctx context.Context, notebook models.Notebook, whatsNew *NotebookWhatsNew, complete completionFunc) (string, error) {
+	if len(whatsNew.Changes) == 0 {
+		return "", nil
+	}
+	ctx = withAICallFeature(ctx, "notebook-changes", notebook.Name)
+
+	texts := make([]string, len(whatsNew.Changes))
+	for i, change := range whatsNew.Changes {
+		title := change.Title
+		if strings.TrimSpace(title) == "" {
+			title = "Untitled"
+		}
+		texts[i] = notebookSummaryDoc{Title: fmt.Sprintf("%s (%s)", title, change.Change), Content: change.content}.render()
+	}
+
+	data := map[string]interface{}{
+		"Notebook": notebook.Name,
+		"Notes":    truncateToTokens(strings.Join(texts, "\n\n"), notebookSummaryTokenBudget),
+		"Since":    "",
+	}
+	if whatsNew.Since != nil {
+		data["Since"] = whatsNew.Since.Format("January 2, 2006 15:04")
+	}
+	prompt, err := prompts.Render(prompts.NotebookChanges, data)
+	if err != nil {
+		return "", err
+	}
+	summary, err := complete(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(summary), nil
+}
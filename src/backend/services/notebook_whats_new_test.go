@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetNotebookWhatsNew_OnlyNotesChangedSinceAreSummarized(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID, notebookID := uuid.New(), uuid.New()
+	since := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	createdID, modifiedID := uuid.New(), uuid.New()
+
+	// The database only returns notes updated after since
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE notebook_id = \$1 AND updated_at > \$2 AND "notes"."deleted_at" IS NULL ORDER BY updated_at DESC`).
+		WithArgs(notebookID, since).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notebook_id", "title", "created_at", "updated_at"}).
+			AddRow(createdID, notebookID, "Launch plan", since.Add(2*time.Hour), since.Add(2*time.Hour)).
+			AddRow(modifiedID, notebookID, "Budget", since.Add(-48*time.Hour), since.Add(time.Hour)))
+	// Trashed blocks stay out of the summary too
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE "blocks"."note_id" IN \(\$1,\$2\) AND "blocks"."deleted_at" IS NULL ORDER BY "order"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "type", "content", "order"}).
+			AddRow(uuid.New(), createdID, "text", []byte(`{"text":"Ship on Friday"}`), 1).
+			AddRow(uuid.New(), modifiedID, "text", []byte(`{"text":"Cut travel costs"}`), 1))
+
+	whatsNew, err := GetNotebookWhatsNew(context.Background(), db.DB, userID, notebookID, &since)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Len(t, whatsNew.Changes, 2)
+	assert.Equal(t, createdID, whatsNew.Changes[0].NoteID)
+	assert.Equal(t, NoteChangeCreated, whatsNew.Changes[0].Change)
+	assert.Equal(t, modifiedID, whatsNew.Changes[1].NoteID)
+	assert.Equal(t, NoteChangeModified, whatsNew.Changes[1].Change, "a note created before since was modified")
+
+	var prompts []string
+	summary, err := summarizeNotebookChanges(context.Background(), models.Notebook{Name: "Project"}, whatsNew,
+		func(ctx context.Context, prompt string) (string, error) {
+			prompts = append(prompts, prompt)
+			return " Launch moved up, budget trimmed. ", nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "Launch moved up, budget trimmed.", summary)
+
+	require.Len(t, prompts, 1)
+	assert.Contains(t, prompts[0], `"Project" since May 1, 2024 09:00`)
+	assert.Contains(t, prompts[0], "## Launch plan (created)\nShip on Friday")
+	assert.Contains(t, prompts[0], "## Budget (modified)\nCut travel costs")
+}
+
+func TestGetNotebookWhatsNew_DefaultsToLastVisit(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID, notebookID := uuid.New(), uuid.New()
+	visitedAt := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT \* FROM "notebook_visits" WHERE user_id = \$1 AND notebook_id = \$2`).
+		WithArgs(userID, notebookID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "notebook_id", "visited_at"}).AddRow(userID, notebookID, visitedAt))
+	mock.ExpectQuery(`SELECT \* FROM "notes" .* updated_at > \$2`).
+		WithArgs(notebookID, visitedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	whatsNew, err := GetNotebookWhatsNew(context.Background(), db.DB, userID, notebookID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, visitedAt, *whatsNew.Since)
+	assert.Empty(t, whatsNew.Changes)
+
+	// Nothing changed, so the AI isn't asked
+	summary, err := summarizeNotebookChanges(context.Background(), models.Notebook{}, whatsNew,
+		func(ctx context.Context, prompt string) (string, error) {
+			t.Fatal("summary requested without changes")
+			return "", nil
+		})
+	require.NoError(t, err)
+	assert.Empty(t, summary)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetNotebookWhatsNew_NeverVisitedListsEveryNote(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID, notebookID := uuid.New(), uuid.New()
+	mock.ExpectQuery(`SELECT \* FROM "notebook_visits"`).WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE notebook_id = \$1 AND "notes"."deleted_at" IS NULL ORDER BY updated_at DESC`).
+		WithArgs(notebookID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(uuid.New(), time.Now(), time.Now()))
+	mock.ExpectQuery(`SELECT \* FROM "blocks"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	whatsNew, err := GetNotebookWhatsNew(context.Background(), db.DB, userID, notebookID, nil)
+	require.NoError(t, err)
+	assert.Nil(t, whatsNew.Since)
+	require.Len(t, whatsNew.Changes, 1)
+	assert.Equal(t, NoteChangeCreated, whatsNew.Changes[0].Change)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
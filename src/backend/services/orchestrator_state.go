@@ -0,0 +1,93 @@
+package services
+
+import (
+	"sort"
+	"time"
+)
+
+// OrchestratorExecutionState describes an execution held in memory
+type OrchestratorExecutionState struct {
+	ID         string    `json:"id"`
+	ChainID    string    `json:"chain_id"`
+	Status     string    `json:"status"`
+	StartTime  time.Time `json:"start_time"`
+	AgeSeconds float64   `json:"age_seconds"`
+}
+
+// OrchestratorChainState describes a chain cached for execution
+type OrchestratorChainState struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+	AgeSeconds float64   `json:"age_seconds"`
+}
+
+// OrchestratorState reports the orchestrator's in-memory maps
+type OrchestratorState struct {
+	ActiveExecutions int                          `json:"active_executions"`
+	CachedChains     int                          `json:"cached_chains"`
+	RegisteredAgents int                          `json:"registered_agents"`
+	Executions       []OrchestratorExecutionState `json:"executions"`
+	Chains           []OrchestratorChainState     `json:"chains"`
+}
+
+// State reports the executions and chains held in memory, oldest first.
+// Chains without a creation time report an age of 0.
+func (o *AgentOrchestrator) State() OrchestratorState {
+	now := time.Now()
+
+	o.stateMu.Lock()
+	state := OrchestratorState{
+		ActiveExecutions: len(o.activeExecutions),
+		CachedChains:     len(o.activeChains),
+		RegisteredAgents: len(o.registeredAgents),
+		Executions:       make([]OrchestratorExecutionState, 0, len(o.activeExecutions)),
+		Chains:           make([]OrchestratorChainState, 0, len(o.activeChains)),
+	}
+	for _, execution := range o.activeExecutions {
+		state.Executions = append(state.Executions, OrchestratorExecutionState{
+			ID:         execution.ID,
+			ChainID:    execution.ChainID,
+			Status:     execution.Status,
+			StartTime:  execution.StartTime,
+			AgeSeconds: now.Sub(execution.StartTime).Seconds(),
+		})
+	}
+	for _, chain := range o.activeChains {
+		chainState := OrchestratorChainState{ID: chain.ID, Name: chain.Name, CreatedAt: chain.CreatedAt}
+		if !chain.CreatedAt.IsZero() {
+			chainState.AgeSeconds = now.Sub(chain.CreatedAt).Seconds()
+		}
+		state.Chains = append(state.Chains, chainState)
+	}
+	o.stateMu.Unlock()
+
+	sort.Slice(state.Executions, func(i, j int) bool {
+		return state.Executions[i].StartTime.Before(state.Executions[j].StartTime)
+	})
+	sort.Slice(state.Chains, func(i, j int) bool {
+		return state.Chains[i].AgeSeconds > state.Chains[j].AgeSeconds
+	})
+	return state
+}
+
+// CollectStaleExecutions removes executions started more than olderThan ago,
+// with their chains, and returns the removed execution IDs. An execution
+// still running when removed finishes normally but can no longer be polled.
+func (o *AgentOrchestrator) CollectStaleExecutions(olderThan time.Duration) []string {
+	cutoff := time.Now().Add(-olderThan)
+
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+
+	removed := []string{}
+	for id, execution := range o.activeExecutions {
+		if execution.StartTime.Before(cutoff) {
+			delete(o.activeExecutions, id)
+			delete(o.activeChains, execution.ChainID)
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
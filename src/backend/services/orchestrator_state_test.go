@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// panickingAgent panics instead of returning
+type panickingAgent struct{}
+
+func (panickingAgent) Execute(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+	panic("agent blew up")
+}
+
+func (panickingAgent) GetType() AgentType {
+	return "panicking"
+}
+
+func (panickingAgent) Name() string {
+	return "Panicking Agent"
+}
+
+func (panickingAgent) Description() string {
+	return "Panics when executed"
+}
+
+func (panickingAgent) InputSchema() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+// blockingAgent waits for its context to end and reports why it ended
+type blockingAgent struct {
+	started chan struct{}
+	done    chan error
+}
+
+func (a blockingAgent) Execute(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+	close(a.started)
+	<-ctx.Done()
+	a.done <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func (blockingAgent) GetType() AgentType {
+	return "blocking"
+}
+
+func (blockingAgent) Name() string {
+	return "Blocking Agent"
+}
+
+func (blockingAgent) Description() string {
+	return "Runs until its context ends"
+}
+
+func (blockingAgent) InputSchema() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+// panickingOutputStore panics while the orchestrator stores an oversized
+// output, outside of any agent
+type panickingOutputStore struct{}
+
+func (panickingOutputStore) Save(ctx context.Context, key string, data []byte) (string, error) {
+	panic("store blew up")
+}
+
+func TestExecuteChain_PanickingAgentFailsExecution(t *testing.T) {
+	for _, mode := range []ChainExecutionMode{ChainModeSequential, ChainModeParallel} {
+		t.Run(string(mode), func(t *testing.T) {
+			o, mock, chainID, _ := newTestOrchestrator(t)
+			o.registeredAgents["panicking"] = panickingAgent{}
+			o.activeChains[chainID].Mode = mode
+			o.activeChains[chainID].Agents = []AgentDefinition{
+				{ID: "boom", Type: "panicking", Name: "Boom", OutputKey: "boom", RetryPolicy: RetryPolicy{MaxRetries: 2}},
+			}
+
+			result, err := o.ExecuteChain(context.Background(), ChainExecutionRequest{ChainID: chainID, UserID: uuid.New()})
+
+			require.Error(t, err)
+			assert.Equal(t, "failed", result.Status)
+			assert.NotNil(t, result.EndTime)
+			// Panics are not retried
+			require.Len(t, result.ExecutionLog, 1)
+			assert.Equal(t, "failed", result.ExecutionLog[0].Status)
+			// Sequential chains fail with the agent's error, parallel ones list it
+			messages := err.Error()
+			for _, agentErr := range result.Errors {
+				messages += "\n" + agentErr.Error
+			}
+			assert.Contains(t, messages, "agent panicked: agent blew up")
+			assert.Empty(t, o.GetActiveExecutions())
+			assert.Equal(t, 0, o.State().CachedChains)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestExecuteChain_RecoversPanicOutsideAgents(t *testing.T) {
+	o, mock, chainID, _ := newTestOrchestrator(t)
+	o.outputLimits = AgentOutputLimits{MaxChars: 10, Store: panickingOutputStore{}}
+	o.registeredAgents["fixed_output"] = fixedOutputAgent{output: strings.Repeat("x", 100)}
+	o.activeChains[chainID].Agents = []AgentDefinition{
+		{ID: "big", Type: "fixed_output", Name: "Big", OutputKey: "big_output"},
+	}
+
+	var result *ChainExecutionResult
+	var err error
+	require.NotPanics(t, func() {
+		result, err = o.ExecuteChain(context.Background(), ChainExecutionRequest{ChainID: chainID, UserID: uuid.New()})
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "store blew up")
+	assert.Equal(t, "failed", result.Status)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0].Error, "chain execution panicked")
+	assert.Empty(t, o.GetActiveExecutions())
+	// The failure is persisted like any other
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecuteChain_CancelReachesRunningAgent(t *testing.T) {
+	o, _, chainID, _ := newTestOrchestrator(t)
+	agent := blockingAgent{started: make(chan struct{}), done: make(chan error, 1)}
+	o.registeredAgents["blocking"] = agent
+	o.activeChains[chainID].Agents = []AgentDefinition{
+		{ID: "wait", Type: "blocking", Name: "Wait", OutputKey: "wait"},
+	}
+	save := false
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	finished := make(chan error, 1)
+	go func() {
+		_, err := o.ExecuteChain(ctx, ChainExecutionRequest{ChainID: chainID, UserID: uuid.New(), SaveAsNotebook: &save})
+		finished <- err
+	}()
+
+	<-agent.started
+	cancel()
+
+	select {
+	case err := <-agent.done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent did not see the chain being cancelled")
+	}
+	assert.Error(t, <-finished)
+}
+
+func TestOrchestratorState_WhileChainCompletes(t *testing.T) {
+	o, mock, chainID, _ := newTestOrchestrator(t)
+	o.registeredAgents["fixed_output"] = fixedOutputAgent{output: "done", delay: 20 * time.Millisecond}
+	o.activeChains[chainID].Agents = []AgentDefinition{
+		{ID: "quick", Type: "fixed_output", Name: "Quick", OutputKey: "quick"},
+	}
+	save := false
+
+	// Run with -race: State reads each status as the chain finishes
+	stop := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				o.State()
+			}
+		}
+	}()
+
+	result, err := o.ExecuteChain(context.Background(), ChainExecutionRequest{ChainID: chainID, UserID: uuid.New(), SaveAsNotebook: &save})
+	close(stop)
+	<-polled
+
+	require.NoError(t, err)
+	assert.Equal(t, "completed", result.Status)
+	assert.NotNil(t, result.EndTime)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecuteChain_LoadErrorDoesNotLeakExecution(t *testing.T) {
+	o, _, _, _ := newTestOrchestrator(t)
+
+	result, err := o.ExecuteChain(context.Background(), ChainExecutionRequest{ChainID: "missing-chain"})
+	require.Error(t, err)
+	assert.Equal(t, "failed", result.Status)
+	assert.Empty(t, o.GetActiveExecutions())
+}
+
+func TestOrchestratorState_AndCollectStaleExecutions(t *testing.T) {
+	o, _, chainID, _ := newTestOrchestrator(t)
+	o.activeChains[chainID].CreatedAt = time.Now().Add(-3 * time.Hour)
+	o.activeExecutions["stale"] = &ChainExecutionResult{ID: "stale", ChainID: chainID, Status: "running", StartTime: time.Now().Add(-2 * time.Hour)}
+	o.activeExecutions["recent"] = &ChainExecutionResult{ID: "recent", ChainID: "other-chain", Status: "running", StartTime: time.Now().Add(-time.Minute)}
+
+	state := o.State()
+	assert.Equal(t, 2, state.ActiveExecutions)
+	assert.Equal(t, 1, state.CachedChains)
+	require.Len(t, state.Executions, 2)
+	assert.Equal(t, "stale", state.Executions[0].ID)
+	assert.InDelta(t, 7200, state.Executions[0].AgeSeconds, 5)
+	require.Len(t, state.Chains, 1)
+	assert.InDelta(t, 3*3600, state.Chains[0].AgeSeconds, 5)
+
+	removed := o.CollectStaleExecutions(time.Hour)
+
+	assert.Equal(t, []string{"stale"}, removed)
+	state = o.State()
+	assert.Equal(t, 1, state.ActiveExecutions)
+	assert.Equal(t, "recent", state.Executions[0].ID)
+	assert.Equal(t, 0, state.CachedChains)
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/prompts"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -63,6 +64,7 @@ type ReasoningContext struct {
 	Resources      map[string]interface{}   `json:"resources"`
 	MaxSteps       int                      `json:"max_steps"`
 	Strategy       string                   `json:"strategy"` // methodical, exploratory, focused
+	Assessment     *ReasoningAssessment     `json:"assessment,omitempty"` // Set once the loop ended
 }
 
 func NewReasoningAgentService(db *gorm.DB, ai *AIService, noteService *NoteService) *ReasoningAgentService {
@@ -75,6 +77,18 @@ func NewReasoningAgentService(db *gorm.DB, ai *AIService, noteService *NoteServi
 
 // ExecuteReasoningLoop runs a complete reasoning loop for a given goal
 func (r *ReasoningAgentService) ExecuteReasoningLoop(ctx context.Context, userID uuid.UUID, goal string, initialContext string, strategy string) (*models.AIAgent, error) {
+	return r.ExecuteReasoningLoopWithOptions(ctx, userID, goal, initialContext, strategy, ReasoningOptions{})
+}
+
+// ExecuteReasoningLoopWithOptions runs a reasoning loop, writing it up as a
+// note when opts ask for it. The note's ID is added to the output data.
+func (r *ReasoningAgentService) ExecuteReasoningLoopWithOptions(ctx context.Context, userID uuid.UUID, goal string, initialContext string, strategy string, opts ReasoningOptions) (*models.AIAgent, error) {
+	if err := r.checkReasoningNotebook(userID, opts); err != nil {
+		return nil, err
+	}
+
+	ctx = WithAICallUser(ctx, userID)
+
 	// Create agent record
 	agent := &models.AIAgent{
 		UserID:    userID,
@@ -108,8 +122,11 @@ func (r *ReasoningAgentService) ExecuteReasoningLoop(ctx context.Context, userID
 		reasoningCtx.Strategy = "methodical"
 	}
 
-	// Execute reasoning loop
+	// Execute reasoning loop, then assess how far it got
 	err := r.runReasoningLoop(ctx, agent, reasoningCtx)
+	if err == nil {
+		reasoningCtx.Assessment = r.assessOutcome(ctx, reasoningCtx)
+	}
 	
 	// Update agent record
 	agent.CompletedAt = &[]time.Time{time.Now()}[0]
@@ -125,6 +142,19 @@ func (r *ReasoningAgentService) ExecuteReasoningLoop(ctx context.Context, userID
 		"learnings":   reasoningCtx.Learnings,
 		"total_steps": len(reasoningCtx.Steps),
 	}
+	if reasoningCtx.Assessment != nil {
+		agent.OutputData["assessment"] = reasoningCtx.Assessment
+	}
+
+	// A note failing to save doesn't fail the run
+	if opts.SaveAsNote {
+		if note, noteErr := r.saveReasoningNote(ctx, agent, reasoningCtx, opts); noteErr != nil {
+			log.Printf("Failed to save reasoning note for agent %s: %v", agent.ID, noteErr)
+		} else {
+			agent.OutputData["note_id"] = note.ID.String()
+			agent.OutputData["notebook_id"] = note.NotebookID.String()
+		}
+	}
 
 	if err := r.db.Save(agent).Error; err != nil {
 		log.Printf("Failed to update agent record: %v", err)
@@ -196,31 +226,18 @@ func (r *ReasoningAgentService) runReasoningLoop(ctx context.Context, agent *mod
 
 // analyzeCurrentState analyzes the current state of the reasoning process
 func (r *ReasoningAgentService) analyzeCurrentState(ctx context.Context, reasoningCtx *ReasoningContext) (*ReasoningStep, error) {
-	prompt := fmt.Sprintf(`You are a reasoning agent analyzing the current state of problem-solving.
-
-Goal: %s
-Initial Context: %s
-Current State: %s
-Strategy: %s
-
-Previous Steps Taken: %d
-
-Recent Learnings:
-%s
-
-Analyze the current situation and provide:
-1. Current understanding of the problem
-2. Progress made so far
-3. Key obstacles or challenges
-4. Available resources or information
-
-Provide your analysis in a structured format.`, 
-		reasoningCtx.Goal,
-		reasoningCtx.InitialContext,
-		reasoningCtx.CurrentState,
-		reasoningCtx.Strategy,
-		len(reasoningCtx.Steps),
-		strings.Join(reasoningCtx.Learnings[max(0, len(reasoningCtx.Learnings)-5):], "\n"))
+	ctx = withAICallFeature(ctx, prompts.ReasoningAnalyze, reasoningCtx.Goal, reasoningCtx.InitialContext)
+	prompt, err := prompts.Render(prompts.ReasoningAnalyze, map[string]interface{}{
+		"Goal":           reasoningCtx.Goal,
+		"InitialContext": reasoningCtx.InitialContext,
+		"CurrentState":   reasoningCtx.CurrentState,
+		"Strategy":       reasoningCtx.Strategy,
+		"StepCount":      len(reasoningCtx.Steps),
+		"Learnings":      strings.Join(reasoningCtx.Learnings[max(0, len(reasoningCtx.Learnings)-5):], "\n"),
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	analysis, err := r.ai.callAnthropic(ctx, prompt, 500)
 	if err != nil {
@@ -251,27 +268,15 @@ func (r *ReasoningAgentService) planNextActions(ctx context.Context, reasoningCt
 		}
 	}
 
-	prompt := fmt.Sprintf(`You are a strategic planner for a reasoning agent.
-
-Goal: %s
-Strategy: %s
-Current Analysis: %s
-
-Based on the analysis, plan the next 1-3 concrete actions to make progress toward the goal.
-
-Consider the %s strategy:
-- methodical: Step-by-step, thorough approach
-- exploratory: Try multiple approaches, gather information
-- focused: Direct path to goal, minimize steps
-
-Return a JSON array of action strings. Each action should be specific and actionable.
-Example: ["Research X topic in notes", "Create summary of findings", "Generate hypothesis"]
-
-Actions:`, 
-		reasoningCtx.Goal,
-		reasoningCtx.Strategy,
-		recentAnalysis,
-		reasoningCtx.Strategy)
+	ctx = withAICallFeature(ctx, prompts.ReasoningPlan, reasoningCtx.Goal)
+	prompt, err := prompts.Render(prompts.ReasoningPlan, map[string]interface{}{
+		"Goal":     reasoningCtx.Goal,
+		"Strategy": reasoningCtx.Strategy,
+		"Analysis": recentAnalysis,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	response, err := r.ai.callAnthropic(ctx, prompt, 200)
 	if err != nil {
@@ -394,13 +399,15 @@ func (r *ReasoningAgentService) executeSearchAction(ctx context.Context, reasoni
 // executeCreateAction handles creation-related actions
 func (r *ReasoningAgentService) executeCreateAction(ctx context.Context, reasoningCtx *ReasoningContext, action string) (string, error) {
 	// Generate content based on action
-	prompt := fmt.Sprintf(`Create content based on this action: %s
-
-Context:
-Goal: %s
-Current Resources: %v
-
-Generate appropriate content.`, action, reasoningCtx.Goal, reasoningCtx.Resources)
+	ctx = withAICallFeature(ctx, prompts.ReasoningCreate, reasoningCtx.Goal)
+	prompt, err := prompts.Render(prompts.ReasoningCreate, map[string]interface{}{
+		"Action":    action,
+		"Goal":      reasoningCtx.Goal,
+		"Resources": fmt.Sprintf("%v", reasoningCtx.Resources),
+	})
+	if err != nil {
+		return "", err
+	}
 
 	content, err := r.ai.callAnthropic(ctx, prompt, 500)
 	if err != nil {
@@ -417,24 +424,15 @@ Generate appropriate content.`, action, reasoningCtx.Goal, reasoningCtx.Resource
 func (r *ReasoningAgentService) reflectOnResults(ctx context.Context, reasoningCtx *ReasoningContext) (*ReasoningStep, error) {
 	recentSteps := reasoningCtx.Steps[max(0, len(reasoningCtx.Steps)-4):]
 	
-	prompt := fmt.Sprintf(`Reflect on the recent actions and their results.
-
-Goal: %s
-Recent Steps: %d
-
-Recent Actions and Results:
-%s
-
-Provide insights on:
-1. What worked well?
-2. What didn't work as expected?
-3. What new information was discovered?
-4. How should the approach be adjusted?
-
-Be concise and focus on actionable insights.`,
-		reasoningCtx.Goal,
-		len(recentSteps),
-		r.formatRecentSteps(recentSteps))
+	ctx = withAICallFeature(ctx, prompts.ReasoningReflect, reasoningCtx.Goal)
+	prompt, err := prompts.Render(prompts.ReasoningReflect, map[string]interface{}{
+		"Goal":        reasoningCtx.Goal,
+		"StepCount":   len(recentSteps),
+		"RecentSteps": r.formatRecentSteps(recentSteps),
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	reflection, err := r.ai.callAnthropic(ctx, prompt, 300)
 	if err != nil {
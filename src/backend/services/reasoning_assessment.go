@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"owlistic-notes/owlistic/prompts"
+)
+
+// Why a reasoning loop ended
+const (
+	ReasoningEndGoalAchieved = "goal_achieved"
+	ReasoningEndStagnated    = "stagnated"
+	ReasoningEndMaxSteps     = "max_steps"
+)
+
+// maxAssessmentNextSteps caps the next steps kept from an assessment
+const maxAssessmentNextSteps = 5
+
+// ReasoningAssessment says how complete the result of a reasoning run is and
+// what to do next, so users can tell whether continuing the loop is worth it
+type ReasoningAssessment struct {
+	Confidence   float64  `json:"confidence"` // 0 to 1, how well the goal was met
+	Accomplished string   `json:"accomplished"`
+	NextSteps    []string `json:"next_steps"`
+	EndReason    string   `json:"end_reason"`          // goal_achieved, stagnated or max_steps
+	Estimated    bool     `json:"estimated,omitempty"` // Set when the model gave no assessment
+}
+
+// reasoningEndReason tells why the loop stopped from its final state
+func reasoningEndReason(reasoningCtx *ReasoningContext) string {
+	switch reasoningCtx.CurrentState {
+	case ReasoningEndGoalAchieved, ReasoningEndStagnated:
+		return reasoningCtx.CurrentState
+	}
+	return ReasoningEndMaxSteps
+}
+
+// assessOutcome asks the model for a final assessment of the run. When the
+// model fails or its answer can't be read, the assessment is estimated from
+// why the run ended and is marked as such.
+func (r *ReasoningAgentService) assessOutcome(ctx context.Context, reasoningCtx *ReasoningContext) *ReasoningAssessment {
+	endReason := reasoningEndReason(reasoningCtx)
+
+	assessment, err := r.requestAssessment(ctx, reasoningCtx, endReason)
+	if err != nil {
+		log.Printf("Reasoning assessment failed, estimating it: %v", err)
+		return estimatedAssessment(reasoningCtx, endReason)
+	}
+	assessment.EndReason = endReason
+	return assessment
+}
+
+func (r *ReasoningAgentService) requestAssessment(ctx context.Context, reasoningCtx *ReasoningContext, endReason string) (*ReasoningAssessment, error) {
+	recentSteps := reasoningCtx.Steps[max(0, len(reasoningCtx.Steps)-4):]
+
+	ctx = withAICallFeature(ctx, prompts.ReasoningAssess, reasoningCtx.Goal)
+	prompt, err := prompts.Render(prompts.ReasoningAssess, map[string]interface{}{
+		"Goal":        reasoningCtx.Goal,
+		"Strategy":    reasoningCtx.Strategy,
+		"StepCount":   reasoningStepCount(reasoningCtx),
+		"MaxSteps":    reasoningCtx.MaxSteps,
+		"EndReason":   strings.ReplaceAll(endReason, "_", " "),
+		"RecentSteps": r.formatRecentSteps(recentSteps),
+		"Learnings":   reasoningCtx.Learnings,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := r.ai.callAnthropic(ctx, prompt, 400)
+	if err != nil {
+		return nil, err
+	}
+	return parseReasoningAssessment(response)
+}
+
+// parseReasoningAssessment reads the model's JSON answer, clamping the
+// confidence to [0, 1] and dropping blank next steps
+func parseReasoningAssessment(response string) (*ReasoningAssessment, error) {
+	response = strings.TrimSpace(response)
+	response = strings.TrimPrefix(response, "```json")
+	response = strings.TrimPrefix(response, "```")
+	response = strings.TrimSuffix(response, "```")
+
+	var answer struct {
+		Confidence   *float64 `json:"confidence"`
+		Accomplished string   `json:"accomplished"`
+		NextSteps    []string `json:"next_steps"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(response)), &answer); err != nil {
+		return nil, fmt.Errorf("invalid reasoning assessment: %w", err)
+	}
+	if answer.Confidence == nil {
+		return nil, fmt.Errorf("invalid reasoning assessment: no confidence")
+	}
+
+	assessment := &ReasoningAssessment{
+		Confidence:   clampConfidence(*answer.Confidence),
+		Accomplished: strings.TrimSpace(answer.Accomplished),
+		NextSteps:    []string{},
+	}
+	for _, step := range answer.NextSteps {
+		if step = strings.TrimSpace(step); step != "" && len(assessment.NextSteps) < maxAssessmentNextSteps {
+			assessment.NextSteps = append(assessment.NextSteps, step)
+		}
+	}
+	return assessment, nil
+}
+
+// estimatedAssessment stands in for the model's assessment, rating the run
+// by why it ended
+func estimatedAssessment(reasoningCtx *ReasoningContext, endReason string) *ReasoningAssessment {
+	assessment := &ReasoningAssessment{
+		Accomplished: fmt.Sprintf("Completed %d reasoning step(s) with %d learning(s) recorded.",
+			reasoningStepCount(reasoningCtx), len(reasoningCtx.Learnings)),
+		EndReason: endReason,
+		Estimated: true,
+	}
+	switch endReason {
+	case ReasoningEndGoalAchieved:
+		assessment.Confidence = 0.8
+		assessment.NextSteps = []string{"Review the result and act on it"}
+	case ReasoningEndStagnated:
+		assessment.Confidence = 0.3
+		assessment.NextSteps = []string{"Continue with a different strategy or more context, the last steps repeated themselves"}
+	default:
+		assessment.Confidence = 0.5
+		assessment.NextSteps = []string{"Continue the reasoning loop, it ran out of steps before finishing"}
+	}
+	return assessment
+}
+
+// reasoningStepCount is the number of loop iterations, each of which has
+// several phases
+func reasoningStepCount(reasoningCtx *ReasoningContext) int {
+	if len(reasoningCtx.Steps) == 0 {
+		return 0
+	}
+	return reasoningCtx.Steps[len(reasoningCtx.Steps)-1].StepNumber
+}
+
+func clampConfidence(confidence float64) float64 {
+	if confidence < 0 {
+		return 0
+	}
+	if confidence > 1 {
+		return 1
+	}
+	return confidence
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteReasoningLoop_OutputHasAssessment(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "ai_agents"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "ai_agents"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// The analysis saying the goal is achieved ends the loop after one step;
+	// the same answer is then read as the assessment
+	ai, prompt := newStubAIService(t, "```json\n"+`{"confidence": 1.4, "accomplished": "Goal achieved: a watering plan for the balcony",
+		"next_steps": ["Buy a drip kit", " ", "Check the plants in a week"]}`+"\n```")
+	ai.db = db.DB
+	service := NewReasoningAgentService(db.DB, ai, nil)
+
+	agent, err := service.ExecuteReasoningLoop(context.Background(), uuid.New(), "Plan balcony watering", "", "")
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Contains(t, *prompt, "Why it ended: goal achieved")
+
+	assessment, ok := agent.OutputData["assessment"].(*ReasoningAssessment)
+	require.True(t, ok, "the output carries the assessment")
+	assert.Equal(t, 1.0, assessment.Confidence, "confidence is clamped to 1")
+	assert.Equal(t, "Goal achieved: a watering plan for the balcony", assessment.Accomplished)
+	assert.Equal(t, []string{"Buy a drip kit", "Check the plants in a week"}, assessment.NextSteps)
+	assert.Equal(t, ReasoningEndGoalAchieved, assessment.EndReason)
+	assert.False(t, assessment.Estimated)
+}
+
+func TestAssessment_EstimatedWhenAnswerIsUnreadable(t *testing.T) {
+	_, err := parseReasoningAssessment("I think it went fine")
+	assert.Error(t, err)
+	_, err = parseReasoningAssessment(`{"accomplished": "something"}`)
+	assert.Error(t, err, "an answer without a confidence isn't an assessment")
+
+	reasoningCtx := &ReasoningContext{
+		CurrentState: "analyzing",
+		Steps:        []ReasoningStep{{StepNumber: 1}, {StepNumber: 2}},
+		Learnings:    []string{"a", "b", "c"},
+	}
+	assessment := estimatedAssessment(reasoningCtx, reasoningEndReason(reasoningCtx))
+	assert.True(t, assessment.Estimated)
+	assert.Equal(t, ReasoningEndMaxSteps, assessment.EndReason)
+	assert.Equal(t, 0.5, assessment.Confidence)
+	assert.Equal(t, "Completed 2 reasoning step(s) with 3 learning(s) recorded.", assessment.Accomplished)
+	assert.NotEmpty(t, assessment.NextSteps)
+}
+
+func TestReasoningNoteBlocks_Assessment(t *testing.T) {
+	reasoningCtx := &ReasoningContext{
+		Goal:         "Plan a garden",
+		CurrentState: ReasoningEndStagnated,
+		Assessment: &ReasoningAssessment{
+			Confidence:   0.35,
+			Accomplished: "Picked the plants",
+			NextSteps:    []string{"Measure the balcony"},
+			EndReason:    ReasoningEndStagnated,
+		},
+	}
+
+	var texts []string
+	for _, block := range reasoningNoteBlocks(reasoningCtx, "completed", uuid.New(), uuid.New()) {
+		texts = append(texts, block.Content["text"].(string))
+		if block.Type == models.ListItemBlock {
+			assert.Equal(t, "Measure the balcony", block.Content["text"])
+		}
+	}
+	assert.Contains(t, texts, "Assessment")
+	assert.Contains(t, texts, "Confidence: 35%")
+	assert.Contains(t, texts, "Accomplished: Picked the plants")
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// reasoningNotebookName is the notebook reasoning notes go to when the
+// request doesn't name one
+const reasoningNotebookName = "💭 Reasoning"
+
+// ReasoningOptions are optional settings of a reasoning run
+type ReasoningOptions struct {
+	SaveAsNote bool      // Write the run up as a note
+	NotebookID uuid.UUID // Notebook of the note, the user's reasoning notebook when unset
+}
+
+// reasoningPhaseTitles are the headings of each phase of a step, in loop order
+var reasoningPhaseTitles = map[string]string{
+	"analyze": "🔍 Analyze",
+	"plan":    "🗺️ Plan",
+	"execute": "⚙️ Execute",
+	"reflect": "🪞 Reflect",
+}
+
+// checkReasoningNotebook requires the user to be able to add notes to the
+// notebook a reasoning note is saved in
+func (r *ReasoningAgentService) checkReasoningNotebook(userID uuid.UUID, opts ReasoningOptions) error {
+	if !opts.SaveAsNote || opts.NotebookID == uuid.Nil {
+		return nil
+	}
+
+	hasAccess, err := RoleServiceInstance.HasAccessByStrings(&database.Database{DB: r.db}, userID.String(), opts.NotebookID.String(), string(models.NotebookResource), "editor")
+	if err != nil {
+		return err
+	}
+	if !hasAccess {
+		return ErrInsufficientAccess
+	}
+	return nil
+}
+
+// saveReasoningNote writes the run up as a note, in the requested notebook or
+// the user's reasoning notebook
+func (r *ReasoningAgentService) saveReasoningNote(ctx context.Context, agent *models.AIAgent, reasoningCtx *ReasoningContext, opts ReasoningOptions) (*models.Note, error) {
+	dbWrapper := &database.Database{DB: r.db.WithContext(ctx)}
+
+	notebookID := opts.NotebookID
+	if notebookID == uuid.Nil {
+		notebook, err := r.getOrCreateReasoningNotebook(ctx, agent.UserID)
+		if err != nil {
+			return nil, err
+		}
+		notebookID = notebook.ID
+	}
+
+	note, err := r.noteService.CreateNote(dbWrapper, map[string]interface{}{
+		"title":       reasoningNoteTitle(reasoningCtx.Goal),
+		"user_id":     agent.UserID.String(),
+		"notebook_id": notebookID.String(),
+		"source":      "reasoning_agent",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reasoning note: %w", err)
+	}
+
+	for _, block := range reasoningNoteBlocks(reasoningCtx, agent.Status, agent.UserID, note.ID) {
+		if err := dbWrapper.DB.Create(&block).Error; err != nil {
+			return &note, fmt.Errorf("failed to add reasoning note content: %w", err)
+		}
+	}
+	refreshNotePreview(dbWrapper.DB, note.ID)
+
+	return &note, nil
+}
+
+// reasoningNoteTitle names the note after the goal's first line
+func reasoningNoteTitle(goal string) string {
+	title := strings.TrimSpace(strings.SplitN(strings.TrimSpace(goal), "\n", 2)[0])
+	if runes := []rune(title); len(runes) > 80 {
+		title = string(runes[:80]) + "..."
+	}
+	return "Reasoning: " + title
+}
+
+// getOrCreateReasoningNotebook returns the user's reasoning notebook
+func (r *ReasoningAgentService) getOrCreateReasoningNotebook(ctx context.Context, userID uuid.UUID) (*models.Notebook, error) {
+	var notebook models.Notebook
+	if err := r.db.WithContext(ctx).Where("user_id = ? AND name = ?", userID, reasoningNotebookName).First(&notebook).Error; err == nil {
+		return &notebook, nil
+	}
+
+	notebook = models.Notebook{
+		UserID:      userID,
+		Name:        reasoningNotebookName,
+		Description: "Write-ups of reasoning agent runs",
+	}
+	if err := r.db.WithContext(ctx).Create(&notebook).Error; err != nil {
+		return nil, fmt.Errorf("failed to create reasoning notebook: %w", err)
+	}
+	return &notebook, nil
+}
+
+// reasoningNoteBlocks lays a run out as an overview, a section per step with
+// its analyze, plan, execute and reflect phases, the learnings, the
+// assessment and the final state. Formatting is shared with the orchestrator's chain notes.
+func reasoningNoteBlocks(reasoningCtx *ReasoningContext, status string, userID, noteID uuid.UUID) []models.Block {
+	// The orchestrator's block helpers don't use its state
+	formatter := &AgentOrchestrator{}
+
+	var blocks []models.Block
+	order := 1000.0
+	add := func(added ...models.Block) {
+		for _, block := range added {
+			block.Order = order
+			blocks = append(blocks, block)
+			order += 100.0
+		}
+	}
+	heading := func(text string, level int) models.Block {
+		return models.Block{
+			ID:       uuid.New(),
+			UserID:   userID,
+			NoteID:   noteID,
+			Type:     models.HeadingBlock,
+			Content:  models.BlockContent{"text": text},
+			Metadata: models.BlockMetadata{"level": level, "spans": []interface{}{}},
+		}
+	}
+	// labelled adds a bold label followed by the items as a bulleted list
+	labelled := func(key string, items []string) {
+		values := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			if strings.TrimSpace(item) != "" {
+				values = append(values, item)
+			}
+		}
+		if len(values) > 0 {
+			add(formatter.formatMapAsBlocks(map[string]interface{}{key: values}, userID, noteID, 0)...)
+		}
+	}
+
+	add(heading("Reasoning Run", 1))
+	add(formatter.formatMapAsBlocks(map[string]interface{}{"goal": reasoningCtx.Goal}, userID, noteID, 0)...)
+	add(formatter.formatMapAsBlocks(map[string]interface{}{"strategy": reasoningCtx.Strategy}, userID, noteID, 0)...)
+	add(formatter.formatMapAsBlocks(map[string]interface{}{"status": status}, userID, noteID, 0)...)
+	add(formatter.formatMapAsBlocks(map[string]interface{}{"total_steps": len(reasoningCtx.Steps)}, userID, noteID, 0)...)
+
+	if strings.TrimSpace(reasoningCtx.InitialContext) != "" {
+		add(heading("Initial Context", 2))
+		add(formatter.formatValueAsBlocks(reasoningCtx.InitialContext, userID, noteID, 0)...)
+	}
+
+	// Phases of an iteration share its step number
+	stepNumber := 0
+	for _, step := range reasoningCtx.Steps {
+		if step.StepNumber != stepNumber {
+			stepNumber = step.StepNumber
+			add(heading(fmt.Sprintf("Step %d", stepNumber), 2))
+		}
+
+		title, ok := reasoningPhaseTitles[step.Type]
+		if !ok {
+			title = formatter.humanizeKey(step.Type)
+		}
+		add(heading(title, 3))
+		if strings.TrimSpace(step.Content) != "" {
+			add(formatter.formatValueAsBlocks(step.Content, userID, noteID, 0)...)
+		}
+		labelled("observations", step.Observations)
+		labelled("actions", step.Actions)
+	}
+
+	add(heading("Learnings", 2))
+	learnings := make([]interface{}, 0, len(reasoningCtx.Learnings))
+	for _, learning := range reasoningCtx.Learnings {
+		learnings = append(learnings, learning)
+	}
+	if len(learnings) > 0 {
+		add(formatter.formatValueAsBlocks(learnings, userID, noteID, 0)...)
+	} else {
+		add(formatter.formatValueAsBlocks("No learnings were recorded.", userID, noteID, 0)...)
+	}
+
+	if assessment := reasoningCtx.Assessment; assessment != nil {
+		add(heading("Assessment", 2))
+		add(formatter.formatMapAsBlocks(map[string]interface{}{"confidence": fmt.Sprintf("%.0f%%", assessment.Confidence*100)}, userID, noteID, 0)...)
+		if assessment.Accomplished != "" {
+			add(formatter.formatMapAsBlocks(map[string]interface{}{"accomplished": assessment.Accomplished}, userID, noteID, 0)...)
+		}
+		labelled("next_steps", assessment.NextSteps)
+	}
+
+	add(heading("Final State", 2))
+	add(formatter.formatValueAsBlocks(reasoningCtx.CurrentState, userID, noteID, 0)...)
+
+	return blocks
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReasoningNoteBlocks_SectionPerStep(t *testing.T) {
+	reasoningCtx := &ReasoningContext{
+		Goal:           "Plan a garden",
+		InitialContext: "Small balcony",
+		Strategy:       "methodical",
+		CurrentState:   "stagnated",
+		Learnings:      []string{"Tomatoes need sun"},
+	}
+	for step := 1; step <= 2; step++ {
+		for _, phase := range []string{"analyze", "plan", "execute", "reflect"} {
+			reasoningCtx.Steps = append(reasoningCtx.Steps, ReasoningStep{
+				StepNumber:   step,
+				Type:         phase,
+				Content:      phase + " content",
+				Observations: []string{"an observation"},
+				Timestamp:    time.Now(),
+			})
+		}
+	}
+
+	blocks := reasoningNoteBlocks(reasoningCtx, "completed", uuid.New(), uuid.New())
+
+	headings := map[int][]string{}
+	for i, block := range blocks {
+		if i > 0 {
+			assert.Greater(t, block.Order, blocks[i-1].Order)
+		}
+		if block.Type == models.HeadingBlock {
+			level := block.Metadata["level"].(int)
+			headings[level] = append(headings[level], block.Content["text"].(string))
+		}
+	}
+
+	assert.Equal(t, []string{"Reasoning Run"}, headings[1])
+	assert.Equal(t, []string{"Initial Context", "Step 1", "Step 2", "Learnings", "Final State"}, headings[2])
+	require.Len(t, headings[3], 8)
+	assert.Equal(t, []string{"🔍 Analyze", "🗺️ Plan", "⚙️ Execute", "🪞 Reflect"}, headings[3][:4])
+
+	var listItems []string
+	for _, block := range blocks {
+		if block.Type == models.ListItemBlock {
+			listItems = append(listItems, block.Content["text"].(string))
+		}
+	}
+	// One observation per phase, then the learning
+	require.Len(t, listItems, 9)
+	assert.Equal(t, "Tomatoes need sun", listItems[8])
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// defaultRelatedNotesLimit is how many related notes are stored per note
+const defaultRelatedNotesLimit = 5
+
+// relatedNotesLimitFromEnv reads AI_RELATED_NOTES_LIMIT
+func relatedNotesLimitFromEnv() int {
+	if value, err := strconv.Atoi(os.Getenv("AI_RELATED_NOTES_LIMIT")); err == nil && value > 0 {
+		return value
+	}
+	return defaultRelatedNotesLimit
+}
+
+func (ai *AIService) relatedLimit() int {
+	if ai.relatedNotesLimit > 0 {
+		return ai.relatedNotesLimit
+	}
+	return defaultRelatedNotesLimit
+}
+
+// dedupeRelatedNoteIDs drops the note itself, empty and repeated IDs, keeping
+// the first occurrence so the ranking from the vector search is preserved
+func dedupeRelatedNoteIDs(noteID uuid.UUID, ids []uuid.UUID, limit int) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	deduped := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if id == noteID || id == uuid.Nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		deduped = append(deduped, id)
+		if limit > 0 && len(deduped) == limit {
+			break
+		}
+	}
+	return deduped
+}
+
+// refreshRelatedNotes recomputes the related notes of a note
+func (ai *AIService) refreshRelatedNotes(ctx context.Context, noteID uuid.UUID) error {
+	_, err := ai.refreshRelatedNotesBatch(ctx, []uuid.UUID{noteID})
+	return err
+}
+
+// refreshRelatedNotesBatch recomputes the related notes of the notes with a
+// single ChromaDB query, holding a query text per note, and returns the
+// stored IDs by note. Each run replaces the stored lists, so notes that
+// stopped matching drop out, unless a run that started later has stored its
+// list already; the later list is returned then.
+func (ai *AIService) refreshRelatedNotesBatch(ctx context.Context, noteIDs []uuid.UUID) (map[uuid.UUID][]uuid.UUID, error) {
+	db := ai.db.WithContext(ctx)
+	computedAt := time.Now()
+	var notes []models.Note
+	if err := db.Preload("Blocks", func(db *gorm.DB) *gorm.DB { return db.Order(`"order"`) }).
+		Where("id IN ?", noteIDs).
+		Find(&notes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load notes: %w", err)
+	}
+	if len(notes) == 0 {
+		return nil, nil
+	}
+
+	queryTexts := make([]string, len(notes))
+	for i := range notes {
+		queryTexts[i] = relatedNotesQuery(&notes[i], renderNoteBlocks(notes[i].Blocks, NoteContentPlain))
+	}
+	limit := ai.relatedLimit()
+	ranking := RelevanceRanking
+	ranking.MinSimilarity = DefaultMinSimilarity()
+	// One more result than needed, as each note matches itself
+	results, err := ai.chromaService.QueryByText(ctx, ai.noteCollection(), queryTexts, ranking.candidates(limit)+1, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ChromaDB: %w", err)
+	}
+
+	now, space := time.Now(), ai.collectionSpace()
+	matches := make([][]uuid.UUID, len(notes))
+	var matched []uuid.UUID
+	for i, note := range notes {
+		for _, hit := range rankHits(queryHits(results, i, space), ranking, now) {
+			if hit.NoteID != note.ID {
+				matches[i] = append(matches[i], hit.NoteID)
+			}
+		}
+		matched = append(matched, matches[i]...)
+	}
+
+	// Documents of deleted notes can linger in the index
+	existing := make(map[uuid.UUID]bool, len(matched))
+	if len(matched) > 0 {
+		var ids []uuid.UUID
+		if err := db.Model(&models.Note{}).Where("id IN ?", matched).Pluck("id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to check related notes: %w", err)
+		}
+		for _, id := range ids {
+			existing[id] = true
+		}
+	}
+
+	related := make(map[uuid.UUID][]uuid.UUID, len(notes))
+	for i, note := range notes {
+		var ids []uuid.UUID
+		for _, id := range matches[i] {
+			if existing[id] {
+				ids = append(ids, id)
+			}
+		}
+		ids = dedupeRelatedNoteIDs(note.ID, ids, limit)
+		saved, err := saveRelatedNoteIDs(db, note.ID, ids, computedAt)
+		if err != nil {
+			return related, err
+		}
+		if !saved {
+			if ids, err = storedRelatedNoteIDs(db, note.ID, ids); err != nil {
+				return related, err
+			}
+		}
+		related[note.ID] = ids
+	}
+	return related, nil
+}
+
+// relatedNotesQuery is the text related notes are searched with: the title
+// and the start of the content
+func relatedNotesQuery(note *models.Note, content string) string {
+	if len(content) > 500 {
+		content = content[:500]
+	}
+	return note.Title + " " + content
+}
+
+// EnsureRelatedNotes computes the related notes of aiNote when they are
+// computed lazily and haven't been since the note was last processed,
+// updating aiNote. It waits for a slot of the related notes queue.
+func (ai *AIService) EnsureRelatedNotes(ctx context.Context, aiNote *models.AIEnhancedNote) error {
+	if ai.relatedNotesMode != RelatedNotesLazy {
+		return nil
+	}
+	if computedAt := aiNote.RelatedNotesUpdatedAt; computedAt != nil &&
+		(aiNote.LastProcessedAt == nil || !aiNote.LastProcessedAt.After(*computedAt)) {
+		return nil
+	}
+
+	release, err := ai.relatedNotes.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	related, err := ai.refreshRelatedNotesBatch(ctx, []uuid.UUID{aiNote.NoteID})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	aiNote.RelatedNoteIDs = related[aiNote.NoteID]
+	aiNote.RelatedNotesUpdatedAt = &now
+	return nil
+}
+
+// queueRelatedNotes computes the related notes of a processed note in the
+// background, unless they are computed lazily
+func (ai *AIService) queueRelatedNotes(noteID uuid.UUID) {
+	if ai.relatedNotesMode == RelatedNotesLazy {
+		return
+	}
+	ai.relatedNotes.Enqueue(noteID)
+}
+
+// saveRelatedNoteIDs stores the deduplicated related IDs of a note, computed
+// from the note as it was at computedAt. It reports false when the stored
+// list was computed later, which is kept, or the note has no AI record.
+func saveRelatedNoteIDs(db *gorm.DB, noteID uuid.UUID, ids []uuid.UUID, computedAt time.Time) (bool, error) {
+	related := models.UUIDArray(dedupeRelatedNoteIDs(noteID, ids, 0))
+	result := db.Model(&models.AIEnhancedNote{}).
+		Where("note_id = ? AND (related_notes_updated_at IS NULL OR related_notes_updated_at < ?)", noteID, computedAt).
+		Updates(map[string]interface{}{"related_note_ids": related, "related_notes_updated_at": computedAt})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to store related notes: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// storedRelatedNoteIDs reads the related IDs stored for a note, or returns
+// fallback when the note has no AI record
+func storedRelatedNoteIDs(db *gorm.DB, noteID uuid.UUID, fallback []uuid.UUID) ([]uuid.UUID, error) {
+	var aiNotes []models.AIEnhancedNote
+	if err := db.Select("note_id", "related_note_ids").Where("note_id = ?", noteID).Limit(1).Find(&aiNotes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load related notes: %w", err)
+	}
+	if len(aiNotes) == 0 {
+		return fallback, nil
+	}
+	return aiNotes[0].RelatedNoteIDs, nil
+}
+
+// PruneRelatedNoteIDs drops related IDs whose notes were deleted or don't
+// belong to the user, and writes the pruned list back when it changed
+func PruneRelatedNoteIDs(db *gorm.DB, userID uuid.UUID, aiNote *models.AIEnhancedNote) error {
+	if len(aiNote.RelatedNoteIDs) == 0 {
+		return nil
+	}
+
+	var existing []uuid.UUID
+	if err := db.Model(&models.Note{}).
+		Where("id IN ? AND user_id = ?", []uuid.UUID(aiNote.RelatedNoteIDs), userID).
+		Pluck("id", &existing).Error; err != nil {
+		return fmt.Errorf("failed to check related notes: %w", err)
+	}
+
+	found := make(map[uuid.UUID]bool, len(existing))
+	for _, id := range existing {
+		found[id] = true
+	}
+	pruned := make(models.UUIDArray, 0, len(aiNote.RelatedNoteIDs))
+	for _, id := range dedupeRelatedNoteIDs(aiNote.NoteID, aiNote.RelatedNoteIDs, 0) {
+		if found[id] {
+			pruned = append(pruned, id)
+		}
+	}
+	if len(pruned) == len(aiNote.RelatedNoteIDs) {
+		return nil
+	}
+
+	aiNote.RelatedNoteIDs = pruned
+	if err := db.Model(&models.AIEnhancedNote{}).
+		Where("note_id = ?", aiNote.NoteID).
+		Update("related_note_ids", pruned).Error; err != nil {
+		log.Printf("Failed to store pruned related notes for %s: %v", aiNote.NoteID, err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// RelatedNotesMode is when the related notes of a processed note are computed
+type RelatedNotesMode string
+
+const (
+	// RelatedNotesEager queues the computation when the note is processed
+	RelatedNotesEager RelatedNotesMode = "eager"
+	// RelatedNotesLazy computes them the first time the enhanced note is read
+	RelatedNotesLazy RelatedNotesMode = "lazy"
+)
+
+const (
+	defaultRelatedNotesConcurrency = 2
+	defaultRelatedNotesBatchSize   = 10
+)
+
+// relatedNotesModeFromEnv reads AI_RELATED_NOTES_MODE, eager by default
+func relatedNotesModeFromEnv() RelatedNotesMode {
+	if RelatedNotesMode(os.Getenv("AI_RELATED_NOTES_MODE")) == RelatedNotesLazy {
+		return RelatedNotesLazy
+	}
+	return RelatedNotesEager
+}
+
+// relatedNotesConcurrency reads AI_RELATED_NOTES_CONCURRENCY, the most
+// related-notes ChromaDB queries running at the same time
+func relatedNotesConcurrency() int {
+	if value, err := strconv.Atoi(os.Getenv("AI_RELATED_NOTES_CONCURRENCY")); err == nil && value > 0 {
+		return value
+	}
+	return defaultRelatedNotesConcurrency
+}
+
+// relatedNotesBatchSize reads AI_RELATED_NOTES_BATCH_SIZE, the most notes
+// whose related notes are found with one ChromaDB query
+func relatedNotesBatchSize() int {
+	if value, err := strconv.Atoi(os.Getenv("AI_RELATED_NOTES_BATCH_SIZE")); err == nil && value > 0 {
+		return value
+	}
+	return defaultRelatedNotesBatchSize
+}
+
+// RelatedNotesQueue computes related notes in the background. Queued notes
+// are taken in batches by a bounded number of workers, so processing many
+// notes at once doesn't flood ChromaDB with a query per note. A note queued
+// again before its batch is taken is computed once.
+type RelatedNotesQueue struct {
+	tasks     *BackgroundTasks
+	batchSize int
+	slots     chan struct{} // One per ChromaDB query allowed at a time
+	compute   func(ctx context.Context, noteIDs []uuid.UUID) error
+
+	mu      sync.Mutex
+	pending []uuid.UUID
+	queued  map[uuid.UUID]bool
+	workers int
+}
+
+// NewRelatedNotesQueue creates a queue computing batches with compute, at
+// most concurrency at a time, on the application's background tasks
+func NewRelatedNotesQueue(concurrency, batchSize int, compute func(ctx context.Context, noteIDs []uuid.UUID) error) *RelatedNotesQueue {
+	return newRelatedNotesQueue(AppBackgroundTasks(), concurrency, batchSize, compute)
+}
+
+func newRelatedNotesQueue(tasks *BackgroundTasks, concurrency, batchSize int, compute func(ctx context.Context, noteIDs []uuid.UUID) error) *RelatedNotesQueue {
+	return &RelatedNotesQueue{
+		tasks:     tasks,
+		batchSize: max(batchSize, 1),
+		slots:     make(chan struct{}, max(concurrency, 1)),
+		compute:   compute,
+		queued:    make(map[uuid.UUID]bool),
+	}
+}
+
+// Enqueue queues the note and starts a worker if fewer than the concurrency
+// are running. A nil queue computes nothing.
+func (q *RelatedNotesQueue) Enqueue(noteID uuid.UUID) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.queued[noteID] {
+		return
+	}
+	q.queued[noteID] = true
+	q.pending = append(q.pending, noteID)
+
+	if q.workers < cap(q.slots) {
+		q.workers++
+		if !q.tasks.Go(context.Background(), "related notes", q.work) {
+			q.workers--
+		}
+	}
+}
+
+// Run computes the related notes of the notes once a query slot is free
+func (q *RelatedNotesQueue) Run(ctx context.Context, noteIDs []uuid.UUID) error {
+	release, err := q.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return q.compute(ctx, noteIDs)
+}
+
+// acquire waits for a free query slot, for computations outside the queue
+// to share its concurrency limit. The returned func frees it. A nil queue
+// doesn't limit anything.
+func (q *RelatedNotesQueue) acquire(ctx context.Context) (func(), error) {
+	if q == nil {
+		return func() {}, nil
+	}
+	select {
+	case q.slots <- struct{}{}:
+		return func() { <-q.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// work computes queued batches until the queue is empty
+func (q *RelatedNotesQueue) work(ctx context.Context) error {
+	for {
+		batch := q.next()
+		if batch == nil {
+			return nil
+		}
+		if err := q.Run(ctx, batch); err != nil {
+			log.Printf("Failed to update related notes of %d notes: %v", len(batch), err)
+		}
+	}
+}
+
+// next takes the next batch, or returns nil and retires the worker when
+// nothing is queued
+func (q *RelatedNotesQueue) next() []uuid.UUID {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		q.workers--
+		return nil
+	}
+
+	n := min(q.batchSize, len(q.pending))
+	batch := append([]uuid.UUID(nil), q.pending[:n]...)
+	q.pending = q.pending[n:]
+	for _, noteID := range batch {
+		// Changes from now on queue the note again
+		delete(q.queued, noteID)
+	}
+	return batch
+}
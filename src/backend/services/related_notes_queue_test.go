@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelatedNotesQueue_BulkProcessingStaysWithinConcurrency(t *testing.T) {
+	var inFlight, maxInFlight, queries atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		io.WriteString(w, `{"ids":[[]]}`)
+	}))
+	defer server.Close()
+	chroma := NewChromaService(server.URL, nil)
+
+	const notes = 40
+	var mu sync.Mutex
+	computed := make(map[uuid.UUID]int)
+	var wg sync.WaitGroup
+	wg.Add(notes)
+
+	tasks := NewBackgroundTasks()
+	defer tasks.Stop(time.Second)
+	queue := newRelatedNotesQueue(tasks, 3, 4, func(ctx context.Context, noteIDs []uuid.UUID) error {
+		assert.LessOrEqual(t, len(noteIDs), 4)
+		_, err := chroma.QueryByText(ctx, NoteEmbeddingsCollection, make([]string, len(noteIDs)), 5, nil)
+		mu.Lock()
+		for _, noteID := range noteIDs {
+			computed[noteID]++
+			wg.Done()
+		}
+		mu.Unlock()
+		return err
+	})
+
+	// A bulk reprocess queues every note as it finishes
+	for i := 0; i < notes; i++ {
+		queue.Enqueue(uuid.New())
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(3), "no more queries at once than the concurrency")
+	assert.GreaterOrEqual(t, queries.Load(), int32(notes/4))
+	assert.Less(t, queries.Load(), int32(notes), "notes are queried in batches")
+	assert.Len(t, computed, notes)
+	for noteID, runs := range computed {
+		assert.Equal(t, 1, runs, "note %s computed more than once", noteID)
+	}
+}
+
+func TestRelatedNotesQueue_RequeuedNoteComputedOnce(t *testing.T) {
+	tasks := NewBackgroundTasks()
+	defer tasks.Stop(time.Second)
+
+	release := make(chan struct{})
+	var batches [][]uuid.UUID
+	var mu sync.Mutex
+	done := make(chan struct{}, 2)
+	queue := newRelatedNotesQueue(tasks, 1, 10, func(ctx context.Context, noteIDs []uuid.UUID) error {
+		<-release
+		mu.Lock()
+		batches = append(batches, noteIDs)
+		mu.Unlock()
+		done <- struct{}{}
+		return nil
+	})
+
+	first, second := uuid.New(), uuid.New()
+	queue.Enqueue(first)
+	// The worker has taken first, so second and its repeats wait for the next batch
+	require.Eventually(t, func() bool {
+		queue.mu.Lock()
+		defer queue.mu.Unlock()
+		return len(queue.pending) == 0
+	}, time.Second, time.Millisecond)
+	queue.Enqueue(second)
+	queue.Enqueue(second)
+	close(release)
+	<-done
+	<-done
+
+	assert.Equal(t, [][]uuid.UUID{{first}, {second}}, batches)
+}
+
+func TestRefreshRelatedNotesBatch_OneQueryForSeveralNotes(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	garden, plants, recipes := uuid.New(), uuid.New(), uuid.New()
+	server := newChromaMockServer(t, map[string]string{
+		"POST " + chatQueryPath: fmt.Sprintf(`{"ids":[["%s","%s","%s"],["%s","%s"]],"distances":[[0,0.2,0.7],[0,0.3]]}`,
+			NoteIDToChromaID(garden), NoteIDToChromaID(plants), NoteIDToChromaID(recipes),
+			NoteIDToChromaID(plants), NoteIDToChromaID(garden)),
+	})
+	ai := &AIService{db: db.DB, chromaService: NewChromaService(server.URL, nil), relatedNotesLimit: 5}
+
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE id IN \(\$1,\$2\)`).
+		WithArgs(garden, plants).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(garden, "Garden").AddRow(plants, "Plants"))
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE "blocks"."note_id" IN \(\$1,\$2\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "type", "content", "order"}).
+			AddRow(uuid.New(), garden, "text", []byte(`{"text":"Tomatoes in May"}`), 1))
+	// recipes has been deleted since it was indexed
+	mock.ExpectQuery(`SELECT "id" FROM "notes" WHERE id IN \(\$1,\$2,\$3\)`).
+		WithArgs(plants, recipes, garden).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(plants).AddRow(garden))
+	for _, related := range []models.UUIDArray{{plants}, {garden}} {
+		stored, err := related.Value()
+		require.NoError(t, err)
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "ai_enhanced_notes" SET "related_note_ids"=\$1`).
+			WithArgs(stored, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	related, err := ai.refreshRelatedNotesBatch(context.Background(), []uuid.UUID{garden, plants})
+	require.NoError(t, err)
+	assert.Equal(t, map[uuid.UUID][]uuid.UUID{garden: {plants}, plants: {garden}}, related)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	require.Len(t, server.requests, 1, "one ChromaDB query for the batch")
+	request, _ := server.last("POST", chatQueryPath)
+	assert.Equal(t, []interface{}{"Garden Tomatoes in May", "Plants "}, request.Body["query_texts"])
+}
+
+func TestEnsureRelatedNotes_OnlyWhenLazyAndStale(t *testing.T) {
+	processed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	computed := processed.Add(time.Minute)
+
+	// Nothing is queried here, the mock database would fail otherwise
+	db, _, close := testutils.SetupMockDB()
+	defer close()
+
+	eager := &AIService{db: db.DB}
+	require.NoError(t, eager.EnsureRelatedNotes(context.Background(), &models.AIEnhancedNote{NoteID: uuid.New()}))
+
+	lazy := &AIService{db: db.DB, relatedNotesMode: RelatedNotesLazy}
+	upToDate := &models.AIEnhancedNote{NoteID: uuid.New(), LastProcessedAt: &processed, RelatedNotesUpdatedAt: &computed}
+	require.NoError(t, lazy.EnsureRelatedNotes(context.Background(), upToDate))
+	assert.Equal(t, &computed, upToDate.RelatedNotesUpdatedAt)
+}
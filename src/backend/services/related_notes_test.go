@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupeRelatedNoteIDs(t *testing.T) {
+	self, a, b, c := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	ids := []uuid.UUID{a, self, a, uuid.Nil, b, b, c}
+	assert.Equal(t, []uuid.UUID{a, b, c}, dedupeRelatedNoteIDs(self, ids, 0))
+	assert.Equal(t, []uuid.UUID{a, b}, dedupeRelatedNoteIDs(self, ids, 2))
+	assert.Empty(t, dedupeRelatedNoteIDs(self, []uuid.UUID{self, self}, 5))
+}
+
+func TestRefreshRelatedNotes_StoresNoDuplicateOrSelfIDs(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID, a, b := uuid.New(), uuid.New(), uuid.New()
+	// Chunked notes can match several times, and a stale index may return the note itself
+	server := newChromaMockServer(t, map[string]string{
+		"POST " + chatQueryPath: fmt.Sprintf(`{"ids":[["%s","%s","%s","%s","%s"]],"distances":[[0.1,0.1,0.2,0.3,0.3]]}`,
+			NoteIDToChromaID(a), NoteIDToChromaID(noteID), NoteIDToChromaID(a), NoteIDToChromaID(b), NoteIDToChromaID(b)),
+	})
+	ai := &AIService{db: db.DB, chromaService: NewChromaService(server.URL, nil), relatedNotesLimit: 5}
+
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE id IN \(\$1\) AND "notes"."deleted_at" IS NULL`).
+		WithArgs(noteID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(noteID, "Source"))
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE "blocks"."note_id" = \$1`).
+		WithArgs(noteID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT "id" FROM "notes" WHERE id IN \(\$1,\$2\) AND "notes"."deleted_at" IS NULL`).
+		WithArgs(a, b).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(a).AddRow(b))
+	stored, err := models.UUIDArray{a, b}.Value()
+	require.NoError(t, err)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "ai_enhanced_notes" SET "related_note_ids"=\$1,"related_notes_updated_at"=\$2,"updated_at"=\$3 WHERE note_id = \$4 AND \(related_notes_updated_at IS NULL OR related_notes_updated_at < \$5\)`).
+		WithArgs(stored, sqlmock.AnyArg(), sqlmock.AnyArg(), noteID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, ai.refreshRelatedNotes(context.Background(), noteID))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshRelatedNotes_KeepsAListComputedLater(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID, stale, fresh := uuid.New(), uuid.New(), uuid.New()
+	server := newChromaMockServer(t, map[string]string{
+		"POST " + chatQueryPath: fmt.Sprintf(`{"ids":[["%s"]],"distances":[[0.1]]}`, NoteIDToChromaID(stale)),
+	})
+	ai := &AIService{db: db.DB, chromaService: NewChromaService(server.URL, nil), relatedNotesLimit: 5}
+
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE id IN \(\$1\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(noteID, "Source"))
+	mock.ExpectQuery(`SELECT \* FROM "blocks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT "id" FROM "notes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(stale))
+	// A refresh that started after this one has stored its list meanwhile
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "ai_enhanced_notes" SET "related_note_ids"=\$1.*related_notes_updated_at < \$5`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	current, err := models.UUIDArray{fresh}.Value()
+	require.NoError(t, err)
+	mock.ExpectQuery(`SELECT "note_id","related_note_ids" FROM "ai_enhanced_notes" WHERE note_id = \$1`).
+		WithArgs(noteID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"note_id", "related_note_ids"}).AddRow(noteID, current))
+
+	related, err := ai.refreshRelatedNotesBatch(context.Background(), []uuid.UUID{noteID})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{fresh}, related[noteID])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPruneRelatedNoteIDs_DropsDeletedNotes(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID, kept, deleted := uuid.New(), uuid.New(), uuid.New()
+	aiNote := &models.AIEnhancedNote{NoteID: uuid.New(), RelatedNoteIDs: models.UUIDArray{kept, deleted}}
+
+	mock.ExpectQuery(`SELECT "id" FROM "notes" WHERE \(id IN \(\$1,\$2\) AND user_id = \$3\) AND "notes"."deleted_at" IS NULL`).
+		WithArgs(kept, deleted, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(kept))
+	stored, err := models.UUIDArray{kept}.Value()
+	require.NoError(t, err)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "ai_enhanced_notes" SET "related_note_ids"=\$1,"updated_at"=\$2 WHERE note_id = \$3`).
+		WithArgs(stored, sqlmock.AnyArg(), aiNote.NoteID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, PruneRelatedNoteIDs(db.DB, userID, aiNote))
+	assert.Equal(t, models.UUIDArray{kept}, aiNote.RelatedNoteIDs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// defaultRemoteAgentTimeout bounds a remote agent call when none is configured
+const defaultRemoteAgentTimeout = 60 * time.Second
+
+// maxRemoteAgentResponseBytes is the largest reply read from a remote agent
+const maxRemoteAgentResponseBytes = 10 << 20
+
+// remoteAgentClient makes the client remote agents are called with. Like
+// link previews it refuses to connect to non-public addresses, as agent URLs
+// are chosen by users.
+var remoteAgentClient = newLinkClient
+
+// AgentTypeInfo describes an agent type available to chains
+type AgentTypeInfo struct {
+	Type        AgentType              `json:"type"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+	Remote      bool                   `json:"remote"`
+	URL         string                 `json:"url,omitempty"` // Endpoint of remote agents
+}
+
+// RemoteAgentRequest registers an agent type backed by an HTTP endpoint
+type RemoteAgentRequest struct {
+	Type           string                 `json:"type" binding:"required"`
+	Name           string                 `json:"name" binding:"required"`
+	Description    string                 `json:"description"`
+	URL            string                 `json:"url" binding:"required"`
+	InputSchema    map[string]interface{} `json:"input_schema"`
+	TimeoutSeconds int                    `json:"timeout_seconds"`
+}
+
+// remoteAgentCall is the body POSTed to a remote agent
+type remoteAgentCall struct {
+	AgentType string                 `json:"agent_type"`
+	Input     map[string]interface{} `json:"input"`
+}
+
+// remoteAgentReply is what a remote agent answers with
+type remoteAgentReply struct {
+	Output interface{} `json:"output"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// RemoteAgentExecutor runs an agent by POSTing its input to an external
+// endpoint, which answers with {"output": ...} or {"error": "..."}
+type RemoteAgentExecutor struct {
+	agent      models.RemoteAgent
+	httpClient *http.Client
+}
+
+// NewRemoteAgentExecutor creates an executor for a registered remote agent
+func NewRemoteAgentExecutor(agent models.RemoteAgent) *RemoteAgentExecutor {
+	timeout := defaultRemoteAgentTimeout
+	if agent.TimeoutSeconds > 0 {
+		timeout = time.Duration(agent.TimeoutSeconds) * time.Second
+	}
+	return &RemoteAgentExecutor{
+		agent:      agent,
+		httpClient: remoteAgentClient(timeout),
+	}
+}
+
+func (r *RemoteAgentExecutor) Execute(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+	body, err := json.Marshal(remoteAgentCall{AgentType: r.agent.AgentType, Input: input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode remote agent input: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", r.agent.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote agent request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("remote agent %s request failed: %w", r.agent.AgentType, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteAgentResponseBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote agent response: %w", err)
+	}
+	if len(respBody) > maxRemoteAgentResponseBytes {
+		return nil, fmt.Errorf("remote agent %s response exceeds %d bytes", r.agent.AgentType, maxRemoteAgentResponseBytes)
+	}
+
+	var reply remoteAgentReply
+	decodeErr := json.Unmarshal(respBody, &reply)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if decodeErr == nil && reply.Error != "" {
+			return nil, fmt.Errorf("remote agent %s failed with status %d: %s", r.agent.AgentType, resp.StatusCode, reply.Error)
+		}
+		return nil, fmt.Errorf("remote agent %s failed with status %d: %s", r.agent.AgentType, resp.StatusCode, string(respBody))
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode remote agent response: %w", decodeErr)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("remote agent %s failed: %s", r.agent.AgentType, reply.Error)
+	}
+	return reply.Output, nil
+}
+
+func (r *RemoteAgentExecutor) GetType() AgentType {
+	return AgentType(r.agent.AgentType)
+}
+
+func (r *RemoteAgentExecutor) Name() string {
+	return r.agent.Name
+}
+
+func (r *RemoteAgentExecutor) Description() string {
+	return r.agent.Description
+}
+
+func (r *RemoteAgentExecutor) InputSchema() map[string]interface{} {
+	return r.agent.InputSchema
+}
+
+// ListAgentTypes describes the built-in agents followed by the remote agents
+// the user registered
+func (o *AgentOrchestrator) ListAgentTypes(userID uuid.UUID) ([]AgentTypeInfo, error) {
+	agentTypes := make([]AgentTypeInfo, 0, len(o.registeredAgents))
+	for agentType, executor := range o.registeredAgents {
+		agentTypes = append(agentTypes, AgentTypeInfo{
+			Type:        agentType,
+			Name:        executor.Name(),
+			Description: executor.Description(),
+			InputSchema: executor.InputSchema(),
+		})
+	}
+	sort.Slice(agentTypes, func(i, j int) bool { return agentTypes[i].Type < agentTypes[j].Type })
+
+	var remoteAgents []models.RemoteAgent
+	if err := o.db.Where("user_id = ?", userID).Order("agent_type ASC").Find(&remoteAgents).Error; err != nil {
+		return nil, fmt.Errorf("failed to load remote agents: %w", err)
+	}
+	for _, agent := range remoteAgents {
+		agentTypes = append(agentTypes, AgentTypeInfo{
+			Type:        AgentType(agent.AgentType),
+			Name:        agent.Name,
+			Description: agent.Description,
+			InputSchema: agent.InputSchema,
+			Remote:      true,
+			URL:         agent.URL,
+		})
+	}
+	return agentTypes, nil
+}
+
+// RegisterRemoteAgent stores a remote agent so the user's chains can use its
+// type. Remote agents are kept in the database so every orchestrator sees
+// them.
+func (o *AgentOrchestrator) RegisterRemoteAgent(userID uuid.UUID, req RemoteAgentRequest) (models.RemoteAgent, error) {
+	if req.Type == "" || req.Name == "" {
+		return models.RemoteAgent{}, fmt.Errorf("%w: type and name are required", ErrInvalidInput)
+	}
+	if _, builtIn := o.registeredAgents[AgentType(req.Type)]; builtIn {
+		return models.RemoteAgent{}, fmt.Errorf("%w: %s is a built-in agent type", ErrResourceExists, req.Type)
+	}
+	endpoint, err := url.Parse(req.URL)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return models.RemoteAgent{}, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidInput)
+	}
+	if req.TimeoutSeconds < 0 {
+		return models.RemoteAgent{}, fmt.Errorf("%w: timeout_seconds must not be negative", ErrInvalidInput)
+	}
+
+	var existing int64
+	if err := o.db.Model(&models.RemoteAgent{}).Where("user_id = ? AND agent_type = ?", userID, req.Type).Count(&existing).Error; err != nil {
+		return models.RemoteAgent{}, err
+	}
+	if existing > 0 {
+		return models.RemoteAgent{}, fmt.Errorf("%w: agent type %s is already registered", ErrResourceExists, req.Type)
+	}
+
+	agent := models.RemoteAgent{
+		ID:             uuid.New(),
+		UserID:         userID,
+		AgentType:      req.Type,
+		Name:           req.Name,
+		Description:    req.Description,
+		URL:            endpoint.String(),
+		InputSchema:    models.AIMetadata(req.InputSchema),
+		TimeoutSeconds: req.TimeoutSeconds,
+	}
+	if agent.InputSchema == nil {
+		agent.InputSchema = models.AIMetadata{}
+	}
+	if err := o.db.Create(&agent).Error; err != nil {
+		return models.RemoteAgent{}, fmt.Errorf("failed to register remote agent: %w", err)
+	}
+
+	log.Printf("Registered remote agent %s at %s", agent.AgentType, agent.URL)
+	return agent, nil
+}
+
+// DeleteRemoteAgent removes a remote agent registered by the user
+func (o *AgentOrchestrator) DeleteRemoteAgent(userID uuid.UUID, agentType string) error {
+	if _, builtIn := o.registeredAgents[AgentType(agentType)]; builtIn {
+		return fmt.Errorf("%w: built-in agent types can't be removed", ErrInvalidInput)
+	}
+
+	result := o.db.Where("agent_type = ? AND user_id = ?", agentType, userID).Delete(&models.RemoteAgent{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// remoteAgent looks up a remote agent the user registered by type
+func (o *AgentOrchestrator) remoteAgent(userID uuid.UUID, agentType AgentType) (AgentExecutor, bool) {
+	if o.db == nil {
+		return nil, false
+	}
+	var agent models.RemoteAgent
+	if err := o.db.Where("user_id = ? AND agent_type = ?", userID, string(agentType)).First(&agent).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to look up remote agent %s: %v", agentType, err)
+		}
+		return nil, false
+	}
+	return NewRemoteAgentExecutor(agent), true
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRemoteAgentTestOrchestrator returns an orchestrator with the built-in
+// agents whose remote agents may call the local test servers
+func newRemoteAgentTestOrchestrator(t *testing.T) (*AgentOrchestrator, sqlmock.Sqlmock) {
+	db, mock, close := testutils.SetupMockDB()
+	t.Cleanup(close)
+
+	previous := remoteAgentClient
+	remoteAgentClient = func(timeout time.Duration) *http.Client { return &http.Client{Timeout: timeout} }
+	t.Cleanup(func() { remoteAgentClient = previous })
+
+	o := &AgentOrchestrator{
+		db:               db.DB,
+		registeredAgents: make(map[AgentType]AgentExecutor),
+	}
+	o.registerBuiltInAgents()
+	return o, mock
+}
+
+func TestListAgentTypes_MatchesRegisteredAgents(t *testing.T) {
+	o, mock := newRemoteAgentTestOrchestrator(t)
+	userID := uuid.New()
+	mock.ExpectQuery(`SELECT \* FROM "remote_agents" WHERE user_id = \$1 ORDER BY agent_type ASC`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "agent_type", "name", "description", "url", "input_schema"}).
+			AddRow(uuid.New(), "sentiment", "Sentiment", "Scores text", "http://agents.local/sentiment", []byte(`{"text":"string (required)"}`)))
+
+	agentTypes, err := o.ListAgentTypes(userID)
+	require.NoError(t, err)
+	require.Len(t, agentTypes, len(o.registeredAgents)+1)
+
+	for _, info := range agentTypes[:len(o.registeredAgents)] {
+		executor, ok := o.registeredAgents[info.Type]
+		require.True(t, ok, "listed type %s is not registered", info.Type)
+		assert.Equal(t, executor.Name(), info.Name)
+		assert.NotEmpty(t, info.Description)
+		assert.NotEmpty(t, info.InputSchema)
+		assert.False(t, info.Remote)
+	}
+	assert.Equal(t, AgentTypeReasoning, agentTypes[3].Type, "built-in types are sorted")
+
+	remote := agentTypes[len(agentTypes)-1]
+	assert.Equal(t, AgentType("sentiment"), remote.Type)
+	assert.True(t, remote.Remote)
+	assert.Equal(t, "http://agents.local/sentiment", remote.URL)
+	assert.Equal(t, "string (required)", remote.InputSchema["text"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRemoteAgent_RoundTrip(t *testing.T) {
+	var received remoteAgentCall
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"output": map[string]interface{}{"score": 0.8, "label": "positive"},
+		})
+	}))
+	defer server.Close()
+
+	o, mock := newRemoteAgentTestOrchestrator(t)
+	userID := uuid.New()
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "remote_agents" WHERE user_id = \$1 AND agent_type = \$2`).
+		WithArgs(userID, "sentiment").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "remote_agents"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "input_schema", "created_at", "updated_at"}).
+			AddRow(uuid.New(), []byte(`{}`), time.Now(), time.Now()))
+	mock.ExpectCommit()
+
+	agent, err := o.RegisterRemoteAgent(userID, RemoteAgentRequest{
+		Type: "sentiment",
+		Name: "Sentiment",
+		URL:  server.URL + "/run",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, userID, agent.UserID)
+
+	mock.ExpectQuery(`SELECT \* FROM "remote_agents" WHERE user_id = \$1 AND agent_type = \$2`).
+		WithArgs(userID, "sentiment", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "agent_type", "name", "url"}).
+			AddRow(agent.ID, "sentiment", "Sentiment", agent.URL))
+
+	executor, ok := o.GetAgent(userID, "sentiment")
+	require.True(t, ok)
+	output, err := executor.Execute(context.Background(), map[string]interface{}{"text": "great day"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "sentiment", received.AgentType)
+	assert.Equal(t, "great day", received.Input["text"])
+	assert.Equal(t, map[string]interface{}{"score": 0.8, "label": "positive"}, output)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRemoteAgent_ErrorReply(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{"error": "model unavailable"})
+	}))
+	defer server.Close()
+
+	executor := &RemoteAgentExecutor{agent: models.RemoteAgent{AgentType: "sentiment", URL: server.URL}, httpClient: server.Client()}
+	_, err := executor.Execute(context.Background(), map[string]interface{}{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 502: model unavailable")
+}
+
+func TestRegisterRemoteAgent_Validation(t *testing.T) {
+	o, _ := newRemoteAgentTestOrchestrator(t)
+
+	_, err := o.RegisterRemoteAgent(uuid.New(), RemoteAgentRequest{Type: "chat", Name: "Chat", URL: "http://example.com"})
+	assert.ErrorIs(t, err, ErrResourceExists)
+
+	_, err = o.RegisterRemoteAgent(uuid.New(), RemoteAgentRequest{Type: "custom", Name: "Custom", URL: "ftp://example.com"})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	assert.ErrorIs(t, o.DeleteRemoteAgent(uuid.New(), "chat"), ErrInvalidInput)
+}
+
+func TestRemoteAgent_OtherUsersAgentsAreNotFound(t *testing.T) {
+	o, mock := newRemoteAgentTestOrchestrator(t)
+	otherUser := uuid.New()
+
+	mock.ExpectQuery(`SELECT \* FROM "remote_agents" WHERE user_id = \$1 AND agent_type = \$2`).
+		WithArgs(otherUser, "sentiment", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, ok := o.GetAgent(otherUser, "sentiment")
+	assert.False(t, ok)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRemoteAgent_RefusesInternalAddresses(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer server.Close()
+
+	executor := NewRemoteAgentExecutor(models.RemoteAgent{AgentType: "sentiment", URL: server.URL})
+	_, err := executor.Execute(context.Background(), map[string]interface{}{})
+	assert.ErrorIs(t, err, ErrBlockedAddress)
+	assert.Zero(t, atomic.LoadInt32(&hits))
+}
+
+func TestRemoteAgent_RejectsOversizedReplies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"output":"`))
+		w.Write(bytes.Repeat([]byte("a"), maxRemoteAgentResponseBytes))
+		w.Write([]byte(`"}`))
+	}))
+	defer server.Close()
+
+	executor := &RemoteAgentExecutor{agent: models.RemoteAgent{AgentType: "sentiment", URL: server.URL}, httpClient: server.Client()}
+	_, err := executor.Execute(context.Background(), map[string]interface{}{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds")
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"log"
 
 	"owlistic-notes/owlistic/database"
@@ -24,6 +25,12 @@ type RoleServiceInterface interface {
 	GetRoles(db *database.Database, params map[string]interface{}) ([]models.Role, error)
 	RemoveRole(db *database.Database, roleID uuid.UUID) error
 
+	// Note-level sharing, independent of the note's notebook
+	GetNoteRoles(db *database.Database, ownerID uuid.UUID, noteID uuid.UUID) ([]models.Role, error)
+	GrantNoteRole(db *database.Database, ownerID uuid.UUID, noteID uuid.UUID, userID uuid.UUID, role models.RoleType) (models.Role, error)
+	RevokeNoteRole(db *database.Database, ownerID uuid.UUID, noteID uuid.UUID, userID uuid.UUID) error
+	CanMoveNote(db *database.Database, userID uuid.UUID, noteID uuid.UUID, targetNotebookID uuid.UUID) (bool, error)
+
 	// New utility methods for RBAC
 	HasSystemRole(db *database.Database, userID string, requiredRole string) (bool, error)
 	HasNoteAccess(db *database.Database, userID string, noteID string, requiredRole string) (bool, error)
@@ -98,6 +105,18 @@ func (s *RoleService) HasAccess(db *database.Database, userID uuid.UUID, resourc
 		return true, nil
 	}
 
+	// Notes combine roles shared on the note with roles on its notebook
+	if resourceType == models.NoteResource {
+		role, err := s.noteRole(db, userID, resourceID)
+		if err != nil {
+			return false, err
+		}
+		sufficient := isRoleSufficient(role, minimumRole)
+		log.Printf("User %s has effective role %q for note %s (required: %s): access %v",
+			userID, role, resourceID, minimumRole, sufficient)
+		return sufficient, nil
+	}
+
 	// Check for direct role assignment
 	var role models.Role
 	result := db.DB.Where("user_id = ? AND resource_id = ? AND resource_type = ?",
@@ -160,78 +179,14 @@ func (s *RoleService) HasAccess(db *database.Database, userID uuid.UUID, resourc
 			}
 		}
 
-		// Check if the resource belongs to the user directly
-		var noteUserIDStr string
-		err := db.DB.Model(&models.Note{}).
-			Where("id = ?", parentID).
-			Select("user_id").
-			Take(&noteUserIDStr).Error
-
-		if err == nil {
-			// Parse the UUID string to compare with userID
-			noteUserUUID, parseErr := uuid.Parse(noteUserIDStr)
-			if parseErr == nil && noteUserUUID == userID {
-				log.Printf("User %s owns the parent note %s, granting access", userID, parentID)
-				return true, nil
-			}
-		}
-
-		// Check permission on parent note through roles
-		var parentRole models.Role
-		parentResult := db.DB.Where(
-			"user_id = ? AND resource_id = ? AND resource_type = ?",
-			userID, parentID, models.NoteResource).First(&parentRole)
-
-		if parentResult.Error == nil {
-			// Check if parent role is sufficient
-			sufficient := isRoleSufficient(parentRole.Role, minimumRole)
-			log.Printf("User %s has role %s for parent note %s (required: %s): access %v",
-				userID, parentRole.Role, parentID, minimumRole, sufficient)
-			return sufficient, nil
-		} else if !errors.Is(parentResult.Error, gorm.ErrRecordNotFound) {
-			return false, parentResult.Error
-		}
-
-		// If note not found or no role, check parent notebook
-		var note models.Note
-		if err := db.DB.Select("notebook_id").First(&note, "id = ?", parentID).Error; err == nil {
-			var notebookRole models.Role
-			notebookResult := db.DB.Where(
-				"user_id = ? AND resource_id = ? AND resource_type = ?",
-				userID, note.NotebookID, models.NotebookResource).First(&notebookRole)
-
-			if notebookResult.Error == nil {
-				// Check if notebook role is sufficient
-				sufficient := isRoleSufficient(notebookRole.Role, minimumRole)
-				log.Printf("User %s has role %s for grandparent notebook %s (required: %s): access %v",
-					userID, notebookRole.Role, note.NotebookID, minimumRole, sufficient)
-				return sufficient, nil
-			}
-		}
-	} else if resourceType == models.NoteResource {
-		// For notes, check if user has access to the parent notebook
-		var note models.Note
-		if err := db.DB.Select("notebook_id, user_id").First(&note, "id = ?", resourceID).Error; err == nil {
-			// Check if user owns the note directly
-			if note.UserID == userID {
-				log.Printf("User %s owns note %s directly, granting access", userID, resourceID)
-				return true, nil
-			}
-
-			// Check for inherited permissions from notebook
-			var notebookRole models.Role
-			notebookResult := db.DB.Where(
-				"user_id = ? AND resource_id = ? AND resource_type = ?",
-				userID, note.NotebookID, models.NotebookResource).First(&notebookRole)
-
-			if notebookResult.Error == nil {
-				// Check if notebook role is sufficient
-				sufficient := isRoleSufficient(notebookRole.Role, minimumRole)
-				log.Printf("User %s has role %s for parent notebook %s (required: %s): access %v",
-					userID, notebookRole.Role, note.NotebookID, minimumRole, sufficient)
-				return sufficient, nil
-			}
+		parentRole, err := s.noteRole(db, userID, parentID)
+		if err != nil {
+			return false, err
 		}
+		sufficient := isRoleSufficient(parentRole, minimumRole)
+		log.Printf("User %s has effective role %q for parent note %s (required: %s): access %v",
+			userID, parentRole, parentID, minimumRole, sufficient)
+		return sufficient, nil
 	}
 
 	// No relevant role found
@@ -239,16 +194,95 @@ func (s *RoleService) HasAccess(db *database.Database, userID uuid.UUID, resourc
 	return false, nil
 }
 
+// roleRank orders roles from least to most permissive
+var roleRank = map[models.RoleType]int{
+	models.AdminRole:  4,
+	models.OwnerRole:  3,
+	models.EditorRole: 2,
+	models.ViewerRole: 1,
+}
+
 // isRoleSufficient checks if the assigned role is at least as powerful as the required role
 func isRoleSufficient(assigned models.RoleType, required models.RoleType) bool {
-	roleRank := map[models.RoleType]int{
-		models.AdminRole:  4,
-		models.OwnerRole:  3,
-		models.EditorRole: 2,
-		models.ViewerRole: 1,
+	return roleRank[assigned] >= roleRank[required]
+}
+
+// noteRole returns the most permissive role a user holds on a note: owner
+// when the note is theirs, otherwise the better of a role shared on the note
+// and a role on its notebook. An empty role means no access.
+func (s *RoleService) noteRole(db *database.Database, userID uuid.UUID, noteID uuid.UUID) (models.RoleType, error) {
+	var note models.Note
+	if err := db.DB.Select("notebook_id, user_id").First(&note, "id = ?", noteID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrNoteNotFound
+		}
+		return "", err
+	}
+	if note.UserID == userID {
+		return models.OwnerRole, nil
 	}
 
-	return roleRank[assigned] >= roleRank[required]
+	var roles []models.Role
+	if err := db.DB.Where("user_id = ? AND ((resource_id = ? AND resource_type = ?) OR (resource_id = ? AND resource_type = ?))",
+		userID, noteID, models.NoteResource, note.NotebookID, models.NotebookResource).
+		Find(&roles).Error; err != nil {
+		return "", err
+	}
+
+	var best models.RoleType
+	for _, role := range roles {
+		if roleRank[role.Role] > roleRank[best] {
+			best = role.Role
+		}
+	}
+	return best, nil
+}
+
+// CanMoveNote reports whether a user may move a note into another notebook.
+// They must own the note or be an editor of the notebook it is in, and be an
+// editor of the target notebook. A role shared on the note itself lets a
+// user change the note but not where it lives.
+func (s *RoleService) CanMoveNote(db *database.Database, userID uuid.UUID, noteID uuid.UUID, targetNotebookID uuid.UUID) (bool, error) {
+	var adminRoleCount int64
+	if err := db.DB.Model(&models.Role{}).
+		Where("user_id = ? AND resource_type = ? AND role = ?",
+			userID, models.UserResource, models.AdminRole).
+		Count(&adminRoleCount).Error; err != nil {
+		return false, err
+	}
+	if adminRoleCount > 0 {
+		return true, nil
+	}
+
+	var note models.Note
+	if err := db.DB.Select("notebook_id, user_id").First(&note, "id = ?", noteID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, ErrNoteNotFound
+		}
+		return false, err
+	}
+
+	var roles []models.Role
+	if err := db.DB.Where("user_id = ? AND resource_type = ? AND resource_id IN ?",
+		userID, models.NotebookResource, []uuid.UUID{note.NotebookID, targetNotebookID}).
+		Find(&roles).Error; err != nil {
+		return false, err
+	}
+
+	canLeave := note.UserID == userID
+	canEnter := false
+	for _, role := range roles {
+		if !isRoleSufficient(role.Role, models.EditorRole) {
+			continue
+		}
+		if role.ResourceID == note.NotebookID {
+			canLeave = true
+		}
+		if role.ResourceID == targetNotebookID {
+			canEnter = true
+		}
+	}
+	return canLeave && canEnter, nil
 }
 
 // GetRole retrieves a specific role
@@ -299,6 +333,80 @@ func (s *RoleService) RemoveRole(db *database.Database, roleID uuid.UUID) error
 	return nil
 }
 
+// requireNoteOwner returns ErrInsufficientAccess unless the user owns the note
+func (s *RoleService) requireNoteOwner(db *database.Database, userID uuid.UUID, noteID uuid.UUID) error {
+	hasAccess, err := s.HasAccess(db, userID, noteID, models.NoteResource, models.OwnerRole)
+	if err != nil {
+		return err
+	}
+	if !hasAccess {
+		return ErrInsufficientAccess
+	}
+	return nil
+}
+
+// GetNoteRoles lists the roles a note is shared with
+func (s *RoleService) GetNoteRoles(db *database.Database, ownerID uuid.UUID, noteID uuid.UUID) ([]models.Role, error) {
+	if err := s.requireNoteOwner(db, ownerID, noteID); err != nil {
+		return nil, err
+	}
+
+	var roles []models.Role
+	if err := db.DB.Where("resource_id = ? AND resource_type = ? AND role IN ?",
+		noteID, models.NoteResource, []models.RoleType{models.EditorRole, models.ViewerRole}).
+		Order("created_at ASC").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GrantNoteRole shares a single note with another user as viewer or editor.
+// The role adds to whatever the user holds on the notebook; the most
+// permissive of the two applies.
+func (s *RoleService) GrantNoteRole(db *database.Database, ownerID uuid.UUID, noteID uuid.UUID, userID uuid.UUID, role models.RoleType) (models.Role, error) {
+	if role != models.ViewerRole && role != models.EditorRole {
+		return models.Role{}, fmt.Errorf("%w: a note can be shared as viewer or editor", ErrInvalidInput)
+	}
+	if userID == ownerID {
+		return models.Role{}, fmt.Errorf("%w: cannot share a note with yourself", ErrInvalidInput)
+	}
+	if err := s.requireNoteOwner(db, ownerID, noteID); err != nil {
+		return models.Role{}, err
+	}
+
+	var userCount int64
+	if err := db.DB.Model(&models.User{}).Where("id = ?", userID).Count(&userCount).Error; err != nil {
+		return models.Role{}, err
+	}
+	if userCount == 0 {
+		return models.Role{}, ErrUserNotFound
+	}
+
+	if err := s.AssignRole(db, userID, noteID, models.NoteResource, role); err != nil {
+		return models.Role{}, err
+	}
+	return s.GetRole(db, userID, noteID, models.NoteResource)
+}
+
+// RevokeNoteRole stops sharing a note with a user. Access the user has
+// through the notebook is not affected.
+func (s *RoleService) RevokeNoteRole(db *database.Database, ownerID uuid.UUID, noteID uuid.UUID, userID uuid.UUID) error {
+	if err := s.requireNoteOwner(db, ownerID, noteID); err != nil {
+		return err
+	}
+
+	result := db.DB.Where("user_id = ? AND resource_id = ? AND resource_type = ? AND role IN ?",
+		userID, noteID, models.NoteResource, []models.RoleType{models.EditorRole, models.ViewerRole}).
+		Delete(&models.Role{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
 // HasSystemRole checks if a user has a specific system-level role
 func (s *RoleService) HasSystemRole(db *database.Database, userID string, requiredRole string) (bool, error) {
 	userUUID, err := uuid.Parse(userID)
@@ -285,3 +285,221 @@ func TestHasBlockAccess(t *testing.T) {
 	assert.True(t, hasAccess)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+// expectNotAdmin mocks the admin check every access check starts with
+func expectNotAdmin(mock sqlmock.Sqlmock, userID uuid.UUID) {
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "roles" WHERE \(user_id = \$1 AND resource_type = \$2 AND role = \$3\)`).
+		WithArgs(userID, models.UserResource, models.AdminRole).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+}
+
+// expectNoteRoleLookup mocks the queries resolving a non-admin user's
+// effective role on a note: the note and the user's note and notebook roles
+func expectNoteRoleLookup(mock sqlmock.Sqlmock, userID, noteID, notebookID, noteOwnerID uuid.UUID, roles ...models.Role) {
+	mock.ExpectQuery(`SELECT notebook_id, user_id FROM "notes" WHERE id = \$1`).
+		WithArgs(noteID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"notebook_id", "user_id"}).AddRow(notebookID, noteOwnerID))
+	if noteOwnerID == userID {
+		return
+	}
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "resource_id", "resource_type", "role"})
+	for _, role := range roles {
+		rows.AddRow(uuid.New(), userID, role.ResourceID, role.ResourceType, role.Role)
+	}
+	mock.ExpectQuery(`SELECT \* FROM "roles" WHERE \(user_id = \$1 AND \(\(resource_id = \$2 AND resource_type = \$3\) OR \(resource_id = \$4 AND resource_type = \$5\)\)\)`).
+		WithArgs(userID, noteID, models.NoteResource, notebookID, models.NotebookResource).
+		WillReturnRows(rows)
+}
+
+func TestHasNoteAccess_PermissionMatrix(t *testing.T) {
+	noteID := uuid.New()
+	notebookID := uuid.New()
+	noteOwnerID := uuid.New()
+	notebookRole := func(role models.RoleType) models.Role {
+		return models.Role{ResourceID: notebookID, ResourceType: models.NotebookResource, Role: role}
+	}
+	noteRole := func(role models.RoleType) models.Role {
+		return models.Role{ResourceID: noteID, ResourceType: models.NoteResource, Role: role}
+	}
+
+	// move is whether the user may move the note to a notebook they edit
+	tests := []struct {
+		name   string
+		owner  bool
+		roles  []models.Role
+		access map[string]bool
+		move   bool
+	}{
+		{"note owner", true, nil, map[string]bool{"viewer": true, "editor": true, "owner": true}, true},
+		{"notebook owner", false, []models.Role{notebookRole(models.OwnerRole)}, map[string]bool{"viewer": true, "editor": true, "owner": true}, true},
+		{"note editor", false, []models.Role{noteRole(models.EditorRole)}, map[string]bool{"viewer": true, "editor": true, "owner": false}, false},
+		{"note viewer", false, []models.Role{noteRole(models.ViewerRole)}, map[string]bool{"viewer": true, "editor": false, "owner": false}, false},
+		{"note viewer, notebook editor", false, []models.Role{noteRole(models.ViewerRole), notebookRole(models.EditorRole)}, map[string]bool{"viewer": true, "editor": true, "owner": false}, true},
+		{"note editor, notebook viewer", false, []models.Role{notebookRole(models.ViewerRole), noteRole(models.EditorRole)}, map[string]bool{"viewer": true, "editor": true, "owner": false}, false},
+		{"no access", false, nil, map[string]bool{"viewer": false, "editor": false, "owner": false}, false},
+	}
+
+	service := NewRoleService()
+	for _, tt := range tests {
+		for _, required := range []string{"viewer", "editor", "owner"} {
+			t.Run(tt.name+"/"+required, func(t *testing.T) {
+				db, mock, close := testutils.SetupMockDB()
+				defer close()
+
+				userID := uuid.New()
+				owner := noteOwnerID
+				if tt.owner {
+					owner = userID
+				}
+				expectNotAdmin(mock, userID)
+				expectNoteRoleLookup(mock, userID, noteID, notebookID, owner, tt.roles...)
+
+				hasAccess, err := service.HasNoteAccess(db, userID.String(), noteID.String(), required)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.access[required], hasAccess)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			})
+		}
+
+		// Moving also needs editor access to the target notebook
+		for _, targetRole := range []models.RoleType{models.EditorRole, models.ViewerRole} {
+			t.Run(tt.name+"/move to "+string(targetRole)+" notebook", func(t *testing.T) {
+				db, mock, close := testutils.SetupMockDB()
+				defer close()
+
+				userID := uuid.New()
+				targetID := uuid.New()
+				owner := noteOwnerID
+				if tt.owner {
+					owner = userID
+				}
+				expectNotAdmin(mock, userID)
+				mock.ExpectQuery(`SELECT notebook_id, user_id FROM "notes" WHERE id = \$1`).
+					WithArgs(noteID, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"notebook_id", "user_id"}).AddRow(notebookID, owner))
+				rows := sqlmock.NewRows([]string{"id", "user_id", "resource_id", "resource_type", "role"}).
+					AddRow(uuid.New(), userID, targetID, models.NotebookResource, targetRole)
+				for _, role := range tt.roles {
+					if role.ResourceType == models.NotebookResource {
+						rows.AddRow(uuid.New(), userID, role.ResourceID, role.ResourceType, role.Role)
+					}
+				}
+				mock.ExpectQuery(`SELECT \* FROM "roles" WHERE \(user_id = \$1 AND resource_type = \$2 AND resource_id IN \(\$3,\$4\)\)`).
+					WithArgs(userID, models.NotebookResource, notebookID, targetID).
+					WillReturnRows(rows)
+
+				canMove, err := service.CanMoveNote(db, userID, noteID, targetID)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.move && targetRole == models.EditorRole, canMove)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			})
+		}
+	}
+}
+
+func TestHasAccess_BlockUsesSharedNoteRole(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	service := NewRoleService()
+	userID := uuid.New()
+	blockID := uuid.New()
+	noteID := uuid.New()
+	notebookID := uuid.New()
+
+	expectNotAdmin(mock, userID)
+	mock.ExpectQuery(`SELECT \* FROM "roles" WHERE \(user_id = \$1 AND resource_id = \$2 AND resource_type = \$3\)`).
+		WithArgs(userID, blockID, models.BlockResource, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE id = \$1`).
+		WithArgs(blockID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id"}).AddRow(blockID, noteID))
+	expectNoteRoleLookup(mock, userID, noteID, notebookID, uuid.New(),
+		models.Role{ResourceID: noteID, ResourceType: models.NoteResource, Role: models.EditorRole})
+
+	hasAccess, err := service.HasAccess(db, userID, blockID, models.BlockResource, models.EditorRole)
+	assert.NoError(t, err)
+	assert.True(t, hasAccess)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGrantNoteRole(t *testing.T) {
+	service := NewRoleService()
+	ownerID := uuid.New()
+	userID := uuid.New()
+	noteID := uuid.New()
+	notebookID := uuid.New()
+
+	t.Run("rejects roles other than viewer and editor", func(t *testing.T) {
+		db, mock, close := testutils.SetupMockDB()
+		defer close()
+
+		_, err := service.GrantNoteRole(db, ownerID, noteID, userID, models.OwnerRole)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("requires note ownership", func(t *testing.T) {
+		db, mock, close := testutils.SetupMockDB()
+		defer close()
+
+		expectNotAdmin(mock, ownerID)
+		expectNoteRoleLookup(mock, ownerID, noteID, notebookID, uuid.New(),
+			models.Role{ResourceID: noteID, ResourceType: models.NoteResource, Role: models.EditorRole})
+
+		_, err := service.GrantNoteRole(db, ownerID, noteID, userID, models.ViewerRole)
+		assert.ErrorIs(t, err, ErrInsufficientAccess)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("shares the note", func(t *testing.T) {
+		db, mock, close := testutils.SetupMockDB()
+		defer close()
+
+		expectNotAdmin(mock, ownerID)
+		expectNoteRoleLookup(mock, ownerID, noteID, notebookID, ownerID)
+		mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE id = \$1`).
+			WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(`SELECT \* FROM "roles" WHERE \(user_id = \$1 AND resource_id = \$2 AND resource_type = \$3\)`).
+			WithArgs(userID, noteID, models.NoteResource, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO "roles"`).
+			WithArgs(sqlmock.AnyArg(), userID, noteID, models.NoteResource, models.ViewerRole, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(`SELECT \* FROM "roles" WHERE \(user_id = \$1 AND resource_id = \$2 AND resource_type = \$3\)`).
+			WithArgs(userID, noteID, models.NoteResource, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "resource_id", "resource_type", "role"}).
+				AddRow(uuid.New(), userID, noteID, models.NoteResource, models.ViewerRole))
+
+		role, err := service.GrantNoteRole(db, ownerID, noteID, userID, models.ViewerRole)
+		assert.NoError(t, err)
+		assert.Equal(t, models.ViewerRole, role.Role)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRevokeNoteRole(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	service := NewRoleService()
+	ownerID := uuid.New()
+	userID := uuid.New()
+	noteID := uuid.New()
+
+	expectNotAdmin(mock, ownerID)
+	expectNoteRoleLookup(mock, ownerID, noteID, uuid.New(), ownerID)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "roles" SET "deleted_at"=\$1 WHERE \(user_id = \$2 AND resource_id = \$3 AND resource_type = \$4 AND role IN \(\$5,\$6\)\)`).
+		WithArgs(sqlmock.AnyArg(), userID, noteID, models.NoteResource, models.EditorRole, models.ViewerRole).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err := service.RevokeNoteRole(db, ownerID, noteID, userID)
+	assert.ErrorIs(t, err, ErrRoleNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
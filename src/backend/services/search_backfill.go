@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// SearchBackfill is how a semantic search with fewer matches than its limit
+// is filled up
+type SearchBackfill string
+
+const (
+	// BackfillNone returns the semantic matches only
+	BackfillNone SearchBackfill = ""
+	// BackfillRecency fills up with the most recently updated notes
+	BackfillRecency SearchBackfill = "recency"
+	// BackfillText fills up with the notes containing the query text
+	BackfillText SearchBackfill = "text"
+)
+
+// noteTextSearchCondition matches notes by title and preview, taking the
+// user ID, the query as an ILIKE pattern twice and the query itself
+const noteTextSearchCondition = "user_id = ? AND (title ILIKE ? OR preview ILIKE ? OR to_tsvector('simple', title || ' ' || preview) @@ plainto_tsquery('simple', ?))"
+
+// ParseSearchBackfill reads the backfill parameter, none when empty
+func ParseSearchBackfill(value string) (SearchBackfill, error) {
+	switch backfill := SearchBackfill(value); backfill {
+	case BackfillNone, BackfillRecency, BackfillText:
+		return backfill, nil
+	case "none":
+		return BackfillNone, nil
+	default:
+		return BackfillNone, fmt.Errorf("%w: backfill must be none, recency or text", ErrInvalidInput)
+	}
+}
+
+// backfillSearch loads up to limit notes of the user for the backfill,
+// leaving out the notes already found. They are returned as enhanced notes
+// like the semantic matches, marked supplemental in their AI metadata with
+// the backfill that found them and no relevance score.
+func (ai *AIService) backfillSearch(ctx context.Context, userID uuid.UUID, query string, backfill SearchBackfill, found []models.AIEnhancedNote, limit int) ([]models.AIEnhancedNote, error) {
+	if backfill == BackfillNone || limit <= 0 {
+		return nil, nil
+	}
+
+	db := ai.db.WithContext(ctx).Scopes(models.NotTrashed)
+	if backfill == BackfillText {
+		pattern := "%" + query + "%"
+		db = db.Where(noteTextSearchCondition, userID, pattern, pattern, query)
+	} else {
+		db = db.Where("user_id = ?", userID)
+	}
+	if len(found) > 0 {
+		foundIDs := make([]uuid.UUID, len(found))
+		for i, enhancedNote := range found {
+			foundIDs[i] = enhancedNote.NoteID
+		}
+		db = db.Where("id NOT IN ?", foundIDs)
+	}
+	var notes []models.Note
+	if err := db.Order("updated_at DESC").Limit(limit).Find(&notes).Error; err != nil {
+		return nil, fmt.Errorf("failed to backfill search: %w", err)
+	}
+	if len(notes) == 0 {
+		return nil, nil
+	}
+
+	noteIDs := make([]uuid.UUID, len(notes))
+	for i, note := range notes {
+		noteIDs[i] = note.ID
+	}
+	var enhanced []models.AIEnhancedNote
+	if err := ai.db.WithContext(ctx).Where("note_id IN ?", noteIDs).Find(&enhanced).Error; err != nil {
+		return nil, fmt.Errorf("failed to backfill search: %w", err)
+	}
+	enhancedByNote := make(map[uuid.UUID]models.AIEnhancedNote, len(enhanced))
+	for _, enhancedNote := range enhanced {
+		enhancedByNote[enhancedNote.NoteID] = enhancedNote
+	}
+
+	results := make([]models.AIEnhancedNote, len(notes))
+	for i, note := range notes {
+		enhancedNote, ok := enhancedByNote[note.ID]
+		if !ok {
+			enhancedNote = models.AIEnhancedNote{NoteID: note.ID}
+		}
+		enhancedNote.Note = note
+		metadata := models.AIMetadata{}
+		for k, v := range enhancedNote.AIMetadata {
+			metadata[k] = v
+		}
+		metadata["supplemental"] = true
+		metadata["backfill"] = string(backfill)
+		enhancedNote.AIMetadata = metadata
+		results[i] = enhancedNote
+	}
+	return results, nil
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchNotesByEmbedding_BackfillFillsSparseCollection(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID, match := uuid.New(), uuid.New()
+	query := "/api/v2/tenants/default_tenant/databases/default_database/collections/" + NoteEmbeddingsCollection + "/query"
+	server := newChromaMockServer(t, map[string]string{
+		// The collection holds a single note
+		"POST " + query: fmt.Sprintf(`{"ids":[["%s"]],"distances":[[0.2]],"metadatas":[[{}]]}`, NoteIDToChromaID(match)),
+	})
+	ai := &AIService{db: db.DB, chromaService: NewChromaService(server.URL, nil)}
+
+	mock.ExpectQuery(`SELECT "ai_enhanced_notes"."note_id".* FROM "ai_enhanced_notes" JOIN notes`).
+		WithArgs(match, userID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"note_id", "summary"}).AddRow(match, "Garden plan"))
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE "notes"."id" = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(match, "Garden"))
+
+	// The backfill leaves out the semantic match
+	recent := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE user_id = \$1 AND id NOT IN \(\$2\) AND "notes"."deleted_at" IS NULL ORDER BY updated_at DESC LIMIT \$3`).
+		WithArgs(userID, match, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).
+			AddRow(recent[0], "Groceries").AddRow(recent[1], "Taxes").AddRow(recent[2], "Trip"))
+	mock.ExpectQuery(`SELECT \* FROM "ai_enhanced_notes" WHERE note_id IN \(\$1,\$2,\$3\)`).
+		WithArgs(recent[0], recent[1], recent[2]).
+		WillReturnRows(sqlmock.NewRows([]string{"note_id", "summary"}).AddRow(recent[1], "Tax papers"))
+
+	results, err := ai.SearchNotesByEmbedding(context.Background(), "garden", userID, 4, RelevanceRanking, BackfillRecency)
+	require.NoError(t, err)
+	require.Len(t, results, 4, "backfill fills up to the limit")
+
+	seen := make(map[uuid.UUID]bool)
+	for _, result := range results {
+		assert.False(t, seen[result.NoteID], "note %s returned twice", result.NoteID)
+		seen[result.NoteID] = true
+	}
+
+	assert.Equal(t, match, results[0].NoteID, "semantic matches come first")
+	assert.InDelta(t, 0.8, results[0].AIMetadata["relevance_score"], 1e-9)
+	assert.NotContains(t, results[0].AIMetadata, "supplemental")
+	for i, result := range results[1:] {
+		assert.Equal(t, recent[i], result.NoteID)
+		assert.Equal(t, recent[i], result.Note.ID)
+		assert.Equal(t, true, result.AIMetadata["supplemental"])
+		assert.Equal(t, "recency", result.AIMetadata["backfill"])
+		assert.NotContains(t, result.AIMetadata, "relevance_score")
+	}
+	assert.Equal(t, "Tax papers", results[2].Summary, "a backfilled note keeps its enhancement")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchNotesByEmbedding_NoBackfillByDefault(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	query := "/api/v2/tenants/default_tenant/databases/default_database/collections/" + NoteEmbeddingsCollection + "/query"
+	server := newChromaMockServer(t, map[string]string{"POST " + query: `{"ids":[[]],"distances":[[]]}`})
+	ai := &AIService{db: db.DB, chromaService: NewChromaService(server.URL, nil)}
+
+	results, err := ai.SearchNotesByEmbedding(context.Background(), "garden", uuid.New(), 4, RelevanceRanking, BackfillNone)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	assert.NoError(t, mock.ExpectationsWereMet(), "no notes are loaded without backfill")
+}
+
+func TestBackfillSearch_TextMatchesQuery(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	ai := &AIService{db: db.DB}
+
+	userID := uuid.New()
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE \(user_id = \$1 AND \(title ILIKE \$2 OR preview ILIKE \$3 .*\)\) AND "notes"."deleted_at" IS NULL ORDER BY updated_at DESC LIMIT \$5`).
+		WithArgs(userID, "%garden%", "%garden%", "garden", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	results, err := ai.backfillSearch(context.Background(), userID, "garden", BackfillText, nil, 2)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParseSearchBackfill(t *testing.T) {
+	for value, want := range map[string]SearchBackfill{"": BackfillNone, "none": BackfillNone, "recency": BackfillRecency, "text": BackfillText} {
+		backfill, err := ParseSearchBackfill(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, backfill, value)
+	}
+
+	_, err := ParseSearchBackfill("random")
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// SearchOrder is how semantic and related search results are ranked
+type SearchOrder string
+
+const (
+	// OrderRelevance ranks by similarity only
+	OrderRelevance SearchOrder = "relevance"
+	// OrderRecency ranks the matches by when they were last updated
+	OrderRecency SearchOrder = "recency"
+	// OrderHybrid weighs similarity by a recency decay
+	OrderHybrid SearchOrder = "hybrid"
+)
+
+const (
+	defaultRecencyHalfLifeDays = 30
+	// defaultMinSimilarity is the similarity a match needs to be returned
+	defaultMinSimilarity = 0.2
+	// recencyWeight is the share of the hybrid score that decays with age, so
+	// an old note keeps at least half of its similarity
+	recencyWeight = 0.5
+	// rankingCandidates is how many more matches than requested are fetched
+	// when re-ranking, so recent notes just outside the top results compete
+	rankingCandidates    = 3
+	maxRankingCandidates = 100
+)
+
+// SearchRanking selects the result order, the recency half-life and the
+// similarity below which matches are dropped
+type SearchRanking struct {
+	Order         SearchOrder
+	HalfLife      time.Duration
+	MinSimilarity float64
+}
+
+// RelevanceRanking is plain similarity order
+var RelevanceRanking = SearchRanking{Order: OrderRelevance}
+
+// ParseSearchRanking reads the order, half_life_days and min_similarity
+// parameters. An empty order is relevance; the half-life defaults to
+// SEARCH_RECENCY_HALF_LIFE_DAYS and, when minSimilarity is nil, the threshold
+// to SEARCH_MIN_SIMILARITY.
+func ParseSearchRanking(order string, halfLifeDays float64, minSimilarity *float64) (SearchRanking, error) {
+	ranking := SearchRanking{Order: SearchOrder(order), HalfLife: defaultRecencyHalfLife(), MinSimilarity: DefaultMinSimilarity()}
+	switch ranking.Order {
+	case "":
+		ranking.Order = OrderRelevance
+	case OrderRelevance, OrderRecency, OrderHybrid:
+	default:
+		return SearchRanking{}, fmt.Errorf("%w: order must be relevance, recency or hybrid", ErrInvalidInput)
+	}
+	if halfLifeDays < 0 {
+		return SearchRanking{}, fmt.Errorf("%w: half_life_days must be positive", ErrInvalidInput)
+	}
+	if halfLifeDays > 0 {
+		ranking.HalfLife = time.Duration(halfLifeDays * float64(24*time.Hour))
+	}
+	if minSimilarity != nil {
+		if *minSimilarity < 0 || *minSimilarity > 1 {
+			return SearchRanking{}, fmt.Errorf("%w: min_similarity must be between 0 and 1", ErrInvalidInput)
+		}
+		ranking.MinSimilarity = *minSimilarity
+	}
+	return ranking, nil
+}
+
+// DefaultMinSimilarity reads SEARCH_MIN_SIMILARITY, a similarity between 0
+// and 1
+func DefaultMinSimilarity() float64 {
+	if value, err := strconv.ParseFloat(os.Getenv("SEARCH_MIN_SIMILARITY"), 64); err == nil && value >= 0 && value <= 1 {
+		return value
+	}
+	return defaultMinSimilarity
+}
+
+// defaultRecencyHalfLife reads SEARCH_RECENCY_HALF_LIFE_DAYS
+func defaultRecencyHalfLife() time.Duration {
+	days := float64(defaultRecencyHalfLifeDays)
+	if value, err := strconv.ParseFloat(os.Getenv("SEARCH_RECENCY_HALF_LIFE_DAYS"), 64); err == nil && value > 0 {
+		days = value
+	}
+	return time.Duration(days * float64(24*time.Hour))
+}
+
+// candidates is how many matches to fetch for limit results
+func (r SearchRanking) candidates(limit int) int {
+	if r.Order == OrderRelevance || r.Order == "" {
+		return limit
+	}
+	candidates := limit * rankingCandidates
+	if candidates > maxRankingCandidates {
+		candidates = maxRankingCandidates
+	}
+	if candidates < limit {
+		candidates = limit
+	}
+	return candidates
+}
+
+// searchHit is a vector search match with its ranking inputs and score
+type searchHit struct {
+	NoteID     uuid.UUID
+	Similarity float64
+	UpdatedAt  time.Time
+	Score      float64
+}
+
+// ScoredNote is a search result with the score it was ranked by
+type ScoredNote struct {
+	models.Note
+	Similarity float64 `json:"similarity"`
+	Score      float64 `json:"score"`
+}
+
+// searchHits reads the matches of the first query, skipping invalid and
+// repeated IDs. Similarity is derived from the distance of the collection's
+// space, see distanceSimilarity.
+func searchHits(results *ChromaQueryResponse, space string) []searchHit {
+	return queryHits(results, 0, space)
+}
+
+// queryHits reads the matches of the query at index query, like searchHits
+func queryHits(results *ChromaQueryResponse, query int, space string) []searchHit {
+	if results == nil || len(results.IDs) <= query {
+		return nil
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	var hits []searchHit
+	for i, chromaID := range results.IDs[query] {
+		noteID, err := ChromaIDToNoteID(chromaID)
+		if err != nil || seen[noteID] {
+			continue
+		}
+		seen[noteID] = true
+
+		hit := searchHit{NoteID: noteID}
+		if len(results.Distances) > query && len(results.Distances[query]) > i {
+			hit.Similarity = distanceSimilarity(space, results.Distances[query][i])
+		}
+		if len(results.Metadatas) > query && len(results.Metadatas[query]) > i {
+			if updatedAt, ok := results.Metadatas[query][i]["updated_at"].(string); ok {
+				hit.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+			}
+		}
+		hits = append(hits, hit)
+	}
+	return hits
+}
+
+// distanceSimilarity turns a Chroma distance in space into the cosine
+// similarity of the embeddings, between 0 and 1, so one minimum similarity
+// fits every space. Cosine distance is 1 - cos and inner product distance is
+// 1 - dot, which is the same for the unit-length vectors of the embedding
+// models; squared L2 distance between unit vectors is 2 - 2cos.
+func distanceSimilarity(space string, distance float64) float64 {
+	similarity := 1 - distance
+	if space == "l2" {
+		similarity = 1 - distance/2
+	}
+	return math.Min(1, math.Max(0, similarity))
+}
+
+// rankHits drops the hits below the ranking's minimum similarity, then
+// scores and orders the rest. Relevance keeps the similarity order, recency
+// sorts by last update, and hybrid multiplies similarity by
+// 1 - recencyWeight + recencyWeight * 0.5^(age / half-life).
+func rankHits(hits []searchHit, ranking SearchRanking, now time.Time) []searchHit {
+	kept := hits[:0]
+	for _, hit := range hits {
+		if hit.Similarity >= ranking.MinSimilarity {
+			kept = append(kept, hit)
+		}
+	}
+	hits = kept
+
+	halfLife := ranking.HalfLife
+	if halfLife <= 0 {
+		halfLife = defaultRecencyHalfLife()
+	}
+
+	for i := range hits {
+		hit := &hits[i]
+		switch ranking.Order {
+		case OrderHybrid:
+			decay := 0.0
+			if !hit.UpdatedAt.IsZero() {
+				age := math.Max(0, now.Sub(hit.UpdatedAt).Hours())
+				decay = math.Pow(0.5, age/halfLife.Hours())
+			}
+			hit.Score = hit.Similarity * (1 - recencyWeight + recencyWeight*decay)
+		default:
+			hit.Score = hit.Similarity
+		}
+	}
+
+	switch ranking.Order {
+	case OrderRecency:
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].UpdatedAt.After(hits[j].UpdatedAt) })
+	case OrderHybrid:
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	}
+	return hits
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rankingFixture(now time.Time) (old, fresh, stale uuid.UUID, hits []searchHit) {
+	old, fresh, stale = uuid.New(), uuid.New(), uuid.New()
+	hits = []searchHit{
+		{NoteID: old, Similarity: 0.90, UpdatedAt: now.AddDate(0, 0, -365)},
+		{NoteID: fresh, Similarity: 0.80, UpdatedAt: now.Add(-time.Hour)},
+		{NoteID: stale, Similarity: 0.50, UpdatedAt: now.AddDate(0, 0, -30)},
+	}
+	return old, fresh, stale, hits
+}
+
+func hitIDs(hits []searchHit) []uuid.UUID {
+	ids := make([]uuid.UUID, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.NoteID
+	}
+	return ids
+}
+
+func TestRankHits_Relevance(t *testing.T) {
+	now := time.Now()
+	old, fresh, stale, hits := rankingFixture(now)
+
+	ranked := rankHits(hits, RelevanceRanking, now)
+
+	assert.Equal(t, []uuid.UUID{old, fresh, stale}, hitIDs(ranked))
+	assert.Equal(t, 0.90, ranked[0].Score)
+}
+
+func TestRankHits_Recency(t *testing.T) {
+	now := time.Now()
+	old, fresh, stale, hits := rankingFixture(now)
+
+	ranked := rankHits(hits, SearchRanking{Order: OrderRecency, HalfLife: 30 * 24 * time.Hour}, now)
+
+	assert.Equal(t, []uuid.UUID{fresh, stale, old}, hitIDs(ranked))
+}
+
+func TestRankHits_HybridBlendsSimilarityAndRecency(t *testing.T) {
+	now := time.Now()
+	old, fresh, stale, hits := rankingFixture(now)
+
+	ranked := rankHits(hits, SearchRanking{Order: OrderHybrid, HalfLife: 30 * 24 * time.Hour}, now)
+
+	// The slightly less similar recent note beats the year old one, which
+	// still keeps about half of its similarity
+	assert.Equal(t, []uuid.UUID{fresh, old, stale}, hitIDs(ranked))
+	assert.InDelta(t, 0.80, ranked[0].Score, 0.001)
+	assert.InDelta(t, 0.45, ranked[1].Score, 0.001)
+	// One half-life old: 0.5 * (0.5 + 0.5 * 0.5)
+	assert.InDelta(t, 0.375, ranked[2].Score, 0.001)
+}
+
+func TestRankHits_HybridHalfLifeChangesOrder(t *testing.T) {
+	now := time.Now()
+	old, fresh, _, hits := rankingFixture(now)
+
+	// With a half-life of years the old note's similarity wins again
+	ranked := rankHits(hits, SearchRanking{Order: OrderHybrid, HalfLife: 10 * 365 * 24 * time.Hour}, now)
+
+	assert.Equal(t, old, ranked[0].NoteID)
+	assert.Equal(t, fresh, ranked[1].NoteID)
+}
+
+func TestSearchHits_ParsesDistancesAndDates(t *testing.T) {
+	updated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	first, second := uuid.New(), uuid.New()
+	results := &ChromaQueryResponse{
+		IDs:       [][]string{{NoteIDToChromaID(first), "not-a-note", NoteIDToChromaID(second), NoteIDToChromaID(first)}},
+		Distances: [][]float64{{0.25, 0.3, 1.4, 0.5}},
+		Metadatas: [][]map[string]interface{}{{
+			{"updated_at": updated.Format(time.RFC3339)},
+			{},
+			{},
+			{},
+		}},
+	}
+
+	hits := searchHits(results, "cosine")
+
+	require.Len(t, hits, 2)
+	assert.Equal(t, first, hits[0].NoteID)
+	assert.Equal(t, 0.75, hits[0].Similarity)
+	assert.True(t, updated.Equal(hits[0].UpdatedAt))
+	assert.Equal(t, second, hits[1].NoteID)
+	assert.Equal(t, 0.0, hits[1].Similarity)
+	assert.True(t, hits[1].UpdatedAt.IsZero())
+}
+
+func TestDistanceSimilarity_PerSpace(t *testing.T) {
+	// Distances of unit vectors 60 degrees apart, a cosine similarity of 0.5
+	assert.InDelta(t, 0.5, distanceSimilarity("cosine", 0.5), 1e-9)
+	assert.InDelta(t, 0.5, distanceSimilarity("ip", 0.5), 1e-9)
+	assert.InDelta(t, 0.5, distanceSimilarity("l2", 1.0), 1e-9)
+
+	// Opposite vectors are as far apart as it gets in every space
+	assert.Equal(t, 0.0, distanceSimilarity("cosine", 2))
+	assert.Equal(t, 0.0, distanceSimilarity("ip", 2))
+	assert.Equal(t, 0.0, distanceSimilarity("l2", 4))
+	// Unnormalized inner products can't pass as more than identical
+	assert.Equal(t, 1.0, distanceSimilarity("ip", -3))
+}
+
+func TestParseSearchRanking(t *testing.T) {
+	t.Setenv("SEARCH_RECENCY_HALF_LIFE_DAYS", "7")
+
+	ranking, err := ParseSearchRanking("", 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, OrderRelevance, ranking.Order)
+	assert.Equal(t, 7*24*time.Hour, ranking.HalfLife)
+
+	ranking, err = ParseSearchRanking("hybrid", 1.5, nil)
+	require.NoError(t, err)
+	assert.Equal(t, OrderHybrid, ranking.Order)
+	assert.Equal(t, 36*time.Hour, ranking.HalfLife)
+	assert.Equal(t, 30, ranking.candidates(10))
+	assert.Equal(t, maxRankingCandidates, ranking.candidates(50))
+	assert.Equal(t, 10, RelevanceRanking.candidates(10))
+
+	assert.Equal(t, defaultMinSimilarity, ranking.MinSimilarity)
+
+	_, err = ParseSearchRanking("newest", 0, nil)
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+	_, err = ParseSearchRanking("recency", -1, nil)
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+}
+
+func TestParseSearchRanking_MinSimilarity(t *testing.T) {
+	t.Setenv("SEARCH_MIN_SIMILARITY", "0.45")
+
+	ranking, err := ParseSearchRanking("", 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0.45, ranking.MinSimilarity)
+
+	override := 0.0
+	ranking, err = ParseSearchRanking("", 0, &override)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, ranking.MinSimilarity, "a request can turn the threshold off")
+
+	tooHigh := 1.5
+	_, err = ParseSearchRanking("", 0, &tooHigh)
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+}
+
+func TestRankHits_DropsHitsBelowMinSimilarity(t *testing.T) {
+	now := time.Now()
+	old, fresh, _, hits := rankingFixture(now)
+
+	ranked := rankHits(hits, SearchRanking{Order: OrderRecency, MinSimilarity: 0.6}, now)
+
+	assert.Equal(t, []uuid.UUID{fresh, old}, hitIDs(ranked))
+}
+
+func TestFindRankedRelatedNotes_DropsSubThresholdMatches(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID, nearest, near, far := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	query := "/api/v2/tenants/default_tenant/databases/default_database/collections/" + NoteEmbeddingsCollection + "/query"
+	server := newChromaMockServer(t, map[string]string{
+		// Similarities 0.9, 0.7 and 0.05
+		"POST " + query: fmt.Sprintf(`{"ids":[["%s","%s","%s"]],"distances":[[0.1,0.3,0.95]],"metadatas":[[{},{},{}]]}`,
+			NoteIDToChromaID(nearest), NoteIDToChromaID(near), NoteIDToChromaID(far)),
+	})
+	ai := &AIService{db: db.DB, chromaService: NewChromaService(server.URL, nil)}
+
+	mock.ExpectQuery(`SELECT \* FROM "notes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(noteID, "Tomatoes"))
+	mock.ExpectQuery(`SELECT \* FROM "blocks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	for _, id := range []uuid.UUID{nearest, near} {
+		mock.ExpectQuery(`SELECT \* FROM "notes"`).
+			WithArgs(id, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(id, "Garden"))
+	}
+
+	related, err := ai.FindRankedRelatedNotes(context.Background(), noteID, 5,
+		SearchRanking{Order: OrderRelevance, MinSimilarity: 0.5})
+	require.NoError(t, err)
+	require.Len(t, related, 2, "the far match is dropped rather than padding the limit")
+	assert.Equal(t, nearest, related[0].ID)
+	assert.Equal(t, near, related[1].ID)
+	assert.InDelta(t, 0.7, related[1].Similarity, 1e-9)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+
+	"owlistic-notes/owlistic/database"
+
+	"gorm.io/gorm"
+)
+
+// sharedTx is a transaction handed to services that begin, commit and roll
+// back their own. Their calls leave it alone, so their writes only land when
+// the outer transaction commits.
+type sharedTx struct {
+	gorm.ConnPool
+}
+
+func (t *sharedTx) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return t, nil
+}
+
+func (t *sharedTx) Commit() error   { return nil }
+func (t *sharedTx) Rollback() error { return nil }
+
+// inOneTransaction runs fn in a single transaction of db, including the
+// transactions the services fn calls start. fn failing rolls back all of it.
+func inOneTransaction(db *gorm.DB, fn func(db *database.Database) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		shared := tx.Session(&gorm.Session{NewDB: true, Context: tx.Statement.Context})
+		shared.Statement.ConnPool = &sharedTx{ConnPool: tx.Statement.ConnPool}
+		return fn(&database.Database{DB: shared})
+	})
+}
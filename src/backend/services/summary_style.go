@@ -0,0 +1,78 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"owlistic-notes/owlistic/models"
+)
+
+// SummaryStyle is how long a summary is and how it is laid out
+type SummaryStyle struct {
+	Length string `json:"length"`
+	Format string `json:"format"`
+}
+
+// summaryWords and summaryMaxTokens are what each length asks the model for
+// and lets it answer with
+var (
+	summaryWords     = map[string]int{models.SummaryShort: 50, models.SummaryMedium: 120, models.SummaryLong: 250}
+	summaryMaxTokens = map[string]int{models.SummaryShort: 200, models.SummaryMedium: 400, models.SummaryLong: 800}
+)
+
+// summaryStyle is the style the settings ask summaries to be written in
+func (s EffectiveAISettings) summaryStyle() SummaryStyle {
+	return SummaryStyle{Length: s.SummaryLength, Format: s.SummaryFormat}
+}
+
+// withDefaults fills in the server default length and format
+func (s SummaryStyle) withDefaults() SummaryStyle {
+	defaults := DefaultAISettings()
+	if _, ok := summaryWords[s.Length]; !ok {
+		s.Length = defaults.SummaryLength
+	}
+	if s.Format != models.SummaryParagraph && s.Format != models.SummaryBullets {
+		s.Format = defaults.SummaryFormat
+	}
+	return s
+}
+
+// MaxTokens is the token budget of a summary of this length
+func (s SummaryStyle) MaxTokens() int {
+	return summaryMaxTokens[s.withDefaults().Length]
+}
+
+var (
+	summaryBulletPrefix = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)])\s+`)
+	summarySentenceEnd  = regexp.MustCompile(`([.!?])\s+`)
+)
+
+// formatSummary lays out a generated summary the way the style asks, as
+// models don't always follow the format they're asked for
+func (s SummaryStyle) formatSummary(summary string) string {
+	summary = strings.TrimSpace(summary)
+	if s.withDefaults().Format != models.SummaryBullets || summary == "" {
+		return summary
+	}
+
+	var points []string
+	for _, line := range strings.Split(summary, "\n") {
+		if summaryBulletPrefix.MatchString(line) {
+			points = append(points, summaryBulletPrefix.ReplaceAllString(line, ""))
+		}
+	}
+	if len(points) == 0 {
+		// A paragraph came back, so every sentence becomes a point
+		for _, sentence := range strings.Split(summarySentenceEnd.ReplaceAllString(summary, "$1\n"), "\n") {
+			points = append(points, sentence)
+		}
+	}
+
+	var b strings.Builder
+	for _, point := range points {
+		if point = strings.TrimSpace(point); point != "" {
+			b.WriteString("- " + point + "\n")
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
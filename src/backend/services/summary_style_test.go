@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSummaryStubAIService answers every request with reply and records the
+// last request
+func newSummaryStubAIService(t *testing.T, reply string) (*AIService, *AnthropicRequest) {
+	var last AnthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&last))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": reply}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return &AIService{
+		anthropicKey:     "test-key",
+		anthropicBaseURL: server.URL,
+		httpClient:       server.Client(),
+		health:           aiHealth{ttl: time.Minute},
+	}, &last
+}
+
+func TestGenerateSummary_BulletsFormat(t *testing.T) {
+	// The model answered with a paragraph anyway
+	ai, last := newSummaryStubAIService(t, "The launch moved to May. Marketing needs new dates! Budget is unchanged.")
+
+	summary, err := ai.generateSummary(context.Background(), "notes", "Launch", "", SummaryStyle{Format: models.SummaryBullets})
+	require.NoError(t, err)
+	assert.Equal(t, "- The launch moved to May.\n- Marketing needs new dates!\n- Budget is unchanged.", summary)
+	assert.Contains(t, last.Messages[0].Content, "Markdown bullet list")
+
+	// Lists in another style are normalized
+	ai, _ = newSummaryStubAIService(t, "Key points:\n* Launch in May\n2. New dates for marketing\n• Same budget")
+	summary, err = ai.generateSummary(context.Background(), "notes", "Launch", "", SummaryStyle{Format: models.SummaryBullets})
+	require.NoError(t, err)
+	assert.Equal(t, "- Launch in May\n- New dates for marketing\n- Same budget", summary)
+
+	// Paragraphs are left alone
+	ai, last = newSummaryStubAIService(t, "The launch moved to May.\n")
+	summary, err = ai.generateSummary(context.Background(), "notes", "Launch", "", SummaryStyle{Format: models.SummaryParagraph})
+	require.NoError(t, err)
+	assert.Equal(t, "The launch moved to May.", summary)
+	assert.Contains(t, last.Messages[0].Content, "single paragraph")
+}
+
+func TestGenerateSummary_LengthSetsTokenBudget(t *testing.T) {
+	ai, last := newSummaryStubAIService(t, "Summary.")
+
+	budgets := map[string]int{}
+	for _, length := range []string{models.SummaryShort, models.SummaryMedium, models.SummaryLong} {
+		_, err := ai.generateSummary(context.Background(), "notes", "Launch", "", SummaryStyle{Length: length})
+		require.NoError(t, err)
+		budgets[length] = last.MaxTokens
+		assert.Contains(t, last.Messages[0].Content, "about ")
+	}
+	assert.Less(t, budgets[models.SummaryShort], budgets[models.SummaryMedium])
+	assert.Less(t, budgets[models.SummaryMedium], budgets[models.SummaryLong])
+
+	// Unset falls back to the server default
+	t.Setenv("AI_SUMMARY_LENGTH", "long")
+	_, err := ai.generateSummary(context.Background(), "notes", "Launch", "", SummaryStyle{})
+	require.NoError(t, err)
+	assert.Equal(t, budgets[models.SummaryLong], last.MaxTokens)
+}
+
+func TestResolveAISettings_SummaryStyle(t *testing.T) {
+	notebook := models.AISettings{SummaryLength: models.SummaryShort, SummaryFormat: models.SummaryBullets}
+	note := models.AISettings{SummaryLength: models.SummaryLong}
+
+	settings := ResolveAISettings(notebook, note)
+	assert.Equal(t, SummaryStyle{Length: models.SummaryLong, Format: models.SummaryBullets}, settings.summaryStyle())
+
+	settings = ResolveAISettings()
+	assert.Equal(t, SummaryStyle{Length: models.SummaryMedium, Format: models.SummaryParagraph}, settings.summaryStyle())
+
+	assert.Error(t, models.AISettings{SummaryFormat: "haiku"}.Validate())
+	assert.Error(t, models.AISettings{SummaryLength: "epic"}.Validate())
+}
@@ -15,6 +15,9 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
+// lockRecheckInterval is how often deferred events check a locked note
+const lockRecheckInterval = 5 * time.Second
+
 // SyncHandlerService handles bidirectional synchronization between blocks and tasks
 type SyncHandlerService struct {
 	db           *database.Database
@@ -47,6 +50,7 @@ func (s *SyncHandlerService) Start(cfg config.Config) {
 
 	messageChan := consumer.GetMessageChannel()
 
+	s.resumeDeferredSyncEvents()
 	go s.processEvents(messageChan)
 	log.Println("Block-Task Sync Handler started successfully")
 }
@@ -109,6 +113,17 @@ func (s *SyncHandlerService) handleSyncEvent(eventType string, data []byte) erro
 		return nil
 	}
 
+	// Task events write to blocks, hold them back while the note is being edited
+	switch eventType {
+	case string(broker.TaskCreated), string(broker.TaskUpdated), string(broker.TaskDeleted):
+		if noteID := s.taskEventNoteID(message.Payload); noteID != uuid.Nil {
+			if until := NoteLockedUntil(s.db.DB, noteID); until != nil {
+				s.deferSyncEvent(eventType, data, noteID, *until)
+				return nil
+			}
+		}
+	}
+
 	switch eventType {
 	case string(broker.BlockCreated):
 		return s.handleBlockCreated(message.Payload)
@@ -127,6 +142,86 @@ func (s *SyncHandlerService) handleSyncEvent(eventType string, data []byte) erro
 	}
 }
 
+// taskEventNoteID resolves the note whose blocks a task event would modify
+func (s *SyncHandlerService) taskEventNoteID(payload map[string]interface{}) uuid.UUID {
+	if noteIDStr, ok := payload["note_id"].(string); ok {
+		if noteID, err := uuid.Parse(noteIDStr); err == nil {
+			return noteID
+		}
+	}
+	if blockIDStr, ok := payload["block_id"].(string); ok && blockIDStr != "" {
+		var block models.Block
+		if err := s.db.DB.Select("note_id").Where("id = ?", blockIDStr).First(&block).Error; err == nil {
+			return block.NoteID
+		}
+	}
+	if taskIDStr, ok := payload["task_id"].(string); ok {
+		var task models.Task
+		if err := s.db.DB.Select("note_id").Where("id = ?", taskIDStr).First(&task).Error; err == nil {
+			return task.NoteID
+		}
+	}
+	return uuid.Nil
+}
+
+// deferSyncEvent replays an event once its note is unlocked. The event is
+// stored until then so a restart doesn't drop it. The lock is rechecked
+// periodically so an early unlock isn't kept waiting for the expiry, and a
+// refreshed lock defers the event further.
+func (s *SyncHandlerService) deferSyncEvent(eventType string, data []byte, noteID uuid.UUID, until time.Time) {
+	log.Printf("Note %s is locked until %s, deferring %s", noteID, until.Format(time.RFC3339), eventType)
+	event := models.DeferredSyncEvent{ID: uuid.New(), NoteID: noteID, EventType: eventType, Data: data}
+	if err := s.db.DB.Create(&event).Error; err != nil {
+		log.Printf("Failed to store deferred sync event %s for note %s: %v", eventType, noteID, err)
+		event.ID = uuid.Nil
+	}
+	s.scheduleDeferredSyncEvent(event, until)
+}
+
+// resumeDeferredSyncEvents schedules the events deferred before the last
+// stop. They are replayed like new deferrals, once their note is unlocked.
+func (s *SyncHandlerService) resumeDeferredSyncEvents() {
+	var events []models.DeferredSyncEvent
+	if err := s.db.DB.Order("created_at ASC").Find(&events).Error; err != nil {
+		log.Printf("Failed to load deferred sync events: %v", err)
+		return
+	}
+	if len(events) > 0 {
+		log.Printf("Resuming %d deferred sync events", len(events))
+	}
+	for _, event := range events {
+		s.scheduleDeferredSyncEvent(event, time.Now())
+	}
+}
+
+// scheduleDeferredSyncEvent replays event after the lock check that follows
+// until. An event that wasn't stored has no ID.
+func (s *SyncHandlerService) scheduleDeferredSyncEvent(event models.DeferredSyncEvent, until time.Time) {
+	delay := time.Until(until) + time.Second
+	if delay > lockRecheckInterval {
+		delay = lockRecheckInterval
+	}
+	time.AfterFunc(delay, func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("SyncHandlerService deferred event panic recovered: %v", r)
+			}
+		}()
+		if until := NoteLockedUntil(s.db.DB, event.NoteID); until != nil {
+			s.scheduleDeferredSyncEvent(event, *until)
+			return
+		}
+		if err := s.handleSyncEvent(event.EventType, event.Data); err != nil {
+			log.Printf("Error handling deferred sync event %s: %v", event.EventType, err)
+		}
+		if event.ID != uuid.Nil {
+			if err := s.db.DB.Delete(&models.DeferredSyncEvent{}, "id = ?", event.ID).Error; err != nil {
+				log.Printf("Failed to remove deferred sync event %s: %v", event.ID, err)
+			}
+		}
+	})
+}
+
 // handleBlockCreated creates a task when a task block is created
 func (s *SyncHandlerService) handleBlockCreated(payload map[string]interface{}) error {
 	blockIDStr, ok := payload["block_id"].(string)
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// TagCount is a tag and the number of the user's notes carrying it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// TagChange reports the notes a rename or merge rewrote
+type TagChange struct {
+	Tag     string      `json:"tag"`
+	Merged  []string    `json:"merged"`
+	NoteIDs []uuid.UUID `json:"note_ids"`
+}
+
+type TagServiceInterface interface {
+	GetTags(db *database.Database, params map[string]interface{}) ([]TagCount, error)
+	RenameTag(db *database.Database, from string, to string, params map[string]interface{}) (TagChange, error)
+	MergeTags(db *database.Database, tags []string, into string, params map[string]interface{}) (TagChange, error)
+}
+
+type TagService struct{}
+
+var TagServiceInstance TagServiceInterface = NewTagService()
+
+func NewTagService() TagServiceInterface {
+	return &TagService{}
+}
+
+// GetTags lists the tags of the user's notes with their note counts, most
+// used first
+func (s *TagService) GetTags(db *database.Database, params map[string]interface{}) ([]TagCount, error) {
+	userID, ok := params["user_id"].(string)
+	if !ok || userID == "" {
+		return nil, errors.New("user_id must be provided in parameters")
+	}
+
+	var tagSets []pq.StringArray
+	if err := db.DB.Model(&models.Note{}).Where("user_id = ?", userID).Pluck("tags", &tagSets).Error; err != nil {
+		return nil, err
+	}
+	return countTags(tagSets), nil
+}
+
+// RenameTag renames a tag on all of the user's notes. Notes that already
+// carry the new name keep it once.
+func (s *TagService) RenameTag(db *database.Database, from string, to string, params map[string]interface{}) (TagChange, error) {
+	return s.MergeTags(db, []string{from}, to, params)
+}
+
+// MergeTags replaces tags with one canonical tag on all of the user's notes,
+// trashed ones included, in a single transaction
+func (s *TagService) MergeTags(db *database.Database, tags []string, into string, params map[string]interface{}) (TagChange, error) {
+	userID, ok := params["user_id"].(string)
+	if !ok || userID == "" {
+		return TagChange{}, errors.New("user_id must be provided in parameters")
+	}
+
+	into = strings.TrimSpace(into)
+	if into == "" {
+		return TagChange{}, fmt.Errorf("%w: the new tag name is required", ErrInvalidInput)
+	}
+	sources := make(map[string]bool)
+	merged := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == into || sources[tag] {
+			continue
+		}
+		sources[tag] = true
+		merged = append(merged, tag)
+	}
+	if len(merged) == 0 {
+		return TagChange{}, fmt.Errorf("%w: at least one tag other than %q is required", ErrInvalidInput, into)
+	}
+
+	change := TagChange{Tag: into, Merged: merged, NoteIDs: []uuid.UUID{}}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return TagChange{}, tx.Error
+	}
+
+	var notes []models.Note
+	if err := tx.Unscoped().Model(&models.Note{}).Select("id", "tags").
+		Where("user_id = ? AND tags && ?", userID, pq.StringArray(merged)).
+		Find(&notes).Error; err != nil {
+		tx.Rollback()
+		return TagChange{}, err
+	}
+
+	for _, note := range notes {
+		if err := tx.Unscoped().Model(&models.Note{}).Where("id = ?", note.ID).
+			UpdateColumn("tags", replaceTags(note.Tags, sources, into)).Error; err != nil {
+			tx.Rollback()
+			return TagChange{}, err
+		}
+		change.NoteIDs = append(change.NoteIDs, note.ID)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return TagChange{}, err
+	}
+	return change, nil
+}
+
+// replaceTags swaps the source tags for into, keeping the first position any
+// of them had and dropping the duplicates this creates
+func replaceTags(tags pq.StringArray, sources map[string]bool, into string) pq.StringArray {
+	replaced := make(pq.StringArray, 0, len(tags))
+	for _, tag := range tags {
+		if sources[tag] {
+			tag = into
+		}
+		replaced = append(replaced, tag)
+	}
+	return mergeTags(replaced)
+}
+
+// countTags counts the notes carrying each tag, most used first
+func countTags(tagSets []pq.StringArray) []TagCount {
+	counts := make(map[string]int)
+	for _, tags := range tagSets {
+		seen := make(map[string]bool)
+		for _, tag := range tags {
+			if tag == "" || seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			counts[tag]++
+		}
+	}
+
+	result := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		result = append(result, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	return result
+}
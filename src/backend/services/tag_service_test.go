@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceTags_UpdatesTagCounts(t *testing.T) {
+	notes := []pq.StringArray{
+		{"ai", "research"},
+		{"AI", "ai"},
+		{"artificial-intelligence"},
+		{"go"},
+	}
+	assert.Equal(t, []TagCount{
+		{Tag: "ai", Count: 2},
+		{Tag: "AI", Count: 1},
+		{Tag: "artificial-intelligence", Count: 1},
+		{Tag: "go", Count: 1},
+		{Tag: "research", Count: 1},
+	}, countTags(notes))
+
+	t.Run("rename", func(t *testing.T) {
+		renamed := make([]pq.StringArray, len(notes))
+		for i, tags := range notes {
+			renamed[i] = replaceTags(tags, map[string]bool{"research": true}, "papers")
+		}
+		assert.Equal(t, pq.StringArray{"ai", "papers"}, renamed[0])
+		assert.Contains(t, countTags(renamed), TagCount{Tag: "papers", Count: 1})
+		assert.NotContains(t, countTags(renamed), TagCount{Tag: "research", Count: 1})
+	})
+
+	t.Run("merge into existing", func(t *testing.T) {
+		merged := make([]pq.StringArray, len(notes))
+		for i, tags := range notes {
+			merged[i] = replaceTags(tags, map[string]bool{"ai": true, "artificial-intelligence": true}, "AI")
+		}
+		assert.Equal(t, pq.StringArray{"AI"}, merged[1], "a note with both tags keeps one")
+		assert.Equal(t, []TagCount{
+			{Tag: "AI", Count: 3},
+			{Tag: "go", Count: 1},
+			{Tag: "research", Count: 1},
+		}, countTags(merged))
+	})
+}
+
+func TestMergeTags_RewritesNotesInOneTransaction(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	first := uuid.New()
+	second := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "id","tags" FROM "notes" WHERE user_id = \$1 AND tags && \$2`).
+		WithArgs(userID.String(), `{"ai","artificial-intelligence"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tags"}).
+			AddRow(first, `{ai,research}`).
+			AddRow(second, `{AI,artificial-intelligence}`))
+	mock.ExpectExec(`UPDATE "notes" SET "tags"=\$1 WHERE id = \$2`).
+		WithArgs(`{"AI","research"}`, first).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "notes" SET "tags"=\$1 WHERE id = \$2`).
+		WithArgs(`{"AI"}`, second).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	change, err := NewTagService().MergeTags(db, []string{"ai", "AI", " artificial-intelligence "}, "AI",
+		map[string]interface{}{"user_id": userID.String()})
+	require.NoError(t, err)
+	assert.Equal(t, "AI", change.Tag)
+	assert.Equal(t, []string{"ai", "artificial-intelligence"}, change.Merged)
+	assert.Equal(t, []uuid.UUID{first, second}, change.NoteIDs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRenameTag_RejectsSameName(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	_, err := NewTagService().RenameTag(db, "ai", "ai", map[string]interface{}{"user_id": uuid.New().String()})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSuggestTagMerges(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	ai, prompt := newStubAIService(t, `[{"into": "AI", "tags": ["ai", "artificial-intelligence"], "reason": "Same topic"}]`)
+	ai.db = db.DB
+	userID := uuid.New()
+
+	mock.ExpectQuery(`SELECT "tags" FROM "notes" WHERE user_id = \$1`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"tags"}).
+			AddRow(`{ai,research}`).
+			AddRow(`{AI,ai}`).
+			AddRow(`{artificial-intelligence}`).
+			AddRow(`{Go}`).
+			AddRow(`{go}`))
+
+	suggestions, err := ai.SuggestTagMerges(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Equal(t, []TagMergeSuggestion{
+		{
+			Into:   "AI",
+			Tags:   []TagCount{{Tag: "ai", Count: 2}, {Tag: "AI", Count: 1}, {Tag: "artificial-intelligence", Count: 1}},
+			Reason: "Same topic",
+		},
+		{
+			Into:   "Go",
+			Tags:   []TagCount{{Tag: "Go", Count: 1}, {Tag: "go", Count: 1}},
+			Reason: "Spelling variants of the same tag",
+		},
+	}, suggestions)
+	assert.Contains(t, *prompt, "- ai (3)", "variants are sent to the model once, with their combined count")
+	assert.NotContains(t, *prompt, "- AI (")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/prompts"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// maxSuggestionTags caps the tag vocabulary sent to the model, most used first
+const maxSuggestionTags = 300
+
+// TagMergeSuggestion proposes merging tags into one of them
+type TagMergeSuggestion struct {
+	Into   string     `json:"into"`
+	Tags   []TagCount `json:"tags"`
+	Reason string     `json:"reason,omitempty"`
+}
+
+// tagMergeAnswer is one group of the model's answer
+type tagMergeAnswer struct {
+	Into   string   `json:"into"`
+	Tags   []string `json:"tags"`
+	Reason string   `json:"reason"`
+}
+
+// SuggestTagMerges groups the user's tags that name the same thing. Tags that
+// differ only in case or punctuation are always grouped; the model clusters
+// the remaining synonyms. Nothing is changed, the groups can be applied with
+// TagService.MergeTags.
+func (ai *AIService) SuggestTagMerges(ctx context.Context, userID uuid.UUID) ([]TagMergeSuggestion, error) {
+	var tagSets []pq.StringArray
+	if err := ai.db.WithContext(ctx).Model(&models.Note{}).Where("user_id = ?", userID).Pluck("tags", &tagSets).Error; err != nil {
+		return nil, fmt.Errorf("failed to load tags: %w", err)
+	}
+
+	// Spelling variants first: each group is known by its most used tag
+	var groups [][]TagCount
+	groupByKey := make(map[string]int)
+	groupByTag := make(map[string]int)
+	for _, count := range countTags(tagSets) {
+		key := tagVariantKey(count.Tag)
+		index, ok := groupByKey[key]
+		if !ok {
+			index = len(groups)
+			groupByKey[key] = index
+			groups = append(groups, nil)
+		}
+		groups[index] = append(groups[index], count)
+		groupByTag[count.Tag] = index
+	}
+
+	// Union of the variant groups the model says are synonyms
+	parent := make([]int, len(groups))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	reasons := make(map[int]string)
+	preferred := make(map[int]string)
+
+	if len(groups) >= 2 {
+		vocabulary := make([]TagCount, 0, len(groups))
+		for _, group := range groups {
+			if len(vocabulary) == maxSuggestionTags {
+				break
+			}
+			vocabulary = append(vocabulary, TagCount{Tag: group[0].Tag, Count: groupCount(group)})
+		}
+
+		answers, err := ai.askTagMerges(ctx, vocabulary)
+		if err != nil {
+			return nil, err
+		}
+		for _, answer := range answers {
+			first := -1
+			for _, tag := range answer.Tags {
+				if index, ok := groupByTag[strings.TrimSpace(tag)]; ok {
+					if first == -1 {
+						first = index
+					} else {
+						parent[find(index)] = find(first)
+					}
+				}
+			}
+		}
+		// Roots are final now, attach the model's choices to them
+		for _, answer := range answers {
+			for _, tag := range answer.Tags {
+				if index, ok := groupByTag[strings.TrimSpace(tag)]; ok {
+					root := find(index)
+					if answer.Reason != "" {
+						reasons[root] = answer.Reason
+					}
+					if into, ok := groupByTag[answer.Into]; ok && find(into) == root {
+						preferred[root] = answer.Into
+					}
+					break
+				}
+			}
+		}
+	}
+
+	// Collect each cluster's tags in the order of the most used group
+	clusters := make(map[int][]TagCount)
+	var order []int
+	for i, group := range groups {
+		root := find(i)
+		if _, ok := clusters[root]; !ok {
+			order = append(order, root)
+		}
+		clusters[root] = append(clusters[root], group...)
+	}
+
+	suggestions := []TagMergeSuggestion{}
+	for _, root := range order {
+		tags := clusters[root]
+		if len(tags) < 2 {
+			continue
+		}
+		into := tags[0].Tag
+		if tag, ok := preferred[root]; ok {
+			into = tag
+		}
+		reason := reasons[root]
+		if reason == "" {
+			reason = "Spelling variants of the same tag"
+		}
+		suggestions = append(suggestions, TagMergeSuggestion{Into: into, Tags: tags, Reason: reason})
+	}
+	return suggestions, nil
+}
+
+// askTagMerges asks the model which of the tags are synonyms
+func (ai *AIService) askTagMerges(ctx context.Context, tags []TagCount) ([]tagMergeAnswer, error) {
+	ctx = withAICallFeature(ctx, prompts.SuggestTagMerges)
+	prompt, err := prompts.Render(prompts.SuggestTagMerges, map[string]interface{}{
+		"Tags": tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := ai.callAnthropic(ctx, prompt, 2000)
+	if err != nil {
+		return nil, err
+	}
+
+	response = strings.TrimSpace(response)
+	response = strings.TrimPrefix(response, "```json")
+	response = strings.TrimPrefix(response, "```")
+	response = strings.TrimSuffix(response, "```")
+
+	var answers []tagMergeAnswer
+	if err := json.Unmarshal([]byte(strings.TrimSpace(response)), &answers); err != nil {
+		return nil, fmt.Errorf("invalid tag merge suggestions: %w", err)
+	}
+	return answers, nil
+}
+
+// tagVariantKey is what spelling variants of a tag have in common: its
+// lowercase letters and digits
+func tagVariantKey(tag string) string {
+	var key strings.Builder
+	for _, r := range strings.ToLower(tag) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			key.WriteRune(r)
+		}
+	}
+	if key.Len() == 0 {
+		return tag
+	}
+	return key.String()
+}
+
+// groupCount adds up the note counts of a group of tags
+func groupCount(group []TagCount) int {
+	total := 0
+	for _, count := range group {
+		total += count.Count
+	}
+	return total
+}
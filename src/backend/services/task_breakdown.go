@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// BreakdownOptions picks what a task breakdown is turned into
+type BreakdownOptions struct {
+	CreateTasks bool      // A task for the goal with a subtask per step
+	CreateNotes bool      // A note per step
+	NotebookID  uuid.UUID // Notebook of the notes, a new notebook for the goal when unset
+}
+
+// BreakdownItems are the notebook, notes and tasks a breakdown was turned into
+type BreakdownItems struct {
+	NotebookID  uuid.UUID   `json:"notebook_id"`
+	NoteID      *uuid.UUID  `json:"note_id,omitempty"`      // Note holding the goal task
+	GoalTaskID  *uuid.UUID  `json:"goal_task_id,omitempty"` // Parent of the step tasks
+	TaskIDs     []uuid.UUID `json:"task_ids,omitempty"`     // A task per step, in step order
+	StepNoteIDs []uuid.UUID `json:"step_note_ids,omitempty"`
+}
+
+// CheckBreakdownNotebook requires the user to be able to add notes to the
+// notebook a breakdown is saved in
+func (ai *AIService) CheckBreakdownNotebook(userID uuid.UUID, opts BreakdownOptions) error {
+	if (!opts.CreateTasks && !opts.CreateNotes) || opts.NotebookID == uuid.Nil {
+		return nil
+	}
+
+	hasAccess, err := RoleServiceInstance.HasAccessByStrings(&database.Database{DB: ai.db}, userID.String(), opts.NotebookID.String(), string(models.NotebookResource), "editor")
+	if err != nil {
+		return err
+	}
+	if !hasAccess {
+		return ErrInsufficientAccess
+	}
+	return nil
+}
+
+// SaveBreakdown turns the steps of a BreakDownTask result into step notes
+// and/or tasks. The tasks are a task for the goal, in a note named after it,
+// and a subtask per step whose metadata holds the goal task's ID as
+// parent_task_id. With step notes, a step's task goes in its step note.
+// Everything is saved in one transaction, so a failure leaves nothing behind.
+func (ai *AIService) SaveBreakdown(ctx context.Context, userID uuid.UUID, goal, description string, breakdown map[string]interface{}, opts BreakdownOptions) (*BreakdownItems, error) {
+	if !opts.CreateTasks && !opts.CreateNotes {
+		return nil, nil
+	}
+	steps := breakdownSteps(breakdown)
+
+	items := &BreakdownItems{NotebookID: opts.NotebookID}
+	err := inOneTransaction(ai.db.WithContext(ctx), func(db *database.Database) error {
+		if items.NotebookID == uuid.Nil {
+			notebook, err := NotebookServiceInstance.CreateNotebook(db, map[string]interface{}{
+				"name":        goal,
+				"description": description,
+				"user_id":     userID.String(),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create breakdown notebook: %w", err)
+			}
+			items.NotebookID = notebook.ID
+		}
+
+		var stepNoteIDs []uuid.UUID
+		if opts.CreateNotes {
+			for i, step := range steps {
+				data := breakdownStepData(goal, description, i, step)
+				note, err := NoteServiceInstance.CreateNote(db, map[string]interface{}{
+					"title":       fmt.Sprintf("Step %d: %s", data.Number, data.Title),
+					"user_id":     userID.String(),
+					"notebook_id": items.NotebookID.String(),
+					"source":      "ai_breakdown",
+				})
+				if err != nil {
+					return fmt.Errorf("failed to create note for step %d: %w", data.Number, err)
+				}
+				stepNoteIDs = append(stepNoteIDs, note.ID)
+
+				blocks, err := buildStepNoteBlocks(DefaultStepNoteTemplate, data, userID, note.ID)
+				if err != nil {
+					log.Printf("Failed to render step note %d of %q: %v", data.Number, goal, err)
+				}
+				for j := range blocks {
+					if err := db.DB.Create(&blocks[j]).Error; err != nil {
+						return fmt.Errorf("failed to add content to step note %d: %w", data.Number, err)
+					}
+				}
+				refreshNotePreview(db.DB, note.ID)
+			}
+			items.StepNoteIDs = stepNoteIDs
+		}
+
+		if opts.CreateTasks {
+			goalNote, err := NoteServiceInstance.CreateNote(db, map[string]interface{}{
+				"title":       goal,
+				"user_id":     userID.String(),
+				"notebook_id": items.NotebookID.String(),
+				"source":      "ai_breakdown",
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create goal note: %w", err)
+			}
+			items.NoteID = &goalNote.ID
+
+			goalTask, err := TaskServiceInstance.CreateTask(db, map[string]interface{}{
+				"user_id":     userID.String(),
+				"note_id":     goalNote.ID.String(),
+				"title":       goal,
+				"description": description,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create goal task: %w", err)
+			}
+			items.GoalTaskID = &goalTask.ID
+
+			for i, step := range steps {
+				data := breakdownStepData(goal, description, i, step)
+				noteID := goalNote.ID
+				if i < len(stepNoteIDs) {
+					noteID = stepNoteIDs[i]
+				}
+				taskData := map[string]interface{}{
+					"user_id":        userID.String(),
+					"note_id":        noteID.String(),
+					"parent_task_id": goalTask.ID.String(),
+					"title":          data.Title,
+					"description":    data.Description,
+				}
+				if data.DueDate != "" {
+					taskData["due_date"] = data.DueDate
+				}
+				task, err := TaskServiceInstance.CreateTask(db, taskData)
+				if err != nil {
+					return fmt.Errorf("failed to create task for step %d: %w", data.Number, err)
+				}
+				items.TaskIDs = append(items.TaskIDs, task.ID)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// breakdownSteps returns the steps of a breakdown, which come as
+// []map[string]interface{} from BreakDownTask and as []interface{} once
+// decoded from JSON
+func breakdownSteps(breakdown map[string]interface{}) []map[string]interface{} {
+	switch steps := breakdown["steps"].(type) {
+	case []map[string]interface{}:
+		return steps
+	case []interface{}:
+		var stepMaps []map[string]interface{}
+		for _, step := range steps {
+			if stepMap, ok := step.(map[string]interface{}); ok {
+				stepMaps = append(stepMaps, stepMap)
+			}
+		}
+		return stepMaps
+	}
+	return nil
+}
+
+// breakdownStepData reads the i-th step for a step note or task
+func breakdownStepData(goal, description string, i int, step map[string]interface{}) StepNoteData {
+	data := StepNoteData{
+		ProjectName:        goal,
+		ProjectDescription: description,
+		Number:             i + 1,
+		Title:              fmt.Sprintf("Step %d", i+1),
+		Step:               step,
+	}
+	if title, ok := step["title"].(string); ok && title != "" {
+		data.Title = title
+	}
+	if desc, ok := step["description"].(string); ok {
+		data.Description = desc
+	}
+	if dueDate, ok := step["due_date"].(string); ok {
+		data.DueDate = dueDate
+	}
+	return data
+}
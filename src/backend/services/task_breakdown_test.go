@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotebookService keeps the notebooks it is asked to create
+type recordingNotebookService struct {
+	NotebookServiceInterface
+	created []map[string]interface{}
+}
+
+func (r *recordingNotebookService) CreateNotebook(db *database.Database, notebookData map[string]interface{}) (models.Notebook, error) {
+	r.created = append(r.created, notebookData)
+	return models.Notebook{ID: uuid.New(), Name: notebookData["name"].(string)}, nil
+}
+
+// recordingNoteService keeps the notes it is asked to create
+type recordingNoteService struct {
+	NoteServiceInterface
+	created []models.Note
+}
+
+func (r *recordingNoteService) CreateNote(db *database.Database, noteData map[string]interface{}) (models.Note, error) {
+	note := models.Note{
+		ID:         uuid.New(),
+		Title:      noteData["title"].(string),
+		NotebookID: uuid.MustParse(noteData["notebook_id"].(string)),
+	}
+	r.created = append(r.created, note)
+	return note, nil
+}
+
+// recordingTaskService keeps the tasks it is asked to create
+type recordingTaskService struct {
+	TaskServiceInterface
+	created []map[string]interface{}
+	ids     []uuid.UUID
+}
+
+func (r *recordingTaskService) CreateTask(db *database.Database, taskData map[string]interface{}) (models.Task, error) {
+	id := uuid.New()
+	r.created = append(r.created, taskData)
+	r.ids = append(r.ids, id)
+	return models.Task{ID: id, Title: taskData["title"].(string)}, nil
+}
+
+func stubBreakdownServices(t *testing.T) (*recordingNotebookService, *recordingNoteService, *recordingTaskService) {
+	notebooks, notes, tasks := &recordingNotebookService{}, &recordingNoteService{}, &recordingTaskService{}
+	originalNotebooks, originalNotes, originalTasks := NotebookServiceInstance, NoteServiceInstance, TaskServiceInstance
+	NotebookServiceInstance, NoteServiceInstance, TaskServiceInstance = notebooks, notes, tasks
+	t.Cleanup(func() {
+		NotebookServiceInstance, NoteServiceInstance, TaskServiceInstance = originalNotebooks, originalNotes, originalTasks
+	})
+	return notebooks, notes, tasks
+}
+
+func threeStepBreakdown() map[string]interface{} {
+	return map[string]interface{}{
+		"goal": "Launch the blog",
+		"steps": []map[string]interface{}{
+			{"step": 1, "title": "Pick a theme", "description": "Choose something readable"},
+			{"step": 2, "title": "Write three posts"},
+			{"step": 3, "title": "Announce it", "due_date": "2025-03-01T09:00:00Z"},
+		},
+	}
+}
+
+func TestSaveBreakdown_CreateTasksLinksStepsToGoalTask(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	notebooks, notes, tasks := stubBreakdownServices(t)
+
+	ai := &AIService{db: db.DB}
+	userID := uuid.New()
+	items, err := ai.SaveBreakdown(context.Background(), userID, "Launch the blog", "A personal blog", threeStepBreakdown(),
+		BreakdownOptions{CreateTasks: true})
+	require.NoError(t, err)
+
+	// Without a notebook_id the breakdown gets a notebook named after the goal
+	require.Len(t, notebooks.created, 1)
+	assert.Equal(t, "Launch the blog", notebooks.created[0]["name"])
+	require.Len(t, notes.created, 1, "only the goal note, no step notes")
+	goalNote := notes.created[0]
+	assert.Equal(t, goalNote.NotebookID, items.NotebookID)
+
+	// A goal task and a subtask per step
+	require.Len(t, tasks.created, 4)
+	require.NotNil(t, items.GoalTaskID)
+	assert.Equal(t, tasks.ids[0], *items.GoalTaskID)
+	assert.Equal(t, "Launch the blog", tasks.created[0]["title"])
+	assert.NotContains(t, tasks.created[0], "parent_task_id")
+	assert.Equal(t, tasks.ids[1:], items.TaskIDs)
+	for i, title := range []string{"Pick a theme", "Write three posts", "Announce it"} {
+		task := tasks.created[i+1]
+		assert.Equal(t, title, task["title"])
+		assert.Equal(t, items.GoalTaskID.String(), task["parent_task_id"])
+		assert.Equal(t, goalNote.ID.String(), task["note_id"])
+		assert.Equal(t, userID.String(), task["user_id"])
+	}
+	assert.Equal(t, "2025-03-01T09:00:00Z", tasks.created[3]["due_date"])
+	assert.Empty(t, items.StepNoteIDs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveBreakdown_StepTasksGoInStepNotes(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	// The step note's content, written in the breakdown's transaction
+	mock.ExpectBegin()
+	for range DefaultStepNoteTemplate {
+		mock.ExpectQuery(`INSERT INTO "blocks"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	}
+	mock.ExpectExec(notePreviewUpdate).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	notebooks, notes, tasks := stubBreakdownServices(t)
+
+	ai := &AIService{db: db.DB}
+	notebookID := uuid.New()
+	breakdown := map[string]interface{}{
+		"steps": []interface{}{map[string]interface{}{"title": "Pick a theme"}},
+	}
+	items, err := ai.SaveBreakdown(context.Background(), uuid.New(), "Launch the blog", "", breakdown,
+		BreakdownOptions{CreateTasks: true, CreateNotes: true, NotebookID: notebookID})
+	require.NoError(t, err)
+
+	assert.Empty(t, notebooks.created, "the chosen notebook is used")
+	assert.Equal(t, notebookID, items.NotebookID)
+	require.Len(t, notes.created, 2)
+	assert.Equal(t, "Step 1: Pick a theme", notes.created[0].Title)
+	assert.Equal(t, []uuid.UUID{notes.created[0].ID}, items.StepNoteIDs)
+	assert.Equal(t, notes.created[1].ID, *items.NoteID)
+
+	require.Len(t, tasks.created, 2)
+	assert.Equal(t, notes.created[1].ID.String(), tasks.created[0]["note_id"])
+	assert.Equal(t, notes.created[0].ID.String(), tasks.created[1]["note_id"])
+	assert.Equal(t, tasks.ids[0].String(), tasks.created[1]["parent_task_id"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// failingTaskService fails the task creations after the first
+type failingTaskService struct {
+	TaskServiceInterface
+	created int
+}
+
+func (f *failingTaskService) CreateTask(db *database.Database, taskData map[string]interface{}) (models.Task, error) {
+	if f.created++; f.created > 1 {
+		return models.Task{}, ErrLimitExceeded
+	}
+	// Services start their own transactions, which are part of the breakdown's
+	tx := db.DB.Begin()
+	if err := tx.Exec(`INSERT INTO tasks DEFAULT VALUES`).Error; err != nil {
+		tx.Rollback()
+		return models.Task{}, err
+	}
+	return models.Task{ID: uuid.New()}, tx.Commit().Error
+}
+
+func TestSaveBreakdown_FailureRollsBackEverything(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	stubBreakdownServices(t)
+	TaskServiceInstance = &failingTaskService{}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO tasks DEFAULT VALUES`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	ai := &AIService{db: db.DB}
+	items, err := ai.SaveBreakdown(context.Background(), uuid.New(), "Launch the blog", "", threeStepBreakdown(),
+		BreakdownOptions{CreateTasks: true, NotebookID: uuid.New()})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	assert.Nil(t, items)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
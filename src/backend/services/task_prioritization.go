@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/prompts"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxPrioritizedTasks caps the open tasks sent to the model, oldest first
+const maxPrioritizedTasks = 100
+
+// TaskPriority is a task's place in a suggested order. Rank 1 is the top
+// priority; it is what ApplyTaskPriorities stores as the task's priority.
+type TaskPriority struct {
+	TaskID    uuid.UUID   `json:"task_id"`
+	Title     string      `json:"title"`
+	DueDate   string      `json:"due_date,omitempty"`
+	NoteID    uuid.UUID   `json:"note_id"`
+	Rank      int         `json:"rank"`
+	Rationale string      `json:"rationale,omitempty"`
+	BlockedBy []uuid.UUID `json:"blocked_by,omitempty"`
+}
+
+// openTask is an open task with the open tasks it waits for
+type openTask struct {
+	models.Task
+	NoteTitle string
+	BlockedBy []uuid.UUID
+}
+
+// taskPriorityAnswer is one task of the model's answer
+type taskPriorityAnswer struct {
+	Task      int    `json:"task"`
+	Rationale string `json:"rationale"`
+}
+
+// PrioritizeTasks asks the model to order the user's open tasks. Nothing is
+// changed; the order can be applied with ApplyTaskPriorities. Whatever the
+// model says, a task comes after the open tasks blocking it.
+func (ai *AIService) PrioritizeTasks(ctx context.Context, userID uuid.UUID) ([]TaskPriority, error) {
+	tasks, err := loadOpenTasks(ai.db.WithContext(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return []TaskPriority{}, nil
+	}
+
+	answers, err := ai.askTaskPriorities(ctx, tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]int, 0, len(tasks))
+	rationales := make(map[int]string, len(tasks))
+	for _, answer := range answers {
+		index := answer.Task - 1
+		if index < 0 || index >= len(tasks) {
+			continue
+		}
+		if _, seen := rationales[index]; seen {
+			continue
+		}
+		rationales[index] = answer.Rationale
+		order = append(order, index)
+	}
+	// Tasks the model left out go last, in the order they were created
+	for index := range tasks {
+		if _, seen := rationales[index]; !seen {
+			order = append(order, index)
+		}
+	}
+
+	return rankTasks(tasks, order, rationales), nil
+}
+
+// ApplyTaskPriorities stores the order of taskIDs, usually a confirmed
+// PrioritizeTasks preview, as the priority of each task: 1 for the first.
+// Blocked tasks are still moved after their blockers.
+func ApplyTaskPriorities(db *database.Database, userID uuid.UUID, taskIDs []uuid.UUID) ([]TaskPriority, error) {
+	if len(taskIDs) == 0 {
+		return nil, fmt.Errorf("%w: task_ids is empty", ErrInvalidInput)
+	}
+	tasks, err := loadOpenTasks(db.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	indexByID := make(map[uuid.UUID]int, len(tasks))
+	for index, task := range tasks {
+		indexByID[task.ID] = index
+	}
+
+	order := make([]int, 0, len(taskIDs))
+	seen := make(map[int]bool, len(taskIDs))
+	for _, taskID := range taskIDs {
+		index, ok := indexByID[taskID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not an open task", ErrInvalidInput, taskID)
+		}
+		if !seen[index] {
+			seen[index] = true
+			order = append(order, index)
+		}
+	}
+	ranking := rankTasks(tasks, order, nil)
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	for _, priority := range ranking {
+		task := tasks[indexByID[priority.TaskID]]
+		metadata := task.Metadata
+		if metadata == nil {
+			metadata = models.TaskMetadata{}
+		}
+		metadata["priority"] = priority.Rank
+		if err := tx.Model(&models.Task{}).Where("id = ?", task.ID).Update("metadata", metadata).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to save task priority: %w", err)
+		}
+
+		event, err := models.NewEvent(string(broker.TaskUpdated), "task", map[string]interface{}{
+			"task_id":      task.ID.String(),
+			"user_id":      task.UserID.String(),
+			"note_id":      task.NoteID.String(),
+			"block_id":     metadata["block_id"],
+			"title":        task.Title,
+			"is_completed": task.IsCompleted,
+			"priority":     priority.Rank,
+		})
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := tx.Create(event).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return ranking, nil
+}
+
+// loadOpenTasks loads the user's open tasks, oldest first, with the titles
+// of their notes and the open tasks blocking each. A task is blocked by the
+// tasks listed in its depends_on metadata and by its open subtasks.
+func loadOpenTasks(db *gorm.DB, userID uuid.UUID) ([]openTask, error) {
+	var tasks []models.Task
+	if err := db.Scopes(models.NotTrashed).
+		Select("id", "user_id", "note_id", "title", "description", "is_completed", "due_date", "metadata", "created_at").
+		Where("user_id = ? AND is_completed = ?", userID, false).
+		Order("created_at ASC").Limit(maxPrioritizedTasks).Find(&tasks).Error; err != nil {
+		return nil, fmt.Errorf("failed to load open tasks: %w", err)
+	}
+	if len(tasks) == 0 {
+		return nil, nil
+	}
+
+	noteIDs := make([]uuid.UUID, 0, len(tasks))
+	open := make(map[uuid.UUID]bool, len(tasks))
+	for _, task := range tasks {
+		noteIDs = append(noteIDs, task.NoteID)
+		open[task.ID] = true
+	}
+	var notes []models.Note
+	if err := db.Select("id", "title").Where("id IN ?", noteIDs).Find(&notes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load task notes: %w", err)
+	}
+	noteTitles := make(map[uuid.UUID]string, len(notes))
+	for _, note := range notes {
+		noteTitles[note.ID] = note.Title
+	}
+
+	blockedBy := make(map[uuid.UUID][]uuid.UUID)
+	for _, task := range tasks {
+		for _, dependency := range taskDependencies(task.Metadata) {
+			if open[dependency] && dependency != task.ID {
+				blockedBy[task.ID] = append(blockedBy[task.ID], dependency)
+			}
+		}
+		parentIDStr, _ := task.Metadata["parent_task_id"].(string)
+		if parentID, err := uuid.Parse(parentIDStr); err == nil && open[parentID] {
+			blockedBy[parentID] = append(blockedBy[parentID], task.ID)
+		}
+	}
+
+	result := make([]openTask, 0, len(tasks))
+	for _, task := range tasks {
+		result = append(result, openTask{Task: task, NoteTitle: noteTitles[task.NoteID], BlockedBy: blockedBy[task.ID]})
+	}
+	return result, nil
+}
+
+// taskDependencies reads the depends_on metadata of a task, one task ID or
+// a list of them
+func taskDependencies(metadata models.TaskMetadata) []uuid.UUID {
+	var values []interface{}
+	switch dependsOn := metadata["depends_on"].(type) {
+	case string:
+		values = []interface{}{dependsOn}
+	case []interface{}:
+		values = dependsOn
+	}
+
+	var dependencies []uuid.UUID
+	for _, value := range values {
+		if id, ok := value.(string); ok {
+			if parsed, err := uuid.Parse(id); err == nil {
+				dependencies = append(dependencies, parsed)
+			}
+		}
+	}
+	return dependencies
+}
+
+// rankTasks ranks tasks in order, a list of their indexes, moving each task
+// after the tasks blocking it. Tasks not in order are left out. When tasks
+// block each other in a cycle, the first of them in order goes first.
+func rankTasks(tasks []openTask, order []int, rationales map[int]string) []TaskPriority {
+	indexByID := make(map[uuid.UUID]int, len(tasks))
+	for index, task := range tasks {
+		indexByID[task.ID] = index
+	}
+	inOrder := make(map[int]bool, len(order))
+	for _, index := range order {
+		inOrder[index] = true
+	}
+	ranked := make(map[int]bool, len(order))
+	ready := func(index int) bool {
+		for _, blocker := range tasks[index].BlockedBy {
+			if blockerIndex, ok := indexByID[blocker]; ok && inOrder[blockerIndex] && !ranked[blockerIndex] {
+				return false
+			}
+		}
+		return true
+	}
+
+	ranking := make([]TaskPriority, 0, len(order))
+	remaining := append([]int(nil), order...)
+	for len(remaining) > 0 {
+		next := 0
+		for i, index := range remaining {
+			if ready(index) {
+				next = i
+				break
+			}
+		}
+		index := remaining[next]
+		remaining = append(remaining[:next], remaining[next+1:]...)
+		ranked[index] = true
+
+		task := tasks[index]
+		ranking = append(ranking, TaskPriority{
+			TaskID:    task.ID,
+			Title:     task.Title,
+			DueDate:   task.DueDate,
+			NoteID:    task.NoteID,
+			Rank:      len(ranking) + 1,
+			Rationale: rationales[index],
+			BlockedBy: task.BlockedBy,
+		})
+	}
+	return ranking
+}
+
+func (ai *AIService) askTaskPriorities(ctx context.Context, tasks []openTask) ([]taskPriorityAnswer, error) {
+	numbers := make(map[uuid.UUID]int, len(tasks))
+	for index, task := range tasks {
+		numbers[task.ID] = index + 1
+	}
+	promptTasks := make([]map[string]interface{}, 0, len(tasks))
+	for index, task := range tasks {
+		blockedBy := make([]int, 0, len(task.BlockedBy))
+		for _, blocker := range task.BlockedBy {
+			blockedBy = append(blockedBy, numbers[blocker])
+		}
+		promptTasks = append(promptTasks, map[string]interface{}{
+			"Number":      index + 1,
+			"Title":       task.Title,
+			"Description": strings.TrimSpace(task.Description),
+			"DueDate":     task.DueDate,
+			"Note":        task.NoteTitle,
+			"BlockedBy":   blockedBy,
+		})
+	}
+
+	ctx = withAICallFeature(ctx, prompts.PrioritizeTasks)
+	prompt, err := prompts.Render(prompts.PrioritizeTasks, map[string]interface{}{
+		"Today": time.Now().Format("2006-01-02"),
+		"Tasks": promptTasks,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := ai.callAnthropic(ctx, prompt, 3000)
+	if err != nil {
+		return nil, err
+	}
+
+	response = strings.TrimSpace(response)
+	response = strings.TrimPrefix(response, "```json")
+	response = strings.TrimPrefix(response, "```")
+	response = strings.TrimSuffix(response, "```")
+
+	var answers []taskPriorityAnswer
+	if err := json.Unmarshal([]byte(strings.TrimSpace(response)), &answers); err != nil {
+		return nil, fmt.Errorf("invalid task priorities: %w", err)
+	}
+	return answers, nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// taskPriorityMetadata matches task metadata holding priority
+type taskPriorityMetadata int
+
+func (priority taskPriorityMetadata) Match(value driver.Value) bool {
+	raw, ok := value.([]byte)
+	if !ok {
+		return false
+	}
+	var metadata map[string]interface{}
+	if err := json.Unmarshal(raw, &metadata); err != nil {
+		return false
+	}
+	return metadata["priority"] == float64(priority)
+}
+
+func TestPrioritizeTasks_PreviewThenApply(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	// The model puts the report first, though it waits for the data export
+	ai, prompt := newStubAIService(t, `[
+		{"task": 1, "rationale": "Due first"},
+		{"task": 2, "rationale": "Quick win"},
+		{"task": 3, "rationale": "Unblocks the report"}
+	]`)
+	ai.db = db.DB
+
+	userID, noteID := uuid.New(), uuid.New()
+	report, email, export := uuid.New(), uuid.New(), uuid.New()
+	expectOpenTasks := func() {
+		created := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(`SELECT "id","user_id","note_id","title","description","is_completed","due_date","metadata","created_at" FROM "tasks" `+
+			`WHERE \(user_id = \$1 AND is_completed = \$2\) AND "tasks"."deleted_at" IS NULL ORDER BY created_at ASC LIMIT \$3`).
+			WithArgs(userID, false, maxPrioritizedTasks).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "note_id", "title", "due_date", "metadata", "created_at"}).
+				AddRow(report, userID, noteID, "Write the quarterly report", "2025-03-07", []byte(`{"depends_on": ["`+export.String()+`"]}`), created).
+				AddRow(email, userID, noteID, "Answer Sam", "", []byte(`{}`), created.Add(time.Hour)).
+				AddRow(export, userID, noteID, "Export the sales data", "", []byte(`{}`), created.Add(2*time.Hour)))
+		mock.ExpectQuery(`SELECT "id","title" FROM "notes" WHERE id IN \(\$1,\$2,\$3\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(noteID, "Q1 planning"))
+	}
+
+	expectOpenTasks()
+	preview, err := ai.PrioritizeTasks(context.Background(), userID)
+	require.NoError(t, err)
+	require.Len(t, preview, 3)
+	assert.Contains(t, *prompt, "1. Write the quarterly report (due 2025-03-07) [note: Q1 planning]")
+	assert.Contains(t, *prompt, "Blocked until these are done: 3")
+
+	// The blocked report moves after the export
+	assert.Equal(t, []uuid.UUID{email, export, report}, []uuid.UUID{preview[0].TaskID, preview[1].TaskID, preview[2].TaskID})
+	assert.Equal(t, "Quick win", preview[0].Rationale)
+	assert.Equal(t, []uuid.UUID{export}, preview[2].BlockedBy)
+	assert.Equal(t, 3, preview[2].Rank)
+	assert.NoError(t, mock.ExpectationsWereMet(), "the preview changes nothing")
+
+	// Confirming the preview stores each rank as the task's priority
+	expectOpenTasks()
+	mock.ExpectBegin()
+	for rank, taskID := range []uuid.UUID{email, export, report} {
+		mock.ExpectExec(`UPDATE "tasks" SET "metadata"=\$1,"updated_at"=\$2 WHERE id = \$3`).
+			WithArgs(taskPriorityMetadata(rank+1), sqlmock.AnyArg(), taskID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`INSERT INTO "events"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	}
+	mock.ExpectCommit()
+
+	ids := []uuid.UUID{preview[0].TaskID, preview[1].TaskID, preview[2].TaskID}
+	applied, err := ApplyTaskPriorities(db, userID, ids)
+	require.NoError(t, err)
+	require.Len(t, applied, 3)
+	assert.Equal(t, report, applied[2].TaskID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyTaskPriorities_KeepsBlockedTasksAfterTheirBlockers(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID, parent, subtask := uuid.New(), uuid.New(), uuid.New()
+	mock.ExpectQuery(`SELECT .* FROM "tasks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "note_id", "title", "metadata"}).
+			AddRow(parent, userID, uuid.New(), "Launch", []byte(`{}`)).
+			AddRow(subtask, userID, uuid.New(), "Write the announcement", []byte(`{"parent_task_id": "`+parent.String()+`"}`)))
+	mock.ExpectQuery(`SELECT "id","title" FROM "notes"`).WillReturnRows(sqlmock.NewRows([]string{"id", "title"}))
+	mock.ExpectBegin()
+	for _, taskID := range []driver.Value{subtask, parent} {
+		mock.ExpectExec(`UPDATE "tasks"`).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), taskID).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`INSERT INTO "events"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	}
+	mock.ExpectCommit()
+
+	// A goal task waits for its open subtasks
+	applied, err := ApplyTaskPriorities(db, userID, []uuid.UUID{parent, subtask})
+	require.NoError(t, err)
+	assert.Equal(t, subtask, applied[0].TaskID)
+	assert.Equal(t, parent, applied[1].TaskID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyTaskPriorities_RejectsUnknownTasks(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	mock.ExpectQuery(`SELECT .* FROM "tasks"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err := ApplyTaskPriorities(db, uuid.New(), []uuid.UUID{uuid.New()})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
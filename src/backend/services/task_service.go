@@ -19,7 +19,9 @@ type TaskServiceInterface interface {
 	UpdateTask(db *database.Database, id string, updatedData models.Task) (models.Task, error)
 	DeleteTask(db *database.Database, id string) error
 	GetAllTasks(db *database.Database) ([]models.Task, error)
+	// GetTasks lists tasks matching params; limit and offset load one page
 	GetTasks(db *database.Database, params map[string]interface{}) ([]models.Task, error)
+	CountTasks(db *database.Database, params map[string]interface{}) (int64, error)
 }
 
 type TaskService struct{}
@@ -79,8 +81,18 @@ func (s *TaskService) CreateTask(db *database.Database, taskData map[string]inte
 		task.Metadata["note_id"] = noteIDStr
 	}
 
+	// Subtasks keep the ID of their parent task in metadata
+	if parentIDStr, ok := taskData["parent_task_id"].(string); ok && parentIDStr != "" {
+		if _, err := uuid.Parse(parentIDStr); err != nil {
+			tx.Rollback()
+			return models.Task{}, errors.New("invalid parent_task_id format")
+		}
+		task.Metadata["parent_task_id"] = parentIDStr
+	}
+
 	// Handle block association
 	blockIDProvided := false
+	createdBlockNoteID := uuid.Nil
 	if blockIDStr, ok := taskData["block_id"].(string); ok && blockIDStr != "" {
 		blockID, err := uuid.Parse(blockIDStr)
 		if err == nil && blockID != uuid.Nil {
@@ -134,6 +146,7 @@ func (s *TaskService) CreateTask(db *database.Database, taskData map[string]inte
 
 		// Now set the block_id on the task
 		task.Metadata["block_id"] = block.ID.String()
+		createdBlockNoteID = noteID
 
 		// Create event for block creation
 		blockEvent, err := models.NewEvent(
@@ -189,6 +202,7 @@ func (s *TaskService) CreateTask(db *database.Database, taskData map[string]inte
 	// Create event for task creation
 	eventPayload := map[string]interface{}{
 		"task_id":      task.ID.String(),
+		"user_id":      task.UserID.String(),
 		"title":        task.Title,
 		"is_completed": task.IsCompleted,
 	}
@@ -223,6 +237,8 @@ func (s *TaskService) CreateTask(db *database.Database, taskData map[string]inte
 		return models.Task{}, err
 	}
 
+	refreshNotePreview(db.DB, createdBlockNoteID)
+
 	return task, nil
 }
 
@@ -261,6 +277,7 @@ func (s *TaskService) UpdateTask(db *database.Database, id string, updatedData m
 	eventPayload := map[string]interface{}{
 		"task_id":      task.ID.String(),
 		"user_id":      task.UserID.String(),
+		"note_id":      task.NoteID.String(),
 		"block_id":     task.Metadata["block_id"],
 		"title":        task.Title,
 		"is_completed": task.IsCompleted,
@@ -315,6 +332,8 @@ func (s *TaskService) DeleteTask(db *database.Database, id string) error {
 	eventData := map[string]interface{}{
 		"task_id":  task.ID.String(),
 		"user_id":  task.UserID.String(),
+		"note_id":  task.NoteID.String(),
+		"title":    task.Title,
 		"block_id": task.Metadata["block_id"],
 	}
 
@@ -367,6 +386,31 @@ func (s *TaskService) GetAllTasks(db *database.Database) ([]models.Task, error)
 
 func (s *TaskService) GetTasks(db *database.Database, params map[string]interface{}) ([]models.Task, error) {
 	var tasks []models.Task
+	query := pagedList(taskListQuery(db, params), params, "created_at ASC, id ASC")
+
+	// Only load the requested columns
+	if fields, ok := params["fields"].([]string); ok && len(fields) > 0 {
+		query = query.Select(fields)
+	}
+
+	result := query.Find(&tasks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return tasks, nil
+}
+
+// CountTasks counts the tasks GetTasks lists for params, ignoring the page
+func (s *TaskService) CountTasks(db *database.Database, params map[string]interface{}) (int64, error) {
+	var count int64
+	if err := taskListQuery(db, params).Model(&models.Task{}).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// taskListQuery filters tasks by the list params
+func taskListQuery(db *database.Database, params map[string]interface{}) *gorm.DB {
 	query := db.DB
 
 	// Apply filters based on params
@@ -387,13 +431,7 @@ func (s *TaskService) GetTasks(db *database.Database, params map[string]interfac
 		query = query.Where("note_id = ?", noteID)
 	}
 
-	query = query.Where("deleted_at IS NULL")
-
-	result := query.Find(&tasks)
-	if result.Error != nil {
-		return nil, result.Error
-	}
-	return tasks, nil
+	return query.Where("deleted_at IS NULL")
 }
 
 // NewTaskService creates a new instance of TaskService
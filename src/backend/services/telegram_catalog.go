@@ -0,0 +1,599 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// TelegramLanguagePreference is the user preference holding the language of
+// the Telegram bot's replies, as an ISO 639-1 code. When unset the bot
+// answers in the AI language preference, then in English.
+const TelegramLanguagePreference = "telegram_language"
+
+// defaultTelegramLanguage is the language of the built-in catalog
+const defaultTelegramLanguage = "en"
+
+// TelegramMessageID names a bot reply in the message catalogs
+type TelegramMessageID string
+
+// TelegramCatalog holds the reply templates of one language by message ID.
+// Templates are Telegram Markdown with {name} placeholders, turned into
+// MarkdownV2 when rendered; a placeholder outside the arguments is kept as
+// written.
+type TelegramCatalog map[TelegramMessageID]string
+
+// TelegramArgs are the values filled into a template's placeholders. Strings
+// and other values are escaped for where they land in the MarkdownV2;
+// telegramMarkup values are inserted as they are.
+type TelegramArgs map[string]interface{}
+
+// telegramMarkup is text already formatted for Telegram, such as another
+// rendered message
+type telegramMarkup string
+
+// TelegramCatalogs are the reply catalogs by language. A message missing from
+// a language is answered from the English catalog; catalogs can be added or
+// replaced at startup.
+var TelegramCatalogs = map[string]TelegramCatalog{defaultTelegramLanguage: englishTelegramMessages}
+
+type telegramLanguageKey struct{}
+
+// withTelegramLanguage returns a context whose replies are in language
+func withTelegramLanguage(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, telegramLanguageKey{}, language)
+}
+
+// telegramLanguage returns the reply language set by withTelegramLanguage
+func telegramLanguage(ctx context.Context) string {
+	if language, _ := ctx.Value(telegramLanguageKey{}).(string); language != "" {
+		return language
+	}
+	return defaultTelegramLanguage
+}
+
+// telegramText renders the message in the context's language
+func telegramText(ctx context.Context, id TelegramMessageID, args TelegramArgs) string {
+	template, ok := TelegramCatalogs[telegramLanguage(ctx)][id]
+	if !ok {
+		template, ok = englishTelegramMessages[id]
+	}
+	if !ok {
+		log.Printf("Telegram message %s is missing from the catalog", id)
+		return string(id)
+	}
+	return renderTelegramTemplate(template, args)
+}
+
+// userLanguage reads the user's reply language preference
+func (ts *TelegramService) userLanguage(ctx context.Context, userID uuid.UUID) string {
+	var language string
+	err := ts.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ?", userID).
+		Select("COALESCE(NULLIF(preferences->>?, ''), preferences->>?, '')", TelegramLanguagePreference, AILanguagePreference).
+		Row().Scan(&language)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to read Telegram language of user %s: %v", userID, err)
+	}
+	return strings.ToLower(strings.TrimSpace(language))
+}
+
+// telegramParseMode is the parse mode of the bot's replies. MarkdownV2 takes
+// a backslash before any special character, in and out of entities, so every
+// value can be escaped the same way.
+const telegramParseMode = "MarkdownV2"
+
+// telegramMarkdownSpecial are the characters MarkdownV2 reads as markup
+const telegramMarkdownSpecial = "_*[]()~`>#+-=|{}.!\\"
+
+// renderTelegramTemplate turns a template into MarkdownV2 and fills its
+// placeholders. Templates mark bold, italic and code with *, _ and backticks
+// and escape any other use of those with a backslash; the rest of their text
+// and every value are escaped for the entity they are in.
+func renderTelegramTemplate(template string, args TelegramArgs) string {
+	var b strings.Builder
+	entity := ""
+	for i := 0; i < len(template); {
+		rest := template[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1:
+			b.WriteString(rest[:2])
+			i += 2
+			continue
+		case strings.HasPrefix(rest, telegramCodeFence) && (entity == "" || entity == telegramCodeFence):
+			entity = toggleTelegramEntity(entity, telegramCodeFence)
+			b.WriteString(telegramCodeFence)
+			i += len(telegramCodeFence)
+			continue
+		case strings.ContainsRune("*_`", rune(rest[0])) && (entity == "" || entity == rest[:1]):
+			entity = toggleTelegramEntity(entity, rest[:1])
+		case rest[0] == '{':
+			if end := strings.IndexByte(rest, '}'); end > 0 {
+				if value, ok := args[rest[1:end]]; ok {
+					b.WriteString(telegramArg(value, entity))
+					i += end + 1
+					continue
+				}
+			}
+			fallthrough
+		default:
+			if !telegramInCode(entity) && strings.IndexByte(telegramMarkdownSpecial, rest[0]) >= 0 {
+				b.WriteByte('\\')
+			}
+		}
+		b.WriteByte(rest[0])
+		i++
+	}
+	return b.String()
+}
+
+func toggleTelegramEntity(entity, marker string) string {
+	if entity == marker {
+		return ""
+	}
+	return marker
+}
+
+func telegramInCode(entity string) bool {
+	return entity == "`" || entity == telegramCodeFence
+}
+
+// telegramArg formats a placeholder value for the entity it is in
+func telegramArg(value interface{}, entity string) string {
+	var text string
+	switch v := value.(type) {
+	case telegramMarkup:
+		return string(v)
+	case string:
+		text = v
+	default:
+		text = fmt.Sprint(v)
+	}
+
+	if telegramInCode(entity) {
+		return escapeTelegramCode(text)
+	}
+	return escapeTelegramMarkdown(text)
+}
+
+// escapeTelegramMarkdown escapes text for MarkdownV2 outside of code
+func escapeTelegramMarkdown(text string) string {
+	return telegramMarkdownEscaper.Replace(text)
+}
+
+// escapeTelegramCode escapes text for a MarkdownV2 code span or block
+func escapeTelegramCode(text string) string {
+	return telegramCodeEscaper.Replace(text)
+}
+
+var (
+	telegramMarkdownEscaper = newTelegramEscaper(telegramMarkdownSpecial)
+	telegramCodeEscaper     = newTelegramEscaper("`\\")
+)
+
+// newTelegramEscaper puts a backslash before each of the characters
+func newTelegramEscaper(characters string) *strings.Replacer {
+	pairs := make([]string, 0, 2*len(characters))
+	for _, c := range characters {
+		pairs = append(pairs, string(c), `\`+string(c))
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// Bot replies
+const (
+	msgBusy          TelegramMessageID = "busy"
+	msgUnknownUser   TelegramMessageID = "unknown_user"
+	msgNotUnderstood TelegramMessageID = "not_understood"
+	msgLimitReached  TelegramMessageID = "limit_reached"
+	msgListItem      TelegramMessageID = "list_item"
+	msgAndMore       TelegramMessageID = "and_more"
+
+	msgCalendarNotConnected  TelegramMessageID = "calendar_not_connected"
+	msgCalendarEventFailed   TelegramMessageID = "calendar_event_failed"
+	msgCalendarEventRetry    TelegramMessageID = "calendar_event_retry"
+	msgCalendarEventDay      TelegramMessageID = "calendar_event_day"
+	msgCalendarEventTime     TelegramMessageID = "calendar_event_time"
+	msgCalendarEventLocation TelegramMessageID = "calendar_event_location"
+	msgCalendarEventCreated  TelegramMessageID = "calendar_event_created"
+	msgCalendarSaveFailed    TelegramMessageID = "calendar_save_failed"
+	msgCalendarSavedAsTask   TelegramMessageID = "calendar_saved_as_task"
+
+	msgTaskFailed  TelegramMessageID = "task_failed"
+	msgTaskCreated TelegramMessageID = "task_created"
+
+	msgProjectBreakdownFailed TelegramMessageID = "project_breakdown_failed"
+	msgProjectFailed          TelegramMessageID = "project_failed"
+	msgProjectCreated         TelegramMessageID = "project_created"
+	msgProjectPlaceholder     TelegramMessageID = "project_created_placeholder"
+	msgProjectNotebook        TelegramMessageID = "project_notebook"
+
+	msgNoteFailed       TelegramMessageID = "note_failed"
+	msgNoteCreated      TelegramMessageID = "note_created"
+	msgNoteCreatedNoAI  TelegramMessageID = "note_created_without_ai"
+	msgLinkNotPublic    TelegramMessageID = "link_not_public"
+	msgLinkFailed       TelegramMessageID = "link_failed"
+	msgLinkSaved        TelegramMessageID = "link_saved"
+	msgLinkSavedDetails TelegramMessageID = "link_saved_with_description"
+
+	msgInvalidCommand TelegramMessageID = "invalid_command"
+	msgUnknownCommand TelegramMessageID = "unknown_command"
+	msgStart          TelegramMessageID = "start"
+	msgHelp           TelegramMessageID = "help"
+
+	msgChains          TelegramMessageID = "chains"
+	msgChainEntry      TelegramMessageID = "chain_entry"
+	msgRunUsage        TelegramMessageID = "run_usage"
+	msgRunFailed       TelegramMessageID = "run_failed"
+	msgRunStarted      TelegramMessageID = "run_started"
+	msgTemplateUsage   TelegramMessageID = "template_usage"
+	msgTemplateCreated TelegramMessageID = "template_instantiated"
+	msgTemplateUnknown TelegramMessageID = "template_unknown"
+
+	msgStatusUsage          TelegramMessageID = "status_usage"
+	msgExecutionNotFound    TelegramMessageID = "execution_not_found"
+	msgExecutionRunning     TelegramMessageID = "execution_running"
+	msgExecutionCompleted   TelegramMessageID = "execution_completed"
+	msgExecutionFailed      TelegramMessageID = "execution_failed"
+	msgExecutionTimeout     TelegramMessageID = "execution_timeout"
+	msgExecutionOther       TelegramMessageID = "execution_other"
+	msgExecutionStatus      TelegramMessageID = "execution_status"
+	msgExecutionDuration    TelegramMessageID = "execution_duration"
+	msgExecutionErrors      TelegramMessageID = "execution_errors"
+	msgExecutionError       TelegramMessageID = "execution_error"
+	msgExecutionProgress    TelegramMessageID = "execution_progress"
+	msgExecutionStep        TelegramMessageID = "execution_step"
+	msgExecutionResultsLink TelegramMessageID = "execution_results_ready"
+	msgStoredResults        TelegramMessageID = "stored_results"
+	msgStoredFinished       TelegramMessageID = "stored_finished"
+	msgStoredSteps          TelegramMessageID = "stored_steps"
+	msgStoredStep           TelegramMessageID = "stored_step"
+	msgStoredResultsHeader  TelegramMessageID = "stored_results_header"
+	msgStoredResult         TelegramMessageID = "stored_result"
+
+	msgDegradedSearch      TelegramMessageID = "degraded_search"
+	msgSearchUsage         TelegramMessageID = "search_usage"
+	msgSearchFailed        TelegramMessageID = "search_failed"
+	msgSearchNoResults     TelegramMessageID = "search_no_results"
+	msgSearchResults       TelegramMessageID = "search_results"
+	msgSearchResult        TelegramMessageID = "search_result"
+	msgSearchResultPreview TelegramMessageID = "search_result_preview"
+	msgSearchResultDate    TelegramMessageID = "search_result_date"
+	msgSearchFound         TelegramMessageID = "search_found"
+	msgKnowledgeUsage      TelegramMessageID = "knowledge_usage"
+	msgKnowledgeFailed     TelegramMessageID = "knowledge_failed"
+	msgKnowledgeNone       TelegramMessageID = "knowledge_none"
+	msgKnowledgeNoAnswer   TelegramMessageID = "knowledge_answer_failed"
+	msgKnowledgeAnswer     TelegramMessageID = "knowledge_answer"
+	msgRelatedUsage        TelegramMessageID = "related_usage"
+	msgRelatedFailed       TelegramMessageID = "related_failed"
+	msgRelatedNone         TelegramMessageID = "related_none"
+	msgRelatedHeader       TelegramMessageID = "related_header"
+
+	msgTodayFailed       TelegramMessageID = "today_failed"
+	msgTodayHeader       TelegramMessageID = "today_header"
+	msgTodayTasks        TelegramMessageID = "today_tasks"
+	msgTodayPending      TelegramMessageID = "today_pending"
+	msgTodayEvents       TelegramMessageID = "today_events"
+	msgTodayAllDay       TelegramMessageID = "today_all_day"
+	msgTodayEvent        TelegramMessageID = "today_event"
+	msgTodayReminders    TelegramMessageID = "today_reminders"
+	msgTodayNotes        TelegramMessageID = "today_notes"
+	msgTodayWhatsNew     TelegramMessageID = "today_whats_new"
+	msgTodayNotebook     TelegramMessageID = "today_notebook"
+	msgTodayMoreNotebook TelegramMessageID = "today_more_notebooks"
+	msgTodayActions      TelegramMessageID = "today_quick_actions"
+
+	msgRecentHeader TelegramMessageID = "recent_header"
+	msgRecentNotes  TelegramMessageID = "recent_notes"
+	msgRecentNote   TelegramMessageID = "recent_note"
+	msgRecentTasks  TelegramMessageID = "recent_tasks"
+	msgRecentTask   TelegramMessageID = "recent_task"
+
+	msgStatsWeek       TelegramMessageID = "stats_week"
+	msgStatsMonth      TelegramMessageID = "stats_month"
+	msgStatsHeader     TelegramMessageID = "stats_header"
+	msgStatsNotes      TelegramMessageID = "stats_notes"
+	msgStatsTasks      TelegramMessageID = "stats_tasks"
+	msgStatsCompletion TelegramMessageID = "stats_completion"
+	msgStatsEvents     TelegramMessageID = "stats_events"
+	msgStatsAverages   TelegramMessageID = "stats_averages"
+	msgStatsInsights   TelegramMessageID = "stats_insights"
+	msgInsightBalanced TelegramMessageID = "insight_balanced"
+	msgInsightNotes    TelegramMessageID = "insight_notes"
+	msgInsightTasks    TelegramMessageID = "insight_tasks"
+
+	msgExportUsage       TelegramMessageID = "export_usage"
+	msgExportBadPage     TelegramMessageID = "export_page_invalid"
+	msgExportUnknownType TelegramMessageID = "export_unknown_type"
+	msgExportFailed      TelegramMessageID = "export_failed"
+	msgExportPastEnd     TelegramMessageID = "export_past_end"
+	msgExportComplete    TelegramMessageID = "export_complete"
+	msgExportNextPage    TelegramMessageID = "export_next_page"
+	msgChatExportUsage   TelegramMessageID = "chat_export_usage"
+	msgChatExportMissing TelegramMessageID = "chat_export_not_found"
+	msgChatExport        TelegramMessageID = "chat_export"
+
+	msgSyncUsage           TelegramMessageID = "sync_usage"
+	msgSyncStarted         TelegramMessageID = "sync_started"
+	msgSyncNoCalendar      TelegramMessageID = "sync_calendar_unavailable"
+	msgSyncCalendarFailed  TelegramMessageID = "sync_calendar_failed"
+	msgSyncCalendars       TelegramMessageID = "sync_calendars"
+	msgSyncSynced          TelegramMessageID = "sync_synced"
+	msgSyncFailed          TelegramMessageID = "sync_failed"
+	msgSyncNothing         TelegramMessageID = "sync_nothing"
+	msgSyncUnknownService  TelegramMessageID = "sync_unknown_service"
+	msgCalendarSyncError   TelegramMessageID = "calendar_sync_error"
+	msgCalendarSyncedOne   TelegramMessageID = "calendar_synced_one"
+	msgCalendarSyncedCount TelegramMessageID = "calendar_synced"
+	msgBackupCreated       TelegramMessageID = "backup_created"
+)
+
+// englishTelegramMessages is the default catalog
+var englishTelegramMessages = TelegramCatalog{
+	msgBusy:          "⏳ I'm still working on your previous messages, please send this again in a moment.",
+	msgUnknownUser:   "Sorry, I couldn't identify your user account. Please contact an administrator.",
+	msgNotUnderstood: "Sorry, I had trouble understanding your message. Please try again.",
+	msgLimitReached:  "🚫 You've reached the limit of {limit} {resource}. Delete some to make room.",
+	msgListItem:      "• {item}\n",
+	msgAndMore:       "  ... and {count} more\n",
+
+	msgCalendarNotConnected: "📅 Calendar event detected, but you haven't connected your Google Calendar yet.\n\n" +
+		"Use `/api/v1/calendar/oauth/authorize` to connect your calendar, then try again.\n\n" +
+		"For now, I'll save this as a task:\n\n{fallback}",
+	msgCalendarEventFailed: "❌ Sorry, I couldn't create your calendar event. {error}\n\n" +
+		"Falling back to task creation:\n\n{fallback}",
+	msgCalendarEventRetry:    "❌ Sorry, I couldn't create your calendar event. Please try again.",
+	msgCalendarEventDay:      "📅 {date}",
+	msgCalendarEventTime:     "📅 {date} at {time}",
+	msgCalendarEventLocation: "\n📍 {location}",
+	msgCalendarEventCreated: "📅 Calendar event created successfully!\n\n" +
+		"*{title}*\n{when}\n\n" +
+		"✅ Added to your Google Calendar\n" +
+		"🔗 Event ID: {event_id}",
+	msgCalendarSaveFailed:  "❌ Sorry, I couldn't save your calendar event. Please try again.",
+	msgCalendarSavedAsTask: "📅 Calendar event saved as task: \"{title}\"\n📝 Note ID: {note_id}\n\n⚠️ Connect your Google Calendar for full calendar integration!",
+
+	msgTaskFailed:  "❌ Sorry, I couldn't create your task. Please try again.",
+	msgTaskCreated: "✅ Task created: \"{title}\"\n📝 Note ID: {note_id}",
+
+	msgProjectBreakdownFailed: "❌ Sorry, I couldn't break down your project. Please try again.",
+	msgProjectFailed:          "❌ Sorry, I couldn't create your project. Please try again.",
+	msgProjectCreated:         "🚀 Project created: \"{name}\"\n📊 Broken down into {steps} steps",
+	msgProjectPlaceholder:     "🚀 Project created: \"{name}\"\n⚠️ {ai_unavailable} A single placeholder step was added.",
+	msgProjectNotebook:        "\n📓 Notebook ID: {notebook_id}",
+
+	msgNoteFailed:       "❌ Sorry, I couldn't create your note. Please try again.",
+	msgNoteCreated:      "📝 Note created: \"{title}\"\n🤖 AI processing started for enhanced insights\n📝 Note ID: {note_id}",
+	msgNoteCreatedNoAI:  "📝 Note created: \"{title}\"\n⚠️ {ai_unavailable} The note was saved without AI enhancement.\n📝 Note ID: {note_id}",
+	msgLinkNotPublic:    "❌ I can only save links to public web pages.",
+	msgLinkFailed:       "❌ Sorry, I couldn't save your link. Please try again.",
+	msgLinkSaved:        "🔗 Bookmark saved: \"{title}\"\n📝 Note ID: {note_id}",
+	msgLinkSavedDetails: "🔗 Bookmark saved: \"{title}\"\n{description}\n📝 Note ID: {note_id}",
+
+	msgInvalidCommand: "❌ Invalid command format",
+	msgUnknownCommand: "❌ Unknown command: {command}\n\nType /help to see available commands.",
+	msgStart: `🦉 *Welcome to Owlistic AI Bot!*
+
+I can help you with:
+• 📝 Create notes and tasks
+• 📅 Schedule calendar events
+• 🤖 Run AI agent chains
+• 📊 Execute workflow templates
+
+Type /help to see all available commands.`,
+	msgHelp: `🤖 *Owlistic AI Bot Commands*
+
+*Basic Commands:*
+• /start - Show welcome message
+• /help - Show this help
+
+*AI Agent Chains:*
+• /chains - List available chains
+• /run <chain\_id> <input> - Execute a chain
+• /template <template\_id> - Use a template
+• /status <execution\_id> - Check execution status
+
+*Smart Search:*
+• /search <query> - Search your notes & content
+• /knowledge <question> - Ask your knowledge base
+• /related <topic> - Find related content
+
+*Dashboard:*
+• /today - Today's overview & agenda
+• /recent [count] - Show recent activity
+• /stats [week|month] - Productivity statistics
+
+*Export & Sync:*
+• /export <type> [timeframe] [page] - Export content
+• /export chat <session> - Export a chat transcript
+• /sync <service> - Force synchronization
+• /backup - Create data backup
+
+*Natural Language:*
+Just type naturally and I'll:
+• Create calendar events
+• Add tasks
+• Take notes
+• Start projects
+• Bookmark a link you send on its own
+
+*Examples:*
+• "Schedule meeting tomorrow at 2pm"
+• /search "machine learning notes"
+• /today
+• /export notes week`,
+
+	msgChains: "🤖 *Available AI Agent Chains:*\n\n{chains}" +
+		"*Templates:*\n" +
+		"`/template research-template` - Research Pipeline\n" +
+		"`/template writing-template` - Writing Assistant\n" +
+		"`/template learning-template` - Learning Path\n" +
+		"`/template project-planning` - Project Planning\n",
+	msgChainEntry: "*{name}*\n`/run {id} <your input>`\n{description}\n\n",
+	msgRunUsage:   "❌ Usage: `/run <chain_id> <input>`\n\nExample: `/run research-and-summarize machine learning trends`\n\nType /chains to see available chains.",
+	msgRunFailed:  "❌ Failed to execute chain '{chain}': {error}",
+	msgRunStarted: "🚀 *Chain Execution Started*\n\n" +
+		"Chain: {chain}\n" +
+		"Execution ID: `{execution_id}`\n" +
+		"Input: {input}\n\n" +
+		"Use `/status {execution_id}` to check progress.\n\n" +
+		"I'll update you when it's complete!",
+	msgTemplateUsage: "❌ Usage: `/template <template_id> [parameters]`\n\n" +
+		"Available templates:\n" +
+		"• research-template\n" +
+		"• writing-template\n" +
+		"• learning-template\n" +
+		"• project-planning\n\n" +
+		"Example: `/template research-template topic=\"AI trends\" depth=\"deep\"`",
+	msgTemplateCreated: "✅ *Template Instantiated*\n\n" +
+		"Template: {template}\n" +
+		"Chain ID: `{chain_id}`\n" +
+		"Parameters: {parameters}\n\n" +
+		"Use `/run {chain_id} <input>` to execute this chain.",
+	msgTemplateUnknown: "❌ Unknown template: {template}",
+	"template_research-template": "📝 *Research Pipeline Template*\n\n" +
+		"Usage: `/template research-template topic=\"your topic\" depth=\"shallow|medium|deep\"`\n\n" +
+		"Example: `/template research-template topic=\"AI in healthcare\" depth=\"deep\"`",
+	"template_writing-template": "✍️ *Writing Assistant Template*\n\n" +
+		"Usage: `/template writing-template topic=\"your topic\" style=\"formal|casual|technical\" length=\"word count\"`\n\n" +
+		"Example: `/template writing-template topic=\"blockchain basics\" style=\"casual\" length=\"1000\"`",
+	"template_learning-template": "🎓 *Learning Path Template*\n\n" +
+		"Usage: `/template learning-template subject=\"subject\" level=\"beginner|intermediate|advanced\" timeframe=\"duration\"`\n\n" +
+		"Example: `/template learning-template subject=\"Python programming\" level=\"beginner\" timeframe=\"3 months\"`",
+	"template_project-planning": "📋 *Project Planning Template*\n\n" +
+		"Usage: `/template project-planning project_name=\"name\" goals=\"objectives\" constraints=\"limitations\"`\n\n" +
+		"Example: `/template project-planning project_name=\"Mobile App\" goals=\"Create iOS app\" constraints=\"3 month timeline\"`",
+
+	msgStatusUsage:        "❌ Usage: `/status <execution_id>`\n\nExample: `/status abc123-def456`",
+	msgExecutionNotFound:  "❌ Execution not found: {execution_id}",
+	msgExecutionRunning:   "🔄 Running",
+	msgExecutionCompleted: "✅ Completed",
+	msgExecutionFailed:    "❌ Failed",
+	msgExecutionTimeout:   "⏰ Timeout",
+	msgExecutionOther:     "❓ {status}",
+	msgExecutionStatus: "📊 *Execution Status*\n\n" +
+		"ID: `{id}`\n" +
+		"Chain: {chain}\n" +
+		"Status: {status}\n" +
+		"Started: {started}\n",
+	msgExecutionDuration:    "Duration: {duration}\n",
+	msgExecutionErrors:      "\n❌ Errors ({count}):\n",
+	msgExecutionError:       "• {agent}: {error}\n",
+	msgExecutionProgress:    "\n📋 Progress ({count} steps):\n",
+	msgExecutionStep:        "• {status} {agent} ({seconds}s)\n",
+	msgExecutionResultsLink: "\n🎯 *Results available!* Run `/status {id}` again to see them.",
+	msgStoredResults: "📊 *Execution Results*\n\n" +
+		"Chain: `{chain}`\n" +
+		"Status: {status}\n",
+	msgStoredFinished:      "Finished: {finished}\n",
+	msgStoredSteps:         "\n📋 Steps ({count}):\n",
+	msgStoredStep:          "• {name}: {status}\n",
+	msgStoredResultsHeader: "\n🎯 *Results:*\n",
+	msgStoredResult:        "\n*{key}*\n{value}\n",
+
+	msgDegradedSearch:      "⚠️ Semantic search is unavailable right now, showing keyword matches.",
+	msgSearchUsage:         "❌ Usage: `/search <query>`\n\nExample: `/search machine learning notes`",
+	msgSearchFailed:        "❌ Search failed: {error}",
+	msgSearchNoResults:     "🔍 No results found for: *{query}*\n\nTry different keywords or check if you have notes created.",
+	msgSearchResults:       "🔍 *Search Results for:* {query}\n\n",
+	msgSearchResult:        "{number}. *{title}*\n",
+	msgSearchResultPreview: "   {preview}\n",
+	msgSearchResultDate:    "   📅 {date}\n\n",
+	msgSearchFound:         "Found {count} result(s). Use the web interface to view full content.",
+	msgKnowledgeUsage:      "❌ Usage: `/knowledge <question>`\n\nExample: `/knowledge how do I deploy with docker?`",
+	msgKnowledgeFailed:     "❌ Knowledge search failed: {error}",
+	msgKnowledgeNone:       "🤔 No relevant knowledge found for: *{question}*\n\nTry creating some notes first, then ask again!",
+	msgKnowledgeNoAnswer:   "❌ Failed to generate answer: {error}",
+	msgKnowledgeAnswer:     "🧠 *Knowledge Base Answer*\n\n*Question:* {question}\n\n*Answer:* {answer}\n\n_Based on {count} of your notes_",
+	msgRelatedUsage:        "❌ Usage: `/related <topic>`\n\nExample: `/related project planning`",
+	msgRelatedFailed:       "❌ Related search failed: {error}",
+	msgRelatedNone:         "🔗 No related content found for: *{topic}*",
+	msgRelatedHeader:       "🔗 *Related to:* {topic}\n\n",
+
+	msgTodayFailed:       "❌ Failed to load today's overview. Please try again.",
+	msgTodayHeader:       "📅 *Today's Overview - {date}*\n\n",
+	msgTodayTasks:        "✅ *Tasks:* {pending} pending, {completed} completed\n",
+	msgTodayPending:      "📋 Pending tasks:\n",
+	msgTodayEvents:       "📅 *Calendar:* {count} events today\n",
+	msgTodayAllDay:       "All day",
+	msgTodayEvent:        "• {time} - {title}\n",
+	msgTodayReminders:    "🔔 {count} reminders today\n",
+	msgTodayNotes:        "📝 *Today's Notes:* {count} created\n",
+	msgTodayWhatsNew:     "📚 *What's New:*\n",
+	msgTodayNotebook:     "• {name} - {count} changed notes\n",
+	msgTodayMoreNotebook: "  ... and {count} more notebooks\n",
+	msgTodayActions: "💡 *Quick Actions:*\n" +
+		"• Type a message to create a note\n" +
+		"• `/recent` - See recent activity\n" +
+		"• `/stats` - View productivity stats",
+
+	msgRecentHeader: "📋 *Recent Activity (last {count} items)*\n\n",
+	msgRecentNotes:  "📝 *Recent Notes:*\n",
+	msgRecentNote:   "• {note} ({age} ago)\n",
+	msgRecentTasks:  "✅ *Recent Tasks:*\n",
+	msgRecentTask:   "• {status} {title} ({age} ago)\n",
+
+	msgStatsWeek:       "Past 7 days",
+	msgStatsMonth:      "Past 30 days",
+	msgStatsHeader:     "📊 *Productivity Stats - {period}*\n\n",
+	msgStatsNotes:      "📝 *Notes Created:* {count}\n",
+	msgStatsTasks:      "✅ *Tasks Completed:* {count}",
+	msgStatsCompletion: " ({rate}% completion rate)",
+	msgStatsEvents:     "📅 *Calendar Events:* {count}\n",
+	msgStatsAverages:   "\n📈 *Daily Averages:*\n• {notes} notes per day\n• {tasks} tasks completed per day\n",
+	msgStatsInsights:   "\n💡 *Insights:*\n",
+	msgInsightBalanced: "• Great balance of note-taking and task completion! 🎯\n",
+	msgInsightNotes:    "• Lots of notes created! Consider converting ideas to actionable tasks 📋\n",
+	msgInsightTasks:    "• High task completion rate! Consider documenting your learnings 📝\n",
+
+	msgExportUsage: "❌ Usage: `/export <type> [timeframe] [page]`\n\n" +
+		"Types: notes, tasks, all\n" +
+		"Timeframe: today, week, month, all\n\n" +
+		"Example: `/export notes week 2`\n" +
+		"Chat transcript: `/export chat <session>`",
+	msgExportBadPage:     "❌ Page must be a positive number",
+	msgExportUnknownType: "❌ Unknown export type. Use: notes, tasks, or all",
+	msgExportFailed:      "❌ Export failed: {error}",
+	msgExportPastEnd:     "❌ Page {page} is past the end of the export, which has {pages} page(s)",
+	msgExportComplete: "📦 *Export Complete*\n\n" +
+		"Type: {type}\n" +
+		"Timeframe: {timeframe}\n" +
+		"Page: {page} of {pages}\n\n" +
+		"```\n{content}\n```",
+	msgExportNextPage:    "\n\nNext page: `/export {type} {timeframe} {next}`",
+	msgChatExportUsage:   "❌ Usage: `/export chat <session>`",
+	msgChatExportMissing: "❌ No chat session `{session}` found",
+	msgChatExport: "📦 *Chat Export*\n\n" +
+		"Session: {session}\n" +
+		"Messages: {count}\n\n" +
+		"```\n{transcript}\n```",
+
+	msgSyncUsage: "❌ Usage: `/sync <service>`\n\n" +
+		"Services: calendar, all\n\n" +
+		"Example: `/sync calendar`",
+	msgSyncStarted:         "🔄 *Sync Started - {service}*\n\n",
+	msgSyncNoCalendar:      "❌ Calendar service not available",
+	msgSyncCalendarFailed:  "❌ Calendar sync failed: {error}",
+	msgSyncCalendars:       "\n*Calendars:*\n",
+	msgSyncSynced:          "✅ Synced: {services}\n",
+	msgSyncFailed:          "❌ Failed: {services}\n",
+	msgSyncNothing:         "ℹ️ No external services configured for sync",
+	msgSyncUnknownService:  "❌ Unknown service: {service}\nAvailable: calendar, all",
+	msgCalendarSyncError:   "❌ {calendar}: {error}\n",
+	msgCalendarSyncedOne:   "✅ {calendar}: {count} event\n",
+	msgCalendarSyncedCount: "✅ {calendar}: {count} events\n",
+	msgBackupCreated: "💾 *Backup Created*\n\n" +
+		"Timestamp: {timestamp}\n" +
+		"Notes: {notes}\n" +
+		"Tasks: {tasks}\n\n" +
+		"✅ Your data has been backed up successfully!\n\n" +
+		"📧 Backup file would be available for download or sent via email.",
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// assertTelegramMarkdown fails unless text is valid MarkdownV2: every
+// special character is escaped or opens and closes an entity
+func assertTelegramMarkdown(t *testing.T, text string) {
+	t.Helper()
+	var bold, italic bool
+	code := ""
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\':
+			if !assert.Less(t, i+1, len(text), "trailing backslash in %q", text) {
+				return
+			}
+			i++
+		case code != "":
+			if strings.HasPrefix(text[i:], code) {
+				i += len(code) - 1
+				code = ""
+			} else if !assert.NotEqual(t, byte('`'), c, "unescaped backtick in code of %q", text) {
+				return
+			}
+		case strings.HasPrefix(text[i:], telegramCodeFence):
+			code = telegramCodeFence
+			i += len(telegramCodeFence) - 1
+		case c == '`':
+			code = "`"
+		case c == '*':
+			bold = !bold
+		case c == '_':
+			italic = !italic
+		case strings.IndexByte(telegramMarkdownSpecial, c) >= 0:
+			assert.Failf(t, "unescaped character", "%q at %d of %q", c, i, text)
+			return
+		}
+	}
+	assert.False(t, bold || italic || code != "", "unclosed entity in %q", text)
+}
+
+// telegramSpecialTitles are titles holding each MarkdownV2 special character
+func telegramSpecialTitles() map[string]string {
+	titles := make(map[string]string)
+	for _, c := range telegramMarkdownSpecial {
+		titles[string(c)] = "a" + string(c) + "b"
+	}
+	return titles
+}
+
+func TestHandleRecentCommand_EscapesUserTitles(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	now := time.Now()
+	mock.ExpectQuery(`SELECT "id",.*,"updated_at" FROM "notes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "updated_at"}).
+			AddRow(uuid.New().String(), userID.String(), "my_draft_notes", now))
+	mock.ExpectQuery(`SELECT "id",.*,"updated_at" FROM "tasks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "updated_at"}).
+			AddRow(uuid.New().String(), userID.String(), "fix *all* the `bugs`", now))
+
+	ts := &TelegramService{db: db.DB}
+	response := ts.handleRecentCommand(context.Background(), userID, nil)
+
+	assert.Contains(t, response, `my\_draft\_notes`)
+	assert.Contains(t, response, "fix \\*all\\* the \\`bugs\\`")
+	assert.Contains(t, response, "*Recent Notes:*")
+	assertTelegramMarkdown(t, response)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRenderTelegramTemplate_EscapesForEntity(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		value    interface{}
+		want     string
+	}{
+		{"plain text", `Title: {v}`, "a_b*c`d[e", "Title: a\\_b\\*c\\`d\\[e"},
+		{"bold", `*{v}*`, "2*2_4", `*2\*2\_4*`},
+		{"italic", `_{v}_`, "snake_case", `_snake\_case_`},
+		{"code", "`{v}`", "a`b_c\\", "`a\\`b_c\\\\`"},
+		{"pre", "```\n{v}\n```", "x```y_z", "```\nx\\`\\`\\`y_z\n```"},
+		{"template text", `Done. (ok) {v}!`, "", `Done\. \(ok\) \!`},
+		{"escaped template", `\_{v}`, "a_b", `\_a\_b`},
+		{"markup", `{v}!`, telegramMarkup("*bold*"), `*bold*\!`},
+		{"number", `{v} notes`, -1.5, `\-1\.5 notes`},
+		{"unknown placeholder", `{other}`, "x", `\{other\}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderTelegramTemplate(tt.template, TelegramArgs{"v": tt.value})
+			assert.Equal(t, tt.want, got)
+			assertTelegramMarkdown(t, got)
+		})
+	}
+}
+
+func TestTelegramCatalog_EnglishRendersValidMarkdown(t *testing.T) {
+	hostile := "a_b*c`d[e```f.g!h\\"
+	for id, template := range englishTelegramMessages {
+		args := TelegramArgs{}
+		for _, part := range strings.Split(template, "{")[1:] {
+			if end := strings.IndexByte(part, '}'); end > 0 {
+				args[part[:end]] = hostile
+			}
+		}
+		t.Run(string(id), func(t *testing.T) {
+			assertTelegramMarkdown(t, renderTelegramTemplate(template, args))
+		})
+	}
+}
+
+func TestTelegramReplies_EscapeEverySpecialCharacter(t *testing.T) {
+	defer func(delay time.Duration) { searchRetryDelay = delay }(searchRetryDelay)
+	searchRetryDelay = 0
+	chroma := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer chroma.Close()
+
+	userID := uuid.New()
+	noteRows := func(title string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "user_id", "title", "updated_at"}).AddRow(uuid.New(), userID, title, time.Now())
+	}
+	replies := map[string]func(ts *TelegramService, mock sqlmock.Sqlmock, title string) string{
+		"task": func(ts *TelegramService, mock sqlmock.Sqlmock, title string) string {
+			mock.ExpectQuery(`SELECT \* FROM "notebooks"`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name"}).AddRow(uuid.New(), userID, "📱 Telegram Messages"))
+			mock.ExpectBegin()
+			mock.ExpectQuery(`INSERT INTO "notes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			mock.ExpectCommit()
+			mock.ExpectBegin()
+			mock.ExpectQuery(`INSERT INTO "tasks"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			mock.ExpectCommit()
+			return ts.handleTask(context.Background(), userID, title, &MessageIntent{Type: "task", ExtractedData: map[string]interface{}{"title": title}})
+		},
+		"note": func(ts *TelegramService, mock sqlmock.Sqlmock, title string) string {
+			mock.ExpectQuery(`SELECT \* FROM "notebooks"`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name"}).AddRow(uuid.New(), userID, "📱 Telegram Messages"))
+			mock.ExpectBegin()
+			mock.ExpectQuery(`INSERT INTO "notes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			mock.ExpectCommit()
+			mock.ExpectBegin()
+			mock.ExpectQuery(`INSERT INTO "blocks"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			mock.ExpectCommit()
+			mock.ExpectExec(notePreviewUpdate).WillReturnResult(sqlmock.NewResult(0, 1))
+			return ts.handleNote(context.Background(), userID, title, &MessageIntent{Type: "note"})
+		},
+		"search": func(ts *TelegramService, mock sqlmock.Sqlmock, title string) string {
+			mock.ExpectQuery(`SELECT \* FROM "notes"`).WillReturnRows(noteRows(title))
+			return ts.handleSearchCommand(context.Background(), userID, []string{title})
+		},
+		"related": func(ts *TelegramService, mock sqlmock.Sqlmock, title string) string {
+			mock.ExpectQuery(`SELECT \* FROM "notes"`).WillReturnRows(noteRows(title))
+			return ts.handleRelatedCommand(context.Background(), userID, []string{title})
+		},
+		"recent": func(ts *TelegramService, mock sqlmock.Sqlmock, title string) string {
+			mock.ExpectQuery(`FROM "notes"`).WillReturnRows(noteRows(title))
+			mock.ExpectQuery(`FROM "tasks"`).WillReturnRows(noteRows(title))
+			return ts.handleRecentCommand(context.Background(), userID, nil)
+		},
+		"results": func(ts *TelegramService, mock sqlmock.Sqlmock, title string) string {
+			return formatStoredExecutionResults(context.Background(), &ChainExecutionResults{
+				ChainID: title,
+				Status:  "completed",
+				Steps:   []models.AIAgentStep{{Name: title, Status: "completed"}},
+				Results: models.AIMetadata{title: title},
+			})
+		},
+	}
+
+	for command, reply := range replies {
+		for c, title := range telegramSpecialTitles() {
+			t.Run(command+" "+c, func(t *testing.T) {
+				db, mock, close := testutils.SetupMockDB()
+				defer close()
+				ts := &TelegramService{db: db.DB, aiService: &AIService{db: db.DB, chromaService: NewChromaService(chroma.URL, nil)}}
+
+				response := reply(ts, mock, title)
+				assert.Contains(t, response, "a\\"+c+"b")
+				assertTelegramMarkdown(t, response)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			})
+		}
+	}
+}
+
+func TestTelegramText_FallsBackToEnglish(t *testing.T) {
+	TelegramCatalogs["fr"] = TelegramCatalog{msgTaskCreated: "✅ Tâche créée : \"{title}\""}
+	defer delete(TelegramCatalogs, "fr")
+
+	ctx := withTelegramLanguage(context.Background(), "fr")
+	assert.Equal(t, `✅ Tâche créée : "Courses"`, telegramText(ctx, msgTaskCreated, TelegramArgs{"title": "Courses"}))
+	assert.Equal(t, renderTelegramTemplate(englishTelegramMessages[msgTaskFailed], nil), telegramText(ctx, msgTaskFailed, nil))
+	assert.Equal(t, renderTelegramTemplate(englishTelegramMessages[msgTaskFailed], nil), telegramText(withTelegramLanguage(context.Background(), "de"), msgTaskFailed, nil))
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	// telegramMaxMessageLength is Telegram's limit for a single message, in
+	// UTF-16 code units as Telegram counts them
+	telegramMaxMessageLength = 4096
+	// telegramMessageChunkSize leaves room for the code fences a split may add
+	telegramMessageChunkSize = 4000
+	telegramCodeFence        = "```"
+)
+
+// TelegramLimits caps how much a single bot command returns and how much
+// work inbound messages start
+type TelegramLimits struct {
+	RecentMax      int // Largest item count accepted by /recent
+	ExportPageSize int // Notes or tasks per /export page
+
+	ClassifyConcurrency int           // Intent classifications running at once
+	ChatInFlight        int           // Messages of a chat handled at once, more are turned away
+	ClassifyInterval    time.Duration // Spacing of a chat's classifications, 0 disables
+}
+
+// DefaultTelegramLimits returns the limits used when none are configured
+func DefaultTelegramLimits() TelegramLimits {
+	return TelegramLimits{
+		RecentMax:           50,
+		ExportPageSize:      100,
+		ClassifyConcurrency: 2,
+		ChatInFlight:        5,
+		ClassifyInterval:    500 * time.Millisecond,
+	}
+}
+
+// telegramLimitsFromEnv applies TELEGRAM_RECENT_MAX, TELEGRAM_EXPORT_PAGE_SIZE,
+// TELEGRAM_MAX_CONCURRENT_CLASSIFICATIONS, TELEGRAM_CHAT_MAX_IN_FLIGHT and
+// TELEGRAM_CLASSIFY_INTERVAL to the defaults
+func telegramLimitsFromEnv() TelegramLimits {
+	limits := DefaultTelegramLimits()
+	if n, err := strconv.Atoi(os.Getenv("TELEGRAM_RECENT_MAX")); err == nil && n > 0 {
+		limits.RecentMax = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("TELEGRAM_EXPORT_PAGE_SIZE")); err == nil && n > 0 {
+		limits.ExportPageSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("TELEGRAM_MAX_CONCURRENT_CLASSIFICATIONS")); err == nil && n > 0 {
+		limits.ClassifyConcurrency = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("TELEGRAM_CHAT_MAX_IN_FLIGHT")); err == nil && n > 0 {
+		limits.ChatInFlight = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("TELEGRAM_CLASSIFY_INTERVAL")); err == nil && d >= 0 {
+		limits.ClassifyInterval = d
+	}
+	return limits
+}
+
+// withDefaults fills unset limits, e.g. on services built without the constructor
+func (l TelegramLimits) withDefaults() TelegramLimits {
+	defaults := DefaultTelegramLimits()
+	if l.RecentMax <= 0 {
+		l.RecentMax = defaults.RecentMax
+	}
+	if l.ExportPageSize <= 0 {
+		l.ExportPageSize = defaults.ExportPageSize
+	}
+	if l.ClassifyConcurrency <= 0 {
+		l.ClassifyConcurrency = defaults.ClassifyConcurrency
+	}
+	if l.ChatInFlight <= 0 {
+		l.ChatInFlight = defaults.ChatInFlight
+	}
+	return l
+}
+
+// splitTelegramMessage cuts text into chunks of at most maxLen UTF-16 code
+// units, so characters outside the Basic Multilingual Plane count twice.
+// Cuts prefer paragraph breaks, then line breaks, then spaces, and a code
+// block that spans a cut is closed and reopened so each chunk stays valid
+// Markdown on its own.
+func splitTelegramMessage(text string, maxLen int) []string {
+	if telegramLength(text) <= maxLen {
+		return []string{text}
+	}
+
+	// Reserve room for closing and reopening a code fence
+	budget := maxLen - 2*(len(telegramCodeFence)+1)
+	var chunks []string
+	inCode := false
+	rest := text
+	for rest != "" {
+		prefix := ""
+		if inCode {
+			prefix = telegramCodeFence + "\n"
+		}
+		if telegramLength(rest)+len(prefix) <= maxLen {
+			chunks = append(chunks, prefix+rest)
+			break
+		}
+
+		cut := telegramCutPoint(rest, budget)
+		chunk := strings.TrimRight(rest[:cut], " \n")
+		rest = strings.TrimLeft(rest[cut:], " \n")
+
+		if strings.Count(chunk, telegramCodeFence)%2 == 1 {
+			inCode = !inCode
+		}
+		if inCode {
+			chunk += "\n" + telegramCodeFence
+		}
+		if chunk = prefix + chunk; strings.TrimSpace(chunk) != "" {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
+
+// telegramLength is the length of text as Telegram measures it
+func telegramLength(text string) int {
+	length := 0
+	for _, r := range text {
+		length += utf16.RuneLen(r)
+	}
+	return length
+}
+
+// telegramCutPoint returns the byte offset to cut text at so the first part
+// has at most budget UTF-16 code units
+func telegramCutPoint(text string, budget int) int {
+	limit := len(text)
+	count := 0
+	for i, r := range text {
+		if count+utf16.RuneLen(r) > budget {
+			limit = i
+			break
+		}
+		count += utf16.RuneLen(r)
+	}
+
+	window := text[:limit]
+	for _, sep := range []string{"\n\n", "\n", " "} {
+		// Ignore separators so early that the chunk would be mostly empty
+		if i := strings.LastIndex(window, sep); i > len(window)/2 {
+			return i + len(sep)
+		}
+	}
+	return limit
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRecordingBot returns a bot backed by a fake Bot API that records the
+// text of every message sent
+func newRecordingBot(t *testing.T) (*tgbotapi.BotAPI, func() []string) {
+	var mu sync.Mutex
+	var sent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		text := r.PostForm.Get("text")
+		mu.Lock()
+		sent = append(sent, text)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if utf8.RuneCountInString(text) > telegramMaxMessageLength {
+			fmt.Fprint(w, `{"ok":false,"error_code":400,"description":"Bad Request: message is too long"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	bot := &tgbotapi.BotAPI{Token: "token", Client: server.Client()}
+	bot.SetAPIEndpoint(server.URL + "/bot%s/%s")
+	return bot, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), sent...)
+	}
+}
+
+func TestSendMessage_SplitsLongReplies(t *testing.T) {
+	bot, sent := newRecordingBot(t)
+	ts := &TelegramService{bot: bot, allowedChatID: 1}
+
+	var reply strings.Builder
+	for i := 0; reply.Len() < 10000; i++ {
+		fmt.Fprintf(&reply, "• line %04d of a long reply\n", i)
+	}
+	require.GreaterOrEqual(t, reply.Len(), 10000)
+
+	ts.sendMessage(reply.String())
+
+	messages := sent()
+	require.Greater(t, len(messages), 2)
+	for _, message := range messages {
+		assert.LessOrEqual(t, utf8.RuneCountInString(message), telegramMaxMessageLength)
+		assert.True(t, strings.HasSuffix(strings.TrimSpace(message), "reply"), "chunks end on a line boundary")
+	}
+	assert.Equal(t, strings.TrimSpace(reply.String()), strings.TrimSpace(strings.Join(messages, "\n")))
+}
+
+func TestSendNotification_SplitsLongMessages(t *testing.T) {
+	bot, sent := newRecordingBot(t)
+	ts := &TelegramService{bot: bot, allowedChatID: 1}
+
+	require.NoError(t, ts.SendNotification(strings.Repeat("word ", 2000)))
+	assert.Len(t, sent(), 3)
+}
+
+func TestSplitTelegramMessage(t *testing.T) {
+	t.Run("short text is kept", func(t *testing.T) {
+		assert.Equal(t, []string{"hello"}, splitTelegramMessage("hello", 100))
+	})
+
+	t.Run("code blocks are closed and reopened", func(t *testing.T) {
+		text := "Preview:\n```\n" + strings.Repeat("a line of code\n", 40) + "```\ndone"
+		chunks := splitTelegramMessage(text, 100)
+		require.Greater(t, len(chunks), 1)
+		for _, chunk := range chunks {
+			assert.LessOrEqual(t, telegramLength(chunk), 100)
+			assert.Equal(t, 0, strings.Count(chunk, telegramCodeFence)%2, "unbalanced fences in %q", chunk)
+		}
+		assert.True(t, strings.HasPrefix(chunks[1], "```\n"))
+	})
+
+	t.Run("text without separators is cut on rune boundaries", func(t *testing.T) {
+		chunks := splitTelegramMessage(strings.Repeat("ü", 250), 100)
+		require.Len(t, chunks, 3)
+		for _, chunk := range chunks {
+			assert.True(t, utf8.ValidString(chunk))
+		}
+		assert.Equal(t, strings.Repeat("ü", 250), strings.Join(chunks, ""))
+	})
+
+	t.Run("characters are counted in UTF-16 code units", func(t *testing.T) {
+		// Each emoji is two UTF-16 code units, so 60 of them exceed 100
+		text := strings.Repeat("😀", 60)
+		chunks := splitTelegramMessage(text, 100)
+		require.Len(t, chunks, 2)
+		for _, chunk := range chunks {
+			assert.LessOrEqual(t, len(utf16.Encode([]rune(chunk))), 100)
+		}
+		assert.Equal(t, text, strings.Join(chunks, ""))
+	})
+}
+
+func TestHandleRecentCommand_CapsLimit(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	mock.ExpectQuery(`SELECT "id",.*,"updated_at" FROM "notes" WHERE user_id = \$1 AND "notes"."deleted_at" IS NULL ORDER BY updated_at DESC LIMIT \$2$`).
+		WithArgs(userID, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT "id",.*,"updated_at" FROM "tasks" WHERE user_id = \$1 AND "tasks"."deleted_at" IS NULL ORDER BY updated_at DESC LIMIT \$2$`).
+		WithArgs(userID, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	ts := &TelegramService{db: db.DB, limits: TelegramLimits{RecentMax: 4}}
+	response := ts.handleRecentCommand(context.Background(), userID, []string{"500"})
+
+	assert.Contains(t, response, "last 4 items")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleExportCommand_Paginates(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "notes" WHERE user_id = \$1 AND "notes"."deleted_at" IS NULL$`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE user_id = \$1 AND "notes"."deleted_at" IS NULL ORDER BY created_at DESC LIMIT \$2 OFFSET \$3$`).
+		WithArgs(userID, 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).
+			AddRow(uuid.New(), "Third").
+			AddRow(uuid.New(), "Fourth"))
+
+	ts := &TelegramService{db: db.DB, limits: TelegramLimits{ExportPageSize: 2}}
+	response := ts.handleExportCommand(context.Background(), userID, []string{"notes", "all", "2"})
+
+	assert.Contains(t, response, "Page: 2 of 3")
+	assert.Contains(t, response, "## Third")
+	assert.Contains(t, response, "## Fourth")
+	assert.Contains(t, response, "Next page: `/export notes all 3`")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Contains(t, ts.handleExportCommand(context.Background(), userID, []string{"notes", "all", "x"}), "Page must be a positive number")
+}
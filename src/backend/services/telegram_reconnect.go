@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ErrTelegramPermanent marks bot errors that retrying won't fix, such as a
+// revoked or malformed token
+var ErrTelegramPermanent = errors.New("permanent telegram error")
+
+// TelegramReconnectConfig controls how the bot reconnects after losing its connection
+type TelegramReconnectConfig struct {
+	InitialInterval time.Duration // Wait before the first reconnect attempt
+	MaxInterval     time.Duration // Upper bound for the exponential backoff
+	Multiplier      float64       // Backoff growth per failed attempt
+	AlertAfter      int           // Consecutive failures before an alert is raised
+	MaxAttempts     int           // Consecutive failures before giving up, 0 retries forever
+	Notify          bool          // Publish an in-app notification with the alert
+}
+
+// DefaultTelegramReconnectConfig returns the reconnect settings used when none are configured
+func DefaultTelegramReconnectConfig() TelegramReconnectConfig {
+	return TelegramReconnectConfig{
+		InitialInterval: 5 * time.Second,
+		MaxInterval:     5 * time.Minute,
+		Multiplier:      2,
+		AlertAfter:      5,
+		MaxAttempts:     30,
+	}
+}
+
+// telegramReconnectConfigFromEnv applies TELEGRAM_RECONNECT_* overrides to the defaults
+func telegramReconnectConfigFromEnv() TelegramReconnectConfig {
+	cfg := DefaultTelegramReconnectConfig()
+	if d, err := time.ParseDuration(os.Getenv("TELEGRAM_RECONNECT_INITIAL_INTERVAL")); err == nil && d > 0 {
+		cfg.InitialInterval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("TELEGRAM_RECONNECT_MAX_INTERVAL")); err == nil && d > 0 {
+		cfg.MaxInterval = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("TELEGRAM_RECONNECT_ALERT_AFTER")); err == nil && n > 0 {
+		cfg.AlertAfter = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("TELEGRAM_RECONNECT_MAX_ATTEMPTS")); err == nil && n >= 0 {
+		cfg.MaxAttempts = n
+	}
+	cfg.Notify = envFlag("TELEGRAM_RECONNECT_NOTIFY")
+	return cfg
+}
+
+// backoff returns the wait before the given reconnect attempt (1-based)
+func (cfg TelegramReconnectConfig) backoff(attempt int) time.Duration {
+	interval := float64(cfg.InitialInterval)
+	for i := 1; i < attempt; i++ {
+		interval *= cfg.Multiplier
+		if interval >= float64(cfg.MaxInterval) {
+			return cfg.MaxInterval
+		}
+	}
+	return time.Duration(interval)
+}
+
+// telegramBotFactory creates an authorized bot client
+type telegramBotFactory func(token string) (*tgbotapi.BotAPI, error)
+
+// classifyTelegramError wraps errors that won't go away on retry with ErrTelegramPermanent
+func classifyTelegramError(err error) error {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusUnauthorized, http.StatusNotFound:
+			// Invalid or revoked tokens are answered with 401, malformed ones with 404
+			return fmt.Errorf("%w: %v", ErrTelegramPermanent, err)
+		}
+	}
+	return err
+}
+
+// waitFor blocks for d or until ctx is cancelled
+func waitFor(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reconnect recreates the bot client with exponential backoff. It returns
+// when a client was created, the error is permanent, the attempt budget is
+// exhausted or ctx is cancelled.
+func (ts *TelegramService) reconnect(ctx context.Context) error {
+	cfg := ts.reconnectConfig
+	for attempt := 1; ; attempt++ {
+		wait := cfg.backoff(attempt)
+		log.Printf("Telegram bot reconnecting in %s (attempt %d)...", wait, attempt)
+		if err := ts.wait(ctx, wait); err != nil {
+			return err
+		}
+
+		bot, err := ts.botFactory(ts.botToken)
+		if err == nil {
+			ts.bot = bot
+			if attempt-1 >= cfg.AlertAfter {
+				log.Printf("Telegram bot recovered after %d failed reconnect attempts", attempt-1)
+			}
+			log.Printf("Telegram bot reconnected successfully")
+			return nil
+		}
+
+		err = classifyTelegramError(err)
+		if errors.Is(err, ErrTelegramPermanent) {
+			ts.raiseReconnectAlert(ctx, attempt, err)
+			return err
+		}
+
+		log.Printf("Failed to reconnect Telegram bot: %v", err)
+		if attempt == cfg.AlertAfter {
+			ts.raiseReconnectAlert(ctx, attempt, err)
+		}
+		if cfg.MaxAttempts > 0 && attempt >= cfg.MaxAttempts {
+			return fmt.Errorf("giving up after %d reconnect attempts: %w", attempt, err)
+		}
+	}
+}
+
+// raiseReconnectAlert reports that the bot has been unreachable for a while
+func (ts *TelegramService) raiseReconnectAlert(ctx context.Context, failures int, err error) {
+	message := fmt.Sprintf("Telegram bot failed to reconnect %d times: %v", failures, err)
+	log.Printf("ALERT: %s", message)
+
+	if !ts.reconnectConfig.Notify || ts.db == nil {
+		return
+	}
+	userID, userErr := ts.getDefaultUserID(ctx)
+	if userErr != nil {
+		log.Printf("Failed to resolve user for Telegram alert: %v", userErr)
+		return
+	}
+	if notifyErr := NotificationServiceInstance.PublishNotification(userID.String(), "telegram.disconnected", message, time.Now().Format(time.RFC3339)); notifyErr != nil {
+		log.Printf("Failed to publish Telegram alert: %v", notifyErr)
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBotFactory struct {
+	failures int
+	err      error
+	calls    int
+	bot      *tgbotapi.BotAPI
+}
+
+func (f *fakeBotFactory) create(token string) (*tgbotapi.BotAPI, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, f.err
+	}
+	return f.bot, nil
+}
+
+func newReconnectTestService(factory *fakeBotFactory, cfg TelegramReconnectConfig) (*TelegramService, *[]time.Duration) {
+	var waits []time.Duration
+	ctx, cancel := context.WithCancel(context.Background())
+	ts := &TelegramService{
+		botToken:        "token",
+		botFactory:      factory.create,
+		reconnectConfig: cfg,
+		wait: func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return ctx.Err()
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	return ts, &waits
+}
+
+func TestTelegramReconnect_SucceedsAfterFailures(t *testing.T) {
+	factory := &fakeBotFactory{failures: 4, err: errors.New("connection refused"), bot: &tgbotapi.BotAPI{}}
+	cfg := TelegramReconnectConfig{InitialInterval: time.Second, MaxInterval: 5 * time.Second, Multiplier: 2, AlertAfter: 3, MaxAttempts: 10}
+	ts, waits := newReconnectTestService(factory, cfg)
+
+	err := ts.reconnect(ts.ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 5, factory.calls)
+	assert.Same(t, factory.bot, ts.bot)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, *waits)
+}
+
+func TestTelegramReconnect_GivesUpAfterMaxAttempts(t *testing.T) {
+	factory := &fakeBotFactory{failures: 100, err: errors.New("timeout")}
+	cfg := TelegramReconnectConfig{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, Multiplier: 2, AlertAfter: 2, MaxAttempts: 3}
+	ts, _ := newReconnectTestService(factory, cfg)
+
+	err := ts.reconnect(ts.ctx)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "giving up after 3 reconnect attempts")
+	assert.Equal(t, 3, factory.calls)
+}
+
+func TestTelegramReconnect_StopsOnPermanentError(t *testing.T) {
+	factory := &fakeBotFactory{failures: 100, err: &tgbotapi.Error{Code: 401, Message: "Unauthorized"}}
+	ts, _ := newReconnectTestService(factory, DefaultTelegramReconnectConfig())
+
+	err := ts.reconnect(ts.ctx)
+
+	assert.True(t, errors.Is(err, ErrTelegramPermanent))
+	assert.Equal(t, 1, factory.calls)
+}
+
+func TestTelegramReconnect_ExitsWhenStopped(t *testing.T) {
+	factory := &fakeBotFactory{failures: 100, err: errors.New("timeout")}
+	ts, _ := newReconnectTestService(factory, DefaultTelegramReconnectConfig())
+	ts.Stop()
+
+	err := ts.reconnect(ts.ctx)
+
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, 0, factory.calls)
+}
+
+func TestWaitFor_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	assert.Error(t, waitFor(ctx, time.Hour))
+	assert.Less(t, time.Since(start), time.Second)
+}
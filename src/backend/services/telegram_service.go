@@ -3,18 +3,24 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	"gorm.io/gorm"
+	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/prompts"
 )
 
 type TelegramService struct {
@@ -24,6 +30,17 @@ type TelegramService struct {
 	calendarService *CalendarService
 	orchestrator    *AgentOrchestrator
 	allowedChatID   int64
+
+	botToken        string
+	botFactory      telegramBotFactory
+	reconnectConfig TelegramReconnectConfig
+	limits          TelegramLimits
+	clock           Clock
+	wait            func(ctx context.Context, d time.Duration) error
+	classifyOnce    sync.Once
+	classify        *telegramClassifyLimiter
+	ctx             context.Context
+	cancel          context.CancelFunc
 }
 
 type MessageIntent struct {
@@ -33,13 +50,6 @@ type MessageIntent struct {
 	Reasoning   string                 `json:"reasoning"`
 }
 
-type CalendarEvent struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	DateTime    time.Time `json:"date_time"`
-	Duration    int       `json:"duration"` // minutes
-}
-
 func NewTelegramService(db *gorm.DB, aiService *AIService) (*TelegramService, error) {
 	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
 	if botToken == "" {
@@ -70,6 +80,7 @@ func NewTelegramService(db *gorm.DB, aiService *AIService) (*TelegramService, er
 
 	log.Printf("Telegram bot authorized on account %s", bot.Self.UserName)
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &TelegramService{
 		db:              db,
 		bot:             bot,
@@ -77,71 +88,111 @@ func NewTelegramService(db *gorm.DB, aiService *AIService) (*TelegramService, er
 		calendarService: calendarService,
 		orchestrator:    NewAgentOrchestrator(db),
 		allowedChatID:   chatID,
+		botToken:        botToken,
+		botFactory:      tgbotapi.NewBotAPI,
+		reconnectConfig: telegramReconnectConfigFromEnv(),
+		limits:          telegramLimitsFromEnv(),
+		clock:           SystemClock,
+		wait:            waitFor,
+		ctx:             ctx,
+		cancel:          cancel,
 	}, nil
 }
 
-// StartListening starts the Telegram bot polling loop with error recovery
+// StartListening starts the Telegram bot polling loop with error recovery.
+// It returns nil once Stop is called, or an error when reconnecting fails
+// permanently.
 func (ts *TelegramService) StartListening() error {
 	log.Printf("Telegram bot listening for messages...")
 
 	for {
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("Telegram bot panic recovered: %v", r)
-				}
-			}()
+		ts.listen()
 
-			u := tgbotapi.NewUpdate(0)
-			u.Timeout = 30 // Reduced timeout to prevent long hangs
+		if ts.ctx.Err() != nil {
+			log.Printf("Telegram bot stopped listening")
+			return nil
+		}
 
-			updates := ts.bot.GetUpdatesChan(u)
+		// If we get here, the updates channel closed (network error, etc.)
+		log.Printf("Telegram bot connection lost")
+		if err := ts.reconnect(ts.ctx); err != nil {
+			if ts.ctx.Err() != nil {
+				log.Printf("Telegram bot stopped listening")
+				return nil
+			}
+			return err
+		}
+	}
+}
 
-			for update := range updates {
-				if update.Message == nil {
-					continue
-				}
+// Stop ends the polling loop started by StartListening
+func (ts *TelegramService) Stop() {
+	ts.cancel()
+}
 
-				// Check if message is from allowed chat
-				if update.Message.Chat.ID != ts.allowedChatID {
-					log.Printf("Ignoring message from unauthorized chat: %d", update.Message.Chat.ID)
-					continue
-				}
+// listen consumes updates until the channel closes or the service is stopped
+func (ts *TelegramService) listen() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Telegram bot panic recovered: %v", r)
+		}
+	}()
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 30 // Reduced timeout to prevent long hangs
+
+	updates := ts.bot.GetUpdatesChan(u)
 
-				// Background message processing disabled to prevent goroutine leaks
-				log.Printf("Telegram message processing is disabled to prevent application crashes")
-				// go ts.handleMessage(update.Message)
+	for {
+		select {
+		case <-ts.ctx.Done():
+			ts.bot.StopReceivingUpdates()
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			if update.Message == nil {
+				continue
 			}
-		}()
 
-		// If we get here, the updates channel closed (network error, etc.)
-		log.Printf("Telegram bot connection lost, reconnecting in 5 seconds...")
-		time.Sleep(5 * time.Second)
-		
-		// Recreate bot connection
-		botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-		if botToken != "" {
-			if newBot, err := tgbotapi.NewBotAPI(botToken); err == nil {
-				ts.bot = newBot
-				log.Printf("Telegram bot reconnected successfully")
-			} else {
-				log.Printf("Failed to reconnect Telegram bot: %v", err)
+			// Check if message is from allowed chat
+			if update.Message.Chat.ID != ts.allowedChatID {
+				log.Printf("Ignoring message from unauthorized chat: %d", update.Message.Chat.ID)
+				continue
+			}
+
+			// The in-flight limit bounds the goroutines a burst starts
+			chatID := update.Message.Chat.ID
+			if !ts.classifier().admit(chatID) {
+				ts.sendMessage(telegramText(ts.ctx, msgBusy, nil))
+				continue
 			}
+			go func(message *tgbotapi.Message) {
+				defer ts.classifier().done(chatID)
+				defer func() {
+					if r := recover(); r != nil {
+						log.Printf("Telegram message handling panic recovered: %v", r)
+					}
+				}()
+				ts.handleMessage(ts.ctx, message)
+			}(update.Message)
 		}
 	}
 }
 
-// handleMessage processes incoming Telegram messages
-func (ts *TelegramService) handleMessage(message *tgbotapi.Message) {
-	ctx := context.Background()
-	
+// handleMessage processes incoming Telegram messages. ctx ends when the
+// service stops.
+func (ts *TelegramService) handleMessage(ctx context.Context, message *tgbotapi.Message) {
 	// Get the default user (you might want to implement user mapping)
 	userID, err := ts.getDefaultUserID(ctx)
 	if err != nil {
 		log.Printf("Failed to get user ID: %v", err)
-		ts.sendMessage("Sorry, I couldn't identify your user account. Please contact an administrator.")
+		ts.sendMessage(telegramText(ctx, msgUnknownUser, nil))
 		return
 	}
+	ctx = WithAICallUser(ctx, userID)
+	ctx = withTelegramLanguage(ctx, ts.userLanguage(ctx, userID))
 
 	// Check if it's a command (starts with /)
 	if strings.HasPrefix(message.Text, "/") {
@@ -150,11 +201,17 @@ func (ts *TelegramService) handleMessage(message *tgbotapi.Message) {
 		return
 	}
 
+	// A bare link is saved as a bookmark, no classification needed
+	if link, ok := bareLink(message.Text); ok {
+		ts.sendMessage(ts.handleLink(ctx, userID, link))
+		return
+	}
+
 	// Classify the message intent using AI
-	intent, err := ts.classifyMessage(ctx, message.Text)
+	intent, err := ts.classifyChatMessage(ctx, message.Chat.ID, message.Text)
 	if err != nil {
 		log.Printf("Failed to classify message: %v", err)
-		ts.sendMessage("Sorry, I had trouble understanding your message. Please try again.")
+		ts.sendMessage(telegramText(ctx, msgNotUnderstood, nil))
 		return
 	}
 
@@ -163,50 +220,92 @@ func (ts *TelegramService) handleMessage(message *tgbotapi.Message) {
 	ts.sendMessage(response)
 }
 
+// classifier returns the limiter of the service's classifications
+func (ts *TelegramService) classifier() *telegramClassifyLimiter {
+	ts.classifyOnce.Do(func() {
+		ts.classify = newTelegramClassifyLimiter(ts.limits, ts.wait)
+		if ts.clock != nil {
+			ts.classify.clock = ts.clock
+		}
+	})
+	return ts.classify
+}
+
+func (ts *TelegramService) now() time.Time {
+	return clockNow(ts.clock)
+}
+
+// classifyChatMessage classifies a message of the chat once the chat's turn
+// and a classification slot come up
+func (ts *TelegramService) classifyChatMessage(ctx context.Context, chatID int64, messageText string) (*MessageIntent, error) {
+	release, err := ts.classifier().acquire(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return ts.classifyMessage(ctx, messageText)
+}
+
 // classifyMessage uses AI to determine the intent of a message
 func (ts *TelegramService) classifyMessage(ctx context.Context, messageText string) (*MessageIntent, error) {
-	prompt := fmt.Sprintf(`Analyze this message and determine the user's intent. Classify it as one of these types:
-
-1. "calendar" - Adding an event, meeting, appointment, or time-based activity
-2. "task" - Creating a to-do item, reminder, or action item
-3. "project" - Starting a complex goal that needs to be broken down into steps
-4. "note" - General information, thoughts, or miscellaneous content
-
-Message: "%s"
-
-Return a JSON response with this exact structure:
-{
-  "type": "calendar|task|project|note",
-  "confidence": 0.95,
-  "extracted_data": {
-    "title": "extracted title or description",
-    "details": "additional context or details",
-    "date_time": "extracted date/time if applicable (ISO format)",
-    "duration": "extracted duration in minutes if applicable"
-  },
-  "reasoning": "Brief explanation of why this classification was chosen"
+	intent, _, err := ts.classifyWithAI(ctx, messageText)
+	return intent, err
 }
 
-Focus on keywords like:
-- Calendar: "meeting", "appointment", "at 3pm", "tomorrow", "schedule", "call", dates/times
-- Task: "need to", "remember to", "todo", "buy", "call", "email", "fix", action verbs
-- Project: "want to build", "learning", "create", "implement", "develop", complex goals
-- Note: general thoughts, ideas, information without clear action
-
-Be confident in your classification. If unsure between task and calendar, prefer task.`, messageText)
+// classifyWithAI classifies a message with AI, and tells whether the
+// keyword rules were used instead because AI was down or its answer
+// couldn't be read
+func (ts *TelegramService) classifyWithAI(ctx context.Context, messageText string) (*MessageIntent, bool, error) {
+	ctx = withAICallFeature(ctx, prompts.ClassifyIntent, messageText)
+	prompt, err := prompts.Render(prompts.ClassifyIntent, map[string]interface{}{
+		"Message": messageText,
+	})
+	if err != nil {
+		return nil, false, err
+	}
 
 	response, err := ts.aiService.callAnthropic(ctx, prompt, 500)
+	if errors.Is(err, ErrAIUnavailable) {
+		// Keep capturing messages with the keyword rules while AI is down
+		return ts.fallbackClassification(messageText), true, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to call AI service: %w", err)
+		return nil, false, fmt.Errorf("failed to call AI service: %w", err)
 	}
 
 	var intent MessageIntent
 	if err := json.Unmarshal([]byte(response), &intent); err != nil {
 		// Fallback classification if JSON parsing fails
-		return ts.fallbackClassification(messageText), nil
+		return ts.fallbackClassification(messageText), true, nil
 	}
 
-	return &intent, nil
+	return &intent, false, nil
+}
+
+// ClassificationPreview is how a message would be classified, by AI and by
+// the keyword rules used when AI isn't available
+type ClassificationPreview struct {
+	Text     string         `json:"text"`
+	AI       *MessageIntent `json:"ai"`
+	Fallback *MessageIntent `json:"fallback"`
+	// AIFellBack is set when the AI result is the keyword rules' result
+	// because AI was down or answered with something that isn't an intent
+	AIFellBack bool `json:"ai_fell_back"`
+}
+
+// PreviewClassification classifies a message the way an incoming Telegram
+// message is, without acting on it
+func (ts *TelegramService) PreviewClassification(ctx context.Context, messageText string) (*ClassificationPreview, error) {
+	intent, fellBack, err := ts.classifyWithAI(ctx, messageText)
+	if err != nil {
+		return nil, err
+	}
+	return &ClassificationPreview{
+		Text:       messageText,
+		AI:         intent,
+		Fallback:   ts.fallbackClassification(messageText),
+		AIFellBack: fellBack,
+	}, nil
 }
 
 // fallbackClassification provides simple rule-based classification as backup
@@ -290,50 +389,66 @@ func (ts *TelegramService) handleCalendarEvent(ctx context.Context, userID uuid.
 	}
 
 	if !ts.calendarService.HasCalendarAccess(ctx, userID) {
-		return "📅 Calendar event detected, but you haven't connected your Google Calendar yet.\n\n" +
-			"Use `/api/v1/calendar/oauth/authorize` to connect your calendar, then try again.\n\n" +
-			"For now, I'll save this as a task:\n\n" + ts.handleCalendarEventFallback(ctx, userID, messageText, intent)
+		return telegramText(ctx, msgCalendarNotConnected, TelegramArgs{
+			"fallback": telegramMarkup(ts.handleCalendarEventFallback(ctx, userID, messageText, intent)),
+		})
 	}
 
-	// Extract calendar event details from AI
-	title := messageText
-	if extractedTitle, ok := intent.ExtractedData["title"].(string); ok && extractedTitle != "" {
-		title = extractedTitle
+	// Extract the event fields with the dedicated prompt, falling back to the
+	// classifier's data and keyword heuristics when that fails
+	var title, location string
+	var startTime, endTime time.Time
+	var allDay bool
+	extracted, err := ts.aiService.ExtractCalendarEvent(ctx, messageText)
+	if err == nil {
+		title, location = extracted.Title, extracted.Location
+		startTime, endTime, allDay = extracted.Start, extracted.End, extracted.AllDay
+	} else {
+		log.Printf("Calendar extraction failed, using classifier data: %v", err)
+		title = messageText
+		if extractedTitle, ok := intent.ExtractedData["title"].(string); ok && extractedTitle != "" {
+			title = extractedTitle
+		}
+		startTime, endTime, allDay = ts.parseEventDateTime(intent.ExtractedData, messageText)
 	}
 
-	// Parse date/time from extracted data or use AI to extract it
-	startTime, endTime, allDay := ts.parseEventDateTime(intent.ExtractedData, messageText)
-
 	// Create calendar event request
 	request := CalendarEventRequest{
 		Title:       title,
 		Description: fmt.Sprintf("Created from Telegram: %s", messageText),
+		Location:    location,
 		StartTime:   FlexibleTime{Time: startTime},
 		EndTime:     FlexibleTime{Time: endTime},
 		AllDay:      allDay,
 		CalendarID:  "primary", // Use primary calendar
+		Source:      "telegram", // Resent messages return the event already created
 	}
 
 	// Create the calendar event
 	event, err := ts.calendarService.CreateEvent(ctx, userID, request)
 	if err != nil {
 		log.Printf("Failed to create calendar event: %v", err)
-		return "❌ Sorry, I couldn't create your calendar event. " + err.Error() + "\n\n" +
-			"Falling back to task creation:\n\n" + ts.handleCalendarEventFallback(ctx, userID, messageText, intent)
+		return telegramText(ctx, msgCalendarEventFailed, TelegramArgs{
+			"error":    err.Error(),
+			"fallback": telegramMarkup(ts.handleCalendarEventFallback(ctx, userID, messageText, intent)),
+		})
 	}
 
 	// Format response
-	timeStr := ""
+	when := TelegramArgs{"date": startTime.Format("January 2, 2006"), "time": startTime.Format("3:04 PM")}
+	timeStr := telegramText(ctx, msgCalendarEventTime, when)
 	if allDay {
-		timeStr = fmt.Sprintf("📅 %s", startTime.Format("January 2, 2006"))
-	} else {
-		timeStr = fmt.Sprintf("📅 %s at %s", startTime.Format("January 2, 2006"), startTime.Format("3:04 PM"))
+		timeStr = telegramText(ctx, msgCalendarEventDay, when)
+	}
+	if location != "" {
+		timeStr += telegramText(ctx, msgCalendarEventLocation, TelegramArgs{"location": location})
 	}
 
-	return fmt.Sprintf("📅 Calendar event created successfully!\n\n"+
-		"**%s**\n%s\n\n"+
-		"✅ Added to your Google Calendar\n"+
-		"🔗 Event ID: %s", event.Title, timeStr, event.ID)
+	return telegramText(ctx, msgCalendarEventCreated, TelegramArgs{
+		"title":    event.Title,
+		"when":     telegramMarkup(timeStr),
+		"event_id": event.ID,
+	})
 }
 
 // handleCalendarEventFallback creates a task when calendar integration isn't available
@@ -347,7 +462,7 @@ func (ts *TelegramService) handleCalendarEventFallback(ctx context.Context, user
 	notebook, err := ts.getOrCreateTelegramNotebook(ctx, userID)
 	if err != nil {
 		log.Printf("Failed to get/create Telegram notebook: %v", err)
-		return "❌ Sorry, I couldn't create your calendar event. Please try again."
+		return telegramLimitMessage(ctx, err, msgCalendarEventRetry)
 	}
 
 	// Create a note for the calendar event
@@ -358,9 +473,13 @@ func (ts *TelegramService) handleCalendarEventFallback(ctx context.Context, user
 		Tags:       pq.StringArray{"telegram", "calendar", "event"},
 	}
 
+	if err := checkNoteLimit(ts.db.WithContext(ctx), userID); err != nil {
+		log.Printf("Failed to create note: %v", err)
+		return telegramLimitMessage(ctx, err, msgCalendarEventRetry)
+	}
 	if err := ts.db.WithContext(ctx).Create(&note).Error; err != nil {
 		log.Printf("Failed to create calendar note: %v", err)
-		return "❌ Sorry, I couldn't create your calendar event. Please try again."
+		return telegramText(ctx, msgCalendarEventRetry, nil)
 	}
 
 	task := models.Task{
@@ -381,15 +500,15 @@ func (ts *TelegramService) handleCalendarEventFallback(ctx context.Context, user
 
 	if err := ts.db.WithContext(ctx).Create(&task).Error; err != nil {
 		log.Printf("Failed to create calendar task: %v", err)
-		return "❌ Sorry, I couldn't save your calendar event. Please try again."
+		return telegramText(ctx, msgCalendarSaveFailed, nil)
 	}
 
-	return fmt.Sprintf("📅 Calendar event saved as task: \"%s\"\n📝 Note ID: %s\n\n⚠️ Connect your Google Calendar for full calendar integration!", task.Title, note.ID)
+	return telegramText(ctx, msgCalendarSavedAsTask, TelegramArgs{"title": task.Title, "note_id": note.ID})
 }
 
 // parseEventDateTime extracts and parses date/time information from the AI extracted data
 func (ts *TelegramService) parseEventDateTime(extractedData map[string]interface{}, messageText string) (startTime, endTime time.Time, allDay bool) {
-	now := time.Now()
+	now := ts.now()
 	
 	// Try to get parsed datetime from extracted data
 	if dateTimeStr, ok := extractedData["date_time"].(string); ok && dateTimeStr != "" {
@@ -452,7 +571,7 @@ func (ts *TelegramService) handleTask(ctx context.Context, userID uuid.UUID, mes
 	notebook, err := ts.getOrCreateTelegramNotebook(ctx, userID)
 	if err != nil {
 		log.Printf("Failed to get/create Telegram notebook: %v", err)
-		return "❌ Sorry, I couldn't create your task. Please try again."
+		return telegramLimitMessage(ctx, err, msgTaskFailed)
 	}
 
 	// Create a note for the task
@@ -463,9 +582,13 @@ func (ts *TelegramService) handleTask(ctx context.Context, userID uuid.UUID, mes
 		Tags:       pq.StringArray{"telegram", "task"},
 	}
 
+	if err := checkNoteLimit(ts.db.WithContext(ctx), userID); err != nil {
+		log.Printf("Failed to create note: %v", err)
+		return telegramLimitMessage(ctx, err, msgTaskFailed)
+	}
 	if err := ts.db.WithContext(ctx).Create(&note).Error; err != nil {
 		log.Printf("Failed to create task note: %v", err)
-		return "❌ Sorry, I couldn't create your task. Please try again."
+		return telegramText(ctx, msgTaskFailed, nil)
 	}
 
 	task := models.Task{
@@ -486,10 +609,10 @@ func (ts *TelegramService) handleTask(ctx context.Context, userID uuid.UUID, mes
 
 	if err := ts.db.WithContext(ctx).Create(&task).Error; err != nil {
 		log.Printf("Failed to create task: %v", err)
-		return "❌ Sorry, I couldn't create your task. Please try again."
+		return telegramText(ctx, msgTaskFailed, nil)
 	}
 
-	return fmt.Sprintf("✅ Task created: \"%s\"\n📝 Note ID: %s", task.Title, note.ID)
+	return telegramText(ctx, msgTaskCreated, TelegramArgs{"title": task.Title, "note_id": note.ID})
 }
 
 // handleProject creates an AI project with task breakdown
@@ -503,7 +626,7 @@ func (ts *TelegramService) handleProject(ctx context.Context, userID uuid.UUID,
 	breakdown, err := ts.aiService.BreakDownTask(ctx, title, messageText, 8)
 	if err != nil {
 		log.Printf("Failed to break down project: %v", err)
-		return "❌ Sorry, I couldn't break down your project. Please try again."
+		return telegramText(ctx, msgProjectBreakdownFailed, nil)
 	}
 
 	// Create the AI project with notebook integration
@@ -524,7 +647,7 @@ func (ts *TelegramService) handleProject(ctx context.Context, userID uuid.UUID,
 	}
 
 	// Create notebook and notes for the project
-	notebookID, noteIDs, err := ts.aiService.CreateProjectNotebook(ctx, userID, title, project.Description, breakdown)
+	notebookID, noteIDs, err := ts.aiService.CreateProjectNotebook(ctx, userID, title, project.Description, breakdown, "")
 	if err != nil {
 		log.Printf("Failed to create project notebook: %v", err)
 	} else {
@@ -534,7 +657,7 @@ func (ts *TelegramService) handleProject(ctx context.Context, userID uuid.UUID,
 
 	if err := ts.db.WithContext(ctx).Create(&project).Error; err != nil {
 		log.Printf("Failed to create project: %v", err)
-		return "❌ Sorry, I couldn't create your project. Please try again."
+		return telegramText(ctx, msgProjectFailed, nil)
 	}
 
 	stepsCount := 0
@@ -542,9 +665,12 @@ func (ts *TelegramService) handleProject(ctx context.Context, userID uuid.UUID,
 		stepsCount = len(steps)
 	}
 
-	response := fmt.Sprintf("🚀 Project created: \"%s\"\n📊 Broken down into %d steps", project.Name, stepsCount)
+	response := telegramText(ctx, msgProjectCreated, TelegramArgs{"name": project.Name, "steps": stepsCount})
+	if unavailable, _ := breakdown["ai_unavailable"].(bool); unavailable {
+		response = telegramText(ctx, msgProjectPlaceholder, TelegramArgs{"name": project.Name, "ai_unavailable": AIUnavailableMessage})
+	}
 	if project.NotebookID != nil {
-		response += fmt.Sprintf("\n📓 Notebook ID: %s", *project.NotebookID)
+		response += telegramText(ctx, msgProjectNotebook, TelegramArgs{"notebook_id": *project.NotebookID})
 	}
 	
 	return response
@@ -561,7 +687,7 @@ func (ts *TelegramService) handleNote(ctx context.Context, userID uuid.UUID, mes
 	notebook, err := ts.getOrCreateTelegramNotebook(ctx, userID)
 	if err != nil {
 		log.Printf("Failed to get/create Telegram notebook: %v", err)
-		return "❌ Sorry, I couldn't create your note. Please try again."
+		return telegramLimitMessage(ctx, err, msgNoteFailed)
 	}
 
 	note := models.Note{
@@ -571,9 +697,13 @@ func (ts *TelegramService) handleNote(ctx context.Context, userID uuid.UUID, mes
 		Tags:       pq.StringArray{"telegram", "note"},
 	}
 
+	if err := checkNoteLimit(ts.db.WithContext(ctx), userID); err != nil {
+		log.Printf("Failed to create note: %v", err)
+		return telegramLimitMessage(ctx, err, msgNoteFailed)
+	}
 	if err := ts.db.WithContext(ctx).Create(&note).Error; err != nil {
 		log.Printf("Failed to create note: %v", err)
-		return "❌ Sorry, I couldn't create your note. Please try again."
+		return telegramText(ctx, msgNoteFailed, nil)
 	}
 
 	// Create a text block with the message content
@@ -590,6 +720,8 @@ func (ts *TelegramService) handleNote(ctx context.Context, userID uuid.UUID, mes
 	if err := ts.db.WithContext(ctx).Create(&block).Error; err != nil {
 		log.Printf("Failed to create note block: %v", err)
 		// Note was created, so don't fail completely
+	} else {
+		refreshNotePreview(ts.db.WithContext(ctx), note.ID)
 	}
 
 	// AI background processing is disabled to prevent goroutine leaks
@@ -604,7 +736,84 @@ func (ts *TelegramService) handleNote(ctx context.Context, userID uuid.UUID, mes
 	}()
 	*/
 
-	return fmt.Sprintf("📝 Note created: \"%s\"\n🤖 AI processing started for enhanced insights\n📝 Note ID: %s", note.Title, note.ID)
+	if !ts.aiService.Available(ctx) {
+		return telegramText(ctx, msgNoteCreatedNoAI, TelegramArgs{"title": note.Title, "ai_unavailable": AIUnavailableMessage, "note_id": note.ID})
+	}
+	return telegramText(ctx, msgNoteCreated, TelegramArgs{"title": note.Title, "note_id": note.ID})
+}
+
+// bareLink reports whether the message is nothing but an http(s) link
+func bareLink(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.ContainsAny(text, " \t\n") {
+		return "", false
+	}
+	parsed, err := url.Parse(text)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", false
+	}
+	return text, true
+}
+
+// handleLink saves a link as a bookmark note with the page's title and
+// description
+func (ts *TelegramService) handleLink(ctx context.Context, userID uuid.UUID, link string) string {
+	preview, err := LinkServiceInstance.FetchPreview(ctx, link)
+	if errors.Is(err, ErrBlockedAddress) || errors.Is(err, ErrInvalidInput) {
+		return telegramText(ctx, msgLinkNotPublic, nil)
+	}
+	if err != nil {
+		log.Printf("Link preview of %s failed: %v", link, err)
+		preview = LinkPreview{URL: link}
+	}
+
+	notebook, err := ts.getOrCreateTelegramNotebook(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to get/create Telegram notebook: %v", err)
+		return telegramLimitMessage(ctx, err, msgLinkFailed)
+	}
+
+	title := preview.Title
+	if title == "" {
+		title = link
+	}
+	if runes := []rune(title); len(runes) > 100 {
+		title = string(runes[:97]) + "..."
+	}
+
+	note := models.Note{
+		UserID:     userID,
+		NotebookID: notebook.ID,
+		Title:      title,
+		Tags:       pq.StringArray{"telegram", "link"},
+	}
+	if err := checkNoteLimit(ts.db.WithContext(ctx), userID); err != nil {
+		log.Printf("Failed to create note: %v", err)
+		return telegramLimitMessage(ctx, err, msgLinkFailed)
+	}
+	if err := ts.db.WithContext(ctx).Create(&note).Error; err != nil {
+		log.Printf("Failed to create bookmark note: %v", err)
+		return telegramText(ctx, msgLinkFailed, nil)
+	}
+
+	block := models.Block{
+		UserID:   userID,
+		NoteID:   note.ID,
+		Type:     models.LinkBlock,
+		Order:    1.0,
+		Content:  linkBlockContent(preview),
+		Metadata: models.BlockMetadata{"fetched_at": ts.now().UTC().Format(time.RFC3339)},
+	}
+	if err := ts.db.WithContext(ctx).Create(&block).Error; err != nil {
+		log.Printf("Failed to create bookmark block: %v", err)
+	} else {
+		refreshNotePreview(ts.db.WithContext(ctx), note.ID)
+	}
+
+	if preview.Description != "" {
+		return telegramText(ctx, msgLinkSavedDetails, TelegramArgs{"title": note.Title, "description": preview.Description, "note_id": note.ID})
+	}
+	return telegramText(ctx, msgLinkSaved, TelegramArgs{"title": note.Title, "note_id": note.ID})
 }
 
 // getOrCreateTelegramNotebook gets or creates a default notebook for Telegram messages
@@ -624,6 +833,9 @@ func (ts *TelegramService) getOrCreateTelegramNotebook(ctx context.Context, user
 		Description: "Notes, tasks, and projects created via Telegram bot",
 	}
 
+	if err := checkNotebookLimit(ts.db.WithContext(ctx), userID); err != nil {
+		return nil, err
+	}
 	if err := ts.db.WithContext(ctx).Create(&notebook).Error; err != nil {
 		return nil, fmt.Errorf("failed to create Telegram notebook: %w", err)
 	}
@@ -631,11 +843,21 @@ func (ts *TelegramService) getOrCreateTelegramNotebook(ctx context.Context, user
 	return &notebook, nil
 }
 
+// telegramLimitMessage explains a reached usage limit, and otherwise
+// answers with the fallback message
+func telegramLimitMessage(ctx context.Context, err error, fallback TelegramMessageID) string {
+	var limitErr *LimitExceededError
+	if errors.As(err, &limitErr) {
+		return telegramText(ctx, msgLimitReached, TelegramArgs{"limit": limitErr.Limit, "resource": usageLabel(limitErr.Resource)})
+	}
+	return telegramText(ctx, fallback, nil)
+}
+
 // handleCommand processes Telegram bot commands
 func (ts *TelegramService) handleCommand(ctx context.Context, userID uuid.UUID, command string) string {
 	parts := strings.Fields(command)
 	if len(parts) == 0 {
-		return "❌ Invalid command format"
+		return telegramText(ctx, msgInvalidCommand, nil)
 	}
 
 	cmd := strings.ToLower(parts[0])
@@ -643,11 +865,11 @@ func (ts *TelegramService) handleCommand(ctx context.Context, userID uuid.UUID,
 
 	switch cmd {
 	case "/start":
-		return ts.handleStartCommand()
+		return telegramText(ctx, msgStart, nil)
 	case "/help":
-		return ts.handleHelpCommand()
+		return telegramText(ctx, msgHelp, nil)
 	case "/chains":
-		return ts.handleChainsCommand()
+		return ts.handleChainsCommand(ctx)
 	case "/run":
 		return ts.handleRunChainCommand(ctx, userID, args)
 	case "/template":
@@ -676,68 +898,12 @@ func (ts *TelegramService) handleCommand(ctx context.Context, userID uuid.UUID,
 	case "/backup":
 		return ts.handleBackupCommand(ctx, userID)
 	default:
-		return fmt.Sprintf("❌ Unknown command: %s\n\nType /help to see available commands.", cmd)
+		return telegramText(ctx, msgUnknownCommand, TelegramArgs{"command": cmd})
 	}
 }
 
-// handleStartCommand shows welcome message
-func (ts *TelegramService) handleStartCommand() string {
-	return `🦉 *Welcome to Owlistic AI Bot!*
-
-I can help you with:
-• 📝 Create notes and tasks
-• 📅 Schedule calendar events  
-• 🤖 Run AI agent chains
-• 📊 Execute workflow templates
-
-Type /help to see all available commands.`
-}
-
-// handleHelpCommand shows all available commands
-func (ts *TelegramService) handleHelpCommand() string {
-	return `🤖 *Owlistic AI Bot Commands*
-
-*Basic Commands:*
-• /start - Show welcome message
-• /help - Show this help
-
-*AI Agent Chains:*
-• /chains - List available chains
-• /run <chain_id> <input> - Execute a chain
-• /template <template_id> - Use a template
-• /status <execution_id> - Check execution status
-
-*Smart Search:*
-• /search <query> - Search your notes & content
-• /knowledge <question> - Ask your knowledge base
-• /related <topic> - Find related content
-
-*Dashboard:*
-• /today - Today's overview & agenda
-• /recent [count] - Show recent activity
-• /stats [week|month] - Productivity statistics
-
-*Export & Sync:*
-• /export <type> [timeframe] - Export content
-• /sync <service> - Force synchronization
-• /backup - Create data backup
-
-*Natural Language:*
-Just type naturally and I'll:
-• Create calendar events
-• Add tasks
-• Take notes
-• Start projects
-
-*Examples:*
-• "Schedule meeting tomorrow at 2pm"
-• /search "machine learning notes"
-• /today
-• /export notes week`
-}
-
 // handleChainsCommand lists available agent chains
-func (ts *TelegramService) handleChainsCommand() string {
+func (ts *TelegramService) handleChainsCommand(ctx context.Context) string {
 	chains := []struct {
 		ID          string
 		Name        string
@@ -749,25 +915,17 @@ func (ts *TelegramService) handleChainsCommand() string {
 		{"content-creation", "Content Creation", "Research, outline, write, and polish content"},
 	}
 
-	response := "🤖 *Available AI Agent Chains:*\n\n"
+	var list strings.Builder
 	for _, chain := range chains {
-		response += fmt.Sprintf("*%s*\n`/run %s <your input>`\n%s\n\n", 
-			chain.Name, chain.ID, chain.Description)
+		list.WriteString(telegramText(ctx, msgChainEntry, TelegramArgs{"name": chain.Name, "id": chain.ID, "description": chain.Description}))
 	}
-
-	response += "*Templates:*\n"
-	response += "`/template research-template` - Research Pipeline\n"
-	response += "`/template writing-template` - Writing Assistant\n"
-	response += "`/template learning-template` - Learning Path\n"
-	response += "`/template project-planning` - Project Planning\n"
-
-	return response
+	return telegramText(ctx, msgChains, TelegramArgs{"chains": telegramMarkup(list.String())})
 }
 
 // handleRunChainCommand executes an agent chain
 func (ts *TelegramService) handleRunChainCommand(ctx context.Context, userID uuid.UUID, args []string) string {
 	if len(args) < 2 {
-		return "❌ Usage: `/run <chain_id> <input>`\n\nExample: `/run research-and-summarize machine learning trends`\n\nType /chains to see available chains."
+		return telegramText(ctx, msgRunUsage, nil)
 	}
 
 	chainID := args[0]
@@ -788,35 +946,23 @@ func (ts *TelegramService) handleRunChainCommand(ctx context.Context, userID uui
 	// Execute the chain
 	result, err := ts.orchestrator.ExecuteChain(ctx, request)
 	if err != nil {
-		return fmt.Sprintf("❌ Failed to execute chain '%s': %v", chainID, err)
+		return telegramText(ctx, msgRunFailed, TelegramArgs{"chain": chainID, "error": err})
 	}
 
-	return fmt.Sprintf("🚀 *Chain Execution Started*\n\n"+
-		"Chain: %s\n"+
-		"Execution ID: `%s`\n"+
-		"Input: %s\n\n"+
-		"Use `/status %s` to check progress.\n\n"+
-		"I'll update you when it's complete!",
-		chainID, result.ID, input, result.ID)
+	return telegramText(ctx, msgRunStarted, TelegramArgs{"chain": chainID, "execution_id": result.ID, "input": input})
 }
 
 // handleTemplateCommand instantiates a template
 func (ts *TelegramService) handleTemplateCommand(ctx context.Context, userID uuid.UUID, args []string) string {
 	if len(args) < 1 {
-		return "❌ Usage: `/template <template_id> [parameters]`\n\n" +
-			"Available templates:\n" +
-			"• research-template\n" +
-			"• writing-template\n" +
-			"• learning-template\n" +
-			"• project-planning\n\n" +
-			"Example: `/template research-template topic=\"AI trends\" depth=\"deep\"`"
+		return telegramText(ctx, msgTemplateUsage, nil)
 	}
 
 	templateID := args[0]
 	
 	// Parse parameters from remaining args
 	parameters := make(map[string]interface{})
-	parameters["name"] = fmt.Sprintf("Telegram %s - %s", templateID, time.Now().Format("Jan 2"))
+	parameters["name"] = fmt.Sprintf("Telegram %s - %s", templateID, ts.now().Format("Jan 2"))
 	
 	// Simple parameter parsing (key=value format)
 	for _, arg := range args[1:] {
@@ -830,48 +976,29 @@ func (ts *TelegramService) handleTemplateCommand(ctx context.Context, userID uui
 
 	// If no parameters provided, use interactive approach
 	if len(parameters) == 1 { // Only name was set
-		return ts.getTemplatePrompt(templateID)
+		return ts.getTemplatePrompt(ctx, templateID)
 	}
 
 	// Create chain from template (placeholder for now)
-	chainID := fmt.Sprintf("%s-%d", templateID, time.Now().Unix())
+	chainID := fmt.Sprintf("%s-%d", templateID, ts.now().Unix())
 	
-	return fmt.Sprintf("✅ *Template Instantiated*\n\n"+
-		"Template: %s\n"+
-		"Chain ID: `%s`\n"+
-		"Parameters: %v\n\n"+
-		"Use `/run %s <input>` to execute this chain.",
-		templateID, chainID, parameters, chainID)
+	return telegramText(ctx, msgTemplateCreated, TelegramArgs{"template": templateID, "chain_id": chainID, "parameters": parameters})
 }
 
-// getTemplatePrompt returns parameter instructions for a template
-func (ts *TelegramService) getTemplatePrompt(templateID string) string {
-	switch templateID {
-	case "research-template":
-		return "📝 *Research Pipeline Template*\n\n" +
-			"Usage: `/template research-template topic=\"your topic\" depth=\"shallow|medium|deep\"`\n\n" +
-			"Example: `/template research-template topic=\"AI in healthcare\" depth=\"deep\"`"
-	case "writing-template":
-		return "✍️ *Writing Assistant Template*\n\n" +
-			"Usage: `/template writing-template topic=\"your topic\" style=\"formal|casual|technical\" length=\"word count\"`\n\n" +
-			"Example: `/template writing-template topic=\"blockchain basics\" style=\"casual\" length=\"1000\"`"
-	case "learning-template":
-		return "🎓 *Learning Path Template*\n\n" +
-			"Usage: `/template learning-template subject=\"subject\" level=\"beginner|intermediate|advanced\" timeframe=\"duration\"`\n\n" +
-			"Example: `/template learning-template subject=\"Python programming\" level=\"beginner\" timeframe=\"3 months\"`"
-	case "project-planning":
-		return "📋 *Project Planning Template*\n\n" +
-			"Usage: `/template project-planning project_name=\"name\" goals=\"objectives\" constraints=\"limitations\"`\n\n" +
-			"Example: `/template project-planning project_name=\"Mobile App\" goals=\"Create iOS app\" constraints=\"3 month timeline\"`"
-	default:
-		return "❌ Unknown template: " + templateID
+// getTemplatePrompt returns parameter instructions for a template, which
+// are the catalog's template_<id> message
+func (ts *TelegramService) getTemplatePrompt(ctx context.Context, templateID string) string {
+	id := TelegramMessageID("template_" + templateID)
+	if _, ok := englishTelegramMessages[id]; !ok {
+		return telegramText(ctx, msgTemplateUnknown, TelegramArgs{"template": templateID})
 	}
+	return telegramText(ctx, id, nil)
 }
 
 // handleStatusCommand checks execution status
 func (ts *TelegramService) handleStatusCommand(ctx context.Context, userID uuid.UUID, args []string) string {
 	if len(args) < 1 {
-		return "❌ Usage: `/status <execution_id>`\n\nExample: `/status abc123-def456`"
+		return telegramText(ctx, msgStatusUsage, nil)
 	}
 
 	executionID := args[0]
@@ -879,44 +1006,49 @@ func (ts *TelegramService) handleStatusCommand(ctx context.Context, userID uuid.
 	// Get execution status
 	result, exists := ts.orchestrator.GetExecutionStatus(executionID)
 	if !exists {
-		return fmt.Sprintf("❌ Execution not found: %s", executionID)
+		// Finished executions are only kept in the database
+		stored, err := ts.orchestrator.GetExecutionResults(userID, executionID)
+		if err != nil {
+			return telegramText(ctx, msgExecutionNotFound, TelegramArgs{"execution_id": executionID})
+		}
+		return formatStoredExecutionResults(ctx, stored)
 	}
 
-	status := ""
+	var status string
 	switch result.Status {
 	case "running":
-		status = "🔄 Running"
+		status = telegramText(ctx, msgExecutionRunning, nil)
 	case "completed":
-		status = "✅ Completed"
+		status = telegramText(ctx, msgExecutionCompleted, nil)
 	case "failed":
-		status = "❌ Failed"
+		status = telegramText(ctx, msgExecutionFailed, nil)
 	case "timeout":
-		status = "⏰ Timeout"
+		status = telegramText(ctx, msgExecutionTimeout, nil)
 	default:
-		status = "❓ " + result.Status
+		status = telegramText(ctx, msgExecutionOther, TelegramArgs{"status": result.Status})
 	}
 
-	response := fmt.Sprintf("📊 *Execution Status*\n\n"+
-		"ID: `%s`\n"+
-		"Chain: %s\n"+
-		"Status: %s\n"+
-		"Started: %s\n",
-		result.ID, result.ChainID, status, result.StartTime.Format("Jan 2, 15:04"))
+	response := telegramText(ctx, msgExecutionStatus, TelegramArgs{
+		"id":      result.ID,
+		"chain":   result.ChainID,
+		"status":  telegramMarkup(status),
+		"started": result.StartTime.Format("Jan 2, 15:04"),
+	})
 
 	if result.EndTime != nil {
 		duration := result.EndTime.Sub(result.StartTime)
-		response += fmt.Sprintf("Duration: %v\n", duration.Round(time.Second))
+		response += telegramText(ctx, msgExecutionDuration, TelegramArgs{"duration": duration.Round(time.Second)})
 	}
 
 	if len(result.Errors) > 0 {
-		response += fmt.Sprintf("\n❌ Errors (%d):\n", len(result.Errors))
+		response += telegramText(ctx, msgExecutionErrors, TelegramArgs{"count": len(result.Errors)})
 		for _, err := range result.Errors {
-			response += fmt.Sprintf("• %s: %s\n", err.AgentName, err.Error)
+			response += telegramText(ctx, msgExecutionError, TelegramArgs{"agent": err.AgentName, "error": err.Error})
 		}
 	}
 
 	if len(result.ExecutionLog) > 0 {
-		response += fmt.Sprintf("\n📋 Progress (%d steps):\n", len(result.ExecutionLog))
+		response += telegramText(ctx, msgExecutionProgress, TelegramArgs{"count": len(result.ExecutionLog)})
 		for _, log := range result.ExecutionLog {
 			stepStatus := "❓"
 			if log.Status == "completed" {
@@ -926,67 +1058,127 @@ func (ts *TelegramService) handleStatusCommand(ctx context.Context, userID uuid.
 			} else if log.Status == "running" {
 				stepStatus = "🔄"
 			}
-			response += fmt.Sprintf("• %s %s (%.1fs)\n", stepStatus, log.AgentName, log.Duration)
+			response += telegramText(ctx, msgExecutionStep, TelegramArgs{"status": stepStatus, "agent": log.AgentName, "seconds": fmt.Sprintf("%.1f", log.Duration)})
 		}
 	}
 
 	if result.Status == "completed" && len(result.Results) > 0 {
-		response += "\n🎯 *Results available!* Check the web interface for detailed output."
+		response += telegramText(ctx, msgExecutionResultsLink, TelegramArgs{"id": result.ID})
+	}
+
+	return response
+}
+
+// telegramNotePreview renders a note as its title followed by the start of
+// its content
+func telegramNotePreview(note models.Note, titleChars, previewChars int) string {
+	title := shortenText(note.Title, titleChars)
+	preview := PreviewText(note, previewChars)
+	switch {
+	case preview == "" || preview == title:
+		return title
+	case title == "":
+		return preview
+	default:
+		return title + " — " + preview
+	}
+}
+
+// shortenText cuts text to at most maxChars characters
+func shortenText(text string, maxChars int) string {
+	text = strings.TrimSpace(text)
+	runes := []rune(text)
+	if len(runes) <= maxChars {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:maxChars])) + "..."
+}
+
+// formatStoredExecutionResults renders the persisted results of a finished chain
+func formatStoredExecutionResults(ctx context.Context, stored *ChainExecutionResults) string {
+	response := telegramText(ctx, msgStoredResults, TelegramArgs{"chain": stored.ChainID, "status": stored.Status})
+	if stored.CompletedAt != nil {
+		response += telegramText(ctx, msgStoredFinished, TelegramArgs{"finished": stored.CompletedAt.Format("Jan 2, 15:04")})
+	}
+
+	if len(stored.Steps) > 0 {
+		response += telegramText(ctx, msgStoredSteps, TelegramArgs{"count": len(stored.Steps)})
+		for _, step := range stored.Steps {
+			response += telegramText(ctx, msgStoredStep, TelegramArgs{"name": step.Name, "status": step.Status})
+		}
+	}
+
+	keys := make([]string, 0, len(stored.Results))
+	for key := range stored.Results {
+		if key != "user_id" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		response += telegramText(ctx, msgStoredResultsHeader, nil)
+		for _, key := range keys {
+			value := shortenText(fmt.Sprintf("%v", stored.Results[key]), 300)
+			response += telegramText(ctx, msgStoredResult, TelegramArgs{"key": key, "value": value})
+		}
 	}
 
 	return response
 }
 
+// telegramExportPreviewChars is how much of a note's content /export shows
+const telegramExportPreviewChars = 200
+
 // handleSearchCommand performs semantic search across user's content
 func (ts *TelegramService) handleSearchCommand(ctx context.Context, userID uuid.UUID, args []string) string {
 	if len(args) == 0 {
-		return "❌ Usage: `/search <query>`\n\nExample: `/search machine learning notes`"
+		return telegramText(ctx, msgSearchUsage, nil)
 	}
 
 	query := strings.Join(args, " ")
 	
 	// Use ChromaDB for semantic search
-	results, err := ts.aiService.SearchNotes(ctx, userID, query, 5)
+	results, degraded, err := ts.aiService.SearchNotes(ctx, userID, query, 5)
 	if err != nil {
-		return fmt.Sprintf("❌ Search failed: %v", err)
+		return telegramText(ctx, msgSearchFailed, TelegramArgs{"error": err})
 	}
 
 	if len(results) == 0 {
-		return fmt.Sprintf("🔍 No results found for: *%s*\n\nTry different keywords or check if you have notes created.", query)
+		return telegramText(ctx, msgSearchNoResults, TelegramArgs{"query": query})
 	}
 
-	response := fmt.Sprintf("🔍 *Search Results for:* %s\n\n", query)
+	response := telegramText(ctx, msgSearchResults, TelegramArgs{"query": query})
+	if degraded {
+		response += telegramText(ctx, msgDegradedSearch, nil) + "\n\n"
+	}
 	for i, note := range results {
-		// Truncate content for preview
-		preview := note.Title
-		if len(preview) > 60 {
-			preview = preview[:60] + "..."
+		response += telegramText(ctx, msgSearchResult, TelegramArgs{"number": i + 1, "title": shortenText(note.Title, 60)})
+		if preview := PreviewText(note, 120); preview != "" {
+			response += telegramText(ctx, msgSearchResultPreview, TelegramArgs{"preview": preview})
 		}
-		response += fmt.Sprintf("%d. *%s*\n", i+1, preview)
-		response += fmt.Sprintf("   📅 %s\n", note.UpdatedAt.Format("Jan 2, 2006"))
-		response += "\n"
+		response += telegramText(ctx, msgSearchResultDate, TelegramArgs{"date": note.UpdatedAt.Format("Jan 2, 2006")})
 	}
 
-	response += fmt.Sprintf("Found %d result(s). Use the web interface to view full content.", len(results))
+	response += telegramText(ctx, msgSearchFound, TelegramArgs{"count": len(results)})
 	return response
 }
 
 // handleKnowledgeCommand answers questions using user's knowledge base
 func (ts *TelegramService) handleKnowledgeCommand(ctx context.Context, userID uuid.UUID, args []string) string {
 	if len(args) == 0 {
-		return "❌ Usage: `/knowledge <question>`\n\nExample: `/knowledge how do I deploy with docker?`"
+		return telegramText(ctx, msgKnowledgeUsage, nil)
 	}
 
 	question := strings.Join(args, " ")
 	
 	// Search for relevant notes first
-	relevantNotes, err := ts.aiService.SearchNotes(ctx, userID, question, 3)
+	relevantNotes, degraded, err := ts.aiService.SearchNotes(ctx, userID, question, 3)
 	if err != nil {
-		return fmt.Sprintf("❌ Knowledge search failed: %v", err)
+		return telegramText(ctx, msgKnowledgeFailed, TelegramArgs{"error": err})
 	}
 
 	if len(relevantNotes) == 0 {
-		return fmt.Sprintf("🤔 No relevant knowledge found for: *%s*\n\nTry creating some notes first, then ask again!", question)
+		return telegramText(ctx, msgKnowledgeNone, TelegramArgs{"question": question})
 	}
 
 	// Prepare context from notes
@@ -1005,43 +1197,45 @@ Please provide a helpful answer based on the user's own notes and knowledge. If
 
 	response, err := ts.aiService.GenerateResponse(ctx, prompt, nil)
 	if err != nil {
-		return fmt.Sprintf("❌ Failed to generate answer: %v", err)
+		return telegramText(ctx, msgKnowledgeNoAnswer, TelegramArgs{"error": err})
 	}
 
-	return fmt.Sprintf("🧠 *Knowledge Base Answer*\n\n**Question:** %s\n\n**Answer:** %s\n\n*Based on %d of your notes*", 
-		question, response, len(relevantNotes))
+	answer := telegramText(ctx, msgKnowledgeAnswer, TelegramArgs{"question": question, "answer": response, "count": len(relevantNotes)})
+	if degraded {
+		answer += "\n\n" + telegramText(ctx, msgDegradedSearch, nil)
+	}
+	return answer
 }
 
 // handleRelatedCommand finds content related to a topic
 func (ts *TelegramService) handleRelatedCommand(ctx context.Context, userID uuid.UUID, args []string) string {
 	if len(args) == 0 {
-		return "❌ Usage: `/related <topic>`\n\nExample: `/related project planning`"
+		return telegramText(ctx, msgRelatedUsage, nil)
 	}
 
 	topic := strings.Join(args, " ")
 	
 	// Search for related notes
-	relatedNotes, err := ts.aiService.SearchNotes(ctx, userID, topic, 8)
+	relatedNotes, degraded, err := ts.aiService.SearchNotes(ctx, userID, topic, 8)
 	if err != nil {
-		return fmt.Sprintf("❌ Related search failed: %v", err)
+		return telegramText(ctx, msgRelatedFailed, TelegramArgs{"error": err})
 	}
 
 	if len(relatedNotes) == 0 {
-		return fmt.Sprintf("🔗 No related content found for: *%s*", topic)
+		return telegramText(ctx, msgRelatedNone, TelegramArgs{"topic": topic})
 	}
 
-	response := fmt.Sprintf("🔗 *Related to:* %s\n\n", topic)
+	response := telegramText(ctx, msgRelatedHeader, TelegramArgs{"topic": topic})
+	if degraded {
+		response += telegramText(ctx, msgDegradedSearch, nil) + "\n\n"
+	}
 	
 	for i, note := range relatedNotes {
-		preview := note.Title
-		if len(preview) > 50 {
-			preview = preview[:50] + "..."
-		}
-		response += fmt.Sprintf("• %s\n", preview)
+		response += telegramText(ctx, msgListItem, TelegramArgs{"item": telegramNotePreview(note, 50, 80)})
 		if i >= 6 { // Limit display to prevent long messages
 			remaining := len(relatedNotes) - i - 1
 			if remaining > 0 {
-				response += fmt.Sprintf("  ... and %d more\n", remaining)
+				response += telegramText(ctx, msgAndMore, TelegramArgs{"count": remaining})
 			}
 			break
 		}
@@ -1052,87 +1246,97 @@ func (ts *TelegramService) handleRelatedCommand(ctx context.Context, userID uuid
 
 // handleTodayCommand shows today's overview
 func (ts *TelegramService) handleTodayCommand(ctx context.Context, userID uuid.UUID) string {
-	now := time.Now()
-	today := now.Format("Monday, January 2, 2006")
-	
-	response := fmt.Sprintf("📅 *Today's Overview - %s*\n\n", today)
+	agenda, err := AgendaServiceInstance.GetAgenda(&database.Database{DB: ts.db.WithContext(ctx)}, userID, "", "")
+	if err != nil {
+		log.Printf("Failed to get today's agenda: %v", err)
+		return telegramText(ctx, msgTodayFailed, nil)
+	}
+	location, _ := time.LoadLocation(agenda.Timezone)
+	startOfDay, _ := time.ParseInLocation(agendaDateLayout, agenda.Date, location)
 
-	// Get today's tasks
-	var tasks []models.Task
-	if err := ts.db.WithContext(ctx).Where("user_id = ? AND due_date::date = ?", userID, now.Format("2006-01-02")).Find(&tasks).Error; err != nil {
-		log.Printf("Failed to get today's tasks: %v", err)
-	} else {
-		pendingTasks := 0
-		completedTasks := 0
-		for _, task := range tasks {
-			if task.IsCompleted {
+	response := telegramText(ctx, msgTodayHeader, TelegramArgs{"date": startOfDay.Format("Monday, January 2, 2006")})
+
+	var pendingTasks, events []AgendaItem
+	completedTasks, reminders := 0, 0
+	for _, item := range agenda.Items {
+		switch item.Type {
+		case AgendaItemTask:
+			if item.Completed {
 				completedTasks++
 			} else {
-				pendingTasks++
+				pendingTasks = append(pendingTasks, item)
 			}
+		case AgendaItemEvent:
+			events = append(events, item)
+		case AgendaItemReminder:
+			reminders++
 		}
-		
-		response += fmt.Sprintf("✅ *Tasks:* %d pending, %d completed\n", pendingTasks, completedTasks)
-		
-		if pendingTasks > 0 {
-			response += "📋 Pending tasks:\n"
-			count := 0
-			for _, task := range tasks {
-				if !task.IsCompleted && count < 5 {
-					response += fmt.Sprintf("• %s\n", task.Title)
-					count++
-				}
-			}
-			if pendingTasks > 5 {
-				response += fmt.Sprintf("  ... and %d more\n", pendingTasks-5)
+	}
+
+	response += telegramText(ctx, msgTodayTasks, TelegramArgs{"pending": len(pendingTasks), "completed": completedTasks})
+	if len(pendingTasks) > 0 {
+		response += telegramText(ctx, msgTodayPending, nil)
+		for i, task := range pendingTasks {
+			if i < 5 {
+				response += telegramText(ctx, msgListItem, TelegramArgs{"item": task.Title})
 			}
 		}
-		response += "\n"
+		if len(pendingTasks) > 5 {
+			response += telegramText(ctx, msgAndMore, TelegramArgs{"count": len(pendingTasks) - 5})
+		}
 	}
+	response += "\n"
 
-	// Get today's calendar events (if calendar service is available)
-	if ts.calendarService != nil {
-		events, err := ts.calendarService.GetTodaysEvents(ctx, userID)
-		if err == nil && len(events) > 0 {
-			response += fmt.Sprintf("📅 *Calendar:* %d events today\n", len(events))
-			for i, event := range events {
-				if i < 3 { // Show first 3 events
-					eventTime := "All day"
-					if !event.StartTime.IsZero() {
-						eventTime = event.StartTime.Format("15:04")
-					}
-					response += fmt.Sprintf("• %s - %s\n", eventTime, event.Title)
+	if len(events) > 0 {
+		response += telegramText(ctx, msgTodayEvents, TelegramArgs{"count": len(events)})
+		for i, event := range events {
+			if i < 3 { // Show first 3 events
+				eventTime := telegramText(ctx, msgTodayAllDay, nil)
+				if !event.AllDay {
+					eventTime = event.Start.Format("15:04")
 				}
+				response += telegramText(ctx, msgTodayEvent, TelegramArgs{"time": telegramMarkup(eventTime), "title": event.Title})
 			}
-			if len(events) > 3 {
-				response += fmt.Sprintf("  ... and %d more\n", len(events)-3)
-			}
-			response += "\n"
 		}
+		if len(events) > 3 {
+			response += telegramText(ctx, msgAndMore, TelegramArgs{"count": len(events) - 3})
+		}
+		if reminders > 0 {
+			response += telegramText(ctx, msgTodayReminders, TelegramArgs{"count": reminders})
+		}
+		response += "\n"
 	}
 
 	// Get recent notes (today)
 	var notes []models.Note
-	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	if err := ts.db.WithContext(ctx).Where("user_id = ? AND created_at >= ?", userID, startOfDay).
+	if err := ts.db.WithContext(ctx).Scopes(models.NotTrashed).Select(NoteListFields).Where("user_id = ? AND created_at >= ?", userID, startOfDay).
 		Order("created_at DESC").Limit(3).Find(&notes).Error; err != nil {
 		log.Printf("Failed to get today's notes: %v", err)
 	} else if len(notes) > 0 {
-		response += fmt.Sprintf("📝 *Today's Notes:* %d created\n", len(notes))
+		response += telegramText(ctx, msgTodayNotes, TelegramArgs{"count": len(notes)})
 		for _, note := range notes {
-			preview := note.Title
-			if len(preview) > 40 {
-				preview = preview[:40] + "..."
+			response += telegramText(ctx, msgListItem, TelegramArgs{"item": telegramNotePreview(note, 40, 60)})
+		}
+		response += "\n"
+	}
+
+	// Notebooks that changed since they were last visited
+	if counts, err := NotebookChangeCounts(ctx, ts.db, userID); err != nil {
+		log.Printf("Failed to get notebook changes: %v", err)
+	} else if len(counts) > 0 {
+		response += telegramText(ctx, msgTodayWhatsNew, nil)
+		for i, count := range counts {
+			if i < 3 {
+				response += telegramText(ctx, msgTodayNotebook, TelegramArgs{"name": count.Name, "count": count.Changes})
 			}
-			response += fmt.Sprintf("• %s\n", preview)
+		}
+		if len(counts) > 3 {
+			response += telegramText(ctx, msgTodayMoreNotebook, TelegramArgs{"count": len(counts) - 3})
 		}
 		response += "\n"
 	}
 
-	response += "💡 *Quick Actions:*\n"
-	response += "• Type a message to create a note\n"
-	response += "• `/recent` - See recent activity\n"
-	response += "• `/stats` - View productivity stats"
+	response += telegramText(ctx, msgTodayActions, nil)
 
 	return response
 }
@@ -1141,29 +1345,24 @@ func (ts *TelegramService) handleTodayCommand(ctx context.Context, userID uuid.U
 func (ts *TelegramService) handleRecentCommand(ctx context.Context, userID uuid.UUID, args []string) string {
 	limit := 10
 	if len(args) > 0 {
-		if l, err := strconv.Atoi(args[0]); err == nil && l > 0 && l <= 50 {
-			limit = l
+		if l, err := strconv.Atoi(args[0]); err == nil && l > 0 {
+			limit = min(l, ts.limits.withDefaults().RecentMax)
 		}
 	}
 
-	response := fmt.Sprintf("📋 *Recent Activity (last %d items)*\n\n", limit)
+	response := telegramText(ctx, msgRecentHeader, TelegramArgs{"count": limit})
 
 	// Get recent notes
 	var notes []models.Note
-	if err := ts.db.WithContext(ctx).Where("user_id = ?", userID).
-		Order("updated_at DESC").Limit(limit/2).Find(&notes).Error; err == nil {
+	if err := ts.db.WithContext(ctx).Scopes(models.NotTrashed).Select(NoteListFields).Where("user_id = ?", userID).
+		Order("updated_at DESC").Limit((limit+1)/2).Find(&notes).Error; err == nil {
 		
 		if len(notes) > 0 {
-			response += "📝 *Recent Notes:*\n"
-			for i, note := range notes {
-				if i >= 5 { break } // Limit to 5
-				age := time.Since(note.UpdatedAt)
+			response += telegramText(ctx, msgRecentNotes, nil)
+			for _, note := range notes {
+				age := ts.now().Sub(note.UpdatedAt)
 				ageStr := formatDuration(age)
-				preview := note.Title
-				if len(preview) > 45 {
-					preview = preview[:45] + "..."
-				}
-				response += fmt.Sprintf("• %s (%s ago)\n", preview, ageStr)
+				response += telegramText(ctx, msgRecentNote, TelegramArgs{"note": telegramNotePreview(note, 45, 60), "age": ageStr})
 			}
 			response += "\n"
 		}
@@ -1171,20 +1370,19 @@ func (ts *TelegramService) handleRecentCommand(ctx context.Context, userID uuid.
 
 	// Get recent tasks
 	var tasks []models.Task
-	if err := ts.db.WithContext(ctx).Where("user_id = ?", userID).
+	if err := ts.db.WithContext(ctx).Scopes(models.NotTrashed).Select(TaskListFields).Where("user_id = ?", userID).
 		Order("updated_at DESC").Limit(limit/2).Find(&tasks).Error; err == nil {
 		
 		if len(tasks) > 0 {
-			response += "✅ *Recent Tasks:*\n"
-			for i, task := range tasks {
-				if i >= 5 { break } // Limit to 5
-				age := time.Since(task.UpdatedAt)
+			response += telegramText(ctx, msgRecentTasks, nil)
+			for _, task := range tasks {
+				age := ts.now().Sub(task.UpdatedAt)
 				ageStr := formatDuration(age)
 				status := "⏳"
 				if task.IsCompleted {
 					status = "✅"
 				}
-				response += fmt.Sprintf("• %s %s (%s ago)\n", status, task.Title, ageStr)
+				response += telegramText(ctx, msgRecentTask, TelegramArgs{"status": status, "title": task.Title, "age": ageStr})
 			}
 		}
 	}
@@ -1201,33 +1399,33 @@ func (ts *TelegramService) handleStatsCommand(ctx context.Context, userID uuid.U
 
 	var startDate time.Time
 	var periodName string
-	now := time.Now()
+	now := ts.now()
 
 	if period == "week" {
 		startDate = now.AddDate(0, 0, -7)
-		periodName = "Past 7 days"
+		periodName = telegramText(ctx, msgStatsWeek, nil)
 	} else {
 		startDate = now.AddDate(0, -1, 0)
-		periodName = "Past 30 days"
+		periodName = telegramText(ctx, msgStatsMonth, nil)
 	}
 
-	response := fmt.Sprintf("📊 *Productivity Stats - %s*\n\n", periodName)
+	response := telegramText(ctx, msgStatsHeader, TelegramArgs{"period": telegramMarkup(periodName)})
 
 	// Count notes created
 	var notesCount int64
-	ts.db.WithContext(ctx).Model(&models.Note{}).
+	ts.db.WithContext(ctx).Model(&models.Note{}).Scopes(models.NotTrashed).
 		Where("user_id = ? AND created_at >= ?", userID, startDate).
 		Count(&notesCount)
 
 	// Count tasks completed
 	var tasksCompleted int64
-	ts.db.WithContext(ctx).Model(&models.Task{}).
+	ts.db.WithContext(ctx).Model(&models.Task{}).Scopes(models.NotTrashed).
 		Where("user_id = ? AND is_completed = true AND updated_at >= ?", userID, startDate).
 		Count(&tasksCompleted)
 
 	// Count total tasks
 	var totalTasks int64
-	ts.db.WithContext(ctx).Model(&models.Task{}).
+	ts.db.WithContext(ctx).Model(&models.Task{}).Scopes(models.NotTrashed).
 		Where("user_id = ? AND created_at >= ?", userID, startDate).
 		Count(&totalTasks)
 
@@ -1238,161 +1436,238 @@ func (ts *TelegramService) handleStatsCommand(ctx context.Context, userID uuid.U
 		eventsCount = 0 // Placeholder
 	}
 
-	response += fmt.Sprintf("📝 *Notes Created:* %d\n", notesCount)
-	response += fmt.Sprintf("✅ *Tasks Completed:* %d", tasksCompleted)
+	response += telegramText(ctx, msgStatsNotes, TelegramArgs{"count": notesCount})
+	response += telegramText(ctx, msgStatsTasks, TelegramArgs{"count": tasksCompleted})
 	if totalTasks > 0 {
 		completionRate := float64(tasksCompleted) / float64(totalTasks) * 100
-		response += fmt.Sprintf(" (%.1f%% completion rate)", completionRate)
+		response += telegramText(ctx, msgStatsCompletion, TelegramArgs{"rate": fmt.Sprintf("%.1f", completionRate)})
 	}
 	response += "\n"
 	
 	if eventsCount > 0 {
-		response += fmt.Sprintf("📅 *Calendar Events:* %d\n", eventsCount)
+		response += telegramText(ctx, msgStatsEvents, TelegramArgs{"count": eventsCount})
 	}
 
 	// Calculate daily averages
-	days := int(time.Since(startDate).Hours() / 24)
+	days := int(now.Sub(startDate).Hours() / 24)
 	if days == 0 {
 		days = 1
 	}
 	
-	response += "\n📈 *Daily Averages:*\n"
-	response += fmt.Sprintf("• %.1f notes per day\n", float64(notesCount)/float64(days))
-	response += fmt.Sprintf("• %.1f tasks completed per day\n", float64(tasksCompleted)/float64(days))
+	response += telegramText(ctx, msgStatsAverages, TelegramArgs{
+		"notes": fmt.Sprintf("%.1f", float64(notesCount)/float64(days)),
+		"tasks": fmt.Sprintf("%.1f", float64(tasksCompleted)/float64(days)),
+	})
 
 	// Productivity insights
-	response += "\n💡 *Insights:*\n"
+	response += telegramText(ctx, msgStatsInsights, nil)
 	if notesCount > 0 && tasksCompleted > 0 {
-		response += "• Great balance of note-taking and task completion! 🎯\n"
+		response += telegramText(ctx, msgInsightBalanced, nil)
 	} else if notesCount > tasksCompleted*2 {
-		response += "• Lots of notes created! Consider converting ideas to actionable tasks 📋\n"
+		response += telegramText(ctx, msgInsightNotes, nil)
 	} else if tasksCompleted > notesCount*2 {
-		response += "• High task completion rate! Consider documenting your learnings 📝\n"
+		response += telegramText(ctx, msgInsightTasks, nil)
 	}
 
 	return response
 }
 
-// handleExportCommand exports user content
+// handleExportCommand exports user content, one page of at most
+// ExportPageSize notes or tasks at a time
 func (ts *TelegramService) handleExportCommand(ctx context.Context, userID uuid.UUID, args []string) string {
 	if len(args) == 0 {
-		return "❌ Usage: `/export <type> [timeframe]`\n\n" +
-			"Types: notes, tasks, all\n" +
-			"Timeframe: today, week, month, all\n\n" +
-			"Example: `/export notes week`"
+		return telegramText(ctx, msgExportUsage, nil)
 	}
 
 	exportType := args[0]
+	if exportType == "chat" {
+		return ts.handleChatExport(ctx, userID, args[1:])
+	}
 	timeframe := "all"
 	if len(args) > 1 {
 		timeframe = args[1]
 	}
+	page := 1
+	if len(args) > 2 {
+		p, err := strconv.Atoi(args[2])
+		if err != nil || p < 1 {
+			return telegramText(ctx, msgExportBadPage, nil)
+		}
+		page = p
+	}
+	pageSize := ts.limits.withDefaults().ExportPageSize
 
 	// Generate export based on type
 	var content string
+	var total int64
 	var err error
 
 	switch exportType {
 	case "notes":
-		content, err = ts.generateNotesExport(ctx, userID, timeframe)
+		content, total, err = ts.generateNotesExport(ctx, userID, timeframe, page, pageSize)
 	case "tasks":
-		content, err = ts.generateTasksExport(ctx, userID, timeframe)
+		content, total, err = ts.generateTasksExport(ctx, userID, timeframe, page, pageSize)
 	case "all":
-		notesContent, _ := ts.generateNotesExport(ctx, userID, timeframe)
-		tasksContent, _ := ts.generateTasksExport(ctx, userID, timeframe)
+		notesContent, notesTotal, _ := ts.generateNotesExport(ctx, userID, timeframe, page, pageSize)
+		tasksContent, tasksTotal, _ := ts.generateTasksExport(ctx, userID, timeframe, page, pageSize)
 		content = fmt.Sprintf("# Complete Export\n\n%s\n\n%s", notesContent, tasksContent)
+		total = notesTotal
+		if tasksTotal > total {
+			total = tasksTotal
+		}
 	default:
-		return "❌ Unknown export type. Use: notes, tasks, or all"
+		return telegramText(ctx, msgExportUnknownType, nil)
 	}
 
 	if err != nil {
-		return fmt.Sprintf("❌ Export failed: %v", err)
+		return telegramText(ctx, msgExportFailed, TelegramArgs{"error": err})
+	}
+
+	pages := int((total + int64(pageSize) - 1) / int64(pageSize))
+	if pages == 0 {
+		pages = 1
+	}
+	if page > pages {
+		return telegramText(ctx, msgExportPastEnd, TelegramArgs{"page": page, "pages": pages})
 	}
 
-	// For now, return summary (in production, you'd want to upload file)
-	lines := strings.Split(content, "\n")
-	summary := fmt.Sprintf("📦 *Export Complete*\n\n" +
-		"Type: %s\n" +
-		"Timeframe: %s\n" +
-		"Content: %d lines\n\n" +
-		"Preview:\n```\n%s\n```\n\n" +
-		"📧 Full export would be sent via email or file upload.",
-		exportType, timeframe, len(lines), 
-		strings.Join(lines[:min(len(lines), 10)], "\n"))
+	// Long exports are split into several messages when sent
+	summary := telegramText(ctx, msgExportComplete, TelegramArgs{
+		"type":      exportType,
+		"timeframe": timeframe,
+		"page":      page,
+		"pages":     pages,
+		"content":   strings.TrimSpace(content),
+	})
+	if page < pages {
+		summary += telegramText(ctx, msgExportNextPage, TelegramArgs{"type": exportType, "timeframe": timeframe, "next": page + 1})
+	}
 
 	return summary
 }
 
+// handleChatExport sends a chat session as a Markdown transcript
+func (ts *TelegramService) handleChatExport(ctx context.Context, userID uuid.UUID, args []string) string {
+	if len(args) == 0 {
+		return telegramText(ctx, msgChatExportUsage, nil)
+	}
+
+	transcript, err := NewChatService(ts.db, ts.aiService, nil).ExportChatSession(ctx, userID, args[0])
+	if errors.Is(err, ErrNotFound) {
+		return telegramText(ctx, msgChatExportMissing, TelegramArgs{"session": args[0]})
+	}
+	if err != nil {
+		return telegramText(ctx, msgExportFailed, TelegramArgs{"error": err})
+	}
+
+	// Long transcripts are split into several messages when sent
+	return telegramText(ctx, msgChatExport, TelegramArgs{
+		"session":    transcript.SessionID,
+		"count":      transcript.Messages,
+		"transcript": strings.TrimSpace(transcript.Markdown),
+	})
+}
+
 // handleSyncCommand forces synchronization with external services
 func (ts *TelegramService) handleSyncCommand(ctx context.Context, userID uuid.UUID, args []string) string {
 	if len(args) == 0 {
-		return "❌ Usage: `/sync <service>`\n\n" +
-			"Services: calendar, all\n\n" +
-			"Example: `/sync calendar`"
+		return telegramText(ctx, msgSyncUsage, nil)
 	}
 
 	service := args[0]
-	response := fmt.Sprintf("🔄 *Sync Started - %s*\n\n", service)
+	response := telegramText(ctx, msgSyncStarted, TelegramArgs{"service": service})
 
 	switch service {
 	case "calendar":
 		if ts.calendarService == nil {
-			return "❌ Calendar service not available"
+			return telegramText(ctx, msgSyncNoCalendar, nil)
 		}
 		
 		// Trigger calendar sync  
-		err := ts.calendarService.SyncAllCalendars(ctx, userID)
+		results, err := ts.calendarService.SyncAllCalendars(ctx, userID)
 		if err != nil {
-			return fmt.Sprintf("❌ Calendar sync failed: %v", err)
+			return telegramText(ctx, msgSyncCalendarFailed, TelegramArgs{"error": err})
 		}
-		response += "✅ Calendar synchronization completed successfully"
+		response += formatCalendarSyncResults(ctx, results)
 		
 	case "all":
 		// Sync all available services
 		synced := []string{}
 		failed := []string{}
+		breakdown := ""
 		
 		if ts.calendarService != nil {
-			if err := ts.calendarService.SyncAllCalendars(ctx, userID); err != nil {
+			results, err := ts.calendarService.SyncAllCalendars(ctx, userID)
+			if err != nil || !anyCalendarSynced(results) {
 				failed = append(failed, "calendar")
 			} else {
 				synced = append(synced, "calendar")
 			}
+			if len(results) > 0 {
+				breakdown = telegramText(ctx, msgSyncCalendars, nil) + formatCalendarSyncResults(ctx, results)
+			}
 		}
 		
 		if len(synced) > 0 {
-			response += fmt.Sprintf("✅ Synced: %s\n", strings.Join(synced, ", "))
+			response += telegramText(ctx, msgSyncSynced, TelegramArgs{"services": strings.Join(synced, ", ")})
 		}
 		if len(failed) > 0 {
-			response += fmt.Sprintf("❌ Failed: %s\n", strings.Join(failed, ", "))
+			response += telegramText(ctx, msgSyncFailed, TelegramArgs{"services": strings.Join(failed, ", ")})
 		}
 		if len(synced) == 0 && len(failed) == 0 {
-			response += "ℹ️ No external services configured for sync"
+			response += telegramText(ctx, msgSyncNothing, nil)
 		}
+		response += breakdown
 		
 	default:
-		return fmt.Sprintf("❌ Unknown service: %s\nAvailable: calendar, all", service)
+		return telegramText(ctx, msgSyncUnknownService, TelegramArgs{"service": service})
 	}
 
 	return response
 }
 
+// formatCalendarSyncResults renders a line per calendar, e.g.
+// "✅ Work: 12 events" or "❌ Personal: token expired"
+func formatCalendarSyncResults(ctx context.Context, results []CalendarSyncResult) string {
+	var b strings.Builder
+	for _, result := range results {
+		name := result.CalendarName
+		if name == "" {
+			name = result.CalendarID
+		}
+		if result.Error != "" {
+			b.WriteString(telegramText(ctx, msgCalendarSyncError, TelegramArgs{"calendar": name, "error": result.Error}))
+			continue
+		}
+		id := msgCalendarSyncedCount
+		if result.Synced == 1 {
+			id = msgCalendarSyncedOne
+		}
+		b.WriteString(telegramText(ctx, id, TelegramArgs{"calendar": name, "count": result.Synced}))
+	}
+	return b.String()
+}
+
+// anyCalendarSynced tells whether at least one calendar synced
+func anyCalendarSynced(results []CalendarSyncResult) bool {
+	for _, result := range results {
+		if result.Error == "" {
+			return true
+		}
+	}
+	return false
+}
+
 // handleBackupCommand creates a data backup
 func (ts *TelegramService) handleBackupCommand(ctx context.Context, userID uuid.UUID) string {
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
+	timestamp := ts.now().Format("2006-01-02_15-04-05")
 	
 	// Count user data
 	var notesCount, tasksCount int64
-	ts.db.WithContext(ctx).Model(&models.Note{}).Where("user_id = ?", userID).Count(&notesCount)
-	ts.db.WithContext(ctx).Model(&models.Task{}).Where("user_id = ?", userID).Count(&tasksCount)
+	ts.db.WithContext(ctx).Model(&models.Note{}).Scopes(models.NotTrashed).Where("user_id = ?", userID).Count(&notesCount)
+	ts.db.WithContext(ctx).Model(&models.Task{}).Scopes(models.NotTrashed).Where("user_id = ?", userID).Count(&tasksCount)
 
-	response := fmt.Sprintf("💾 *Backup Created*\n\n" +
-		"Timestamp: %s\n" +
-		"Notes: %d\n" +
-		"Tasks: %d\n\n" +
-		"✅ Your data has been backed up successfully!\n\n" +
-		"📧 Backup file would be available for download or sent via email.",
-		timestamp, notesCount, tasksCount)
+	response := telegramText(ctx, msgBackupCreated, TelegramArgs{"timestamp": timestamp, "notes": notesCount, "tasks": tasksCount})
 
 	// In production, you would:
 	// 1. Create actual backup file (JSON, SQL dump, etc.)
@@ -1404,46 +1679,60 @@ func (ts *TelegramService) handleBackupCommand(ctx context.Context, userID uuid.
 
 // Helper functions
 
-func (ts *TelegramService) generateNotesExport(ctx context.Context, userID uuid.UUID, timeframe string) (string, error) {
-	query := ts.db.WithContext(ctx).Where("user_id = ?", userID)
+// generateNotesExport renders one page of the user's notes and returns the
+// number of notes in the timeframe
+func (ts *TelegramService) generateNotesExport(ctx context.Context, userID uuid.UUID, timeframe string, page, pageSize int) (string, int64, error) {
+	query := ts.db.WithContext(ctx).Model(&models.Note{}).Scopes(models.NotTrashed).Where("user_id = ?", userID)
 	
 	// Apply timeframe filter
 	if timeframe != "all" {
-		startDate := getTimeframeStart(timeframe)
+		startDate := getTimeframeStart(ts.now(), timeframe)
 		if !startDate.IsZero() {
 			query = query.Where("created_at >= ?", startDate)
 		}
 	}
 	
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return "", 0, err
+	}
 	var notes []models.Note
-	if err := query.Order("created_at DESC").Find(&notes).Error; err != nil {
-		return "", err
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&notes).Error; err != nil {
+		return "", 0, err
 	}
 
 	content := "# Notes Export\n\n"
 	for _, note := range notes {
 		content += fmt.Sprintf("## %s\n\n", note.Title)
 		content += fmt.Sprintf("Created: %s\n\n", note.CreatedAt.Format("2006-01-02 15:04"))
-		// In a real implementation, you'd include the note content from blocks
+		if preview := PreviewText(note, telegramExportPreviewChars); preview != "" {
+			content += preview + "\n\n"
+		}
 		content += "---\n\n"
 	}
 	
-	return content, nil
+	return content, total, nil
 }
 
-func (ts *TelegramService) generateTasksExport(ctx context.Context, userID uuid.UUID, timeframe string) (string, error) {
-	query := ts.db.WithContext(ctx).Where("user_id = ?", userID)
+// generateTasksExport renders one page of the user's tasks and returns the
+// number of tasks in the timeframe
+func (ts *TelegramService) generateTasksExport(ctx context.Context, userID uuid.UUID, timeframe string, page, pageSize int) (string, int64, error) {
+	query := ts.db.WithContext(ctx).Model(&models.Task{}).Scopes(models.NotTrashed).Where("user_id = ?", userID)
 	
 	if timeframe != "all" {
-		startDate := getTimeframeStart(timeframe)
+		startDate := getTimeframeStart(ts.now(), timeframe)
 		if !startDate.IsZero() {
 			query = query.Where("created_at >= ?", startDate)
 		}
 	}
 	
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return "", 0, err
+	}
 	var tasks []models.Task
-	if err := query.Order("created_at DESC").Find(&tasks).Error; err != nil {
-		return "", err
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&tasks).Error; err != nil {
+		return "", 0, err
 	}
 
 	content := "# Tasks Export\n\n"
@@ -1457,11 +1746,11 @@ func (ts *TelegramService) generateTasksExport(ctx context.Context, userID uuid.
 			task.Title, status)
 	}
 	
-	return content, nil
+	return content, total, nil
 }
 
-func getTimeframeStart(timeframe string) time.Time {
-	now := time.Now()
+// getTimeframeStart returns when an /export timeframe starts, as of now
+func getTimeframeStart(now time.Time, timeframe string) time.Time {
 	switch timeframe {
 	case "today":
 		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
@@ -1503,7 +1792,9 @@ func (ts *TelegramService) getDefaultUserID(ctx context.Context) (uuid.UUID, err
 	return user.ID, nil
 }
 
-// sendMessage sends a message to the configured Telegram chat with timeout protection
+// sendMessage sends a reply rendered from the message catalog to the configured
+// Telegram chat with timeout protection. Replies over Telegram's length limit
+// are sent as several messages.
 func (ts *TelegramService) sendMessage(text string) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -1511,47 +1802,39 @@ func (ts *TelegramService) sendMessage(text string) {
 		}
 	}()
 
-	msg := tgbotapi.NewMessage(ts.allowedChatID, text)
-	msg.ParseMode = "Markdown"
-	
-	// Create a context with timeout for the send operation
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // Reduced to minimize context goroutines
-	defer cancel()
-	
-	// Use a goroutine with timeout to prevent blocking
-	done := make(chan error, 1)
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				done <- fmt.Errorf("panic in send: %v", r)
-			}
-		}()
-		_, err := ts.bot.Send(msg)
-		done <- err
-	}()
-	
-	select {
-	case err := <-done:
-		if err != nil {
+	for _, chunk := range splitTelegramMessage(text, telegramMessageChunkSize) {
+		if err := ts.sendChunk(chunk, telegramParseMode); err != nil {
 			log.Printf("Failed to send Telegram message: %v", err)
+			return
 		}
-	case <-ctx.Done():
-		log.Printf("Telegram message send timeout")
 	}
 }
 
-// SendNotification sends a notification to Telegram (can be used by other services)
-func (ts *TelegramService) SendNotification(message string) error {
+// SendNotification sends a notification to Telegram (can be used by other
+// services). The message is read as Telegram's legacy Markdown, so callers
+// don't have to escape it for MarkdownV2.
+func (ts *TelegramService) SendNotification(message string) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("Telegram SendNotification panic recovered: %v", r)
+			err = fmt.Errorf("panic in send notification: %v", r)
 		}
 	}()
 
-	msg := tgbotapi.NewMessage(ts.allowedChatID, message)
-	msg.ParseMode = "Markdown"
+	for _, chunk := range splitTelegramMessage(message, telegramMessageChunkSize) {
+		if err := ts.sendChunk(chunk, "Markdown"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendChunk sends a single message that fits Telegram's length limit
+func (ts *TelegramService) sendChunk(text, parseMode string) error {
+	msg := tgbotapi.NewMessage(ts.allowedChatID, text)
+	msg.ParseMode = parseMode
 	
-	// Create a context with timeout
+	// Create a context with timeout for the send operation
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // Reduced to minimize context goroutines
 	defer cancel()
 	
@@ -1560,7 +1843,7 @@ func (ts *TelegramService) SendNotification(message string) error {
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				done <- fmt.Errorf("panic in send notification: %v", r)
+				done <- fmt.Errorf("panic in send: %v", r)
 			}
 		}()
 		_, err := ts.bot.Send(msg)
@@ -1571,6 +1854,6 @@ func (ts *TelegramService) SendNotification(message string) error {
 	case err := <-done:
 		return err
 	case <-ctx.Done():
-		return fmt.Errorf("telegram notification send timeout")
+		return fmt.Errorf("telegram message send timeout")
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleStatsCommand_ExcludesTrashed(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "notes" WHERE \(user_id = \$1 AND created_at >= \$2\) AND "notes"."deleted_at" IS NULL$`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "tasks" WHERE \(user_id = \$1 AND is_completed = true AND updated_at >= \$2\) AND "tasks"."deleted_at" IS NULL$`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "tasks" WHERE \(user_id = \$1 AND created_at >= \$2\) AND "tasks"."deleted_at" IS NULL$`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+
+	ts := &TelegramService{db: db.DB}
+	response := ts.handleStatsCommand(context.Background(), userID, nil)
+
+	assert.Contains(t, response, "*Notes Created:* 2")
+	assert.Contains(t, response, "*Tasks Completed:* 1")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleRecentCommand_ExcludesTrashed(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT "id",.*,"updated_at" FROM "notes" WHERE user_id = \$1 AND "notes"."deleted_at" IS NULL ORDER BY updated_at DESC LIMIT \$2$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "updated_at"}).
+			AddRow(uuid.New().String(), userID.String(), "Live note", now))
+	mock.ExpectQuery(`SELECT "id",.*,"updated_at" FROM "tasks" WHERE user_id = \$1 AND "tasks"."deleted_at" IS NULL ORDER BY updated_at DESC LIMIT \$2$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "updated_at"}))
+
+	ts := &TelegramService{db: db.DB}
+	response := ts.handleRecentCommand(context.Background(), userID, []string{"4"})
+
+	assert.Contains(t, response, "Live note")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPreviewClassification_ReturnsAIAndFallback(t *testing.T) {
+	aiService, prompt := newStubAIService(t, `{"type":"calendar","confidence":0.92,"extracted_data":{"title":"Dentist","date":"tomorrow","time":"3pm"},"reasoning":"Names a time for an appointment"}`)
+	ts := &TelegramService{aiService: aiService}
+
+	preview, err := ts.PreviewClassification(context.Background(), "Need to see the dentist tomorrow at 3pm")
+	assert.NoError(t, err)
+	assert.Contains(t, *prompt, "Need to see the dentist tomorrow at 3pm")
+
+	assert.False(t, preview.AIFellBack)
+	assert.Equal(t, "calendar", preview.AI.Type)
+	assert.Equal(t, 0.92, preview.AI.Confidence)
+	assert.Equal(t, "Dentist", preview.AI.ExtractedData["title"])
+	assert.Equal(t, "Names a time for an appointment", preview.AI.Reasoning)
+
+	assert.Equal(t, "calendar", preview.Fallback.Type)
+	assert.Equal(t, 0.7, preview.Fallback.Confidence)
+	assert.Equal(t, "Contains calendar-related keywords", preview.Fallback.Reasoning)
+}
+
+func TestFormatStoredExecutionResults_ShortensByCharacters(t *testing.T) {
+	// Cutting by bytes would split a character and leave invalid UTF-8
+	value := strings.Repeat("Привет", 60)
+	response := formatStoredExecutionResults(context.Background(), &ChainExecutionResults{
+		ChainID: "chain",
+		Status:  "completed",
+		Results: models.AIMetadata{"summary": value},
+	})
+	assert.True(t, utf8.ValidString(response))
+	assert.Contains(t, response, string([]rune(value)[:300])+`\.\.\.`)
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// telegramClassifyLimiter bounds the LLM classifications inbound messages
+// trigger. At most Concurrency classifications run at once over all chats, a
+// chat has at most ChatInFlight messages being handled, and the
+// classifications of one chat start ClassifyInterval apart so a burst is
+// spread out instead of fanning out. Classifications also hold a shared LLM
+// call slot.
+type telegramClassifyLimiter struct {
+	slots    chan struct{}
+	perChat  int
+	interval time.Duration
+	clock    Clock
+	wait     func(ctx context.Context, d time.Duration) error
+
+	mu        sync.Mutex
+	inFlight  map[int64]int
+	nextStart map[int64]time.Time
+}
+
+func newTelegramClassifyLimiter(limits TelegramLimits, wait func(ctx context.Context, d time.Duration) error) *telegramClassifyLimiter {
+	limits = limits.withDefaults()
+	if wait == nil {
+		wait = waitFor
+	}
+	return &telegramClassifyLimiter{
+		slots:     make(chan struct{}, limits.ClassifyConcurrency),
+		perChat:   limits.ChatInFlight,
+		interval:  limits.ClassifyInterval,
+		clock:     SystemClock,
+		wait:      wait,
+		inFlight:  make(map[int64]int),
+		nextStart: make(map[int64]time.Time),
+	}
+}
+
+func (l *telegramClassifyLimiter) now() time.Time {
+	return clockNow(l.clock)
+}
+
+// admit reserves an in-flight place for a message of the chat. Returns false
+// when the chat has ChatInFlight messages being handled already.
+func (l *telegramClassifyLimiter) admit(chatID int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[chatID] >= l.perChat {
+		return false
+	}
+	l.inFlight[chatID]++
+	return true
+}
+
+// done frees the place admit reserved
+func (l *telegramClassifyLimiter) done(chatID int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[chatID] <= 1 {
+		delete(l.inFlight, chatID)
+		delete(l.nextStart, chatID)
+		return
+	}
+	l.inFlight[chatID]--
+}
+
+// acquire waits for the chat's turn and a free classification slot. The
+// returned func frees the slot.
+func (l *telegramClassifyLimiter) acquire(ctx context.Context, chatID int64) (func(), error) {
+	if delay := l.reserveStart(chatID); delay > 0 {
+		if err := l.wait(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// reserveStart books the chat's next classification start and returns how
+// long to wait for it
+func (l *telegramClassifyLimiter) reserveStart(chatID int64) time.Duration {
+	if l.interval <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	start := l.nextStart[chatID]
+	if start.Before(now) {
+		start = now
+	}
+	l.nextStart[chatID] = start.Add(l.interval)
+	return start.Sub(now)
+}
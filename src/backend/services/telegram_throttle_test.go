@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyChatMessage_BurstStaysUnderCap(t *testing.T) {
+	var running, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		now := atomic.AddInt32(&running, 1)
+		for {
+			seen := atomic.LoadInt32(&peak)
+			if now <= seen || atomic.CompareAndSwapInt32(&peak, seen, now) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": `{"type":"note","confidence":0.9}`}},
+		})
+	}))
+	defer server.Close()
+
+	ts := &TelegramService{
+		aiService: &AIService{
+			anthropicKey:     "test-key",
+			anthropicBaseURL: server.URL,
+			httpClient:       server.Client(),
+			health:           aiHealth{ttl: time.Minute},
+		},
+		limits: TelegramLimits{ClassifyConcurrency: 3, ChatInFlight: 20},
+	}
+
+	var wg sync.WaitGroup
+	var classified int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			intent, err := ts.classifyChatMessage(context.Background(), 42, "remember to buy milk")
+			if assert.NoError(t, err) && assert.Equal(t, "note", intent.Type) {
+				atomic.AddInt32(&classified, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(20), classified)
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(3))
+	assert.Positive(t, atomic.LoadInt32(&peak))
+}
+
+func TestTelegramClassifyLimiter_TurnsAwayBeyondChatInFlight(t *testing.T) {
+	limiter := newTelegramClassifyLimiter(TelegramLimits{ChatInFlight: 2}, nil)
+
+	assert.True(t, limiter.admit(1))
+	assert.True(t, limiter.admit(1))
+	assert.False(t, limiter.admit(1))
+	// Other chats have their own limit
+	assert.True(t, limiter.admit(2))
+
+	limiter.done(1)
+	assert.True(t, limiter.admit(1))
+}
+
+func TestTelegramClassifyLimiter_SpacesBurstOfAChat(t *testing.T) {
+	now := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	limiter := newTelegramClassifyLimiter(TelegramLimits{ClassifyConcurrency: 10, ClassifyInterval: 100 * time.Millisecond},
+		func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		})
+	limiter.clock = NewFakeClock(now)
+
+	for i := 0; i < 3; i++ {
+		release, err := limiter.acquire(context.Background(), 1)
+		require.NoError(t, err)
+		release()
+	}
+	release, err := limiter.acquire(context.Background(), 2)
+	require.NoError(t, err)
+	release()
+
+	// The first message of each chat goes straight away
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, waits)
+}
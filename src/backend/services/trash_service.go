@@ -61,6 +61,7 @@ func (s *TrashService) RestoreItem(db *database.Database, itemType, itemID, user
 	}
 
 	var eventType, entityType string
+	eventData := map[string]interface{}{"user_id": userID}
 
 	// Handle different item types
 	switch itemType {
@@ -88,6 +89,13 @@ func (s *TrashService) RestoreItem(db *database.Database, itemType, itemID, user
 				blockID, models.BlockResource)
 		}
 
+		// Event consumers filter note events by notebook
+		var restored models.Note
+		if err := tx.Select("notebook_id", "title").Where("id = ?", parsedItemID).Take(&restored).Error; err == nil {
+			eventData["notebook_id"] = restored.NotebookID.String()
+			eventData["title"] = restored.Title
+		}
+
 		eventType = "note.restored"
 		entityType = "note"
 
@@ -137,12 +145,11 @@ func (s *TrashService) RestoreItem(db *database.Database, itemType, itemID, user
 	}
 
 	// Create an event for the restore action
+	eventData[fmt.Sprintf("%s_id", entityType)] = itemID
 	event, err := models.NewEvent(
 		eventType,
 		entityType,
-		map[string]interface{}{
-			fmt.Sprintf("%s_id", entityType): itemID,
-		},
+		eventData,
 	)
 
 	if err != nil {
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Resources with a per-user limit
+const (
+	UsageNotes         = "notes"
+	UsageNotebooks     = "notebooks"
+	UsageBlocksPerNote = "blocks_per_note"
+)
+
+// usageLimitEnvs are read as USAGE_MAX_<NAME> for the hard limit and
+// USAGE_MAX_<NAME>_SOFT for the soft limit
+var usageLimitEnvs = map[string]string{
+	UsageNotes:         "USAGE_MAX_NOTES",
+	UsageNotebooks:     "USAGE_MAX_NOTEBOOKS",
+	UsageBlocksPerNote: "USAGE_MAX_BLOCKS_PER_NOTE",
+}
+
+// UsageLimit bounds how many of a resource a user can have. Creating past
+// the hard limit fails; going past the soft limit only warns. Zero means no
+// limit.
+type UsageLimit struct {
+	Soft int64 `json:"soft_limit"`
+	Hard int64 `json:"hard_limit"`
+}
+
+// LimitExceededError is returned when a creation would pass a hard limit. It
+// matches ErrLimitExceeded.
+type LimitExceededError struct {
+	Resource string
+	Limit    int64
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("%s limit of %d reached", e.Resource, e.Limit)
+}
+
+func (e *LimitExceededError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// CurrentUsageLimit reads the limits of resource from the environment
+func CurrentUsageLimit(resource string) UsageLimit {
+	env := usageLimitEnvs[resource]
+	return UsageLimit{
+		Soft: readUsageLimit(env + "_SOFT"),
+		Hard: readUsageLimit(env),
+	}
+}
+
+func readUsageLimit(env string) int64 {
+	if value, err := strconv.ParseInt(os.Getenv(env), 10, 64); err == nil && value > 0 {
+		return value
+	}
+	return 0
+}
+
+// checkUsageLimit is called before one more of resource is created, with
+// the number the user has now. It fails at the hard limit and warns the
+// user once, when the creation goes past the soft limit.
+func checkUsageLimit(userID uuid.UUID, resource string, limit UsageLimit, current int64) error {
+	if limit.Hard > 0 && current >= limit.Hard {
+		return &LimitExceededError{Resource: resource, Limit: limit.Hard}
+	}
+	if limit.Soft > 0 && current == limit.Soft {
+		log.Printf("User %s passed the soft %s limit of %d", userID, resource, limit.Soft)
+		message := fmt.Sprintf("You have more than %d %s. Creating more stops at %d.", limit.Soft, usageLabel(resource), limit.Hard)
+		if limit.Hard == 0 {
+			message = fmt.Sprintf("You have more than %d %s.", limit.Soft, usageLabel(resource))
+		}
+		if err := NotificationServiceInstance.PublishNotification(userID.String(), "usage.soft_limit_reached", message, time.Now().Format(time.RFC3339)); err != nil {
+			log.Printf("Failed to notify user %s about the %s limit: %v", userID, resource, err)
+		}
+	}
+	return nil
+}
+
+func usageLabel(resource string) string {
+	if resource == UsageBlocksPerNote {
+		return "blocks in a note"
+	}
+	return resource
+}
+
+// checkNoteLimit checks that the user can create another note
+func checkNoteLimit(db *gorm.DB, userID uuid.UUID) error {
+	limit := CurrentUsageLimit(UsageNotes)
+	if limit == (UsageLimit{}) {
+		return nil
+	}
+	var count int64
+	if err := db.Model(&models.Note{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	return checkUsageLimit(userID, UsageNotes, limit, count)
+}
+
+// checkNotebookLimit checks that the user can create another notebook
+func checkNotebookLimit(db *gorm.DB, userID uuid.UUID) error {
+	limit := CurrentUsageLimit(UsageNotebooks)
+	if limit == (UsageLimit{}) {
+		return nil
+	}
+	var count int64
+	if err := db.Model(&models.Notebook{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	return checkUsageLimit(userID, UsageNotebooks, limit, count)
+}
+
+// checkBlockLimit checks that the user can add another block to the note
+func checkBlockLimit(db *gorm.DB, userID uuid.UUID, noteID string) error {
+	return checkBlocksLimit(db, userID, noteID, 1)
+}
+
+// checkBlocksLimit checks that the user can add adding blocks to the note
+// at once
+func checkBlocksLimit(db *gorm.DB, userID uuid.UUID, noteID string, adding int) error {
+	limit := CurrentUsageLimit(UsageBlocksPerNote)
+	if limit == (UsageLimit{}) || adding < 1 {
+		return nil
+	}
+	var count int64
+	if err := db.Model(&models.Block{}).Where("note_id = ?", noteID).Count(&count).Error; err != nil {
+		return err
+	}
+	// The last new block is the one that can pass the hard limit, while any
+	// of them can be the one passing the soft limit
+	last := count + int64(adding) - 1
+	if limit.Hard > 0 && last >= limit.Hard {
+		return &LimitExceededError{Resource: UsageBlocksPerNote, Limit: limit.Hard}
+	}
+	current := last
+	if limit.Soft >= count && limit.Soft <= last {
+		current = limit.Soft
+	}
+	return checkUsageLimit(userID, UsageBlocksPerNote, limit, current)
+}
+
+// ResourceUsage is how much of a resource a user has next to its limits.
+// For blocks it is the count of the user's fullest note.
+type ResourceUsage struct {
+	Usage int64 `json:"usage"`
+	UsageLimit
+}
+
+// GetUsageLimits reports the usage of each limited resource of the user
+func GetUsageLimits(db *database.Database, userID uuid.UUID) (map[string]ResourceUsage, error) {
+	usage := make(map[string]ResourceUsage, len(usageLimitEnvs))
+
+	var notes, notebooks int64
+	if err := db.DB.Model(&models.Note{}).Where("user_id = ?", userID).Count(&notes).Error; err != nil {
+		return nil, err
+	}
+	if err := db.DB.Model(&models.Notebook{}).Where("user_id = ?", userID).Count(&notebooks).Error; err != nil {
+		return nil, err
+	}
+
+	var fullest []int64
+	if err := db.DB.Model(&models.Block{}).
+		Where("note_id IN (?)", db.DB.Model(&models.Note{}).Select("id").Where("user_id = ?", userID)).
+		Group("note_id").Order("count(*) DESC").Limit(1).
+		Pluck("count(*)", &fullest).Error; err != nil {
+		return nil, err
+	}
+	var blocks int64
+	if len(fullest) > 0 {
+		blocks = fullest[0]
+	}
+
+	usage[UsageNotes] = ResourceUsage{Usage: notes, UsageLimit: CurrentUsageLimit(UsageNotes)}
+	usage[UsageNotebooks] = ResourceUsage{Usage: notebooks, UsageLimit: CurrentUsageLimit(UsageNotebooks)}
+	usage[UsageBlocksPerNote] = ResourceUsage{Usage: blocks, UsageLimit: CurrentUsageLimit(UsageBlocksPerNote)}
+	return usage, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateNotebook_UpToHardLimit(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	notifications := &recordingNotifications{}
+	original := NotificationServiceInstance
+	NotificationServiceInstance = notifications
+	defer func() { NotificationServiceInstance = original }()
+	t.Setenv("USAGE_MAX_NOTEBOOKS", "3")
+	t.Setenv("USAGE_MAX_NOTEBOOKS_SOFT", "2")
+
+	userID := uuid.New()
+	expectNotebookCount := func(count int) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(`SELECT count\(\*\) FROM "notebooks" WHERE user_id = \$1 AND "notebooks"."deleted_at" IS NULL`).
+			WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+	}
+	data := map[string]interface{}{"user_id": userID.String(), "name": "Imported"}
+
+	// The third notebook is the last allowed, and the first past the soft limit
+	expectNotebookCount(2)
+	mock.ExpectQuery(`INSERT INTO "notebooks"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectExec(`INSERT INTO "roles"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "events"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+
+	_, err := (&NotebookService{}).CreateNotebook(db, data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"usage.soft_limit_reached"}, notifications.eventTypes)
+	assert.Equal(t, []string{userID.String()}, notifications.userIDs)
+
+	// A fourth one is refused
+	expectNotebookCount(3)
+	mock.ExpectRollback()
+
+	_, err = (&NotebookService{}).CreateNotebook(db, data)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	var limitErr *LimitExceededError
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, UsageNotebooks, limitErr.Resource)
+	assert.EqualValues(t, 3, limitErr.Limit)
+	assert.Len(t, notifications.eventTypes, 1, "the soft limit warns once")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateNote_OverHardLimit(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+	t.Setenv("USAGE_MAX_NOTES", "100")
+
+	userID := uuid.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "notes" WHERE user_id = \$1 AND "notes"."deleted_at" IS NULL`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(120))
+	mock.ExpectRollback()
+
+	_, err := (&NoteService{}).CreateNote(db, map[string]interface{}{
+		"user_id":     userID.String(),
+		"notebook_id": uuid.New().String(),
+		"title":       "From a runaway loop",
+	})
+	assert.EqualError(t, err, "notes limit of 100 reached")
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckUsageLimit_Unlimited(t *testing.T) {
+	// No queries run when no limit is set
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	assert.NoError(t, checkNoteLimit(db.DB, uuid.New()))
+	assert.NoError(t, checkBlockLimit(db.DB, uuid.New(), uuid.New().String()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	t.Setenv("USAGE_MAX_BLOCKS_PER_NOTE", "many")
+	assert.Equal(t, UsageLimit{}, CurrentUsageLimit(UsageBlocksPerNote))
+}
@@ -0,0 +1,392 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	webhookTimeout     = 10 * time.Second
+	webhookMaxAttempts = 3
+	webhookWorkers     = 4
+	webhookQueueSize   = 256
+)
+
+// WebhookEventTypes are the events webhooks can subscribe to
+var WebhookEventTypes = []broker.EventType{
+	broker.NoteCreated, broker.NoteUpdated, broker.NoteDeleted, broker.NoteRestored,
+	broker.NotebookCreated, broker.NotebookUpdated, broker.NotebookDeleted, broker.NotebookRestored,
+	broker.TaskCreated, broker.TaskUpdated, broker.TaskDeleted,
+}
+
+// WebhookPayload is the JSON body POSTed to a webhook. ID is the event ID, so
+// receivers can drop a delivery they already processed.
+type WebhookPayload struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"` // NoteWebhookData, NotebookWebhookData or TaskWebhookData
+}
+
+// NoteWebhookData describes the note of a note.* event
+type NoteWebhookData struct {
+	NoteID     string   `json:"note_id"`
+	NotebookID string   `json:"notebook_id"`
+	UserID     string   `json:"user_id"`
+	Title      string   `json:"title,omitempty"`
+	Source     string   `json:"source,omitempty"`      // What created the note: api, agent_chain, ai_project...
+	MergedFrom []string `json:"merged_from,omitempty"` // Notes merged into this one
+	MergedInto string   `json:"merged_into,omitempty"` // Note this one was merged into
+	Reordered  bool     `json:"reordered,omitempty"`
+}
+
+// NotebookWebhookData describes the notebook of a notebook.* event
+type NotebookWebhookData struct {
+	NotebookID  string `json:"notebook_id"`
+	UserID      string `json:"user_id"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// TaskWebhookData describes the task of a task.* event
+type TaskWebhookData struct {
+	TaskID      string `json:"task_id"`
+	NoteID      string `json:"note_id,omitempty"`
+	NotebookID  string `json:"notebook_id,omitempty"`
+	UserID      string `json:"user_id"`
+	Title       string `json:"title,omitempty"`
+	IsCompleted bool   `json:"is_completed"`
+}
+
+type WebhookServiceInterface interface {
+	CreateWebhook(db *database.Database, webhookData map[string]interface{}, params map[string]interface{}) (models.Webhook, error)
+	GetWebhooks(db *database.Database, params map[string]interface{}) ([]models.Webhook, error)
+	DeleteWebhook(db *database.Database, id string, params map[string]interface{}) error
+	// Deliver sends a lifecycle event to the webhooks of its owner that
+	// subscribe to it. Requests are made in the background by a fixed
+	// number of workers; deliveries are dropped while the queue is full.
+	Deliver(db *database.Database, event models.Event)
+}
+
+type WebhookService struct {
+	client     *http.Client
+	retryDelay time.Duration
+
+	startOnce sync.Once
+	queue     chan webhookDelivery
+}
+
+// webhookDelivery is one POST waiting for a worker
+type webhookDelivery struct {
+	webhook models.Webhook
+	event   models.Event
+	body    []byte
+}
+
+var WebhookServiceInstance WebhookServiceInterface = NewWebhookService()
+
+func NewWebhookService() WebhookServiceInterface {
+	return &WebhookService{
+		// Webhook URLs are user supplied, so only public addresses are dialed
+		client:     newLinkClient(webhookTimeout),
+		retryDelay: 2 * time.Second,
+	}
+}
+
+// CreateWebhook registers a webhook. webhookData holds url, an optional
+// secret, event_types ([]string, exact types or "note.*" style wildcards)
+// and notebook_ids ([]string).
+func (s *WebhookService) CreateWebhook(db *database.Database, webhookData map[string]interface{}, params map[string]interface{}) (models.Webhook, error) {
+	userID, ok := params["user_id"].(string)
+	if !ok {
+		return models.Webhook{}, errors.New("user_id must be provided in parameters")
+	}
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("%w: invalid user id", ErrInvalidInput)
+	}
+
+	rawURL, _ := webhookData["url"].(string)
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return models.Webhook{}, fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidInput)
+	}
+	if err := checkLinkURL(parsed); err != nil {
+		return models.Webhook{}, fmt.Errorf("%w: webhook url must be a public address", ErrInvalidInput)
+	}
+
+	eventTypes, _ := webhookData["event_types"].([]string)
+	for _, eventType := range eventTypes {
+		if !isWebhookEventType(eventType) {
+			return models.Webhook{}, fmt.Errorf("%w: unknown event type %q", ErrInvalidInput, eventType)
+		}
+	}
+
+	notebookIDs := models.UUIDArray{}
+	if ids, _ := webhookData["notebook_ids"].([]string); len(ids) > 0 {
+		for _, id := range ids {
+			notebookID, err := uuid.Parse(id)
+			if err != nil {
+				return models.Webhook{}, fmt.Errorf("%w: invalid notebook id %q", ErrInvalidInput, id)
+			}
+			hasAccess, err := RoleServiceInstance.HasNotebookAccess(db, userID, id, "viewer")
+			if err != nil {
+				return models.Webhook{}, err
+			}
+			if !hasAccess {
+				return models.Webhook{}, fmt.Errorf("%w: notebook %s not found", ErrInvalidInput, id)
+			}
+			notebookIDs = append(notebookIDs, notebookID)
+		}
+	}
+
+	secret, _ := webhookData["secret"].(string)
+	webhook := models.Webhook{
+		ID:          uuid.New(),
+		UserID:      userUUID,
+		URL:         parsed.String(),
+		Secret:      secret,
+		EventTypes:  pq.StringArray(eventTypes),
+		NotebookIDs: notebookIDs,
+		Active:      true,
+	}
+	if err := db.DB.Create(&webhook).Error; err != nil {
+		return models.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// GetWebhooks lists the caller's webhooks
+func (s *WebhookService) GetWebhooks(db *database.Database, params map[string]interface{}) ([]models.Webhook, error) {
+	userID, ok := params["user_id"].(string)
+	if !ok {
+		return nil, errors.New("user_id must be provided in parameters")
+	}
+
+	var webhooks []models.Webhook
+	if err := db.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook removes one of the caller's webhooks, or returns ErrNotFound
+func (s *WebhookService) DeleteWebhook(db *database.Database, id string, params map[string]interface{}) error {
+	userID, ok := params["user_id"].(string)
+	if !ok {
+		return errors.New("user_id must be provided in parameters")
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("%w: invalid webhook id", ErrInvalidInput)
+	}
+
+	result := db.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Webhook{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *WebhookService) Deliver(db *database.Database, event models.Event) {
+	payload, userID, notebookID, ok := webhookPayloadFor(db, event)
+	if !ok {
+		return
+	}
+
+	var webhooks []models.Webhook
+	if err := db.DB.Where("user_id = ? AND active = ?", userID, true).Find(&webhooks).Error; err != nil {
+		log.Printf("Failed to load webhooks for event %s: %v", event.ID, err)
+		return
+	}
+
+	var body []byte
+	for _, webhook := range webhooks {
+		if !webhookMatches(webhook, event.Event, notebookID) {
+			continue
+		}
+		if body == nil {
+			var err error
+			if body, err = json.Marshal(payload); err != nil {
+				log.Printf("Failed to encode webhook payload for event %s: %v", event.ID, err)
+				return
+			}
+		}
+		s.enqueue(webhookDelivery{webhook: webhook, event: event, body: body})
+	}
+}
+
+// enqueue hands a delivery to the workers, starting them on first use
+func (s *WebhookService) enqueue(delivery webhookDelivery) {
+	s.startOnce.Do(func() {
+		s.queue = make(chan webhookDelivery, webhookQueueSize)
+		for i := 0; i < webhookWorkers; i++ {
+			go func() {
+				for d := range s.queue {
+					s.send(d.webhook, d.event, d.body)
+				}
+			}()
+		}
+	})
+
+	select {
+	case s.queue <- delivery:
+	default:
+		log.Printf("Webhook queue full, dropping delivery of event %s to webhook %s", delivery.event.ID, delivery.webhook.ID)
+	}
+}
+
+// send POSTs body to the webhook, retrying failed deliveries with a growing delay
+func (s *WebhookService) send(webhook models.Webhook, event models.Event, body []byte) {
+	var lastErr error
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * s.retryDelay)
+		}
+		if lastErr = s.post(webhook, event, body); lastErr == nil {
+			return
+		}
+	}
+	log.Printf("Webhook %s failed for event %s after %d attempts: %v", webhook.ID, event.ID, webhookMaxAttempts, lastErr)
+}
+
+func (s *WebhookService) post(webhook models.Webhook, event models.Event, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Owlistic-Event", event.Event)
+	req.Header.Set("X-Owlistic-Delivery", event.ID.String())
+	if webhook.Secret != "" {
+		req.Header.Set("X-Owlistic-Signature", "sha256="+signWebhookBody(webhook.Secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signWebhookBody returns the hex HMAC-SHA256 of body, which receivers
+// recompute with their copy of the secret
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookPayloadFor builds the payload of a lifecycle event along with the
+// owner and notebook it is filtered by. ok is false for other events.
+func webhookPayloadFor(db *database.Database, event models.Event) (payload WebhookPayload, userID, notebookID string, ok bool) {
+	if !isWebhookEventType(event.Event) || strings.HasSuffix(event.Event, ".*") {
+		return WebhookPayload{}, "", "", false
+	}
+
+	var data interface{}
+	switch event.Entity {
+	case "note":
+		var note NoteWebhookData
+		if err := json.Unmarshal(event.Data, &note); err != nil {
+			return WebhookPayload{}, "", "", false
+		}
+		data, userID, notebookID = note, note.UserID, note.NotebookID
+	case "notebook":
+		var notebook NotebookWebhookData
+		if err := json.Unmarshal(event.Data, &notebook); err != nil {
+			return WebhookPayload{}, "", "", false
+		}
+		data, userID, notebookID = notebook, notebook.UserID, notebook.NotebookID
+	case "task":
+		var task TaskWebhookData
+		if err := json.Unmarshal(event.Data, &task); err != nil {
+			return WebhookPayload{}, "", "", false
+		}
+		if task.NoteID != "" {
+			// Unscoped so events of tasks in trashed notes still resolve
+			var note models.Note
+			if err := db.DB.Unscoped().Select("notebook_id").Where("id = ?", task.NoteID).First(&note).Error; err == nil {
+				task.NotebookID = note.NotebookID.String()
+			}
+		}
+		data, userID, notebookID = task, task.UserID, task.NotebookID
+	default:
+		return WebhookPayload{}, "", "", false
+	}
+	if userID == "" {
+		return WebhookPayload{}, "", "", false
+	}
+
+	return WebhookPayload{
+		ID:        event.ID.String(),
+		Type:      event.Event,
+		Timestamp: event.Timestamp,
+		Data:      data,
+	}, userID, notebookID, true
+}
+
+// webhookMatches reports whether the webhook subscribes to eventType in notebookID
+func webhookMatches(webhook models.Webhook, eventType, notebookID string) bool {
+	if len(webhook.EventTypes) > 0 {
+		subscribed := false
+		for _, pattern := range webhook.EventTypes {
+			if pattern == eventType || (strings.HasSuffix(pattern, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(pattern, "*"))) {
+				subscribed = true
+				break
+			}
+		}
+		if !subscribed {
+			return false
+		}
+	}
+
+	if len(webhook.NotebookIDs) > 0 {
+		for _, id := range webhook.NotebookIDs {
+			if id.String() == notebookID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// isWebhookEventType accepts the lifecycle event types and their "<entity>.*" wildcards
+func isWebhookEventType(eventType string) bool {
+	for _, known := range WebhookEventTypes {
+		entity := strings.SplitN(string(known), ".", 2)[0]
+		if eventType == string(known) || eventType == entity+".*" {
+			return true
+		}
+	}
+	return false
+}
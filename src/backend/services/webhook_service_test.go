@@ -0,0 +1,214 @@
+package services
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// capturedJSON matches any argument and keeps it, to inspect what was stored
+type capturedJSON struct{ value []byte }
+
+func (c *capturedJSON) Match(v driver.Value) bool {
+	if b, ok := v.([]byte); ok {
+		c.value = b
+	}
+	return true
+}
+
+// expectCreateNote expects the queries of NoteService.CreateNote and returns
+// the captured data of the note.created event it stores
+func expectCreateNote(dbMock sqlmock.Sqlmock) *capturedJSON {
+	eventData := &capturedJSON{}
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery(`SELECT count\(\*\) FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	dbMock.ExpectQuery(`SELECT count\(\*\) FROM "notebooks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	dbMock.ExpectQuery(`SELECT COALESCE\(preferences`).
+		WillReturnRows(sqlmock.NewRows([]string{"placement"}).AddRow(""))
+	dbMock.ExpectQuery(`SELECT COALESCE\(MIN\(position\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(0.0))
+	dbMock.ExpectQuery(`INSERT INTO "notes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(time.Now(), time.Now()))
+	dbMock.ExpectExec(`INSERT INTO "roles"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery(`INSERT INTO "blocks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	dbMock.ExpectQuery(`INSERT INTO "events"`).
+		WithArgs("note.created", 1, "note", sqlmock.AnyArg(), eventData, "pending", false, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	dbMock.ExpectCommit()
+	dbMock.ExpectQuery(`SELECT \* FROM "notes" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(uuid.New(), "Mirror me"))
+	dbMock.ExpectQuery(`SELECT \* FROM "blocks" WHERE "blocks"."note_id" = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	return eventData
+}
+
+func TestCreateNote_DeliversNoteCreatedWebhook(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan delivery, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{header: r.Header, body: body}
+	}))
+	defer server.Close()
+
+	userID, notebookID := uuid.New(), uuid.New()
+
+	// Creating the note stores a note.created event
+	eventData := expectCreateNote(dbMock)
+
+	_, err := (&NoteService{}).CreateNote(db, map[string]interface{}{
+		"title":       "Mirror me",
+		"user_id":     userID.String(),
+		"notebook_id": notebookID.String(),
+		"source":      "telegram",
+	})
+	require.NoError(t, err)
+	var stored map[string]interface{}
+	require.NoError(t, json.Unmarshal(eventData.value, &stored))
+
+	// Dispatching the event delivers it to the owner's subscribed webhook
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`UPDATE "events" SET`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`DELETE FROM "ai_artifacts"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectCommit()
+	dbMock.ExpectQuery(`SELECT \* FROM "webhooks" WHERE \(user_id = \$1 AND active = \$2\)`).
+		WithArgs(userID.String(), true).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "url", "secret", "event_types", "notebook_ids", "active"}).
+			AddRow(uuid.New(), userID, server.URL, "s3cret", pq.StringArray{"note.created"}, "{"+notebookID.String()+"}", true).
+			AddRow(uuid.New(), userID, server.URL, "", pq.StringArray{"task.*"}, "{}", true))
+
+	producer := NewMockProducer()
+	producer.On("PublishMessage", mock.Anything, mock.Anything).Return(nil)
+	handler := &EventHandlerService{db: db, producer: producer, webhooks: &WebhookService{client: server.Client()}}
+
+	event := models.Event{ID: uuid.New(), Event: "note.created", Entity: "note", Timestamp: time.Now().UTC(), Data: eventData.value}
+	require.NoError(t, handler.dispatchEvent(event))
+
+	select {
+	case got := <-received:
+		assert.Equal(t, "note.created", got.header.Get("X-Owlistic-Event"))
+		assert.Equal(t, event.ID.String(), got.header.Get("X-Owlistic-Delivery"))
+		assert.Equal(t, "sha256="+signWebhookBody("s3cret", got.body), got.header.Get("X-Owlistic-Signature"))
+
+		var payload struct {
+			ID   string          `json:"id"`
+			Type string          `json:"type"`
+			Data NoteWebhookData `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(got.body, &payload))
+		assert.Equal(t, event.ID.String(), payload.ID)
+		assert.Equal(t, "note.created", payload.Type)
+		assert.Equal(t, NoteWebhookData{
+			NoteID:     stored["note_id"].(string),
+			NotebookID: notebookID.String(),
+			UserID:     userID.String(),
+			Title:      "Mirror me",
+			Source:     "telegram",
+		}, payload.Data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+
+	// The task.* webhook isn't called for a note event
+	select {
+	case <-received:
+		t.Fatal("unsubscribed webhook was called")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestWebhookMatches(t *testing.T) {
+	notebookID := uuid.New()
+
+	all := models.Webhook{}
+	assert.True(t, webhookMatches(all, "task.deleted", ""))
+
+	typed := models.Webhook{EventTypes: pq.StringArray{"note.created", "notebook.*"}}
+	assert.True(t, webhookMatches(typed, "note.created", ""))
+	assert.True(t, webhookMatches(typed, "notebook.deleted", ""))
+	assert.False(t, webhookMatches(typed, "note.updated", ""))
+
+	scoped := models.Webhook{NotebookIDs: models.UUIDArray{notebookID}}
+	assert.True(t, webhookMatches(scoped, "note.updated", notebookID.String()))
+	assert.False(t, webhookMatches(scoped, "note.updated", uuid.New().String()))
+	assert.False(t, webhookMatches(scoped, "task.created", ""), "events without a notebook don't match a notebook filter")
+}
+
+func TestCreateWebhook_Validation(t *testing.T) {
+	withAllowAllRoles(t)
+	db, _, close := testutils.SetupMockDB()
+	defer close()
+
+	service := &WebhookService{}
+	params := map[string]interface{}{"user_id": uuid.New().String()}
+	for _, data := range []map[string]interface{}{
+		{"url": "not a url"},
+		{"url": "ftp://example.com/hook"},
+		{"url": "https://example.com/hook", "event_types": []string{"block.created"}},
+		{"url": "https://example.com/hook", "event_types": []string{"note.*", "note.moved"}},
+		{"url": "https://example.com/hook", "notebook_ids": []string{"nope"}},
+		{"url": "http://127.0.0.1:8080/hook"},
+		{"url": "http://localhost/hook"},
+		{"url": "http://169.254.169.254/latest/meta-data"},
+	} {
+		_, err := service.CreateWebhook(db, data, params)
+		assert.ErrorIs(t, err, ErrInvalidInput, "%v", data)
+	}
+}
+
+func TestWebhookService_RefusesInternalAddresses(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer server.Close()
+
+	// A host name resolving to a private address is refused when dialing
+	service := NewWebhookService().(*WebhookService)
+	err := service.post(models.Webhook{ID: uuid.New(), URL: server.URL}, models.Event{ID: uuid.New(), Event: "note.created"}, []byte(`{}`))
+	assert.ErrorIs(t, err, ErrBlockedAddress)
+	assert.Zero(t, atomic.LoadInt32(&hits))
+}
+
+func TestWebhookPayloadFor_SkipsOtherEvents(t *testing.T) {
+	db, _, close := testutils.SetupMockDB()
+	defer close()
+
+	for _, event := range []models.Event{
+		{Event: "block.created", Entity: "block", Data: []byte(`{"user_id":"u"}`)},
+		{Event: "note.created", Entity: "note", Data: []byte(`{"note_id":"n"}`)}, // No owner
+	} {
+		_, _, _, ok := webhookPayloadFor(db, event)
+		assert.False(t, ok, event.Event)
+	}
+}
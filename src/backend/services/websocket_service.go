@@ -189,6 +189,12 @@ func (s *WebSocketService) readPump(connID string, wsConn *websocketConnection)
 		s.connMutex.Unlock()
 		wsConn.conn.Close()
 		close(wsConn.send)
+		// Editing locks taken over this connection end with it
+		if s.db != nil {
+			if err := NoteLockServiceInstance.ReleaseClientLocks(s.db, connID); err != nil {
+				log.Printf("Failed to release note locks for %s: %v", connID, err)
+			}
+		}
 		log.Printf("WebSocket connection closed: %s", connID)
 	}()
 
@@ -259,6 +265,10 @@ func (s *WebSocketService) readPump(connID string, wsConn *websocketConnection)
 				// Handle presence notifications
 				log.Printf("User %s sent presence event", wsConn.userID)
 
+			case "note.lock", "note.unlock":
+				// Editing clients hold an advisory lock so background jobs leave the note alone
+				s.handleNoteLockEvent(connID, wsConn, &clientMsg)
+
 			case "typing":
 				// Handle typing indicators
 				log.Printf("User %s sent typing event", wsConn.userID)
@@ -378,6 +388,38 @@ func (s *WebSocketService) readPump(connID string, wsConn *websocketConnection)
 	}
 }
 
+// handleNoteLockEvent takes or releases a note editing lock for a client
+func (s *WebSocketService) handleNoteLockEvent(connID string, wsConn *websocketConnection, clientMsg *models.StandardMessage) {
+	if clientMsg.ResourceID == "" {
+		log.Printf("User %s sent %s without a note id", wsConn.userID, clientMsg.Event)
+		return
+	}
+
+	params := map[string]interface{}{
+		"user_id":   wsConn.userID.String(),
+		"client_id": connID,
+	}
+	if ttl, ok := clientMsg.Payload["ttl_seconds"]; ok {
+		params["ttl_seconds"] = ttl
+	}
+
+	var err error
+	if clientMsg.Event == "note.lock" {
+		_, err = NoteLockServiceInstance.AcquireLock(s.db, clientMsg.ResourceID, params)
+	} else {
+		err = NoteLockServiceInstance.ReleaseLock(s.db, clientMsg.ResourceID, params)
+	}
+	if err != nil {
+		log.Printf("Failed to handle %s for note %s: %v", clientMsg.Event, clientMsg.ResourceID, err)
+		errorMsg := models.NewStandardMessage(models.ErrorMessage, clientMsg.Event, map[string]interface{}{
+			"message": "Failed to update note lock",
+			"error":   err.Error(),
+		}).WithResource("note", clientMsg.ResourceID)
+		errorBytes, _ := json.Marshal(errorMsg)
+		wsConn.send <- errorBytes
+	}
+}
+
 func (s *WebSocketService) writePump(connID string, wsConn *websocketConnection) {
 	ticker := time.NewTicker(30 * time.Second) // More frequent pings (30s instead of 54s)
 	defer func() {
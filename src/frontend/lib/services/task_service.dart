@@ -16,6 +16,8 @@ class TaskService extends BaseService {
       
       if (completed != null) params['is_completed'] = completed;
       if (noteId != null) params['note_id'] = noteId;
+      // The list defaults to a lightweight set; tasks need their description and block link
+      params['fields'] = 'id,user_id,note_id,title,description,is_completed,due_date,metadata,created_at,updated_at';
       
       if (queryParams != null) {
         params.addAll(queryParams);